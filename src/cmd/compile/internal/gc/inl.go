@@ -46,6 +46,8 @@ const (
 
 	inlineBigFunctionNodes   = 5000 // Functions with this many nodes are considered "big".
 	inlineBigFunctionMaxCost = 20   // Max cost of inlinee when inlining into a "big" function.
+
+	inlineHotMaxBudget = 2000 // Max cost of inlinee when inlining at a hot call site; see pgo.go.
 )
 
 // Get the function's package. For ordinary functions it's on the ->sym, but for imported methods
@@ -201,8 +203,15 @@ func caninl(fn *Node) {
 	// locals, and we use this map to produce a pruned Inline.Dcl
 	// list. See issue 25249 for more context.
 
+	// Callees of hot call sites get a bigger budget. mkinlcall
+	// only inlines them beyond inlineMaxBudget at hot call sites.
+	budget := int32(inlineMaxBudget)
+	if pgoHotCallee(n) {
+		budget = inlineHotMaxBudget
+	}
+
 	visitor := hairyVisitor{
-		budget:        inlineMaxBudget,
+		budget:        budget,
 		extraCallCost: cc,
 		usedLocals:    make(map[*Node]bool),
 	}
@@ -211,12 +220,12 @@ func caninl(fn *Node) {
 		return
 	}
 	if visitor.budget < 0 {
-		reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", inlineMaxBudget-visitor.budget, inlineMaxBudget)
+		reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", budget-visitor.budget, budget)
 		return
 	}
 
 	n.Func.Inl = &Inline{
-		Cost: inlineMaxBudget - visitor.budget,
+		Cost: budget - visitor.budget,
 		Dcl:  inlcopylist(pruneUnusedAutos(n.Name.Defn.Func.Dcl, &visitor)),
 		Body: inlcopylist(fn.Nbody.Slice()),
 	}
@@ -226,12 +235,12 @@ func caninl(fn *Node) {
 	fn.Type.FuncType().Nname = asTypesNode(n)
 
 	if Debug.m > 1 {
-		fmt.Printf("%v: can inline %#v with cost %d as: %#v { %#v }\n", fn.Line(), n, inlineMaxBudget-visitor.budget, fn.Type, asNodes(n.Func.Inl.Body))
+		fmt.Printf("%v: can inline %#v with cost %d as: %#v { %#v }\n", fn.Line(), n, n.Func.Inl.Cost, fn.Type, asNodes(n.Func.Inl.Body))
 	} else if Debug.m != 0 {
 		fmt.Printf("%v: can inline %v\n", fn.Line(), n)
 	}
 	if logopt.Enabled() {
-		logopt.LogOpt(fn.Pos, "canInlineFunction", "inline", fn.funcname(), fmt.Sprintf("cost: %d", inlineMaxBudget-visitor.budget))
+		logopt.LogOpt(fn.Pos, "canInlineFunction", "inline", fn.funcname(), fmt.Sprintf("cost: %d", n.Func.Inl.Cost))
 	}
 }
 
@@ -591,7 +600,7 @@ func inlnode(n *Node, maxCost int32, inlMap map[*Node]bool) *Node {
 	switch n.Op {
 	case ODEFER, OGO:
 		switch n.Left.Op {
-		case OCALLFUNC, OCALLMETH:
+		case OCALLFUNC, OCALLMETH, OCALLINTER:
 			n.Left.SetNoInline(true)
 		}
 
@@ -675,7 +684,7 @@ func inlnode(n *Node, maxCost int32, inlMap map[*Node]bool) *Node {
 	// transmogrify this node itself unless inhibited by the
 	// switch at the top of this function.
 	switch n.Op {
-	case OCALLFUNC, OCALLMETH:
+	case OCALLFUNC, OCALLMETH, OCALLINTER:
 		if n.NoInline() {
 			return n
 		}
@@ -708,6 +717,11 @@ func inlnode(n *Node, maxCost int32, inlMap map[*Node]bool) *Node {
 		}
 
 		n = mkinlcall(n, asNode(n.Left.Type.FuncType().Nname), maxCost, inlMap)
+
+	case OCALLINTER:
+		if t := pgoDevirtualizeType(n); t != nil {
+			n = mkpgodevirtcall(n, t, maxCost, inlMap)
+		}
 	}
 
 	lineno = lno
@@ -909,9 +923,11 @@ func mkinlcall(n, fn *Node, maxCost int32, inlMap map[*Node]bool) *Node {
 		}
 		return n
 	}
-	if fn.Func.Inl.Cost > maxCost {
+	if fn.Func.Inl.Cost > maxCost && (maxCost < inlineMaxBudget || fn.Func.Inl.Cost > inlineHotMaxBudget || !pgoHotCallSite(n)) {
 		// The inlined function body is too big. Typically we use this check to restrict
 		// inlining into very big functions.  See issue 26546 and 17566.
+		// Hot call sites may inline bigger functions, unless the caller
+		// is itself big.
 		if logopt.Enabled() {
 			logopt.LogOpt(n.Pos, "cannotInlineCall", "inline", Curfn.funcname(),
 				fmt.Sprintf("cost %d of %s exceeds max large caller cost %d", fn.Func.Inl.Cost, fn.pkgFuncName(), maxCost))
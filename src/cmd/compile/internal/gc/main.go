@@ -253,6 +253,7 @@ func Main(archInit func(*Arch)) {
 	}
 	flag.BoolVar(&nolocalimports, "nolocalimports", false, "reject local (relative) imports")
 	flag.StringVar(&outfile, "o", "", "write output to `file`")
+	flag.StringVar(&pgoProfile, "pgoprofile", "", "read profile from `file` for profile-guided optimization")
 	flag.StringVar(&myimportpath, "p", "", "set expected package import `path`")
 	flag.BoolVar(&writearchive, "pack", false, "write to file.a instead of file.o")
 	if sys.RaceDetectorSupported(objabi.GOOS, objabi.GOARCH) {
@@ -684,6 +685,10 @@ func Main(archInit func(*Arch)) {
 		}
 	}
 
+	if pgoProfile != "" {
+		readPGOProfile(pgoProfile)
+	}
+
 	if Debug.l != 0 {
 		// Find functions that can be inlined and clone them before walk expands them.
 		visitBottomUp(xtop, func(list []*Node, recursive bool) {
@@ -0,0 +1,435 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Profile-guided optimization.
+//
+// With -pgoprofile=file, the compiler reads a CPU profile in the
+// format written by runtime/pprof and uses it to focus inlining and
+// devirtualization on the code that is hot in practice.
+//
+// The profile is reduced to a set of weighted call edges, each from
+// a call site (the calling function and the line of the call) to a
+// callee. The heaviest edges, which together account for
+// pgoHotCallSiteCDF percent of the total edge weight, are hot:
+//
+//   - A function that is the callee of a hot edge may be inlined if
+//     its cost is within inlineHotMaxBudget, rather than the usual
+//     inlineMaxBudget, and a hot call site inlines such callees.
+//
+//   - A hot interface method call is devirtualized to the concrete
+//     method it calls most often in the profile, behind a type
+//     assertion:
+//
+//	if c, ok := x.(T); ok {
+//		c.M(args) // a direct call, which may then be inlined
+//	} else {
+//		x.M(args)
+//	}
+//
+// Functions are identified by symbol name and call sites by line
+// number, so a profile of a slightly older version of the program
+// remains mostly useful.
+
+package gc
+
+import (
+	"cmd/compile/internal/types"
+	"cmd/internal/objabi"
+	"cmd/internal/src"
+	"internal/profile"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pgoHotCallSiteCDF is the percentage of the total call edge weight
+// in the profile accounted for by the hot call edges.
+const pgoHotCallSiteCDF = 99
+
+var pgoProfile string // -pgoprofile flag
+
+// A pgoCallSite identifies a call site in the profile.
+type pgoCallSite struct {
+	caller string // symbol name of the calling function
+	line   int64  // line number of the call
+}
+
+var (
+	// pgoEdges maps each call site in the profile to the weight of
+	// each of its callees, by symbol name.
+	pgoEdges map[pgoCallSite]map[string]int64
+
+	// pgoHotSites and pgoHotCallees are the call sites and callees
+	// of the hot call edges.
+	pgoHotSites   map[pgoCallSite]bool
+	pgoHotCallees map[string]bool
+)
+
+// readPGOProfile reads the profile in file and determines the hot
+// call edges.
+func readPGOProfile(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("-pgoprofile: %v", err)
+	}
+	p, err := profile.Parse(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("-pgoprofile: %s: %v", file, err)
+	}
+	if len(p.SampleType) == 0 {
+		log.Fatalf("-pgoprofile: %s: profile has no sample types", file)
+	}
+
+	// Weigh samples by CPU time if the profile has it, and
+	// otherwise by the last sample value.
+	value := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == "cpu" {
+			value = i
+		}
+	}
+
+	pgoEdges = make(map[pgoCallSite]map[string]int64)
+	for _, s := range p.Sample {
+		w := s.Value[value]
+		if w <= 0 {
+			continue
+		}
+		// Walk the stack from the leaf up. Locations are ordered
+		// leaf first, and so are the inlined frames within each
+		// location, so every frame calls the one before it.
+		callee := ""
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				if callee != "" {
+					site := pgoCallSite{caller: line.Function.Name, line: line.Line}
+					m := pgoEdges[site]
+					if m == nil {
+						m = make(map[string]int64)
+						pgoEdges[site] = m
+					}
+					m[callee] += w
+				}
+				callee = line.Function.Name
+			}
+		}
+	}
+
+	var edges []pgoEdge
+	var total int64
+	for site, callees := range pgoEdges {
+		for callee, w := range callees {
+			edges = append(edges, pgoEdge{site, callee, w})
+			total += w
+		}
+	}
+	sort.Sort(byPGOWeight(edges))
+
+	pgoHotSites = make(map[pgoCallSite]bool)
+	pgoHotCallees = make(map[string]bool)
+	var cum int64
+	for _, e := range edges {
+		if cum*100 >= total*pgoHotCallSiteCDF {
+			break
+		}
+		cum += e.weight
+		pgoHotSites[e.site] = true
+		pgoHotCallees[e.callee] = true
+	}
+}
+
+// A pgoEdge is a call edge in the profile.
+type pgoEdge struct {
+	site   pgoCallSite
+	callee string
+	weight int64
+}
+
+// byPGOWeight sorts call edges by decreasing weight. Ties are broken
+// by name and line so that hot edges are chosen deterministically.
+type byPGOWeight []pgoEdge
+
+func (x byPGOWeight) Len() int      { return len(x) }
+func (x byPGOWeight) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x byPGOWeight) Less(i, j int) bool {
+	a, b := x[i], x[j]
+	if a.weight != b.weight {
+		return a.weight > b.weight
+	}
+	if a.site.caller != b.site.caller {
+		return a.site.caller < b.site.caller
+	}
+	if a.site.line != b.site.line {
+		return a.site.line < b.site.line
+	}
+	return a.callee < b.callee
+}
+
+// pgoSymName returns the symbol name name, which may use the ""
+// placeholder for the local package, as it appears in profiles.
+func pgoSymName(name string) string {
+	if strings.HasPrefix(name, `"".`) {
+		return objabi.PathToPrefix(myimportpath) + name[2:]
+	}
+	return name
+}
+
+// pgoFuncName returns the name of the function ONAME fn as it
+// appears in profiles.
+func pgoFuncName(fn *Node) string {
+	return pgoSymName(fn.Sym.LinksymName())
+}
+
+// pgoSite returns the call site in Curfn at pos. If pos is within
+// a function inlined into Curfn, the call site belongs to the
+// inlined function.
+func pgoSite(pos src.XPos) pgoCallSite {
+	p := Ctxt.InnermostPos(pos)
+	caller := pgoFuncName(Curfn.Func.Nname)
+	if ix := p.Base().InliningIndex(); ix >= 0 {
+		caller = pgoSymName(Ctxt.InlTree.InlinedFunction(ix).Name)
+	}
+	return pgoCallSite{caller: caller, line: int64(p.RelLine())}
+}
+
+// pgoHotCallSite reports whether the call n in Curfn is hot.
+func pgoHotCallSite(n *Node) bool {
+	if pgoHotSites == nil || Curfn.Func.Pragma&Nosplit != 0 {
+		// Don't grow nosplit functions, which could
+		// overflow their limited stack.
+		return false
+	}
+	return pgoHotSites[pgoSite(n.Pos)]
+}
+
+// pgoHotCallee reports whether fn, a function ONAME, is the callee of
+// a hot call edge.
+func pgoHotCallee(fn *Node) bool {
+	return pgoHotCallees != nil && pgoHotCallees[pgoFuncName(fn)]
+}
+
+// pgoDevirtualizeType returns the concrete receiver type to which
+// the interface method call n should be devirtualized, or nil if n is
+// not a hot call site or the profile doesn't suggest a usable type.
+func pgoDevirtualizeType(n *Node) *types.Type {
+	if n.Op != OCALLINTER || n.Left.Op != ODOTINTER || !pgoHotCallSite(n) {
+		return nil
+	}
+	if n.List.Len() == 1 && n.List.First().Type.IsFuncArgStruct() {
+		// f(g()) with multiple results; not worth the trouble.
+		return nil
+	}
+
+	// Find the hottest callee.
+	var callee string
+	var weight int64
+	for c, w := range pgoEdges[pgoSite(n.Pos)] {
+		if w > weight || w == weight && c < callee {
+			callee, weight = c, w
+		}
+	}
+
+	t, method := pgoMethodType(callee)
+	if t == nil || t.IsInterface() || method != n.Left.Sym.Name {
+		return nil
+	}
+	var missing, have *types.Field
+	var ptr int
+	if !implements(t, n.Left.Left.Type, &missing, &have, &ptr) {
+		return nil
+	}
+	return t
+}
+
+// pgoMethodType parses name, the symbol name of a method as it
+// appears in profiles, and returns its receiver type and method name.
+// It returns a nil type if name is not a method of a type known to
+// this compilation.
+//
+// A profile name of the form (*T).M, where M is declared on T, may
+// come from a call through an interface holding either a T or a *T,
+// as the autogenerated (*T).M wrapper serves both. pgoMethodType
+// chooses T in that case.
+func pgoMethodType(name string) (*types.Type, string) {
+	// Split off the package prefix, which extends to the first dot
+	// after the last slash.
+	i := strings.LastIndex(name, "/")
+	dot := strings.Index(name[i+1:], ".")
+	if dot < 0 {
+		return nil, ""
+	}
+	dot += i + 1
+	path, rest := pgoUnescape(name[:dot]), name[dot+1:]
+
+	var tname, method string
+	ptr := strings.HasPrefix(rest, "(*")
+	if ptr {
+		j := strings.Index(rest, ").")
+		if j < 0 {
+			return nil, ""
+		}
+		tname, method = rest[2:j], rest[j+2:]
+	} else {
+		j := strings.Index(rest, ".")
+		if j < 0 {
+			return nil, ""
+		}
+		tname, method = rest[:j], rest[j+1:]
+	}
+	if strings.Contains(method, ".") {
+		// A closure within a method, or an unexported method
+		// from another package.
+		return nil, ""
+	}
+
+	pkg := localpkg
+	if path != myimportpath {
+		pkg = types.LookupPkg(path)
+		if pkg == nil {
+			return nil, ""
+		}
+	}
+	s, ok := pkg.LookupOK(tname)
+	if !ok {
+		return nil, ""
+	}
+	n := resolve(asNode(s.Def))
+	if n == nil || n.Op != OTYPE || n.Type == nil {
+		return nil, ""
+	}
+	t := n.Type
+	if ptr {
+		for _, f := range t.Methods().Slice() {
+			if f.Sym.Name == method && !f.Type.Recv().Type.IsPtr() {
+				ptr = false
+			}
+		}
+	}
+	if ptr {
+		t = types.NewPtr(t)
+	}
+	return t, method
+}
+
+// pgoUnescape undoes the %xx escaping that objabi.PathToPrefix
+// applies to package paths in symbol names.
+func pgoUnescape(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if hi, lo := unhex(s[i+1]), unhex(s[i+2]); hi >= 0 && lo >= 0 {
+				b = append(b, byte(hi<<4|lo))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// mkpgodevirtcall returns an OINLCALL that devirtualizes the interface
+// method call n to the concrete receiver type t, with a fallback to n
+// for receivers of other types. The direct call is itself considered
+// for inlining.
+func mkpgodevirtcall(n *Node, t *types.Type, maxCost int32, inlMap map[*Node]bool) *Node {
+	sel := n.Left
+	pos := n.Pos
+	if Debug.m != 0 {
+		Warnl(pos, "PGO devirtualizing %v to %v", sel, t)
+	}
+
+	// Evaluate the receiver and arguments once, up front.
+	var init Nodes
+	init.AppendNodes(&n.Ninit)
+	tmp := func(x *Node) *Node {
+		v := temp(x.Type)
+		init.Append(typecheck(nodl(pos, OAS, v, x), ctxStmt))
+		return v
+	}
+	recv := tmp(sel.Left)
+	args := make([]*Node, n.List.Len())
+	for i, a := range n.List.Slice() {
+		args[i] = tmp(a)
+	}
+
+	var results []*Node
+	if n.Type != nil {
+		if n.Type.IsFuncArgStruct() {
+			for _, f := range n.Type.FieldSlice() {
+				results = append(results, temp(f.Type))
+			}
+		} else {
+			results = append(results, temp(n.Type))
+		}
+	}
+	call := func(x *Node, noinline bool) *Node {
+		c := nodl(pos, OCALL, nodlSym(pos, OXDOT, x, sel.Sym), nil)
+		c.List.Set(args)
+		c.SetIsDDD(n.IsDDD())
+		c.SetNoInline(noinline)
+		switch len(results) {
+		case 0:
+			return typecheck(c, ctxStmt)
+		case 1:
+			return typecheck(nodl(pos, OAS, results[0], c), ctxStmt)
+		}
+		as := nodl(pos, OAS2, nil, nil)
+		as.List.Set(results)
+		as.Rlist.Set1(c)
+		return typecheck(as, ctxStmt)
+	}
+
+	// c, ok := recv.(t)
+	c := temp(t)
+	ok := temp(types.Types[TBOOL])
+	assert := nodl(pos, ODOTTYPE, recv, nil)
+	assert.Type = t
+	as := nodl(pos, OAS2, nil, nil)
+	as.List.Set2(c, ok)
+	as.Rlist.Set1(assert)
+	as = typecheck(as, ctxStmt)
+
+	// if ok { c.M(args) } else { recv.M(args) }
+	// The fallback call must not be devirtualized again.
+	nif := nodl(pos, OIF, ok, nil)
+	nif.Nbody.Set1(call(c, false))
+	nif.Rlist.Set1(call(recv, true))
+	nif = typecheck(nif, ctxStmt)
+
+	inl := nodl(pos, OINLCALL, nil, nil)
+	inl.Ninit.Set(init.Slice())
+	inl.Nbody.Set2(as, nif)
+	inl.Rlist.Set(results)
+	inl.Type = n.Type
+	inl.SetTypecheck(1)
+
+	inlnodelist(inl.Nbody, maxCost, inlMap)
+	for _, n := range inl.Nbody.Slice() {
+		if n.Op == OINLCALL {
+			inlconv2stmt(n)
+		}
+	}
+	return inl
+}
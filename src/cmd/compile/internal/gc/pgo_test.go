@@ -0,0 +1,155 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gc
+
+import (
+	"internal/profile"
+	"internal/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pgoSrc = `package main
+
+type Adder interface {
+	Add(a, b int) int
+}
+
+type add struct{}
+
+func (add) Add(a, b int) int { return a + b }
+
+func big(x int) int {
+	for i := 0; i < 10; i++ {
+		x = x*31 + i
+		x ^= x >> 3
+		x += x << 2
+		x = x*17 + i
+		x ^= x >> 5
+		x += x << 1
+		x = x*13 + i
+		x ^= x >> 7
+		x += x << 4
+		x = x*11 + i
+		x ^= x >> 9
+		x += x << 3
+		x = x*7 + i
+		x ^= x >> 11
+		x += x << 5
+		if x%7 == 0 {
+			x++
+		}
+	}
+	return x
+}
+
+func run(a Adder, n int) int {
+	s := 0
+	for i := 0; i < n; i++ {
+		s += a.Add(i, s) // hot interface call
+		s += big(s)      // hot call
+	}
+	return s
+}
+
+func main() {
+	println(run(add{}, 1000))
+}
+`
+
+// pgoLine returns the line number of the line in pgoSrc containing marker.
+func pgoLine(t *testing.T, marker string) int64 {
+	for i, l := range strings.Split(pgoSrc, "\n") {
+		if strings.Contains(l, marker) {
+			return int64(i + 1)
+		}
+	}
+	t.Fatalf("marker %q not found", marker)
+	return 0
+}
+
+// writePGOProfile writes a CPU profile to file in which main.run
+// spends all its time calling add.Add and big.
+func writePGOProfile(t *testing.T, file string) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+	}
+	loc := func(fn string, line int64) *profile.Location {
+		f := &profile.Function{ID: uint64(len(p.Function) + 1), Name: fn, SystemName: fn, Filename: "x.go"}
+		p.Function = append(p.Function, f)
+		l := &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: f, Line: line}}}
+		p.Location = append(p.Location, l)
+		return l
+	}
+	main := loc("main.main", pgoLine(t, "println(run"))
+	p.Sample = []*profile.Sample{{
+		Location: []*profile.Location{loc("main.add.Add", pgoLine(t, "func (add) Add")), loc("main.run", pgoLine(t, "hot interface call")), main},
+		Value:    []int64{100, 1000000000},
+	}, {
+		Location: []*profile.Location{loc("main.big", pgoLine(t, "x = x*31")), loc("main.run", pgoLine(t, "hot call")), main},
+		Value:    []int64{300, 3000000000},
+	}}
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPGO tests that a profile makes the compiler devirtualize a hot
+// interface call and inline a hot callee that exceeds the usual budget.
+func TestPGO(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	dir, err := ioutil.TempDir("", "TestPGO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(pgoSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prof := filepath.Join(dir, "cpu.pprof")
+	writePGOProfile(t, prof)
+
+	compile := func(args ...string) string {
+		args = append([]string{"tool", "compile", "-p", "main", "-m", "-o", filepath.Join(dir, "x.o")}, args...)
+		out, err := exec.Command(testenv.GoToolPath(t), append(args, src)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("go tool compile failed: %v\n%s", err, out)
+		}
+		return string(out)
+	}
+
+	devirt := "PGO devirtualizing a.Add to add"
+	inlined := "inlining call to big"
+	out := compile()
+	if strings.Contains(out, devirt) || strings.Contains(out, inlined) {
+		t.Errorf("without profile, got unexpected optimizations:\n%s", out)
+	}
+	out = compile("-pgoprofile", prof)
+	for _, want := range []string{devirt, "inlining call to add.Add", inlined} {
+		if !strings.Contains(out, want) {
+			t.Errorf("with profile, missing %q in output:\n%s", want, out)
+		}
+	}
+}
@@ -56,6 +56,12 @@ func NewPkg(path, name string) *Pkg {
 	return p
 }
 
+// LookupPkg returns the package with the given path,
+// or nil if there is no such package.
+func LookupPkg(path string) *Pkg {
+	return pkgMap[path]
+}
+
 // ImportedPkgList returns the list of directly imported packages.
 // The list is sorted by package path.
 func ImportedPkgList() []*Pkg {
@@ -98,6 +98,7 @@ var bootstrapDirs = []string{
 	"debug/macho",
 	"debug/pe",
 	"internal/goversion",
+	"internal/profile",
 	"internal/race",
 	"internal/unsafeheader",
 	"internal/xcoff",
@@ -30,6 +30,7 @@
 // 	tool        run specified go tool
 // 	version     print Go version
 // 	vet         report likely mistakes in packages
+// 	work        workspace maintenance
 //
 // Use "go help <command>" for more information about a command.
 //
@@ -178,6 +179,11 @@
 // 		include path must be  in the same directory as the Go package they are
 // 		included from, and overlays will not appear when binaries and tests are
 // 		run through go run and go test respectively.
+// 	-pgo file
+// 		specify the file path of a profile for profile-guided optimization (PGO).
+// 		The profile is a CPU profile in the format written by runtime/pprof,
+// 		and is applied to every package in the build. The special name "off"
+// 		turns off PGO, which is the default.
 // 	-pkgdir dir
 // 		install and load all packages from dir instead of the usual locations.
 // 		For example, when building with a non-standard configuration,
@@ -282,6 +288,13 @@
 // download cache, including unpacked source code of versioned
 // dependencies.
 //
+// The -fuzzcache flag causes clean to remove files stored in the Go build
+// cache for fuzz testing. The fuzzing engine caches files that expand
+// code coverage, so removing them may make fuzzing less effective until
+// new inputs are found that provide the same coverage. These files are
+// distinct from those stored in testdata directory; clean does not remove
+// those files.
+//
 // For more about build flags, see 'go help build'.
 //
 // For more about specifying packages, see 'go help packages'.
@@ -1539,6 +1552,105 @@
 // See also: go fmt, go fix.
 //
 //
+// Workspace maintenance
+//
+// Go work provides access to operations on workspaces.
+//
+// A workspace is a set of modules that are developed together. It is
+// described by a go.work file, which lists the directories of the modules
+// in the workspace, each in a use directive:
+//
+// 	go 1.16
+//
+// 	use (
+// 		./api
+// 		./server
+// 	)
+//
+// When the current directory or one of its parents contains a go.work file
+// (or the GOWORK environment variable names one), the go command runs in
+// workspace mode: all of the modules listed are main modules. Their packages
+// import each other's packages directly from their directories, whatever
+// versions their go.mod files require, so changes spanning several modules
+// can be built and tested without adding replace directives to any go.mod
+// file. Replace and exclude directives from all of the workspace modules
+// apply to the workspace as a whole.
+//
+// In workspace mode, go.mod files are not updated and -mod may only be set
+// to readonly. Checksums already recorded in each module's go.sum are used,
+// and any new checksums are recorded in a go.work.sum file next to go.work.
+// The 'go get' and 'go mod' commands ignore go.work and operate on the
+// module in the current directory. Set GOWORK=off to disable workspace mode
+// for other commands too.
+//
+// Usage:
+//
+// 	go work <command> [arguments]
+//
+// The commands are:
+//
+// 	init        initialize workspace file
+// 	sync        sync workspace build list to modules
+// 	use         add modules to workspace file
+//
+// Use "go help work <command>" for more information about a command.
+//
+// Initialize workspace file
+//
+// Usage:
+//
+// 	go work init [moddirs]
+//
+// Init initializes and writes a new go.work file in the current directory,
+// in effect creating a new workspace rooted at the current directory. The
+// go.work file must not already exist.
+//
+// Init optionally accepts paths to the workspace modules as arguments. Each
+// must be a directory containing a go.mod file. If an argument is omitted,
+// an empty workspace with no modules is created; add modules to it with
+// 'go work use'.
+//
+//
+// Sync workspace build list to modules
+//
+// Usage:
+//
+// 	go work sync
+//
+// Sync syncs the workspace's build list back to the workspace's modules.
+//
+// The workspace's build list is the set of versions of all the (transitive)
+// dependency modules used to do builds in the workspace. Sync computes it
+// using minimal version selection over the requirements of all of the
+// workspace modules.
+//
+// Sync then raises each dependency requirement listed in the go.mod file of
+// each workspace module to the version selected for the workspace, if that
+// version is higher. Requirements on other workspace modules are left
+// unchanged. Finally, sync adds to each module's go.sum file the checksums
+// needed to build that module on its own.
+//
+//
+// Add modules to workspace file
+//
+// Usage:
+//
+// 	go work use [-r] moddirs
+//
+// Use provides a command-line interface for adding directories,
+// optionally recursively, to a go.work file.
+//
+// A use directive is added to the go.work file for each argument
+// directory that contains a go.mod file. Arguments that are listed in the
+// go.work file but no longer contain a go.mod file are removed from it.
+//
+// The -r flag searches recursively for modules in the argument
+// directories, and the use command operates as if each of the directories
+// were specified as arguments: namely, use directives are added for
+// directories that contain modules, and removed for listed directories
+// that no longer do.
+//
+//
 // Build constraints
 //
 // A build constraint, also known as a build tag, is a line comment that begins
@@ -1814,6 +1926,13 @@
 // 	GOVCS
 // 		Lists version control commands that may be used with matching servers.
 // 		See 'go help vcs'.
+// 	GOWORK
+// 		In module aware mode, use the given go.work file as a workspace file.
+// 		By default or when GOWORK is "auto", the go command searches for a
+// 		file named go.work in the current directory and then containing
+// 		directories until one is found. If GOWORK is "off", workspace mode
+// 		is disabled. 'go env GOWORK' reports the go.work file in use.
+// 		See 'go help work'. Cannot be set using 'go env -w'.
 //
 // Environment variables for use with cgo:
 //
@@ -2634,6 +2753,20 @@
 // 	-failfast
 // 	    Do not start new tests after the first test failure.
 //
+// 	-fuzz regexp
+// 	    Run the fuzz target matching the regular expression. When specified,
+// 	    the command line argument must match exactly one package, and regexp
+// 	    must match exactly one fuzz target within that package. After tests,
+// 	    benchmarks, seed corpora of other fuzz targets, and examples have
+// 	    completed, the matching target will be fuzzed. See the Fuzzing
+// 	    section of the testing package documentation for details.
+//
+// 	-fuzztime t
+// 	    Run enough iterations of the fuzz target to take t, specified as a
+// 	    time.Duration (for example, -fuzztime 1h30s). The default is to run
+// 	    forever. The special syntax Nx means to run the fuzz target N times
+// 	    (for example, -fuzztime 100x).
+//
 // 	-list regexp
 // 	    List tests, benchmarks, or examples matching the regular expression.
 // 	    No tests, benchmarks or examples will be run. This will only
@@ -2667,7 +2800,8 @@
 // 	-timeout d
 // 	    If a test binary runs longer than duration d, panic.
 // 	    If d is 0, the timeout is disabled.
-// 	    The default is 10 minutes (10m).
+// 	    The default is 10 minutes (10m), except when fuzzing with -fuzz,
+// 	    in which case there is no default timeout.
 //
 // 	-v
 // 	    Verbose output: log all tests as they are run. Also print all
@@ -2800,8 +2934,8 @@
 //
 // Testing functions
 //
-// The 'go test' command expects to find test, benchmark, and example functions
-// in the "*_test.go" files corresponding to the package under test.
+// The 'go test' command expects to find test, benchmark, fuzz, and example
+// functions in the "*_test.go" files corresponding to the package under test.
 //
 // A test function is one named TestXxx (where Xxx does not start with a
 // lower case letter) and should have the signature,
@@ -2812,6 +2946,10 @@
 //
 // 	func BenchmarkXxx(b *testing.B) { ... }
 //
+// A fuzz target is one named FuzzXxx and should have the signature,
+//
+// 	func FuzzXxx(f *testing.F) { ... }
+//
 // An example function is similar to a test function but, instead of using
 // *testing.T to report success or failure, prints output to os.Stdout.
 // If the last comment in the function starts with "Output:" then the output
@@ -47,6 +47,7 @@ var (
 	canRace = false // whether we can run the race detector
 	canCgo  = false // whether we can use cgo
 	canMSan = false // whether we can run the memory sanitizer
+	canFuzz = false // whether we can run the fuzzing engine
 )
 
 var exeSuffix string = func() string {
@@ -207,6 +208,7 @@ func TestMain(m *testing.M) {
 
 		canMSan = canCgo && sys.MSanSupported(runtime.GOOS, runtime.GOARCH)
 		canRace = canCgo && sys.RaceDetectorSupported(runtime.GOOS, runtime.GOARCH)
+		canFuzz = sys.FuzzSupported(runtime.GOOS, runtime.GOARCH)
 		// The race detector doesn't work on Alpine Linux:
 		// golang.org/issue/14481
 		// gccgo does not support the race detector.
@@ -37,6 +37,8 @@ var (
 	BuildN                 bool               // -n flag
 	BuildO                 string             // -o flag
 	BuildP                 = runtime.NumCPU() // -p flag
+	BuildPGO               string             // -pgo flag
+	BuildPGOFile           string             // absolute path of the profile selected by -pgo, if any
 	BuildPkgdir            string             // -pkgdir flag
 	BuildRace              bool               // -race flag
 	BuildToolexec          []string           // -toolexec flag
@@ -544,6 +544,13 @@ General-purpose environment variables:
 	GOVCS
 		Lists version control commands that may be used with matching servers.
 		See 'go help vcs'.
+	GOWORK
+		In module aware mode, use the given go.work file as a workspace file.
+		By default or when GOWORK is "auto", the go command searches for a
+		file named go.work in the current directory and then containing
+		directories until one is found. If GOWORK is "off", workspace mode
+		is disabled. 'go env GOWORK' reports the go.work file in use.
+		See 'go help work'. Cannot be set using 'go env -w'.
 
 Environment variables for use with cgo:
 
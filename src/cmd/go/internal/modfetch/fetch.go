@@ -379,6 +379,11 @@ func RemoveAll(dir string) error {
 
 var GoSumFile string // path to go.sum; set by package modload
 
+// WorkspaceGoSumFiles lists the go.sum files of the modules in the
+// workspace, if any. Their sums are trusted but never rewritten; new sums
+// are added to GoSumFile (go.work.sum). Set by package modload.
+var WorkspaceGoSumFiles []string
+
 type modSum struct {
 	mod module.Version
 	sum string
@@ -387,6 +392,7 @@ type modSum struct {
 var goSum struct {
 	mu        sync.Mutex
 	m         map[module.Version][]string // content of go.sum file
+	w         map[module.Version][]string // content of workspace modules' go.sum files
 	status    map[modSum]modSumStatus     // state of sums in m
 	overwrite bool                        // if true, overwrite go.sum without incorporating its contents
 	enabled   bool                        // whether to use go.sum at all
@@ -417,6 +423,17 @@ func initGoSum() (bool, error) {
 	goSum.enabled = true
 	readGoSum(goSum.m, GoSumFile, data)
 
+	goSum.w = make(map[module.Version][]string)
+	for _, f := range WorkspaceGoSumFiles {
+		data, err := lockedfile.Read(f)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if err := readGoSum(goSum.w, f, data); err != nil {
+			return false, err
+		}
+	}
+
 	return true, nil
 }
 
@@ -475,6 +492,11 @@ func HaveSum(mod module.Version) bool {
 			return true
 		}
 	}
+	for _, h := range goSum.w[mod] {
+		if strings.HasPrefix(h, "h1:") {
+			return true
+		}
+	}
 	return false
 }
 
@@ -579,6 +601,14 @@ func haveModSumLocked(mod module.Version, h string) bool {
 			base.Fatalf("verifying %s@%s: checksum mismatch\n\tdownloaded: %v\n\tgo.sum:     %v"+goSumMismatch, mod.Path, mod.Version, h, vh)
 		}
 	}
+	for _, vh := range goSum.w[mod] {
+		if h == vh {
+			return true
+		}
+		if strings.HasPrefix(vh, "h1:") {
+			base.Fatalf("verifying %s@%s: checksum mismatch\n\tdownloaded: %v\n\tgo.sum:     %v"+goSumMismatch, mod.Path, mod.Version, h, vh)
+		}
+	}
 	return false
 }
 
@@ -726,6 +756,76 @@ Outer:
 	goSum.overwrite = false
 }
 
+// AddGoSums adds to the go.sum file at path every known sum for the modules
+// in keep, taking sums from go.sum, go.work.sum, and the go.sum files of the
+// workspace modules. Sums already present in the file are preserved.
+// It is used by 'go work sync' to make each workspace module's go.sum
+// complete for the module's own build.
+func AddGoSums(path string, keep map[module.Version]bool) error {
+	goSum.mu.Lock()
+	defer goSum.mu.Unlock()
+	inited, err := initGoSum()
+	if err != nil {
+		return err
+	}
+	if !inited {
+		return nil
+	}
+
+	if unlock, err := SideLock(); err == nil {
+		defer unlock()
+	}
+
+	errNoChange := errors.New("no update needed")
+	err = lockedfile.Transform(path, func(data []byte) ([]byte, error) {
+		sums := make(map[module.Version][]string)
+		if err := readGoSum(sums, path, data); err != nil {
+			return nil, err
+		}
+		changed := false
+		add := func(m module.Version, h string) {
+			for _, vh := range sums[m] {
+				if vh == h {
+					return
+				}
+			}
+			sums[m] = append(sums[m], h)
+			changed = true
+		}
+		for m := range keep {
+			for _, h := range goSum.m[m] {
+				add(m, h)
+			}
+			for _, h := range goSum.w[m] {
+				add(m, h)
+			}
+		}
+		if !changed {
+			return nil, errNoChange
+		}
+
+		var mods []module.Version
+		for m := range sums {
+			mods = append(mods, m)
+		}
+		module.Sort(mods)
+
+		var buf bytes.Buffer
+		for _, m := range mods {
+			list := sums[m]
+			sort.Strings(list)
+			for _, h := range list {
+				fmt.Fprintf(&buf, "%s %s %s\n", m.Path, m.Version, h)
+			}
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil && err != errNoChange {
+		return err
+	}
+	return nil
+}
+
 // TrimGoSum trims go.sum to contain only the modules needed for reproducible
 // builds.
 //
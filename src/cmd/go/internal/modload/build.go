@@ -152,6 +152,18 @@ func moduleInfo(ctx context.Context, m module.Version, fromBuildList, listRetrac
 		}
 		return info
 	}
+	if ws := workModules[m.Path]; ws != nil && m == ws.mod {
+		info := &modinfo.ModulePublic{
+			Path:  m.Path,
+			Main:  true,
+			Dir:   ws.dir,
+			GoMod: filepath.Join(ws.dir, "go.mod"),
+		}
+		if ws.file.Go != nil {
+			info.GoVersion = ws.file.Go.Version
+		}
+		return info
+	}
 
 	info := &modinfo.ModulePublic{
 		Path:     m.Path,
@@ -56,9 +56,9 @@ func LoadAllModules(ctx context.Context) []module.Version {
 
 // Selected returns the selected version of the module with the given path, or
 // the empty string if the given module has no selected version
-// (either because it is not required or because it is the Target module).
+// (either because it is not required or because it is a main module).
 func Selected(path string) (version string) {
-	if path == Target.Path {
+	if isMainModule(module.Version{Path: path}) {
 		return ""
 	}
 	for _, m := range buildList {
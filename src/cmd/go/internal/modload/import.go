@@ -156,7 +156,11 @@ func (e *ImportMissingSumError) Error() string {
 		message = fmt.Sprintf("missing go.sum entry for module providing package %s%s", e.importPath, importParen)
 	}
 	var hint string
-	if e.importer == "" {
+	if workFilePath != "" {
+		// 'go get' and 'go mod download' operate on a single module, not the
+		// workspace. 'go work sync' adds the sums for the whole workspace.
+		hint = "; to add:\n\tgo work sync"
+	} else if e.importer == "" {
 		// Importing package is unknown, or the missing package was named on the
 		// command line. Recommend 'go mod download' for the modules that could
 		// provide the package, since that shouldn't change go.mod.
@@ -555,6 +559,9 @@ func fetch(ctx context.Context, mod module.Version, needSum bool) (dir string, i
 	if mod == Target {
 		return ModRoot(), true, nil
 	}
+	if ws := workModules[mod.Path]; ws != nil && mod == ws.mod {
+		return ws.dir, true, nil
+	}
 	if r := Replacement(mod); r.Path != "" {
 		if r.Version == "" {
 			dir = r.Path
@@ -170,6 +170,8 @@ func Init() {
 			base.Fatalf("go: -modfile cannot be used with commands that ignore the current module")
 		}
 		modRoot = ""
+	} else if workFile := FindGoWork(base.Cwd); workFile != "" && !ignoresWorkspace() {
+		initWorkspace(workFile)
 	} else {
 		modRoot = findModuleRoot(base.Cwd)
 		if modRoot == "" {
@@ -231,12 +233,24 @@ func Init() {
 		// For example, 'go get' does this, since it is expected to resolve paths.
 		//
 		// See golang.org/issue/32027.
+	} else if workFilePath != "" {
+		// The go.sum files and search roots of the workspace modules are set
+		// by loadWorkModules, once their go.mod files have been read.
+		modfetch.GoSumFile = workFilePath + ".sum"
+		search.SetModRoots([]string{modRoot, filepath.Dir(workFilePath)})
 	} else {
 		modfetch.GoSumFile = strings.TrimSuffix(ModFilePath(), ".mod") + ".sum"
-		search.SetModRoot(modRoot)
+		search.SetModRoots([]string{modRoot})
 	}
 }
 
+// ignoresWorkspace reports whether the current command operates on a single
+// module even when a go.work file is present: 'go get' and the 'go mod'
+// commands edit the go.mod file of the module in the current directory.
+func ignoresWorkspace() bool {
+	return cfg.CmdName == "get" || strings.HasPrefix(cfg.CmdName, "mod ")
+}
+
 // WillBeEnabled checks whether modules should be enabled but does not
 // initialize modules by installing hooks. If Init has already been called,
 // WillBeEnabled returns the same result as Enabled.
@@ -268,6 +282,9 @@ func WillBeEnabled() bool {
 		return false
 	}
 
+	if FindGoWork(base.Cwd) != "" {
+		return true
+	}
 	if modRoot := findModuleRoot(base.Cwd); modRoot == "" {
 		// GO111MODULE is 'auto', and we can't find a module root.
 		// Stay in GOPATH mode.
@@ -389,6 +406,10 @@ func LoadModFile(ctx context.Context) {
 		base.Fatalf("go: %v", err)
 	}
 
+	if workFilePath != "" {
+		loadWorkModules()
+	}
+
 	setDefaultBuildMod() // possibly enable automatic vendoring
 	modFileToBuildList()
 	if cfg.BuildMod == "vendor" {
@@ -586,6 +607,9 @@ func modFileToBuildList() {
 			list = append(list, r.Mod)
 		}
 	}
+	for _, ws := range workModuleList {
+		list = append(list, ws.mod)
+	}
 	buildList = list
 }
 
@@ -608,6 +632,16 @@ func setDefaultBuildMod() {
 		cfg.BuildMod = "readonly"
 		return
 	}
+	if workFilePath != "" {
+		// Workspace modules are never vendored, and their go.mod files are
+		// only updated by 'go work sync'.
+		if cfg.CmdName == "work sync" {
+			cfg.BuildMod = "mod"
+		} else {
+			cfg.BuildMod = "readonly"
+		}
+		return
+	}
 
 	if fi, err := fsys.Stat(filepath.Join(modRoot, "vendor")); err == nil && fi.IsDir() {
 		modGo := "unspecified"
@@ -880,6 +914,13 @@ func WriteGoMod() {
 		return
 	}
 
+	// In workspace mode, the go.mod files belong to the individual modules
+	// and are left alone. Only go.work.sum is updated.
+	if workFilePath != "" {
+		modfetch.WriteGoSum(keepSums(true))
+		return
+	}
+
 	if cfg.BuildMod != "readonly" {
 		addGoStmt()
 	}
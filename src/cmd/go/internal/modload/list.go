@@ -60,7 +60,11 @@ func ListModules(ctx context.Context, args []string, listU, listVersions, listRe
 func listModules(ctx context.Context, args []string, listVersions, listRetracted bool) []*modinfo.ModulePublic {
 	LoadAllModules(ctx)
 	if len(args) == 0 {
-		return []*modinfo.ModulePublic{moduleInfo(ctx, buildList[0], true, listRetracted)}
+		var mods []*modinfo.ModulePublic
+		for _, m := range mainModules() {
+			mods = append(mods, moduleInfo(ctx, m, true, listRetracted))
+		}
+		return mods
 	}
 
 	var mods []*modinfo.ModulePublic
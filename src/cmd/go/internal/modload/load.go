@@ -246,7 +246,7 @@ func LoadPackages(ctx context.Context, opts PackageOpts, patterns ...string) (ma
 					// The initial roots are the packages in the main module.
 					// loadFromRoots will expand that to "all".
 					m.Errs = m.Errs[:0]
-					matchPackages(ctx, m, opts.Tags, omitStd, []module.Version{Target})
+					matchPackages(ctx, m, opts.Tags, omitStd, mainModules())
 				} else {
 					// Starting with the packages in the main module,
 					// enumerate the full list of "all".
@@ -354,7 +354,7 @@ func matchLocalDirs(m *search.Match) {
 		if !filepath.IsAbs(dir) {
 			absDir = filepath.Join(base.Cwd, dir)
 		}
-		if search.InDir(absDir, cfg.GOROOTsrc) == "" && search.InDir(absDir, ModRoot()) == "" && pathInModuleCache(absDir) == "" {
+		if search.InDir(absDir, cfg.GOROOTsrc) == "" && !inWorkspaceDir(absDir) && pathInModuleCache(absDir) == "" {
 			m.Dirs = []string{}
 			m.AddError(fmt.Errorf("directory prefix %s outside available modules", base.ShortPath(absDir)))
 			return
@@ -403,6 +403,19 @@ func resolveLocalPackage(dir string) (string, error) {
 		}
 	}
 
+	if ws, sub := workModuleForDir(absDir); ws != nil {
+		pkg := ws.mod.Path
+		if sub != "." {
+			pkg = path.Join(pkg, filepath.ToSlash(sub))
+		}
+		if _, ok, err := dirInModule(pkg, ws.mod.Path, ws.dir, true); err != nil {
+			return "", err
+		} else if !ok {
+			return "", &PackageNotInModuleError{Mod: ws.mod, Pattern: pkg}
+		}
+		return pkg, nil
+	}
+
 	if modRoot != "" && absDir == modRoot {
 		if absDir == cfg.GOROOTsrc {
 			return "", errPkgIsGorootSrc
@@ -538,7 +551,7 @@ func ImportFromFiles(ctx context.Context, gofiles []string) {
 }
 
 // DirImportPath returns the effective import path for dir,
-// provided it is within the main module, or else returns ".".
+// provided it is within a main module, or else returns ".".
 func DirImportPath(dir string) string {
 	if !HasModRoot() {
 		return "."
@@ -551,6 +564,12 @@ func DirImportPath(dir string) string {
 		dir = filepath.Clean(dir)
 	}
 
+	if ws, sub := workModuleForDir(dir); ws != nil {
+		if sub == "." {
+			return ws.mod.Path
+		}
+		return path.Join(ws.mod.Path, filepath.ToSlash(sub))
+	}
 	if dir == modRoot {
 		return targetPrefix
 	}
@@ -872,10 +891,10 @@ func loadFromRoots(params loaderParams) *loader {
 	// Compute directly referenced dependency modules.
 	ld.direct = make(map[string]bool)
 	for _, pkg := range ld.pkgs {
-		if pkg.mod == Target {
+		if isMainModule(pkg.mod) {
 			for _, dep := range pkg.imports {
-				if dep.mod.Path != "" && dep.mod.Path != Target.Path && index != nil {
-					_, explicit := index.require[dep.mod]
+				if dep.mod.Path != "" && !isMainModule(dep.mod) && index != nil {
+					explicit := isExplicitRequirement(pkg.mod, dep.mod)
 					if allowWriteGoMod && cfg.BuildMod == "readonly" && !explicit {
 						// TODO(#40775): attach error to package instead of using
 						// base.Errorf. Ideally, 'go list' should not fail because of this,
@@ -1012,7 +1031,7 @@ func (ld *loader) applyPkgFlags(pkg *loadPkg, flags loadPkgFlags) {
 		// so it's ok if we call it more than is strictly necessary.
 		wantTest := false
 		switch {
-		case ld.allPatternIsRoot && pkg.mod == Target:
+		case ld.allPatternIsRoot && isMainModule(pkg.mod):
 			// We are loading the "all" pattern, which includes packages imported by
 			// tests in the main module. This package is in the main module, so we
 			// need to identify the imports of its test even if LoadTests is not set.
@@ -1033,7 +1052,7 @@ func (ld *loader) applyPkgFlags(pkg *loadPkg, flags loadPkgFlags) {
 
 		if wantTest {
 			var testFlags loadPkgFlags
-			if pkg.mod == Target || (ld.allClosesOverTests && new.has(pkgInAll)) {
+			if isMainModule(pkg.mod) || (ld.allClosesOverTests && new.has(pkgInAll)) {
 				// Tests of packages in the main module are in "all", in the sense that
 				// they cause the packages they import to also be in "all". So are tests
 				// of packages in "all" if "all" closes over test dependencies.
@@ -1076,7 +1095,7 @@ func (ld *loader) load(pkg *loadPkg) {
 	if pkg.dir == "" {
 		return
 	}
-	if pkg.mod == Target {
+	if isMainModule(pkg.mod) {
 		// Go ahead and mark pkg as in "all". This provides the invariant that a
 		// package that is *only* imported by other packages in "all" is always
 		// marked as such before loading its imports.
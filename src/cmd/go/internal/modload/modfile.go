@@ -450,6 +450,9 @@ func goModSummary(m module.Version) (*modFileSummary, error) {
 		key := module.Version{Path: actual.Path, Version: actual.Version + "/go.mod"}
 		if !modfetch.HaveSum(key) {
 			suggestion := fmt.Sprintf("; to add it:\n\tgo mod download %s", m.Path)
+			if workFilePath != "" {
+				suggestion = "; to add it:\n\tgo work sync"
+			}
 			return nil, module.VersionError(actual, &sumMissingError{suggestion: suggestion})
 		}
 	}
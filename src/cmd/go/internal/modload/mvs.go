@@ -28,6 +28,11 @@ func (r *mvsReqs) Required(mod module.Version) ([]module.Version, error) {
 		// global build list.
 		return r.buildList[1:], nil
 	}
+	if ws := workModules[mod.Path]; ws != nil {
+		// The other main modules in a workspace are always used from their
+		// directories, whatever version of them is required.
+		return workModuleRequires(ws), nil
+	}
 
 	if mod.Version == "none" {
 		return nil, nil
@@ -89,12 +94,12 @@ func versions(ctx context.Context, path string, allowed AllowedFunc) ([]string,
 // Previous returns the tagged version of m.Path immediately prior to
 // m.Version, or version "none" if no prior version is tagged.
 //
-// Since the version of Target is not found in the version list,
-// it has no previous version.
+// Since the versions of Target and the other main modules are not found in
+// the version list, they have no previous version.
 func (*mvsReqs) Previous(m module.Version) (module.Version, error) {
 	// TODO(golang.org/issue/38714): thread tracing context through MVS.
 
-	if m == Target {
+	if isMainModule(m) {
 		return module.Version{Path: m.Path, Version: "none"}, nil
 	}
 
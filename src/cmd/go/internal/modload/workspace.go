@@ -0,0 +1,733 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cmd/go/internal/base"
+	"cmd/go/internal/cfg"
+	"cmd/go/internal/fsys"
+	"cmd/go/internal/imports"
+	"cmd/go/internal/lockedfile"
+	"cmd/go/internal/modfetch"
+	"cmd/go/internal/mvs"
+	"cmd/go/internal/search"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	// workFilePath is the path of the go.work file in use,
+	// or "" if the go command is not in workspace mode.
+	workFilePath string
+
+	// workDirs lists the module directories named by the go.work file,
+	// as absolute paths, in the order they appear in the file.
+	workDirs []string
+
+	// workModules holds the modules in the workspace other than Target,
+	// indexed by module path. Like Target, each is a main module: it has
+	// no version and is chosen over every other version of its path.
+	workModules map[string]*workModule
+
+	// workModuleList holds the same modules as workModules,
+	// in the order they are listed in the go.work file.
+	workModuleList []*workModule
+)
+
+// A workModule is a main module other than Target in workspace mode.
+type workModule struct {
+	mod  module.Version // mod.Version is always ""
+	dir  string
+	file *modfile.File
+}
+
+// inWorkspaceMode reports whether the go command is using a go.work file.
+func inWorkspaceMode() bool {
+	Init()
+	return workFilePath != ""
+}
+
+// WorkFilePath returns the absolute path of the go.work file in use,
+// or "" if the go command is not in workspace mode.
+func WorkFilePath() string {
+	Init()
+	return workFilePath
+}
+
+// FindGoWork returns the go.work file that applies to the directory dir,
+// or "" if there is none. It honors the GOWORK environment variable:
+// "off" disables workspaces and an absolute path names the file to use.
+// Otherwise, FindGoWork looks in dir and then each of its parents.
+func FindGoWork(dir string) string {
+	switch gowork := cfg.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "", "auto":
+	default:
+		if !filepath.IsAbs(gowork) {
+			base.Fatalf("go: invalid GOWORK: not an absolute path")
+		}
+		return gowork
+	}
+
+	dir = filepath.Clean(dir)
+	for {
+		if fi, err := fsys.Stat(filepath.Join(dir, "go.work")); err == nil && !fi.IsDir() {
+			return filepath.Join(dir, "go.work")
+		}
+		d := filepath.Dir(dir)
+		if d == dir {
+			break
+		}
+		dir = d
+	}
+	return ""
+}
+
+// initWorkspace reads the go.work file at path and chooses the root of the
+// Target module: the listed module directory that contains the current
+// directory, or else the first module listed.
+func initWorkspace(path string) {
+	if cfg.ModFile != "" {
+		base.Fatalf("go: -modfile cannot be used in workspace mode\n\tto disable workspace mode, set GOWORK=off")
+	}
+	if cfg.BuildModExplicit && cfg.BuildMod != "readonly" {
+		base.Fatalf("go: -mod may only be set to readonly when in workspace mode, but it is set to %q\n\tto disable workspace mode, set GOWORK=off", cfg.BuildMod)
+	}
+
+	wf, err := ReadWorkFile(path)
+	if err != nil {
+		base.Fatalf("go: %v", err)
+	}
+	if len(wf.Use) == 0 {
+		base.Fatalf("go: %s does not list any modules; to add one, run:\n\tgo work use <dir>", base.ShortPath(path))
+	}
+
+	workFilePath = path
+	workDirs = workDirs[:0]
+	root := ""
+	for _, u := range wf.Use {
+		dir := wf.AbsDir(u.Path)
+		workDirs = append(workDirs, dir)
+		if search.InDir(base.Cwd, dir) != "" && len(dir) > len(root) {
+			root = dir
+		}
+	}
+	if root == "" {
+		root = workDirs[0]
+	}
+	modRoot = root
+}
+
+// loadWorkModules parses the go.mod file of each workspace module other
+// than Target and merges their replacements and exclusions into index.
+// It must be called after the Target go.mod file has been indexed.
+func loadWorkModules() {
+	workModules = make(map[string]*workModule)
+	workModuleList = nil
+	seen := map[string]string{modFile.Module.Mod.Path: modRoot}
+	for _, dir := range workDirs {
+		if dir == modRoot {
+			continue
+		}
+		gomod := filepath.Join(dir, "go.mod")
+		data, err := lockedfile.Read(gomod)
+		if err != nil {
+			base.Fatalf("go: %s: %v", base.ShortPath(workFilePath), err)
+		}
+		f, err := modfile.Parse(gomod, data, nil)
+		if err != nil {
+			base.Fatalf("go: errors parsing %s:\n%s\n", base.ShortPath(gomod), err)
+		}
+		if f.Module == nil {
+			base.Fatalf("go: no module declaration in %s", base.ShortPath(gomod))
+		}
+		path := f.Module.Mod.Path
+		if prev, ok := seen[path]; ok {
+			base.Fatalf("go: module %s appears multiple times in workspace:\n\t%s\n\t%s", path, base.ShortPath(prev), base.ShortPath(dir))
+		}
+		seen[path] = dir
+		ws := &workModule{mod: module.Version{Path: path}, dir: dir, file: f}
+		workModules[path] = ws
+		workModuleList = append(workModuleList, ws)
+	}
+
+	// Replacements and exclusions from every workspace module apply to the
+	// whole workspace. Resolve relative replacement directories now, since
+	// they are relative to the module that declares them.
+	absReplacement := func(dir string, r module.Version) module.Version {
+		if r.Version == "" && !filepath.IsAbs(r.Path) {
+			r.Path = filepath.Join(dir, r.Path)
+		}
+		return r
+	}
+	for old, r := range index.replace {
+		index.replace[old] = absReplacement(modRoot, r)
+	}
+	for _, ws := range workModuleList {
+		for _, r := range ws.file.Replace {
+			new := absReplacement(ws.dir, r.New)
+			if prev, dup := index.replace[r.Old]; dup && prev != new {
+				base.Fatalf("go: conflicting replacements for %v in workspace:\n\t%v\n\t%v", r.Old, prev, new)
+			}
+			index.replace[r.Old] = new
+			if v, ok := index.highestReplaced[r.Old.Path]; !ok || semver.Compare(r.Old.Version, v) > 0 {
+				index.highestReplaced[r.Old.Path] = r.Old.Version
+			}
+		}
+		for _, x := range ws.file.Exclude {
+			index.exclude[x.Mod] = true
+		}
+	}
+
+	modfetch.GoSumFile = workFilePath + ".sum"
+	modfetch.WorkspaceGoSumFiles = []string{filepath.Join(modRoot, "go.sum")}
+	roots := []string{modRoot}
+	for _, ws := range workModuleList {
+		modfetch.WorkspaceGoSumFiles = append(modfetch.WorkspaceGoSumFiles, filepath.Join(ws.dir, "go.sum"))
+		roots = append(roots, ws.dir)
+	}
+	search.SetModRoots(append(roots, filepath.Dir(workFilePath)))
+}
+
+// isMainModule reports whether m is the Target module or,
+// in workspace mode, one of the other workspace modules.
+func isMainModule(m module.Version) bool {
+	if m == Target {
+		return true
+	}
+	ws := workModules[m.Path]
+	return ws != nil && m == ws.mod
+}
+
+// mainModules returns the main modules: Target followed by any other
+// workspace modules.
+func mainModules() []module.Version {
+	mods := []module.Version{Target}
+	for _, ws := range workModuleList {
+		mods = append(mods, ws.mod)
+	}
+	return mods
+}
+
+// workModuleRequires returns the requirements listed in the go.mod file of
+// workspace module ws, without any excluded versions.
+func workModuleRequires(ws *workModule) []module.Version {
+	var list []module.Version
+	for _, r := range ws.file.Require {
+		if !index.exclude[r.Mod] {
+			list = append(list, r.Mod)
+		}
+	}
+	return list
+}
+
+// isExplicitRequirement reports whether the go.mod file of the main module
+// mm lists a requirement on dep. In workspace mode the selected version of
+// dep may come from another workspace module, so any requirement on the
+// path of dep counts.
+func isExplicitRequirement(mm, dep module.Version) bool {
+	if workFilePath == "" {
+		_, explicit := index.require[dep]
+		return explicit
+	}
+	var reqs []*modfile.Require
+	if mm == Target {
+		reqs = modFile.Require
+	} else {
+		reqs = workModules[mm.Path].file.Require
+	}
+	for _, r := range reqs {
+		if r.Mod.Path == dep.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// workModuleForDir returns the workspace module other than Target whose
+// directory contains dir and is more deeply nested than any other main
+// module containing dir, along with the path of dir relative to it.
+func workModuleForDir(dir string) (ws *workModule, rel string) {
+	best := ""
+	if modRoot != "" && search.InDir(dir, modRoot) != "" {
+		best = modRoot
+	}
+	for _, w := range workModuleList {
+		if sub := search.InDir(dir, w.dir); sub != "" && len(w.dir) > len(best) {
+			best = w.dir
+			ws, rel = w, sub
+		}
+	}
+	if ws == nil || best != ws.dir {
+		return nil, ""
+	}
+	return ws, rel
+}
+
+// inWorkspaceDir reports whether dir is within one of the main modules or,
+// in workspace mode, the directory containing go.work.
+func inWorkspaceDir(dir string) bool {
+	if modRoot != "" && search.InDir(dir, modRoot) != "" {
+		return true
+	}
+	if workFilePath == "" {
+		return false
+	}
+	if search.InDir(dir, filepath.Dir(workFilePath)) != "" {
+		return true
+	}
+	ws, _ := workModuleForDir(dir)
+	return ws != nil
+}
+
+// SyncWorkspace updates the go.mod file of each workspace module so that
+// it requires at least the versions of its dependencies that the workspace
+// as a whole selects, and adds to each module's go.sum the checksums needed
+// to build that module on its own. Requirements on other workspace modules
+// are left unchanged.
+func SyncWorkspace(ctx context.Context) {
+	if !inWorkspaceMode() {
+		base.Fatalf("go: no go.work file found\n\t(run 'go work init' first or specify path using GOWORK environment variable)")
+	}
+	// Load every package in the workspace and its dependencies (including
+	// those of tests), so that the checksums for the modules that provide
+	// them are known.
+	LoadPackages(ctx, PackageOpts{
+		Tags:                     imports.AnyTags(),
+		LoadTests:                true,
+		SilenceMissingStdImports: true,
+	}, "all")
+
+	selected := make(map[string]string, len(buildList))
+	for _, m := range buildList {
+		selected[m.Path] = m.Version
+	}
+
+	sync := func(dir string, mod module.Version) {
+		gomod := filepath.Join(dir, "go.mod")
+		data, err := lockedfile.Read(gomod)
+		if err != nil {
+			base.Fatalf("go: %v", err)
+		}
+		f, err := modfile.Parse(gomod, data, nil)
+		if err != nil {
+			base.Fatalf("go: errors parsing %s:\n%s\n", base.ShortPath(gomod), err)
+		}
+
+		var upgrades []module.Version
+		for _, r := range f.Require {
+			if isMainModule(module.Version{Path: r.Mod.Path}) {
+				continue
+			}
+			if v := selected[r.Mod.Path]; v != "" && semver.Compare(v, r.Mod.Version) > 0 {
+				upgrades = append(upgrades, module.Version{Path: r.Mod.Path, Version: v})
+			}
+		}
+		for _, m := range upgrades {
+			if err := f.AddRequire(m.Path, m.Version); err != nil {
+				base.Fatalf("go: %s: %v", base.ShortPath(gomod), err)
+			}
+		}
+		f.Cleanup()
+		var reqs []module.Version
+		for _, r := range f.Require {
+			reqs = append(reqs, r.Mod)
+		}
+
+		out, err := f.Format()
+		if err != nil {
+			base.Fatalf("go: %v", err)
+		}
+		errNoChange := errors.New("no update needed")
+		err = lockedfile.Transform(gomod, func(old []byte) ([]byte, error) {
+			if string(old) == string(out) {
+				return nil, errNoChange
+			}
+			if string(old) != string(data) {
+				return nil, fmt.Errorf("existing contents have changed since last read")
+			}
+			return out, nil
+		})
+		if err != nil && err != errNoChange {
+			base.Fatalf("go: updating %s: %v", base.ShortPath(gomod), err)
+		}
+
+		// Record the sums needed to build the module outside the workspace:
+		// the go.mod file of every module in its requirement graph, and the
+		// contents of every module selected in its build list.
+		keep := make(map[module.Version]bool)
+		standalone := &workSyncReqs{Reqs: &mvsReqs{}, mod: mod, reqs: reqs, visit: func(m module.Version) {
+			if r := Replacement(m); r.Path != "" {
+				m = r
+			}
+			if m.Version != "" {
+				keep[module.Version{Path: m.Path, Version: m.Version + "/go.mod"}] = true
+			}
+		}}
+		list, err := mvs.BuildList(mod, standalone)
+		if err != nil {
+			base.Fatalf("go: %v", err)
+		}
+		for _, m := range list[1:] {
+			if r := Replacement(m); r.Path != "" {
+				m = r
+			}
+			if m.Version != "" {
+				keep[m] = true
+			}
+		}
+		if err := modfetch.AddGoSums(filepath.Join(dir, "go.sum"), keep); err != nil {
+			base.Fatalf("go: updating %s: %v", base.ShortPath(filepath.Join(dir, "go.sum")), err)
+		}
+	}
+
+	sync(modRoot, Target)
+	for _, ws := range workModuleList {
+		sync(ws.dir, ws.mod)
+	}
+}
+
+// workSyncReqs is the requirement graph of a single workspace module built
+// on its own, with the given requirements. The requirements of the other
+// workspace modules are not followed: outside the workspace they would be
+// satisfied by versions that may not have been published yet.
+type workSyncReqs struct {
+	mvs.Reqs
+	mod   module.Version
+	reqs  []module.Version
+	visit func(module.Version)
+}
+
+func (r *workSyncReqs) Required(m module.Version) ([]module.Version, error) {
+	if m == r.mod {
+		return r.reqs, nil
+	}
+	if m.Version == "none" || m.Path == Target.Path || workModules[m.Path] != nil {
+		return nil, nil
+	}
+	r.visit(m)
+	summary, err := goModSummary(m)
+	if err != nil {
+		return nil, err
+	}
+	return summary.require, nil
+}
+
+// A WorkFile is the parsed form of a go.work file.
+type WorkFile struct {
+	Path   string // absolute path of the go.work file
+	Go     string // version from the go directive, or ""
+	Use    []*WorkUse
+	Syntax *modfile.FileSyntax
+}
+
+// A WorkUse is a single use directive in a go.work file.
+type WorkUse struct {
+	Path   string // module directory, as written in the file (slash-separated)
+	Syntax *modfile.Line
+}
+
+// ReadWorkFile reads and parses the go.work file at path.
+func ReadWorkFile(path string) (*WorkFile, error) {
+	data, err := lockedfile.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWorkFile(path, data)
+}
+
+// ParseWorkFile parses the contents of the go.work file at path.
+// A go.work file holds a go directive and any number of use directives,
+// each naming the directory of a module in the workspace.
+func ParseWorkFile(path string, data []byte) (*WorkFile, error) {
+	f, err := modfile.ParseLax(path, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	wf := &WorkFile{Path: path, Syntax: f.Syntax}
+	if f.Go != nil {
+		wf.Go = f.Go.Version
+	}
+
+	var errs modfile.ErrorList
+	addUse := func(line *modfile.Line, args []string) {
+		if len(args) != 1 {
+			errs = append(errs, modfile.Error{Filename: path, Pos: line.Start, Err: errors.New("usage: use local/dir")})
+			return
+		}
+		dir := args[0]
+		if strings.HasPrefix(dir, `"`) {
+			var err error
+			if dir, err = strconv.Unquote(dir); err != nil {
+				errs = append(errs, modfile.Error{Filename: path, Pos: line.Start, Err: err})
+				return
+			}
+		}
+		wf.Use = append(wf.Use, &WorkUse{Path: dir, Syntax: line})
+	}
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			switch x.Token[0] {
+			case "go":
+			case "use":
+				addUse(x, x.Token[1:])
+			default:
+				errs = append(errs, modfile.Error{Filename: path, Pos: x.Start, Err: fmt.Errorf("unknown directive: %s", x.Token[0])})
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) != 1 || x.Token[0] != "use" {
+				errs = append(errs, modfile.Error{Filename: path, Pos: x.Start, Err: fmt.Errorf("unknown block type: %s", strings.Join(x.Token, " "))})
+				continue
+			}
+			for _, l := range x.Line {
+				addUse(l, l.Token)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return wf, nil
+}
+
+// AbsDir returns the absolute path of the module directory dir,
+// as written in a use directive of wf.
+func (wf *WorkFile) AbsDir(dir string) string {
+	dir = filepath.FromSlash(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(wf.Path), dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// UsePath returns the path to write in a use directive of wf for the
+// absolute directory dir: relative to the directory containing the go.work
+// file when possible, and slash-separated.
+func (wf *WorkFile) UsePath(dir string) string {
+	rel, err := filepath.Rel(filepath.Dir(wf.Path), dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// SetUse replaces the use directives of wf with a single directive listing
+// dirs, preserving the comments on directories that were already listed.
+func (wf *WorkFile) SetUse(dirs []string) {
+	old := make(map[string]*modfile.Line)
+	for _, u := range wf.Use {
+		old[u.Path] = u.Syntax
+	}
+
+	stmts := wf.Syntax.Stmt[:0]
+	for _, stmt := range wf.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if x.Token[0] == "use" {
+				continue
+			}
+		case *modfile.LineBlock:
+			if x.Token[0] == "use" {
+				continue
+			}
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	wf.Use = nil
+	var lines []*modfile.Line
+	for _, dir := range dirs {
+		line := &modfile.Line{Token: []string{modfile.AutoQuote(dir)}, InBlock: true}
+		if prev := old[dir]; prev != nil {
+			line.Comments = prev.Comments
+		}
+		lines = append(lines, line)
+		wf.Use = append(wf.Use, &WorkUse{Path: dir, Syntax: line})
+	}
+	switch len(lines) {
+	case 0:
+	case 1:
+		line := lines[0]
+		line.Token = append([]string{"use"}, line.Token...)
+		line.InBlock = false
+		stmts = append(stmts, line)
+	default:
+		stmts = append(stmts, &modfile.LineBlock{Token: []string{"use"}, Line: lines})
+	}
+	wf.Syntax.Stmt = stmts
+}
+
+// Format returns the contents of wf, formatted in standard style.
+func (wf *WorkFile) Format() []byte {
+	return modfile.Format(wf.Syntax)
+}
+
+// WriteWorkFile writes wf to its file.
+func WriteWorkFile(wf *WorkFile) {
+	if err := os.WriteFile(wf.Path, wf.Format(), 0666); err != nil {
+		base.Fatalf("go: %v", err)
+	}
+}
+
+// CreateWorkFile creates a new go.work file at path listing the modules in
+// dirs, which must each contain a go.mod file.
+func CreateWorkFile(path string, dirs []string) {
+	if _, err := fsys.Stat(path); err == nil {
+		base.Fatalf("go: %s already exists", base.ShortPath(path))
+	}
+
+	tags := build.Default.ReleaseTags
+	version := tags[len(tags)-1]
+	if !strings.HasPrefix(version, "go") || !modfile.GoVersionRE.MatchString(version[2:]) {
+		base.Fatalf("go: unrecognized default version %q", version)
+	}
+	wf, err := ParseWorkFile(path, []byte("go "+version[2:]+"\n"))
+	if err != nil {
+		base.Fatalf("go: internal error: %v", err)
+	}
+
+	var use []string
+	for _, dir := range dirs {
+		abs := absWorkDir(dir)
+		if !hasGoMod(abs) {
+			base.Fatalf("go: directory %s does not contain a go.mod file", base.ShortPath(abs))
+		}
+		use = appendUse(use, wf.UsePath(abs))
+	}
+	wf.SetUse(use)
+	WriteWorkFile(wf)
+}
+
+// UpdateWorkFileUse adds the modules in dirs to the go.work file that
+// applies to the current directory and removes any listed directories in
+// dirs that no longer contain a go.mod file. If recursive is set, the
+// directory trees rooted at dirs are searched for modules.
+func UpdateWorkFileUse(dirs []string, recursive bool) {
+	path := FindGoWork(base.Cwd)
+	if path == "" {
+		base.Fatalf("go: no go.work file found\n\t(run 'go work init' first or specify path using GOWORK environment variable)")
+	}
+	wf, err := ReadWorkFile(path)
+	if err != nil {
+		base.Fatalf("go: %v", err)
+	}
+
+	listed := make(map[string]string) // absolute directory → path in go.work
+	var use []string
+	for _, u := range wf.Use {
+		listed[wf.AbsDir(u.Path)] = u.Path
+		use = append(use, u.Path)
+	}
+
+	drop := make(map[string]bool)
+	lookDir := func(dir string) {
+		if hasGoMod(dir) {
+			if _, ok := listed[dir]; !ok {
+				use = appendUse(use, wf.UsePath(dir))
+			}
+			delete(drop, dir)
+			return
+		}
+		if p, ok := listed[dir]; ok {
+			drop[p] = true
+		}
+	}
+
+	for _, arg := range dirs {
+		dir := absWorkDir(arg)
+		if !recursive {
+			if !hasGoMod(dir) {
+				if _, ok := listed[dir]; !ok {
+					base.Fatalf("go: directory %s does not contain a go.mod file", base.ShortPath(dir))
+				}
+			}
+			lookDir(dir)
+			continue
+		}
+
+		// Listed directories under dir that have since been removed are not
+		// reached by the walk below; drop them too.
+		for ldir := range listed {
+			if search.InDir(ldir, dir) != "" {
+				if _, err := os.Stat(ldir); os.IsNotExist(err) {
+					drop[listed[ldir]] = true
+				}
+			}
+		}
+		err := fsys.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == dir {
+					return nil
+				}
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if path != dir {
+				elem := filepath.Base(path)
+				if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" || elem == "vendor" {
+					return filepath.SkipDir
+				}
+			}
+			lookDir(path)
+			return nil
+		})
+		if err != nil {
+			base.Fatalf("go: %v", err)
+		}
+	}
+
+	kept := use[:0]
+	for _, u := range use {
+		if !drop[u] {
+			kept = append(kept, u)
+		}
+	}
+	wf.SetUse(kept)
+	WriteWorkFile(wf)
+}
+
+// absWorkDir returns dir, a directory named on the command line,
+// as a clean absolute path.
+func absWorkDir(dir string) string {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(base.Cwd, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// hasGoMod reports whether dir contains a go.mod file.
+func hasGoMod(dir string) bool {
+	fi, err := fsys.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil && !fi.IsDir()
+}
+
+// appendUse appends dir to use if it is not already present.
+func appendUse(use []string, dir string) []string {
+	for _, u := range use {
+		if u == dir {
+			return use
+		}
+	}
+	return append(use, dir)
+}
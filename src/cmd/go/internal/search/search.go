@@ -202,10 +202,13 @@ func (m *Match) MatchPackages() {
 	}
 }
 
-var modRoot string
+var modRoots []string
 
-func SetModRoot(dir string) {
-	modRoot = dir
+// SetModRoots sets the directories that local patterns may match within:
+// the root of the main module, or the roots of all main modules (and the
+// directory containing go.work) in workspace mode.
+func SetModRoots(dirs []string) {
+	modRoots = dirs
 }
 
 // MatchDirs sets m.Dirs to a non-nil slice containing all directories that
@@ -253,14 +256,25 @@ func (m *Match) MatchDirs() {
 	// We need to preserve the ./ for pattern matching
 	// and in the returned import paths.
 
-	if modRoot != "" {
+	if len(modRoots) > 0 {
 		abs, err := filepath.Abs(dir)
 		if err != nil {
 			m.AddError(err)
 			return
 		}
-		if !hasFilepathPrefix(abs, modRoot) {
-			m.AddError(fmt.Errorf("directory %s is outside module root (%s)", abs, modRoot))
+		found := false
+		for _, modRoot := range modRoots {
+			if hasFilepathPrefix(abs, modRoot) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if len(modRoots) == 1 {
+				m.AddError(fmt.Errorf("directory %s is outside module root (%s)", abs, modRoots[0]))
+			} else {
+				m.AddError(fmt.Errorf("directory %s is outside modules listed in go.work", abs))
+			}
 			return
 		}
 	}
@@ -294,8 +308,9 @@ func (m *Match) MatchDirs() {
 		}
 
 		if !top && cfg.ModulesEnabled {
-			// Ignore other modules found in subdirectories.
-			if fi, err := fsys.Stat(filepath.Join(path, "go.mod")); err == nil && !fi.IsDir() {
+			// Ignore other modules found in subdirectories,
+			// unless they are themselves main modules.
+			if fi, err := fsys.Stat(filepath.Join(path, "go.mod")); err == nil && !fi.IsDir() && !isModRoot(path) {
 				return filepath.SkipDir
 			}
 		}
@@ -329,6 +344,23 @@ func (m *Match) MatchDirs() {
 	}
 }
 
+// isModRoot reports whether dir is the root directory of a main module.
+func isModRoot(dir string) bool {
+	if len(modRoots) < 2 {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, modRoot := range modRoots {
+		if abs == modRoot {
+			return true
+		}
+	}
+	return false
+}
+
 // TreeCanMatchPattern(pattern)(name) reports whether
 // name or children of name can possibly match pattern.
 // Pattern is the same limited glob accepted by matchPattern.
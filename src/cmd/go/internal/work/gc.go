@@ -114,6 +114,12 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg, embedcfg
 	if symabis != "" {
 		gcargs = append(gcargs, "-symabis", symabis)
 	}
+	if cfg.BuildPGOFile != "" {
+		gcargs = append(gcargs, "-pgoprofile", cfg.BuildPGOFile)
+	}
+	if p.Internal.FuzzInstrument {
+		gcargs = append(gcargs, "-d=libfuzzer")
+	}
 
 	gcflags := str.StringList(forcedGcflags, p.Internal.Gcflags)
 	if compilingRuntime {
@@ -41,6 +41,21 @@ func BuildInit() {
 		cfg.BuildPkgdir = p
 	}
 
+	// Likewise for the -pgo profile, which the compiler reads.
+	if cfg.BuildPGO != "" && cfg.BuildPGO != "off" {
+		if cfg.BuildToolchainName == "gccgo" {
+			base.Fatalf("go %s: -pgo is not supported with -compiler=gccgo", flag.Args()[0])
+		}
+		p, err := filepath.Abs(cfg.BuildPGO)
+		if err == nil {
+			_, err = os.Stat(p)
+		}
+		if err != nil {
+			base.Fatalf("go %s: -pgo: %v", flag.Args()[0], err)
+		}
+		cfg.BuildPGOFile = p
+	}
+
 	// Make sure CC and CXX are absolute paths
 	for _, key := range []string{"CC", "CXX"} {
 		if path := cfg.Getenv(key); !filepath.IsAbs(path) && path != "" && path != filepath.Base(path) {
@@ -0,0 +1,35 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// go work init
+
+package workcmd
+
+import (
+	"cmd/go/internal/base"
+	"cmd/go/internal/modload"
+	"context"
+	"path/filepath"
+)
+
+var cmdInit = &base.Command{
+	UsageLine: "go work init [moddirs]",
+	Short:     "initialize workspace file",
+	Long: `
+Init initializes and writes a new go.work file in the current directory,
+in effect creating a new workspace rooted at the current directory. The
+go.work file must not already exist.
+
+Init optionally accepts paths to the workspace modules as arguments. Each
+must be a directory containing a go.mod file. If an argument is omitted,
+an empty workspace with no modules is created; add modules to it with
+'go work use'.
+`,
+	Run: runInit,
+}
+
+func runInit(ctx context.Context, cmd *base.Command, args []string) {
+	modload.ForceUseModules = true
+	modload.CreateWorkFile(filepath.Join(base.Cwd, "go.work"), args)
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// go work sync
+
+package workcmd
+
+import (
+	"cmd/go/internal/base"
+	"cmd/go/internal/modload"
+	"context"
+)
+
+var cmdSync = &base.Command{
+	UsageLine: "go work sync",
+	Short:     "sync workspace build list to modules",
+	Long: `
+Sync syncs the workspace's build list back to the workspace's modules.
+
+The workspace's build list is the set of versions of all the (transitive)
+dependency modules used to do builds in the workspace. Sync computes it
+using minimal version selection over the requirements of all of the
+workspace modules.
+
+Sync then raises each dependency requirement listed in the go.mod file of
+each workspace module to the version selected for the workspace, if that
+version is higher. Requirements on other workspace modules are left
+unchanged. Finally, sync adds to each module's go.sum file the checksums
+needed to build that module on its own.
+`,
+	Run: runSync,
+}
+
+func runSync(ctx context.Context, cmd *base.Command, args []string) {
+	if len(args) > 0 {
+		base.Fatalf("go work sync: no arguments allowed")
+	}
+	modload.ForceUseModules = true
+	modload.SyncWorkspace(ctx)
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// go work use
+
+package workcmd
+
+import (
+	"cmd/go/internal/base"
+	"cmd/go/internal/modload"
+	"context"
+)
+
+var cmdUse = &base.Command{
+	UsageLine: "go work use [-r] moddirs",
+	Short:     "add modules to workspace file",
+	Long: `
+Use provides a command-line interface for adding directories,
+optionally recursively, to a go.work file.
+
+A use directive is added to the go.work file for each argument
+directory that contains a go.mod file. Arguments that are listed in the
+go.work file but no longer contain a go.mod file are removed from it.
+
+The -r flag searches recursively for modules in the argument
+directories, and the use command operates as if each of the directories
+were specified as arguments: namely, use directives are added for
+directories that contain modules, and removed for listed directories
+that no longer do.
+`,
+	Run: runUse,
+}
+
+var useR bool // if true, search the directory trees for modules.
+
+func init() {
+	cmdUse.Flag.BoolVar(&useR, "r", false, "")
+}
+
+func runUse(ctx context.Context, cmd *base.Command, args []string) {
+	if len(args) == 0 {
+		base.Fatalf("go work use: no directories specified")
+	}
+	modload.ForceUseModules = true
+	modload.UpdateWorkFileUse(args, useR)
+}
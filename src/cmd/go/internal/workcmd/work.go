@@ -0,0 +1,50 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package workcmd implements the ``go work'' command.
+package workcmd
+
+import (
+	"cmd/go/internal/base"
+)
+
+var CmdWork = &base.Command{
+	UsageLine: "go work",
+	Short:     "workspace maintenance",
+	Long: `Go work provides access to operations on workspaces.
+
+A workspace is a set of modules that are developed together. It is
+described by a go.work file, which lists the directories of the modules
+in the workspace, each in a use directive:
+
+	go 1.16
+
+	use (
+		./api
+		./server
+	)
+
+When the current directory or one of its parents contains a go.work file
+(or the GOWORK environment variable names one), the go command runs in
+workspace mode: all of the modules listed are main modules. Their packages
+import each other's packages directly from their directories, whatever
+versions their go.mod files require, so changes spanning several modules
+can be built and tested without adding replace directives to any go.mod
+file. Replace and exclude directives from all of the workspace modules
+apply to the workspace as a whole.
+
+In workspace mode, go.mod files are not updated and -mod may only be set
+to readonly. Checksums already recorded in each module's go.sum are used,
+and any new checksums are recorded in a go.work.sum file next to go.work.
+The 'go get' and 'go mod' commands ignore go.work and operate on the
+module in the current directory. Set GOWORK=off to disable workspace mode
+for other commands too.
+`,
+
+	Commands: []*base.Command{
+		cmdInit,
+		cmdSync,
+		cmdUse,
+	},
+}
@@ -39,6 +39,7 @@ import (
 	"cmd/go/internal/version"
 	"cmd/go/internal/vet"
 	"cmd/go/internal/work"
+	"cmd/go/internal/workcmd"
 )
 
 func init() {
@@ -60,6 +61,7 @@ func init() {
 		tool.CmdTool,
 		version.CmdVersion,
 		vet.CmdVet,
+		workcmd.CmdWork,
 
 		help.HelpBuildConstraint,
 		help.HelpBuildmode,
@@ -291,6 +291,8 @@ Script:
 				ok = canMSan
 			case "race":
 				ok = canRace
+			case "fuzz":
+				ok = canFuzz
 			case "net":
 				ok = testenv.HasExternalNetwork()
 			case "link":
@@ -1743,9 +1743,15 @@ func (state *dodataState) allocateDataSections(ctxt *Link) {
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.enoptrbss", 0), sect)
 	ldr.SetSymSect(ldr.LookupOrCreateSym("runtime.end", 0), sect)
 
-	// Coverage instrumentation counters for libfuzzer.
+	// Coverage instrumentation counters for libfuzzer. If the program
+	// has no instrumented code, internal/fuzz's markers delimit an empty
+	// range at the end of .noptrbss instead.
 	if len(state.data[sym.SLIBFUZZER_EXTRA_COUNTER]) > 0 {
-		state.allocateNamedSectionAndAssignSyms(&Segdata, "__libfuzzer_extra_counters", sym.SLIBFUZZER_EXTRA_COUNTER, sym.Sxxx, 06)
+		sect = state.allocateNamedSectionAndAssignSyms(&Segdata, "__libfuzzer_extra_counters", sym.SLIBFUZZER_EXTRA_COUNTER, sym.Sxxx, 06)
+	}
+	if s := ldr.Lookup("internal/fuzz._counters", 0); s != 0 {
+		ldr.SetSymSect(s, sect)
+		ldr.SetSymSect(ldr.Lookup("internal/fuzz._ecounters", 0), sect)
 	}
 
 	if len(state.data[sym.STLSBSS]) > 0 {
@@ -2409,6 +2415,7 @@ func (ctxt *Link) address() []*sym.Segment {
 	var noptr *sym.Section
 	var bss *sym.Section
 	var noptrbss *sym.Section
+	var fuzzCounters *sym.Section
 	for i, s := range Segdata.Sections {
 		if (ctxt.IsELF || ctxt.HeadType == objabi.Haix) && s.Name == ".tbss" {
 			continue
@@ -2432,6 +2439,9 @@ func (ctxt *Link) address() []*sym.Segment {
 		if s.Name == ".noptrbss" {
 			noptrbss = s
 		}
+		if s.Name == "__libfuzzer_extra_counters" {
+			fuzzCounters = s
+		}
 	}
 
 	// Assign Segdata's Filelen omitting the BSS. We do this here
@@ -2547,6 +2557,16 @@ func (ctxt *Link) address() []*sym.Segment {
 	ctxt.xdefine("runtime.enoptrbss", sym.SNOPTRBSS, int64(noptrbss.Vaddr+noptrbss.Length))
 	ctxt.xdefine("runtime.end", sym.SBSS, int64(Segdata.Vaddr+Segdata.Length))
 
+	if ctxt.loader.Lookup("internal/fuzz._counters", 0) != 0 {
+		if fuzzCounters != nil {
+			ctxt.xdefine("internal/fuzz._counters", sym.SLIBFUZZER_EXTRA_COUNTER, int64(fuzzCounters.Vaddr))
+			ctxt.xdefine("internal/fuzz._ecounters", sym.SLIBFUZZER_EXTRA_COUNTER, int64(fuzzCounters.Vaddr+fuzzCounters.Length))
+		} else {
+			ctxt.xdefine("internal/fuzz._counters", sym.SNOPTRBSS, int64(noptrbss.Vaddr+noptrbss.Length))
+			ctxt.xdefine("internal/fuzz._ecounters", sym.SNOPTRBSS, int64(noptrbss.Vaddr+noptrbss.Length))
+		}
+	}
+
 	if ctxt.IsSolaris() {
 		// On Solaris, in the runtime it sets the external names of the
 		// end symbols. Unset them and define separate symbols, so we
@@ -0,0 +1,180 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "errors"
+
+var errBitstream = errors.New("bitstream overrun")
+
+// A bitReader reads a little-endian bitstream from the front of a byte
+// slice, least significant bit first. It is used for FSE table
+// descriptions.
+type bitReader struct {
+	data []byte
+	off  int    // next byte of data to load
+	bits uint64 // unconsumed bits, least significant first
+	cnt  uint   // number of valid bits in bits
+}
+
+func (br *bitReader) init(data []byte) {
+	*br = bitReader{data: data}
+}
+
+// peek returns the next n bits, n <= 32, without consuming them.
+// Missing bits past the end of the data read as zero.
+func (br *bitReader) peek(n uint) uint32 {
+	for br.cnt < n && br.off < len(br.data) {
+		br.bits |= uint64(br.data[br.off]) << br.cnt
+		br.off++
+		br.cnt += 8
+	}
+	return uint32(br.bits & (1<<n - 1))
+}
+
+// skip consumes n bits, which must have been peeked.
+func (br *bitReader) skip(n uint) error {
+	if n > br.cnt {
+		return errBitstream
+	}
+	br.bits >>= n
+	br.cnt -= n
+	return nil
+}
+
+// read consumes and returns the next n bits, n <= 32.
+func (br *bitReader) read(n uint) (uint32, error) {
+	v := br.peek(n)
+	return v, br.skip(n)
+}
+
+// bytesRead returns the number of bytes of data holding consumed bits.
+func (br *bitReader) bytesRead() int {
+	return br.off - int(br.cnt/8)
+}
+
+// A reverseBitReader reads a bitstream from the back of a byte slice,
+// most significant bit first, as used by Huffman-coded literals and
+// by sequences. The last byte holds a 1 bit marking where the stream
+// starts; the bits above it are padding.
+type reverseBitReader struct {
+	data []byte
+	off  int    // data[:off] has not been loaded yet
+	bits uint64 // the low cnt bits are unconsumed, most significant first
+	cnt  uint
+}
+
+func (br *reverseBitReader) init(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty bitstream")
+	}
+	last := data[len(data)-1]
+	if last == 0 {
+		return errors.New("missing bitstream start marker")
+	}
+	*br = reverseBitReader{
+		data: data,
+		off:  len(data) - 1,
+		bits: uint64(last),
+		cnt:  highBit(uint32(last)),
+	}
+	br.fill()
+	return nil
+}
+
+// fill loads bytes until at least 57 bits are available or the data is
+// exhausted.
+func (br *reverseBitReader) fill() {
+	for br.cnt <= 56 && br.off > 0 {
+		br.off--
+		br.bits = br.bits<<8 | uint64(br.data[br.off])
+		br.cnt += 8
+	}
+}
+
+// read consumes and returns the next n bits, n <= 32.
+func (br *reverseBitReader) read(n uint) (uint32, error) {
+	if br.cnt < n {
+		br.fill()
+		if br.cnt < n {
+			return 0, errBitstream
+		}
+	}
+	br.cnt -= n
+	return uint32(br.bits>>br.cnt) & (1<<n - 1), nil
+}
+
+// peek returns the next n bits, n <= 32, without consuming them.
+// Missing bits past the end of the stream read as zero.
+func (br *reverseBitReader) peek(n uint) uint32 {
+	if br.cnt < n {
+		br.fill()
+		if br.cnt < n {
+			return uint32(br.bits<<(n-br.cnt)) & (1<<n - 1)
+		}
+	}
+	return uint32(br.bits>>(br.cnt-n)) & (1<<n - 1)
+}
+
+// readPadded is like read, but reading past the start of the stream
+// yields zero bits and reports overflow instead of failing.
+func (br *reverseBitReader) readPadded(n uint) (v uint32, overflow bool) {
+	v = br.peek(n)
+	if n > br.cnt {
+		br.cnt = 0
+		return v, true
+	}
+	br.cnt -= n
+	return v, false
+}
+
+// skip consumes n bits, which must have been peeked.
+func (br *reverseBitReader) skip(n uint) error {
+	if n > br.cnt {
+		return errBitstream
+	}
+	br.cnt -= n
+	return nil
+}
+
+// done reports whether every bit of the stream has been consumed.
+func (br *reverseBitReader) done() bool {
+	return br.cnt == 0 && br.off == 0
+}
+
+// A bitWriter writes a little-endian bitstream, least significant bit
+// first. Streams meant for a reverseBitReader are written in reverse
+// symbol order and terminated by close.
+type bitWriter struct {
+	out  []byte
+	bits uint64
+	cnt  uint
+}
+
+// add writes the low n bits of v, n <= 32.
+func (bw *bitWriter) add(v uint32, n uint) {
+	bw.bits |= uint64(v&(1<<n-1)) << bw.cnt
+	bw.cnt += n
+	for bw.cnt >= 8 {
+		bw.out = append(bw.out, byte(bw.bits))
+		bw.bits >>= 8
+		bw.cnt -= 8
+	}
+}
+
+// flush writes any partial byte, padding it with zero bits.
+func (bw *bitWriter) flush() {
+	if bw.cnt > 0 {
+		bw.out = append(bw.out, byte(bw.bits))
+		bw.bits = 0
+		bw.cnt = 0
+	}
+}
+
+// close writes the start marker read by reverseBitReader.init and
+// flushes the stream.
+func (bw *bitWriter) close() {
+	bw.add(1, 1)
+	bw.flush()
+}
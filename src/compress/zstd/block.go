@@ -0,0 +1,341 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "errors"
+
+// decompressBlock decompresses the compressed block data
+// (RFC 8878, section 3.1.1.3), appending the result to z.hist.
+func (z *Reader) decompressBlock(data []byte) error {
+	literals, n, err := z.readLiterals(data)
+	if err != nil {
+		return err
+	}
+	return z.execSequences(data[n:], literals)
+}
+
+// readLiterals reads the literals section at the front of data
+// (RFC 8878, section 3.1.1.3.1), returning the literals and the size of
+// the section.
+func (z *Reader) readLiterals(data []byte) ([]byte, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errors.New("missing literals section")
+	}
+	b0 := data[0]
+	typ := b0 & 3
+	sizeFormat := (b0 >> 2) & 3
+
+	if typ == literalsRaw || typ == literalsRLE {
+		var size, hdr int
+		switch sizeFormat {
+		case 0, 2:
+			size, hdr = int(b0>>3), 1
+		case 1:
+			if len(data) < 2 {
+				return nil, 0, errors.New("literals header truncated")
+			}
+			size, hdr = int(b0>>4)|int(data[1])<<4, 2
+		case 3:
+			if len(data) < 3 {
+				return nil, 0, errors.New("literals header truncated")
+			}
+			size, hdr = int(b0>>4)|int(data[1])<<4|int(data[2])<<12, 3
+		}
+		if size > z.blockMax {
+			return nil, 0, errors.New("too many literals")
+		}
+		if typ == literalsRaw {
+			if len(data) < hdr+size {
+				return nil, 0, errors.New("literals truncated")
+			}
+			return data[hdr : hdr+size], hdr + size, nil
+		}
+		if len(data) < hdr+1 {
+			return nil, 0, errors.New("literals truncated")
+		}
+		lits := z.literalsBuf(size)
+		for i := range lits {
+			lits[i] = data[hdr]
+		}
+		return lits, hdr + 1, nil
+	}
+
+	// Huffman-compressed literals.
+	streams, hdr, nbits := 4, 0, uint(0)
+	switch sizeFormat {
+	case 0:
+		streams, hdr, nbits = 1, 3, 10
+	case 1:
+		hdr, nbits = 3, 10
+	case 2:
+		hdr, nbits = 4, 14
+	case 3:
+		hdr, nbits = 5, 18
+	}
+	if len(data) < hdr {
+		return nil, 0, errors.New("literals header truncated")
+	}
+	var v uint64
+	for i := hdr - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	mask := uint64(1)<<nbits - 1
+	size := int((v >> 4) & mask)
+	csize := int((v >> (4 + nbits)) & mask)
+	if size > z.blockMax {
+		return nil, 0, errors.New("too many literals")
+	}
+	if len(data) < hdr+csize {
+		return nil, 0, errors.New("literals truncated")
+	}
+	src := data[hdr : hdr+csize]
+
+	if typ == literalsCompressed {
+		n, err := z.huff.read(src)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.hasHuff = true
+		src = src[n:]
+	} else if !z.hasHuff {
+		return nil, 0, errors.New("treeless literals with no previous Huffman table")
+	}
+
+	lits := z.literalsBuf(size)
+	var err error
+	if streams == 1 {
+		err = z.huff.decode1(lits, src)
+	} else {
+		err = z.huff.decode4(lits, src)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return lits, hdr + csize, nil
+}
+
+// literalsBuf returns a buffer for n literals.
+func (z *Reader) literalsBuf(n int) []byte {
+	if cap(z.literals) < n {
+		z.literals = make([]byte, n, maxBlockSize)
+	}
+	return z.literals[:n]
+}
+
+// execSequences reads the sequences section data
+// (RFC 8878, section 3.1.1.3.2) and executes the sequences, copying
+// literals and matches to z.hist.
+func (z *Reader) execSequences(data, literals []byte) error {
+	if len(data) == 0 {
+		return errors.New("missing sequences section")
+	}
+	var nseq int
+	switch b0 := int(data[0]); {
+	case b0 < 128:
+		nseq, data = b0, data[1:]
+	case b0 < 255:
+		if len(data) < 2 {
+			return errors.New("sequences header truncated")
+		}
+		nseq, data = (b0-128)<<8|int(data[1]), data[2:]
+	default:
+		if len(data) < 3 {
+			return errors.New("sequences header truncated")
+		}
+		nseq, data = int(data[1])|int(data[2])<<8+0x7f00, data[3:]
+	}
+
+	if nseq == 0 {
+		if len(data) != 0 {
+			return errors.New("extra data after sequences section")
+		}
+		z.hist = append(z.hist, literals...)
+		return nil
+	}
+
+	if len(data) == 0 {
+		return errors.New("missing symbol compression modes")
+	}
+	modes := data[0]
+	if modes&3 != 0 {
+		return errors.New("reserved bits set in symbol compression modes")
+	}
+	data = data[1:]
+
+	buildPredefinedTables()
+	var err error
+	var n int
+	if z.ll, n, err = z.readTable(data, modes>>6, z.ll, &z.llBuf, &predefinedLiteralsLenFT, maxLiteralsLenCode, maxLiteralsLenLog); err != nil {
+		return err
+	}
+	data = data[n:]
+	if z.of, n, err = z.readTable(data, (modes>>4)&3, z.of, &z.ofBuf, &predefinedOffsetFT, maxOffsetCode, maxOffsetLog); err != nil {
+		return err
+	}
+	data = data[n:]
+	if z.ml, n, err = z.readTable(data, (modes>>2)&3, z.ml, &z.mlBuf, &predefinedMatchLenFT, maxMatchLenCode, maxMatchLenLog); err != nil {
+		return err
+	}
+	data = data[n:]
+
+	var br reverseBitReader
+	if err := br.init(data); err != nil {
+		return err
+	}
+	llt, oft, mlt := z.ll.entries, z.of.entries, z.ml.entries
+	llState, err := br.read(z.ll.log)
+	if err != nil {
+		return err
+	}
+	ofState, err := br.read(z.of.log)
+	if err != nil {
+		return err
+	}
+	mlState, err := br.read(z.ml.log)
+	if err != nil {
+		return err
+	}
+
+	outStart := len(z.hist)
+	for i := 0; i < nseq; i++ {
+		ofCode := uint(oft[ofState].sym)
+		mlCode := mlt[mlState].sym
+		llCode := llt[llState].sym
+
+		ofBits, err := br.read(ofCode)
+		if err != nil {
+			return err
+		}
+		offset := uint32(1)<<ofCode + ofBits
+		mi := matchLenCodes[mlCode]
+		mlBits, err := br.read(uint(mi.nbits))
+		if err != nil {
+			return err
+		}
+		matchLen := int(mi.base + mlBits)
+		li := literalsLenCodes[llCode]
+		llBits, err := br.read(uint(li.nbits))
+		if err != nil {
+			return err
+		}
+		litLen := int(li.base + llBits)
+
+		if i < nseq-1 {
+			e := llt[llState]
+			v, err := br.read(uint(e.nbits))
+			if err != nil {
+				return err
+			}
+			llState = uint32(e.base) + v
+			e = mlt[mlState]
+			if v, err = br.read(uint(e.nbits)); err != nil {
+				return err
+			}
+			mlState = uint32(e.base) + v
+			e = oft[ofState]
+			if v, err = br.read(uint(e.nbits)); err != nil {
+				return err
+			}
+			ofState = uint32(e.base) + v
+		}
+
+		// Resolve repeat offsets (RFC 8878, section 3.1.1.5).
+		if offset > 3 {
+			offset -= 3
+			z.rep[2], z.rep[1], z.rep[0] = z.rep[1], z.rep[0], offset
+		} else {
+			idx := offset - 1
+			if litLen == 0 {
+				idx++
+			}
+			switch idx {
+			case 0:
+				offset = z.rep[0]
+			case 3:
+				offset = z.rep[0] - 1
+				if offset == 0 {
+					return errors.New("invalid repeat offset")
+				}
+				z.rep[2], z.rep[1], z.rep[0] = z.rep[1], z.rep[0], offset
+			default:
+				offset = z.rep[idx]
+				if idx == 2 {
+					z.rep[2] = z.rep[1]
+				}
+				z.rep[1], z.rep[0] = z.rep[0], offset
+			}
+		}
+
+		if litLen > len(literals) {
+			return errors.New("literals length exceeds literals")
+		}
+		if len(z.hist)-outStart+litLen+matchLen > z.blockMax {
+			return errors.New("block content too large")
+		}
+		z.hist = append(z.hist, literals[:litLen]...)
+		literals = literals[litLen:]
+		if int(offset) > len(z.hist) {
+			return errors.New("match offset too large")
+		}
+		z.copyMatch(int(offset), matchLen)
+	}
+	if !br.done() {
+		return errors.New("extra bits in sequences bitstream")
+	}
+	if len(z.hist)-outStart+len(literals) > z.blockMax {
+		return errors.New("block content too large")
+	}
+	z.hist = append(z.hist, literals...)
+	return nil
+}
+
+// copyMatch appends n bytes to z.hist, copied from offset bytes back.
+// The source and destination may overlap.
+func (z *Reader) copyMatch(offset, n int) {
+	for n > 0 {
+		c := n
+		if c > offset {
+			c = offset
+		}
+		start := len(z.hist) - offset
+		z.hist = append(z.hist, z.hist[start:start+c]...)
+		n -= c
+	}
+}
+
+// readTable reads the decoding table for one sequences field according
+// to mode (RFC 8878, section 3.1.1.3.2.1), returning the table and the
+// number of bytes of data consumed. prev is the table used by the
+// previous block, buf is storage for a new table, and predefined is the
+// field's predefined table.
+func (z *Reader) readTable(data []byte, mode byte, prev, buf, predefined *fseTable, maxSym int, maxLog uint) (*fseTable, int, error) {
+	switch mode {
+	case modePredefined:
+		return predefined, 0, nil
+	case modeRLE:
+		if len(data) == 0 {
+			return nil, 0, errors.New("missing RLE symbol")
+		}
+		if int(data[0]) > maxSym {
+			return nil, 0, errors.New("invalid RLE symbol")
+		}
+		buf.setRLE(data[0])
+		return buf, 1, nil
+	case modeCompressed:
+		log, nsym, n, err := readFSEDistribution(data, z.norm[:], maxSym, maxLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := buf.build(z.norm[:nsym], log); err != nil {
+			return nil, 0, err
+		}
+		return buf, n, nil
+	default:
+		if prev == nil {
+			return nil, 0, errMissingTable
+		}
+		return prev, 0, nil
+	}
+}
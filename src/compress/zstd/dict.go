@@ -0,0 +1,76 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A dictionary holds the state a frame starts from when it is
+// compressed with a dictionary (RFC 8878, section 5).
+type dictionary struct {
+	id      uint32
+	content []byte
+
+	// The remaining fields are set only for dictionaries in the
+	// Zstandard dictionary format, not for raw content dictionaries.
+	hasTables  bool
+	huff       huffTable
+	ll, of, ml fseTable
+	rep        [3]uint32
+}
+
+// parseDictionary parses b as a Zstandard dictionary. If b does not
+// start with the dictionary magic number, it is used as raw content.
+func parseDictionary(b []byte) (*dictionary, error) {
+	if len(b) < 8 || binary.LittleEndian.Uint32(b) != dictMagic {
+		return &dictionary{content: b}, nil
+	}
+	d := &dictionary{id: binary.LittleEndian.Uint32(b[4:]), hasTables: true}
+	data := b[8:]
+
+	n, err := d.huff.read(data)
+	if err != nil {
+		return nil, dictError(err)
+	}
+	data = data[n:]
+
+	var norm [maxMatchLenCode + 1]int16
+	for _, t := range []struct {
+		ft     *fseTable
+		maxSym int
+		maxLog uint
+	}{
+		{&d.of, maxOffsetCode, maxOffsetLog},
+		{&d.ml, maxMatchLenCode, maxMatchLenLog},
+		{&d.ll, maxLiteralsLenCode, maxLiteralsLenLog},
+	} {
+		log, nsym, n, err := readFSEDistribution(data, norm[:], t.maxSym, t.maxLog)
+		if err != nil {
+			return nil, dictError(err)
+		}
+		if err := t.ft.build(norm[:nsym], log); err != nil {
+			return nil, dictError(err)
+		}
+		data = data[n:]
+	}
+
+	if len(data) < 12 {
+		return nil, dictError(errors.New("missing repeat offsets"))
+	}
+	for i := range d.rep {
+		d.rep[i] = binary.LittleEndian.Uint32(data[4*i:])
+		if d.rep[i] == 0 || int(d.rep[i]) > len(data)-12 {
+			return nil, dictError(errors.New("invalid repeat offset"))
+		}
+	}
+	d.content = data[12:]
+	return d, nil
+}
+
+func dictError(err error) error {
+	return errors.New("zstd: invalid dictionary: " + err.Error())
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"errors"
+	"sync"
+)
+
+// An fseEntry is one state of an FSE decoding table: the symbol the
+// state decodes to, and how to compute the next state from it.
+type fseEntry struct {
+	sym   uint8  // decoded symbol
+	nbits uint8  // number of bits to read for the next state
+	base  uint16 // value added to those bits to form the next state
+}
+
+// An fseTable is an FSE decoding table with 1<<log states.
+type fseTable struct {
+	log     uint
+	entries []fseEntry
+}
+
+// build fills in t from the normalized counts norm, which must sum to
+// 1<<log, counting each -1 ("less than one") as 1.
+func (t *fseTable) build(norm []int16, log uint) error {
+	size := 1 << log
+	if cap(t.entries) < size {
+		t.entries = make([]fseEntry, size)
+	}
+	t.entries = t.entries[:size]
+	t.log = log
+
+	var next [256]uint16
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			t.entries[high].sym = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = uint16(n)
+		}
+	}
+
+	// Spread the remaining symbols over the table
+	// (RFC 8878, section 4.1.1).
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			t.entries[pos].sym = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return errors.New("invalid FSE distribution")
+	}
+
+	for i := range t.entries {
+		e := &t.entries[i]
+		n := next[e.sym]
+		next[e.sym]++
+		if n == 0 {
+			return errors.New("invalid FSE distribution")
+		}
+		nbits := log - highBit(uint32(n))
+		e.nbits = uint8(nbits)
+		e.base = uint16(uint(n)<<nbits - uint(size))
+	}
+	return nil
+}
+
+// setRLE makes t a table that always decodes to sym.
+func (t *fseTable) setRLE(sym uint8) {
+	if cap(t.entries) < 1 {
+		t.entries = make([]fseEntry, 1)
+	}
+	t.entries = t.entries[:1]
+	t.entries[0] = fseEntry{sym: sym}
+	t.log = 0
+}
+
+// readFSEDistribution reads an FSE table description
+// (RFC 8878, section 4.1.1) from the front of data into norm, which
+// must have room for maxSym+1 counts. It returns the accuracy log, the
+// number of symbols described, and the number of bytes consumed.
+func readFSEDistribution(data []byte, norm []int16, maxSym int, maxLog uint) (log uint, nsym, n int, err error) {
+	var br bitReader
+	br.init(data)
+	v, err := br.read(4)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	log = uint(v) + 5
+	if log > maxLog {
+		return 0, 0, 0, errors.New("FSE accuracy log too large")
+	}
+
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	nbits := log + 1
+	sym := 0
+	for remaining > 1 {
+		if sym > maxSym {
+			return 0, 0, 0, errors.New("too many symbols in FSE distribution")
+		}
+		max := 2*threshold - 1 - remaining
+		var count int
+		if low := int(br.peek(nbits - 1)); low < max {
+			count = low
+			err = br.skip(nbits - 1)
+		} else {
+			count = int(br.peek(nbits))
+			if count >= threshold {
+				count -= max
+			}
+			err = br.skip(nbits)
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		count-- // -1 means "less than one"
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		norm[sym] = int16(count)
+		sym++
+
+		if count == 0 {
+			// A zero count is followed by 2-bit repeat flags giving
+			// the number of further zero counts.
+			for {
+				rep, err := br.read(2)
+				if err != nil {
+					return 0, 0, 0, err
+				}
+				for i := uint32(0); i < rep; i++ {
+					if sym > maxSym {
+						return 0, 0, 0, errors.New("too many symbols in FSE distribution")
+					}
+					norm[sym] = 0
+					sym++
+				}
+				if rep != 3 {
+					break
+				}
+			}
+		}
+
+		for remaining < threshold {
+			nbits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 {
+		return 0, 0, 0, errors.New("invalid FSE distribution")
+	}
+	return log, sym, br.bytesRead(), nil
+}
+
+// Predefined decoding tables for the sequences section, built on first use.
+var (
+	predefinedOnce          sync.Once
+	predefinedLiteralsLenFT fseTable
+	predefinedMatchLenFT    fseTable
+	predefinedOffsetFT      fseTable
+)
+
+func buildPredefinedTables() {
+	predefinedOnce.Do(func() {
+		if predefinedLiteralsLenFT.build(predefinedLiteralsLen[:], predefinedLiteralsLenLog) != nil ||
+			predefinedMatchLenFT.build(predefinedMatchLen[:], predefinedMatchLenLog) != nil ||
+			predefinedOffsetFT.build(predefinedOffset[:], predefinedOffsetLog) != nil {
+			panic("zstd: invalid predefined distribution")
+		}
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"math"
+	"sync"
+)
+
+// An fseSymbolTransform tells the FSE encoder how to move from a state
+// to the next state when encoding one symbol.
+type fseSymbolTransform struct {
+	deltaFindState int32
+	deltaNbBits    uint32
+}
+
+// An fseEncoder is an FSE encoding table built from normalized counts.
+// It is the inverse of the decoding table that fseTable.build builds
+// from the same counts.
+type fseEncoder struct {
+	log        uint
+	stateTable []uint16
+	symbolTT   []fseSymbolTransform
+}
+
+// build fills in e from the normalized counts norm, which must sum to
+// 1<<log, counting each -1 ("less than one") as 1.
+func (e *fseEncoder) build(norm []int16, log uint) {
+	size := 1 << log
+	e.log = log
+	if cap(e.stateTable) < size {
+		e.stateTable = make([]uint16, size)
+	}
+	e.stateTable = e.stateTable[:size]
+	if cap(e.symbolTT) < len(norm) {
+		e.symbolTT = make([]fseSymbolTransform, len(norm))
+	}
+	e.symbolTT = e.symbolTT[:len(norm)]
+
+	// Spread the symbols exactly as fseTable.build does.
+	var symbols [1 << maxMatchLenLog]uint8
+	var cumul [maxMatchLenCode + 2]int
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			cumul[s+1] = cumul[s] + 1
+			symbols[high] = uint8(s)
+			high--
+		} else {
+			cumul[s+1] = cumul[s] + int(n)
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			symbols[pos] = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+
+	// The states of each symbol, in the order the decoder assigns them.
+	for u := 0; u < size; u++ {
+		s := symbols[u]
+		e.stateTable[cumul[s]] = uint16(size + u)
+		cumul[s]++
+	}
+
+	total := int32(0)
+	for s, n := range norm {
+		tt := &e.symbolTT[s]
+		switch n {
+		case 0:
+			tt.deltaNbBits = uint32(log+1)<<16 - uint32(size)
+			tt.deltaFindState = 0
+		case -1, 1:
+			tt.deltaNbBits = uint32(log)<<16 - uint32(size)
+			tt.deltaFindState = total - 1
+			total++
+		default:
+			maxBitsOut := log - highBit(uint32(n-1))
+			minStatePlus := uint32(n) << maxBitsOut
+			tt.deltaNbBits = uint32(maxBitsOut)<<16 - minStatePlus
+			tt.deltaFindState = total - int32(n)
+			total += int32(n)
+		}
+	}
+}
+
+// An fseState is the state of an FSE encoder.
+type fseState struct {
+	e     *fseEncoder
+	value uint32
+}
+
+// init sets the state to one that decodes to sym, writing no bits.
+func (s *fseState) init(e *fseEncoder, sym uint8) {
+	tt := e.symbolTT[sym]
+	nbBitsOut := (tt.deltaNbBits + 1<<15) >> 16
+	v := nbBitsOut<<16 - tt.deltaNbBits
+	s.e = e
+	s.value = uint32(e.stateTable[int32(v>>nbBitsOut)+tt.deltaFindState])
+}
+
+// encode writes the bits that lead from sym's state to the current
+// state, and moves to a state that decodes to sym.
+func (s *fseState) encode(bw *bitWriter, sym uint8) {
+	tt := s.e.symbolTT[sym]
+	nbBitsOut := (s.value + tt.deltaNbBits) >> 16
+	bw.add(s.value, uint(nbBitsOut))
+	s.value = uint32(s.e.stateTable[int32(s.value>>nbBitsOut)+tt.deltaFindState])
+}
+
+// flush writes the current state, which the decoder reads first.
+func (s *fseState) flush(bw *bitWriter) {
+	bw.add(s.value, s.e.log)
+}
+
+// normalizeCounts scales counts, which sum to total, into norm so that
+// they sum to 1<<log. Symbols too rare to get a share of the table are
+// given the special count -1. It reports whether a valid distribution
+// was found.
+func normalizeCounts(norm []int16, counts []uint32, total int, log uint) bool {
+	size := 1 << log
+	sum := 0
+	largest := -1
+	for s, c := range counts {
+		if c == 0 {
+			norm[s] = 0
+			continue
+		}
+		n := int((uint64(c)<<log + uint64(total)/2) / uint64(total))
+		if n == 0 {
+			norm[s] = -1
+			sum++
+		} else {
+			norm[s] = int16(n)
+			sum += n
+		}
+		if largest < 0 || c > counts[largest] {
+			largest = s
+		}
+	}
+	if largest < 0 {
+		return false
+	}
+	n := int(norm[largest]) + size - sum
+	if n <= 0 {
+		return false
+	}
+	norm[largest] = int16(n)
+	return true
+}
+
+// fseCost estimates the number of bits needed to encode symbols with
+// the given counts using the distribution norm with accuracy log. It
+// returns +Inf if some symbol cannot be encoded.
+func fseCost(counts []uint32, norm []int16, log uint) float64 {
+	bits := 0.0
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		if s >= len(norm) || norm[s] == 0 {
+			return math.Inf(1)
+		}
+		p := float64(norm[s])
+		if p < 0 {
+			p = 1
+		}
+		bits += float64(c) * (float64(log) - math.Log2(p))
+	}
+	return bits
+}
+
+// appendFSEDistribution appends the FSE table description of norm
+// (RFC 8878, section 4.1.1) to b. It is the inverse of
+// readFSEDistribution.
+func appendFSEDistribution(b []byte, norm []int16, log uint) []byte {
+	bw := bitWriter{out: b}
+	bw.add(uint32(log-5), 4)
+
+	size := 1 << log
+	remaining := size + 1
+	threshold := size
+	nbits := log + 1
+	prev0 := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if prev0 {
+			start := s
+			for s < len(norm) && norm[s] == 0 {
+				s++
+			}
+			run := s - start
+			for run >= 3 {
+				bw.add(3, 2)
+				run -= 3
+			}
+			bw.add(uint32(run), 2)
+		}
+		count := int(norm[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++ // -1 is written as 0
+		if count >= threshold {
+			count += max
+		}
+		if count < max {
+			bw.add(uint32(count), nbits-1)
+		} else {
+			bw.add(uint32(count), nbits)
+		}
+		prev0 = count == 1
+		for remaining < threshold {
+			nbits--
+			threshold >>= 1
+		}
+	}
+	bw.flush()
+	return bw.out
+}
+
+// Predefined encoding tables for the sequences section, built on first use.
+var (
+	predefinedEncOnce        sync.Once
+	predefinedLiteralsLenEnc fseEncoder
+	predefinedMatchLenEnc    fseEncoder
+	predefinedOffsetEnc      fseEncoder
+)
+
+func buildPredefinedEncoders() {
+	predefinedEncOnce.Do(func() {
+		predefinedLiteralsLenEnc.build(predefinedLiteralsLen[:], predefinedLiteralsLenLog)
+		predefinedMatchLenEnc.build(predefinedMatchLen[:], predefinedMatchLenLog)
+		predefinedOffsetEnc.build(predefinedOffset[:], predefinedOffsetLog)
+	})
+}
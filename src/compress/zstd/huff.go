@@ -0,0 +1,210 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "errors"
+
+// A huffTable is a Huffman decoding table for literals. It is indexed
+// by the next maxBits bits of the stream; each entry holds the decoded
+// symbol in its high byte and the length of its code in its low byte.
+type huffTable struct {
+	maxBits uint
+	entries []uint16
+}
+
+// read reads a Huffman tree description
+// (RFC 8878, section 4.2.1) from the front of data into t, returning
+// the number of bytes consumed.
+func (t *huffTable) read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, errors.New("missing Huffman tree description")
+	}
+	var weights [256]uint8
+	var nw, n int
+	if hdr := int(data[0]); hdr < 128 {
+		// FSE-compressed weights.
+		n = 1 + hdr
+		if len(data) < n {
+			return 0, errors.New("Huffman tree description truncated")
+		}
+		var err error
+		nw, err = readHuffmanWeights(data[1:n], weights[:])
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		// Weights stored directly, four bits each.
+		nw = hdr - 127
+		n = 1 + (nw+1)/2
+		if len(data) < n {
+			return 0, errors.New("Huffman tree description truncated")
+		}
+		for i := 0; i < nw; i++ {
+			b := data[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 0xf
+			}
+		}
+	}
+	if nw >= len(weights) {
+		return 0, errors.New("too many Huffman weights")
+	}
+
+	// The weight of the last symbol is implied: it completes the
+	// total to the next power of two.
+	var total uint32
+	for _, w := range weights[:nw] {
+		if w > maxHuffmanBits {
+			return 0, errors.New("invalid Huffman weight")
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return 0, errors.New("invalid Huffman weights")
+	}
+	maxBits := highBit(total) + 1
+	if maxBits > maxHuffmanBits {
+		return 0, errors.New("Huffman table too large")
+	}
+	rest := uint32(1)<<maxBits - total
+	if rest&(rest-1) != 0 {
+		return 0, errors.New("invalid Huffman weights")
+	}
+	weights[nw] = uint8(highBit(rest) + 1)
+	nw++
+
+	size := 1 << maxBits
+	if cap(t.entries) < size {
+		t.entries = make([]uint16, size)
+	}
+	t.entries = t.entries[:size]
+	t.maxBits = maxBits
+
+	// Codes are assigned in order of increasing weight, and by symbol
+	// within a weight, each taking 1<<(weight-1) table entries.
+	pos := 0
+	for w := uint(1); w <= maxBits; w++ {
+		nbits := maxBits + 1 - w
+		for s, sw := range weights[:nw] {
+			if uint(sw) != w {
+				continue
+			}
+			e := uint16(s)<<8 | uint16(nbits)
+			for i := 0; i < 1<<(w-1); i++ {
+				t.entries[pos] = e
+				pos++
+			}
+		}
+	}
+	return n, nil
+}
+
+// readHuffmanWeights decodes FSE-compressed Huffman weights
+// (RFC 8878, section 4.2.1.2) into weights, returning their number.
+func readHuffmanWeights(data []byte, weights []uint8) (int, error) {
+	var norm [16]int16
+	log, nsym, n, err := readFSEDistribution(data, norm[:], len(norm)-1, maxHuffmanWeightLog)
+	if err != nil {
+		return 0, err
+	}
+	var t fseTable
+	if err := t.build(norm[:nsym], log); err != nil {
+		return 0, err
+	}
+
+	// Two interleaved states share one backward bitstream. Decoding
+	// stops when a state update would read past its beginning; the
+	// other state then yields the final weight.
+	var br reverseBitReader
+	if err := br.init(data[n:]); err != nil {
+		return 0, err
+	}
+	s1, err := br.read(log)
+	if err != nil {
+		return 0, err
+	}
+	s2, err := br.read(log)
+	if err != nil {
+		return 0, err
+	}
+	nw := 0
+	for {
+		if nw+2 > len(weights) {
+			return 0, errors.New("too many Huffman weights")
+		}
+		e := t.entries[s1]
+		weights[nw] = e.sym
+		nw++
+		v, overflow := br.readPadded(uint(e.nbits))
+		s1 = uint32(e.base) + v
+		if overflow {
+			weights[nw] = t.entries[s2].sym
+			return nw + 1, nil
+		}
+
+		e = t.entries[s2]
+		weights[nw] = e.sym
+		nw++
+		v, overflow = br.readPadded(uint(e.nbits))
+		s2 = uint32(e.base) + v
+		if overflow {
+			weights[nw] = t.entries[s1].sym
+			return nw + 1, nil
+		}
+	}
+}
+
+// decode1 decodes the single Huffman-coded stream data into out.
+func (t *huffTable) decode1(out, data []byte) error {
+	var br reverseBitReader
+	if err := br.init(data); err != nil {
+		return err
+	}
+	for i := range out {
+		e := t.entries[br.peek(t.maxBits)]
+		if err := br.skip(uint(e & 0xff)); err != nil {
+			return err
+		}
+		out[i] = byte(e >> 8)
+	}
+	if !br.done() {
+		return errors.New("extra bits in Huffman stream")
+	}
+	return nil
+}
+
+// decode4 decodes the four Huffman-coded streams in data, preceded by
+// their jump table, into out.
+func (t *huffTable) decode4(out, data []byte) error {
+	if len(data) < 6 {
+		return errors.New("Huffman jump table truncated")
+	}
+	n1 := int(data[0]) | int(data[1])<<8
+	n2 := int(data[2]) | int(data[3])<<8
+	n3 := int(data[4]) | int(data[5])<<8
+	data = data[6:]
+	if n1+n2+n3 >= len(data) {
+		return errors.New("invalid Huffman jump table")
+	}
+	seg := (len(out) + 3) / 4
+	if 3*seg > len(out) {
+		return errors.New("too few literals for four Huffman streams")
+	}
+	streams := [4][]byte{data[:n1], data[n1 : n1+n2], data[n1+n2 : n1+n2+n3], data[n1+n2+n3:]}
+	for i, s := range streams {
+		end := (i + 1) * seg
+		if i == 3 {
+			end = len(out)
+		}
+		if err := t.decode1(out[i*seg:end], s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
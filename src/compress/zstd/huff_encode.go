@@ -0,0 +1,236 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// A huffEncoder is a Huffman code for literals, limited to
+// maxHuffmanBits bits per code.
+type huffEncoder struct {
+	maxBits uint
+	maxSym  int // largest symbol with a code
+	lens    [256]uint8
+	codes   [256]uint16
+	weights [256]uint8
+}
+
+// build computes a Huffman code for the byte frequencies in counts.
+// It reports false if fewer than two symbols occur.
+func (h *huffEncoder) build(counts *[256]uint32) bool {
+	c := *counts
+	for {
+		if !huffLengths(&h.lens, &c) {
+			return false
+		}
+		var max uint8
+		for _, l := range h.lens {
+			if l > max {
+				max = l
+			}
+		}
+		if max <= maxHuffmanBits {
+			h.maxBits = uint(max)
+			break
+		}
+		// Flatten the distribution until the code fits.
+		for s, n := range c {
+			if n != 0 {
+				c[s] = n/2 + 1
+			}
+		}
+	}
+
+	for s, l := range h.lens {
+		if l == 0 {
+			h.weights[s] = 0
+			continue
+		}
+		h.weights[s] = uint8(h.maxBits + 1 - uint(l))
+		h.maxSym = s
+	}
+
+	// Assign codes in the order the decoder fills its table: by
+	// increasing weight, and by symbol within a weight.
+	pos := 0
+	for w := uint(1); w <= h.maxBits; w++ {
+		for s, sw := range h.weights {
+			if uint(sw) == w {
+				h.codes[s] = uint16(pos >> (w - 1))
+				pos += 1 << (w - 1)
+			}
+		}
+	}
+	return true
+}
+
+// huffLengths sets lens to the code lengths of a Huffman code for
+// counts, with no limit on the length. It reports false if fewer than
+// two symbols occur.
+func huffLengths(lens *[256]uint8, counts *[256]uint32) bool {
+	var syms [256]uint8
+	n := 0
+	for s, c := range counts {
+		lens[s] = 0
+		if c != 0 {
+			syms[n] = uint8(s)
+			n++
+		}
+	}
+	if n < 2 {
+		return false
+	}
+	// Sort the symbols by count; insertion sort is fine for 256.
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && counts[syms[j]] < counts[syms[j-1]]; j-- {
+			syms[j], syms[j-1] = syms[j-1], syms[j]
+		}
+	}
+
+	// Merge with two queues: the sorted leaves, and the internal
+	// nodes, which are created in order of increasing weight.
+	var weight [511]uint64
+	var parent [511]int16
+	for i := 0; i < n; i++ {
+		weight[i] = uint64(counts[syms[i]])
+	}
+	leaf, inner, next := 0, n, n
+	pick := func() int {
+		if leaf < n && (inner == next || weight[leaf] <= weight[inner]) {
+			leaf++
+			return leaf - 1
+		}
+		inner++
+		return inner - 1
+	}
+	for next < 2*n-1 {
+		a, b := pick(), pick()
+		weight[next] = weight[a] + weight[b]
+		parent[a], parent[b] = int16(next), int16(next)
+		next++
+	}
+
+	var depth [511]uint8
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	for i := 0; i < n; i++ {
+		lens[syms[i]] = depth[i]
+	}
+	return true
+}
+
+// appendTable appends the Huffman tree description
+// (RFC 8878, section 4.2.1) to b. It reports false if the weights
+// cannot be described.
+func (h *huffEncoder) appendTable(b []byte) ([]byte, bool) {
+	// The weight of maxSym is implied.
+	weights := h.weights[:h.maxSym]
+	start := len(b)
+	if c, ok := appendHuffmanWeights(append(b, 0), weights); ok && len(c)-start-1 < 128 {
+		if len(weights) > 128 || len(c)-start-1 < (len(weights)+1)/2 {
+			c[start] = byte(len(c) - start - 1)
+			return c, true
+		}
+	}
+	if len(weights) > 128 {
+		return b, false
+	}
+	b = append(b[:start], byte(127+len(weights)))
+	for i := 0; i < len(weights); i += 2 {
+		v := weights[i] << 4
+		if i+1 < len(weights) {
+			v |= weights[i+1]
+		}
+		b = append(b, v)
+	}
+	return b, true
+}
+
+// appendHuffmanWeights appends weights compressed with FSE using two
+// interleaved states, as read by readHuffmanWeights.
+func appendHuffmanWeights(b []byte, weights []uint8) ([]byte, bool) {
+	if len(weights) < 2 {
+		return b, false
+	}
+	var counts [maxHuffmanBits + 1]uint32
+	distinct := 0
+	for _, w := range weights {
+		if counts[w] == 0 {
+			distinct++
+		}
+		counts[w]++
+	}
+	// With a single weight value, the decoder could not tell where
+	// the stream ends.
+	if distinct < 2 {
+		return b, false
+	}
+	last := len(counts) - 1
+	for counts[last] == 0 {
+		last--
+	}
+	var norm [maxHuffmanBits + 1]int16
+	const log = maxHuffmanWeightLog
+	if !normalizeCounts(norm[:last+1], counts[:last+1], len(weights), log) {
+		return b, false
+	}
+	b = appendFSEDistribution(b, norm[:last+1], log)
+
+	var e fseEncoder
+	e.build(norm[:last+1], log)
+	bw := bitWriter{out: b}
+	var s1, s2 fseState
+	i := len(weights)
+	if i%2 != 0 {
+		s1.init(&e, weights[i-1])
+		s2.init(&e, weights[i-2])
+		s1.encode(&bw, weights[i-3])
+		i -= 3
+	} else {
+		s2.init(&e, weights[i-1])
+		s1.init(&e, weights[i-2])
+		i -= 2
+	}
+	for i > 0 {
+		s2.encode(&bw, weights[i-1])
+		s1.encode(&bw, weights[i-2])
+		i -= 2
+	}
+	s2.flush(&bw)
+	s1.flush(&bw)
+	bw.close()
+	return bw.out, true
+}
+
+// appendStream appends lits, Huffman-coded as a single stream.
+func (h *huffEncoder) appendStream(b, lits []byte) []byte {
+	bw := bitWriter{out: b}
+	for i := len(lits) - 1; i >= 0; i-- {
+		s := lits[i]
+		bw.add(uint32(h.codes[s]), uint(h.lens[s]))
+	}
+	bw.close()
+	return bw.out
+}
+
+// appendStreams4 appends lits, Huffman-coded as four streams preceded
+// by their jump table.
+func (h *huffEncoder) appendStreams4(b, lits []byte) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0, 0, 0)
+	seg := (len(lits) + 3) / 4
+	for i := 0; i < 4; i++ {
+		end := (i + 1) * seg
+		if i == 3 {
+			end = len(lits)
+		}
+		n := len(b)
+		b = h.appendStream(b, lits[i*seg:end])
+		if i < 3 {
+			size := len(b) - n
+			b[start+2*i] = byte(size)
+			b[start+2*i+1] = byte(size >> 8)
+		}
+	}
+	return b
+}
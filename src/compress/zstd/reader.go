@@ -0,0 +1,363 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// A Reader is an io.Reader that decompresses a Zstandard stream.
+//
+// The stream may consist of several frames, including skippable frames,
+// which are ignored. Reads from the Reader return the concatenation of
+// the decompressed content of each frame. A Reader reads no further
+// from its underlying reader than the end of the last frame it has
+// decompressed.
+//
+// A frame may carry a checksum of its content. The Reader returns an
+// ErrChecksum when Read reaches the end of such a frame if the checksum
+// does not match. Clients should treat data returned by Read as
+// tentative until they receive the io.EOF marking the end of the data.
+type Reader struct {
+	r      io.Reader
+	dict   *dictionary
+	err    error
+	offset int64 // bytes of compressed input consumed
+	frames int   // frames seen, including skippable frames
+
+	// State of the current frame.
+	inFrame     bool
+	frameStart  int64
+	windowSize  int
+	dictSize    int // size of the dictionary content at the start of hist
+	blockMax    int
+	hasChecksum bool
+	hasSize     bool
+	contentSize uint64
+	produced    uint64
+	hash        xxhash64
+
+	// Entropy state carried from block to block within a frame.
+	huff                huffTable
+	hasHuff             bool
+	ll, of, ml          *fseTable // tables for repeat mode, nil if unset
+	llBuf, ofBuf, mlBuf fseTable  // storage for tables read from the stream
+	rep                 [3]uint32
+
+	hist     []byte // decompressed window; ends with out
+	out      []byte // decompressed data not yet returned by Read
+	block    []byte // current compressed block
+	literals []byte // buffer for decoded literals
+	norm     [maxMatchLenCode + 1]int16
+	buf      [18]byte
+}
+
+// NewReader creates a new Reader reading the given reader.
+func NewReader(r io.Reader) *Reader {
+	z := new(Reader)
+	z.Reset(r)
+	return z
+}
+
+// NewReaderDict is like NewReader but uses the dictionary dict to
+// decompress frames that were compressed with it. Dict is either a
+// dictionary in the Zstandard dictionary format or, if it does not
+// begin with the dictionary magic number, raw content that compressed
+// data may refer back to.
+//
+// A frame that names a dictionary ID is only decompressed if dict is a
+// formatted dictionary with that ID; otherwise Read returns
+// ErrDictionary. Frames that do not name a dictionary use dict.
+func NewReaderDict(r io.Reader, dict []byte) (*Reader, error) {
+	d, err := parseDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+	z := NewReader(r)
+	z.dict = d
+	return z, nil
+}
+
+// Reset discards the Reader z's state and makes it equivalent to the
+// result of its original state from NewReader or NewReaderDict, but
+// reading from r instead. The dictionary, if any, is retained.
+func (z *Reader) Reset(r io.Reader) {
+	z.r = r
+	z.err = nil
+	z.offset = 0
+	z.frames = 0
+	z.inFrame = false
+	z.hist = z.hist[:0]
+	z.out = nil
+}
+
+// Read implements io.Reader, reading decompressed bytes from its
+// underlying Reader.
+func (z *Reader) Read(p []byte) (n int, err error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.inFrame {
+			z.err = z.readBlock()
+		} else {
+			z.err = z.readFrameHeader()
+		}
+	}
+	n = copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// readFull reads exactly len(b) bytes of compressed input.
+func (z *Reader) readFull(b []byte) error {
+	n, err := io.ReadFull(z.r, b)
+	z.offset += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readFrameHeader reads the header of the next frame, skipping any
+// skippable frames (RFC 8878, section 3.1.1.1).
+func (z *Reader) readFrameHeader() error {
+	for {
+		start := z.offset
+		n, err := io.ReadFull(z.r, z.buf[:4])
+		z.offset += int64(n)
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		z.frames++
+		magic := binary.LittleEndian.Uint32(z.buf[:])
+		if magic&skippableMagicMask == skippableMagic {
+			if err := z.readFull(z.buf[:4]); err != nil {
+				return err
+			}
+			size := int64(binary.LittleEndian.Uint32(z.buf[:]))
+			n, err := io.CopyN(io.Discard, z.r, size)
+			z.offset += n
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if magic != frameMagic {
+			return ErrHeader
+		}
+		z.frameStart = start
+		break
+	}
+
+	if err := z.readFull(z.buf[:1]); err != nil {
+		return err
+	}
+	fhd := z.buf[0]
+	fcsFlag := fhd >> 6
+	single := fhd&(1<<5) != 0
+	if fhd&(1<<3) != 0 {
+		return ErrHeader // reserved bit
+	}
+	z.hasChecksum = fhd&(1<<2) != 0
+	dictIDSize := [4]int{0, 1, 2, 4}[fhd&3]
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if single && fcsFlag == 0 {
+		fcsSize = 1
+	}
+	windowDescSize := 1
+	if single {
+		windowDescSize = 0
+	}
+	hdr := z.buf[:windowDescSize+dictIDSize+fcsSize]
+	if err := z.readFull(hdr); err != nil {
+		return err
+	}
+
+	var windowSize uint64
+	if !single {
+		exp := uint(hdr[0] >> 3)
+		mant := uint64(hdr[0] & 7)
+		base := uint64(1) << (10 + exp)
+		windowSize = base + base/8*mant
+		hdr = hdr[1:]
+	}
+
+	var dictID uint32
+	switch dictIDSize {
+	case 1:
+		dictID = uint32(hdr[0])
+	case 2:
+		dictID = uint32(binary.LittleEndian.Uint16(hdr))
+	case 4:
+		dictID = binary.LittleEndian.Uint32(hdr)
+	}
+	hdr = hdr[dictIDSize:]
+
+	z.hasSize = fcsSize > 0
+	switch fcsSize {
+	case 1:
+		z.contentSize = uint64(hdr[0])
+	case 2:
+		z.contentSize = uint64(binary.LittleEndian.Uint16(hdr)) + 256
+	case 4:
+		z.contentSize = uint64(binary.LittleEndian.Uint32(hdr))
+	case 8:
+		z.contentSize = binary.LittleEndian.Uint64(hdr)
+	}
+	if single {
+		windowSize = z.contentSize
+	}
+	if windowSize > maxWindowSize {
+		return ErrWindowSize
+	}
+	z.windowSize = int(windowSize)
+	z.blockMax = maxBlockSize
+	if z.windowSize < z.blockMax {
+		z.blockMax = z.windowSize
+	}
+
+	// Reset the frame state, starting from the dictionary if there is one.
+	z.inFrame = true
+	z.produced = 0
+	z.hash.reset()
+	z.hist = z.hist[:0]
+	z.hasHuff = false
+	z.ll, z.of, z.ml = nil, nil, nil
+	z.rep = [3]uint32{1, 4, 8}
+	z.dictSize = 0
+	d := z.dict
+	if dictID != 0 && (d == nil || d.id != dictID) {
+		return ErrDictionary
+	}
+	if d != nil {
+		z.hist = append(z.hist, d.content...)
+		z.dictSize = len(d.content)
+		if d.hasTables {
+			// Copy the Huffman table, which later blocks may overwrite.
+			z.huff.maxBits = d.huff.maxBits
+			z.huff.entries = append(z.huff.entries[:0], d.huff.entries...)
+			z.hasHuff = true
+			z.ll, z.of, z.ml = &d.ll, &d.of, &d.ml
+			z.rep = d.rep
+		}
+	}
+	return nil
+}
+
+// readBlock reads and decompresses the next block of the current frame
+// (RFC 8878, section 3.1.1.2), and the frame's checksum if it is the
+// last block.
+func (z *Reader) readBlock() error {
+	start := z.offset
+	if err := z.readFull(z.buf[:3]); err != nil {
+		return err
+	}
+	bh := uint32(z.buf[0]) | uint32(z.buf[1])<<8 | uint32(z.buf[2])<<16
+	last := bh&1 != 0
+	typ := (bh >> 1) & 3
+	size := int(bh >> 3)
+
+	// Drop data that has left the window to make room for the block.
+	// The dictionary stays in reach until the first window is full.
+	if keep := z.windowSize + z.dictSize; len(z.hist) > keep && len(z.hist)+z.blockMax > cap(z.hist) {
+		n := copy(z.hist, z.hist[len(z.hist)-keep:])
+		z.hist = z.hist[:n]
+		z.dictSize = 0
+	}
+	outStart := len(z.hist)
+
+	switch typ {
+	case blockRaw:
+		if size > z.blockMax {
+			return z.corrupt(start, "block too large")
+		}
+		z.hist = grow(z.hist, size)
+		if err := z.readFull(z.hist[outStart:]); err != nil {
+			return err
+		}
+	case blockRLE:
+		if size > z.blockMax {
+			return z.corrupt(start, "block too large")
+		}
+		if err := z.readFull(z.buf[:1]); err != nil {
+			return err
+		}
+		z.hist = grow(z.hist, size)
+		b := z.buf[0]
+		for i := outStart; i < len(z.hist); i++ {
+			z.hist[i] = b
+		}
+	case blockCompressed:
+		if size > z.blockMax {
+			return z.corrupt(start, "block too large")
+		}
+		if cap(z.block) < size {
+			z.block = make([]byte, size, maxBlockSize)
+		}
+		z.block = z.block[:size]
+		if err := z.readFull(z.block); err != nil {
+			return err
+		}
+		if err := z.decompressBlock(z.block); err != nil {
+			return z.corrupt(start, err.Error())
+		}
+	default:
+		return z.corrupt(start, "reserved block type")
+	}
+
+	z.out = z.hist[outStart:]
+	z.produced += uint64(len(z.out))
+	if z.hasChecksum {
+		z.hash.write(z.out)
+	}
+	if z.hasSize && z.produced > z.contentSize {
+		return z.corrupt(start, "frame content larger than declared")
+	}
+	if !last {
+		return nil
+	}
+
+	z.inFrame = false
+	if z.hasSize && z.produced != z.contentSize {
+		return z.corrupt(z.frameStart, "frame content smaller than declared")
+	}
+	if z.hasChecksum {
+		if err := z.readFull(z.buf[:4]); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(z.buf[:]) != uint32(z.hash.sum64()) {
+			return ErrChecksum
+		}
+	}
+	return nil
+}
+
+func (z *Reader) corrupt(offset int64, msg string) error {
+	return &CorruptInputError{Offset: offset, Msg: msg}
+}
+
+// grow extends b by n bytes, reallocating if necessary.
+func grow(b []byte, n int) []byte {
+	if len(b)+n <= cap(b) {
+		return b[:len(b)+n]
+	}
+	nb := make([]byte, len(b)+n, 2*cap(b)+n)
+	copy(nb, b)
+	return nb
+}
+
+var errMissingTable = errors.New("repeat mode with no previous table")
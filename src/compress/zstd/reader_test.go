@@ -0,0 +1,212 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	opticksFile    = "../../testdata/Isaac.Newton-Opticks.txt"
+	eFile          = "../testdata/e.txt"
+	gettysburgFile = "../testdata/gettysburg.txt"
+)
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The frames in testdata were produced by the reference zstd command,
+// version 1.5.6:
+//
+//	zstd -1 Isaac.Newton-Opticks.txt         # opticks.1.zst
+//	zstd -19 Isaac.Newton-Opticks.txt        # opticks.19.zst
+//	zstd -3 --no-check e.txt                 # e.txt.nocheck.zst
+//	zstd </dev/null                          # empty.zst
+//	head -c 300000 /dev/zero | zstd          # zeros.zst
+//	split -b 1024 Isaac.Newton-Opticks.txt s
+//	zstd --train s* --maxdict=8192 -o opticks.dict
+//	zstd -D opticks.dict gettysburg.txt      # gettysburg.dict.zst
+//	zstd -D gettysburg.txt gettysburg.txt    # gettysburg.rawdict.zst
+var readerTests = []struct {
+	name string
+	file string
+	want func(*testing.T) []byte
+	dict string
+}{
+	{name: "opticks-1", file: "testdata/opticks.1.zst", want: fileData(opticksFile)},
+	{name: "opticks-19", file: "testdata/opticks.19.zst", want: fileData(opticksFile)},
+	{name: "e-nocheck", file: "testdata/e.txt.nocheck.zst", want: fileData(eFile)},
+	{name: "empty", file: "testdata/empty.zst", want: func(*testing.T) []byte { return nil }},
+	{name: "zeros", file: "testdata/zeros.zst", want: func(*testing.T) []byte { return make([]byte, 300000) }},
+	{name: "dict", file: "testdata/gettysburg.dict.zst", want: fileData(gettysburgFile), dict: "testdata/opticks.dict"},
+	{name: "rawdict", file: "testdata/gettysburg.rawdict.zst", want: fileData(gettysburgFile), dict: gettysburgFile},
+}
+
+func fileData(name string) func(*testing.T) []byte {
+	return func(t *testing.T) []byte { return readFile(t, name) }
+}
+
+func newTestReader(t *testing.T, r io.Reader, dict string) *Reader {
+	t.Helper()
+	if dict == "" {
+		return NewReader(r)
+	}
+	z, err := NewReaderDict(r, readFile(t, dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestReader(t *testing.T) {
+	for _, tt := range readerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := ioutil.ReadAll(newTestReader(t, f, tt.dict))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.want(t); !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes, want %d bytes matching %s", len(got), len(want), tt.file)
+			}
+		})
+	}
+}
+
+func TestReaderSmallReads(t *testing.T) {
+	z := NewReader(bytes.NewReader(readFile(t, "testdata/opticks.19.zst")))
+	var got []byte
+	buf := make([]byte, 777)
+	for {
+		n, err := z.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, readFile(t, opticksFile)) {
+		t.Error("wrong output")
+	}
+}
+
+func skippableFrame(magic uint32, data string) []byte {
+	b := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(b, magic)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestReaderMultipleFrames(t *testing.T) {
+	var in bytes.Buffer
+	in.Write(skippableFrame(skippableMagic, "metadata"))
+	in.Write(readFile(t, "testdata/e.txt.nocheck.zst"))
+	in.Write(readFile(t, "testdata/empty.zst"))
+	in.Write(skippableFrame(skippableMagic|0xf, ""))
+	in.Write(readFile(t, "testdata/opticks.1.zst"))
+	in.Write(skippableFrame(skippableMagic|3, "trailer"))
+
+	got, err := ioutil.ReadAll(NewReader(&in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(readFile(t, eFile), readFile(t, opticksFile)...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	z := NewReader(bytes.NewReader(readFile(t, "testdata/opticks.1.zst")))
+	if _, err := io.CopyN(ioutil.Discard, z, 1000); err != nil {
+		t.Fatal(err)
+	}
+	z.Reset(bytes.NewReader(readFile(t, "testdata/e.txt.nocheck.zst")))
+	got, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, readFile(t, eFile)) {
+		t.Error("wrong output after Reset")
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	opticks := readFile(t, "testdata/opticks.1.zst")
+	badChecksum := append([]byte(nil), opticks...)
+	badChecksum[len(badChecksum)-1] ^= 1
+
+	hugeWindow := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0xf8, 0x01, 0x00, 0x00}
+
+	tests := []struct {
+		name string
+		in   []byte
+		dict string
+		want error
+	}{
+		{"empty input", nil, "", io.ErrUnexpectedEOF},
+		{"bad magic", []byte("not zstd"), "", ErrHeader},
+		{"truncated header", opticks[:5], "", io.ErrUnexpectedEOF},
+		{"truncated block", opticks[:1000], "", io.ErrUnexpectedEOF},
+		{"truncated checksum", opticks[:len(opticks)-2], "", io.ErrUnexpectedEOF},
+		{"bad checksum", badChecksum, "", ErrChecksum},
+		{"huge window", hugeWindow, "", ErrWindowSize},
+		{"missing dictionary", readFile(t, "testdata/gettysburg.dict.zst"), "", ErrDictionary},
+		{"wrong dictionary", readFile(t, "testdata/gettysburg.dict.zst"), gettysburgFile, ErrDictionary},
+		{"truncated skippable frame", skippableFrame(skippableMagic, "data")[:10], "", io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ioutil.ReadAll(newTestReader(t, bytes.NewReader(tt.in), tt.dict))
+			if err != tt.want {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestReaderCorrupt checks that damaged input is reported as an error,
+// and never causes a panic.
+func TestReaderCorrupt(t *testing.T) {
+	data := readFile(t, "testdata/opticks.19.zst")
+	if testing.Short() {
+		data = readFile(t, "testdata/gettysburg.dict.zst")
+	}
+	want := readFile(t, opticksFile)
+	step := len(data) / 300
+	if step == 0 {
+		step = 1
+	}
+	for i := 0; i < len(data); i += step {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0x55
+		got, err := ioutil.ReadAll(NewReader(bytes.NewReader(bad)))
+		if err == nil && !bytes.Equal(got, want) {
+			t.Errorf("corrupting byte %d: no error and wrong output", i)
+		}
+		var cerr *CorruptInputError
+		if err != nil && errors.As(err, &cerr) && (cerr.Offset < 0 || cerr.Offset > int64(i)) {
+			t.Errorf("corrupting byte %d: error %v reports later offset", i, err)
+		}
+	}
+}
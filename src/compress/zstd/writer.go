@@ -0,0 +1,670 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	NoCompression      = 0
+	BestSpeed          = 1
+	BestCompression    = 3
+	DefaultCompression = -1
+)
+
+// encoderParams tunes the match finder for a compression level.
+type encoderParams struct {
+	windowLog uint // log of the window size declared in frame headers
+	hashLog   uint // log of the number of hash table entries
+	chainLog  uint // log of the number of hash chain entries, 0 for none
+	depth     int  // maximum number of candidate matches to examine
+	lazy      bool // whether to defer a match if the next one is longer
+}
+
+var levels = [...]encoderParams{
+	NoCompression:   {windowLog: 17},
+	BestSpeed:       {windowLog: 19, hashLog: 15, depth: 1},
+	2:               {windowLog: 20, hashLog: 16, chainLog: 16, depth: 16, lazy: true},
+	BestCompression: {windowLog: 21, hashLog: 17, chainLog: 18, depth: 64, lazy: true},
+}
+
+const (
+	defaultLevel = 2
+	minMatch     = 4  // shortest match the Writer looks for
+	minCompress  = 16 // shortest block worth compressing
+)
+
+var errWriterClosed = errors.New("zstd: write to closed Writer")
+
+// A Writer is an io.WriteCloser.
+// Writes to a Writer are compressed and written to w.
+//
+// Each Writer produces a single frame, ended by Close, that carries a
+// checksum of its content.
+type Writer struct {
+	w           io.Writer
+	level       int
+	p           encoderParams
+	err         error
+	wroteHeader bool
+	closed      bool
+	hash        xxhash64
+
+	hist  []byte  // window, followed by input not yet compressed
+	pos   int     // start of the input not yet compressed in hist
+	next  int     // next position of hist to add to the hash table
+	table []int32 // hash of 4 bytes to 1 + their last position, or 0
+	chain []int32 // position to 1 + the previous position with the same hash
+	rep   int     // last match offset, the decoder's first repeat offset
+
+	// Scratch space for compressing a block.
+	seqs       []sequence
+	lits       []byte
+	codes      []uint8
+	ll, of, ml fseEncoder
+	huff       huffEncoder
+	norm       [maxMatchLenCode + 1]int16
+	out        []byte
+}
+
+// A sequence is a run of literals followed by a match.
+type sequence struct {
+	litLen   uint32
+	matchLen uint32
+	offset   uint32 // offset value as coded: a repeat code, or offset+3
+}
+
+// NewWriter returns a new Writer.
+// Writes to the returned writer are compressed and written to w.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+// Writes may be buffered and not flushed until Close.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, DefaultCompression)
+	return z
+}
+
+// NewWriterLevel is like NewWriter but specifies the compression level instead
+// of assuming DefaultCompression.
+//
+// The compression level can be DefaultCompression, NoCompression,
+// or any integer value between BestSpeed and BestCompression inclusive.
+// The error returned will be nil if the level is valid.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level < DefaultCompression || level > BestCompression {
+		return nil, errors.New("zstd: invalid compression level: " + strconv.Itoa(level))
+	}
+	if level == DefaultCompression {
+		level = defaultLevel
+	}
+	p := levels[level]
+	z := &Writer{
+		level: level,
+		p:     p,
+		hist:  make([]byte, 0, 2<<p.windowLog+maxBlockSize),
+	}
+	if p.hashLog > 0 {
+		z.table = make([]int32, 1<<p.hashLog)
+	}
+	if p.chainLog > 0 {
+		z.chain = make([]int32, 1<<p.chainLog)
+	}
+	z.Reset(w)
+	return z, nil
+}
+
+// Reset discards the Writer z's state and makes it equivalent to the
+// result of its original state from NewWriter or NewWriterLevel, but
+// writing to w instead. This permits reusing a Writer rather than
+// allocating a new one.
+func (z *Writer) Reset(w io.Writer) {
+	z.w = w
+	z.err = nil
+	z.wroteHeader = false
+	z.closed = false
+	z.hash.reset()
+	z.hist = z.hist[:0]
+	z.pos = 0
+	z.next = 0
+	for i := range z.table {
+		z.table[i] = 0
+	}
+	z.rep = 1
+}
+
+// Write writes a compressed form of p to the underlying io.Writer. The
+// compressed bytes are not necessarily flushed until the Writer is closed.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errWriterClosed
+	}
+	z.hash.write(p)
+	n := len(p)
+	for len(p) > 0 {
+		if z.pos == len(z.hist) && cap(z.hist)-len(z.hist) < maxBlockSize {
+			z.slide()
+		}
+		m := z.pos + maxBlockSize - len(z.hist)
+		if m > len(p) {
+			m = len(p)
+		}
+		z.hist = append(z.hist, p[:m]...)
+		p = p[m:]
+		if len(z.hist)-z.pos == maxBlockSize {
+			if err := z.writeBlock(false); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush flushes any pending compressed data to the underlying writer.
+//
+// It is useful mainly in compressed network protocols, to ensure that
+// a remote reader has enough data to reconstruct a packet. Flush does
+// not return until the data has been written. If the underlying
+// writer returns an error, Flush returns that error.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if z.pos < len(z.hist) {
+		return z.writeBlock(false)
+	}
+	if !z.wroteHeader {
+		z.wroteHeader = true
+		z.out = z.appendHeader(z.out[:0], false, 0)
+		_, z.err = z.w.Write(z.out)
+	}
+	return z.err
+}
+
+// Close closes the Writer by flushing any unwritten data to the
+// underlying io.Writer and writing the frame's checksum.
+// It does not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.writeBlock(true)
+}
+
+// appendHeader appends a frame header to b (RFC 8878, section 3.1.1.1).
+// A single-segment frame records its content size, size, instead of a
+// window size.
+func (z *Writer) appendHeader(b []byte, single bool, size int) []byte {
+	const (
+		singleFlag   = 1 << 5
+		checksumFlag = 1 << 2
+	)
+	b = append(b, 0x28, 0xb5, 0x2f, 0xfd)
+	if !single {
+		return append(b, checksumFlag, byte(z.p.windowLog-10)<<3)
+	}
+	switch {
+	case size < 256:
+		return append(b, singleFlag|checksumFlag, byte(size))
+	case size < 256+1<<16:
+		size -= 256
+		return append(b, 1<<6|singleFlag|checksumFlag, byte(size), byte(size>>8))
+	default:
+		return append(b, 2<<6|singleFlag|checksumFlag, byte(size), byte(size>>8), byte(size>>16), byte(size>>24))
+	}
+}
+
+// writeBlock compresses the pending input as one block and writes it,
+// preceded by the frame header if it is the first block, and followed
+// by the checksum if it is the last.
+func (z *Writer) writeBlock(last bool) error {
+	src := z.hist[z.pos:]
+	out := z.out[:0]
+	if !z.wroteHeader {
+		z.wroteHeader = true
+		// A frame that fits in one block records its size.
+		out = z.appendHeader(out, last, len(src))
+	}
+
+	start := len(out)
+	out = append(out, 0, 0, 0)
+	typ, size := blockRaw, len(src)
+	switch {
+	case z.level == NoCompression:
+	case len(src) > 1 && isRLE(src):
+		typ = blockRLE
+		out = append(out, src[0])
+	case len(src) >= minCompress:
+		rep := z.rep
+		out = z.compressBlock(out, z.pos)
+		if n := len(out) - start - 3; n < len(src) {
+			typ, size = blockCompressed, n
+		} else {
+			// The decoder will not see the matches.
+			out = out[:start+3]
+			z.rep = rep
+		}
+	}
+	if typ == blockRaw {
+		out = append(out, src...)
+	}
+	bh := uint32(size)<<3 | uint32(typ)<<1
+	if last {
+		bh |= 1
+	}
+	out[start], out[start+1], out[start+2] = byte(bh), byte(bh>>8), byte(bh>>16)
+	if last {
+		var sum [4]byte
+		binary.LittleEndian.PutUint32(sum[:], uint32(z.hash.sum64()))
+		out = append(out, sum[:]...)
+	}
+
+	z.pos = len(z.hist)
+	z.out = out
+	if _, err := z.w.Write(out); err != nil {
+		z.err = err
+		return err
+	}
+	return nil
+}
+
+func isRLE(b []byte) bool {
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// slide drops the oldest data from z.hist, keeping at least a window's
+// worth, to make room for another block.
+func (z *Writer) slide() {
+	delta := len(z.hist) - 1<<z.p.windowLog
+	if z.chain != nil {
+		// Keep chain positions congruent modulo the chain size.
+		delta &^= len(z.chain) - 1
+	}
+	if delta <= 0 {
+		return
+	}
+	n := copy(z.hist, z.hist[delta:])
+	z.hist = z.hist[:n]
+	z.pos -= delta
+	z.next -= delta
+	if z.next < 0 {
+		z.next = 0
+	}
+	rebase(z.table, int32(delta))
+	rebase(z.chain, int32(delta))
+}
+
+// rebase subtracts delta from the positions in t, clearing those that
+// fall out of the history.
+func rebase(t []int32, delta int32) {
+	for i, v := range t {
+		if v > delta {
+			t[i] = v - delta
+		} else {
+			t[i] = 0
+		}
+	}
+}
+
+// compressBlock appends the compressed form of z.hist[start:] to b
+// (RFC 8878, section 3.1.1.3).
+func (z *Writer) compressBlock(b []byte, start int) []byte {
+	z.seqs = z.seqs[:0]
+	z.lits = z.lits[:0]
+	z.findSequences(start)
+	b = z.appendLiterals(b)
+	return z.appendSequences(b)
+}
+
+// findSequences splits z.hist[start:] into sequences and trailing
+// literals, storing them in z.seqs and z.lits.
+func (z *Writer) findSequences(start int) {
+	hist := z.hist
+	end := len(hist)
+	litStart, i := start, start
+	for i+minMatch <= end {
+		off, n := z.findMatch(i, end)
+		if n < minMatch {
+			if z.chain == nil {
+				// Skip ahead faster through data that does not compress.
+				i += 1 + (i-litStart)>>5
+				z.next = i
+			} else {
+				i++
+			}
+			continue
+		}
+		if z.p.lazy {
+			for i+1+minMatch <= end {
+				off2, n2 := z.findMatch(i+1, end)
+				if n2 <= n {
+					break
+				}
+				i, off, n = i+1, off2, n2
+			}
+		}
+		for i > litStart && i > off && hist[i-1] == hist[i-1-off] {
+			i--
+			n++
+		}
+		z.addSequence(litStart, i, off, n)
+		i += n
+		litStart = i
+	}
+	z.lits = append(z.lits, hist[litStart:end]...)
+}
+
+// findMatch returns the offset and length of the longest match it
+// finds for z.hist[i:end], after adding positions up to i to the hash
+// table.
+func (z *Writer) findMatch(i, end int) (off, n int) {
+	hist := z.hist
+	for j := z.next; j < i; j++ {
+		z.insert(j)
+	}
+	cand := int(z.table[hash4(hist[i:], z.p.hashLog)]) - 1
+	z.insert(i)
+	z.next = i + 1
+
+	src := hist[i:end]
+	if r := z.rep; r <= i {
+		if l := matchLen(hist[i-r:], src); l >= minMatch {
+			off, n = r, l
+		}
+	}
+	minPos := i - 1<<z.p.windowLog
+	for depth := z.p.depth; depth > 0 && cand >= 0 && cand >= minPos; depth-- {
+		if l := matchLen(hist[cand:], src); l > n {
+			off, n = i-cand, l
+			if i+l == end {
+				break
+			}
+		}
+		// The chain entry for cand is gone once a position a whole
+		// chain later has been added.
+		if z.chain == nil || i-cand >= len(z.chain) {
+			break
+		}
+		next := int(z.chain[cand&(len(z.chain)-1)]) - 1
+		if next >= cand {
+			break
+		}
+		cand = next
+	}
+	return off, n
+}
+
+// insert adds position j of z.hist to the hash table and chains.
+func (z *Writer) insert(j int) {
+	h := hash4(z.hist[j:], z.p.hashLog)
+	if z.chain != nil {
+		z.chain[j&(len(z.chain)-1)] = z.table[h]
+	}
+	z.table[h] = int32(j + 1)
+}
+
+func hash4(b []byte, log uint) uint32 {
+	return binary.LittleEndian.Uint32(b) * 2654435761 >> (32 - log)
+}
+
+// matchLen returns the length of the common prefix of a and b, which
+// must be no longer than a.
+func matchLen(a, b []byte) int {
+	n := 0
+	for len(b)-n >= 8 {
+		if x := binary.LittleEndian.Uint64(a[n:]) ^ binary.LittleEndian.Uint64(b[n:]); x != 0 {
+			return n + bits.TrailingZeros64(x)>>3
+		}
+		n += 8
+	}
+	for n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// addSequence records the literals z.hist[litStart:i] followed by a
+// match of n bytes at offset off.
+func (z *Writer) addSequence(litStart, i, off, n int) {
+	z.lits = append(z.lits, z.hist[litStart:i]...)
+	s := sequence{litLen: uint32(i - litStart), matchLen: uint32(n)}
+	if s.litLen > 0 && off == z.rep {
+		s.offset = 1
+	} else {
+		s.offset = uint32(off) + 3
+		z.rep = off
+	}
+	z.seqs = append(z.seqs, s)
+}
+
+// appendLiterals appends the literals section for z.lits to b
+// (RFC 8878, section 3.1.1.3.1).
+func (z *Writer) appendLiterals(b []byte) []byte {
+	lits := z.lits
+	n := len(lits)
+	var counts [256]uint32
+	for _, c := range lits {
+		counts[c]++
+	}
+	if n > 1 && counts[lits[0]] == uint32(n) {
+		return append(appendLiteralsHeader(b, literalsRLE, n), lits[0])
+	}
+
+	if n >= minCompress && z.huff.build(&counts) {
+		start := len(b)
+		sizeFormat, hdr, nbits := 0, 3, uint(10)
+		if n > 1023 {
+			sizeFormat, hdr, nbits = 2, 4, 14
+			if n > 16383 {
+				sizeFormat, hdr, nbits = 3, 5, 18
+			}
+		}
+		c, ok := z.huff.appendTable(append(b, 0, 0, 0, 0, 0)[:start+hdr])
+		if ok {
+			if sizeFormat == 0 {
+				c = z.huff.appendStream(c, lits)
+			} else {
+				c = z.huff.appendStreams4(c, lits)
+			}
+			if csize := len(c) - start - hdr; csize < n {
+				v := uint64(literalsCompressed) | uint64(sizeFormat)<<2 | uint64(n)<<4 | uint64(csize)<<(4+nbits)
+				for i := 0; i < hdr; i++ {
+					c[start+i] = byte(v >> (8 * i))
+				}
+				return c
+			}
+		}
+		b = c[:start]
+	}
+	return append(appendLiteralsHeader(b, literalsRaw, n), lits...)
+}
+
+// appendLiteralsHeader appends the header of a raw or RLE literals
+// section of n literals to b.
+func appendLiteralsHeader(b []byte, typ byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(b, typ|byte(n)<<3)
+	case n < 4096:
+		return append(b, typ|1<<2|byte(n)<<4, byte(n>>4))
+	default:
+		return append(b, typ|3<<2|byte(n)<<4, byte(n>>4), byte(n>>12))
+	}
+}
+
+// appendSequences appends the sequences section for z.seqs to b
+// (RFC 8878, section 3.1.1.3.2).
+func (z *Writer) appendSequences(b []byte) []byte {
+	seqs := z.seqs
+	nseq := len(seqs)
+	switch {
+	case nseq < 128:
+		b = append(b, byte(nseq))
+	case nseq < 0x7f00:
+		b = append(b, byte(nseq>>8)+128, byte(nseq))
+	default:
+		b = append(b, 255, byte(nseq-0x7f00), byte((nseq-0x7f00)>>8))
+	}
+	if nseq == 0 {
+		return b
+	}
+
+	if cap(z.codes) < 3*nseq {
+		z.codes = make([]uint8, 3*nseq)
+	}
+	llc, ofc, mlc := z.codes[:nseq], z.codes[nseq:2*nseq], z.codes[2*nseq:3*nseq]
+	var llCounts [maxLiteralsLenCode + 1]uint32
+	var ofCounts [maxOffsetCode + 1]uint32
+	var mlCounts [maxMatchLenCode + 1]uint32
+	for i, s := range seqs {
+		llc[i] = literalsLenCode(s.litLen)
+		ofc[i] = uint8(highBit(s.offset))
+		mlc[i] = matchLenCode(s.matchLen)
+		llCounts[llc[i]]++
+		ofCounts[ofc[i]]++
+		mlCounts[mlc[i]]++
+	}
+
+	buildPredefinedEncoders()
+	modes := len(b)
+	b = append(b, 0)
+	var llMode, ofMode, mlMode byte
+	var llEnc, ofEnc, mlEnc *fseEncoder
+	b, llMode, llEnc = z.chooseTable(b, &z.ll, llCounts[:], nseq, &predefinedLiteralsLenEnc, predefinedLiteralsLen[:], predefinedLiteralsLenLog, maxLiteralsLenLog)
+	b, ofMode, ofEnc = z.chooseTable(b, &z.of, ofCounts[:], nseq, &predefinedOffsetEnc, predefinedOffset[:], predefinedOffsetLog, maxOffsetLog)
+	b, mlMode, mlEnc = z.chooseTable(b, &z.ml, mlCounts[:], nseq, &predefinedMatchLenEnc, predefinedMatchLen[:], predefinedMatchLenLog, maxMatchLenLog)
+	b[modes] = llMode<<6 | ofMode<<4 | mlMode<<2
+
+	// The decoder reads the sequences forward from the end of the
+	// bitstream, so they are written last to first.
+	bw := bitWriter{out: b}
+	var llState, ofState, mlState fseState
+	last := nseq - 1
+	llState.init(llEnc, llc[last])
+	ofState.init(ofEnc, ofc[last])
+	mlState.init(mlEnc, mlc[last])
+	addExtraBits(&bw, seqs[last], llc[last], ofc[last], mlc[last])
+	for i := last - 1; i >= 0; i-- {
+		ofState.encode(&bw, ofc[i])
+		mlState.encode(&bw, mlc[i])
+		llState.encode(&bw, llc[i])
+		addExtraBits(&bw, seqs[i], llc[i], ofc[i], mlc[i])
+	}
+	mlState.flush(&bw)
+	ofState.flush(&bw)
+	llState.flush(&bw)
+	bw.close()
+	return bw.out
+}
+
+// addExtraBits writes the bits of s's fields not given by their codes.
+func addExtraBits(bw *bitWriter, s sequence, llc, ofc, mlc uint8) {
+	li, mi := literalsLenCodes[llc], matchLenCodes[mlc]
+	bw.add(s.litLen-li.base, uint(li.nbits))
+	bw.add(s.matchLen-mi.base, uint(mi.nbits))
+	bw.add(s.offset-1<<ofc, uint(ofc))
+}
+
+// chooseTable picks the cheapest way to encode symbols with the given
+// counts (RFC 8878, section 3.1.1.3.2.1). It appends the table
+// description, if any, to b and returns it with the mode and encoder.
+func (z *Writer) chooseTable(b []byte, enc *fseEncoder, counts []uint32, nseq int, predefined *fseEncoder, predefinedNorm []int16, predefinedLog, maxLog uint) ([]byte, byte, *fseEncoder) {
+	last := len(counts) - 1
+	for counts[last] == 0 {
+		last--
+	}
+	norm := z.norm[:last+1]
+	if counts[last] == uint32(nseq) {
+		for i := range norm {
+			norm[i] = 0
+		}
+		norm[last] = 1
+		enc.build(norm, 0)
+		return append(b, byte(last)), modeRLE, enc
+	}
+
+	distinct := 0
+	for _, c := range counts {
+		if c != 0 {
+			distinct++
+		}
+	}
+	log := highBit(uint32(nseq)) + 1
+	if min := highBit(uint32(distinct)) + 2; log < min {
+		log = min
+	}
+	if log < 5 {
+		log = 5
+	}
+	if log > maxLog {
+		log = maxLog
+	}
+	best := fseCost(counts, predefinedNorm, predefinedLog)
+	if normalizeCounts(norm, counts[:last+1], nseq, log) {
+		start := len(b)
+		c := appendFSEDistribution(b, norm, log)
+		if cost := fseCost(counts, norm, log) + float64(8*(len(c)-start)); cost < best || math.IsInf(best, 1) {
+			enc.build(norm, log)
+			return c, modeCompressed, enc
+		}
+		b = c[:start]
+	}
+	return b, modePredefined, predefined
+}
+
+// Tables mapping small literals and match lengths to their codes.
+var (
+	llCodeTable = codeTable(literalsLenCodes[:], 64)
+	mlCodeTable = codeTable(matchLenCodes[:], 128)
+)
+
+// codeTable returns a table giving the code in codes for each of the
+// first n values the codes represent.
+func codeTable(codes []codeInfo, n int) []uint8 {
+	t := make([]uint8, n)
+	c := 0
+	for i := range t {
+		v := codes[0].base + uint32(i)
+		for c+1 < len(codes) && codes[c+1].base <= v {
+			c++
+		}
+		t[i] = uint8(c)
+	}
+	return t
+}
+
+func literalsLenCode(ll uint32) uint8 {
+	if ll < 64 {
+		return llCodeTable[ll]
+	}
+	return uint8(highBit(ll) + 19)
+}
+
+func matchLenCode(ml uint32) uint8 {
+	if ml-3 < 128 {
+		return mlCodeTable[ml-3]
+	}
+	return uint8(highBit(ml-3) + 36)
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// repetitiveData returns n bytes made of random phrases that recur at
+// distances up to a few megabytes, so that the Writer's history slides.
+func repetitiveData(n int) []byte {
+	r := rand.New(rand.NewSource(1))
+	phrases := make([][]byte, 500)
+	for i := range phrases {
+		phrases[i] = make([]byte, 5+r.Intn(200))
+		r.Read(phrases[i])
+	}
+	b := make([]byte, 0, n+256)
+	for len(b) < n {
+		b = append(b, phrases[r.Intn(len(phrases))]...)
+		b = append(b, byte(r.Intn(256)))
+	}
+	return b[:n]
+}
+
+func randomData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(2)).Read(b)
+	return b
+}
+
+func writerInputs(t *testing.T) []struct {
+	name string
+	data []byte
+} {
+	inputs := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one byte", []byte{'x'}},
+		{"short", []byte("hello, hello, hello, world")},
+		{"gettysburg", readFile(t, gettysburgFile)},
+		{"e", readFile(t, eFile)},
+		{"zeros", make([]byte, 300000)},
+		{"random", randomData(200000)},
+		{"opticks", readFile(t, opticksFile)},
+	}
+	if !testing.Short() {
+		inputs = append(inputs, struct {
+			name string
+			data []byte
+		}{"repetitive", repetitiveData(5 << 20)})
+	}
+	return inputs
+}
+
+func compress(t *testing.T, data []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	got, err := ioutil.ReadAll(NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestWriter(t *testing.T) {
+	for _, in := range writerInputs(t) {
+		for level := DefaultCompression; level <= BestCompression; level++ {
+			c := compress(t, in.data, level)
+			if got := decompress(t, c); !bytes.Equal(got, in.data) {
+				t.Errorf("%s, level %d: round trip mismatch", in.name, level)
+			}
+			if level != NoCompression && len(in.data) > 1000 && in.name != "random" && len(c) >= len(in.data)*3/4 {
+				t.Errorf("%s, level %d: compressed %d bytes to %d", in.name, level, len(in.data), len(c))
+			}
+		}
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	// The reference implementation writes the same frame.
+	if got, want := compress(t, nil, DefaultCompression), readFile(t, "testdata/empty.zst"); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestWriterSmallWrites(t *testing.T) {
+	data := readFile(t, opticksFile)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompress(t, buf.Bytes()), data) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	data := readFile(t, opticksFile)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := 0, 1; i < len(data); n *= 3 {
+		end := i + n
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// Everything written so far must be decodable.
+		got := make([]byte, end)
+		if _, err := io.ReadFull(NewReader(bytes.NewReader(buf.Bytes())), got); err != nil {
+			t.Fatalf("after flushing %d bytes: %v", end, err)
+		}
+		if !bytes.Equal(got, data[:end]) {
+			t.Fatalf("after flushing %d bytes: wrong output", end)
+		}
+		i = end
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompress(t, buf.Bytes()), data) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestWriterReset(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	w := NewWriter(&buf1)
+	w.Write(readFile(t, opticksFile))
+	w.Close()
+
+	data := readFile(t, eFile)
+	w.Reset(&buf2)
+	w.Write(data)
+	w.Close()
+	if got := buf2.Bytes(); !bytes.Equal(got, compress(t, data, DefaultCompression)) {
+		t.Error("output after Reset differs from a new Writer's")
+	}
+}
+
+func TestWriterLevels(t *testing.T) {
+	for _, level := range []int{-2, BestCompression + 1} {
+		if _, err := NewWriterLevel(ioutil.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel(%d) succeeded", level)
+		}
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+type errorWriter struct{ n int }
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, io.ErrShortWrite
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestWriterError(t *testing.T) {
+	w := NewWriter(&errorWriter{n: 1})
+	data := readFile(t, opticksFile)
+	if _, err := w.Write(data); err != io.ErrShortWrite {
+		t.Errorf("Write: got %v, want %v", err, io.ErrShortWrite)
+	}
+	if err := w.Close(); err != io.ErrShortWrite {
+		t.Errorf("Close: got %v, want %v", err, io.ErrShortWrite)
+	}
+}
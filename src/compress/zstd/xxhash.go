@@ -0,0 +1,112 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxhash64 computes the 64-bit xxHash of the data written to it, with a
+// seed of zero. Zstandard frames store the low 32 bits of this hash of
+// the decompressed content as their checksum.
+type xxhash64 struct {
+	v      [4]uint64
+	buf    [32]byte
+	n      int    // number of bytes buffered in buf
+	length uint64 // total number of bytes written
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func (h *xxhash64) reset() {
+	p1, p2 := xxPrime1, xxPrime2 // variables, so that the arithmetic wraps
+	h.v[0] = p1 + p2
+	h.v[1] = p2
+	h.v[2] = 0
+	h.v[3] = -p1
+	h.n = 0
+	h.length = 0
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (h *xxhash64) stripe(b []byte) {
+	h.v[0] = xxRound(h.v[0], binary.LittleEndian.Uint64(b))
+	h.v[1] = xxRound(h.v[1], binary.LittleEndian.Uint64(b[8:]))
+	h.v[2] = xxRound(h.v[2], binary.LittleEndian.Uint64(b[16:]))
+	h.v[3] = xxRound(h.v[3], binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxhash64) write(b []byte) {
+	h.length += uint64(len(b))
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], b)
+		h.n += c
+		b = b[c:]
+		if h.n < len(h.buf) {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for len(b) >= len(h.buf) {
+		h.stripe(b)
+		b = b[len(h.buf):]
+	}
+	h.n = copy(h.buf[:], b)
+}
+
+func (h *xxhash64) sum64() uint64 {
+	var acc uint64
+	if h.length >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = xxMergeRound(acc, v)
+		}
+	} else {
+		acc = h.v[2] + xxPrime5
+	}
+	acc += h.length
+
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		acc ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		acc = bits.RotateLeft64(acc, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		acc ^= uint64(c) * xxPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxPrime2
+	acc ^= acc >> 29
+	acc *= xxPrime3
+	acc ^= acc >> 32
+	return acc
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		{strings.Repeat("0123456789", 10), 0xf80e7b96315afffa},
+	}
+	for _, tt := range tests {
+		// Write in pieces of every size to exercise the buffering.
+		for step := 1; step <= len(tt.in)+1; step++ {
+			var h xxhash64
+			h.reset()
+			for i := 0; i < len(tt.in); i += step {
+				end := i + step
+				if end > len(tt.in) {
+					end = len(tt.in)
+				}
+				h.write([]byte(tt.in[i:end]))
+			}
+			if got := h.sum64(); got != tt.want {
+				t.Errorf("xxhash64(%q) in steps of %d = %#x, want %#x", tt.in, step, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zstd implements reading and writing of Zstandard compressed data,
+// as specified in RFC 8878.
+//
+// The Reader supports the complete frame format, including skippable
+// frames, dictionaries and content checksums. The Writer produces
+// single-threaded, checksummed frames at a few compression levels.
+package zstd
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	frameMagic          = 0xFD2FB528
+	skippableMagicMask  = 0xFFFFFFF0
+	skippableMagic      = 0x184D2A50
+	dictMagic           = 0xEC30A437
+	maxBlockSize        = 128 << 10
+	minWindowSize       = 1 << 10
+	maxWindowSize       = 1 << 27 // largest window the Reader will allocate
+	maxHuffmanBits      = 11
+	maxLiteralsLenCode  = 35
+	maxMatchLenCode     = 52
+	maxOffsetCode       = 31
+	maxLiteralsLenLog   = 9
+	maxMatchLenLog      = 9
+	maxOffsetLog        = 8
+	maxHuffmanWeightLog = 6
+)
+
+var (
+	// ErrChecksum is returned when reading Zstandard data whose content
+	// checksum does not match the decompressed data.
+	ErrChecksum = errors.New("zstd: invalid checksum")
+	// ErrHeader is returned when reading Zstandard data that has an invalid
+	// frame header.
+	ErrHeader = errors.New("zstd: invalid header")
+	// ErrDictionary is returned when reading a frame that requires a
+	// dictionary the Reader was not given.
+	ErrDictionary = errors.New("zstd: missing or mismatched dictionary")
+	// ErrWindowSize is returned when reading a frame whose window is
+	// larger than the Reader is willing to allocate.
+	ErrWindowSize = errors.New("zstd: window size too large")
+)
+
+// A CorruptInputError reports the presence of corrupt input at a given offset.
+type CorruptInputError struct {
+	Offset int64  // offset in the compressed stream of the damaged block or frame
+	Msg    string // description of the problem
+}
+
+func (e *CorruptInputError) Error() string {
+	return "zstd: corrupt input at offset " + strconv.FormatInt(e.Offset, 10) + ": " + e.Msg
+}
+
+// Block types (RFC 8878, section 3.1.1.2.2).
+const (
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+	blockReserved   = 3
+)
+
+// Literals section types (RFC 8878, section 3.1.1.3.1.1).
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+)
+
+// Symbol compression modes for the sequences section
+// (RFC 8878, section 3.1.1.3.2.1).
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+)
+
+// A codeInfo gives the baseline value and number of extra bits for a
+// literals length or match length code.
+type codeInfo struct {
+	base  uint32
+	nbits uint8
+}
+
+// literalsLenCodes is indexed by literals length code
+// (RFC 8878, section 3.1.1.3.2.1.1).
+var literalsLenCodes = [maxLiteralsLenCode + 1]codeInfo{
+	{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0},
+	{8, 0}, {9, 0}, {10, 0}, {11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0},
+	{16, 1}, {18, 1}, {20, 1}, {22, 1}, {24, 2}, {28, 2}, {32, 3}, {40, 3},
+	{48, 4}, {64, 6}, {128, 7}, {256, 8}, {512, 9}, {1024, 10}, {2048, 11}, {4096, 12},
+	{8192, 13}, {16384, 14}, {32768, 15}, {65536, 16},
+}
+
+// matchLenCodes is indexed by match length code
+// (RFC 8878, section 3.1.1.3.2.1.1).
+var matchLenCodes = [maxMatchLenCode + 1]codeInfo{
+	{3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0}, {8, 0}, {9, 0}, {10, 0},
+	{11, 0}, {12, 0}, {13, 0}, {14, 0}, {15, 0}, {16, 0}, {17, 0}, {18, 0},
+	{19, 0}, {20, 0}, {21, 0}, {22, 0}, {23, 0}, {24, 0}, {25, 0}, {26, 0},
+	{27, 0}, {28, 0}, {29, 0}, {30, 0}, {31, 0}, {32, 0}, {33, 0}, {34, 0},
+	{35, 1}, {37, 1}, {39, 1}, {41, 1}, {43, 2}, {47, 2}, {51, 3}, {59, 3},
+	{67, 4}, {83, 4}, {99, 5}, {131, 7}, {259, 8}, {515, 9}, {1027, 10}, {2051, 11},
+	{4099, 12}, {8195, 13}, {16387, 14}, {32771, 15}, {65539, 16},
+}
+
+// Predefined distributions for the sequences section
+// (RFC 8878, section 3.1.1.3.2.2).
+var (
+	predefinedLiteralsLen = [...]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	predefinedMatchLen = [...]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	predefinedOffset = [...]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+const (
+	predefinedLiteralsLenLog = 6
+	predefinedMatchLenLog    = 6
+	predefinedOffsetLog      = 5
+)
+
+// highBit returns the index of the highest set bit of v, which must not
+// be zero.
+func highBit(v uint32) uint {
+	return uint(bits.Len32(v)) - 1
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package aesgcmsiv implements the AES-GCM-SIV AEAD, as specified in RFC 8452.
+//
+// AES-GCM-SIV is resistant to nonce misuse: if a nonce is repeated, the only
+// information leaked is whether the same plaintext and additional data were
+// sealed under it. It should be preferred over AES-GCM when nonce uniqueness
+// cannot be guaranteed, at the cost of requiring two passes over the data.
+package aesgcmsiv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	subtleoverlap "crypto/internal/subtle"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+const (
+	// NonceSize is the size of the nonce used with this AEAD, in bytes.
+	NonceSize = 12
+
+	// Overhead is the size of the authentication tag, and the difference
+	// between a ciphertext length and its plaintext.
+	Overhead = 16
+
+	// maxPlaintextSize and maxAdditionalDataSize are the limits from RFC
+	// 8452, Section 6. The ciphertext limit is one tag larger.
+	maxPlaintextSize      = 1 << 36
+	maxAdditionalDataSize = 1 << 36
+)
+
+var errOpen = errors.New("aesgcmsiv: message authentication failed")
+
+type aesgcmsiv struct {
+	// keyGen is the key-generating key, used to derive the per-nonce keys.
+	keyGen  cipher.Block
+	keySize int
+}
+
+// New returns an AES-GCM-SIV AEAD that uses the given 128-bit or 256-bit key.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, errors.New("aesgcmsiv: invalid key size " + strconv.Itoa(len(key)))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesgcmsiv{keyGen: block, keySize: len(key)}, nil
+}
+
+func (g *aesgcmsiv) NonceSize() int {
+	return NonceSize
+}
+
+func (g *aesgcmsiv) Overhead() int {
+	return Overhead
+}
+
+// deriveKeys returns the message-authentication key and the AES cipher keyed
+// with the message-encryption key for nonce. See RFC 8452, Section 4.
+func (g *aesgcmsiv) deriveKeys(nonce []byte) (authKey [16]byte, block cipher.Block) {
+	var input, output [aes.BlockSize]byte
+	copy(input[4:], nonce)
+
+	encKey := make([]byte, g.keySize)
+	for i := 0; i < 2+g.keySize/8; i++ {
+		binary.LittleEndian.PutUint32(input[:4], uint32(i))
+		g.keyGen.Encrypt(output[:], input[:])
+		if i < 2 {
+			copy(authKey[i*8:], output[:8])
+		} else {
+			copy(encKey[(i-2)*8:], output[:8])
+		}
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		panic("aesgcmsiv: internal error: " + err.Error())
+	}
+	return authKey, block
+}
+
+// tag computes the authentication tag over plaintext and additionalData.
+func tag(block cipher.Block, authKey *[16]byte, nonce, plaintext, additionalData []byte) [16]byte {
+	p := newPolyval(authKey[:])
+	p.update(additionalData)
+	p.update(plaintext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.updateBlock(lengths[:])
+
+	var s [16]byte
+	p.sum(&s)
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	block.Encrypt(s[:], s[:])
+	return s
+}
+
+// counterCrypt crypts in to out using block in the counter mode of RFC 8452,
+// where the first four bytes of the counter are a little-endian value.
+func counterCrypt(block cipher.Block, out, in []byte, tag *[16]byte) {
+	counter := *tag
+	counter[15] |= 0x80
+
+	var mask [aes.BlockSize]byte
+	for len(in) > 0 {
+		block.Encrypt(mask[:], counter[:])
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+
+		n := len(in)
+		if n > aes.BlockSize {
+			n = aes.BlockSize
+		}
+		for i := 0; i < n; i++ {
+			out[i] = in[i] ^ mask[i]
+		}
+		out = out[n:]
+		in = in[n:]
+	}
+}
+
+func (g *aesgcmsiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("aesgcmsiv: incorrect nonce length given to AES-GCM-SIV")
+	}
+	if uint64(len(plaintext)) > maxPlaintextSize {
+		panic("aesgcmsiv: message too large for AES-GCM-SIV")
+	}
+	if uint64(len(additionalData)) > maxAdditionalDataSize {
+		panic("aesgcmsiv: additional data too large for AES-GCM-SIV")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+Overhead)
+	if subtleoverlap.InexactOverlap(out, plaintext) {
+		panic("aesgcmsiv: invalid buffer overlap")
+	}
+
+	authKey, block := g.deriveKeys(nonce)
+	t := tag(block, &authKey, nonce, plaintext, additionalData)
+	// The tag is computed before encrypting, so that out may alias plaintext.
+	counterCrypt(block, out, plaintext, &t)
+	copy(out[len(plaintext):], t[:])
+
+	return ret
+}
+
+func (g *aesgcmsiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("aesgcmsiv: incorrect nonce length given to AES-GCM-SIV")
+	}
+	if len(ciphertext) < Overhead {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > maxPlaintextSize+Overhead {
+		return nil, errOpen
+	}
+	if uint64(len(additionalData)) > maxAdditionalDataSize {
+		return nil, errOpen
+	}
+
+	var expectedTag [16]byte
+	copy(expectedTag[:], ciphertext[len(ciphertext)-Overhead:])
+	ciphertext = ciphertext[:len(ciphertext)-Overhead]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if subtleoverlap.InexactOverlap(out, ciphertext) {
+		panic("aesgcmsiv: invalid buffer overlap")
+	}
+
+	authKey, block := g.deriveKeys(nonce)
+	counterCrypt(block, out, ciphertext, &expectedTag)
+
+	t := tag(block, &authKey, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(t[:], expectedTag[:]) != 1 {
+		// The AESNI code decrypts and authenticates concurrently, and
+		// so overwrites dst in the event of a tag mismatch. That
+		// behavior is mimicked here in order to be consistent across
+		// platforms.
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+
+	return ret, nil
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes. If the
+// original slice has sufficient capacity then no allocation is performed.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aesgcmsiv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestPolyval(t *testing.T) {
+	// RFC 8452, Section 3.
+	p := newPolyval(fromHex("25629347589242761d31f826ba4b757b"))
+	p.update(fromHex("4f4f95668c83dfb6401762bb2d01a262"))
+	p.update(fromHex("d1a24ddd2721d006bbe45f20d3c9f362"))
+	var got [16]byte
+	p.sum(&got)
+	if want := fromHex("f7a3b47b846119fae5b7866cf5e5b77e"); !bytes.Equal(got[:], want) {
+		t.Errorf("POLYVAL = %x, want %x", got, want)
+	}
+}
+
+// Test vectors from RFC 8452, Appendix C.
+var aesGCMSIVTests = []struct {
+	key, nonce, plaintext, aad, result string
+}{
+	{
+		"01000000000000000000000000000000",
+		"030000000000000000000000",
+		"",
+		"",
+		"dc20e2d83f25705bb49e439eca56de25",
+	},
+	{
+		"01000000000000000000000000000000",
+		"030000000000000000000000",
+		"0100000000000000",
+		"",
+		"b5d839330ac7b786578782fff6013b815b287c22493a364c",
+	},
+	{
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"030000000000000000000000",
+		"",
+		"",
+		"07f5f4169bbf55a8400cd47ea6fd400f",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for i, tt := range aesGCMSIVTests {
+		aead, err := New(fromHex(tt.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, plaintext, aad, want := fromHex(tt.nonce), fromHex(tt.plaintext), fromHex(tt.aad), fromHex(tt.result)
+
+		ct := aead.Seal(nil, nonce, plaintext, aad)
+		if !bytes.Equal(ct, want) {
+			t.Errorf("#%d: Seal = %x, want %x", i, ct, want)
+			continue
+		}
+		pt, err := aead.Open(nil, nonce, ct, aad)
+		if err != nil {
+			t.Errorf("#%d: Open failed: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Errorf("#%d: Open = %x, want %x", i, pt, plaintext)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, keySize := range []int{16, 32} {
+		key := make([]byte, keySize)
+		rand.Read(key)
+		aead, err := New(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce := make([]byte, NonceSize)
+		rand.Read(nonce)
+
+		for _, size := range []int{0, 1, 15, 16, 17, 31, 32, 33, 100, 1024} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			aad := plaintext[:size/3]
+
+			ct := aead.Seal(nil, nonce, plaintext, aad)
+			if len(ct) != size+Overhead {
+				t.Errorf("AES-%d, %d bytes: got ciphertext length %d", keySize*8, size, len(ct))
+			}
+			pt, err := aead.Open(nil, nonce, ct, aad)
+			if err != nil {
+				t.Errorf("AES-%d, %d bytes: Open failed: %v", keySize*8, size, err)
+				continue
+			}
+			if !bytes.Equal(pt, plaintext) {
+				t.Errorf("AES-%d, %d bytes: Open returned wrong plaintext", keySize*8, size)
+			}
+
+			// Sealing in place must produce the same result.
+			buf := append([]byte(nil), plaintext...)
+			if inPlace := aead.Seal(buf[:0], nonce, buf, aad); !bytes.Equal(inPlace, ct) {
+				t.Errorf("AES-%d, %d bytes: in-place Seal produced a different ciphertext", keySize*8, size)
+			}
+
+			// Any modification must be detected.
+			for _, i := range []int{0, len(ct) / 2, len(ct) - 1} {
+				ct[i] ^= 0x10
+				if _, err := aead.Open(nil, nonce, ct, aad); err == nil {
+					t.Errorf("AES-%d, %d bytes: Open accepted a ciphertext modified at %d", keySize*8, size, i)
+				}
+				ct[i] ^= 0x10
+			}
+			if _, err := aead.Open(nil, nonce, ct, append(aad, 0)); err == nil {
+				t.Errorf("AES-%d, %d bytes: Open accepted modified additional data", keySize*8, size)
+			}
+		}
+	}
+}
+
+func TestOpenFailureClearsOutput(t *testing.T) {
+	aead, _ := New(make([]byte, 16))
+	nonce := make([]byte, NonceSize)
+	ct := aead.Seal(nil, nonce, []byte("attack at dawn"), nil)
+	ct[0] ^= 1
+
+	dst := make([]byte, 0, len(ct))
+	if _, err := aead.Open(dst, nonce, ct, nil); err == nil {
+		t.Fatal("Open succeeded with a modified ciphertext")
+	}
+	for _, b := range dst[:len(ct)-Overhead] {
+		if b != 0 {
+			t.Fatal("Open left plaintext in dst after failing")
+		}
+	}
+}
+
+func TestBadKeySize(t *testing.T) {
+	for _, size := range []int{0, 15, 24, 33} {
+		if _, err := New(make([]byte, size)); err == nil {
+			t.Errorf("New accepted a %d-byte key", size)
+		}
+	}
+}
+
+func benchmarkSeal(b *testing.B, keySize, size int) {
+	aead, _ := New(make([]byte, keySize))
+	nonce := make([]byte, NonceSize)
+	plaintext := make([]byte, size)
+	out := make([]byte, 0, size+Overhead)
+	b.SetBytes(int64(size))
+	for i := 0; i < b.N; i++ {
+		out = aead.Seal(out[:0], nonce, plaintext, nil)
+	}
+}
+
+func BenchmarkSeal128_1K(b *testing.B) { benchmarkSeal(b, 16, 1024) }
+func BenchmarkSeal256_1K(b *testing.B) { benchmarkSeal(b, 32, 1024) }
@@ -0,0 +1,138 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aesgcmsiv
+
+import "encoding/binary"
+
+// POLYVAL is computed with the GHASH arithmetic of crypto/cipher, using the
+// relation given in RFC 8452, Appendix A:
+//
+//	POLYVAL(H, X_1, ..., X_n) = ByteReverse(GHASH(mulX_GHASH(ByteReverse(H)),
+//	    ByteReverse(X_1), ..., ByteReverse(X_n)))
+
+// fieldElement represents a value in GF(2¹²⁸), with the same bit order as
+// crypto/cipher's gcmFieldElement:
+//   the coefficient of x⁰ can be obtained by v.low >> 63.
+//   the coefficient of x⁶³ can be obtained by v.low & 1.
+//   the coefficient of x⁶⁴ can be obtained by v.high >> 63.
+//   the coefficient of x¹²⁷ can be obtained by v.high & 1.
+type fieldElement struct {
+	low, high uint64
+}
+
+// polyval computes the POLYVAL universal hash for a fixed key.
+type polyval struct {
+	// productTable contains the first sixteen multiples of the GHASH key,
+	// in bit reversed order, as in crypto/cipher.
+	productTable [16]fieldElement
+	y            fieldElement
+}
+
+// newPolyval returns a POLYVAL instance keyed with the 16-byte key h.
+func newPolyval(h []byte) *polyval {
+	p := new(polyval)
+	x := double(&fieldElement{
+		binary.LittleEndian.Uint64(h[8:]),
+		binary.LittleEndian.Uint64(h[:8]),
+	})
+	p.productTable[reverseBits(1)] = x
+	for i := 2; i < 16; i += 2 {
+		p.productTable[reverseBits(i)] = double(&p.productTable[reverseBits(i/2)])
+		p.productTable[reverseBits(i+1)] = add(&p.productTable[reverseBits(i)], &x)
+	}
+	return p
+}
+
+// update absorbs data, zero padded to a multiple of 16 bytes.
+func (p *polyval) update(data []byte) {
+	for len(data) >= 16 {
+		p.updateBlock(data)
+		data = data[16:]
+	}
+	if len(data) > 0 {
+		var block [16]byte
+		copy(block[:], data)
+		p.updateBlock(block[:])
+	}
+}
+
+// updateBlock absorbs the first 16 bytes of block.
+func (p *polyval) updateBlock(block []byte) {
+	// Loading little endian and swapping the halves is ByteReverse.
+	p.y.low ^= binary.LittleEndian.Uint64(block[8:])
+	p.y.high ^= binary.LittleEndian.Uint64(block[:8])
+	p.mul(&p.y)
+}
+
+// sum writes the POLYVAL result to out.
+func (p *polyval) sum(out *[16]byte) {
+	binary.LittleEndian.PutUint64(out[:8], p.y.high)
+	binary.LittleEndian.PutUint64(out[8:], p.y.low)
+}
+
+// reverseBits reverses the order of the bits of 4-bit number in i.
+func reverseBits(i int) int {
+	i = ((i << 2) & 0xc) | ((i >> 2) & 0x3)
+	i = ((i << 1) & 0xa) | ((i >> 1) & 0x5)
+	return i
+}
+
+// add adds two elements of GF(2¹²⁸) and returns the sum.
+func add(x, y *fieldElement) fieldElement {
+	return fieldElement{x.low ^ y.low, x.high ^ y.high}
+}
+
+// double returns the result of multiplying an element of GF(2¹²⁸) by x, in
+// GHASH's representation. This is mulX_GHASH in RFC 8452.
+func double(x *fieldElement) (double fieldElement) {
+	msbSet := x.high&1 == 1
+
+	// Because of the bit-ordering, doubling is actually a right shift.
+	double.high = x.high >> 1
+	double.high |= x.low << 63
+	double.low = x.low >> 1
+
+	// Reduce by the GHASH polynomial 1+x+x^2+x^7+x^128 if needed.
+	if msbSet {
+		double.low ^= 0xe100000000000000
+	}
+
+	return
+}
+
+var reductionTable = []uint16{
+	0x0000, 0x1c20, 0x3840, 0x2460, 0x7080, 0x6ca0, 0x48c0, 0x54e0,
+	0xe100, 0xfd20, 0xd940, 0xc560, 0x9180, 0x8da0, 0xa9c0, 0xb5e0,
+}
+
+// mul sets y to y*H, where H is the key fixed in newPolyval.
+func (p *polyval) mul(y *fieldElement) {
+	var z fieldElement
+
+	for i := 0; i < 2; i++ {
+		word := y.high
+		if i == 1 {
+			word = y.low
+		}
+
+		// Multiplication works by multiplying z by 16 and adding in
+		// one of the precomputed multiples of H.
+		for j := 0; j < 64; j += 4 {
+			msw := z.high & 0xf
+			z.high >>= 4
+			z.high |= z.low << 60
+			z.low >>= 4
+			z.low ^= uint64(reductionTable[msw]) << 48
+
+			t := &p.productTable[word&0xf]
+
+			z.low ^= t.low
+			z.high ^= t.high
+			word >>= 4
+		}
+	}
+
+	*y = z
+}
@@ -7,10 +7,9 @@
 package chacha20poly1305
 
 import (
+	"crypto/internal/subtle"
 	"encoding/binary"
-
-	"golang.org/x/crypto/internal/subtle"
-	"golang.org/x/sys/cpu"
+	"internal/cpu"
 )
 
 //go:noescape
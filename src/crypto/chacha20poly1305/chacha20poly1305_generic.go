@@ -5,10 +5,10 @@
 package chacha20poly1305
 
 import (
+	"crypto/internal/subtle"
 	"encoding/binary"
 
 	"golang.org/x/crypto/chacha20"
-	"golang.org/x/crypto/internal/subtle"
 	"golang.org/x/crypto/poly1305"
 )
 
@@ -0,0 +1,144 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+const sunscreen = "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."
+
+var aeadTests = []struct {
+	newAEAD    func([]byte) (cipher.AEAD, error)
+	key        string
+	nonce      string
+	aad        string
+	ciphertext string
+}{
+	// RFC 8439, Section 2.8.2.
+	{
+		New,
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"50515253c0c1c2c3c4c5c6c7",
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" +
+			"1ae10b594f09e26a7e902ecbd0600691",
+	},
+	// draft-irtf-cfrg-xchacha-03, Appendix A.3.1.
+	{
+		NewX,
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"404142434445464748494a4b4c4d4e4f5051525354555657",
+		"50515253c0c1c2c3c4c5c6c7",
+		"bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52e" +
+			"c0875924c1c7987947deafd8780acf49",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for i, tt := range aeadTests {
+		aead, err := tt.newAEAD(fromHex(tt.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, aad, want := fromHex(tt.nonce), fromHex(tt.aad), fromHex(tt.ciphertext)
+
+		ct := aead.Seal(nil, nonce, []byte(sunscreen), aad)
+		if !bytes.Equal(ct, want) {
+			t.Errorf("#%d: Seal = %x, want %x", i, ct, want)
+			continue
+		}
+		pt, err := aead.Open(nil, nonce, ct, aad)
+		if err != nil {
+			t.Errorf("#%d: Open failed: %v", i, err)
+			continue
+		}
+		if string(pt) != sunscreen {
+			t.Errorf("#%d: Open = %q, want %q", i, pt, sunscreen)
+		}
+
+		ct[len(ct)-1] ^= 1
+		if _, err := aead.Open(nil, nonce, ct, aad); err == nil {
+			t.Errorf("#%d: Open succeeded with a modified tag", i)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+
+	for _, newAEAD := range []func([]byte) (cipher.AEAD, error){New, NewX} {
+		aead, err := newAEAD(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if aead.Overhead() != Overhead {
+			t.Errorf("Overhead() = %d, want %d", aead.Overhead(), Overhead)
+		}
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+
+		for _, size := range []int{0, 1, 15, 16, 17, 63, 64, 65, 129, 256, 511, 1024, 4096} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			aad := plaintext[:size/2]
+
+			ct := aead.Seal(nil, nonce, plaintext, aad)
+			if len(ct) != size+Overhead {
+				t.Errorf("%d bytes: got ciphertext length %d", size, len(ct))
+			}
+			pt, err := aead.Open(nil, nonce, ct, aad)
+			if err != nil {
+				t.Errorf("%d bytes: Open failed: %v", size, err)
+				continue
+			}
+			if !bytes.Equal(pt, plaintext) {
+				t.Errorf("%d bytes: Open returned wrong plaintext", size)
+			}
+
+			// Sealing in place must produce the same result.
+			buf := append([]byte(nil), plaintext...)
+			if inPlace := aead.Seal(buf[:0], nonce, buf, aad); !bytes.Equal(inPlace, ct) {
+				t.Errorf("%d bytes: in-place Seal produced a different ciphertext", size)
+			}
+		}
+	}
+}
+
+func TestBadKeyLength(t *testing.T) {
+	if _, err := New(make([]byte, KeySize-1)); err == nil {
+		t.Error("New accepted a short key")
+	}
+	if _, err := NewX(make([]byte, KeySize+1)); err == nil {
+		t.Error("NewX accepted a long key")
+	}
+}
+
+func benchmarkSeal(b *testing.B, newAEAD func([]byte) (cipher.AEAD, error), size int) {
+	aead, _ := newAEAD(make([]byte, KeySize))
+	nonce := make([]byte, aead.NonceSize())
+	plaintext := make([]byte, size)
+	out := make([]byte, 0, size+Overhead)
+	b.SetBytes(int64(size))
+	for i := 0; i < b.N; i++ {
+		out = aead.Seal(out[:0], nonce, plaintext, nil)
+	}
+}
+
+func BenchmarkSeal1K(b *testing.B)  { benchmarkSeal(b, New, 1024) }
+func BenchmarkSealX1K(b *testing.B) { benchmarkSeal(b, NewX, 1024) }
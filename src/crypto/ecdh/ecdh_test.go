@@ -0,0 +1,341 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+)
+
+// Check that PublicKey and PrivateKey implement the interfaces documented in
+// crypto.PublicKey and crypto.PrivateKey.
+var _ interface {
+	Equal(x crypto.PublicKey) bool
+} = &ecdh.PublicKey{}
+var _ interface {
+	Public() crypto.PublicKey
+	Equal(x crypto.PrivateKey) bool
+} = &ecdh.PrivateKey{}
+
+var curves = []ecdh.Curve{ecdh.P256(), ecdh.P384(), ecdh.P521(), ecdh.X25519()}
+
+func TestECDH(t *testing.T) {
+	for _, curve := range curves {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			aliceKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bobKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			alicePubKey, err := curve.NewPublicKey(aliceKey.PublicKey().Bytes())
+			if err != nil {
+				t.Error(err)
+			}
+			if !alicePubKey.Equal(aliceKey.PublicKey()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+			if !alicePubKey.Equal(aliceKey.Public()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+
+			alicePrivKey, err := curve.NewPrivateKey(aliceKey.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !alicePrivKey.Equal(aliceKey) {
+				t.Error("encoded and decoded private keys are different")
+			}
+			if alicePrivKey.Equal(bobKey) || alicePubKey.Equal(bobKey.PublicKey()) {
+				t.Error("different keys compare equal")
+			}
+
+			bobSecret, err := bobKey.ECDH(aliceKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			aliceSecret, err := aliceKey.ECDH(bobKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bobSecret, aliceSecret) {
+				t.Error("two ECDH computations came out different")
+			}
+		})
+	}
+}
+
+func TestNISTAgainstElliptic(t *testing.T) {
+	for _, tt := range []struct {
+		curve ecdh.Curve
+		ref   elliptic.Curve
+	}{
+		{ecdh.P256(), elliptic.P256()},
+		{ecdh.P384(), elliptic.P384()},
+		{ecdh.P521(), elliptic.P521()},
+	} {
+		t.Run(tt.ref.Params().Name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				priv, err := tt.curve.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				x, y := tt.ref.ScalarBaseMult(priv.Bytes())
+				if want := elliptic.Marshal(tt.ref, x, y); !bytes.Equal(priv.PublicKey().Bytes(), want) {
+					t.Errorf("public key = %x, want %x", priv.PublicKey().Bytes(), want)
+				}
+
+				peer, err := tt.curve.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				secret, err := priv.ECDH(peer.PublicKey())
+				if err != nil {
+					t.Fatal(err)
+				}
+				px, py := elliptic.Unmarshal(tt.ref, peer.PublicKey().Bytes())
+				x, _ = tt.ref.ScalarMult(px, py, priv.Bytes())
+				want := x.FillBytes(make([]byte, (tt.ref.Params().BitSize+7)/8))
+				if !bytes.Equal(secret, want) {
+					t.Errorf("shared secret = %x, want %x", secret, want)
+				}
+			}
+		})
+	}
+}
+
+func hexDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestX25519Vectors(t *testing.T) {
+	// Test vectors from RFC 7748, Section 6.1.
+	alicePriv := hexDecode(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	alicePub := hexDecode(t, "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	bobPriv := hexDecode(t, "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb")
+	bobPub := hexDecode(t, "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")
+	shared := hexDecode(t, "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742")
+
+	alice, err := ecdh.X25519().NewPrivateKey(alicePriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := alice.PublicKey().Bytes(); !bytes.Equal(got, alicePub) {
+		t.Errorf("Alice's public key = %x, want %x", got, alicePub)
+	}
+	bob, err := ecdh.X25519().NewPrivateKey(bobPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bob.PublicKey().Bytes(); !bytes.Equal(got, bobPub) {
+		t.Errorf("Bob's public key = %x, want %x", got, bobPub)
+	}
+	secret, err := alice.ECDH(bob.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, shared) {
+		t.Errorf("shared secret = %x, want %x", secret, shared)
+	}
+}
+
+func TestInvalidPrivateKeys(t *testing.T) {
+	orders := map[ecdh.Curve]*big.Int{
+		ecdh.P256(): elliptic.P256().Params().N,
+		ecdh.P384(): elliptic.P384().Params().N,
+		ecdh.P521(): elliptic.P521().Params().N,
+	}
+	for curve, n := range orders {
+		size := (n.BitLen() + 7) / 8
+		for _, key := range [][]byte{
+			nil,
+			make([]byte, size-1),
+			make([]byte, size+1),
+			make([]byte, size),
+			n.FillBytes(make([]byte, size)),
+			new(big.Int).Add(n, big.NewInt(1)).FillBytes(make([]byte, size)),
+			bytes.Repeat([]byte{0xff}, size),
+		} {
+			if _, err := curve.NewPrivateKey(key); err == nil {
+				t.Errorf("%v: NewPrivateKey(%x) succeeded", curve, key)
+			}
+		}
+		max := new(big.Int).Sub(n, big.NewInt(1)).FillBytes(make([]byte, size))
+		if _, err := curve.NewPrivateKey(max); err != nil {
+			t.Errorf("%v: NewPrivateKey(N-1) failed: %v", curve, err)
+		}
+	}
+	for _, key := range [][]byte{nil, make([]byte, 31), make([]byte, 33)} {
+		if _, err := ecdh.X25519().NewPrivateKey(key); err == nil {
+			t.Errorf("X25519: NewPrivateKey(%x) succeeded", key)
+		}
+	}
+}
+
+func TestInvalidPublicKeys(t *testing.T) {
+	for _, tt := range []struct {
+		curve ecdh.Curve
+		ref   elliptic.Curve
+	}{
+		{ecdh.P256(), elliptic.P256()},
+		{ecdh.P384(), elliptic.P384()},
+		{ecdh.P521(), elliptic.P521()},
+	} {
+		params := tt.ref.Params()
+		g := elliptic.Marshal(tt.ref, params.Gx, params.Gy)
+		offCurve := append([]byte{}, g...)
+		offCurve[len(offCurve)-1] ^= 1
+		for _, key := range [][]byte{
+			nil,
+			{0},
+			g[:len(g)-1],
+			append(g, 0),
+			offCurve,
+			elliptic.MarshalCompressed(tt.ref, params.Gx, params.Gy),
+		} {
+			if _, err := tt.curve.NewPublicKey(key); err == nil {
+				t.Errorf("%s: NewPublicKey(%x) succeeded", params.Name, key)
+			}
+		}
+	}
+
+	for _, key := range [][]byte{nil, make([]byte, 31), make([]byte, 33)} {
+		if _, err := ecdh.X25519().NewPublicKey(key); err == nil {
+			t.Errorf("X25519: NewPublicKey(%x) succeeded", key)
+		}
+	}
+
+	// A low order point is a valid encoding, but ECDH with it must fail.
+	lowOrder, err := ecdh.X25519().NewPublicKey(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := priv.ECDH(lowOrder); err == nil {
+		t.Error("X25519: ECDH with a low order point succeeded")
+	}
+}
+
+func TestMismatchedCurves(t *testing.T) {
+	for _, a := range curves {
+		for _, b := range curves {
+			if a == b {
+				continue
+			}
+			priv, err := a.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peer, err := b.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := priv.ECDH(peer.PublicKey()); err == nil {
+				t.Errorf("ECDH between %v and %v succeeded", a, b)
+			}
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(dst []byte) (int, error) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	return len(dst), nil
+}
+
+func TestGenerateKeyZeroReader(t *testing.T) {
+	for _, curve := range curves {
+		if _, err := curve.GenerateKey(zeroReader{}); err != nil {
+			t.Errorf("%v: %v", curve, err)
+		}
+	}
+	for _, curve := range curves {
+		if _, err := curve.GenerateKey(io.LimitReader(zeroReader{}, 0)); err == nil {
+			t.Errorf("%v: GenerateKey with an empty reader succeeded", curve)
+		}
+	}
+}
+
+func TestECDSAConversion(t *testing.T) {
+	for _, tt := range []struct {
+		curve ecdh.Curve
+		ref   elliptic.Curve
+	}{
+		{ecdh.P256(), elliptic.P256()},
+		{ecdh.P384(), elliptic.P384()},
+		{ecdh.P521(), elliptic.P521()},
+	} {
+		k, err := ecdsa.GenerateKey(tt.ref, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, err := k.ECDH()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := k.PublicKey.ECDH()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if priv.Curve() != tt.curve || pub.Curve() != tt.curve {
+			t.Errorf("%s: converted keys have the wrong curve", tt.ref.Params().Name)
+		}
+		if !priv.PublicKey().Equal(pub) {
+			t.Errorf("%s: converted public key does not match the private key", tt.ref.Params().Name)
+		}
+	}
+
+	k, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.ECDH(); err == nil {
+		t.Error("converting a P-224 key succeeded")
+	}
+}
+
+func BenchmarkECDH(b *testing.B) {
+	for _, curve := range curves {
+		b.Run(fmt.Sprint(curve), func(b *testing.B) {
+			priv, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				b.Fatal(err)
+			}
+			peer, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				b.Fatal(err)
+			}
+			peerPub := peer.PublicKey()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := priv.ECDH(peerPub); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
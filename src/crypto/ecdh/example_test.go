@@ -0,0 +1,48 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+)
+
+func Example() {
+	// Alice and Bob each generate a key pair and send each other the
+	// encoding of their public key.
+	alice, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	bob, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	alicePublic := alice.PublicKey().Bytes()
+	bobPublic := bob.PublicKey().Bytes()
+
+	// Each side decodes the peer's public key and computes the shared secret.
+	bobKey, err := ecdh.X25519().NewPublicKey(bobPublic)
+	if err != nil {
+		panic(err)
+	}
+	aliceSecret, err := alice.ECDH(bobKey)
+	if err != nil {
+		panic(err)
+	}
+	aliceKey, err := ecdh.X25519().NewPublicKey(alicePublic)
+	if err != nil {
+		panic(err)
+	}
+	bobSecret, err := bob.ECDH(aliceKey)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(bytes.Equal(aliceSecret, bobSecret))
+	// Output: true
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hkdf
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 5869, Appendix A.
+var hkdfTests = []struct {
+	hash func() hash.Hash
+	ikm  string
+	salt string
+	info string
+	prk  string
+	okm  string
+}{
+	{
+		sha256.New,
+		"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+		"000102030405060708090a0b0c",
+		"f0f1f2f3f4f5f6f7f8f9",
+		"077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5",
+		"3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+	},
+	{
+		sha256.New,
+		"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+		"",
+		"",
+		"19ef24a32c717b167f33a91d6f648bdf96596776afdb6377ac434c1c293ccb04",
+		"8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+	},
+	{
+		sha1.New,
+		"0b0b0b0b0b0b0b0b0b0b0b",
+		"000102030405060708090a0b0c",
+		"f0f1f2f3f4f5f6f7f8f9",
+		"9b6c18c432a7bf8f0e71c8eb88f4b30baa2ba243",
+		"085a01ea1b10f36933068b56efa5ad81a4f14b822f5b091568a9cdd4f155fda2c22e422478d305f3f896",
+	},
+}
+
+func TestHKDF(t *testing.T) {
+	for i, tt := range hkdfTests {
+		ikm, salt, info := fromHex(tt.ikm), fromHex(tt.salt), fromHex(tt.info)
+		if len(salt) == 0 {
+			salt = nil
+		}
+
+		prk := Extract(tt.hash, ikm, salt)
+		if want := fromHex(tt.prk); !bytes.Equal(prk, want) {
+			t.Errorf("%d: Extract = %x, want %x", i, prk, want)
+		}
+
+		want := fromHex(tt.okm)
+		out := make([]byte, len(want))
+		if _, err := io.ReadFull(Expand(tt.hash, prk, info), out); err != nil {
+			t.Errorf("%d: Expand failed: %v", i, err)
+		} else if !bytes.Equal(out, want) {
+			t.Errorf("%d: Expand = %x, want %x", i, out, want)
+		}
+
+		// Reading in small chunks must produce the same output.
+		r := New(tt.hash, ikm, salt, info)
+		out = out[:0]
+		for len(out) < len(want) {
+			n := 7
+			if len(want)-len(out) < n {
+				n = len(want) - len(out)
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				t.Fatalf("%d: New failed: %v", i, err)
+			}
+			out = append(out, chunk...)
+		}
+		if !bytes.Equal(out, want) {
+			t.Errorf("%d: New = %x, want %x", i, out, want)
+		}
+	}
+}
+
+func TestHKDFLimit(t *testing.T) {
+	hash := sha1.New
+	r := New(hash, []byte("secret"), nil, nil)
+
+	// The maximum output length is 255 blocks of the hash output.
+	limit := 255 * hash().Size()
+	if _, err := io.ReadFull(r, make([]byte, limit)); err != nil {
+		t.Fatalf("failed to read %d bytes: %v", limit, err)
+	}
+	if n, err := r.Read(make([]byte, 1)); err == nil || n != 0 {
+		t.Errorf("reading past the limit returned %d, %v; want an error", n, err)
+	}
+}
+
+func BenchmarkHKDFSHA256(b *testing.B) {
+	secret := make([]byte, 32)
+	out := make([]byte, 32)
+	b.SetBytes(int64(len(out)))
+	for i := 0; i < b.N; i++ {
+		io.ReadFull(New(sha256.New, secret, nil, nil), out)
+	}
+}
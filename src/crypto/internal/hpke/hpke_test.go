@@ -0,0 +1,148 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpke
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, in string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestRFC9180Vector checks the first encryption of the base mode test vector
+// for DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM from RFC 9180,
+// Appendix A.1.1.
+func TestRFC9180Vector(t *testing.T) {
+	info := mustDecodeHex(t, "4f6465206f6e2061204772656369616e2055726e")
+	skEm := mustDecodeHex(t, "52c4a758a802cd8b936eceea314432798d5baf2d7e9235dc084ab1b9cfa2f736")
+	skRm := mustDecodeHex(t, "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8")
+	wantEnc := mustDecodeHex(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431")
+	wantSharedSecret := mustDecodeHex(t, "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc")
+	wantKey := mustDecodeHex(t, "4531685d41d65f03dc48f6b8302c05b0")
+	wantBaseNonce := mustDecodeHex(t, "56d890e5accaaf011cff4b7d")
+	wantExporterSecret := mustDecodeHex(t, "45ff1c2e220db587171952c0592d5f5ebe103f1561a2614e38f2ffd47e99e3f8")
+	aad := mustDecodeHex(t, "436f756e742d30")
+	pt := mustDecodeHex(t, "4265617574792069732074727574682c20747275746820626561757479")
+	wantCT := mustDecodeHex(t, "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a")
+
+	privR, err := ParseHPKEPrivateKey(DHKEM_X25519_HKDF_SHA256, skRm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubR, err := ParseHPKEPublicKey(DHKEM_X25519_HKDF_SHA256, privR.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testingOnlyGenerateKey = func() (*ecdh.PrivateKey, error) {
+		return ecdh.X25519().NewPrivateKey(skEm)
+	}
+	defer func() { testingOnlyGenerateKey = nil }()
+
+	enc, sender, err := SetupSender(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, AEAD_AES_128_GCM, pubR, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, wantEnc) {
+		t.Errorf("enc = %x, want %x", enc, wantEnc)
+	}
+	if !bytes.Equal(sender.sharedSecret, wantSharedSecret) {
+		t.Errorf("shared secret = %x, want %x", sender.sharedSecret, wantSharedSecret)
+	}
+	if !bytes.Equal(sender.key, wantKey) {
+		t.Errorf("key = %x, want %x", sender.key, wantKey)
+	}
+	if !bytes.Equal(sender.baseNonce, wantBaseNonce) {
+		t.Errorf("base nonce = %x, want %x", sender.baseNonce, wantBaseNonce)
+	}
+	if !bytes.Equal(sender.exporterSecret, wantExporterSecret) {
+		t.Errorf("exporter secret = %x, want %x", sender.exporterSecret, wantExporterSecret)
+	}
+
+	ct, err := sender.Seal(aad, pt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ct, wantCT) {
+		t.Errorf("ciphertext = %x, want %x", ct, wantCT)
+	}
+
+	recipient, err := SetupRecipient(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, AEAD_AES_128_GCM, privR, info, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := recipient.Open(aad, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pt) {
+		t.Errorf("plaintext = %x, want %x", got, pt)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for aeadID := range SupportedAEADs {
+		info := []byte("info")
+		enc, sender, err := SetupSender(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, aeadID, priv.PublicKey(), info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipient, err := SetupRecipient(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, aeadID, priv, info, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			msg := []byte{byte(i), 1, 2, 3}
+			ct, err := sender.Seal([]byte("aad"), msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := recipient.Open([]byte("bad aad"), ct); err == nil {
+				t.Errorf("AEAD %d: Open with the wrong aad succeeded", aeadID)
+			}
+			pt, err := recipient.Open([]byte("aad"), ct)
+			if err != nil {
+				t.Fatalf("AEAD %d: message %d: %v", aeadID, i, err)
+			}
+			if !bytes.Equal(pt, msg) {
+				t.Errorf("AEAD %d: message %d = %x, want %x", aeadID, i, pt, msg)
+			}
+		}
+
+		// A recipient with a different info derives different keys.
+		other, err := SetupRecipient(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, aeadID, priv, []byte("other"), enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, _ := sender.Seal(nil, []byte("hello"))
+		if _, err := other.Open(nil, ct); err == nil {
+			t.Errorf("AEAD %d: Open with the wrong info succeeded", aeadID)
+		}
+	}
+
+	if _, _, err := SetupSender(0x0010, KDF_HKDF_SHA256, AEAD_AES_128_GCM, priv.PublicKey(), nil); err == nil {
+		t.Error("SetupSender with an unsupported KEM succeeded")
+	}
+	if _, _, err := SetupSender(DHKEM_X25519_HKDF_SHA256, 0x0002, AEAD_AES_128_GCM, priv.PublicKey(), nil); err == nil {
+		t.Error("SetupSender with an unsupported KDF succeeded")
+	}
+	if _, _, err := SetupSender(DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, 0xffff, priv.PublicKey(), nil); err == nil {
+		t.Error("SetupSender with an unsupported AEAD succeeded")
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nistec
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// maxLimbs is the number of 64-bit limbs needed for the largest field,
+// GF(2^521 - 1).
+const maxLimbs = 9
+
+// A fieldElement is an element of a prime field in the Montgomery domain,
+// stored as little-endian 64-bit limbs. Only the first field.limbs limbs are
+// used; the rest are always zero.
+//
+// All operations on fieldElements run in time that depends only on the
+// field, and never on the values being operated on.
+type fieldElement [maxLimbs]uint64
+
+// A field holds the constants for arithmetic modulo an odd prime p, using
+// Montgomery multiplication with R = 2^(64*limbs).
+type field struct {
+	limbs int          // number of 64-bit limbs of p
+	size  int          // length in bytes of the big-endian encoding
+	p     fieldElement // the modulus
+	pInv  uint64       // -p⁻¹ mod 2^64
+	one   fieldElement // R mod p, the Montgomery form of one
+	rr    fieldElement // R² mod p
+	exp   fieldElement // p - 2, the exponent used by invert
+}
+
+// newField returns a field for the prime given in hexadecimal, which is
+// encoded in size bytes.
+func newField(hexP string, size int) *field {
+	f := &field{size: size}
+	f.p = mustParseHex(hexP)
+	f.limbs = (size + 7) / 8
+
+	// Newton's method doubles the number of correct low bits of the inverse
+	// at each step, starting from the three bits that any odd p⁻¹ = p
+	// provides modulo 8.
+	inv := f.p[0]
+	for i := 0; i < 5; i++ {
+		inv *= 2 - f.p[0]*inv
+	}
+	f.pInv = -inv
+
+	// Compute R mod p and then R² mod p by repeated modular doubling. add
+	// does not depend on the Montgomery representation.
+	f.one[0] = 1
+	for i := 0; i < 64*f.limbs; i++ {
+		f.add(&f.one, &f.one, &f.one)
+	}
+	f.rr = f.one
+	for i := 0; i < 64*f.limbs; i++ {
+		f.add(&f.rr, &f.rr, &f.rr)
+	}
+
+	f.exp = f.p
+	var b uint64
+	f.exp[0], b = bits.Sub64(f.exp[0], 2, 0)
+	for i := 1; i < f.limbs; i++ {
+		f.exp[i], b = bits.Sub64(f.exp[i], 0, b)
+	}
+	return f
+}
+
+// mustParseHex parses a big-endian hexadecimal constant.
+func mustParseHex(s string) fieldElement {
+	var e fieldElement
+	if len(s) > 16*maxLimbs {
+		panic("nistec: constant too large")
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[len(s)-1-i]
+		var v uint64
+		switch {
+		case '0' <= c && c <= '9':
+			v = uint64(c - '0')
+		case 'a' <= c && c <= 'f':
+			v = uint64(c - 'a' + 10)
+		default:
+			panic("nistec: invalid hex constant")
+		}
+		e[i/16] |= v << (4 * uint(i%16))
+	}
+	return e
+}
+
+// constant returns the Montgomery form of a constant given in
+// hexadecimal.
+func (f *field) constant(hex string) fieldElement {
+	x := mustParseHex(hex)
+	f.mul(&x, &x, &f.rr)
+	return x
+}
+
+// add sets z = x + y mod p.
+func (f *field) add(z, x, y *fieldElement) {
+	var sum, diff fieldElement
+	var carry, b uint64
+	for i := 0; i < f.limbs; i++ {
+		sum[i], carry = bits.Add64(x[i], y[i], carry)
+	}
+	for i := 0; i < f.limbs; i++ {
+		diff[i], b = bits.Sub64(sum[i], f.p[i], b)
+	}
+	// If sum - p borrowed past the carry bit, sum was already reduced.
+	_, b = bits.Sub64(carry, 0, b)
+	f.selectLimbs(z, &sum, &diff, b)
+}
+
+// sub sets z = x - y mod p.
+func (f *field) sub(z, x, y *fieldElement) {
+	var diff fieldElement
+	var b, carry uint64
+	for i := 0; i < f.limbs; i++ {
+		diff[i], b = bits.Sub64(x[i], y[i], b)
+	}
+	mask := -b
+	for i := 0; i < f.limbs; i++ {
+		diff[i], carry = bits.Add64(diff[i], f.p[i]&mask, carry)
+	}
+	*z = diff
+}
+
+// mul sets z = x * y * R⁻¹ mod p, using the coarsely integrated operand
+// scanning method.
+func (f *field) mul(z, x, y *fieldElement) {
+	n := f.limbs
+	var t [maxLimbs + 2]uint64
+	for i := 0; i < n; i++ {
+		var c, cc uint64
+		for j := 0; j < n; j++ {
+			hi, lo := bits.Mul64(x[j], y[i])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t[n], cc = bits.Add64(t[n], c, 0)
+		t[n+1] = cc
+
+		m := t[0] * f.pInv
+		hi, lo := bits.Mul64(m, f.p[0])
+		_, cc = bits.Add64(lo, t[0], 0)
+		c = hi + cc
+		for j := 1; j < n; j++ {
+			hi, lo := bits.Mul64(m, f.p[j])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[n-1], cc = bits.Add64(t[n], c, 0)
+		t[n] = t[n+1] + cc
+	}
+
+	// The result is less than 2p, so at most one subtraction is needed.
+	var res, diff fieldElement
+	var b uint64
+	copy(res[:n], t[:n])
+	for i := 0; i < n; i++ {
+		diff[i], b = bits.Sub64(res[i], f.p[i], b)
+	}
+	_, b = bits.Sub64(t[n], 0, b)
+	f.selectLimbs(z, &res, &diff, b)
+}
+
+// square sets z = x * x * R⁻¹ mod p.
+func (f *field) square(z, x *fieldElement) {
+	f.mul(z, x, x)
+}
+
+// invert sets z = 1 / x mod p, computed as x^(p-2) by Fermat's little
+// theorem. If x is zero, z is set to zero.
+func (f *field) invert(z, x *fieldElement) {
+	// The exponent is public, so square-and-multiply over its bits does not
+	// leak anything about x.
+	r := f.one
+	for i := 64*f.limbs - 1; i >= 0; i-- {
+		f.square(&r, &r)
+		if f.exp[i/64]>>(uint(i)%64)&1 == 1 {
+			f.mul(&r, &r, x)
+		}
+	}
+	*z = r
+}
+
+// selectLimbs sets z to a if cond is 1, and to b if cond is 0.
+func (f *field) selectLimbs(z, a, b *fieldElement, cond uint64) {
+	mask := -cond
+	for i := 0; i < f.limbs; i++ {
+		z[i] = a[i]&mask | b[i]&^mask
+	}
+}
+
+// isZero returns 1 if x is zero and 0 otherwise.
+func (f *field) isZero(x *fieldElement) uint64 {
+	var acc uint64
+	for i := 0; i < f.limbs; i++ {
+		acc |= x[i]
+	}
+	return 1 ^ (acc|-acc)>>63
+}
+
+// equal returns 1 if x and y are equal and 0 otherwise.
+func (f *field) equal(x, y *fieldElement) uint64 {
+	var acc uint64
+	for i := 0; i < f.limbs; i++ {
+		acc |= x[i] ^ y[i]
+	}
+	return 1 ^ (acc|-acc)>>63
+}
+
+var errInvalidFieldElement = errors.New("nistec: invalid field element encoding")
+
+// setBytes sets z to the Montgomery form of the big-endian value b, which
+// must be exactly f.size bytes long and less than p.
+func (f *field) setBytes(z *fieldElement, b []byte) error {
+	if len(b) != f.size {
+		return errInvalidFieldElement
+	}
+	var x fieldElement
+	for i, v := range b {
+		j := len(b) - 1 - i
+		x[j/8] |= uint64(v) << (8 * uint(j%8))
+	}
+	var diff fieldElement
+	var borrow uint64
+	for i := 0; i < f.limbs; i++ {
+		diff[i], borrow = bits.Sub64(x[i], f.p[i], borrow)
+	}
+	if borrow == 0 {
+		return errInvalidFieldElement
+	}
+	f.mul(z, &x, &f.rr)
+	return nil
+}
+
+// bytes returns the big-endian encoding of x, out of the Montgomery domain.
+func (f *field) bytes(x *fieldElement) []byte {
+	var v fieldElement
+	one := fieldElement{1}
+	f.mul(&v, x, &one)
+	out := make([]byte, f.size)
+	for i := range out {
+		j := len(out) - 1 - i
+		out[i] = byte(v[j/8] >> (8 * uint(j%8)))
+	}
+	return out
+}
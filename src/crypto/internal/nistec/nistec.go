@@ -0,0 +1,380 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nistec implements the NIST P-256, P-384 and P-521 elliptic curves
+// with constant-time field and group operations.
+//
+// Points are kept in projective coordinates and combined with the complete
+// addition formulas of Renes, Costello and Batina (https://eprint.iacr.org/2015/1060),
+// so that the identity and doubling cases need no branches.
+package nistec
+
+import (
+	"errors"
+	"sync"
+)
+
+// A Curve is a short Weierstrass curve y² = x³ - 3x + b over a prime field.
+type Curve struct {
+	name       string
+	f          *field
+	b          fieldElement
+	gx, gy     fieldElement
+	scalarSize int
+}
+
+var (
+	initOnce         sync.Once
+	p256, p384, p521 Curve
+)
+
+func initAll() {
+	p256.name = "P-256"
+	p256.f = newField("ffffffff00000001000000000000000000000000ffffffffffffffffffffffff", 32)
+	p256.b = p256.f.constant("5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604b")
+	p256.gx = p256.f.constant("6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296")
+	p256.gy = p256.f.constant("4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5")
+	p256.scalarSize = 32
+
+	p384.name = "P-384"
+	p384.f = newField("fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"+
+		"ffffffff0000000000000000ffffffff", 48)
+	p384.b = p384.f.constant("b3312fa7e23ee7e4988e056be3f82d19181d9c6efe8141120314088f5013875a" +
+		"c656398d8a2ed19d2a85c8edd3ec2aef")
+	p384.gx = p384.f.constant("aa87ca22be8b05378eb1c71ef320ad746e1d3b628ba79b9859f741e082542a38" +
+		"5502f25dbf55296c3a545e3872760ab7")
+	p384.gy = p384.f.constant("3617de4a96262c6f5d9e98bf9292dc29f8f41dbd289a147ce9da3113b5f0b8c0" +
+		"0a60b1ce1d7e819d7a431d7c90ea0e5f")
+	p384.scalarSize = 48
+
+	p521.name = "P-521"
+	p521.f = newField("1ff"+
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"+
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 66)
+	p521.b = p521.f.constant("051" +
+		"953eb9618e1c9a1f929a21a0b68540eea2da725b99b315f3b8b489918ef109e1" +
+		"56193951ec7e937b1652c0bd3bb1bf073573df883d2c34f1ef451fd46b503f00")
+	p521.gx = p521.f.constant("0c6" +
+		"858e06b70404e9cd9e3ecb662395b4429c648139053fb521f828af606b4d3dba" +
+		"a14b5e77efe75928fe1dc127a2ffa8de3348b3c1856a429bf97e7e31c2e5bd66")
+	p521.gy = p521.f.constant("118" +
+		"39296a789a3bc0045c8a5fb42c7d1bd998f54449579b446817afbd17273e662c" +
+		"97ee72995ef42640c550b9013fad0761353c7086a272c24088be94769fd16650")
+	p521.scalarSize = 66
+}
+
+// P256 returns a Curve which implements NIST P-256 (FIPS 186-3, section D.2.3).
+func P256() *Curve {
+	initOnce.Do(initAll)
+	return &p256
+}
+
+// P384 returns a Curve which implements NIST P-384 (FIPS 186-3, section D.2.4).
+func P384() *Curve {
+	initOnce.Do(initAll)
+	return &p384
+}
+
+// P521 returns a Curve which implements NIST P-521 (FIPS 186-3, section D.2.5).
+func P521() *Curve {
+	initOnce.Do(initAll)
+	return &p521
+}
+
+// String returns the name of the curve, such as "P-256".
+func (c *Curve) String() string {
+	return c.name
+}
+
+// ScalarSize returns the length in bytes of the scalars accepted by
+// Point.ScalarMult and Point.ScalarBaseMult.
+func (c *Curve) ScalarSize() int {
+	return c.scalarSize
+}
+
+// PointSize returns the length in bytes of the uncompressed encoding of a
+// point other than the identity.
+func (c *Curve) PointSize() int {
+	return 1 + 2*c.f.size
+}
+
+// A Point is a point on a Curve. The zero value is not valid; use
+// Curve.NewPoint or Curve.NewGenerator.
+type Point struct {
+	c *Curve
+	// The point is represented in projective coordinates (X:Y:Z),
+	// where x = X/Z and y = Y/Z.
+	x, y, z fieldElement
+}
+
+// NewPoint returns a new Point representing the point at infinity.
+func (c *Curve) NewPoint() *Point {
+	return &Point{c: c, y: c.f.one}
+}
+
+// NewGenerator returns a new Point set to the canonical generator.
+func (c *Curve) NewGenerator() *Point {
+	return &Point{c: c, x: c.gx, y: c.gy, z: c.f.one}
+}
+
+// Set sets p = q and returns p.
+func (p *Point) Set(q *Point) *Point {
+	p.c, p.x, p.y, p.z = q.c, q.x, q.y, q.z
+	return p
+}
+
+var errInvalidPoint = errors.New("nistec: invalid point encoding")
+
+// SetBytes sets p to the uncompressed or infinity value encoded in b, as
+// specified in SEC 1, Version 2.0, Section 2.3.4. Compressed encodings are
+// not supported. If the point is not on the curve, it returns nil and an
+// error, and the receiver is unchanged. Otherwise, it returns p.
+func (p *Point) SetBytes(b []byte) (*Point, error) {
+	f := p.c.f
+	switch {
+	case len(b) == 1 && b[0] == 0:
+		return p.Set(p.c.NewPoint()), nil
+	case len(b) == 1+2*f.size && b[0] == 4:
+		var x, y fieldElement
+		if err := f.setBytes(&x, b[1:1+f.size]); err != nil {
+			return nil, errInvalidPoint
+		}
+		if err := f.setBytes(&y, b[1+f.size:]); err != nil {
+			return nil, errInvalidPoint
+		}
+		if !p.c.isOnCurve(&x, &y) {
+			return nil, errors.New("nistec: invalid point")
+		}
+		p.x, p.y, p.z = x, y, f.one
+		return p, nil
+	default:
+		return nil, errInvalidPoint
+	}
+}
+
+// isOnCurve reports whether y² = x³ - 3x + b. The coordinates of a point
+// being decoded are public, so this is allowed to return early.
+func (c *Curve) isOnCurve(x, y *fieldElement) bool {
+	f := c.f
+	var rhs, t fieldElement
+	f.square(&rhs, x)
+	f.mul(&rhs, &rhs, x)
+	f.add(&t, x, x)
+	f.add(&t, &t, x)
+	f.sub(&rhs, &rhs, &t)
+	f.add(&rhs, &rhs, &c.b)
+	f.square(&t, y)
+	return f.equal(&rhs, &t) == 1
+}
+
+// affine returns the affine coordinates of p, and 0 if p is the point at
+// infinity, or 1 otherwise.
+func (p *Point) affine() (x, y fieldElement, ok uint64) {
+	f := p.c.f
+	var zinv fieldElement
+	f.invert(&zinv, &p.z)
+	f.mul(&x, &p.x, &zinv)
+	f.mul(&y, &p.y, &zinv)
+	return x, y, 1 ^ f.isZero(&p.z)
+}
+
+// Bytes returns the uncompressed or infinity encoding of p, as specified in
+// SEC 1, Version 2.0, Section 2.3.3. Note that the encoding of the point at
+// infinity is shorter than all other encodings.
+func (p *Point) Bytes() []byte {
+	x, y, ok := p.affine()
+	if ok == 0 {
+		return []byte{0}
+	}
+	f := p.c.f
+	out := make([]byte, 0, 1+2*f.size)
+	out = append(out, 4)
+	out = append(out, f.bytes(&x)...)
+	out = append(out, f.bytes(&y)...)
+	return out
+}
+
+// BytesX returns the encoding of the x-coordinate of p, as specified in SEC 1,
+// Version 2.0, Section 2.3.5, or an error if p is the point at infinity.
+func (p *Point) BytesX() ([]byte, error) {
+	x, _, ok := p.affine()
+	if ok == 0 {
+		return nil, errors.New("nistec: point is the point at infinity")
+	}
+	return p.c.f.bytes(&x), nil
+}
+
+// Add sets q = p1 + p2, and returns q. The points may overlap.
+func (q *Point) Add(p1, p2 *Point) *Point {
+	// Complete addition formula for a = -3 from "Complete addition formulas
+	// for prime order elliptic curves" (https://eprint.iacr.org/2015/1060),
+	// Algorithm 4.
+	c := p1.c
+	f := c.f
+	var t0, t1, t2, t3, t4, x3, y3, z3 fieldElement
+
+	f.mul(&t0, &p1.x, &p2.x) // t0 := X1 * X2
+	f.mul(&t1, &p1.y, &p2.y) // t1 := Y1 * Y2
+	f.mul(&t2, &p1.z, &p2.z) // t2 := Z1 * Z2
+	f.add(&t3, &p1.x, &p1.y) // t3 := X1 + Y1
+	f.add(&t4, &p2.x, &p2.y) // t4 := X2 + Y2
+	f.mul(&t3, &t3, &t4)     // t3 := t3 * t4
+	f.add(&t4, &t0, &t1)     // t4 := t0 + t1
+	f.sub(&t3, &t3, &t4)     // t3 := t3 - t4
+	f.add(&t4, &p1.y, &p1.z) // t4 := Y1 + Z1
+	f.add(&x3, &p2.y, &p2.z) // X3 := Y2 + Z2
+	f.mul(&t4, &t4, &x3)     // t4 := t4 * X3
+	f.add(&x3, &t1, &t2)     // X3 := t1 + t2
+	f.sub(&t4, &t4, &x3)     // t4 := t4 - X3
+	f.add(&x3, &p1.x, &p1.z) // X3 := X1 + Z1
+	f.add(&y3, &p2.x, &p2.z) // Y3 := X2 + Z2
+	f.mul(&x3, &x3, &y3)     // X3 := X3 * Y3
+	f.add(&y3, &t0, &t2)     // Y3 := t0 + t2
+	f.sub(&y3, &x3, &y3)     // Y3 := X3 - Y3
+	f.mul(&z3, &c.b, &t2)    // Z3 := b * t2
+	f.sub(&x3, &y3, &z3)     // X3 := Y3 - Z3
+	f.add(&z3, &x3, &x3)     // Z3 := X3 + X3
+	f.add(&x3, &x3, &z3)     // X3 := X3 + Z3
+	f.sub(&z3, &t1, &x3)     // Z3 := t1 - X3
+	f.add(&x3, &t1, &x3)     // X3 := t1 + X3
+	f.mul(&y3, &c.b, &y3)    // Y3 := b * Y3
+	f.add(&t1, &t2, &t2)     // t1 := t2 + t2
+	f.add(&t2, &t1, &t2)     // t2 := t1 + t2
+	f.sub(&y3, &y3, &t2)     // Y3 := Y3 - t2
+	f.sub(&y3, &y3, &t0)     // Y3 := Y3 - t0
+	f.add(&t1, &y3, &y3)     // t1 := Y3 + Y3
+	f.add(&y3, &t1, &y3)     // Y3 := t1 + Y3
+	f.add(&t1, &t0, &t0)     // t1 := t0 + t0
+	f.add(&t0, &t1, &t0)     // t0 := t1 + t0
+	f.sub(&t0, &t0, &t2)     // t0 := t0 - t2
+	f.mul(&t1, &t4, &y3)     // t1 := t4 * Y3
+	f.mul(&t2, &t0, &y3)     // t2 := t0 * Y3
+	f.mul(&y3, &x3, &z3)     // Y3 := X3 * Z3
+	f.add(&y3, &y3, &t2)     // Y3 := Y3 + t2
+	f.mul(&x3, &t3, &x3)     // X3 := t3 * X3
+	f.sub(&x3, &x3, &t1)     // X3 := X3 - t1
+	f.mul(&z3, &t4, &z3)     // Z3 := t4 * Z3
+	f.mul(&t1, &t3, &t0)     // t1 := t3 * t0
+	f.add(&z3, &z3, &t1)     // Z3 := Z3 + t1
+
+	q.c, q.x, q.y, q.z = c, x3, y3, z3
+	return q
+}
+
+// Double sets q = p + p, and returns q. The points may overlap.
+func (q *Point) Double(p *Point) *Point {
+	// Complete doubling formula for a = -3 from "Complete addition formulas
+	// for prime order elliptic curves" (https://eprint.iacr.org/2015/1060),
+	// Algorithm 6.
+	c := p.c
+	f := c.f
+	var t0, t1, t2, t3, x3, y3, z3 fieldElement
+
+	f.square(&t0, &p.x)    // t0 := X ^ 2
+	f.square(&t1, &p.y)    // t1 := Y ^ 2
+	f.square(&t2, &p.z)    // t2 := Z ^ 2
+	f.mul(&t3, &p.x, &p.y) // t3 := X * Y
+	f.add(&t3, &t3, &t3)   // t3 := t3 + t3
+	f.mul(&z3, &p.x, &p.z) // Z3 := X * Z
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+	f.mul(&y3, &c.b, &t2)  // Y3 := b * t2
+	f.sub(&y3, &y3, &z3)   // Y3 := Y3 - Z3
+	f.add(&x3, &y3, &y3)   // X3 := Y3 + Y3
+	f.add(&y3, &x3, &y3)   // Y3 := X3 + Y3
+	f.sub(&x3, &t1, &y3)   // X3 := t1 - Y3
+	f.add(&y3, &t1, &y3)   // Y3 := t1 + Y3
+	f.mul(&y3, &x3, &y3)   // Y3 := X3 * Y3
+	f.mul(&x3, &x3, &t3)   // X3 := X3 * t3
+	f.add(&t3, &t2, &t2)   // t3 := t2 + t2
+	f.add(&t2, &t2, &t3)   // t2 := t2 + t3
+	f.mul(&z3, &c.b, &z3)  // Z3 := b * Z3
+	f.sub(&z3, &z3, &t2)   // Z3 := Z3 - t2
+	f.sub(&z3, &z3, &t0)   // Z3 := Z3 - t0
+	f.add(&t3, &z3, &z3)   // t3 := Z3 + Z3
+	f.add(&z3, &z3, &t3)   // Z3 := Z3 + t3
+	f.add(&t3, &t0, &t0)   // t3 := t0 + t0
+	f.add(&t0, &t3, &t0)   // t0 := t3 + t0
+	f.sub(&t0, &t0, &t2)   // t0 := t0 - t2
+	f.mul(&t0, &t0, &z3)   // t0 := t0 * Z3
+	f.add(&y3, &y3, &t0)   // Y3 := Y3 + t0
+	f.mul(&t0, &p.y, &p.z) // t0 := Y * Z
+	f.add(&t0, &t0, &t0)   // t0 := t0 + t0
+	f.mul(&z3, &t0, &z3)   // Z3 := t0 * Z3
+	f.sub(&x3, &x3, &z3)   // X3 := X3 - Z3
+	f.mul(&z3, &t0, &t1)   // Z3 := t0 * t1
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+	f.add(&z3, &z3, &z3)   // Z3 := Z3 + Z3
+
+	q.c, q.x, q.y, q.z = c, x3, y3, z3
+	return q
+}
+
+// selectPoint sets p to a if cond is 1, and to b if cond is 0.
+func (p *Point) selectPoint(a, b *Point, cond uint64) {
+	f := a.c.f
+	p.c = a.c
+	f.selectLimbs(&p.x, &a.x, &b.x, cond)
+	f.selectLimbs(&p.y, &a.y, &b.y, cond)
+	f.selectLimbs(&p.z, &a.z, &b.z, cond)
+}
+
+// A pointTable holds the first 15 multiples of a point, table[i] = (i+1)·q.
+type pointTable [15]Point
+
+// selectInto sets p to n·q in constant time, for n in [0, 15].
+func (table *pointTable) selectInto(p *Point, n uint8) {
+	c := table[0].c
+	p.c, p.x, p.y, p.z = c, fieldElement{}, c.f.one, fieldElement{}
+	for i := uint8(1); i < 16; i++ {
+		// cond is 1 if i == n, and 0 otherwise.
+		d := uint64(i ^ n)
+		cond := 1 ^ (d|-d)>>63
+		p.selectPoint(&table[i-1], p, cond)
+	}
+}
+
+// ScalarMult sets p = scalar * q, and returns p. The scalar is a big-endian
+// value of exactly Curve.ScalarSize bytes, and it does not need to be reduced
+// modulo the order of the group. The time taken depends only on the curve.
+func (p *Point) ScalarMult(q *Point, scalar []byte) (*Point, error) {
+	c := q.c
+	if len(scalar) != c.scalarSize {
+		return nil, errors.New("nistec: invalid scalar length")
+	}
+
+	var table pointTable
+	table[0].Set(q)
+	for i := 1; i < 15; i += 2 {
+		table[i].Double(&table[i/2])
+		table[i+1].Add(&table[i], q)
+	}
+
+	// Process the scalar in fixed 4-bit windows, from the most significant.
+	r := c.NewPoint()
+	t := c.NewPoint()
+	for i, b := range scalar {
+		if i != 0 {
+			r.Double(r)
+			r.Double(r)
+			r.Double(r)
+			r.Double(r)
+		}
+		table.selectInto(t, b>>4)
+		r.Add(r, t)
+		r.Double(r)
+		r.Double(r)
+		r.Double(r)
+		r.Double(r)
+		table.selectInto(t, b&0b1111)
+		r.Add(r, t)
+	}
+	return p.Set(r), nil
+}
+
+// ScalarBaseMult sets p = scalar * G, where G is the generator of the curve,
+// and returns p. See ScalarMult for the scalar format.
+func (p *Point) ScalarBaseMult(scalar []byte) (*Point, error) {
+	c := p.c
+	return p.ScalarMult(c.NewGenerator(), scalar)
+}
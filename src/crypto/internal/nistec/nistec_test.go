@@ -0,0 +1,183 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nistec_test
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/internal/nistec"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var curves = []struct {
+	c     *nistec.Curve
+	curve elliptic.Curve
+}{
+	{nistec.P256(), elliptic.P256()},
+	{nistec.P384(), elliptic.P384()},
+	{nistec.P521(), elliptic.P521()},
+}
+
+func TestGenerator(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			params := tt.curve.Params()
+			want := elliptic.Marshal(tt.curve, params.Gx, params.Gy)
+			if got := tt.c.NewGenerator().Bytes(); !bytes.Equal(got, want) {
+				t.Errorf("generator = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestScalarMult(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for _, tt := range curves {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			params := tt.curve.Params()
+			scalars := [][]byte{
+				make([]byte, tt.c.ScalarSize()),
+				new(big.Int).SetInt64(1).FillBytes(make([]byte, tt.c.ScalarSize())),
+				new(big.Int).Sub(params.N, big.NewInt(1)).FillBytes(make([]byte, tt.c.ScalarSize())),
+				params.N.FillBytes(make([]byte, tt.c.ScalarSize())),
+			}
+			for i := 0; i < 10; i++ {
+				s := make([]byte, tt.c.ScalarSize())
+				r.Read(s)
+				s[0] &= byte(0xff >> (8*len(s) - params.N.BitLen()))
+				scalars = append(scalars, s)
+			}
+
+			for _, s := range scalars {
+				x, y := tt.curve.ScalarBaseMult(s)
+				want := elliptic.Marshal(tt.curve, x, y)
+				if x.Sign() == 0 && y.Sign() == 0 {
+					want = []byte{0}
+				}
+				p, err := tt.c.NewPoint().ScalarBaseMult(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := p.Bytes(); !bytes.Equal(got, want) {
+					t.Errorf("ScalarBaseMult(%x) = %x, want %x", s, got, want)
+				}
+
+				q, err := tt.c.NewPoint().ScalarBaseMult(scalars[len(scalars)-1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				qx, qy := elliptic.Unmarshal(tt.curve, q.Bytes())
+				x, y = tt.curve.ScalarMult(qx, qy, s)
+				want = elliptic.Marshal(tt.curve, x, y)
+				if x.Sign() == 0 && y.Sign() == 0 {
+					want = []byte{0}
+				}
+				if _, err := q.ScalarMult(q, s); err != nil {
+					t.Fatal(err)
+				}
+				if got := q.Bytes(); !bytes.Equal(got, want) {
+					t.Errorf("ScalarMult(%x) = %x, want %x", s, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddDouble(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			g := tt.c.NewGenerator()
+			inf := tt.c.NewPoint()
+
+			p := tt.c.NewPoint().Add(g, inf)
+			if !bytes.Equal(p.Bytes(), g.Bytes()) {
+				t.Error("G + ∞ != G")
+			}
+			p.Add(inf, inf)
+			if !bytes.Equal(p.Bytes(), []byte{0}) {
+				t.Error("∞ + ∞ != ∞")
+			}
+			p.Double(inf)
+			if !bytes.Equal(p.Bytes(), []byte{0}) {
+				t.Error("2∞ != ∞")
+			}
+
+			d := tt.c.NewPoint().Double(g)
+			a := tt.c.NewPoint().Add(g, g)
+			if !bytes.Equal(d.Bytes(), a.Bytes()) {
+				t.Error("2G != G + G")
+			}
+
+			// -G has the same x-coordinate and the opposite y-coordinate.
+			params := tt.curve.Params()
+			negY := new(big.Int).Sub(params.P, params.Gy)
+			neg, err := tt.c.NewPoint().SetBytes(elliptic.Marshal(tt.curve, params.Gx, negY))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p.Add(g, neg).Bytes(), []byte{0}) {
+				t.Error("G + -G != ∞")
+			}
+			if _, err := p.BytesX(); err == nil {
+				t.Error("BytesX of ∞ did not fail")
+			}
+		})
+	}
+}
+
+func TestSetBytes(t *testing.T) {
+	for _, tt := range curves {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			g := tt.c.NewGenerator().Bytes()
+			if len(g) != tt.c.PointSize() {
+				t.Errorf("len(G) = %d, want %d", len(g), tt.c.PointSize())
+			}
+			if p, err := tt.c.NewPoint().SetBytes(g); err != nil || !bytes.Equal(p.Bytes(), g) {
+				t.Errorf("SetBytes(G) = %v, %v", p, err)
+			}
+			if p, err := tt.c.NewPoint().SetBytes([]byte{0}); err != nil || !bytes.Equal(p.Bytes(), []byte{0}) {
+				t.Errorf("SetBytes(∞) = %v, %v", p, err)
+			}
+
+			offCurve := append([]byte{}, g...)
+			offCurve[len(offCurve)-1] ^= 1
+			params := tt.curve.Params()
+			notReduced := append([]byte{}, g...)
+			params.P.FillBytes(notReduced[1 : 1+(params.BitSize+7)/8])
+			compressed := append([]byte{2 | g[len(g)-1]&1}, g[1:1+(params.BitSize+7)/8]...)
+
+			for _, b := range [][]byte{
+				nil,
+				{4},
+				g[:len(g)-1],
+				append(g, 0),
+				offCurve,
+				notReduced,
+				compressed,
+			} {
+				if _, err := tt.c.NewPoint().SetBytes(b); err == nil {
+					t.Errorf("SetBytes(%x) succeeded", b)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScalarMult(b *testing.B) {
+	for _, tt := range curves {
+		b.Run(tt.c.String(), func(b *testing.B) {
+			scalar := make([]byte, tt.c.ScalarSize())
+			rand.Read(scalar[1:])
+			p := tt.c.NewGenerator()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.ScalarMult(p, scalar)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 7914, Section 12.
+var good = []struct {
+	password string
+	salt     string
+	N, r, p  int
+	output   string
+}{
+	{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+	{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+}
+
+var bad = []struct {
+	N, r, p int
+}{
+	{0, 1, 1},              // N == 0
+	{1, 1, 1},              // N == 1
+	{7, 8, 1},              // N is not power of 2
+	{16, 0, 1},             // r == 0
+	{16, 1, 0},             // p == 0
+	{16, 1 << 15, 1 << 15}, // r * p too large
+}
+
+func TestKey(t *testing.T) {
+	for i, v := range good {
+		if testing.Short() && v.N > 1024 {
+			continue
+		}
+		want, _ := hex.DecodeString(v.output)
+		got, err := Key([]byte(v.password), []byte(v.salt), v.N, v.r, v.p, len(want))
+		if err != nil {
+			t.Errorf("%d: got unexpected error: %s", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: got %x, want %x", i, got, want)
+		}
+	}
+	for i, v := range bad {
+		if _, err := Key([]byte("password"), []byte("salt"), v.N, v.r, v.p, 32); err == nil {
+			t.Errorf("%d: expected error, got nil", i)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sha3 implements the SHA-3 fixed-output-length hash functions and
+// the SHAKE extendable-output functions defined in FIPS 202, as needed by
+// ML-KEM.
+package sha3
+
+import "encoding/binary"
+
+// spongeDirection indicates the direction bytes are flowing through the
+// sponge.
+type spongeDirection int
+
+const (
+	// spongeAbsorbing indicates that the sponge is absorbing input.
+	spongeAbsorbing spongeDirection = iota
+	// spongeSqueezing indicates that the sponge is being squeezed.
+	spongeSqueezing
+)
+
+// sponge is the Keccak sponge construction, with a byte-oriented interface.
+type sponge struct {
+	a [25]uint64 // main state of the hash
+
+	// n is the number of bytes of the current block that have been absorbed
+	// or squeezed, and rate is the size of a block.
+	n, rate int
+
+	// dsbyte contains the domain separation bits and the first bit of the
+	// padding. See FIPS 202, Appendix B.2.
+	dsbyte byte
+
+	state spongeDirection
+}
+
+func (s *sponge) reset() {
+	s.a = [25]uint64{}
+	s.n = 0
+	s.state = spongeAbsorbing
+}
+
+func (s *sponge) xorByte(i int, b byte) {
+	s.a[i/8] ^= uint64(b) << (8 * (i % 8))
+}
+
+func (s *sponge) byteAt(i int) byte {
+	return byte(s.a[i/8] >> (8 * (i % 8)))
+}
+
+func (s *sponge) write(p []byte) {
+	if s.state != spongeAbsorbing {
+		panic("sha3: Write after Read")
+	}
+	for len(p) > 0 {
+		if s.n == 0 && len(p) >= s.rate {
+			// Fast path: absorb a full block.
+			for i := 0; i < s.rate/8; i++ {
+				s.a[i] ^= binary.LittleEndian.Uint64(p[8*i:])
+			}
+			keccakF1600(&s.a)
+			p = p[s.rate:]
+			continue
+		}
+		s.xorByte(s.n, p[0])
+		s.n++
+		p = p[1:]
+		if s.n == s.rate {
+			keccakF1600(&s.a)
+			s.n = 0
+		}
+	}
+}
+
+// padAndPermute appends the domain separation bits and the padding, and
+// switches the sponge to squeezing.
+func (s *sponge) padAndPermute() {
+	s.xorByte(s.n, s.dsbyte)
+	s.xorByte(s.rate-1, 0x80)
+	keccakF1600(&s.a)
+	s.n = 0
+	s.state = spongeSqueezing
+}
+
+func (s *sponge) read(out []byte) {
+	if s.state == spongeAbsorbing {
+		s.padAndPermute()
+	}
+	for i := range out {
+		if s.n == s.rate {
+			keccakF1600(&s.a)
+			s.n = 0
+		}
+		out[i] = s.byteAt(s.n)
+		s.n++
+	}
+}
+
+// Digest is a SHA-3 hash, which implements hash.Hash.
+type Digest struct {
+	s         sponge
+	outputLen int
+}
+
+// New256 returns a new Digest computing the SHA3-256 hash.
+func New256() *Digest {
+	return &Digest{s: sponge{rate: 136, dsbyte: 0x06}, outputLen: 32}
+}
+
+// New512 returns a new Digest computing the SHA3-512 hash.
+func New512() *Digest {
+	return &Digest{s: sponge{rate: 72, dsbyte: 0x06}, outputLen: 64}
+}
+
+// Sum256 returns the SHA3-256 hash of data.
+func Sum256(data []byte) [32]byte {
+	var out [32]byte
+	h := New256()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+// Sum512 returns the SHA3-512 hash of data.
+func Sum512(data []byte) [64]byte {
+	var out [64]byte
+	h := New512()
+	h.Write(data)
+	h.s.read(out[:])
+	return out
+}
+
+func (d *Digest) Size() int      { return d.outputLen }
+func (d *Digest) BlockSize() int { return d.s.rate }
+func (d *Digest) Reset()         { d.s.reset() }
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.s.write(p)
+	return len(p), nil
+}
+
+// Sum appends the current hash to b and returns the resulting slice. It does
+// not change the underlying hash state.
+func (d *Digest) Sum(b []byte) []byte {
+	dup := d.s
+	out := make([]byte, d.outputLen)
+	dup.read(out)
+	return append(b, out...)
+}
+
+// SHAKE is an instance of a SHAKE extendable-output function.
+type SHAKE struct {
+	s sponge
+}
+
+// NewShake128 returns a new SHAKE128 XOF.
+func NewShake128() *SHAKE {
+	return &SHAKE{s: sponge{rate: 168, dsbyte: 0x1f}}
+}
+
+// NewShake256 returns a new SHAKE256 XOF.
+func NewShake256() *SHAKE {
+	return &SHAKE{s: sponge{rate: 136, dsbyte: 0x1f}}
+}
+
+// Write absorbs more data into the XOF's state. It panics if called after
+// Read.
+func (s *SHAKE) Write(p []byte) (int, error) {
+	s.s.write(p)
+	return len(p), nil
+}
+
+// Read squeezes an arbitrary number of bytes from the XOF. It never fails.
+func (s *SHAKE) Read(out []byte) (int, error) {
+	s.s.read(out)
+	return len(out), nil
+}
+
+// Reset resets the XOF to its initial state.
+func (s *SHAKE) Reset() { s.s.reset() }
+
+// Clone returns a copy of the XOF in its current state.
+func (s *SHAKE) Clone() *SHAKE {
+	dup := *s
+	return &dup
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// The expected values were computed with an independent implementation. The
+// input of length n is the bytes i % 251, for i from 0 to n-1.
+var sha3Tests = []struct {
+	n                  int
+	sha3_256, sha3_512 string
+	shake128, shake256 string // first 32 bytes of output
+}{
+	{
+		0,
+		"a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a",
+		"a69f73cca23a9ac5c8b567dc185a756e97c982164fe25859e0d1dcc1475c80a615b2123af1f5f94c11e3e9402c3ac558f500199d95b6d3e301758586281dcd26",
+		"7f9c2ba4e88f827d616045507605853ed73b8093f6efbc88eb1a6eacfa66ef26",
+		"46b9dd2b0ba88d13233b3feb743eeb243fcd52ea62b81b82b50c27646ed5762f",
+	},
+	{
+		72,
+		"fe58866b2893c6c40ee832ce40fb6eb4c70ff7c4794380d95c2ebeec62decd31",
+		"5d63f2bbe971a983ac6847480106e4e1264ee3a0befd79954914e1d86e795b2e18238f12fc5e46cb9cc78efdec610a93647cc04e1c23d8caaa6a58c21dd26c07",
+		"29cbc126c6e6ba6a53c0b6d2a556fcd13eddb6ebfff551b2405c51b4f0aaa45c",
+		"2bb9aade91b40cfced14ad1fd7e26aa839b5140227fad20311d24db1578a8a55",
+	},
+	{
+		135,
+		"fded8fd9d6551c601eeb3b7c6bc5e5cfd8aad1d015b7e9aaa9c9b9475231d5e2",
+		"d942df0df09ac042cd3b641144c98d8fda0980bb037fc5c0e7f2e9a073b073dc4bb8a8c1f4cb5b45f5805c6523741ed0571d6779b15829b2faa280fc60b50645",
+		"d11fafa27f42a8162b8ae013535771de81722c0abc8aa2bca01825462e2f8971",
+		"c45dae624ad8a2f5aa7bac9d7557737fd91c96eedb70a6be5574d57a844eade0",
+	},
+	{
+		136,
+		"cf3ccff92480a29160c2d38317c430e14749bfee1788106957dfe73f8c4930e5",
+		"ad8edff4f1b7aa1c63bbe49728ab9b165f7245b3d7102e6f99c261fc15d2d0bf6afef6a491720454a1349fbf5d848854875ac83a1156fd7f6e2a37af26c07fb2",
+		"30bdfd69382cab028173fba7c6d53878ec18081358e52c955dc6f5d52b60b029",
+		"b7ff4073b3f5a8eabd6e17705ca7f6761a31058f9df781a6a47e3a3063b9d67a",
+	},
+	{
+		168,
+		"369a33badfa618d58d16aaddeaff98d66b30a70c2deee42fc809b9721dc1c524",
+		"9567f47a24e5c3b934777516554d4875de4b1d8a59e18b6983827dd9bf394414eefdccf8f6b10acd3c08afa951be34a31d11065ccd486e71b530f33b7ef263e0",
+		"f15277eb61c4908d44a2853f3cde071ae2ed7a23461fbe162a1a98cf6875059c",
+		"1687771440dbcdaa8af7049dd319414a12a702caa4809a0ded089cb659219ea4",
+	},
+	{
+		500,
+		"495689a003b0b1a4ec4572335ed2d96510cac163d6cc7e83daa73d9b555a2fd5",
+		"f7aca9a50e9bd1207509d43bf9f9dfc980988f2e073b2756b17f003567182174330f2f8d04bd0527fb7f7312c8769362dbcba91c35f87f25fe0ce5b528a38e4d",
+		"ed9a5f1ed895f8f7cbad5bf512be2d884ffc10ee917ab8d4188b846b8063f533",
+		"20a1c001eb6aee7535706c02dbe70f2a39d87d3fda665f89706bea6211025657",
+	},
+}
+
+func testInput(n int) []byte {
+	in := make([]byte, n)
+	for i := range in {
+		in[i] = byte(i % 251)
+	}
+	return in
+}
+
+func TestVectors(t *testing.T) {
+	for _, tt := range sha3Tests {
+		in := testInput(tt.n)
+
+		sum256 := Sum256(in)
+		if got := hex.EncodeToString(sum256[:]); got != tt.sha3_256 {
+			t.Errorf("SHA3-256(%d bytes) = %s, want %s", tt.n, got, tt.sha3_256)
+		}
+		sum512 := Sum512(in)
+		if got := hex.EncodeToString(sum512[:]); got != tt.sha3_512 {
+			t.Errorf("SHA3-512(%d bytes) = %s, want %s", tt.n, got, tt.sha3_512)
+		}
+
+		for _, x := range []struct {
+			name string
+			xof  *SHAKE
+			want string
+		}{
+			{"SHAKE128", NewShake128(), tt.shake128},
+			{"SHAKE256", NewShake256(), tt.shake256},
+		} {
+			x.xof.Write(in)
+			out := make([]byte, 32)
+			x.xof.Read(out)
+			if got := hex.EncodeToString(out); got != x.want {
+				t.Errorf("%s(%d bytes) = %s, want %s", x.name, tt.n, got, x.want)
+			}
+		}
+	}
+}
+
+// TestIncremental checks that writes and reads split at arbitrary points
+// produce the same output as single calls.
+func TestIncremental(t *testing.T) {
+	in := testInput(1000)
+	for _, newXOF := range []func() *SHAKE{NewShake128, NewShake256} {
+		x := newXOF()
+		x.Write(in)
+		want := make([]byte, 1000)
+		x.Read(want)
+
+		for _, step := range []int{1, 7, 64, 135, 136, 168, 169} {
+			x.Reset()
+			for i := 0; i < len(in); i += step {
+				end := i + step
+				if end > len(in) {
+					end = len(in)
+				}
+				x.Write(in[i:end])
+			}
+			got := make([]byte, 0, len(want))
+			for len(got) < len(want) {
+				n := step
+				if n > len(want)-len(got) {
+					n = len(want) - len(got)
+				}
+				buf := make([]byte, n)
+				x.Read(buf)
+				got = append(got, buf...)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("step %d: incremental output differs", step)
+			}
+		}
+	}
+
+	h := New256()
+	h.Write(in[:100])
+	first := h.Sum(nil)
+	if again := h.Sum(nil); !bytes.Equal(first, again) {
+		t.Error("Sum changed the hash state")
+	}
+	h.Write(in[100:])
+	want := Sum256(in)
+	if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Error("Sum after more writes doesn't match Sum256")
+	}
+	h.Reset()
+	if got, want := h.Sum(nil), Sum256(nil); !bytes.Equal(got, want[:]) {
+		t.Error("Reset didn't restore the initial state")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mlkem
+
+import (
+	"bytes"
+	"crypto/internal/sha3"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dk, err := GenerateKey768()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+	Ke, c := ek.Encapsulate()
+	Kd, err := dk.Decapsulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Ke, Kd) {
+		t.Fail()
+	}
+
+	ek1, err := NewEncapsulationKey768(ek.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ek.Bytes(), ek1.Bytes()) {
+		t.Fail()
+	}
+	dk1, err := NewDecapsulationKey768(dk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dk.Bytes(), dk1.Bytes()) {
+		t.Fail()
+	}
+	Kd1, err := dk1.Decapsulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Ke, Kd1) {
+		t.Fail()
+	}
+
+	dk2, err := GenerateKey768()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(dk.EncapsulationKey().Bytes(), dk2.EncapsulationKey().Bytes()) {
+		t.Fail()
+	}
+	if bytes.Equal(dk.Bytes(), dk2.Bytes()) {
+		t.Fail()
+	}
+
+	Ke1, c1 := ek.Encapsulate()
+	if bytes.Equal(c, c1) {
+		t.Fail()
+	}
+	if bytes.Equal(Ke, Ke1) {
+		t.Fail()
+	}
+}
+
+func TestBadLengths(t *testing.T) {
+	dk, err := GenerateKey768()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+	ekBytes := ek.Bytes()
+	_, c := ek.Encapsulate()
+
+	for i := 0; i < len(ekBytes)-1; i++ {
+		if _, err := NewEncapsulationKey768(ekBytes[:i]); err == nil {
+			t.Errorf("expected error for ek length %d", i)
+		}
+	}
+	ekLong := append(ekBytes, 0)
+	if _, err := NewEncapsulationKey768(ekLong); err == nil {
+		t.Error("expected error for long ek")
+	}
+
+	for i := 0; i < len(c)-1; i++ {
+		if _, err := dk.Decapsulate(c[:i]); err == nil {
+			t.Errorf("expected error for c length %d", i)
+		}
+	}
+	cLong := append(c, 0)
+	if _, err := dk.Decapsulate(cLong); err == nil {
+		t.Error("expected error for long c")
+	}
+
+	for _, l := range []int{0, SeedSize - 1, SeedSize + 1} {
+		if _, err := NewDecapsulationKey768(make([]byte, l)); err == nil {
+			t.Errorf("expected error for seed length %d", l)
+		}
+	}
+}
+
+func TestUnreducedEncapsulationKey(t *testing.T) {
+	dk, err := GenerateKey768()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ekBytes := dk.EncapsulationKey().Bytes()
+	// Set the first coefficient to q, which is not a valid field element.
+	ekBytes[0] = byte(q & 0xff)
+	ekBytes[1] = ekBytes[1]&0xf0 | byte(q>>8)
+	if _, err := NewEncapsulationKey768(ekBytes); err == nil {
+		t.Error("expected error for unreduced coefficient")
+	}
+}
+
+// TestVectors checks a deterministic key generation and encapsulation, as
+// well as implicit rejection, against an independent implementation of
+// FIPS 203.
+func TestVectors(t *testing.T) {
+	var seed [SeedSize]byte
+	var m [messageSize]byte
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	for i := range m {
+		m[i] = byte(64 + i)
+	}
+	dk, err := NewDecapsulationKey768(seed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := dk.EncapsulationKey()
+	K, c := ek.encapsulateDerand(&m)
+
+	hexSum := func(b []byte) string {
+		h := sha3.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	if got, want := hexSum(ek.Bytes()), "a24e16d8f8f9383a95b77050f4d9fd2f5733eec1d63ef3c23ebf9918173669a7"; got != want {
+		t.Errorf("SHA3-256(ek) = %s, want %s", got, want)
+	}
+	if got, want := hexSum(c), "b4cfbd24cef67afd3764276c6980e0f88f8e9ca57f59b7f12fe1a9c1e72f4710"; got != want {
+		t.Errorf("SHA3-256(c) = %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(K), "9cddd089ffe70e3996e76f7c8d06746df34d07e8657bc0fcf2bb0e1c3084aea1"; got != want {
+		t.Errorf("K = %s, want %s", got, want)
+	}
+
+	Kd, err := dk.Decapsulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(K, Kd) {
+		t.Errorf("Decapsulate = %x, want %x", Kd, K)
+	}
+
+	c[0] ^= 1
+	Kbad, err := dk.Decapsulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(Kbad), "dcfc80c6db46ff7028e3a4398651c063ae7a42c107a6dc8cb07141861698ab92"; got != want {
+		t.Errorf("implicit rejection K = %s, want %s", got, want)
+	}
+}
+
+func TestFieldReduce(t *testing.T) {
+	for a := uint32(0); a < 2*q*q; a++ {
+		got := fieldReduce(a)
+		exp := fieldElement(a % q)
+		if got != exp {
+			t.Fatalf("reduce(%d) = %d, expected %d", a, got, exp)
+		}
+	}
+}
+
+func TestFieldAdd(t *testing.T) {
+	for a := fieldElement(0); a < q; a++ {
+		for b := fieldElement(0); b < q; b++ {
+			got := fieldAdd(a, b)
+			exp := (a + b) % q
+			if got != exp {
+				t.Fatalf("%d + %d = %d, expected %d", a, b, got, exp)
+			}
+		}
+	}
+}
+
+func TestFieldSub(t *testing.T) {
+	for a := fieldElement(0); a < q; a++ {
+		for b := fieldElement(0); b < q; b++ {
+			got := fieldSub(a, b)
+			exp := (a - b + q) % q
+			if got != exp {
+				t.Fatalf("%d - %d = %d, expected %d", a, b, got, exp)
+			}
+		}
+	}
+}
+
+func TestFieldMul(t *testing.T) {
+	for a := fieldElement(0); a < q; a++ {
+		for b := fieldElement(0); b < q; b++ {
+			got := fieldMul(a, b)
+			exp := fieldElement((uint32(a) * uint32(b)) % q)
+			if got != exp {
+				t.Fatalf("%d * %d = %d, expected %d", a, b, got, exp)
+			}
+		}
+	}
+}
+
+func TestDecompressCompress(t *testing.T) {
+	for _, bits := range []uint8{1, 4, 10} {
+		for a := uint16(0); a < 1<<bits; a++ {
+			f := decompress(a, bits)
+			if f >= q {
+				t.Fatalf("decompress(%d, %d) = %d >= q", a, bits, f)
+			}
+			got := compress(f, bits)
+			if got != a {
+				t.Fatalf("compress(decompress(%d, %d), %d) = %d", a, bits, bits, got)
+			}
+		}
+
+		for a := fieldElement(0); a < q; a++ {
+			c := compress(a, bits)
+			if c >= 1<<bits {
+				t.Fatalf("compress(%d, %d) = %d >= 2^bits", a, bits, c)
+			}
+			got := decompress(c, bits)
+			diff := min(a-got, got-a, a-got+q, got-a+q)
+			ceil := q / (1 << bits)
+			if diff > fieldElement(ceil) {
+				t.Fatalf("decompress(compress(%d, %d), %d) = %d (diff %d, max diff %d)",
+					a, bits, bits, got, diff, ceil)
+			}
+		}
+	}
+}
+
+func min(a, b, c, d fieldElement) fieldElement {
+	x := a
+	for _, y := range []fieldElement{b, c, d} {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
+
+func BitRev7(n uint8) uint8 {
+	if n>>7 != 0 {
+		panic("not 7 bits")
+	}
+	var r uint8
+	r |= n >> 6 & 0b0000_0001
+	r |= n >> 4 & 0b0000_0010
+	r |= n >> 2 & 0b0000_0100
+	r |= n /**/ & 0b0000_1000
+	r |= n << 2 & 0b0001_0000
+	r |= n << 4 & 0b0010_0000
+	r |= n << 6 & 0b0100_0000
+	return r
+}
+
+func TestZetas(t *testing.T) {
+	ζ := big.NewInt(17)
+	q := big.NewInt(q)
+	for k, zeta := range zetas {
+		// ζ^BitRev7(k) mod q
+		exp := new(big.Int).Exp(ζ, big.NewInt(int64(BitRev7(uint8(k)))), q)
+		if big.NewInt(int64(zeta)).Cmp(exp) != 0 {
+			t.Errorf("zetas[%d] = %v, expected %v", k, zeta, exp)
+		}
+	}
+}
+
+func TestGammas(t *testing.T) {
+	ζ := big.NewInt(17)
+	q := big.NewInt(q)
+	for k, gamma := range gammas {
+		// ζ^2BitRev7(i)+1
+		exp := new(big.Int).Exp(ζ, big.NewInt(int64(BitRev7(uint8(k)))*2+1), q)
+		if big.NewInt(int64(gamma)).Cmp(exp) != 0 {
+			t.Errorf("gammas[%d] = %v, expected %v", k, gamma, exp)
+		}
+	}
+}
+
+func TestInverseNTTScale(t *testing.T) {
+	if fieldMul(3303, 128) != 1 {
+		t.Error("3303 is not the inverse of 128 mod q")
+	}
+}
+
+func BenchmarkKeyGen(b *testing.B) {
+	var d, z [32]byte
+	for i := 0; i < b.N; i++ {
+		dk := kemKeyGen(&d, &z)
+		sink ^= dk.EncapsulationKey().Bytes()[0]
+	}
+}
+
+func BenchmarkEncaps(b *testing.B) {
+	dk, err := GenerateKey768()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ekBytes := dk.EncapsulationKey().Bytes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ek, err := NewEncapsulationKey768(ekBytes)
+		if err != nil {
+			b.Fatal(err)
+		}
+		K, _ := ek.Encapsulate()
+		sink ^= K[0]
+	}
+}
+
+func BenchmarkDecaps(b *testing.B) {
+	dk, err := GenerateKey768()
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, c := dk.EncapsulationKey().Encapsulate()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		K, _ := dk.Decapsulate(c)
+		sink ^= K[0]
+	}
+}
+
+var sink byte
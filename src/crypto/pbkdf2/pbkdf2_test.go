@@ -0,0 +1,42 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pbkdf2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var pbkdf2Tests = []struct {
+	hash     func() hash.Hash
+	password string
+	salt     string
+	iter     int
+	output   string
+}{
+	// Test vectors from RFC 6070.
+	{sha1.New, "password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+	{sha1.New, "password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+	{sha1.New, "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096,
+		"3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	{sha256.New, "password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	{sha512.New, "pass\x00word", "sa\x00lt", 4096,
+		"9d9e9c4cd21fe4be24d5b8244c759665f39d98fc12a9ca759bb021db3cfadf345844aebe70dd8b2f6966f25f3613e1187bbd24ed2ca43ed13b246e4675be7ab9ce5cb1e9bd865e2240eecd4ec012b1f9"},
+}
+
+func TestKey(t *testing.T) {
+	for i, v := range pbkdf2Tests {
+		want, _ := hex.DecodeString(v.output)
+		got := Key([]byte(v.password), []byte(v.salt), v.iter, len(want), v.hash)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d: got %x, want %x", i, got, want)
+		}
+	}
+}
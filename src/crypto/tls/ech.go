@@ -0,0 +1,593 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/internal/hpke"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// The ECH implementation follows draft-ietf-tls-esni-18. Only the
+// DHKEM(X25519, HKDF-SHA256) KEM and the HKDF-SHA256 KDF are supported.
+
+type echCipher struct {
+	KDFID  uint16
+	AEADID uint16
+}
+
+type echExtension struct {
+	Type uint16
+	Data []byte
+}
+
+type echConfig struct {
+	raw []byte
+
+	Version uint16
+	Length  uint16
+
+	ConfigID             uint8
+	KemID                uint16
+	PublicKey            []byte
+	SymmetricCipherSuite []echCipher
+
+	MaxNameLength uint8
+	PublicName    []byte
+	Extensions    []echExtension
+}
+
+var errMalformedECHConfig = errors.New("tls: malformed ECHConfigList")
+
+// parseECHConfig parses a single ECHConfig, which must make up all of enc.
+// If the config is for an unknown version, skip is true and ec is empty.
+func parseECHConfig(enc []byte) (skip bool, ec echConfig, err error) {
+	s := cryptobyte.String(enc)
+	ec.raw = enc
+	var contents cryptobyte.String
+	if !s.ReadUint16(&ec.Version) || !s.ReadUint16LengthPrefixed(&contents) || !s.Empty() {
+		return false, echConfig{}, errMalformedECHConfig
+	}
+	ec.Length = uint16(len(contents))
+	if ec.Version != extensionEncryptedClientHello {
+		return true, echConfig{}, nil
+	}
+
+	var cipherSuites, publicName, extensions cryptobyte.String
+	if !contents.ReadUint8(&ec.ConfigID) ||
+		!contents.ReadUint16(&ec.KemID) ||
+		!readUint16LengthPrefixed(&contents, &ec.PublicKey) ||
+		!contents.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!contents.ReadUint8(&ec.MaxNameLength) ||
+		!contents.ReadUint8LengthPrefixed(&publicName) ||
+		!contents.ReadUint16LengthPrefixed(&extensions) ||
+		!contents.Empty() {
+		return false, echConfig{}, errMalformedECHConfig
+	}
+	for !cipherSuites.Empty() {
+		var c echCipher
+		if !cipherSuites.ReadUint16(&c.KDFID) || !cipherSuites.ReadUint16(&c.AEADID) {
+			return false, echConfig{}, errMalformedECHConfig
+		}
+		ec.SymmetricCipherSuite = append(ec.SymmetricCipherSuite, c)
+	}
+	ec.PublicName = publicName
+	for !extensions.Empty() {
+		var e echExtension
+		if !extensions.ReadUint16(&e.Type) || !readUint16LengthPrefixed(&extensions, &e.Data) {
+			return false, echConfig{}, errMalformedECHConfig
+		}
+		ec.Extensions = append(ec.Extensions, e)
+	}
+
+	return false, ec, nil
+}
+
+// parseECHConfigList parses a draft-ietf-tls-esni-18 ECHConfigList, returning
+// the configs with a known version.
+func parseECHConfigList(data []byte) ([]echConfig, error) {
+	s := cryptobyte.String(data)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() || list.Empty() {
+		return nil, errMalformedECHConfig
+	}
+	var configs []echConfig
+	for !list.Empty() {
+		config := list
+		var version uint16
+		var contents cryptobyte.String
+		if !list.ReadUint16(&version) || !list.ReadUint16LengthPrefixed(&contents) {
+			return nil, errMalformedECHConfig
+		}
+		skip, ec, err := parseECHConfig(config[:len(config)-len(list)])
+		if err != nil {
+			return nil, err
+		}
+		if !skip {
+			configs = append(configs, ec)
+		}
+	}
+	return configs, nil
+}
+
+// pickECHConfig returns the first config in list that uses a supported KEM,
+// a supported cipher suite and a valid public name, and that has no
+// mandatory extensions. It returns nil if there is no such config.
+func pickECHConfig(list []echConfig) *echConfig {
+	for i := range list {
+		ec := &list[i]
+		if _, ok := hpke.SupportedKEMs[ec.KemID]; !ok {
+			continue
+		}
+		if _, err := hpke.ParseHPKEPublicKey(ec.KemID, ec.PublicKey); err != nil {
+			continue
+		}
+		if _, err := pickECHCipherSuite(ec.SymmetricCipherSuite); err != nil {
+			continue
+		}
+		if !validDNSName(string(ec.PublicName)) {
+			continue
+		}
+		mandatoryExt := false
+		for _, ext := range ec.Extensions {
+			// Extensions with the high bit set are mandatory, and we don't
+			// support any extensions.
+			if ext.Type&(1<<15) != 0 {
+				mandatoryExt = true
+				break
+			}
+		}
+		if mandatoryExt {
+			continue
+		}
+		return ec
+	}
+	return nil
+}
+
+func pickECHCipherSuite(suites []echCipher) (echCipher, error) {
+	for _, s := range suites {
+		if _, ok := hpke.SupportedAEADs[s.AEADID]; !ok {
+			continue
+		}
+		if _, ok := hpke.SupportedKDFs[s.KDFID]; !ok {
+			continue
+		}
+		return s, nil
+	}
+	return echCipher{}, errors.New("tls: no supported symmetric ciphersuites for ECH")
+}
+
+// validDNSName reports whether name is a syntactically valid, multi-label,
+// LDH DNS name, as required for the public_name of an ECHConfig.
+func validDNSName(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) <= 1 {
+		return false
+	}
+	for _, l := range labels {
+		if len(l) == 0 || len(l) > 63 {
+			return false
+		}
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			if c == '-' && (i == 0 || i == len(l)-1) {
+				return false
+			}
+			if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ECHRejectionError is the error type returned when ECH is rejected by a
+// remote server. If the server offered an ECHConfigList to use for retries,
+// the RetryConfigList field will contain this list.
+//
+// The client may treat an ECHRejectionError with an empty set of
+// RetryConfigList as a secure signal from the server that ECH is not
+// supported.
+type ECHRejectionError struct {
+	RetryConfigList []byte
+}
+
+func (e *ECHRejectionError) Error() string {
+	return "tls: server rejected ECH"
+}
+
+// echClientContext holds the client state of an ECH attempt.
+type echClientContext struct {
+	config          *echConfig
+	hpkeContext     *hpke.Sender
+	encapsulatedKey []byte
+	innerHello      *clientHelloMsg
+	innerTranscript hash.Hash
+	kdfID           uint16
+	aeadID          uint16
+	echRejected     bool
+	retryConfigs    []byte
+}
+
+// echServerContext holds the server state of an accepted ECH attempt.
+type echServerContext struct {
+	hpkeContext *hpke.Recipient
+	configID    uint8
+	ciphersuite echCipher
+	// inner is true if the first ClientHello carried an inner
+	// encrypted_client_hello extension, meaning a client-facing server
+	// already decrypted it on our behalf.
+	inner bool
+}
+
+const (
+	echTypeOuter uint8 = 0
+	echTypeInner uint8 = 1
+)
+
+var errInvalidECHExt = errors.New("tls: client sent invalid encrypted_client_hello extension")
+
+// parseECHExt parses the contents of a ClientHello encrypted_client_hello
+// extension. See draft-ietf-tls-esni-18, Section 5.
+func parseECHExt(ext []byte) (echType uint8, cs echCipher, configID uint8, encap, payload []byte, err error) {
+	s := cryptobyte.String(ext)
+	if !s.ReadUint8(&echType) {
+		return 0, echCipher{}, 0, nil, nil, errInvalidECHExt
+	}
+	switch echType {
+	case echTypeInner:
+		if !s.Empty() {
+			return 0, echCipher{}, 0, nil, nil, errInvalidECHExt
+		}
+		return echType, echCipher{}, 0, nil, nil, nil
+	case echTypeOuter:
+	default:
+		return 0, echCipher{}, 0, nil, nil, errInvalidECHExt
+	}
+	if !s.ReadUint16(&cs.KDFID) ||
+		!s.ReadUint16(&cs.AEADID) ||
+		!s.ReadUint8(&configID) ||
+		!readUint16LengthPrefixed(&s, &encap) ||
+		!readUint16LengthPrefixed(&s, &payload) ||
+		len(payload) == 0 || !s.Empty() {
+		return 0, echCipher{}, 0, nil, nil, errInvalidECHExt
+	}
+	// Copy encap and payload so that they don't alias the message.
+	encap = append([]byte(nil), encap...)
+	payload = append([]byte(nil), payload...)
+	return echType, cs, configID, encap, payload, nil
+}
+
+func generateOuterECHExt(configID uint8, kdfID, aeadID uint16, encodedKey, payload []byte) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint8(echTypeOuter)
+	b.AddUint16(kdfID)
+	b.AddUint16(aeadID)
+	b.AddUint8(configID)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(encodedKey)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(payload)
+	})
+	return b.Bytes()
+}
+
+// encodeInnerClientHello returns the EncodedClientHelloInner for inner: the
+// ClientHello without its message header and with an empty legacy session
+// ID, followed by padding. See draft-ietf-tls-esni-18, Sections 5.1 and 6.1.3.
+func encodeInnerClientHello(inner *clientHelloMsg, maxNameLength int) []byte {
+	h := *inner
+	h.raw = nil
+	h.sessionId = nil
+	encoded := h.marshal()[4:]
+
+	var paddingLen int
+	if inner.serverName != "" {
+		if l := maxNameLength - len(inner.serverName); l > 0 {
+			paddingLen = l
+		}
+	} else {
+		paddingLen = maxNameLength + 9
+	}
+	paddingLen = 31 - ((len(encoded) + paddingLen - 1) % 32)
+
+	return append(encoded, make([]byte, paddingLen)...)
+}
+
+// computeAndUpdateOuterECHExtension encrypts inner and stores the result in
+// the encrypted_client_hello extension of outer. The encapsulated key is only
+// sent in the first ClientHello.
+func computeAndUpdateOuterECHExtension(outer, inner *clientHelloMsg, ech *echClientContext, useKey bool) error {
+	var encapKey []byte
+	if useKey {
+		encapKey = ech.encapsulatedKey
+	}
+	encodedInner := encodeInnerClientHello(inner, int(ech.config.MaxNameLength))
+	// All the supported AEADs have a 16 byte tag.
+	encryptedLen := len(encodedInner) + 16
+
+	// The AAD is the outer ClientHello with the payload replaced by zeroes.
+	var err error
+	outer.encryptedClientHello, err = generateOuterECHExt(ech.config.ConfigID, ech.kdfID, ech.aeadID, encapKey, make([]byte, encryptedLen))
+	if err != nil {
+		return err
+	}
+	outer.raw = nil
+	aad := outer.marshal()[4:]
+	encryptedInner, err := ech.hpkeContext.Seal(aad, encodedInner)
+	if err != nil {
+		return err
+	}
+	outer.encryptedClientHello, err = generateOuterECHExt(ech.config.ConfigID, ech.kdfID, ech.aeadID, encapKey, encryptedInner)
+	if err != nil {
+		return err
+	}
+	outer.raw = nil
+	return nil
+}
+
+// echAcceptConfirmation computes the eight byte signal a server uses to
+// indicate that it accepted ECH. See draft-ietf-tls-esni-18, Section 7.2.
+func echAcceptConfirmation(suite *cipherSuiteTLS13, innerRandom []byte, label string, transcript hash.Hash) []byte {
+	return suite.expandLabel(suite.extract(innerRandom, nil), label, transcript.Sum(nil), 8)
+}
+
+type rawExtension struct {
+	extType uint16
+	data    []byte
+}
+
+func extractRawExtensions(hello *clientHelloMsg) ([]rawExtension, error) {
+	s := cryptobyte.String(hello.marshal())
+	if !s.Skip(4) || // message type and uint24 length field
+		!s.Skip(2) || !s.Skip(32) || // vers, random
+		!skipUint8LengthPrefixed(&s) || // session ID
+		!skipUint16LengthPrefixed(&s) || // cipher suites
+		!skipUint8LengthPrefixed(&s) { // compression methods
+		return nil, errors.New("tls: malformed outer client hello")
+	}
+	var rawExtensions []rawExtension
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("tls: malformed outer client hello")
+	}
+	for !extensions.Empty() {
+		var extension uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extension) ||
+			!extensions.ReadUint16LengthPrefixed(&extData) {
+			return nil, errors.New("tls: invalid inner client hello")
+		}
+		rawExtensions = append(rawExtensions, rawExtension{extension, extData})
+	}
+	return rawExtensions, nil
+}
+
+func skipUint8LengthPrefixed(s *cryptobyte.String) bool {
+	var skip uint8
+	if !s.ReadUint8(&skip) {
+		return false
+	}
+	return s.Skip(int(skip))
+}
+
+func skipUint16LengthPrefixed(s *cryptobyte.String) bool {
+	var skip uint16
+	if !s.ReadUint16(&skip) {
+		return false
+	}
+	return s.Skip(int(skip))
+}
+
+// decodeInnerClientHello reconstructs the inner ClientHello from its
+// encoding, restoring the legacy session ID of outer and expanding any
+// ech_outer_extensions references from outer. The result is byte-for-byte
+// the ClientHello that the client recorded in its transcript.
+func decodeInnerClientHello(outer *clientHelloMsg, encoded []byte) (*clientHelloMsg, error) {
+	innerReader := cryptobyte.String(encoded)
+	var versionAndRandom, sessionID, cipherSuites, compressionMethods []byte
+	var extensions cryptobyte.String
+	if !innerReader.ReadBytes(&versionAndRandom, 2+32) ||
+		!readUint8LengthPrefixed(&innerReader, &sessionID) ||
+		len(sessionID) != 0 ||
+		!readUint16LengthPrefixed(&innerReader, &cipherSuites) ||
+		!readUint8LengthPrefixed(&innerReader, &compressionMethods) ||
+		!innerReader.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errInvalidECHExt
+	}
+
+	// The padding must be all zeroes.
+	for _, p := range innerReader {
+		if p != 0 {
+			return nil, errInvalidECHExt
+		}
+	}
+
+	rawOuterExts, err := extractRawExtensions(outer)
+	if err != nil {
+		return nil, err
+	}
+
+	var recon cryptobyte.Builder
+	recon.AddUint8(typeClientHello)
+	recon.AddUint24LengthPrefixed(func(recon *cryptobyte.Builder) {
+		recon.AddBytes(versionAndRandom)
+		recon.AddUint8LengthPrefixed(func(recon *cryptobyte.Builder) {
+			recon.AddBytes(outer.sessionId)
+		})
+		recon.AddUint16LengthPrefixed(func(recon *cryptobyte.Builder) {
+			recon.AddBytes(cipherSuites)
+		})
+		recon.AddUint8LengthPrefixed(func(recon *cryptobyte.Builder) {
+			recon.AddBytes(compressionMethods)
+		})
+		recon.AddUint16LengthPrefixed(func(recon *cryptobyte.Builder) {
+			// Referenced outer extensions must appear in the same order as
+			// in the outer ClientHello, so the search resumes from the last
+			// match.
+			next := 0
+			for !extensions.Empty() {
+				var extension uint16
+				var extData cryptobyte.String
+				if !extensions.ReadUint16(&extension) ||
+					!extensions.ReadUint16LengthPrefixed(&extData) {
+					recon.SetError(errInvalidECHExt)
+					return
+				}
+				if extension != extensionECHOuterExtensions {
+					recon.AddUint16(extension)
+					recon.AddUint16LengthPrefixed(func(recon *cryptobyte.Builder) {
+						recon.AddBytes(extData)
+					})
+					continue
+				}
+				var outerExts cryptobyte.String
+				if !extData.ReadUint8LengthPrefixed(&outerExts) || !extData.Empty() || outerExts.Empty() {
+					recon.SetError(errInvalidECHExt)
+					return
+				}
+				for !outerExts.Empty() {
+					var extType uint16
+					if !outerExts.ReadUint16(&extType) || extType == extensionEncryptedClientHello {
+						recon.SetError(errInvalidECHExt)
+						return
+					}
+					for next < len(rawOuterExts) && rawOuterExts[next].extType != extType {
+						next++
+					}
+					if next == len(rawOuterExts) {
+						recon.SetError(errInvalidECHExt)
+						return
+					}
+					ext := rawOuterExts[next]
+					next++
+					recon.AddUint16(ext.extType)
+					recon.AddUint16LengthPrefixed(func(recon *cryptobyte.Builder) {
+						recon.AddBytes(ext.data)
+					})
+				}
+			}
+		})
+	})
+
+	reconBytes, err := recon.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	inner := &clientHelloMsg{}
+	if !inner.unmarshal(reconBytes) {
+		return nil, errInvalidECHExt
+	}
+
+	if !bytes.Equal(inner.encryptedClientHello, []byte{echTypeInner}) {
+		return nil, errInvalidECHExt
+	}
+	if len(inner.supportedVersions) != 1 || inner.supportedVersions[0] != VersionTLS13 {
+		return nil, errors.New("tls: client sent encrypted client hello inner extension with unsupported versions")
+	}
+
+	return inner, nil
+}
+
+// decryptECHPayload opens the encrypted inner ClientHello payload carried by
+// the outer ClientHello hello, in its marshaled form.
+func decryptECHPayload(context *hpke.Recipient, hello, payload []byte) ([]byte, error) {
+	outerAAD := bytes.Replace(hello[4:], payload, make([]byte, len(payload)), 1)
+	return context.Open(outerAAD, payload)
+}
+
+// processECHClientHello attempts to decrypt the inner ClientHello of outer
+// with one of the configured keys. If ECH is not in use or every key fails,
+// it returns outer and a nil context, and the handshake proceeds with outer.
+func (c *Conn) processECHClientHello(outer *clientHelloMsg) (*clientHelloMsg, *echServerContext, error) {
+	echType, echCiphersuite, configID, encap, payload, err := parseECHExt(outer.encryptedClientHello)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return nil, nil, err
+	}
+
+	if echType == echTypeInner {
+		return outer, &echServerContext{inner: true}, nil
+	}
+
+	for _, echKey := range c.config.EncryptedClientHelloKeys {
+		skip, config, err := parseECHConfig(echKey.Config)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, nil, fmt.Errorf("tls: invalid EncryptedClientHelloKeys Config: %v", err)
+		}
+		if skip {
+			c.sendAlert(alertInternalError)
+			return nil, nil, errors.New("tls: EncryptedClientHelloKeys Config has an unsupported version")
+		}
+		if config.ConfigID != configID {
+			continue
+		}
+		echPriv, err := hpke.ParseHPKEPrivateKey(config.KemID, echKey.PrivateKey)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, nil, fmt.Errorf("tls: invalid EncryptedClientHelloKeys PrivateKey: %v", err)
+		}
+		info := append([]byte("tls ech\x00"), echKey.Config...)
+		hpkeContext, err := hpke.SetupRecipient(config.KemID, echCiphersuite.KDFID, echCiphersuite.AEADID, echPriv, info, encap)
+		if err != nil {
+			// Attempt the next trial decryption.
+			continue
+		}
+		encodedInner, err := decryptECHPayload(hpkeContext, outer.marshal(), payload)
+		if err != nil {
+			continue
+		}
+
+		// The server_name of outer is not checked against the public name
+		// of the config, as the client had to know the config to encrypt
+		// the payload in the first place.
+
+		inner, err := decodeInnerClientHello(outer, encodedInner)
+		if err != nil {
+			c.sendAlert(alertIllegalParameter)
+			return nil, nil, err
+		}
+
+		c.echAccepted = true
+		return inner, &echServerContext{
+			hpkeContext: hpkeContext,
+			configID:    configID,
+			ciphersuite: echCiphersuite,
+		}, nil
+	}
+
+	return outer, nil, nil
+}
+
+// buildRetryConfigList returns an ECHConfigList of the keys marked with
+// SendAsRetry, or nil if there are none.
+func buildRetryConfigList(keys []EncryptedClientHelloKey) ([]byte, error) {
+	var atLeastOneRetryConfig bool
+	var retryBuilder cryptobyte.Builder
+	retryBuilder.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, c := range keys {
+			if !c.SendAsRetry {
+				continue
+			}
+			atLeastOneRetryConfig = true
+			b.AddBytes(c.Config)
+		}
+	})
+	if !atLeastOneRetryConfig {
+		return nil, nil
+	}
+	return retryBuilder.Bytes()
+}
@@ -0,0 +1,543 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/internal/hpke"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// ECH is not supported by the OpenSSL version used to record the reference
+// handshakes, so these tests run both sides in process.
+
+func marshalECHConfig(id uint8, pubKey []byte, publicName string, maxNameLen uint8) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(extensionEncryptedClientHello)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(id)
+		b.AddUint16(hpke.DHKEM_X25519_HKDF_SHA256)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(pubKey)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, aeadID := range []uint16{hpke.AEAD_AES_128_GCM, hpke.AEAD_AES_256_GCM, hpke.AEAD_ChaCha20Poly1305} {
+				b.AddUint16(hpke.KDF_HKDF_SHA256)
+				b.AddUint16(aeadID)
+			}
+		})
+		b.AddUint8(maxNameLen)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(publicName))
+		})
+		b.AddUint16(0) // extensions
+	})
+	return b.BytesOrPanic()
+}
+
+func marshalECHConfigList(configs ...[]byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, c := range configs {
+			b.AddBytes(c)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func generateECHKey(t *testing.T, id uint8, publicName string) EncryptedClientHelloKey {
+	k, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return EncryptedClientHelloKey{
+		Config:      marshalECHConfig(id, k.PublicKey().Bytes(), publicName, 32),
+		PrivateKey:  k.Bytes(),
+		SendAsRetry: true,
+	}
+}
+
+type echTestEnv struct {
+	roots        *x509.CertPool
+	publicCert   Certificate
+	privateCert  Certificate
+	clientConfig *Config
+	serverConfig *Config
+}
+
+// newECHTestEnv returns a client and a server configured for ECH with a
+// certificate for the public name "public.example" and one for the private
+// name "secret.example".
+func newECHTestEnv(t *testing.T) *echTestEnv {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ECH Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(serial int64, name string) Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	env := &echTestEnv{
+		roots:       x509.NewCertPool(),
+		publicCert:  issue(2, "public.example"),
+		privateCert: issue(3, "secret.example"),
+	}
+	env.roots.AddCert(ca)
+
+	echKey := generateECHKey(t, 1, "public.example")
+	env.serverConfig = &Config{
+		Certificates:             []Certificate{env.publicCert, env.privateCert},
+		MinVersion:               VersionTLS13,
+		EncryptedClientHelloKeys: []EncryptedClientHelloKey{echKey},
+	}
+	env.clientConfig = &Config{
+		ServerName:                     "secret.example",
+		RootCAs:                        env.roots,
+		MinVersion:                     VersionTLS13,
+		EncryptedClientHelloConfigList: marshalECHConfigList(echKey.Config),
+	}
+	return env
+}
+
+// echHandshake runs a handshake and returns the states and errors of both
+// sides.
+func echHandshake(t *testing.T, clientConfig, serverConfig *Config) (clientState, serverState ConnectionState, clientErr, serverErr error) {
+	c, s := localPipe(t)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		server := Server(s, serverConfig)
+		serverErr = server.Handshake()
+		if serverErr == nil {
+			serverState = server.ConnectionState()
+			server.Write([]byte{0})
+			// Wait for the client to close the connection, possibly with
+			// an alert.
+			server.Read(make([]byte, 1))
+		}
+		s.Close()
+	}()
+	client := Client(c, clientConfig)
+	clientErr = client.Handshake()
+	if clientErr == nil {
+		clientState = client.ConnectionState()
+		// Reading processes any session tickets sent by the server.
+		client.Read(make([]byte, 1))
+	}
+	client.Close()
+	<-done
+	return
+}
+
+func TestECHAccepted(t *testing.T) {
+	for _, name := range []string{"Basic", "HelloRetryRequest"} {
+		t.Run(name, func(t *testing.T) {
+			env := newECHTestEnv(t)
+			if name == "HelloRetryRequest" {
+				// The client sends an X25519 key share first.
+				env.serverConfig.CurvePreferences = []CurveID{CurveP256}
+			}
+			var serverSNI string
+			env.serverConfig.GetConfigForClient = func(chi *ClientHelloInfo) (*Config, error) {
+				serverSNI = chi.ServerName
+				return nil, nil
+			}
+
+			cs, ss, cErr, sErr := echHandshake(t, env.clientConfig, env.serverConfig)
+			if cErr != nil || sErr != nil {
+				t.Fatalf("handshake failed: client: %v, server: %v", cErr, sErr)
+			}
+			if !cs.ECHAccepted || !ss.ECHAccepted {
+				t.Errorf("ECHAccepted = %v (client), %v (server), want true", cs.ECHAccepted, ss.ECHAccepted)
+			}
+			if serverSNI != "secret.example" || ss.ServerName != "secret.example" || cs.ServerName != "secret.example" {
+				t.Errorf("server name = %q, %q (server), %q (client), want secret.example", serverSNI, ss.ServerName, cs.ServerName)
+			}
+			if got := cs.PeerCertificates[0].DNSNames[0]; got != "secret.example" {
+				t.Errorf("server certificate is for %q, want secret.example", got)
+			}
+		})
+	}
+}
+
+func TestECHRejected(t *testing.T) {
+	t.Run("RetryConfigs", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		// The server has a different key for the same config ID, so it
+		// can't decrypt the inner ClientHello.
+		serverKey := generateECHKey(t, 1, "public.example")
+		env.serverConfig.EncryptedClientHelloKeys = []EncryptedClientHelloKey{serverKey}
+
+		_, ss, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		var echErr *ECHRejectionError
+		if !errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want ECHRejectionError", cErr)
+		}
+		if want := marshalECHConfigList(serverKey.Config); !bytes.Equal(echErr.RetryConfigList, want) {
+			t.Errorf("RetryConfigList = %x, want %x", echErr.RetryConfigList, want)
+		}
+		if ss.ECHAccepted {
+			t.Error("server reported ECH as accepted")
+		}
+		if ss.HandshakeComplete && ss.ServerName != "public.example" {
+			t.Errorf("server name = %q, want public.example", ss.ServerName)
+		}
+
+		// The retry configs can be used to connect.
+		env.clientConfig.EncryptedClientHelloConfigList = echErr.RetryConfigList
+		cs, _, cErr, sErr := echHandshake(t, env.clientConfig, env.serverConfig)
+		if cErr != nil || sErr != nil {
+			t.Fatalf("retry failed: client: %v, server: %v", cErr, sErr)
+		}
+		if !cs.ECHAccepted {
+			t.Error("retry did not use ECH")
+		}
+	})
+
+	t.Run("NoServerSupport", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		env.serverConfig.EncryptedClientHelloKeys = nil
+
+		_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		var echErr *ECHRejectionError
+		if !errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want ECHRejectionError", cErr)
+		}
+		if echErr.RetryConfigList != nil {
+			t.Errorf("RetryConfigList = %x, want nil", echErr.RetryConfigList)
+		}
+	})
+
+	t.Run("NoSendAsRetry", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		serverKey := generateECHKey(t, 1, "public.example")
+		serverKey.SendAsRetry = false
+		env.serverConfig.EncryptedClientHelloKeys = []EncryptedClientHelloKey{serverKey}
+
+		_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		var echErr *ECHRejectionError
+		if !errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want ECHRejectionError", cErr)
+		}
+		if echErr.RetryConfigList != nil {
+			t.Errorf("RetryConfigList = %x, want nil", echErr.RetryConfigList)
+		}
+	})
+
+	t.Run("HelloRetryRequest", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		env.serverConfig.CurvePreferences = []CurveID{CurveP256}
+		env.serverConfig.EncryptedClientHelloKeys = []EncryptedClientHelloKey{generateECHKey(t, 1, "public.example")}
+
+		_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		var echErr *ECHRejectionError
+		if !errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want ECHRejectionError", cErr)
+		}
+	})
+
+	t.Run("PublicNameNotVerified", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		env.serverConfig.EncryptedClientHelloKeys = nil
+		// The public name certificate is not valid for the public name.
+		env.serverConfig.Certificates = []Certificate{env.privateCert}
+
+		_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		if cErr == nil {
+			t.Fatal("handshake succeeded")
+		}
+		var echErr *ECHRejectionError
+		if errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want certificate verification error", cErr)
+		}
+	})
+
+	t.Run("InsecureSkipVerifyIgnored", func(t *testing.T) {
+		env := newECHTestEnv(t)
+		env.serverConfig.EncryptedClientHelloKeys = nil
+		env.clientConfig.RootCAs = x509.NewCertPool()
+		env.clientConfig.InsecureSkipVerify = true
+
+		_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+		if cErr == nil {
+			t.Fatal("handshake succeeded")
+		}
+		var echErr *ECHRejectionError
+		if errors.As(cErr, &echErr) {
+			t.Fatalf("client error = %v, want certificate verification error", cErr)
+		}
+	})
+}
+
+func TestECHRejectionVerify(t *testing.T) {
+	env := newECHTestEnv(t)
+	env.serverConfig.EncryptedClientHelloKeys = nil
+	env.clientConfig.RootCAs = x509.NewCertPool()
+
+	var called bool
+	env.clientConfig.EncryptedClientHelloRejectionVerify = func(cs ConnectionState) error {
+		called = true
+		if cs.ECHAccepted {
+			t.Error("ECHAccepted is true in EncryptedClientHelloRejectionVerify")
+		}
+		if len(cs.PeerCertificates) == 0 || cs.PeerCertificates[0].DNSNames[0] != "public.example" {
+			t.Error("unexpected peer certificates in EncryptedClientHelloRejectionVerify")
+		}
+		return nil
+	}
+	env.clientConfig.VerifyConnection = func(ConnectionState) error {
+		t.Error("VerifyConnection called after ECH rejection")
+		return nil
+	}
+	_, _, cErr, _ := echHandshake(t, env.clientConfig, env.serverConfig)
+	var echErr *ECHRejectionError
+	if !errors.As(cErr, &echErr) {
+		t.Fatalf("client error = %v, want ECHRejectionError", cErr)
+	}
+	if !called {
+		t.Error("EncryptedClientHelloRejectionVerify was not called")
+	}
+
+	verifyErr := errors.New("rejected by callback")
+	env.clientConfig.EncryptedClientHelloRejectionVerify = func(ConnectionState) error {
+		return verifyErr
+	}
+	_, _, cErr, _ = echHandshake(t, env.clientConfig, env.serverConfig)
+	if !errors.Is(cErr, verifyErr) {
+		t.Fatalf("client error = %v, want %v", cErr, verifyErr)
+	}
+}
+
+func TestECHResumption(t *testing.T) {
+	env := newECHTestEnv(t)
+	env.clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+
+	cs, _, cErr, sErr := echHandshake(t, env.clientConfig, env.serverConfig)
+	if cErr != nil || sErr != nil {
+		t.Fatalf("handshake failed: client: %v, server: %v", cErr, sErr)
+	}
+	if cs.DidResume {
+		t.Fatal("first handshake resumed")
+	}
+	cs, ss, cErr, sErr := echHandshake(t, env.clientConfig, env.serverConfig)
+	if cErr != nil || sErr != nil {
+		t.Fatalf("resumption failed: client: %v, server: %v", cErr, sErr)
+	}
+	if !cs.DidResume || !ss.DidResume {
+		t.Error("second handshake did not resume")
+	}
+	if !cs.ECHAccepted || !ss.ECHAccepted {
+		t.Error("resumed handshake did not use ECH")
+	}
+}
+
+func TestECHConfigErrors(t *testing.T) {
+	env := newECHTestEnv(t)
+	validConfig := env.serverConfig.EncryptedClientHelloKeys[0].Config
+	pub := validConfig[9 : 9+32]
+
+	unknownVersion := append([]byte{0xfe, 0x0a}, validConfig[2:]...)
+	badPublicName := marshalECHConfig(1, pub, "localhost", 32)
+	badKey := marshalECHConfig(1, pub[:31], "public.example", 32)
+
+	for _, tt := range []struct {
+		name   string
+		list   []byte
+		errStr string
+	}{
+		{"Empty", []byte{}, "malformed"},
+		{"EmptyList", []byte{0, 0}, "malformed"},
+		{"Truncated", marshalECHConfigList(validConfig)[:20], "malformed"},
+		{"TrailingData", append(marshalECHConfigList(validConfig), 0), "malformed"},
+		{"UnknownVersion", marshalECHConfigList(unknownVersion), "no valid configs"},
+		{"BadPublicName", marshalECHConfigList(badPublicName), "no valid configs"},
+		{"BadKey", marshalECHConfigList(badKey), "no valid configs"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := env.clientConfig.Clone()
+			config.EncryptedClientHelloConfigList = tt.list
+			_, _, cErr, _ := echHandshake(t, config, env.serverConfig)
+			if cErr == nil || !strings.Contains(cErr.Error(), tt.errStr) {
+				t.Errorf("client error = %v, want %q", cErr, tt.errStr)
+			}
+		})
+	}
+
+	// An unknown version is skipped in favor of the next config.
+	config := env.clientConfig.Clone()
+	config.EncryptedClientHelloConfigList = marshalECHConfigList(unknownVersion, badPublicName, validConfig)
+	cs, _, cErr, sErr := echHandshake(t, config, env.serverConfig)
+	if cErr != nil || sErr != nil {
+		t.Fatalf("handshake failed: client: %v, server: %v", cErr, sErr)
+	}
+	if !cs.ECHAccepted {
+		t.Error("ECH was not accepted")
+	}
+
+	config = env.clientConfig.Clone()
+	config.MinVersion = VersionTLS12
+	if _, _, cErr, _ := echHandshake(t, config, env.serverConfig); cErr == nil || !strings.Contains(cErr.Error(), "MinVersion") {
+		t.Errorf("client error = %v, want MinVersion error", cErr)
+	}
+	config = env.clientConfig.Clone()
+	config.MinVersion = 0
+	config.MaxVersion = VersionTLS12
+	if _, _, cErr, _ := echHandshake(t, config, env.serverConfig); cErr == nil || !strings.Contains(cErr.Error(), "MaxVersion") {
+		t.Errorf("client error = %v, want MaxVersion error", cErr)
+	}
+}
+
+func TestDecodeInnerClientHello(t *testing.T) {
+	outer := &clientHelloMsg{
+		vers:               VersionTLS12,
+		random:             make([]byte, 32),
+		sessionId:          bytes.Repeat([]byte{0xaa}, 32),
+		cipherSuites:       []uint16{TLS_AES_128_GCM_SHA256},
+		compressionMethods: []uint8{compressionNone},
+		serverName:         "public.example",
+		supportedCurves:    []CurveID{X25519},
+		supportedVersions:  []uint16{VersionTLS13},
+		keyShares:          []keyShare{{group: X25519, data: bytes.Repeat([]byte{0xbb}, 32)}},
+		alpnProtocols:      []string{"h2"},
+	}
+	outer.encryptedClientHello, _ = generateOuterECHExt(1, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES_128_GCM, nil, []byte{1})
+	inner := *outer
+	inner.raw = nil
+	inner.random = bytes.Repeat([]byte{0xcc}, 32)
+	inner.serverName = "secret.example"
+	inner.encryptedClientHello = []byte{echTypeInner}
+	want := inner.marshal()
+
+	// encode returns the EncodedClientHelloInner of inner, with the
+	// extensions in compressed replaced by an ech_outer_extensions
+	// extension listing them in the given order.
+	encode := func(compressed ...uint16) []byte {
+		h := inner
+		h.raw = nil
+		h.sessionId = nil
+		exts, err := extractRawExtensions(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b cryptobyte.Builder
+		s := cryptobyte.String(h.marshal()[4:])
+		var prefix []byte
+		var sessionID, suites, compression []byte
+		s.ReadBytes(&prefix, 34)
+		readUint8LengthPrefixed(&s, &sessionID)
+		readUint16LengthPrefixed(&s, &suites)
+		readUint8LengthPrefixed(&s, &compression)
+		b.AddBytes(prefix)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(suites) })
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(compression) })
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			added := false
+			for _, ext := range exts {
+				isCompressed := false
+				for _, c := range compressed {
+					if c == ext.extType {
+						isCompressed = true
+					}
+				}
+				if !isCompressed {
+					b.AddUint16(ext.extType)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(ext.data) })
+					continue
+				}
+				if added {
+					continue
+				}
+				added = true
+				b.AddUint16(extensionECHOuterExtensions)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						for _, c := range compressed {
+							b.AddUint16(c)
+						}
+					})
+				})
+			}
+		})
+		return append(b.BytesOrPanic(), make([]byte, 7)...)
+	}
+
+	for _, compressed := range [][]uint16{
+		nil,
+		{extensionKeyShare},
+		{extensionSupportedVersions, extensionKeyShare},
+	} {
+		got, err := decodeInnerClientHello(outer, encode(compressed...))
+		if err != nil {
+			t.Errorf("%v: %v", compressed, err)
+			continue
+		}
+		if !bytes.Equal(got.marshal(), want) {
+			t.Errorf("%v: decoded inner ClientHello does not match", compressed)
+		}
+	}
+
+	for _, compressed := range [][]uint16{
+		{extensionKeyShare, extensionSupportedVersions}, // out of order
+		{extensionEncryptedClientHello},
+		{extensionKeyShare, extensionKeyShare},
+	} {
+		if _, err := decodeInnerClientHello(outer, encode(compressed...)); err == nil {
+			t.Errorf("%v: decoding succeeded", compressed)
+		}
+	}
+
+	padded := encode()
+	padded[len(padded)-1] = 1
+	if _, err := decodeInnerClientHello(outer, padded); err == nil {
+		t.Error("decoding succeeded with non-zero padding")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/internal/hpke"
 	"crypto/rsa"
 	"crypto/subtle"
 	"crypto/x509"
@@ -29,30 +30,41 @@ type clientHandshakeState struct {
 	suite        *cipherSuite
 	finishedHash finishedHash
 	masterSecret []byte
-	session      *ClientSessionState
+	session      *SessionState // the session being resumed
+	ticket       []byte        // a fresh ticket received during this handshake
 }
 
-func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
+func (c *Conn) makeClientHello() (*clientHelloMsg, *keySharePrivateKeys, *echClientContext, error) {
 	config := c.config
 	if len(config.ServerName) == 0 && !config.InsecureSkipVerify {
-		return nil, nil, errors.New("tls: either ServerName or InsecureSkipVerify must be specified in the tls.Config")
+		return nil, nil, nil, errors.New("tls: either ServerName or InsecureSkipVerify must be specified in the tls.Config")
 	}
 
 	nextProtosLength := 0
 	for _, proto := range config.NextProtos {
 		if l := len(proto); l == 0 || l > 255 {
-			return nil, nil, errors.New("tls: invalid NextProtos value")
+			return nil, nil, nil, errors.New("tls: invalid NextProtos value")
 		} else {
 			nextProtosLength += 1 + l
 		}
 	}
 	if nextProtosLength > 0xffff {
-		return nil, nil, errors.New("tls: NextProtos values too large")
+		return nil, nil, nil, errors.New("tls: NextProtos values too large")
 	}
 
 	supportedVersions := config.supportedVersions()
 	if len(supportedVersions) == 0 {
-		return nil, nil, errors.New("tls: no supported versions satisfy MinVersion and MaxVersion")
+		return nil, nil, nil, errors.New("tls: no supported versions satisfy MinVersion and MaxVersion")
+	}
+	if config.EncryptedClientHelloConfigList != nil {
+		if config.MinVersion != 0 && config.MinVersion < VersionTLS13 {
+			return nil, nil, nil, errors.New("tls: MinVersion must be >= VersionTLS13 if EncryptedClientHelloConfigList is populated")
+		}
+		if supportedVersions[0] != VersionTLS13 {
+			return nil, nil, nil, errors.New("tls: MaxVersion must be >= VersionTLS13 if EncryptedClientHelloConfigList is populated")
+		}
+		// ECH requires TLS 1.3, so don't offer anything else.
+		supportedVersions = supportedVersions[:1]
 	}
 
 	clientHelloVersion := config.maxSupportedVersion()
@@ -67,11 +79,10 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 		vers:                         clientHelloVersion,
 		compressionMethods:           []uint8{compressionNone},
 		random:                       make([]byte, 32),
-		sessionId:                    make([]byte, 32),
 		ocspStapling:                 true,
 		scts:                         true,
 		serverName:                   hostnameInSNI(config.ServerName),
-		supportedCurves:              config.curvePreferences(),
+		supportedCurves:              config.curvePreferences(supportedVersions[0]),
 		supportedPoints:              []uint8{pointFormatUncompressed},
 		secureRenegotiationSupported: true,
 		alpnProtocols:                config.NextProtos,
@@ -102,36 +113,82 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 
 	_, err := io.ReadFull(config.rand(), hello.random)
 	if err != nil {
-		return nil, nil, errors.New("tls: short read from Rand: " + err.Error())
+		return nil, nil, nil, errors.New("tls: short read from Rand: " + err.Error())
 	}
 
 	// A random session ID is used to detect when the server accepted a ticket
 	// and is resuming a session (see RFC 5077). In TLS 1.3, it's always set as
-	// a compatibility measure (see RFC 8446, Section 4.1.2).
-	if _, err := io.ReadFull(config.rand(), hello.sessionId); err != nil {
-		return nil, nil, errors.New("tls: short read from Rand: " + err.Error())
+	// a compatibility measure (see RFC 8446, Section 4.1.2), except on QUIC
+	// connections (see RFC 9001, Section 8.4).
+	if c.quic == nil {
+		hello.sessionId = make([]byte, 32)
+		if _, err := io.ReadFull(config.rand(), hello.sessionId); err != nil {
+			return nil, nil, nil, errors.New("tls: short read from Rand: " + err.Error())
+		}
 	}
 
 	if hello.vers >= VersionTLS12 {
 		hello.supportedSignatureAlgorithms = supportedSignatureAlgorithms
 	}
 
-	var params ecdheParameters
+	var keyShareKeys *keySharePrivateKeys
 	if hello.supportedVersions[0] == VersionTLS13 {
 		hello.cipherSuites = append(hello.cipherSuites, defaultCipherSuitesTLS13()...)
 
-		curveID := config.curvePreferences()[0]
-		if _, ok := curveForCurveID(curveID); curveID != X25519 && !ok {
-			return nil, nil, errors.New("tls: CurvePreferences includes unsupported curve")
+		curveID := hello.supportedCurves[0]
+		keyShareKeys, hello.keyShares, err = generateKeyShares(config.rand(), curveID,
+			config.supportsCurve(VersionTLS13, X25519))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if c.quic != nil {
+		p, err := c.quicGetTransportParameters()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if p == nil {
+			p = []byte{}
+		}
+		hello.quicTransportParameters = p
+	}
+
+	var ech *echClientContext
+	if config.EncryptedClientHelloConfigList != nil {
+		echConfigs, err := parseECHConfigList(config.EncryptedClientHelloConfigList)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		echConfig := pickECHConfig(echConfigs)
+		if echConfig == nil {
+			return nil, nil, nil, errors.New("tls: EncryptedClientHelloConfigList contains no valid configs")
+		}
+		ech = &echClientContext{config: echConfig}
+
+		// Mark hello as the inner ClientHello, and drop the extensions that
+		// only matter to TLS 1.2 and earlier.
+		hello.encryptedClientHello = []byte{echTypeInner}
+		hello.supportedPoints = nil
+		hello.secureRenegotiationSupported = false
+
+		echPK, err := hpke.ParseHPKEPublicKey(echConfig.KemID, echConfig.PublicKey)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		suite, err := pickECHCipherSuite(echConfig.SymmetricCipherSuite)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-		params, err = generateECDHEParameters(config.rand(), curveID)
+		ech.kdfID, ech.aeadID = suite.KDFID, suite.AEADID
+		info := append([]byte("tls ech\x00"), echConfig.raw...)
+		ech.encapsulatedKey, ech.hpkeContext, err = hpke.SetupSender(echConfig.KemID, suite.KDFID, suite.AEADID, echPK, info)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
 	}
 
-	return hello, params, nil
+	return hello, keyShareKeys, ech, nil
 }
 
 func (c *Conn) clientHandshake() (err error) {
@@ -143,13 +200,39 @@ func (c *Conn) clientHandshake() (err error) {
 	// need to be reset.
 	c.didResume = false
 
-	hello, ecdheParams, err := c.makeClientHello()
+	hello, keyShareKeys, ech, err := c.makeClientHello()
 	if err != nil {
 		return err
 	}
-	c.serverName = hello.serverName
 
 	cacheKey, session, earlySecret, binderKey := c.loadSession(hello)
+
+	if ech != nil {
+		// Split hello into the inner and outer ClientHello. The outer one
+		// carries the public name of the ECH config, a fresh random, no
+		// resumption state, and the encrypted inner ClientHello.
+		// See draft-ietf-tls-esni-18, Section 6.1.
+		ech.innerHello = hello
+		outer := *hello
+		outer.raw = nil
+		outer.serverName = string(ech.config.PublicName)
+		outer.random = make([]byte, 32)
+		if _, err := io.ReadFull(c.config.rand(), outer.random); err != nil {
+			return errors.New("tls: short read from Rand: " + err.Error())
+		}
+		outer.earlyData = false
+		outer.pskModes = nil
+		outer.pskIdentities = nil
+		outer.pskBinders = nil
+		outer.ticketSupported = false
+		outer.sessionTicket = nil
+		if err := computeAndUpdateOuterECHExtension(&outer, ech.innerHello, ech, true); err != nil {
+			return err
+		}
+		hello = &outer
+	}
+	c.serverName = hello.serverName
+
 	if cacheKey != "" && session != nil {
 		defer func() {
 			// If we got a handshake failure when resuming a session, throw away
@@ -168,6 +251,14 @@ func (c *Conn) clientHandshake() (err error) {
 		return err
 	}
 
+	if hello.earlyData {
+		suite := cipherSuiteTLS13ByID(session.cipherSuite)
+		transcript := suite.hash.New()
+		transcript.Write(hello.marshal())
+		earlyTrafficSecret := suite.deriveSecret(earlySecret, clientEarlyTrafficLabel, transcript)
+		c.quicSetWriteSecret(QUICEncryptionLevelEarly, suite.id, earlyTrafficSecret)
+	}
+
 	msg, err := c.readHandshake()
 	if err != nil {
 		return err
@@ -195,15 +286,21 @@ func (c *Conn) clientHandshake() (err error) {
 		return errors.New("tls: downgrade attempt detected, possibly due to a MitM attack or a broken middlebox")
 	}
 
+	if ech != nil && c.vers != VersionTLS13 {
+		c.sendAlert(alertProtocolVersion)
+		return errors.New("tls: server selected a version lower than TLS 1.3 while ECH was offered")
+	}
+
 	if c.vers == VersionTLS13 {
 		hs := &clientHandshakeStateTLS13{
-			c:           c,
-			serverHello: serverHello,
-			hello:       hello,
-			ecdheParams: ecdheParams,
-			session:     session,
-			earlySecret: earlySecret,
-			binderKey:   binderKey,
+			c:            c,
+			serverHello:  serverHello,
+			hello:        hello,
+			keyShareKeys: keyShareKeys,
+			session:      session,
+			earlySecret:  earlySecret,
+			binderKey:    binderKey,
+			echContext:   ech,
 		}
 
 		// In TLS 1.3, session tickets are delivered after the handshake.
@@ -224,14 +321,15 @@ func (c *Conn) clientHandshake() (err error) {
 	// If we had a successful handshake and hs.session is different from
 	// the one already cached - cache a new one.
 	if cacheKey != "" && hs.session != nil && session != hs.session {
-		c.config.ClientSessionCache.Put(cacheKey, hs.session)
+		cs := &ClientSessionState{ticket: hs.ticket, session: hs.session}
+		c.config.ClientSessionCache.Put(cacheKey, cs)
 	}
 
 	return nil
 }
 
 func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
-	session *ClientSessionState, earlySecret, binderKey []byte) {
+	session *SessionState, earlySecret, binderKey []byte) {
 	if c.config.SessionTicketsDisabled || c.config.ClientSessionCache == nil {
 		return "", nil, nil, nil
 	}
@@ -252,16 +350,17 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 	}
 
 	// Try to resume a previously negotiated TLS session, if available.
-	cacheKey = clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
-	session, ok := c.config.ClientSessionCache.Get(cacheKey)
-	if !ok || session == nil {
+	cacheKey = c.clientSessionCacheKey()
+	cs, ok := c.config.ClientSessionCache.Get(cacheKey)
+	if !ok || cs == nil || cs.session == nil {
 		return cacheKey, nil, nil, nil
 	}
+	session = cs.session
 
 	// Check that version used for the previous session is still valid.
 	versOk := false
 	for _, v := range hello.supportedVersions {
-		if v == session.vers {
+		if v == session.version {
 			versOk = true
 			break
 		}
@@ -278,7 +377,7 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 			// The original connection had InsecureSkipVerify, while this doesn't.
 			return cacheKey, nil, nil, nil
 		}
-		serverCert := session.serverCertificates[0]
+		serverCert := session.peerCertificates[0]
 		if c.config.time().After(serverCert.NotAfter) {
 			// Expired certificate, delete the entry.
 			c.config.ClientSessionCache.Put(cacheKey, nil)
@@ -289,19 +388,19 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 		}
 	}
 
-	if session.vers != VersionTLS13 {
+	if session.version != VersionTLS13 {
 		// In TLS 1.2 the cipher suite must match the resumed session. Ensure we
 		// are still offering it.
 		if mutualCipherSuite(hello.cipherSuites, session.cipherSuite) == nil {
 			return cacheKey, nil, nil, nil
 		}
 
-		hello.sessionTicket = session.sessionTicket
+		hello.sessionTicket = cs.ticket
 		return
 	}
 
 	// Check that the session ticket is not expired.
-	if c.config.time().After(session.useBy) {
+	if c.config.time().After(time.Unix(int64(session.useBy), 0)) {
 		c.config.ClientSessionCache.Put(cacheKey, nil)
 		return cacheKey, nil, nil, nil
 	}
@@ -324,19 +423,30 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 		return cacheKey, nil, nil, nil
 	}
 
+	// For 0-RTT, the cipher suite has to match exactly, and we need to be
+	// offering the same ALPN. Early data is not offered alongside ECH, as
+	// the outer ClientHello can't carry the PSK.
+	if c.quic != nil && session.EarlyData && c.config.EncryptedClientHelloConfigList == nil &&
+		mutualCipherSuiteTLS13(hello.cipherSuites, session.cipherSuite) != nil {
+		for _, alpn := range hello.alpnProtocols {
+			if alpn == session.alpnProtocol {
+				hello.earlyData = true
+				break
+			}
+		}
+	}
+
 	// Set the pre_shared_key extension. See RFC 8446, Section 4.2.11.1.
-	ticketAge := uint32(c.config.time().Sub(session.receivedAt) / time.Millisecond)
+	ticketAge := c.config.time().Sub(time.Unix(int64(session.createdAt), 0))
 	identity := pskIdentity{
-		label:               session.sessionTicket,
-		obfuscatedTicketAge: ticketAge + session.ageAdd,
+		label:               cs.ticket,
+		obfuscatedTicketAge: uint32(ticketAge/time.Millisecond) + session.ageAdd,
 	}
 	hello.pskIdentities = []pskIdentity{identity}
 	hello.pskBinders = [][]byte{make([]byte, cipherSuite.hash.Size())}
 
 	// Compute the PSK binders. See RFC 8446, Section 4.2.11.2.
-	psk := cipherSuite.expandLabel(session.masterSecret, "resumption",
-		session.nonce, cipherSuite.hash.Size())
-	earlySecret = cipherSuite.extract(psk, nil)
+	earlySecret = cipherSuite.extract(session.secret, nil)
 	binderKey = cipherSuite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
 	transcript := cipherSuite.hash.New()
 	transcript.Write(hello.marshalWithoutBinders())
@@ -719,7 +829,7 @@ func (hs *clientHandshakeState) processServerHello() (bool, error) {
 		return false, nil
 	}
 
-	if hs.session.vers != c.vers {
+	if hs.session.version != c.vers {
 		c.sendAlert(alertHandshakeFailure)
 		return false, errors.New("tls: server resumed a session with a different version")
 	}
@@ -730,8 +840,8 @@ func (hs *clientHandshakeState) processServerHello() (bool, error) {
 	}
 
 	// Restore masterSecret, peerCerts, and ocspResponse from previous state
-	hs.masterSecret = hs.session.masterSecret
-	c.peerCertificates = hs.session.serverCertificates
+	hs.masterSecret = hs.session.secret
+	c.peerCertificates = hs.session.peerCertificates
 	c.verifiedChains = hs.session.verifiedChains
 	c.ocspResponse = hs.session.ocspResponse
 	// Let the ServerHello SCTs override the session SCTs from the original
@@ -788,17 +898,9 @@ func (hs *clientHandshakeState) readSessionTicket() error {
 	}
 	hs.finishedHash.Write(sessionTicketMsg.marshal())
 
-	hs.session = &ClientSessionState{
-		sessionTicket:      sessionTicketMsg.ticket,
-		vers:               c.vers,
-		cipherSuite:        hs.suite.id,
-		masterSecret:       hs.masterSecret,
-		serverCertificates: c.peerCertificates,
-		verifiedChains:     c.verifiedChains,
-		receivedAt:         c.config.time(),
-		ocspResponse:       c.ocspResponse,
-		scts:               c.scts,
-	}
+	hs.session = c.sessionState()
+	hs.session.secret = hs.masterSecret
+	hs.ticket = sessionTicketMsg.ticket
 
 	return nil
 }
@@ -833,20 +935,39 @@ func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
 		certs[i] = cert
 	}
 
-	if !c.config.InsecureSkipVerify {
+	// If ECH was rejected, the certificate must be valid for the public name
+	// of the ECH config, which c.serverName holds at this point. It's only
+	// used to authenticate the retry configs, so the usual verification
+	// settings and callbacks don't apply. See draft-ietf-tls-esni-18,
+	// Section 6.1.7.
+	echRejected := c.config.EncryptedClientHelloConfigList != nil && !c.echAccepted
+	verify := !c.config.InsecureSkipVerify
+	dnsName := c.config.ServerName
+	if echRejected {
+		verify = c.config.EncryptedClientHelloRejectionVerify == nil
+		dnsName = c.serverName
+	}
+	if verify {
 		opts := x509.VerifyOptions{
 			Roots:         c.config.RootCAs,
 			CurrentTime:   c.config.time(),
-			DNSName:       c.config.ServerName,
+			DNSName:       dnsName,
 			Intermediates: x509.NewCertPool(),
 		}
 		for _, cert := range certs[1:] {
 			opts.Intermediates.AddCert(cert)
 		}
+		if c.ocspResponse != nil {
+			opts.OCSPResponses = [][]byte{c.ocspResponse}
+		}
 		var err error
 		c.verifiedChains, err = certs[0].Verify(opts)
 		if err != nil {
-			c.sendAlert(alertBadCertificate)
+			if invalidErr, ok := err.(x509.CertificateInvalidError); ok && invalidErr.Reason == x509.Revoked {
+				c.sendAlert(alertCertificateRevoked)
+			} else {
+				c.sendAlert(alertBadCertificate)
+			}
 			return err
 		}
 	}
@@ -861,6 +982,16 @@ func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
 
 	c.peerCertificates = certs
 
+	if echRejected {
+		if c.config.EncryptedClientHelloRejectionVerify != nil {
+			if err := c.config.EncryptedClientHelloRejectionVerify(c.connectionStateLocked()); err != nil {
+				c.sendAlert(alertBadCertificate)
+				return err
+			}
+		}
+		return nil
+	}
+
 	if c.config.VerifyPeerCertificate != nil {
 		if err := c.config.VerifyPeerCertificate(certificates, c.verifiedChains); err != nil {
 			c.sendAlert(alertBadCertificate)
@@ -961,11 +1092,15 @@ func (c *Conn) getClientCertificate(cri *CertificateRequestInfo) (*Certificate,
 
 // clientSessionCacheKey returns a key used to cache sessionTickets that could
 // be used to resume previously negotiated TLS sessions with a server.
-func clientSessionCacheKey(serverAddr net.Addr, config *Config) string {
-	if len(config.ServerName) > 0 {
-		return config.ServerName
+func (c *Conn) clientSessionCacheKey() string {
+	if len(c.config.ServerName) > 0 {
+		return c.config.ServerName
+	}
+	// QUIC connections have no underlying net.Conn.
+	if c.conn != nil {
+		return c.conn.RemoteAddr().String()
 	}
-	return serverAddr.String()
+	return ""
 }
 
 // mutualProtocol finds the mutual ALPN protocol given list of possible
@@ -6,8 +6,13 @@ package tls
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/ocsp"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/pem"
@@ -914,14 +919,14 @@ func testResumption(t *testing.T, version uint16) {
 	}
 
 	getTicket := func() []byte {
-		return clientConfig.ClientSessionCache.(*lruSessionCache).q.Front().Value.(*lruSessionCacheEntry).state.sessionTicket
+		return clientConfig.ClientSessionCache.(*lruSessionCache).q.Front().Value.(*lruSessionCacheEntry).state.ticket
 	}
 	deleteTicket := func() {
 		ticketKey := clientConfig.ClientSessionCache.(*lruSessionCache).q.Front().Value.(*lruSessionCacheEntry).sessionKey
 		clientConfig.ClientSessionCache.Put(ticketKey, nil)
 	}
 	corruptTicket := func() {
-		clientConfig.ClientSessionCache.(*lruSessionCache).q.Front().Value.(*lruSessionCacheEntry).state.masterSecret[0] ^= 0xff
+		clientConfig.ClientSessionCache.(*lruSessionCache).q.Front().Value.(*lruSessionCacheEntry).state.session.secret[0] ^= 0xff
 	}
 	randomKey := func() [32]byte {
 		var k [32]byte
@@ -934,10 +939,7 @@ func testResumption(t *testing.T, version uint16) {
 	testResumeState("Handshake", false)
 	ticket := getTicket()
 	testResumeState("Resume", true)
-	if !bytes.Equal(ticket, getTicket()) && version != VersionTLS13 {
-		t.Fatal("first ticket doesn't match ticket after resumption")
-	}
-	if bytes.Equal(ticket, getTicket()) && version == VersionTLS13 {
+	if bytes.Equal(ticket, getTicket()) {
 		t.Fatal("ticket didn't change after resumption")
 	}
 
@@ -984,9 +986,11 @@ func testResumption(t *testing.T, version uint16) {
 
 	// Age the session ticket a bit at a time, but don't expire it.
 	d := 0 * time.Hour
+	serverConfig.Time = func() time.Time { return time.Now().Add(d) }
+	deleteTicket()
+	testResumeState("GetFreshSessionTicket", false)
 	for i := 0; i < 13; i++ {
 		d += 12 * time.Hour
-		serverConfig.Time = func() time.Time { return time.Now().Add(d) }
 		testResumeState("OldSessionTicket", true)
 	}
 	// Expire it (now a little more than 7 days) and make sure a full
@@ -994,7 +998,6 @@ func testResumption(t *testing.T, version uint16) {
 	// TLS 1.3 since the client should be using a fresh ticket sent over
 	// by the server.
 	d += 12 * time.Hour
-	serverConfig.Time = func() time.Time { return time.Now().Add(d) }
 	if version == VersionTLS13 {
 		testResumeState("ExpiredSessionTicket", true)
 	} else {
@@ -1049,6 +1052,171 @@ func testResumption(t *testing.T, version uint16) {
 	testResumeState("WithoutSessionCache", false)
 }
 
+func TestSessionTicketHooks(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testSessionTicketHooks(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testSessionTicketHooks(t, VersionTLS13) })
+}
+
+func testSessionTicketHooks(t *testing.T, version uint16) {
+	issuer, err := x509.ParseCertificate(testRSACertificateIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(issuer)
+
+	clientConfig := &Config{
+		MaxVersion:         version,
+		ClientSessionCache: NewLRUClientSessionCache(32),
+		RootCAs:            rootCAs,
+		ServerName:         "example.golang",
+		Time:               func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	serverConfig := testConfig.Clone()
+	serverConfig.MaxVersion = version
+
+	var wrapped, unwrapped int
+	serverConfig.WrapSession = func(cs ConnectionState, ss *SessionState) ([]byte, error) {
+		wrapped++
+		ss.Extra = append(ss.Extra, []byte("authz"))
+		return serverConfig.EncryptTicket(cs, ss)
+	}
+	serverConfig.UnwrapSession = func(identity []byte, cs ConnectionState) (*SessionState, error) {
+		ss, err := serverConfig.DecryptTicket(identity, cs)
+		if ss == nil || err != nil {
+			return ss, err
+		}
+		unwrapped++
+		if len(ss.Extra) != 1 || string(ss.Extra[0]) != "authz" {
+			t.Errorf("unexpected Extra in unwrapped session: %q", ss.Extra)
+		}
+		return ss, nil
+	}
+
+	if _, cs, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	} else if cs.DidResume {
+		t.Fatal("first handshake resumed")
+	}
+	if wrapped != 1 || unwrapped != 0 {
+		t.Fatalf("after first handshake: wrapped %d, unwrapped %d; want 1, 0", wrapped, unwrapped)
+	}
+	if _, cs, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	} else if !cs.DidResume {
+		t.Fatal("second handshake did not resume")
+	}
+	if wrapped != 2 || unwrapped != 1 {
+		t.Fatalf("after second handshake: wrapped %d, unwrapped %d; want 2, 1", wrapped, unwrapped)
+	}
+
+	// An UnwrapSession error aborts the handshake.
+	serverConfig.UnwrapSession = func([]byte, ConnectionState) (*SessionState, error) {
+		return nil, errors.New("unwrap failed")
+	}
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err == nil {
+		t.Fatal("handshake succeeded despite UnwrapSession error")
+	}
+}
+
+// serializingSessionCache is a ClientSessionCache that stores sessions in
+// their serialized form, as an application persisting them would.
+type serializingSessionCache struct {
+	tickets, states map[string][]byte
+}
+
+func (c *serializingSessionCache) Get(sessionKey string) (*ClientSessionState, bool) {
+	ticket, ok := c.tickets[sessionKey]
+	if !ok {
+		return nil, false
+	}
+	state, err := ParseSessionState(c.states[sessionKey])
+	if err != nil {
+		return nil, false
+	}
+	cs, err := NewResumptionState(ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return cs, true
+}
+
+func (c *serializingSessionCache) Put(sessionKey string, cs *ClientSessionState) {
+	ticket, state, err := cs.ResumptionState()
+	if err != nil || state == nil {
+		delete(c.tickets, sessionKey)
+		delete(c.states, sessionKey)
+		return
+	}
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	c.tickets[sessionKey] = ticket
+	c.states[sessionKey] = stateBytes
+}
+
+func TestResumptionStatePersistence(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testResumptionStatePersistence(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testResumptionStatePersistence(t, VersionTLS13) })
+}
+
+func testResumptionStatePersistence(t *testing.T, version uint16) {
+	issuer, err := x509.ParseCertificate(testRSACertificateIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(issuer)
+
+	cache := &serializingSessionCache{
+		tickets: make(map[string][]byte),
+		states:  make(map[string][]byte),
+	}
+	clientConfig := &Config{
+		MaxVersion:         version,
+		ClientSessionCache: cache,
+		RootCAs:            rootCAs,
+		ServerName:         "example.golang",
+		Time:               func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	serverConfig := testConfig.Clone()
+	serverConfig.MaxVersion = version
+
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if len(cache.states) != 1 {
+		t.Fatalf("cache holds %d sessions after handshake, want 1", len(cache.states))
+	}
+
+	// A different client, sharing only the serialized cache contents, can
+	// resume the session.
+	clientConfig = clientConfig.Clone()
+	_, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if !cs.DidResume {
+		t.Fatal("handshake did not resume from the serialized session")
+	}
+	if len(cs.PeerCertificates) == 0 || len(cs.VerifiedChains) == 0 {
+		t.Error("resumed connection is missing the peer certificates or verified chains")
+	}
+
+	// Server sessions can't be used by clients.
+	for _, b := range cache.states {
+		state, err := ParseSessionState(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.isClient = false
+		if _, err := NewResumptionState(nil, state); err == nil {
+			t.Error("NewResumptionState accepted a server session")
+		}
+	}
+}
+
 func TestLRUClientSessionCache(t *testing.T) {
 	// Initialize cache of capacity 4.
 	cache := NewLRUClientSessionCache(4)
@@ -2511,3 +2679,93 @@ func testResumptionKeepsOCSPAndSCT(t *testing.T, ver uint16) {
 			serverConfig.Certificates[0].SignedCertificateTimestamps, ccs.SignedCertificateTimestamps)
 	}
 }
+
+func TestRevokedOCSPStaple(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testRevokedOCSPStaple(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testRevokedOCSPStaple(t, VersionTLS13) })
+}
+
+func testRevokedOCSPStaple(t *testing.T, ver uint16) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.golang"},
+		DNSNames:     []string{"example.golang"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staple := func(status int) []byte {
+		der, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: leafTmpl.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientConfig := &Config{
+		MaxVersion: ver,
+		ServerName: "example.golang",
+		RootCAs:    roots,
+	}
+	serverConfig := &Config{
+		MaxVersion: ver,
+		Certificates: []Certificate{{
+			Certificate: [][]byte{leafDER},
+			PrivateKey:  key,
+			OCSPStaple:  staple(ocsp.Good),
+		}},
+	}
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake with a good staple failed: %v", err)
+	}
+
+	serverConfig.Certificates[0].OCSPStaple = staple(ocsp.Revoked)
+	_, _, err = testHandshake(t, clientConfig, serverConfig)
+	if err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("handshake with a revoked staple: got error %v, want a revocation error", err)
+	}
+
+	clientConfig.InsecureSkipVerify = true
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake with InsecureSkipVerify failed: %v", err)
+	}
+}
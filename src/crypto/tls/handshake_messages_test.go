@@ -6,6 +6,8 @@ package tls
 
 import (
 	"bytes"
+	"crypto/x509"
+	"math"
 	"math/rand"
 	"reflect"
 	"strings"
@@ -27,8 +29,7 @@ var tests = []interface{}{
 	&certificateStatusMsg{},
 	&clientKeyExchangeMsg{},
 	&newSessionTicketMsg{},
-	&sessionState{},
-	&sessionStateTLS13{},
+	&SessionState{},
 	&encryptedExtensionsMsg{},
 	&endOfEarlyDataMsg{},
 	&keyUpdateMsg{},
@@ -190,6 +191,12 @@ func (*clientHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	if rand.Intn(10) > 5 {
 		m.earlyData = true
 	}
+	if rand.Intn(10) > 5 {
+		m.quicTransportParameters = randomBytes(rand.Intn(500), rand)
+	}
+	if rand.Intn(10) > 5 {
+		m.encryptedClientHello = randomBytes(rand.Intn(500)+1, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -239,6 +246,9 @@ func (*serverHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 		m.selectedIdentityPresent = true
 		m.selectedIdentity = uint16(rand.Intn(0xffff))
 	}
+	if rand.Intn(10) > 5 {
+		m.encryptedClientHello = randomBytes(8, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -249,6 +259,15 @@ func (*encryptedExtensionsMsg) Generate(rand *rand.Rand, size int) reflect.Value
 	if rand.Intn(10) > 5 {
 		m.alpnProtocol = randomString(rand.Intn(32)+1, rand)
 	}
+	if rand.Intn(10) > 5 {
+		m.quicTransportParameters = randomBytes(rand.Intn(500), rand)
+	}
+	if rand.Intn(10) > 5 {
+		m.earlyData = true
+	}
+	if rand.Intn(10) > 5 {
+		m.echRetryConfigs = randomBytes(rand.Intn(500)+1, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -304,39 +323,79 @@ func (*newSessionTicketMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	return reflect.ValueOf(m)
 }
 
-func (*sessionState) Generate(rand *rand.Rand, size int) reflect.Value {
-	s := &sessionState{}
-	s.vers = uint16(rand.Intn(10000))
-	s.cipherSuite = uint16(rand.Intn(10000))
-	s.masterSecret = randomBytes(rand.Intn(100)+1, rand)
-	s.createdAt = uint64(rand.Int63())
-	for i := 0; i < rand.Intn(20); i++ {
-		s.certificates = append(s.certificates, randomBytes(rand.Intn(500)+1, rand))
+func (s *SessionState) marshal() []byte {
+	b, err := s.Bytes()
+	if err != nil {
+		panic(err)
 	}
-	return reflect.ValueOf(s)
+	return b
 }
 
-func (*sessionStateTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
-	s := &sessionStateTLS13{}
-	s.cipherSuite = uint16(rand.Intn(10000))
-	s.resumptionSecret = randomBytes(rand.Intn(100)+1, rand)
+func (s *SessionState) unmarshal(b []byte) bool {
+	ss, err := ParseSessionState(b)
+	if err != nil {
+		return false
+	}
+	*s = *ss
+	return true
+}
+
+func (*SessionState) Generate(rand *rand.Rand, size int) reflect.Value {
+	s := &SessionState{}
+	isTLS13 := rand.Intn(10) > 5
+	if isTLS13 {
+		s.version = VersionTLS13
+	} else {
+		s.version = uint16(rand.Intn(VersionTLS13))
+	}
+	s.isClient = rand.Intn(10) > 5
+	s.cipherSuite = uint16(rand.Intn(math.MaxUint16))
 	s.createdAt = uint64(rand.Int63())
-	for i := 0; i < rand.Intn(2)+1; i++ {
-		s.certificate.Certificate = append(
-			s.certificate.Certificate, randomBytes(rand.Intn(500)+1, rand))
+	s.secret = randomBytes(rand.Intn(100)+1, rand)
+	for n, i := rand.Intn(3), 0; i < n; i++ {
+		s.Extra = append(s.Extra, randomBytes(rand.Intn(100), rand))
 	}
 	if rand.Intn(10) > 5 {
-		s.certificate.OCSPStaple = randomBytes(rand.Intn(100)+1, rand)
+		s.EarlyData = true
+		s.alpnProtocol = randomString(rand.Intn(32), rand)
 	}
 	if rand.Intn(10) > 5 {
 		for i := 0; i < rand.Intn(2)+1; i++ {
-			s.certificate.SignedCertificateTimestamps = append(
-				s.certificate.SignedCertificateTimestamps, randomBytes(rand.Intn(500)+1, rand))
+			s.peerCertificates = append(s.peerCertificates, generateTestCert(rand))
 		}
+		if rand.Intn(10) > 5 {
+			s.ocspResponse = randomBytes(rand.Intn(100)+1, rand)
+		}
+		if rand.Intn(10) > 5 {
+			for i := 0; i < rand.Intn(2)+1; i++ {
+				s.scts = append(s.scts, randomBytes(rand.Intn(500)+1, rand))
+			}
+		}
+		for i := 0; i < rand.Intn(3); i++ {
+			chain := []*x509.Certificate{s.peerCertificates[0]}
+			for j := 0; j < rand.Intn(3); j++ {
+				chain = append(chain, generateTestCert(rand))
+			}
+			s.verifiedChains = append(s.verifiedChains, chain)
+		}
+	}
+	if s.isClient && isTLS13 {
+		s.useBy = uint64(rand.Int63())
+		s.ageAdd = uint32(rand.Int63() & math.MaxUint32)
 	}
 	return reflect.ValueOf(s)
 }
 
+// generateTestCert returns one of the test certificates, parsed.
+func generateTestCert(rand *rand.Rand) *x509.Certificate {
+	certs := [][]byte{testRSACertificate, testRSACertificateIssuer, testECDSACertificate, testEd25519Certificate}
+	cert, err := x509.ParseCertificate(certs[rand.Intn(len(certs))])
+	if err != nil {
+		panic(err)
+	}
+	return cert
+}
+
 func (*endOfEarlyDataMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	m := &endOfEarlyDataMsg{}
 	return reflect.ValueOf(m)
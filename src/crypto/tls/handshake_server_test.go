@@ -39,7 +39,7 @@ func testClientHelloFailure(t *testing.T, serverConfig *Config, m handshakeMessa
 		c.Close()
 	}()
 	conn := Server(s, serverConfig)
-	ch, err := conn.readClientHello()
+	ch, _, err := conn.readClientHello()
 	hs := serverHandshakeState{
 		c:           conn,
 		clientHello: ch,
@@ -1421,7 +1421,7 @@ func TestSNIGivenOnFailure(t *testing.T) {
 		c.Close()
 	}()
 	conn := Server(s, serverConfig)
-	ch, err := conn.readClientHello()
+	ch, _, err := conn.readClientHello()
 	hs := serverHandshakeState{
 		c:           conn,
 		clientHello: ch,
@@ -173,3 +173,111 @@ func TestExtract(t *testing.T) {
 		})
 	}
 }
+
+func TestHybridKeyExchange(t *testing.T) {
+	tests := []struct {
+		name          string
+		clientCurves  []CurveID
+		serverCurves  []CurveID
+		expectedCurve CurveID
+		expectHRR     bool
+	}{
+		{
+			name:          "Hybrid",
+			clientCurves:  []CurveID{X25519MLKEM768, X25519},
+			serverCurves:  []CurveID{X25519MLKEM768, X25519},
+			expectedCurve: X25519MLKEM768,
+		},
+		{
+			name:          "ServerDefault",
+			clientCurves:  []CurveID{X25519MLKEM768, X25519},
+			expectedCurve: X25519,
+		},
+		{
+			name:          "ServerPrefersX25519",
+			clientCurves:  []CurveID{X25519MLKEM768, X25519},
+			serverCurves:  []CurveID{X25519, X25519MLKEM768},
+			expectedCurve: X25519,
+		},
+		{
+			name:          "HelloRetryRequestHybrid",
+			clientCurves:  []CurveID{X25519, X25519MLKEM768},
+			serverCurves:  []CurveID{X25519MLKEM768},
+			expectedCurve: X25519MLKEM768,
+			expectHRR:     true,
+		},
+		{
+			name:          "HelloRetryRequestFromHybrid",
+			clientCurves:  []CurveID{X25519MLKEM768, CurveP256},
+			serverCurves:  []CurveID{CurveP256},
+			expectedCurve: CurveP256,
+			expectHRR:     true,
+		},
+		{
+			name:          "KeySharePreferred",
+			clientCurves:  []CurveID{CurveP256, X25519MLKEM768},
+			serverCurves:  []CurveID{X25519MLKEM768, CurveP256},
+			expectedCurve: CurveP256,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientConfig := testConfig.Clone()
+			clientConfig.MinVersion = VersionTLS13
+			clientConfig.CurvePreferences = test.clientCurves
+			serverConfig := testConfig.Clone()
+			serverConfig.CurvePreferences = test.serverCurves
+			serverState, clientState, err := testHandshake(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, state := range []ConnectionState{serverState, clientState} {
+				if state.testingOnlyCurveID != test.expectedCurve {
+					t.Errorf("got curve %v, expected %v", state.testingOnlyCurveID, test.expectedCurve)
+				}
+				if state.testingOnlyDidHRR != test.expectHRR {
+					t.Errorf("got HelloRetryRequest %v, expected %v", state.testingOnlyDidHRR, test.expectHRR)
+				}
+			}
+		})
+	}
+}
+
+func TestHybridKeyExchangeTLS12(t *testing.T) {
+	clientConfig := testConfig.Clone()
+	clientConfig.MaxVersion = VersionTLS12
+	clientConfig.CurvePreferences = []CurveID{X25519MLKEM768, CurveP256}
+	serverConfig := testConfig.Clone()
+	serverConfig.CurvePreferences = []CurveID{X25519MLKEM768, CurveP256}
+	serverConfig.GetConfigForClient = func(chi *ClientHelloInfo) (*Config, error) {
+		for _, curve := range chi.SupportedCurves {
+			if curve == X25519MLKEM768 {
+				t.Errorf("TLS 1.2 client offered %v", curve)
+			}
+		}
+		return nil, nil
+	}
+	serverState, _, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverState.Version != VersionTLS12 {
+		t.Errorf("got version %x, expected TLS 1.2", serverState.Version)
+	}
+
+	// A TLS 1.2 server can't use the hybrid group even if the client offers
+	// it, so a server that only supports it can't use ECDHE.
+	clientConfig = testConfig.Clone()
+	clientConfig.CurvePreferences = []CurveID{X25519MLKEM768, CurveP256}
+	clientConfig.CipherSuites = []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+	serverConfig = testConfig.Clone()
+	serverConfig.MaxVersion = VersionTLS12
+	serverConfig.CurvePreferences = []CurveID{X25519MLKEM768}
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err == nil {
+		t.Error("TLS 1.2 handshake succeeded with only X25519MLKEM768 enabled on the server")
+	}
+	serverConfig.CurvePreferences = []CurveID{X25519MLKEM768, CurveP256}
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err != nil {
+		t.Error(err)
+	}
+}
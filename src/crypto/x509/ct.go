@@ -0,0 +1,335 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// oidExtensionSCTList is the extension carrying the SCTs embedded in a
+// certificate. See RFC 6962, Section 3.3.
+var oidExtensionSCTList = []int{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// A SignedCertificateTimestamp is a promise by a Certificate Transparency
+// log to incorporate a certificate in its public log. See RFC 6962, Section
+// 3.2.
+type SignedCertificateTimestamp struct {
+	Raw []byte // Complete TLS encoding of the SCT.
+
+	// Version is the version of the SCT structure. Only version 1 (encoded
+	// as zero) is supported.
+	Version uint8
+	// LogID is the SHA-256 hash of the log's DER-encoded public key.
+	LogID [sha256.Size]byte
+	// Timestamp is the time at which the log issued the SCT, in
+	// millisecond precision.
+	Timestamp  time.Time
+	Extensions []byte
+
+	// HashAlgorithm and SignatureAlgorithm are the TLS HashAlgorithm and
+	// SignatureAlgorithm codepoints identifying how Signature was made.
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// A CTLog is a Certificate Transparency log trusted to issue SCTs.
+type CTLog struct {
+	// Description is a human-readable name for the log, used in errors.
+	Description string
+	// PublicKey is the log's public key, which must be an *ecdsa.PublicKey
+	// or an *rsa.PublicKey.
+	PublicKey crypto.PublicKey
+}
+
+// ID returns the log ID, the SHA-256 hash of the log's DER-encoded public
+// key, that identifies the log in the SCTs it issues.
+func (log *CTLog) ID() ([sha256.Size]byte, error) {
+	der, err := MarshalPKIXPublicKey(log.PublicKey)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(der), nil
+}
+
+// The TLS codepoints used in SCT signatures. See RFC 5246, Section 7.4.1.4.1.
+const (
+	sctHashSHA256 = 4
+
+	sctSignatureRSA   = 1
+	sctSignatureECDSA = 3
+)
+
+// ParseSignedCertificateTimestamp parses a single TLS-encoded SCT, as found
+// in the signed_certificate_timestamp TLS extension.
+func ParseSignedCertificateTimestamp(data []byte) (*SignedCertificateTimestamp, error) {
+	sct := &SignedCertificateTimestamp{Raw: data}
+	s := cryptobyte.String(data)
+	var timestampHigh, timestampLow uint32
+	var extensions, signature cryptobyte.String
+	if !s.ReadUint8(&sct.Version) {
+		return nil, errors.New("x509: malformed SCT")
+	}
+	if sct.Version != 0 {
+		return nil, fmt.Errorf("x509: unsupported SCT version %d", sct.Version)
+	}
+	if !s.CopyBytes(sct.LogID[:]) ||
+		!s.ReadUint32(&timestampHigh) || !s.ReadUint32(&timestampLow) ||
+		!s.ReadUint16LengthPrefixed(&extensions) ||
+		!s.ReadUint8(&sct.HashAlgorithm) || !s.ReadUint8(&sct.SignatureAlgorithm) ||
+		!s.ReadUint16LengthPrefixed(&signature) || !s.Empty() {
+		return nil, errors.New("x509: malformed SCT")
+	}
+	ms := int64(timestampHigh)<<32 | int64(timestampLow)
+	if ms < 0 {
+		return nil, errors.New("x509: malformed SCT timestamp")
+	}
+	sct.Timestamp = time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+	sct.Extensions = extensions
+	sct.Signature = signature
+	return sct, nil
+}
+
+// SignedCertificateTimestamps parses the SCTs embedded in the certificate's
+// SCT list extension. It returns nil if the certificate has no such
+// extension.
+func (c *Certificate) SignedCertificateTimestamps() ([]*SignedCertificateTimestamp, error) {
+	for _, ext := range c.Extensions {
+		if !ext.Id.Equal(oidExtensionSCTList) {
+			continue
+		}
+		var list, scts cryptobyte.String
+		value := cryptobyte.String(ext.Value)
+		if !value.ReadASN1(&list, cryptobyte_asn1.OCTET_STRING) || !value.Empty() ||
+			!list.ReadUint16LengthPrefixed(&scts) || !list.Empty() {
+			return nil, errors.New("x509: malformed SCT list extension")
+		}
+		var out []*SignedCertificateTimestamp
+		for !scts.Empty() {
+			var raw cryptobyte.String
+			if !scts.ReadUint16LengthPrefixed(&raw) {
+				return nil, errors.New("x509: malformed SCT list extension")
+			}
+			sct, err := ParseSignedCertificateTimestamp(raw)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sct)
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+// CheckSignature verifies that sct was issued by log for cert.
+//
+// If issuer is nil, sct is checked as an SCT for cert itself, as delivered
+// in a TLS extension or in a stapled OCSP response. Otherwise, sct is checked
+// as an SCT embedded in cert, which was issued for the precertificate signed
+// by issuer. See RFC 6962, Section 3.2.
+func (sct *SignedCertificateTimestamp) CheckSignature(log *CTLog, cert, issuer *Certificate) error {
+	id, err := log.ID()
+	if err != nil {
+		return err
+	}
+	if id != sct.LogID {
+		return errors.New("x509: SCT was not issued by " + log.Description)
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(sct.Version)
+	b.AddUint8(0) // signature_type = certificate_timestamp
+	ms := uint64(sct.Timestamp.UnixNano() / int64(time.Millisecond))
+	b.AddUint32(uint32(ms >> 32))
+	b.AddUint32(uint32(ms))
+	if issuer == nil {
+		b.AddUint16(0) // entry_type = x509_entry
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cert.Raw)
+		})
+	} else {
+		tbs, err := precertificateTBS(cert.RawTBSCertificate)
+		if err != nil {
+			return err
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		b.AddUint16(1) // entry_type = precert_entry
+		b.AddBytes(issuerKeyHash[:])
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(tbs)
+		})
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.Extensions)
+	})
+	signed, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if sct.HashAlgorithm != sctHashSHA256 {
+		return fmt.Errorf("x509: unsupported SCT hash algorithm %d", sct.HashAlgorithm)
+	}
+	digest := sha256.Sum256(signed)
+	switch pub := log.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSignatureECDSA {
+			return errors.New("x509: SCT signature algorithm does not match the log key")
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], sct.Signature) {
+			return errors.New("x509: ECDSA verification failure for SCT from " + log.Description)
+		}
+		return nil
+	case *rsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSignatureRSA {
+			return errors.New("x509: SCT signature algorithm does not match the log key")
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sct.Signature)
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+// precertificateTBS returns the TBSCertificate of the precertificate that
+// tbs was issued from, by removing the SCT list extension from tbs. All
+// other fields are copied verbatim.
+func precertificateTBS(tbs []byte) ([]byte, error) {
+	input := cryptobyte.String(tbs)
+	var fields cryptobyte.String
+	if !input.ReadASN1(&fields, cryptobyte_asn1.SEQUENCE) || !input.Empty() {
+		return nil, errors.New("x509: malformed tbs certificate")
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !fields.Empty() {
+			var field cryptobyte.String
+			var tag cryptobyte_asn1.Tag
+			if !fields.ReadAnyASN1Element(&field, &tag) {
+				b.SetError(errors.New("x509: malformed tbs certificate"))
+				return
+			}
+			extensionsTag := cryptobyte_asn1.Tag(3).Constructed().ContextSpecific()
+			if tag != extensionsTag {
+				b.AddBytes(field)
+				continue
+			}
+
+			var exts cryptobyte.String
+			if !field.ReadASN1(&exts, extensionsTag) || !exts.ReadASN1(&exts, cryptobyte_asn1.SEQUENCE) {
+				b.SetError(errors.New("x509: malformed extensions"))
+				return
+			}
+			var kept [][]byte
+			for !exts.Empty() {
+				var ext cryptobyte.String
+				if !exts.ReadASN1Element(&ext, cryptobyte_asn1.SEQUENCE) {
+					b.SetError(errors.New("x509: malformed extension"))
+					return
+				}
+				extFields := ext
+				var id asn1.ObjectIdentifier
+				if !extFields.ReadASN1(&extFields, cryptobyte_asn1.SEQUENCE) ||
+					!extFields.ReadASN1ObjectIdentifier(&id) {
+					b.SetError(errors.New("x509: malformed extension"))
+					return
+				}
+				if id.Equal(oidExtensionSCTList) {
+					continue
+				}
+				kept = append(kept, ext)
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for _, ext := range kept {
+						b.AddBytes(ext)
+					}
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
+
+// filterCTChains removes from chains any chain for which the leaf isn't
+// covered by valid SCTs from at least opts.MinimumCTLogs distinct logs in
+// opts.CTLogs. If no chain is left, it returns the error for the first one.
+func filterCTChains(chains [][]*Certificate, opts *VerifyOptions) ([][]*Certificate, error) {
+	if opts.MinimumCTLogs <= 0 || len(chains) == 0 {
+		return chains, nil
+	}
+
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Malformed SCTs are ignored, like SCTs from unknown logs.
+	leaf := chains[0][0]
+	var delivered []*SignedCertificateTimestamp
+	for _, raw := range opts.SignedCertificateTimestamps {
+		if sct, err := ParseSignedCertificateTimestamp(raw); err == nil {
+			delivered = append(delivered, sct)
+		}
+	}
+	embedded, _ := leaf.SignedCertificateTimestamps()
+
+	logs := make(map[[sha256.Size]byte]*CTLog)
+	for _, log := range opts.CTLogs {
+		if id, err := log.ID(); err == nil {
+			logs[id] = log
+		}
+	}
+
+	var valid [][]*Certificate
+	var firstErr error
+	for _, chain := range chains {
+		seen := make(map[[sha256.Size]byte]bool)
+		check := func(sct *SignedCertificateTimestamp, issuer *Certificate) {
+			log := logs[sct.LogID]
+			if log == nil || seen[sct.LogID] || sct.Timestamp.After(now) {
+				return
+			}
+			if sct.CheckSignature(log, leaf, issuer) == nil {
+				seen[sct.LogID] = true
+			}
+		}
+		for _, sct := range delivered {
+			check(sct, nil)
+		}
+		// Embedded SCTs cover the precertificate, and can only be checked
+		// against the public key of the issuer in this chain.
+		if len(chain) > 1 {
+			for _, sct := range embedded {
+				check(sct, chain[1])
+			}
+		}
+
+		if len(seen) < opts.MinimumCTLogs {
+			if firstErr == nil {
+				firstErr = CertificateInvalidError{leaf, InsufficientSCTs,
+					fmt.Sprintf("valid SCTs from %d distinct logs, %d required", len(seen), opts.MinimumCTLogs)}
+			}
+			continue
+		}
+		valid = append(valid, chain)
+	}
+	if len(valid) == 0 {
+		return nil, firstErr
+	}
+	return valid, nil
+}
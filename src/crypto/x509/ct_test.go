@@ -0,0 +1,281 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// ctTestEnv is a CA issuing a leaf certificate with SCTs embedded by
+// embeddedLog, and SCTs for it from deliveredLog that can be passed to
+// Verify separately.
+type ctTestEnv struct {
+	now          time.Time
+	roots        *CertPool
+	ca           *Certificate
+	leaf         *Certificate
+	embeddedLog  *CTLog
+	deliveredLog *CTLog
+	delivered    []byte
+}
+
+// signTestSCT returns a TLS-encoded SCT from the log with key, for an entry
+// of entryType with the given contents.
+func signTestSCT(t *testing.T, key crypto.Signer, timestamp time.Time, entryType uint16, entry []byte) []byte {
+	t.Helper()
+	der, err := MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(der)
+	ms := uint64(timestamp.UnixNano() / int64(time.Millisecond))
+
+	var signed cryptobyte.Builder
+	signed.AddUint8(0)
+	signed.AddUint8(0)
+	signed.AddUint32(uint32(ms >> 32))
+	signed.AddUint32(uint32(ms))
+	signed.AddUint16(entryType)
+	signed.AddBytes(entry)
+	signed.AddUint16(0)
+	digest := sha256.Sum256(signed.BytesOrPanic())
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigAlg := uint8(sctSignatureECDSA)
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		sigAlg = sctSignatureRSA
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(0)
+	b.AddBytes(logID[:])
+	b.AddUint32(uint32(ms >> 32))
+	b.AddUint32(uint32(ms))
+	b.AddUint16(0)
+	b.AddUint8(sctHashSHA256)
+	b.AddUint8(sigAlg)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(signature)
+	})
+	return b.BytesOrPanic()
+}
+
+func newCTTestEnv(t *testing.T) *ctTestEnv {
+	env := &ctTestEnv{now: time.Now(), roots: NewCertPool()}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CT Test Root"},
+		NotBefore:             env.now.Add(-time.Hour),
+		NotAfter:              env.now.Add(time.Hour),
+		KeyUsage:              KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ca, err = ParseCertificate(caDER); err != nil {
+		t.Fatal(err)
+	}
+	env.roots.AddCert(env.ca)
+
+	embeddedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.embeddedLog = &CTLog{Description: "embedded log", PublicKey: embeddedKey.Public()}
+	deliveredKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.deliveredLog = &CTLog{Description: "delivered log", PublicKey: deliveredKey.Public()}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ct.example.com"},
+		DNSNames:     []string{"ct.example.com"},
+		NotBefore:    env.now.Add(-time.Hour),
+		NotAfter:     env.now.Add(time.Hour),
+		ExtKeyUsage:  []ExtKeyUsage{ExtKeyUsageServerAuth},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 5}, Value: []byte{0x05, 0x00}},
+		},
+	}
+
+	// Issue the precertificate first, which is what the log signs.
+	precertDER, err := CreateCertificate(rand.Reader, leafTemplate, env.ca, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerKeyHash := sha256.Sum256(env.ca.RawSubjectPublicKeyInfo)
+	var entry cryptobyte.Builder
+	entry.AddBytes(issuerKeyHash[:])
+	entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(precert.RawTBSCertificate)
+	})
+	embedded := signTestSCT(t, embeddedKey, env.now.Add(-time.Minute), 1, entry.BytesOrPanic())
+
+	var list cryptobyte.Builder
+	list.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(embedded)
+		})
+	})
+	extValue, err := asn1.Marshal(list.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Put the SCT list in the middle of the extensions, so that removing it
+	// isn't just truncation.
+	leafTemplate.ExtraExtensions = []pkix.Extension{
+		leafTemplate.ExtraExtensions[0],
+		{Id: oidExtensionSCTList, Value: extValue},
+		leafTemplate.ExtraExtensions[1],
+	}
+	leafDER, err := CreateCertificate(rand.Reader, leafTemplate, env.ca, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.leaf, err = ParseCertificate(leafDER); err != nil {
+		t.Fatal(err)
+	}
+
+	var x509Entry cryptobyte.Builder
+	x509Entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(env.leaf.Raw)
+	})
+	env.delivered = signTestSCT(t, deliveredKey, env.now.Add(-time.Minute), 0, x509Entry.BytesOrPanic())
+	return env
+}
+
+func TestSignedCertificateTimestamps(t *testing.T) {
+	env := newCTTestEnv(t)
+
+	scts, err := env.leaf.SignedCertificateTimestamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scts) != 1 {
+		t.Fatalf("got %d embedded SCTs, want 1", len(scts))
+	}
+	id, err := env.embeddedLog.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scts[0].LogID != id {
+		t.Errorf("embedded SCT has log ID %x, want %x", scts[0].LogID, id)
+	}
+	if want := env.now.Add(-time.Minute).Truncate(time.Millisecond); !scts[0].Timestamp.Equal(want) {
+		t.Errorf("embedded SCT has timestamp %v, want %v", scts[0].Timestamp, want)
+	}
+	if err := scts[0].CheckSignature(env.embeddedLog, env.leaf, env.ca); err != nil {
+		t.Errorf("embedded SCT: %v", err)
+	}
+	if err := scts[0].CheckSignature(env.embeddedLog, env.leaf, nil); err == nil {
+		t.Error("embedded SCT verified as an SCT for the final certificate")
+	}
+	if err := scts[0].CheckSignature(env.deliveredLog, env.leaf, env.ca); err == nil {
+		t.Error("embedded SCT verified with the wrong log")
+	}
+
+	sct, err := ParseSignedCertificateTimestamp(env.delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sct.CheckSignature(env.deliveredLog, env.leaf, nil); err != nil {
+		t.Errorf("delivered SCT: %v", err)
+	}
+	if err := sct.CheckSignature(env.deliveredLog, env.ca, nil); err == nil {
+		t.Error("delivered SCT verified for the wrong certificate")
+	}
+
+	if scts, err := env.ca.SignedCertificateTimestamps(); err != nil || scts != nil {
+		t.Errorf("certificate without SCTs: got %v, %v", scts, err)
+	}
+	for _, bad := range [][]byte{nil, env.delivered[:40], append(env.delivered[:len(env.delivered):len(env.delivered)], 0), {1}} {
+		if _, err := ParseSignedCertificateTimestamp(bad); err == nil {
+			t.Errorf("ParseSignedCertificateTimestamp(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestVerifyCTPolicy(t *testing.T) {
+	env := newCTTestEnv(t)
+	bothLogs := []*CTLog{env.embeddedLog, env.deliveredLog}
+
+	tests := []struct {
+		name      string
+		logs      []*CTLog
+		delivered [][]byte
+		minimum   int
+		now       time.Time
+		ok        bool
+	}{
+		{name: "NotEnforced", ok: true},
+		{name: "Embedded", logs: bothLogs, minimum: 1, ok: true},
+		{name: "Delivered", logs: []*CTLog{env.deliveredLog}, delivered: [][]byte{env.delivered}, minimum: 1, ok: true},
+		{name: "TwoLogs", logs: bothLogs, delivered: [][]byte{env.delivered}, minimum: 2, ok: true},
+		{name: "SameLogTwice", logs: bothLogs, delivered: [][]byte{env.delivered, env.delivered}, minimum: 3},
+		{name: "UnknownLog", logs: []*CTLog{env.deliveredLog}, minimum: 1},
+		{name: "NoLogs", delivered: [][]byte{env.delivered}, minimum: 1},
+		{name: "Malformed", logs: bothLogs, delivered: [][]byte{{1, 2, 3}}, minimum: 2},
+		{name: "FutureTimestamp", logs: bothLogs, delivered: [][]byte{env.delivered}, minimum: 1, now: env.now.Add(-time.Hour / 2)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := test.now
+			if now.IsZero() {
+				now = env.now
+			}
+			_, err := env.leaf.Verify(VerifyOptions{
+				DNSName:                     "ct.example.com",
+				Roots:                       env.roots,
+				CurrentTime:                 now,
+				CTLogs:                      test.logs,
+				SignedCertificateTimestamps: test.delivered,
+				MinimumCTLogs:               test.minimum,
+			})
+			if test.ok {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				return
+			}
+			invalidErr, ok := err.(CertificateInvalidError)
+			if !ok || invalidErr.Reason != InsufficientSCTs {
+				t.Fatalf("got error %v, want an InsufficientSCTs error", err)
+			}
+		})
+	}
+}
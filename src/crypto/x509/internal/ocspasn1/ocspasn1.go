@@ -0,0 +1,171 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ocspasn1 defines the ASN.1 structures of the Online Certificate
+// Status Protocol, as specified in RFC 6960. It is shared by crypto/x509,
+// which consults OCSP responses during verification, and crypto/x509/ocsp.
+package ocspasn1
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// OIDBasicResponse is the id-pkix-ocsp-basic response type.
+var OIDBasicResponse = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 5, 5, 7, 48, 1, 1})
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26}),
+	crypto.SHA256: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1}),
+	crypto.SHA384: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2}),
+	crypto.SHA512: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3}),
+}
+
+// HashOID returns the object identifier of h, or nil if h can't be used to
+// identify certificates in OCSP.
+func HashOID(h crypto.Hash) asn1.ObjectIdentifier {
+	return hashOIDs[h]
+}
+
+// HashFromOID returns the hash function identified by oid, or zero if it
+// is not supported.
+func HashFromOID(oid asn1.ObjectIdentifier) crypto.Hash {
+	for h, o := range hashOIDs {
+		if o.Equal(oid) {
+			return h
+		}
+	}
+	return 0
+}
+
+// CertID identifies a certificate by its issuer and serial number.
+type CertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+// Request is an OCSPRequest.
+type Request struct {
+	TBSRequest TBSRequest
+}
+
+// TBSRequest is the signed part of an OCSPRequest. Signed requests are not
+// supported.
+type TBSRequest struct {
+	Version       int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList   []SingleRequest
+}
+
+// SingleRequest is a Request for the status of a single certificate.
+type SingleRequest struct {
+	Cert CertID
+}
+
+// Response is an OCSPResponse.
+type Response struct {
+	Status   asn1.Enumerated
+	Response ResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+// ResponseBytes holds the encoded response of a given type.
+type ResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+// BasicResponse is a BasicOCSPResponse.
+type BasicResponse struct {
+	TBSResponseData    ResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// ResponseData is the signed part of a BasicOCSPResponse.
+type ResponseData struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []SingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// SingleResponse is the status of a single certificate. Exactly one of
+// Good, Revoked and Unknown is set.
+type SingleResponse struct {
+	CertID           CertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          RevokedInfo      `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// RevokedInfo describes the revocation of a certificate.
+type RevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// ResponderIDByName and ResponderIDByKey are the context-specific tags of
+// the two forms of ResponderID.
+const (
+	ResponderIDByName = 1
+	ResponderIDByKey  = 2
+)
+
+// ErrNotBasic is returned by ParseBasicResponse for successful responses
+// of a type other than id-pkix-ocsp-basic.
+var ErrNotBasic = errors.New("ocsp: response is not a basic OCSP response")
+
+// ParseBasicResponse parses a DER-encoded OCSPResponse. If the response
+// status is not successful, it returns the status and a nil response.
+func ParseBasicResponse(der []byte) (status asn1.Enumerated, basic *BasicResponse, err error) {
+	var resp Response
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rest) > 0 {
+		return 0, nil, errors.New("ocsp: trailing data in OCSP response")
+	}
+	if resp.Status != 0 {
+		return resp.Status, nil, nil
+	}
+	if !resp.Response.ResponseType.Equal(OIDBasicResponse) {
+		return 0, nil, ErrNotBasic
+	}
+	basic = new(BasicResponse)
+	rest, err = asn1.Unmarshal(resp.Response.Response, basic)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rest) > 0 {
+		return 0, nil, errors.New("ocsp: trailing data in OCSP basic response")
+	}
+	return 0, basic, nil
+}
+
+// SubjectPublicKey returns the contents of the subjectPublicKey BIT STRING
+// of a DER-encoded SubjectPublicKeyInfo, which is hashed to identify the
+// issuer of a certificate.
+func SubjectPublicKey(rawSPKI []byte) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(rawSPKI, &spki); err != nil {
+		return nil, err
+	}
+	return spki.PublicKey.RightAlign(), nil
+}
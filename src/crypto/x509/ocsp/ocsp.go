@@ -0,0 +1,660 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ocsp implements the Online Certificate Status Protocol, as
+// specified in RFC 6960. It can create OCSP requests, and create, parse and
+// verify OCSP responses, such as those stapled to TLS handshakes.
+package ocsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/internal/ocspasn1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// ResponseStatus contains the result of an OCSP request. See RFC 6960,
+// Section 4.2.1.
+type ResponseStatus int
+
+const (
+	Success       ResponseStatus = 0
+	Malformed     ResponseStatus = 1
+	InternalError ResponseStatus = 2
+	TryLater      ResponseStatus = 3
+	// Status code four is unused in OCSP.
+	SignatureRequired ResponseStatus = 5
+	Unauthorized      ResponseStatus = 6
+)
+
+func (r ResponseStatus) String() string {
+	switch r {
+	case Success:
+		return "success"
+	case Malformed:
+		return "malformed"
+	case InternalError:
+		return "internal error"
+	case TryLater:
+		return "try later"
+	case SignatureRequired:
+		return "signature required"
+	case Unauthorized:
+		return "unauthorized"
+	default:
+		return "unknown OCSP status: " + strconv.Itoa(int(r))
+	}
+}
+
+// ResponseError is an error that may be returned by ParseResponse to indicate
+// that the response itself is an error, not just that it's indicating that a
+// certificate is revoked, unknown, etc.
+type ResponseError struct {
+	Status ResponseStatus
+}
+
+func (r ResponseError) Error() string {
+	return "ocsp: error from server: " + r.Status.String()
+}
+
+// A ParseError results from an invalid OCSP request or response.
+type ParseError string
+
+func (p ParseError) Error() string {
+	return string(p)
+}
+
+// The status values that can be expressed in OCSP. See RFC 6960, Section
+// 2.2.
+const (
+	// Good means that the certificate is valid.
+	Good = iota
+	// Revoked means that the certificate has been deliberately revoked.
+	Revoked
+	// Unknown means that the OCSP responder doesn't know about the
+	// certificate.
+	Unknown
+	// ServerFailed is unused and was never used (see
+	// https://go-review.googlesource.com/#/c/18944). ParseResponse will
+	// return a ResponseError when an error response is parsed.
+	ServerFailed
+)
+
+// The enumerated reasons for revoking a certificate. See RFC 5280, Section
+// 5.3.1.
+const (
+	Unspecified          = 0
+	KeyCompromise        = 1
+	CACompromise         = 2
+	AffiliationChanged   = 3
+	Superseded           = 4
+	CessationOfOperation = 5
+	CertificateHold      = 6
+
+	RemoveFromCRL      = 8
+	PrivilegeWithdrawn = 9
+	AACompromise       = 10
+)
+
+var signatureAlgorithmDetails = []struct {
+	algo       x509.SignatureAlgorithm
+	oid        asn1.ObjectIdentifier
+	pubKeyAlgo x509.PublicKeyAlgorithm
+	hash       crypto.Hash
+}{
+	{x509.SHA1WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.RSA, crypto.SHA1},
+	{x509.SHA256WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.RSA, crypto.SHA256},
+	{x509.SHA384WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.RSA, crypto.SHA384},
+	{x509.SHA512WithRSA, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.RSA, crypto.SHA512},
+	{x509.ECDSAWithSHA1, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSA, crypto.SHA1},
+	{x509.ECDSAWithSHA256, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSA, crypto.SHA256},
+	{x509.ECDSAWithSHA384, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSA, crypto.SHA384},
+	{x509.ECDSAWithSHA512, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSA, crypto.SHA512},
+	{x509.PureEd25519, asn1.ObjectIdentifier{1, 3, 101, 112}, x509.Ed25519, crypto.Hash(0)},
+}
+
+func getSignatureAlgorithmFromOID(oid asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	for _, details := range signatureAlgorithmDetails {
+		if oid.Equal(details.oid) {
+			return details.algo
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// signingParamsForPublicKey returns the parameters to use for signing with
+// priv. If requestedSigAlgo is not zero then it overrides the default
+// signature algorithm.
+func signingParamsForPublicKey(pub crypto.PublicKey, requestedSigAlgo x509.SignatureAlgorithm) (hashFunc crypto.Hash, sigAlgo pkix.AlgorithmIdentifier, err error) {
+	var pubType x509.PublicKeyAlgorithm
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		pubType = x509.RSA
+		hashFunc = crypto.SHA256
+		sigAlgo.Algorithm = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+		sigAlgo.Parameters = asn1.NullRawValue
+
+	case *ecdsa.PublicKey:
+		pubType = x509.ECDSA
+
+		switch pub.Curve {
+		case elliptic.P224(), elliptic.P256():
+			hashFunc = crypto.SHA256
+			sigAlgo.Algorithm = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+		case elliptic.P384():
+			hashFunc = crypto.SHA384
+			sigAlgo.Algorithm = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+		case elliptic.P521():
+			hashFunc = crypto.SHA512
+			sigAlgo.Algorithm = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+		default:
+			err = errors.New("ocsp: unknown elliptic curve")
+		}
+
+	case ed25519.PublicKey:
+		pubType = x509.Ed25519
+		sigAlgo.Algorithm = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	default:
+		err = errors.New("ocsp: only RSA, ECDSA and Ed25519 keys supported")
+	}
+
+	if err != nil {
+		return
+	}
+
+	if requestedSigAlgo == 0 {
+		return
+	}
+
+	found := false
+	for _, details := range signatureAlgorithmDetails {
+		if details.algo == requestedSigAlgo {
+			if details.pubKeyAlgo != pubType {
+				err = errors.New("ocsp: requested SignatureAlgorithm does not match private key type")
+				return
+			}
+			sigAlgo.Algorithm, hashFunc = details.oid, details.hash
+			sigAlgo.Parameters = asn1.RawValue{}
+			if pubType == x509.RSA {
+				sigAlgo.Parameters = asn1.NullRawValue
+			}
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		err = errors.New("ocsp: unknown SignatureAlgorithm")
+	}
+
+	return
+}
+
+// Request represents an OCSP request. See RFC 6960.
+type Request struct {
+	HashAlgorithm  crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// Marshal marshals the OCSP request to ASN.1 DER encoded form.
+func (req *Request) Marshal() ([]byte, error) {
+	hashAlg := ocspasn1.HashOID(req.HashAlgorithm)
+	if hashAlg == nil {
+		return nil, errors.New("ocsp: unknown hash algorithm")
+	}
+	return asn1.Marshal(ocspasn1.Request{
+		TBSRequest: ocspasn1.TBSRequest{
+			RequestList: []ocspasn1.SingleRequest{
+				{
+					Cert: ocspasn1.CertID{
+						HashAlgorithm: pkix.AlgorithmIdentifier{
+							Algorithm:  hashAlg,
+							Parameters: asn1.NullRawValue,
+						},
+						NameHash:      req.IssuerNameHash,
+						IssuerKeyHash: req.IssuerKeyHash,
+						SerialNumber:  req.SerialNumber,
+					},
+				},
+			},
+		},
+	})
+}
+
+// ParseRequest parses an OCSP request in DER form. It only supports
+// requests for a single certificate. Signed requests are not supported.
+// If a request includes a signature, it will result in a ParseError.
+func ParseRequest(bytes []byte) (*Request, error) {
+	var req ocspasn1.Request
+	rest, err := asn1.Unmarshal(bytes, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ParseError("ocsp: trailing data in OCSP request")
+	}
+
+	if len(req.TBSRequest.RequestList) == 0 {
+		return nil, ParseError("ocsp: OCSP request contains no request body")
+	}
+	innerRequest := req.TBSRequest.RequestList[0]
+
+	hashFunc := ocspasn1.HashFromOID(innerRequest.Cert.HashAlgorithm.Algorithm)
+	if hashFunc == 0 {
+		return nil, ParseError("ocsp: OCSP request uses unknown hash function")
+	}
+
+	return &Request{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: innerRequest.Cert.NameHash,
+		IssuerKeyHash:  innerRequest.Cert.IssuerKeyHash,
+		SerialNumber:   innerRequest.Cert.SerialNumber,
+	}, nil
+}
+
+// Response represents an OCSP response containing a single SingleResponse.
+// See RFC 6960.
+type Response struct {
+	Raw []byte
+
+	// Status is one of Good, Revoked, or Unknown.
+	Status                                        int
+	SerialNumber                                  *big.Int
+	ProducedAt, ThisUpdate, NextUpdate, RevokedAt time.Time
+	RevocationReason                              int
+	Certificate                                   *x509.Certificate
+	// TBSResponseData contains the raw bytes of the signed response. If
+	// Certificate is nil then this can be used to verify Signature.
+	TBSResponseData    []byte
+	Signature          []byte
+	SignatureAlgorithm x509.SignatureAlgorithm
+
+	// IssuerHash is the hash used to compute the IssuerNameHash and
+	// IssuerKeyHash. Valid values are crypto.SHA1, crypto.SHA256,
+	// crypto.SHA384, and crypto.SHA512. If zero, the default is crypto.SHA1.
+	IssuerHash crypto.Hash
+
+	// RawResponderName optionally contains the DER-encoded subject of the
+	// responder certificate. Exactly one of RawResponderName and
+	// ResponderKeyHash is set.
+	RawResponderName []byte
+	// ResponderKeyHash optionally contains the SHA-1 hash of the
+	// responder's public key. Exactly one of RawResponderName and
+	// ResponderKeyHash is set.
+	ResponderKeyHash []byte
+
+	// Extensions contains raw X.509 extensions from the singleExtensions
+	// field of the OCSP response. When parsing certificates, this can be used
+	// to extract non-critical extensions that are not parsed by this package.
+	// When marshaling OCSP responses, the Extensions field is ignored, see
+	// ExtraExtensions.
+	Extensions []pkix.Extension
+
+	// ExtraExtensions contains extensions to be copied, raw, into any marshaled
+	// OCSP response (in the singleExtensions field). Values override any
+	// extensions that would otherwise be produced based on the other fields.
+	// The ExtraExtensions field is not populated when parsing certificates,
+	// see Extensions.
+	ExtraExtensions []pkix.Extension
+}
+
+// CheckSignatureFrom checks that the signature in resp is a valid signature
+// from issuer. This should only be used if resp.Certificate is nil.
+// Otherwise, the OCSP response contained an intermediate certificate that
+// created the signature. That signature is checked by ParseResponse and only
+// ParseResponse should be used.
+func (resp *Response) CheckSignatureFrom(issuer *x509.Certificate) error {
+	return issuer.CheckSignature(resp.SignatureAlgorithm, resp.TBSResponseData, resp.Signature)
+}
+
+// IsCurrent reports whether the response is within its validity period at
+// time t, that is, whether ThisUpdate is not after t and t is before
+// NextUpdate. A response without NextUpdate is current from ThisUpdate on.
+func (resp *Response) IsCurrent(t time.Time) bool {
+	if resp.ThisUpdate.After(t) {
+		return false
+	}
+	return resp.NextUpdate.IsZero() || t.Before(resp.NextUpdate)
+}
+
+// ParseResponse parses an OCSP response in DER form. The response must
+// contain only one certificate status. To parse the status of a specific
+// certificate from a response which may contain multiple statuses, use
+// ParseResponseForCert instead.
+//
+// If the response contains an embedded certificate, then that certificate
+// will be used to verify the response signature. If the response contains
+// an embedded certificate and issuer is not nil, then issuer will be used
+// to verify the signature on the embedded certificate.
+//
+// If the response does not contain an embedded certificate and issuer is
+// not nil, then issuer will be used to verify the response signature.
+//
+// Invalid responses and parse failures will result in a ParseError.
+// Error responses will result in a ResponseError.
+func ParseResponse(bytes []byte, issuer *x509.Certificate) (*Response, error) {
+	return ParseResponseForCert(bytes, nil, issuer)
+}
+
+// ParseResponseForCert acts identically to ParseResponse, except it supports
+// parsing responses that contain multiple statuses. If cert is nil, then
+// ParseResponseForCert will return the first status contained in the
+// response.
+func ParseResponseForCert(bytes []byte, cert, issuer *x509.Certificate) (*Response, error) {
+	status, basicResp, err := ocspasn1.ParseBasicResponse(bytes)
+	if err != nil {
+		return nil, ParseError("ocsp: " + err.Error())
+	}
+	if status != 0 {
+		return nil, ResponseError{ResponseStatus(status)}
+	}
+
+	if n := len(basicResp.TBSResponseData.Responses); n == 0 || cert == nil && n > 1 {
+		return nil, ParseError("ocsp: OCSP response contains bad number of responses")
+	}
+
+	var singleResp ocspasn1.SingleResponse
+	if cert == nil {
+		singleResp = basicResp.TBSResponseData.Responses[0]
+	} else {
+		match := false
+		for _, resp := range basicResp.TBSResponseData.Responses {
+			if resp.CertID.SerialNumber != nil && cert.SerialNumber.Cmp(resp.CertID.SerialNumber) == 0 {
+				singleResp = resp
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, ParseError("ocsp: no response matching the supplied certificate")
+		}
+	}
+
+	ret := &Response{
+		Raw:                bytes,
+		TBSResponseData:    basicResp.TBSResponseData.Raw,
+		Signature:          basicResp.Signature.RightAlign(),
+		SignatureAlgorithm: getSignatureAlgorithmFromOID(basicResp.SignatureAlgorithm.Algorithm),
+		Extensions:         singleResp.SingleExtensions,
+		SerialNumber:       singleResp.CertID.SerialNumber,
+		ProducedAt:         basicResp.TBSResponseData.ProducedAt,
+		ThisUpdate:         singleResp.ThisUpdate,
+		NextUpdate:         singleResp.NextUpdate,
+	}
+
+	// ResponderID is a CHOICE between the responder's name and the hash of
+	// its public key. See RFC 6960, Section 4.2.1.
+	rawResponderID := basicResp.TBSResponseData.RawResponderID
+	switch rawResponderID.Tag {
+	case ocspasn1.ResponderIDByName:
+		var rdn pkix.RDNSequence
+		if rest, err := asn1.Unmarshal(rawResponderID.Bytes, &rdn); err != nil || len(rest) != 0 {
+			return nil, ParseError("ocsp: invalid responder name")
+		}
+		ret.RawResponderName = rawResponderID.Bytes
+	case ocspasn1.ResponderIDByKey:
+		var keyHash []byte
+		if rest, err := asn1.Unmarshal(rawResponderID.Bytes, &keyHash); err != nil || len(rest) != 0 {
+			return nil, ParseError("ocsp: invalid responder key hash")
+		}
+		ret.ResponderKeyHash = keyHash
+	default:
+		return nil, ParseError("ocsp: invalid responder id tag")
+	}
+
+	if len(basicResp.Certificates) > 1 {
+		return nil, ParseError("ocsp: OCSP response contains bad number of certificates")
+	}
+	if len(basicResp.Certificates) == 1 {
+		ret.Certificate, err = x509.ParseCertificate(basicResp.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ret.CheckSignatureFrom(ret.Certificate); err != nil {
+			return nil, ParseError("ocsp: bad signature on embedded certificate: " + err.Error())
+		}
+
+		if issuer != nil && !ret.Certificate.Equal(issuer) {
+			// A delegated responder must be issued by the CA and carry the
+			// id-kp-OCSPSigning extended key usage. See RFC 6960, Section
+			// 4.2.2.2.
+			if err := ret.Certificate.CheckSignatureFrom(issuer); err != nil {
+				return nil, ParseError("ocsp: bad OCSP signature: " + err.Error())
+			}
+			authorized := false
+			for _, usage := range ret.Certificate.ExtKeyUsage {
+				if usage == x509.ExtKeyUsageOCSPSigning {
+					authorized = true
+					break
+				}
+			}
+			if !authorized {
+				return nil, ParseError("ocsp: embedded certificate is not authorized for OCSP signing")
+			}
+		}
+	} else if issuer != nil {
+		if err := ret.CheckSignatureFrom(issuer); err != nil {
+			return nil, ParseError("ocsp: bad OCSP signature: " + err.Error())
+		}
+	}
+
+	for _, ext := range singleResp.SingleExtensions {
+		if ext.Critical {
+			return nil, ParseError("ocsp: unsupported critical extension")
+		}
+	}
+
+	ret.IssuerHash = ocspasn1.HashFromOID(singleResp.CertID.HashAlgorithm.Algorithm)
+	if ret.IssuerHash == 0 {
+		return nil, ParseError("ocsp: unsupported issuer hash algorithm")
+	}
+
+	switch {
+	case bool(singleResp.Good):
+		ret.Status = Good
+	case bool(singleResp.Unknown):
+		ret.Status = Unknown
+	default:
+		ret.Status = Revoked
+		ret.RevokedAt = singleResp.Revoked.RevocationTime
+		ret.RevocationReason = int(singleResp.Revoked.Reason)
+	}
+
+	return ret, nil
+}
+
+// RequestOptions contains options for constructing OCSP requests.
+type RequestOptions struct {
+	// Hash contains the hash function that should be used when
+	// constructing the OCSP request. If zero, SHA-1 will be used.
+	Hash crypto.Hash
+}
+
+func (opts *RequestOptions) hash() crypto.Hash {
+	if opts == nil || opts.Hash == 0 {
+		// SHA-1 is nearly universally used in OCSP.
+		return crypto.SHA1
+	}
+	return opts.Hash
+}
+
+// issuerHashes returns the hashes of the subject name and public key of
+// issuer, which identify it in OCSP requests and responses.
+func issuerHashes(issuer *x509.Certificate, hashFunc crypto.Hash) (nameHash, keyHash []byte, err error) {
+	if ocspasn1.HashOID(hashFunc) == nil || !hashFunc.Available() {
+		return nil, nil, x509.ErrUnsupportedAlgorithm
+	}
+	publicKey, err := ocspasn1.SubjectPublicKey(issuer.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := hashFunc.New()
+	h.Write(issuer.RawSubject)
+	nameHash = h.Sum(nil)
+	h.Reset()
+	h.Write(publicKey)
+	keyHash = h.Sum(nil)
+	return nameHash, keyHash, nil
+}
+
+// CreateRequest returns a DER-encoded, OCSP request for the status of cert.
+// If opts is nil then sensible defaults are used.
+func CreateRequest(cert, issuer *x509.Certificate, opts *RequestOptions) ([]byte, error) {
+	hashFunc := opts.hash()
+	nameHash, keyHash, err := issuerHashes(issuer, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: nameHash,
+		IssuerKeyHash:  keyHash,
+		SerialNumber:   cert.SerialNumber,
+	}
+	return req.Marshal()
+}
+
+// CreateResponse returns a DER-encoded OCSP response with the specified
+// contents. The fields in the response are populated as follows:
+//
+// The responder cert is used to populate the responder's name field, and
+// the certificate itself is provided alongside the OCSP response signature.
+//
+// The issuer cert is used to populate the IssuerNameHash and IssuerKeyHash
+// fields.
+//
+// The template is used to populate the SerialNumber, Status, RevokedAt,
+// RevocationReason, ThisUpdate, and NextUpdate fields. If template.IssuerHash
+// is not set, SHA-1 will be used. If template.ProducedAt is not set, the
+// current time, truncated to the minute, is used.
+func CreateResponse(issuer, responderCert *x509.Certificate, template Response, priv crypto.Signer) ([]byte, error) {
+	if template.IssuerHash == 0 {
+		template.IssuerHash = crypto.SHA1
+	}
+	nameHash, keyHash, err := issuerHashes(issuer, template.IssuerHash)
+	if err != nil {
+		return nil, err
+	}
+
+	innerResponse := ocspasn1.SingleResponse{
+		CertID: ocspasn1.CertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  ocspasn1.HashOID(template.IssuerHash),
+				Parameters: asn1.NullRawValue,
+			},
+			NameHash:      nameHash,
+			IssuerKeyHash: keyHash,
+			SerialNumber:  template.SerialNumber,
+		},
+		ThisUpdate:       template.ThisUpdate.UTC(),
+		NextUpdate:       template.NextUpdate.UTC(),
+		SingleExtensions: template.ExtraExtensions,
+	}
+
+	switch template.Status {
+	case Good:
+		innerResponse.Good = true
+	case Unknown:
+		innerResponse.Unknown = true
+	case Revoked:
+		innerResponse.Revoked = ocspasn1.RevokedInfo{
+			RevocationTime: template.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(template.RevocationReason),
+		}
+	default:
+		return nil, errors.New("ocsp: invalid response status")
+	}
+
+	rawResponderID := asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        ocspasn1.ResponderIDByName,
+		IsCompound: true,
+		Bytes:      responderCert.RawSubject,
+	}
+	if template.ResponderKeyHash != nil {
+		keyHash, err := asn1.Marshal(template.ResponderKeyHash)
+		if err != nil {
+			return nil, err
+		}
+		rawResponderID = asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        ocspasn1.ResponderIDByKey,
+			IsCompound: true,
+			Bytes:      keyHash,
+		}
+	}
+
+	producedAt := template.ProducedAt
+	if producedAt.IsZero() {
+		producedAt = time.Now().Truncate(time.Minute)
+	}
+	tbsResponseData := ocspasn1.ResponseData{
+		RawResponderID: rawResponderID,
+		ProducedAt:     producedAt.UTC(),
+		Responses:      []ocspasn1.SingleResponse{innerResponse},
+	}
+
+	tbsResponseDataDER, err := asn1.Marshal(tbsResponseData)
+	if err != nil {
+		return nil, err
+	}
+	tbsResponseData.Raw = tbsResponseDataDER
+
+	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(priv.Public(), template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := tbsResponseDataDER
+	if hashFunc != 0 {
+		responseHash := hashFunc.New()
+		responseHash.Write(tbsResponseDataDER)
+		signed = responseHash.Sum(nil)
+	}
+	signature, err := priv.Sign(rand.Reader, signed, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ocspasn1.BasicResponse{
+		TBSResponseData:    tbsResponseData,
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+	}
+	if template.Certificate != nil {
+		response.Certificates = []asn1.RawValue{
+			{FullBytes: template.Certificate.Raw},
+		}
+	}
+	responseDER, err := asn1.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspasn1.Response{
+		Status: asn1.Enumerated(Success),
+		Response: ocspasn1.ResponseBytes{
+			ResponseType: ocspasn1.OIDBasicResponse,
+			Response:     responseDER,
+		},
+	})
+}
@@ -0,0 +1,344 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testPKI struct {
+	rootKey *ecdsa.PrivateKey
+	root    *x509.Certificate
+	leaf    *x509.Certificate
+}
+
+func newTestCert(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := newTestCert(t, rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234567),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leaf := newTestCert(t, leafTemplate, root, leafKey.Public(), rootKey)
+
+	return &testPKI{rootKey: rootKey, root: root, leaf: leaf}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	pki := newTestPKI(t)
+
+	for _, h := range []crypto.Hash{0, crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		der, err := CreateRequest(pki.leaf, pki.root, &RequestOptions{Hash: h})
+		if err != nil {
+			t.Fatalf("%v: CreateRequest: %v", h, err)
+		}
+		req, err := ParseRequest(der)
+		if err != nil {
+			t.Fatalf("%v: ParseRequest: %v", h, err)
+		}
+
+		want := h
+		if want == 0 {
+			want = crypto.SHA1
+		}
+		if req.HashAlgorithm != want {
+			t.Errorf("%v: got hash %v", h, req.HashAlgorithm)
+		}
+		if req.SerialNumber.Cmp(pki.leaf.SerialNumber) != 0 {
+			t.Errorf("%v: got serial %v, want %v", h, req.SerialNumber, pki.leaf.SerialNumber)
+		}
+		nameHash, keyHash, err := issuerHashes(pki.root, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(req.IssuerNameHash, nameHash) || !bytes.Equal(req.IssuerKeyHash, keyHash) {
+			t.Errorf("%v: issuer hashes don't match", h)
+		}
+
+		remarshaled, err := req.Marshal()
+		if err != nil {
+			t.Fatalf("%v: Marshal: %v", h, err)
+		}
+		if !bytes.Equal(remarshaled, der) {
+			t.Errorf("%v: re-marshaled request differs from original", h)
+		}
+	}
+
+	if _, err := CreateRequest(pki.leaf, pki.root, &RequestOptions{Hash: crypto.MD5}); err == nil {
+		t.Error("CreateRequest with MD5 succeeded")
+	}
+	if _, err := ParseRequest([]byte{0x30, 0x00}); err == nil {
+		t.Error("ParseRequest of an empty request succeeded")
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	pki := newTestPKI(t)
+	thisUpdate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	producedAt := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	ext := pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 2, 3},
+		Value: []byte{0x05, 0x00},
+	}
+	tests := []Response{
+		{
+			Status:       Good,
+			SerialNumber: pki.leaf.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   thisUpdate.Add(7 * 24 * time.Hour),
+			IssuerHash:   crypto.SHA256,
+		},
+		{
+			Status:           Revoked,
+			SerialNumber:     pki.leaf.SerialNumber,
+			ThisUpdate:       thisUpdate,
+			RevokedAt:        thisUpdate.Add(-time.Hour),
+			RevocationReason: KeyCompromise,
+			ExtraExtensions:  []pkix.Extension{ext},
+		},
+		{
+			Status:           Unknown,
+			SerialNumber:     pki.leaf.SerialNumber,
+			ThisUpdate:       thisUpdate,
+			ResponderKeyHash: []byte{1, 2, 3, 4},
+		},
+	}
+
+	for i, template := range tests {
+		template.ProducedAt = producedAt
+		der, err := CreateResponse(pki.root, pki.root, template, pki.rootKey)
+		if err != nil {
+			t.Fatalf("#%d: CreateResponse: %v", i, err)
+		}
+
+		resp, err := ParseResponseForCert(der, pki.leaf, pki.root)
+		if err != nil {
+			t.Fatalf("#%d: ParseResponseForCert: %v", i, err)
+		}
+
+		if resp.Status != template.Status {
+			t.Errorf("#%d: got status %d, want %d", i, resp.Status, template.Status)
+		}
+		if resp.SerialNumber.Cmp(template.SerialNumber) != 0 {
+			t.Errorf("#%d: got serial %v, want %v", i, resp.SerialNumber, template.SerialNumber)
+		}
+		if !resp.ProducedAt.Equal(producedAt) {
+			t.Errorf("#%d: got ProducedAt %v, want %v", i, resp.ProducedAt, producedAt)
+		}
+		if !resp.ThisUpdate.Equal(template.ThisUpdate) || !resp.NextUpdate.Equal(template.NextUpdate) {
+			t.Errorf("#%d: got update times %v, %v", i, resp.ThisUpdate, resp.NextUpdate)
+		}
+		if !resp.RevokedAt.Equal(template.RevokedAt) || resp.RevocationReason != template.RevocationReason {
+			t.Errorf("#%d: got revocation %v, %d", i, resp.RevokedAt, resp.RevocationReason)
+		}
+		wantHash := template.IssuerHash
+		if wantHash == 0 {
+			wantHash = crypto.SHA1
+		}
+		if resp.IssuerHash != wantHash {
+			t.Errorf("#%d: got issuer hash %v, want %v", i, resp.IssuerHash, wantHash)
+		}
+		if resp.SignatureAlgorithm != x509.ECDSAWithSHA256 {
+			t.Errorf("#%d: got signature algorithm %v", i, resp.SignatureAlgorithm)
+		}
+		if template.ResponderKeyHash != nil {
+			if !bytes.Equal(resp.ResponderKeyHash, template.ResponderKeyHash) || resp.RawResponderName != nil {
+				t.Errorf("#%d: got responder key hash %x", i, resp.ResponderKeyHash)
+			}
+		} else if !bytes.Equal(resp.RawResponderName, pki.root.RawSubject) || resp.ResponderKeyHash != nil {
+			t.Errorf("#%d: got responder name %x", i, resp.RawResponderName)
+		}
+		if len(template.ExtraExtensions) > 0 && !reflect.DeepEqual(resp.Extensions, template.ExtraExtensions) {
+			t.Errorf("#%d: got extensions %v, want %v", i, resp.Extensions, template.ExtraExtensions)
+		}
+		if resp.Certificate != nil {
+			t.Errorf("#%d: unexpected embedded certificate", i)
+		}
+		if !resp.IsCurrent(thisUpdate.Add(time.Hour)) || resp.IsCurrent(thisUpdate.Add(-time.Hour)) {
+			t.Errorf("#%d: unexpected IsCurrent result", i)
+		}
+
+		if _, err := ParseResponse(der, pki.leaf); err == nil {
+			t.Errorf("#%d: ParseResponse verified with the wrong issuer", i)
+		}
+	}
+}
+
+func TestDelegatedResponder(t *testing.T) {
+	pki := newTestPKI(t)
+
+	responderKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResponder := func(usage []x509.ExtKeyUsage) *x509.Certificate {
+		return newTestCert(t, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "OCSP Responder"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  usage,
+		}, pki.root, responderKey.Public(), pki.rootKey)
+	}
+
+	responder := newResponder([]x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning})
+	template := Response{
+		Status:       Good,
+		SerialNumber: pki.leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+		Certificate:  responder,
+	}
+	der, err := CreateResponse(pki.root, responder, template, responderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseResponse(der, pki.root)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if !resp.Certificate.Equal(responder) {
+		t.Error("embedded certificate doesn't match the responder")
+	}
+	if resp.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Errorf("got signature algorithm %v", resp.SignatureAlgorithm)
+	}
+
+	unauthorized := newResponder([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	template.Certificate = unauthorized
+	der, err = CreateResponse(pki.root, unauthorized, template, responderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, pki.root); err == nil {
+		t.Error("ParseResponse accepted a responder without the OCSPSigning usage")
+	}
+	// Without an issuer, only the signature of the response is checked.
+	if _, err := ParseResponse(der, nil); err != nil {
+		t.Errorf("ParseResponse without issuer: %v", err)
+	}
+}
+
+func TestResponseSignatureAlgorithms(t *testing.T) {
+	pki := newTestPKI(t)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edRoot := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "Ed25519 Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, pki.root, edKey.Public(), pki.rootKey)
+
+	template := Response{
+		Status:       Good,
+		SerialNumber: big.NewInt(42),
+		ThisUpdate:   time.Now(),
+	}
+	der, err := CreateResponse(edRoot, edRoot, template, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseResponse(der, edRoot)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if resp.SignatureAlgorithm != x509.PureEd25519 {
+		t.Errorf("got signature algorithm %v", resp.SignatureAlgorithm)
+	}
+
+	template.SignatureAlgorithm = x509.ECDSAWithSHA512
+	der, err = CreateResponse(pki.root, pki.root, template, pki.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = ParseResponse(der, pki.root)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if resp.SignatureAlgorithm != x509.ECDSAWithSHA512 {
+		t.Errorf("got signature algorithm %v", resp.SignatureAlgorithm)
+	}
+
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	if _, err := CreateResponse(pki.root, pki.root, template, pki.rootKey); err == nil {
+		t.Error("CreateResponse accepted an RSA algorithm for an ECDSA key")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	for _, status := range []ResponseStatus{Malformed, InternalError, TryLater, SignatureRequired, Unauthorized} {
+		der, err := asn1.Marshal(struct {
+			Status asn1.Enumerated
+		}{asn1.Enumerated(status)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ParseResponse(der, nil)
+		respErr, ok := err.(ResponseError)
+		if !ok {
+			t.Fatalf("%v: got error %v, want a ResponseError", status, err)
+		}
+		if respErr.Status != status {
+			t.Errorf("got status %v, want %v", respErr.Status, status)
+		}
+	}
+
+	if _, err := ParseResponse([]byte{1, 2, 3}, nil); err == nil {
+		t.Error("ParseResponse of garbage succeeded")
+	} else if _, ok := err.(ParseError); !ok {
+		t.Errorf("got error %T, want a ParseError", err)
+	}
+}
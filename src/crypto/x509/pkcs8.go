@@ -39,6 +39,9 @@ func ParsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
 		if _, err := asn1.Unmarshal(der, &pkcs1PrivateKey{}); err == nil {
 			return nil, errors.New("x509: failed to parse private key (use ParsePKCS1PrivateKey instead for this key format)")
 		}
+		if _, err := asn1.Unmarshal(der, &encryptedPrivateKeyInfo{}); err == nil {
+			return nil, errors.New("x509: failed to parse private key (use ParseEncryptedPKCS8PrivateKey instead for this key format)")
+		}
 		return nil, err
 	}
 	switch {
@@ -0,0 +1,446 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+// RFC 5958, Section 3 describes the EncryptedPrivateKeyInfo structure, and
+// RFC 8018, Section 6.2 the PBES2 encryption scheme used with it. The scrypt
+// key derivation function is specified for PBES2 by RFC 7914, Section 7.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/internal/scrypt"
+	"crypto/pbkdf2"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// encryptedPrivateKeyInfo reflects an ASN.1 EncryptedPrivateKeyInfo. See
+// RFC 5958, Section 3.
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params reflects the ASN.1 PBES2-params. See RFC 8018, Appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params reflects the ASN.1 PBKDF2-params, with only the specified
+// salt choice supported. See RFC 8018, Appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams reflects the ASN.1 scrypt-params. See RFC 7914, Section 7.1.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+var pbkdf2PRFs = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidHMACWithSHA1, crypto.SHA1},
+	{oidHMACWithSHA224, crypto.SHA224},
+	{oidHMACWithSHA256, crypto.SHA256},
+	{oidHMACWithSHA384, crypto.SHA384},
+	{oidHMACWithSHA512, crypto.SHA512},
+}
+
+var pbes2Ciphers = []struct {
+	oid     asn1.ObjectIdentifier
+	cipher  PEMCipher
+	keySize int
+}{
+	{oidAES128CBC, PEMCipherAES128, 16},
+	{oidAES192CBC, PEMCipherAES192, 24},
+	{oidAES256CBC, PEMCipherAES256, 32},
+}
+
+const (
+	defaultPBKDF2Iterations = 600000
+	pbes2SaltSize           = 16
+
+	// maxPBKDF2Iterations bounds the PBKDF2 iteration count of an encrypted
+	// key, which would otherwise let the key make parsing it run for hours.
+	maxPBKDF2Iterations = 10000000
+
+	// maxScryptMemory bounds the memory that parsing an encrypted key can
+	// make scrypt use, which is about 128 * N * r bytes for its working
+	// state plus 128 * r * p bytes for its PBKDF2 output.
+	maxScryptMemory = 1 << 30
+
+	// maxScryptCost bounds the CPU time that parsing an encrypted key can
+	// make scrypt use, which is proportional to N * r * p.
+	maxScryptCost = 1 << 24
+)
+
+// PKCS8EncryptionOptions holds the parameters used by
+// MarshalEncryptedPKCS8PrivateKey to encrypt a private key with PBES2.
+type PKCS8EncryptionOptions struct {
+	// Cipher selects the AES-CBC variant used to encrypt the key. It must be
+	// PEMCipherAES128, PEMCipherAES192 or PEMCipherAES256. If zero,
+	// PEMCipherAES256 is used.
+	Cipher PEMCipher
+
+	// PBKDF2 and Scrypt select the function used to derive the encryption
+	// key from the password, and its parameters. At most one of them may be
+	// set. If neither is, PBKDF2 with HMAC-SHA-256 is used with the default
+	// iteration count, which may change in the future.
+	PBKDF2 *PBKDF2Options
+	Scrypt *ScryptOptions
+}
+
+// PBKDF2Options holds the parameters of the PBKDF2 key derivation function.
+// See RFC 8018, Section 5.2.
+type PBKDF2Options struct {
+	// Iterations is the iteration count, which must be at most 10,000,000.
+	// If zero, a default is used.
+	Iterations int
+
+	// Hash is the hash function used with HMAC as the pseudorandom function.
+	// It must be crypto.SHA1, crypto.SHA224, crypto.SHA256, crypto.SHA384 or
+	// crypto.SHA512. If zero, crypto.SHA256 is used.
+	Hash crypto.Hash
+}
+
+// ScryptOptions holds the parameters of the scrypt key derivation function.
+// See RFC 7914, Section 2.
+type ScryptOptions struct {
+	// N is the CPU/memory cost parameter, which must be a power of two
+	// greater than one. R is the block size and P the parallelization
+	// parameter. Together they must need at most 1 GiB of memory to derive
+	// a key, that is 128 * R * (N + P) bytes, and N * R * P must be at most
+	// 2^24.
+	N, R, P int
+}
+
+// ParseEncryptedPKCS8PrivateKey decrypts and parses a private key in
+// encrypted PKCS #8, ASN.1 DER form, as specified in RFC 5958. Only the
+// PBES2 encryption scheme is supported, with the PBKDF2 or scrypt key
+// derivation functions and AES-CBC encryption.
+//
+// It returns the same key types as ParsePKCS8PrivateKey. If an incorrect
+// password is detected an IncorrectPasswordError is returned. Keys whose
+// key derivation parameters exceed the limits documented on PBKDF2Options
+// and ScryptOptions are rejected, so that untrusted input can't make key
+// derivation take excessive time or memory.
+//
+// This kind of key is commonly encoded in PEM blocks of type "ENCRYPTED
+// PRIVATE KEY".
+func ParseEncryptedPKCS8PrivateKey(der, password []byte) (key interface{}, err error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after encrypted PKCS#8 private key")
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("x509: unsupported PKCS#8 encryption scheme: %v", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if rest, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("x509: invalid PBES2 parameters: " + err.Error())
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after PBES2 parameters")
+	}
+
+	var keySize int
+	for _, c := range pbes2Ciphers {
+		if params.EncryptionScheme.Algorithm.Equal(c.oid) {
+			keySize = c.keySize
+		}
+	}
+	if keySize == 0 {
+		return nil, fmt.Errorf("x509: unsupported PBES2 encryption scheme: %v", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if rest, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("x509: invalid AES-CBC parameters: " + err.Error())
+	} else if len(rest) != 0 || len(iv) != aes.BlockSize {
+		return nil, errors.New("x509: invalid AES-CBC parameters")
+	}
+
+	encryptionKey, err := pbes2DeriveKey(&params.KeyDerivationFunc, password, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("x509: encrypted PKCS#8 private key is not a multiple of the block size")
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	// Remove the PKCS #7 padding, as in DecryptPEMBlock. A wrong password
+	// will usually produce invalid padding, but might not, so a plaintext
+	// that doesn't parse is also reported as an incorrect password.
+	n := int(plaintext[len(plaintext)-1])
+	if n == 0 || n > aes.BlockSize {
+		return nil, IncorrectPasswordError
+	}
+	for _, b := range plaintext[len(plaintext)-n:] {
+		if int(b) != n {
+			return nil, IncorrectPasswordError
+		}
+	}
+	plaintext = plaintext[:len(plaintext)-n]
+
+	var privKey pkcs8
+	if rest, err := asn1.Unmarshal(plaintext, &privKey); err != nil || len(rest) != 0 {
+		return nil, IncorrectPasswordError
+	}
+	return ParsePKCS8PrivateKey(plaintext)
+}
+
+// pbes2DeriveKey derives a keySize bytes encryption key from password with
+// the key derivation function specified by kdf.
+func pbes2DeriveKey(kdf *pkix.AlgorithmIdentifier, password []byte, keySize int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if rest, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("x509: invalid PBKDF2 parameters: " + err.Error())
+		} else if len(rest) != 0 {
+			return nil, errors.New("x509: trailing data after PBKDF2 parameters")
+		}
+		if params.IterationCount <= 0 {
+			return nil, errors.New("x509: invalid PBKDF2 iteration count")
+		}
+		if params.IterationCount > maxPBKDF2Iterations {
+			return nil, errors.New("x509: PBKDF2 iteration count is too large")
+		}
+		if params.KeyLength != 0 && params.KeyLength != keySize {
+			return nil, errors.New("x509: PBKDF2 key length doesn't match the encryption scheme")
+		}
+		// The PRF defaults to hmacWithSHA1 if omitted.
+		prfHash := crypto.SHA1
+		if len(params.PRF.Algorithm) != 0 {
+			prfHash = 0
+			for _, prf := range pbkdf2PRFs {
+				if params.PRF.Algorithm.Equal(prf.oid) {
+					prfHash = prf.hash
+				}
+			}
+			if prfHash == 0 {
+				return nil, fmt.Errorf("x509: unsupported PBKDF2 pseudorandom function: %v", params.PRF.Algorithm)
+			}
+		}
+		return pbkdf2.Key(password, params.Salt, params.IterationCount, keySize, prfHash.New), nil
+
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if rest, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("x509: invalid scrypt parameters: " + err.Error())
+		} else if len(rest) != 0 {
+			return nil, errors.New("x509: trailing data after scrypt parameters")
+		}
+		if params.KeyLength != 0 && params.KeyLength != keySize {
+			return nil, errors.New("x509: scrypt key length doesn't match the encryption scheme")
+		}
+		N, r, p := params.CostParameter, params.BlockSize, params.ParallelizationParameter
+		if err := checkScryptParams(N, r, p); err != nil {
+			return nil, err
+		}
+		key, err := scrypt.Key(password, params.Salt, N, r, p, keySize)
+		if err != nil {
+			return nil, errors.New("x509: invalid scrypt parameters")
+		}
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("x509: unsupported PBES2 key derivation function: %v", kdf.Algorithm)
+	}
+}
+
+// checkScryptParams checks that the scrypt parameters are positive, and that
+// deriving a key with them uses at most maxScryptMemory bytes and a cost of
+// maxScryptCost. scrypt.Key checks the remaining constraints.
+func checkScryptParams(N, r, p int) error {
+	if N <= 0 || r <= 0 || p <= 0 {
+		return errors.New("x509: invalid scrypt parameters")
+	}
+	if N > maxScryptMemory/128/r || p > maxScryptMemory/128/r ||
+		128*uint64(r)*(uint64(N)+uint64(p)) > maxScryptMemory ||
+		uint64(N)*uint64(r)*uint64(p) > maxScryptCost {
+		return errors.New("x509: scrypt parameters are too large")
+	}
+	return nil
+}
+
+// MarshalEncryptedPKCS8PrivateKey converts a private key to encrypted PKCS
+// #8, ASN.1 DER form, using the PBES2 encryption scheme with a key derived
+// from password. If opts is nil, the defaults described in
+// PKCS8EncryptionOptions are used. Random salts and IVs are read from rand.
+//
+// The following key types are currently supported: *rsa.PrivateKey,
+// *ecdsa.PrivateKey and ed25519.PrivateKey. Unsupported key types result in
+// an error.
+//
+// This kind of key is commonly encoded in PEM blocks of type "ENCRYPTED
+// PRIVATE KEY".
+func MarshalEncryptedPKCS8PrivateKey(rand io.Reader, key interface{}, password []byte, opts *PKCS8EncryptionOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &PKCS8EncryptionOptions{}
+	}
+	if opts.PBKDF2 != nil && opts.Scrypt != nil {
+		return nil, errors.New("x509: only one of PBKDF2 and Scrypt may be set")
+	}
+
+	cipherAlg := PEMCipherAES256
+	if opts.Cipher != 0 {
+		cipherAlg = opts.Cipher
+	}
+	var encryptionOID asn1.ObjectIdentifier
+	var keySize int
+	for _, c := range pbes2Ciphers {
+		if c.cipher == cipherAlg {
+			encryptionOID, keySize = c.oid, c.keySize
+		}
+	}
+	if keySize == 0 {
+		return nil, errors.New("x509: unsupported cipher for PKCS#8 encryption")
+	}
+
+	plaintext, err := MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, pbes2SaltSize)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, errors.New("x509: cannot generate salt: " + err.Error())
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, errors.New("x509: cannot generate IV: " + err.Error())
+	}
+
+	var kdf pkix.AlgorithmIdentifier
+	var encryptionKey []byte
+	if opts.Scrypt != nil {
+		N, r, p := opts.Scrypt.N, opts.Scrypt.R, opts.Scrypt.P
+		if err := checkScryptParams(N, r, p); err != nil {
+			return nil, err
+		}
+		encryptionKey, err = scrypt.Key(password, salt, N, r, p, keySize)
+		if err != nil {
+			return nil, errors.New("x509: invalid scrypt parameters")
+		}
+		kdf.Algorithm = oidScrypt
+		kdf.Parameters.FullBytes, err = asn1.Marshal(scryptParams{
+			Salt:                     salt,
+			CostParameter:            N,
+			BlockSize:                r,
+			ParallelizationParameter: p,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		iterations, prfHash := defaultPBKDF2Iterations, crypto.SHA256
+		if opts.PBKDF2 != nil {
+			if opts.PBKDF2.Iterations < 0 || opts.PBKDF2.Iterations > maxPBKDF2Iterations {
+				return nil, errors.New("x509: invalid PBKDF2 iteration count")
+			}
+			if opts.PBKDF2.Iterations != 0 {
+				iterations = opts.PBKDF2.Iterations
+			}
+			if opts.PBKDF2.Hash != 0 {
+				prfHash = opts.PBKDF2.Hash
+			}
+		}
+		var prfOID asn1.ObjectIdentifier
+		for _, prf := range pbkdf2PRFs {
+			if prf.hash == prfHash {
+				prfOID = prf.oid
+			}
+		}
+		if prfOID == nil || !prfHash.Available() {
+			return nil, errors.New("x509: unsupported hash for PBKDF2")
+		}
+		encryptionKey = pbkdf2.Key(password, salt, iterations, keySize, prfHash.New)
+		kdf.Algorithm = oidPBKDF2
+		kdf.Parameters.FullBytes, err = asn1.Marshal(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: iterations,
+			PRF: pkix.AlgorithmIdentifier{
+				Algorithm:  prfOID,
+				Parameters: asn1.NullRawValue,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	// Add PKCS #7 padding, as in EncryptPEMBlock.
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	encrypted := append(plaintext, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	pbes2, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  encryptionOID,
+			Parameters: asn1.RawValue{FullBytes: ivParams},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: pbes2},
+		},
+		EncryptedData: encrypted,
+	})
+}
@@ -6,11 +6,15 @@ package x509
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/asn1"
 	"encoding/hex"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -127,6 +131,7 @@ var pkcs8MismatchKeyTests = []struct {
 }{
 	{hexKey: hexPKCS8TestECKey, errorContains: "use ParseECPrivateKey instead"},
 	{hexKey: hexPKCS8TestPKCS1Key, errorContains: "use ParsePKCS1PrivateKey instead"},
+	{hexKey: encryptedPKCS8PBKDF2SHA256Hex, errorContains: "use ParseEncryptedPKCS8PrivateKey instead"},
 }
 
 func TestPKCS8MismatchKeyFormat(t *testing.T) {
@@ -138,3 +143,236 @@ func TestPKCS8MismatchKeyFormat(t *testing.T) {
 		}
 	}
 }
+
+// The following keys are pkcs8Ed25519PrivateKeyHex encrypted with the
+// password "password".
+
+// Generated using:
+//   openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256 -iter 2048
+var encryptedPKCS8PBKDF2SHA256Hex = `30819b305706092a864886f70d01050d304a302906092a864886f70d01050c301c04085e1e40e8c34677c102020800300c06082a864886f70d02090500301d060960864801650304012a0410e0896d579c1d1f604feab32dc868ac3c0440c66a884a51aa151bf4e3fa385d5488275541c3e08aeb577f6fac23821d6b0b337abdb7749246257fe5ee7d57b1b05c52871d0189783f0b407aefff8d3ccd651f`
+
+// Generated using:
+//   openssl pkcs8 -topk8 -v2 aes-128-cbc -v2prf hmacWithSHA1 -iter 2048
+var encryptedPKCS8PBKDF2SHA1Hex = `30818d304906092a864886f70d01050d303c301b06092a864886f70d01050c300e0408b13c8008238f73e602020800301d06096086480165030401020410d95726da214a4876df9640372dbc03420440e2f2145e42bef32307b618f6fecd655a47d88433b2608ccc8e7d2f39d01ed2b23d0d6708ce29fc6c08d8231fb0f878d0f86db4164419c54ac1fe6e18d31efad7`
+
+// Generated using:
+//   openssl pkcs8 -topk8 -v2 aes-192-cbc -scrypt -scrypt_N 1024 -scrypt_r 8 -scrypt_p 1
+var encryptedPKCS8ScryptHex = `308193304f06092a864886f70d01050d3042302106092b06010401da47040b301404083d4767e95809323702020400020108020101301d0609608648016503040116041040a7938ab081a6040107beaf5af006400440b3efecf89e507cf53642949cda66be85b4d037e9e480d38e3a2bf47beb55537e8729f21007b19b28fd0ff8703505103f929bfa8c100d5aa6a88a4314f5bb949f`
+
+func TestParseEncryptedPKCS8(t *testing.T) {
+	want, _ := hex.DecodeString(pkcs8Ed25519PrivateKeyHex)
+	tests := []struct {
+		name   string
+		keyHex string
+	}{
+		{"PBKDF2-SHA256", encryptedPKCS8PBKDF2SHA256Hex},
+		{"PBKDF2-SHA1", encryptedPKCS8PBKDF2SHA1Hex},
+		{"scrypt", encryptedPKCS8ScryptHex},
+	}
+	for _, test := range tests {
+		derBytes, _ := hex.DecodeString(test.keyHex)
+		key, err := ParseEncryptedPKCS8PrivateKey(derBytes, []byte("password"))
+		if err != nil {
+			t.Errorf("%s: failed to decrypt key: %s", test.name, err)
+			continue
+		}
+		got, err := MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Errorf("%s: failed to marshal key: %s", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: decrypted key didn't match: got %x, want %x", test.name, got, want)
+		}
+
+		if _, err := ParseEncryptedPKCS8PrivateKey(derBytes, []byte("wrong")); err != IncorrectPasswordError {
+			t.Errorf("%s: decrypting with the wrong password returned %v, want IncorrectPasswordError", test.name, err)
+		}
+	}
+}
+
+func TestMarshalEncryptedPKCS8(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []interface{}{rsaKey, ecKey, edKey}
+
+	options := []struct {
+		name string
+		opts *PKCS8EncryptionOptions
+	}{
+		{"PBKDF2-SHA256", &PKCS8EncryptionOptions{PBKDF2: &PBKDF2Options{Iterations: 1000}}},
+		{"PBKDF2-SHA512-AES128", &PKCS8EncryptionOptions{
+			Cipher: PEMCipherAES128,
+			PBKDF2: &PBKDF2Options{Iterations: 1000, Hash: crypto.SHA512},
+		}},
+		{"scrypt-AES192", &PKCS8EncryptionOptions{
+			Cipher: PEMCipherAES192,
+			Scrypt: &ScryptOptions{N: 1024, R: 8, P: 1},
+		}},
+	}
+
+	password := []byte("correct horse battery staple")
+	for _, o := range options {
+		for _, key := range keys {
+			der, err := MarshalEncryptedPKCS8PrivateKey(rand.Reader, key, password, o.opts)
+			if err != nil {
+				t.Errorf("%s: %T: failed to encrypt key: %s", o.name, key, err)
+				continue
+			}
+			decrypted, err := ParseEncryptedPKCS8PrivateKey(der, password)
+			if err != nil {
+				t.Errorf("%s: %T: failed to decrypt key: %s", o.name, key, err)
+				continue
+			}
+			if !reflect.DeepEqual(decrypted, key) {
+				t.Errorf("%s: %T: decrypted key didn't match the original", o.name, key)
+			}
+			if _, err := ParseEncryptedPKCS8PrivateKey(der, []byte("wrong")); err != IncorrectPasswordError {
+				t.Errorf("%s: %T: decrypting with the wrong password returned %v, want IncorrectPasswordError", o.name, key, err)
+			}
+		}
+	}
+}
+
+func TestMarshalEncryptedPKCS8InvalidOptions(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts *PKCS8EncryptionOptions
+	}{
+		{"BothKDFs", &PKCS8EncryptionOptions{
+			PBKDF2: &PBKDF2Options{},
+			Scrypt: &ScryptOptions{N: 1024, R: 8, P: 1},
+		}},
+		{"DESCipher", &PKCS8EncryptionOptions{Cipher: PEMCipher3DES}},
+		{"MD5", &PKCS8EncryptionOptions{PBKDF2: &PBKDF2Options{Hash: crypto.MD5}}},
+		{"NegativeIterations", &PKCS8EncryptionOptions{PBKDF2: &PBKDF2Options{Iterations: -1}}},
+		{"TooManyIterations", &PKCS8EncryptionOptions{PBKDF2: &PBKDF2Options{Iterations: 1<<31 - 1}}},
+		{"ScryptZeroP", &PKCS8EncryptionOptions{Scrypt: &ScryptOptions{N: 1024, R: 8, P: 0}}},
+		{"ScryptLargeP", &PKCS8EncryptionOptions{Scrypt: &ScryptOptions{N: 2, R: 1, P: 1<<30 - 1}}},
+		{"ScryptBadN", &PKCS8EncryptionOptions{Scrypt: &ScryptOptions{N: 1000, R: 8, P: 1}}},
+	}
+	for _, test := range tests {
+		if _, err := MarshalEncryptedPKCS8PrivateKey(rand.Reader, key, []byte("password"), test.opts); err == nil {
+			t.Errorf("%s: MarshalEncryptedPKCS8PrivateKey succeeded, want error", test.name)
+		}
+	}
+}
+
+// editKDFParams returns der, an encrypted PKCS #8 key, after decoding its key
+// derivation function parameters into params, calling edit, and encoding
+// params back.
+func editKDFParams(t *testing.T, der []byte, params interface{}, edit func()) []byte {
+	t.Helper()
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		t.Fatal(err)
+	}
+	var pbes2 pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &pbes2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(pbes2.KeyDerivationFunc.Parameters.FullBytes, params); err != nil {
+		t.Fatal(err)
+	}
+	edit()
+	var err error
+	if pbes2.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(reflect.ValueOf(params).Elem().Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if info.Algo.Parameters.FullBytes, err = asn1.Marshal(pbes2); err != nil {
+		t.Fatal(err)
+	}
+	if der, err = asn1.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseEncryptedPKCS8Limits(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptDER, err := MarshalEncryptedPKCS8PrivateKey(rand.Reader, key, []byte("password"), &PKCS8EncryptionOptions{
+		Scrypt: &ScryptOptions{N: 2, R: 8, P: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pbkdf2DER, err := MarshalEncryptedPKCS8PrivateKey(rand.Reader, key, []byte("password"), &PKCS8EncryptionOptions{
+		PBKDF2: &PBKDF2Options{Iterations: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		der     func() []byte
+		wantErr string
+	}{
+		{"ScryptLargeN", func() []byte {
+			// Would require 16 GiB of memory for the working state.
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() { p.CostParameter = 1 << 24 })
+		}, "too large"},
+		{"ScryptLargeP", func() []byte {
+			// Passes the checks of scrypt.Key, but would make its PBKDF2
+			// output about 128 GiB.
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() {
+				p.CostParameter, p.BlockSize, p.ParallelizationParameter = 2, 1, 1<<30-1
+			})
+		}, "too large"},
+		{"ScryptLargeNAndP", func() []byte {
+			// Each within the memory limit alone, but not together.
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() {
+				p.CostParameter, p.BlockSize, p.ParallelizationParameter = 1<<22, 1, 1<<22+1
+			})
+		}, "too large"},
+		{"ScryptHighCost", func() []byte {
+			// Within the memory limit, but would take days to compute.
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() {
+				p.CostParameter, p.BlockSize, p.ParallelizationParameter = 1<<20, 1, 1<<10
+			})
+		}, "too large"},
+		{"ScryptZeroP", func() []byte {
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() { p.ParallelizationParameter = 0 })
+		}, "invalid scrypt parameters"},
+		{"ScryptNegativeP", func() []byte {
+			var p scryptParams
+			return editKDFParams(t, scryptDER, &p, func() { p.ParallelizationParameter = -1 })
+		}, "invalid scrypt parameters"},
+		{"PBKDF2MaxInt32Iterations", func() []byte {
+			var p pbkdf2Params
+			return editKDFParams(t, pbkdf2DER, &p, func() { p.IterationCount = math.MaxInt32 })
+		}, "too large"},
+		{"PBKDF2ZeroIterations", func() []byte {
+			var p pbkdf2Params
+			return editKDFParams(t, pbkdf2DER, &p, func() { p.IterationCount = 0 })
+		}, "invalid PBKDF2 iteration count"},
+	}
+	for _, test := range tests {
+		_, err := ParseEncryptedPKCS8PrivateKey(test.der(), []byte("password"))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got error %v, want error containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"bytes"
+	"crypto/x509/internal/ocspasn1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+)
+
+// crlReasonRemoveFromCRL is the removeFromCRL CRL entry reason code, which
+// only appears in delta CRLs. See RFC 5280, Section 5.3.1.
+const crlReasonRemoveFromCRL = 8
+
+// filterRevokedChains removes from chains any chain that contains a
+// certificate revoked according to opts.OCSPResponses or opts.CRLs. If no
+// chain is left, it returns the error for the first revoked certificate.
+func filterRevokedChains(chains [][]*Certificate, opts *VerifyOptions) ([][]*Certificate, error) {
+	if len(opts.OCSPResponses) == 0 && len(opts.CRLs) == 0 {
+		return chains, nil
+	}
+
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var valid [][]*Certificate
+	var firstErr error
+	for _, chain := range chains {
+		if err := checkChainRevocation(chain, opts, now); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, chain)
+	}
+	if len(valid) == 0 {
+		return nil, firstErr
+	}
+	return valid, nil
+}
+
+func checkChainRevocation(chain []*Certificate, opts *VerifyOptions, now time.Time) error {
+	// The last certificate of a chain is a trust anchor, which can't be
+	// revoked by anything it signed.
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if revokedByCRL(cert, issuer, opts.CRLs, now) {
+			return CertificateInvalidError{cert, Revoked, "listed in a certificate revocation list"}
+		}
+		if revokedByOCSP(cert, issuer, opts.OCSPResponses, now) {
+			return CertificateInvalidError{cert, Revoked, "reported by an OCSP response"}
+		}
+	}
+	return nil
+}
+
+// crlInfo is a CRL that was signed by the issuer being checked, along with
+// its cRLNumber and, for delta CRLs, the deltaCRLIndicator.
+type crlInfo struct {
+	list   *pkix.CertificateList
+	number *big.Int
+	base   *big.Int // nil for complete CRLs
+}
+
+// revokedByCRL reports whether cert is revoked according to the CRLs in crls
+// that were signed by issuer.
+//
+// A delta CRL is combined with every complete CRL it can update, that is one
+// whose number is at least the delta's BaseCRLNumber and less than the
+// delta's own number (RFC 5280, Section 5.2.4). Delta CRLs are cumulative,
+// so only the newest applicable one is used: an entry for cert there takes
+// precedence over the complete CRL, and a removeFromCRL entry means cert is
+// no longer revoked. Entries of delta CRLs that can't be combined with any
+// complete CRL still count as revocations, but their removeFromCRL entries
+// have nothing to apply to.
+func revokedByCRL(cert, issuer *Certificate, crls []*pkix.CertificateList, now time.Time) bool {
+	var complete, deltas []crlInfo
+	for _, crl := range crls {
+		crlIssuer, err := asn1.Marshal(crl.TBSCertList.Issuer)
+		if err != nil || !bytes.Equal(crlIssuer, issuer.RawSubject) {
+			continue
+		}
+		if issuer.CheckCRLSignature(crl) != nil {
+			continue
+		}
+		info, ok := parseCRLInfo(crl)
+		if !ok {
+			continue
+		}
+		if info.base == nil {
+			complete = append(complete, info)
+		} else {
+			deltas = append(deltas, info)
+		}
+	}
+
+	applied := make([]bool, len(deltas))
+	for _, c := range complete {
+		entry := findCRLEntry(c.list, cert.SerialNumber)
+		if c.number != nil {
+			var newest *crlInfo
+			for i := range deltas {
+				d := &deltas[i]
+				if d.base.Cmp(c.number) > 0 || c.number.Cmp(d.number) >= 0 {
+					continue
+				}
+				applied[i] = true
+				if newest == nil || d.number.Cmp(newest.number) > 0 {
+					newest = d
+				}
+			}
+			if newest != nil {
+				if e := findCRLEntry(newest.list, cert.SerialNumber); e != nil {
+					entry = e
+				}
+			}
+		}
+		if crlEntryRevokes(entry, now) {
+			return true
+		}
+	}
+	for i, d := range deltas {
+		if !applied[i] && crlEntryRevokes(findCRLEntry(d.list, cert.SerialNumber), now) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCRLInfo extracts the cRLNumber and deltaCRLIndicator extensions of
+// crl. It returns false if they are malformed, or if crl is a delta CRL
+// without a number.
+func parseCRLInfo(crl *pkix.CertificateList) (crlInfo, bool) {
+	info := crlInfo{list: crl}
+	for _, ext := range crl.TBSCertList.Extensions {
+		var err error
+		switch {
+		case ext.Id.Equal(oidExtensionCRLNumber):
+			info.number, err = parseCRLNumber(ext.Value)
+		case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+			info.base, err = parseCRLNumber(ext.Value)
+		}
+		if err != nil {
+			return crlInfo{}, false
+		}
+	}
+	if info.base != nil && info.number == nil {
+		return crlInfo{}, false
+	}
+	return info, true
+}
+
+// findCRLEntry returns the entry of crl for serial, or nil if there is none.
+func findCRLEntry(crl *pkix.CertificateList, serial *big.Int) *pkix.RevokedCertificate {
+	for i := range crl.TBSCertList.RevokedCertificates {
+		revoked := &crl.TBSCertList.RevokedCertificates[i]
+		if revoked.SerialNumber != nil && revoked.SerialNumber.Cmp(serial) == 0 {
+			return revoked
+		}
+	}
+	return nil
+}
+
+// crlEntryRevokes reports whether entry, which may be nil, revokes its
+// certificate at time now.
+func crlEntryRevokes(entry *pkix.RevokedCertificate, now time.Time) bool {
+	if entry == nil || entry.RevocationTime.After(now) {
+		return false
+	}
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidExtensionReasonCode) {
+			continue
+		}
+		var reason asn1.Enumerated
+		if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil && reason == crlReasonRemoveFromCRL {
+			return false
+		}
+	}
+	return true
+}
+
+// revokedByOCSP reports whether one of the DER-encoded OCSP responses,
+// signed by issuer or by a responder it authorized, reports cert as revoked.
+// Responses that can't be parsed or verified are ignored.
+func revokedByOCSP(cert, issuer *Certificate, responses [][]byte, now time.Time) bool {
+	issuerKey, err := ocspasn1.SubjectPublicKey(issuer.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return false
+	}
+	for _, der := range responses {
+		_, basic, err := ocspasn1.ParseBasicResponse(der)
+		if err != nil || basic == nil {
+			continue
+		}
+		var single *ocspasn1.SingleResponse
+		for i := range basic.TBSResponseData.Responses {
+			if ocspMatchesCert(&basic.TBSResponseData.Responses[i].CertID, cert, issuer, issuerKey) {
+				single = &basic.TBSResponseData.Responses[i]
+				break
+			}
+		}
+		if single == nil || single.Good || single.Unknown {
+			continue
+		}
+		if single.Revoked.RevocationTime.After(now) {
+			continue
+		}
+		if checkOCSPSignature(basic, issuer) != nil {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func ocspMatchesCert(id *ocspasn1.CertID, cert, issuer *Certificate, issuerKey []byte) bool {
+	if id.SerialNumber == nil || id.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return false
+	}
+	hashFunc := ocspasn1.HashFromOID(id.HashAlgorithm.Algorithm)
+	if hashFunc == 0 || !hashFunc.Available() {
+		return false
+	}
+	h := hashFunc.New()
+	h.Write(issuer.RawSubject)
+	if !bytes.Equal(h.Sum(nil), id.NameHash) {
+		return false
+	}
+	h.Reset()
+	h.Write(issuerKey)
+	return bytes.Equal(h.Sum(nil), id.IssuerKeyHash)
+}
+
+// checkOCSPSignature checks that basic was signed either by issuer, or by a
+// delegated responder certificate included in the response, issued by issuer
+// and authorized for OCSP signing. See RFC 6960, Section 4.2.2.2.
+func checkOCSPSignature(basic *ocspasn1.BasicResponse, issuer *Certificate) error {
+	algo := getSignatureAlgorithmFromAI(basic.SignatureAlgorithm)
+	signed := basic.TBSResponseData.Raw
+	signature := basic.Signature.RightAlign()
+	err := issuer.CheckSignature(algo, signed, signature)
+	if err == nil {
+		return nil
+	}
+	for _, raw := range basic.Certificates {
+		responder, parseErr := ParseCertificate(raw.FullBytes)
+		if parseErr != nil {
+			continue
+		}
+		if responder.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		authorized := false
+		for _, usage := range responder.ExtKeyUsage {
+			if usage == ExtKeyUsageOCSPSigning {
+				authorized = true
+				break
+			}
+		}
+		if !authorized {
+			continue
+		}
+		if responder.CheckSignature(algo, signed, signature) == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,324 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/ocsp"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type revocationPKI struct {
+	now       time.Time
+	rootKey   crypto.Signer
+	root      *x509.Certificate
+	interKey  crypto.Signer
+	inter     *x509.Certificate
+	leaf      *x509.Certificate
+	roots     *x509.CertPool
+	inters    *x509.CertPool
+	otherKey  crypto.Signer
+	otherRoot *x509.Certificate
+}
+
+func newRevocationPKI(t *testing.T) *revocationPKI {
+	t.Helper()
+	p := &revocationPKI{now: time.Now()}
+
+	newKey := func() crypto.Signer {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	newCert := func(serial int64, cn string, isCA bool, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             p.now.Add(-time.Hour),
+			NotAfter:              p.now.Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if isCA {
+			template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		} else {
+			template.DNSNames = []string{cn}
+		}
+		if parent == nil {
+			parent = template
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	p.rootKey = newKey()
+	p.root = newCert(1, "Revocation Root", true, nil, p.rootKey.Public(), p.rootKey)
+	p.interKey = newKey()
+	p.inter = newCert(2, "Revocation Intermediate", true, p.root, p.interKey.Public(), p.rootKey)
+	leafKey := newKey()
+	p.leaf = newCert(3, "leaf.example.com", false, p.inter, leafKey.Public(), p.interKey)
+	p.otherKey = newKey()
+	p.otherRoot = newCert(1, "Revocation Intermediate", true, nil, p.otherKey.Public(), p.otherKey)
+
+	p.roots = x509.NewCertPool()
+	p.roots.AddCert(p.root)
+	p.inters = x509.NewCertPool()
+	p.inters.AddCert(p.inter)
+	return p
+}
+
+func (p *revocationPKI) ocspResponse(t *testing.T, issuer *x509.Certificate, key crypto.Signer, serial *big.Int, status int) []byte {
+	t.Helper()
+	der, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: serial,
+		ThisUpdate:   p.now.Add(-time.Minute),
+		NextUpdate:   p.now.Add(time.Hour),
+		RevokedAt:    p.now.Add(-time.Minute),
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func (p *revocationPKI) crl(t *testing.T, issuer *x509.Certificate, key crypto.Signer, serial *big.Int) *pkix.CertificateList {
+	t.Helper()
+	der, err := issuer.CreateCRL(rand.Reader, key, []pkix.RevokedCertificate{
+		{SerialNumber: serial, RevocationTime: p.now.Add(-time.Minute)},
+	}, p.now.Add(-time.Minute), p.now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestVerifyRevocation(t *testing.T) {
+	p := newRevocationPKI(t)
+
+	tests := []struct {
+		name          string
+		ocspResponses [][]byte
+		crls          []*pkix.CertificateList
+		revoked       *x509.Certificate
+	}{
+		{
+			name:          "LeafGood",
+			ocspResponses: [][]byte{p.ocspResponse(t, p.inter, p.interKey, p.leaf.SerialNumber, ocsp.Good)},
+		},
+		{
+			name:          "LeafRevokedOCSP",
+			ocspResponses: [][]byte{p.ocspResponse(t, p.inter, p.interKey, p.leaf.SerialNumber, ocsp.Revoked)},
+			revoked:       p.leaf,
+		},
+		{
+			name:          "IntermediateRevokedOCSP",
+			ocspResponses: [][]byte{p.ocspResponse(t, p.root, p.rootKey, p.inter.SerialNumber, ocsp.Revoked)},
+			revoked:       p.inter,
+		},
+		{
+			name:          "OCSPWrongSigner",
+			ocspResponses: [][]byte{p.ocspResponse(t, p.otherRoot, p.otherKey, p.leaf.SerialNumber, ocsp.Revoked)},
+		},
+		{
+			name:          "OCSPOtherSerial",
+			ocspResponses: [][]byte{p.ocspResponse(t, p.inter, p.interKey, big.NewInt(99), ocsp.Revoked)},
+		},
+		{
+			name:          "OCSPGarbage",
+			ocspResponses: [][]byte{{1, 2, 3}},
+		},
+		{
+			name:    "LeafRevokedCRL",
+			crls:    []*pkix.CertificateList{p.crl(t, p.inter, p.interKey, p.leaf.SerialNumber)},
+			revoked: p.leaf,
+		},
+		{
+			name:    "IntermediateRevokedCRL",
+			crls:    []*pkix.CertificateList{p.crl(t, p.root, p.rootKey, p.inter.SerialNumber)},
+			revoked: p.inter,
+		},
+		{
+			name: "CRLWrongSigner",
+			crls: []*pkix.CertificateList{p.crl(t, p.otherRoot, p.otherKey, p.leaf.SerialNumber)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chains, err := p.leaf.Verify(x509.VerifyOptions{
+				DNSName:       "leaf.example.com",
+				Roots:         p.roots,
+				Intermediates: p.inters,
+				CurrentTime:   p.now,
+				OCSPResponses: test.ocspResponses,
+				CRLs:          test.crls,
+			})
+			if test.revoked == nil {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				if len(chains) != 1 {
+					t.Fatalf("got %d chains, want 1", len(chains))
+				}
+				return
+			}
+			invalidErr, ok := err.(x509.CertificateInvalidError)
+			if !ok {
+				t.Fatalf("got error %v, want a CertificateInvalidError", err)
+			}
+			if invalidErr.Reason != x509.Revoked {
+				t.Errorf("got reason %v, want Revoked", invalidErr.Reason)
+			}
+			if !invalidErr.Cert.Equal(test.revoked) {
+				t.Errorf("got revoked certificate %q, want %q", invalidErr.Cert.Subject.CommonName, test.revoked.Subject.CommonName)
+			}
+		})
+	}
+}
+
+func (p *revocationPKI) revocationList(t *testing.T, number, base int64, entries ...x509.RevocationListEntry) *pkix.CertificateList {
+	t.Helper()
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                p.now.Add(-time.Minute),
+		NextUpdate:                p.now.Add(time.Hour),
+	}
+	if base >= 0 {
+		template.BaseCRLNumber = big.NewInt(base)
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, p.inter, p.interKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestVerifyRevocationDeltaCRL(t *testing.T) {
+	p := newRevocationPKI(t)
+
+	const (
+		certificateHold = 6
+		removeFromCRL   = 8
+	)
+	entry := func(reason int) x509.RevocationListEntry {
+		return x509.RevocationListEntry{
+			SerialNumber:   p.leaf.SerialNumber,
+			RevocationTime: p.now.Add(-time.Minute),
+			ReasonCode:     reason,
+		}
+	}
+	held := p.revocationList(t, 10, -1, entry(certificateHold))
+	empty := p.revocationList(t, 10, -1)
+
+	tests := []struct {
+		name    string
+		crls    []*pkix.CertificateList
+		revoked bool
+	}{
+		{
+			name:    "BaseOnly",
+			crls:    []*pkix.CertificateList{held},
+			revoked: true,
+		},
+		{
+			name: "DeltaRemoves",
+			crls: []*pkix.CertificateList{held, p.revocationList(t, 11, 10, entry(removeFromCRL))},
+		},
+		{
+			name: "DeltaRemovesOlderBase",
+			crls: []*pkix.CertificateList{p.revocationList(t, 11, 9, entry(removeFromCRL)), held},
+		},
+		{
+			name:    "DeltaForNewerBase",
+			crls:    []*pkix.CertificateList{held, p.revocationList(t, 13, 12, entry(removeFromCRL))},
+			revoked: true,
+		},
+		{
+			name:    "DeltaOlderThanBase",
+			crls:    []*pkix.CertificateList{held, p.revocationList(t, 10, 9, entry(removeFromCRL))},
+			revoked: true,
+		},
+		{
+			name: "NewestDeltaRemoves",
+			crls: []*pkix.CertificateList{
+				held,
+				p.revocationList(t, 12, 10, entry(removeFromCRL)),
+				p.revocationList(t, 11, 10, entry(certificateHold)),
+			},
+		},
+		{
+			name: "NewestDeltaRevokes",
+			crls: []*pkix.CertificateList{
+				empty,
+				p.revocationList(t, 11, 10, entry(removeFromCRL)),
+				p.revocationList(t, 12, 10, entry(certificateHold)),
+			},
+			revoked: true,
+		},
+		{
+			name:    "DeltaAdds",
+			crls:    []*pkix.CertificateList{empty, p.revocationList(t, 11, 10, entry(0))},
+			revoked: true,
+		},
+		{
+			name:    "DeltaWithoutBase",
+			crls:    []*pkix.CertificateList{p.revocationList(t, 11, 10, entry(0))},
+			revoked: true,
+		},
+		{
+			name: "RemoveWithoutBase",
+			crls: []*pkix.CertificateList{p.revocationList(t, 11, 10, entry(removeFromCRL))},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := p.leaf.Verify(x509.VerifyOptions{
+				DNSName:       "leaf.example.com",
+				Roots:         p.roots,
+				Intermediates: p.inters,
+				CurrentTime:   p.now,
+				CRLs:          test.crls,
+			})
+			if !test.revoked {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				return
+			}
+			invalidErr, ok := err.(x509.CertificateInvalidError)
+			if !ok || invalidErr.Reason != x509.Revoked {
+				t.Fatalf("got error %v, want a Revoked CertificateInvalidError", err)
+			}
+		})
+	}
+}
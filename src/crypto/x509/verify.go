@@ -6,6 +6,7 @@ package x509
 
 import (
 	"bytes"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"net"
@@ -65,6 +66,12 @@ const (
 	// CANotAuthorizedForExtKeyUsage results when an intermediate or root
 	// certificate does not permit a requested extended key usage.
 	CANotAuthorizedForExtKeyUsage
+	// Revoked results when a certificate in the chain is reported as revoked
+	// by one of the OCSP responses or CRLs given in the VerifyOptions.
+	Revoked
+	// InsufficientSCTs results when the leaf certificate isn't covered by
+	// valid SCTs from enough distinct Certificate Transparency logs.
+	InsufficientSCTs
 )
 
 // CertificateInvalidError results when an odd error occurs. Users of this
@@ -95,6 +102,10 @@ func (e CertificateInvalidError) Error() string {
 		return "x509: issuer has name constraints but leaf doesn't have a SAN extension"
 	case UnconstrainedName:
 		return "x509: issuer has name constraints but leaf contains unknown or unconstrained name: " + e.Detail
+	case Revoked:
+		return "x509: certificate has been revoked: " + e.Detail
+	case InsufficientSCTs:
+		return "x509: certificate does not comply with the Certificate Transparency policy: " + e.Detail
 	}
 	return "x509: unknown error"
 }
@@ -222,6 +233,54 @@ type VerifyOptions struct {
 	// certificates from consuming excessive amounts of CPU time when
 	// validating. It does not apply to the platform verifier.
 	MaxConstraintComparisions int
+
+	// OCSPResponses is an optional set of DER-encoded OCSP responses, such as
+	// those stapled to a TLS handshake, that are consulted for revocation
+	// checking. A chain is rejected if one of its certificates is reported
+	// as revoked by a response signed by its issuer, or by a delegated OCSP
+	// responder certificate that the issuer signed and that has the
+	// OCSPSigning extended key usage. Responses that don't match any
+	// certificate in the chain, or can't be parsed or verified, are ignored.
+	//
+	// The NextUpdate time of a response is not checked. A response can
+	// only cause a chain to be rejected, never accepted, so a stale
+	// response reporting a certificate as revoked still applies.
+	OCSPResponses [][]byte
+
+	// CRLs is an optional set of certificate revocation lists, as returned
+	// by ParseCRL, that are consulted for revocation checking. A chain is
+	// rejected if one of its certificates is listed in a CRL signed by its
+	// issuer. A delta CRL is applied on top of a complete CRL it updates,
+	// if one is present, so that its removeFromCRL entries lift revocations
+	// listed in the complete CRL.
+	//
+	// Revocation information is only used to reject chains; the absence of
+	// a response or CRL for a certificate is not an error.
+	CRLs []*pkix.CertificateList
+
+	// CTLogs is the set of Certificate Transparency logs trusted to issue
+	// SCTs. SCTs from other logs are ignored.
+	CTLogs []*CTLog
+
+	// SignedCertificateTimestamps is an optional set of TLS-encoded SCTs for
+	// the leaf certificate that were delivered separately from it, such as
+	// in the signed_certificate_timestamp TLS extension, as reported by
+	// crypto/tls in ConnectionState.SignedCertificateTimestamps. SCTs
+	// embedded in the leaf certificate are always considered.
+	SignedCertificateTimestamps [][]byte
+
+	// MinimumCTLogs is the minimum number of distinct logs from CTLogs that
+	// must have issued a valid SCT for the leaf certificate, either embedded
+	// in it or in SignedCertificateTimestamps. SCTs with a timestamp after
+	// CurrentTime are not valid, and malformed SCTs are ignored. Embedded
+	// SCTs are checked against the issuer of each candidate chain, so only
+	// chains through the issuer the precertificate was logged with pass.
+	// If zero, Certificate Transparency is not enforced.
+	//
+	// crypto/tls doesn't set these fields. A TLS client that wants to
+	// enforce Certificate Transparency can call Verify from
+	// Config.VerifyConnection.
+	MinimumCTLogs int
 }
 
 const (
@@ -773,7 +832,11 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 
 	// Use Windows's own verification and chain building.
 	if opts.Roots == nil && runtime.GOOS == "windows" {
-		return c.systemVerify(&opts)
+		chains, err = c.systemVerify(&opts)
+		if err != nil {
+			return nil, err
+		}
+		return applyChainPolicies(chains, &opts)
 	}
 
 	if opts.Roots == nil {
@@ -812,7 +875,7 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 	// If any key usage is acceptable then we're done.
 	for _, usage := range keyUsages {
 		if usage == ExtKeyUsageAny {
-			return candidateChains, nil
+			return applyChainPolicies(candidateChains, &opts)
 		}
 	}
 
@@ -826,7 +889,17 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 		return nil, CertificateInvalidError{c, IncompatibleUsage, ""}
 	}
 
-	return chains, nil
+	return applyChainPolicies(chains, &opts)
+}
+
+// applyChainPolicies removes from chains the chains rejected by the
+// revocation and Certificate Transparency policies of opts.
+func applyChainPolicies(chains [][]*Certificate, opts *VerifyOptions) ([][]*Certificate, error) {
+	chains, err := filterRevokedChains(chains, opts)
+	if err != nil {
+		return nil, err
+	}
+	return filterCTChains(chains, opts)
 }
 
 func appendToFreshChain(chain []*Certificate, cert *Certificate) []*Certificate {
@@ -1623,6 +1623,8 @@ var (
 	oidExtensionCRLDistributionPoints = []int{2, 5, 29, 31}
 	oidExtensionAuthorityInfoAccess   = []int{1, 3, 6, 1, 5, 5, 7, 1, 1}
 	oidExtensionCRLNumber             = []int{2, 5, 29, 20}
+	oidExtensionReasonCode            = []int{2, 5, 29, 21}
+	oidExtensionDeltaCRLIndicator     = []int{2, 5, 29, 27}
 )
 
 var (
@@ -2394,6 +2396,14 @@ type CertificateRequest struct {
 	EmailAddresses []string
 	IPAddresses    []net.IP
 	URIs           []*url.URL
+
+	// ChallengePassword is the PKCS #9 challengePassword attribute, which a
+	// CA may use to authenticate the request, or a later revocation request
+	// for the certificate. It is populated by ParseCertificateRequest, which
+	// leaves it empty if the attribute doesn't hold a single string, and
+	// included by CreateCertificateRequest if not empty and not overridden
+	// by Attributes. See RFC 2985, Section 5.4.1.
+	ChallengePassword string
 }
 
 // These structures reflect the ASN.1 structure of X.509 certificate
@@ -2418,6 +2428,10 @@ type certificateRequest struct {
 // extensions in a CSR.
 var oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
 
+// oidChallengePassword is a PKCS #9 OBJECT IDENTIFIER that indicates a
+// challenge password in a CSR.
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
 // newRawAttributes converts AttributeTypeAndValueSETs from a template
 // CertificateRequest's Attributes into tbsCertificateRequest RawAttributes.
 func newRawAttributes(attributes []pkix.AttributeTypeAndValueSET) ([]asn1.RawValue, error) {
@@ -2436,6 +2450,16 @@ func newRawAttributes(attributes []pkix.AttributeTypeAndValueSET) ([]asn1.RawVal
 	return rawAttributes, nil
 }
 
+// attributesContain reports whether attributes has an attribute of type oid.
+func attributesContain(attributes []pkix.AttributeTypeAndValueSET, oid asn1.ObjectIdentifier) bool {
+	for _, attr := range attributes {
+		if attr.Type.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseRawAttributes Unmarshals RawAttributes into AttributeTypeAndValueSETs.
 func parseRawAttributes(rawAttributes []asn1.RawValue) []pkix.AttributeTypeAndValueSET {
 	var attributes []pkix.AttributeTypeAndValueSET
@@ -2451,15 +2475,15 @@ func parseRawAttributes(rawAttributes []asn1.RawValue) []pkix.AttributeTypeAndVa
 	return attributes
 }
 
+// pkcs10Attribute reflects the Attribute structure from RFC 2986, Section 4.1.
+type pkcs10Attribute struct {
+	Id     asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
 // parseCSRExtensions parses the attributes from a CSR and extracts any
 // requested extensions.
 func parseCSRExtensions(rawAttributes []asn1.RawValue) ([]pkix.Extension, error) {
-	// pkcs10Attribute reflects the Attribute structure from RFC 2986, Section 4.1.
-	type pkcs10Attribute struct {
-		Id     asn1.ObjectIdentifier
-		Values []asn1.RawValue `asn1:"set"`
-	}
-
 	var ret []pkix.Extension
 	for _, rawAttr := range rawAttributes {
 		var attr pkcs10Attribute
@@ -2482,6 +2506,30 @@ func parseCSRExtensions(rawAttributes []asn1.RawValue) ([]pkix.Extension, error)
 	return ret, nil
 }
 
+// parseCSRChallengePassword parses the attributes from a CSR and extracts
+// the challenge password, if any. A challengePassword attribute that doesn't
+// hold a single string is ignored; see CertificateRequest.Verify.
+func parseCSRChallengePassword(rawAttributes []asn1.RawValue) string {
+	for _, rawAttr := range rawAttributes {
+		var attr pkcs10Attribute
+		if rest, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil || len(rest) != 0 || len(attr.Values) == 0 {
+			// Ignore attributes that don't parse.
+			continue
+		}
+
+		if !attr.Id.Equal(oidChallengePassword) || len(attr.Values) != 1 {
+			continue
+		}
+		var password string
+		if rest, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password); err != nil || len(rest) != 0 {
+			continue
+		}
+		return password
+	}
+
+	return ""
+}
+
 // CreateCertificateRequest creates a new certificate request based on a
 // template. The following members of template are used:
 //
@@ -2492,6 +2540,7 @@ func parseCSRExtensions(rawAttributes []asn1.RawValue) ([]pkix.Extension, error)
 //  - IPAddresses
 //  - URIs
 //  - ExtraExtensions
+//  - ChallengePassword
 //  - Attributes (deprecated)
 //
 // priv is the private key to sign the CSR with, and the corresponding public
@@ -2584,6 +2633,30 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 		return
 	}
 
+	// Add the challenge password unless it was specified in Attributes.
+	if template.ChallengePassword != "" && !attributesContain(attributes, oidChallengePassword) {
+		// asn1.Marshal picks a PrintableString or a UTF8String, both valid
+		// DirectoryString choices.
+		password, err := asn1.Marshal(template.ChallengePassword)
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(pkcs10Attribute{
+			Id:     oidChallengePassword,
+			Values: []asn1.RawValue{{FullBytes: password}},
+		})
+		if err != nil {
+			return nil, errors.New("x509: failed to serialise challengePassword attribute: " + err.Error())
+		}
+
+		var rawValue asn1.RawValue
+		if _, err := asn1.Unmarshal(b, &rawValue); err != nil {
+			return nil, err
+		}
+
+		rawAttributes = append(rawAttributes, rawValue)
+	}
+
 	// If not included in attributes, add a new attribute for the
 	// extensions.
 	if len(extensions) > 0 && !extensionsAppended {
@@ -2708,6 +2781,8 @@ func parseCertificateRequest(in *certificateRequest) (*CertificateRequest, error
 		return nil, err
 	}
 
+	out.ChallengePassword = parseCSRChallengePassword(in.TBSCSR.RawAttributes)
+
 	for _, extension := range out.Extensions {
 		switch {
 		case extension.Id.Equal(oidExtensionSubjectAltName):
@@ -2726,23 +2801,175 @@ func (c *CertificateRequest) CheckSignature() error {
 	return checkSignature(c.SignatureAlgorithm, c.RawTBSCertificateRequest, c.Signature, c.PublicKey)
 }
 
-// RevocationList contains the fields used to create an X.509 v2 Certificate
-// Revocation list with CreateRevocationList.
+// Verify checks that c, as returned by ParseCertificateRequest, is a
+// consistent and correctly self-signed certificate request. In addition to
+// the signature checked by CheckSignature, it requires that
+//
+//  - every attribute is well formed and has at least one value;
+//  - the extensionRequest and challengePassword attributes appear at most
+//    once, each with a single value;
+//  - no extension is requested more than once;
+//  - the challenge password, if present, is a string.
+//
+// ParseCertificateRequest ignores malformed attributes it doesn't need, so a
+// CA should call Verify before acting on a request. Verify doesn't check the
+// subject or the requested extensions against any issuance policy.
+func (c *CertificateRequest) Verify() error {
+	if err := c.CheckSignature(); err != nil {
+		return err
+	}
+
+	var tbs tbsCertificateRequest
+	if rest, err := asn1.Unmarshal(c.RawTBSCertificateRequest, &tbs); err != nil {
+		return err
+	} else if len(rest) != 0 {
+		return errors.New("x509: trailing data after certificate request")
+	}
+
+	seenAttributes := make(map[string]bool)
+	seenExtensions := make(map[string]bool)
+	for _, rawAttr := range tbs.RawAttributes {
+		var attr pkcs10Attribute
+		if rest, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil {
+			return err
+		} else if len(rest) != 0 {
+			return errors.New("x509: trailing data after CSR attribute")
+		}
+		if len(attr.Values) == 0 {
+			return errors.New("x509: CSR attribute " + attr.Id.String() + " has no values")
+		}
+
+		isExtensionRequest := attr.Id.Equal(oidExtensionRequest)
+		if !isExtensionRequest && !attr.Id.Equal(oidChallengePassword) {
+			continue
+		}
+		if seenAttributes[attr.Id.String()] {
+			return errors.New("x509: CSR contains duplicate attribute " + attr.Id.String())
+		}
+		seenAttributes[attr.Id.String()] = true
+		if len(attr.Values) != 1 {
+			return errors.New("x509: CSR attribute " + attr.Id.String() + " must have a single value")
+		}
+
+		if !isExtensionRequest {
+			var password string
+			if rest, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password); err != nil || len(rest) != 0 {
+				return errors.New("x509: CSR challengePassword is not a string")
+			}
+			continue
+		}
+
+		var extensions []pkix.Extension
+		if rest, err := asn1.Unmarshal(attr.Values[0].FullBytes, &extensions); err != nil {
+			return err
+		} else if len(rest) != 0 {
+			return errors.New("x509: trailing data after CSR extension request")
+		}
+		for _, ext := range extensions {
+			if seenExtensions[ext.Id.String()] {
+				return errors.New("x509: CSR requests duplicate extension " + ext.Id.String())
+			}
+			seenExtensions[ext.Id.String()] = true
+		}
+	}
+
+	return nil
+}
+
+// RevocationListEntry represents an entry in the revokedCertificates
+// sequence of a CRL.
+type RevocationListEntry struct {
+	// Raw contains the raw bytes of the revokedCertificates entry. It is set
+	// when parsing a CRL; it is ignored when generating a CRL.
+	Raw []byte
+
+	// SerialNumber represents the serial number of a revoked certificate. It
+	// is both used when creating a CRL and populated when parsing a CRL. It
+	// must not be nil.
+	SerialNumber *big.Int
+	// RevocationTime represents the time at which the certificate was
+	// revoked. It is both used when creating a CRL and populated when parsing
+	// a CRL. It must not be the zero time.
+	RevocationTime time.Time
+	// ReasonCode represents the reason for revocation, using the integer enum
+	// values specified in RFC 5280 Section 5.3.1. When creating a CRL, the
+	// zero value will result in the reasonCode extension being omitted. When
+	// parsing a CRL, the zero value may represent either the reasonCode
+	// extension being absent (which implies the default revocation reason of
+	// 0/Unspecified), or it may represent the reasonCode extension being
+	// present and explicitly containing a value of 0/Unspecified (which should
+	// not happen per the DER encoding rules, but can and does happen anyway).
+	ReasonCode int
+
+	// Extensions contains raw X.509 extensions. When parsing CRL entries,
+	// this can be used to extract non-critical extensions that are not
+	// parsed by this package. When marshaling CRL entries, the Extensions
+	// field is ignored, see ExtraExtensions.
+	Extensions []pkix.Extension
+	// ExtraExtensions contains extensions to be copied, raw, into any
+	// marshaled CRL entries. Values override any extensions that would
+	// otherwise be produced based on the other fields, such as ReasonCode.
+	// The ExtraExtensions field is not populated when parsing CRL entries,
+	// see Extensions.
+	ExtraExtensions []pkix.Extension
+}
+
+// RevocationList represents a Certificate Revocation List (CRL) as specified
+// by RFC 5280. It's used to create a CRL with CreateRevocationList, and it's
+// returned by ParseRevocationList.
 type RevocationList struct {
+	// Raw contains the complete ASN.1 DER content of the CRL (tbsCertList,
+	// signatureAlgorithm, and signatureValue.)
+	Raw []byte
+	// RawTBSRevocationList contains just the tbsCertList portion of the
+	// ASN.1 DER.
+	RawTBSRevocationList []byte
+	// RawIssuer contains the DER encoded Issuer.
+	RawIssuer []byte
+
+	// Issuer contains the DN of the issuing certificate. It is populated when
+	// parsing a CRL, and ignored when creating one, in which case it's taken
+	// from the issuer certificate.
+	Issuer pkix.Name
+	// AuthorityKeyId is used to identify the public key associated with the
+	// issuing certificate. It is populated from the authorityKeyIdentifier
+	// extension when parsing a CRL. It is ignored when creating a CRL; the
+	// extension is populated from the issuing certificate itself.
+	AuthorityKeyId []byte
+
+	Signature []byte
 	// SignatureAlgorithm is used to determine the signature algorithm to be
 	// used when signing the CRL. If 0 the default algorithm for the signing
 	// key will be used.
 	SignatureAlgorithm SignatureAlgorithm
 
+	// RevokedCertificateEntries represents the revokedCertificates sequence
+	// in the CRL. It is used when creating a CRL and also populated when
+	// parsing a CRL. When creating a CRL, it may be empty or nil, in which
+	// case the revokedCertificates ASN.1 sequence will be omitted from the
+	// CRL entirely.
+	RevokedCertificateEntries []RevocationListEntry
+
 	// RevokedCertificates is used to populate the revokedCertificates
-	// sequence in the CRL, it may be empty. RevokedCertificates may be nil,
-	// in which case an empty CRL will be created.
+	// sequence in the CRL if RevokedCertificateEntries is empty. It may be
+	// empty or nil, in which case an empty CRL will be created.
+	//
+	// Deprecated: Use RevokedCertificateEntries instead.
 	RevokedCertificates []pkix.RevokedCertificate
 
 	// Number is used to populate the X.509 v2 cRLNumber extension in the CRL,
 	// which should be a monotonically increasing sequence number for a given
-	// CRL scope and CRL issuer.
+	// CRL scope and CRL issuer. It is also populated from the cRLNumber
+	// extension when parsing a CRL.
 	Number *big.Int
+
+	// BaseCRLNumber, if not nil, makes the CRL a delta CRL, and is used to
+	// populate the critical deltaCRLIndicator extension, which identifies
+	// the complete CRL the delta CRL updates. It must be less than Number.
+	// It is also populated from the deltaCRLIndicator extension when parsing
+	// a CRL. See RFC 5280, Section 5.2.4.
+	BaseCRLNumber *big.Int
+
 	// ThisUpdate is used to populate the thisUpdate field in the CRL, which
 	// indicates the issuance date of the CRL.
 	ThisUpdate time.Time
@@ -2750,6 +2977,11 @@ type RevocationList struct {
 	// indicates the date by which the next CRL will be issued. NextUpdate
 	// must be greater than ThisUpdate.
 	NextUpdate time.Time
+
+	// Extensions contains raw X.509 extensions. When creating a CRL,
+	// the Extensions field is ignored, see ExtraExtensions.
+	Extensions []pkix.Extension
+
 	// ExtraExtensions contains any additional extensions to add directly to
 	// the CRL.
 	ExtraExtensions []pkix.Extension
@@ -2786,17 +3018,49 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 	if template.Number == nil {
 		return nil, errors.New("x509: template contains nil Number field")
 	}
+	if template.BaseCRLNumber != nil && template.BaseCRLNumber.Cmp(template.Number) >= 0 {
+		return nil, errors.New("x509: template.BaseCRLNumber is not less than template.Number")
+	}
 
 	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(priv.Public(), template.SignatureAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
-	// Force revocation times to UTC per RFC 5280.
-	revokedCertsUTC := make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
-	for i, rc := range template.RevokedCertificates {
-		rc.RevocationTime = rc.RevocationTime.UTC()
-		revokedCertsUTC[i] = rc
+	var revokedCertsUTC []pkix.RevokedCertificate
+	if len(template.RevokedCertificateEntries) == 0 {
+		// Force revocation times to UTC per RFC 5280.
+		revokedCertsUTC = make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
+		for i, rc := range template.RevokedCertificates {
+			rc.RevocationTime = rc.RevocationTime.UTC()
+			revokedCertsUTC[i] = rc
+		}
+	} else {
+		revokedCertsUTC = make([]pkix.RevokedCertificate, len(template.RevokedCertificateEntries))
+		for i, rce := range template.RevokedCertificateEntries {
+			if rce.SerialNumber == nil {
+				return nil, errors.New("x509: template contains entry with nil SerialNumber field")
+			}
+			if rce.RevocationTime.IsZero() {
+				return nil, errors.New("x509: template contains entry with zero RevocationTime field")
+			}
+			rc := pkix.RevokedCertificate{
+				SerialNumber:   rce.SerialNumber,
+				RevocationTime: rce.RevocationTime.UTC(),
+			}
+			if rce.ReasonCode != 0 && !oidInExtensions(oidExtensionReasonCode, rce.ExtraExtensions) {
+				reasonBytes, err := asn1.Marshal(asn1.Enumerated(rce.ReasonCode))
+				if err != nil {
+					return nil, err
+				}
+				rc.Extensions = append(rc.Extensions, pkix.Extension{
+					Id:    oidExtensionReasonCode,
+					Value: reasonBytes,
+				})
+			}
+			rc.Extensions = append(rc.Extensions, rce.ExtraExtensions...)
+			revokedCertsUTC[i] = rc
+		}
 	}
 
 	aki, err := asn1.Marshal(authKeyId{Id: issuer.SubjectKeyId})
@@ -2825,6 +3089,17 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 			},
 		},
 	}
+	if template.BaseCRLNumber != nil {
+		baseCRLNum, err := asn1.Marshal(template.BaseCRLNumber)
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{
+			Id:       oidExtensionDeltaCRLIndicator,
+			Critical: true,
+			Value:    baseCRLNum,
+		})
+	}
 	if len(revokedCertsUTC) > 0 {
 		tbsCertList.RevokedCertificates = revokedCertsUTC
 	}
@@ -2863,3 +3138,168 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
 	})
 }
+
+// These structures reflect the ASN.1 structure of X.509 v2 CRLs (see RFC
+// 5280, Section 5.1). Unlike pkix.CertificateList, they keep the raw encoding
+// of the issuer and of each entry.
+
+type certificateList struct {
+	Raw                asn1.RawContent
+	TBSCertList        tbsCertificateList
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateList struct {
+	Raw                 asn1.RawContent
+	Version             int `asn1:"optional,default:0"`
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time            `asn1:"optional"`
+	RevokedCertificates []revokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension     `asn1:"tag:0,optional,explicit"`
+}
+
+type revokedCertificate struct {
+	Raw            asn1.RawContent
+	SerialNumber   *big.Int
+	RevocationTime time.Time
+	Extensions     []pkix.Extension `asn1:"optional"`
+}
+
+// ParseRevocationList parses a X509 v2 Certificate Revocation List from the
+// given ASN.1 DER data.
+func ParseRevocationList(der []byte) (*RevocationList, error) {
+	var crl certificateList
+	if rest, err := asn1.Unmarshal(der, &crl); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after CRL")
+	}
+	tbs := &crl.TBSCertList
+
+	// The version is v1 (0) or v2 (1). Extensions are only allowed in v2.
+	if tbs.Version < 0 || tbs.Version > 1 {
+		return nil, errors.New("x509: unsupported crl version")
+	}
+	if tbs.Version == 0 && len(tbs.Extensions) > 0 {
+		return nil, errors.New("x509: v1 crl contains extensions")
+	}
+	if !tbs.Signature.Algorithm.Equal(crl.SignatureAlgorithm.Algorithm) {
+		return nil, errors.New("x509: inner and outer signature algorithm identifiers don't match")
+	}
+
+	rl := &RevocationList{
+		Raw:                  crl.Raw,
+		RawTBSRevocationList: tbs.Raw,
+		RawIssuer:            tbs.Issuer.FullBytes,
+		Signature:            crl.SignatureValue.RightAlign(),
+		SignatureAlgorithm:   getSignatureAlgorithmFromAI(crl.SignatureAlgorithm),
+		ThisUpdate:           tbs.ThisUpdate,
+		NextUpdate:           tbs.NextUpdate,
+		Extensions:           tbs.Extensions,
+	}
+
+	var issuer pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(tbs.Issuer.FullBytes, &issuer); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after X.509 issuer")
+	}
+	rl.Issuer.FillFromRDNSequence(&issuer)
+
+	seen := make(map[string]bool)
+	for _, ext := range tbs.Extensions {
+		if seen[ext.Id.String()] {
+			return nil, errors.New("x509: crl contains duplicate extension " + ext.Id.String())
+		}
+		seen[ext.Id.String()] = true
+
+		switch {
+		case ext.Id.Equal(oidExtensionAuthorityKeyId):
+			var a authKeyId
+			if rest, err := asn1.Unmarshal(ext.Value, &a); err != nil {
+				return nil, err
+			} else if len(rest) != 0 {
+				return nil, errors.New("x509: trailing data after X.509 authority key-id")
+			}
+			rl.AuthorityKeyId = a.Id
+		case ext.Id.Equal(oidExtensionCRLNumber):
+			number, err := parseCRLNumber(ext.Value)
+			if err != nil {
+				return nil, errors.New("x509: invalid CRL number")
+			}
+			rl.Number = number
+		case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+			number, err := parseCRLNumber(ext.Value)
+			if err != nil {
+				return nil, errors.New("x509: invalid delta CRL indicator")
+			}
+			rl.BaseCRLNumber = number
+		}
+	}
+
+	for _, rc := range tbs.RevokedCertificates {
+		rce := RevocationListEntry{
+			Raw:            rc.Raw,
+			SerialNumber:   rc.SerialNumber,
+			RevocationTime: rc.RevocationTime,
+			Extensions:     rc.Extensions,
+		}
+		for _, ext := range rc.Extensions {
+			if !ext.Id.Equal(oidExtensionReasonCode) {
+				continue
+			}
+			var reason asn1.Enumerated
+			if rest, err := asn1.Unmarshal(ext.Value, &reason); err != nil {
+				return nil, err
+			} else if len(rest) != 0 {
+				return nil, errors.New("x509: trailing data after CRL entry reason code")
+			}
+			rce.ReasonCode = int(reason)
+		}
+		rl.RevokedCertificateEntries = append(rl.RevokedCertificateEntries, rce)
+		rl.RevokedCertificates = append(rl.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   rc.SerialNumber,
+			RevocationTime: rc.RevocationTime,
+			Extensions:     rc.Extensions,
+		})
+	}
+
+	return rl, nil
+}
+
+// parseCRLNumber parses the value of a cRLNumber or deltaCRLIndicator
+// extension, a non-negative INTEGER. See RFC 5280, Section 5.2.3.
+func parseCRLNumber(der []byte) (*big.Int, error) {
+	number := new(big.Int)
+	if rest, err := asn1.Unmarshal(der, &number); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after CRL number")
+	}
+	if number.Sign() < 0 {
+		return nil, errors.New("x509: negative CRL number")
+	}
+	return number, nil
+}
+
+// CheckSignatureFrom verifies that the signature on rl is a valid signature
+// from parent, which must be a CA certificate allowed to sign CRLs.
+func (rl *RevocationList) CheckSignatureFrom(parent *Certificate) error {
+	if parent.Version == 3 && !parent.BasicConstraintsValid ||
+		parent.BasicConstraintsValid && !parent.IsCA {
+		return ConstraintViolationError{}
+	}
+
+	if parent.KeyUsage != 0 && parent.KeyUsage&KeyUsageCRLSign == 0 {
+		return ConstraintViolationError{}
+	}
+
+	if parent.PublicKeyAlgorithm == UnknownPublicKeyAlgorithm {
+		return ErrUnsupportedAlgorithm
+	}
+
+	return parent.CheckSignature(rl.SignatureAlgorithm, rl.RawTBSRevocationList, rl.Signature)
+}
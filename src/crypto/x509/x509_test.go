@@ -2454,6 +2454,46 @@ func TestCreateRevocationList(t *testing.T) {
 			},
 			expectedError: "x509: template contains nil Number field",
 		},
+		{
+			name: "BaseCRLNumber not less than Number",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				Number:        big.NewInt(5),
+				BaseCRLNumber: big.NewInt(5),
+				ThisUpdate:    time.Time{}.Add(time.Hour * 24),
+				NextUpdate:    time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: template.BaseCRLNumber is not less than template.Number",
+		},
+		{
+			name: "entry without SerialNumber",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				RevokedCertificateEntries: []RevocationListEntry{
+					{
+						RevocationTime: time.Time{}.Add(time.Hour),
+					},
+				},
+				Number:     big.NewInt(5),
+				ThisUpdate: time.Time{}.Add(time.Hour * 24),
+				NextUpdate: time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: template contains entry with nil SerialNumber field",
+		},
 		{
 			name: "invalid signature algorithm",
 			key:  ec256Priv,
@@ -2661,6 +2701,279 @@ func TestCreateRevocationList(t *testing.T) {
 	}
 }
 
+func TestParseRevocationList(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA P256 key: %s", err)
+	}
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL Test CA", Organization: []string{"Acme Co"}},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %s", err)
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %s", err)
+	}
+
+	invalidityDate := pkix.Extension{Id: []int{2, 5, 29, 24}, Value: []byte{0x18, 0x0f,
+		'2', '0', '2', '1', '0', '1', '0', '1', '0', '0', '0', '0', '0', '0', 'Z'}}
+	extraExtension := pkix.Extension{Id: []int{2, 5, 29, 99}, Value: []byte{5, 0}}
+	template := &RevocationList{
+		RevokedCertificateEntries: []RevocationListEntry{
+			{
+				SerialNumber:   big.NewInt(2),
+				RevocationTime: time.Unix(2000, 0),
+			},
+			{
+				SerialNumber:   big.NewInt(3),
+				RevocationTime: time.Unix(3000, 0),
+				ReasonCode:     1, // keyCompromise
+			},
+			{
+				SerialNumber:    big.NewInt(4),
+				RevocationTime:  time.Unix(4000, 0),
+				ReasonCode:      8, // removeFromCRL
+				ExtraExtensions: []pkix.Extension{invalidityDate},
+			},
+		},
+		Number:          big.NewInt(12),
+		BaseCRLNumber:   big.NewInt(10),
+		ThisUpdate:      time.Unix(5000, 0),
+		NextUpdate:      time.Unix(6000, 0),
+		ExtraExtensions: []pkix.Extension{extraExtension},
+	}
+	der, err := CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		t.Fatalf("CreateRevocationList failed: %s", err)
+	}
+
+	crl, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatalf("ParseRevocationList failed: %s", err)
+	}
+	if !bytes.Equal(crl.Raw, der) {
+		t.Errorf("Raw doesn't match the input")
+	}
+	if !bytes.Equal(crl.RawIssuer, ca.RawSubject) {
+		t.Errorf("RawIssuer = %x, want %x", crl.RawIssuer, ca.RawSubject)
+	}
+	if crl.Issuer.String() != ca.Subject.String() {
+		t.Errorf("Issuer = %v, want %v", crl.Issuer, ca.Subject)
+	}
+	if !bytes.Equal(crl.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Errorf("AuthorityKeyId = %x, want %x", crl.AuthorityKeyId, ca.SubjectKeyId)
+	}
+	if crl.SignatureAlgorithm != ECDSAWithSHA256 {
+		t.Errorf("SignatureAlgorithm = %v, want %v", crl.SignatureAlgorithm, ECDSAWithSHA256)
+	}
+	if crl.Number.Cmp(template.Number) != 0 {
+		t.Errorf("Number = %v, want %v", crl.Number, template.Number)
+	}
+	if crl.BaseCRLNumber == nil || crl.BaseCRLNumber.Cmp(template.BaseCRLNumber) != 0 {
+		t.Errorf("BaseCRLNumber = %v, want %v", crl.BaseCRLNumber, template.BaseCRLNumber)
+	}
+	if !crl.ThisUpdate.Equal(template.ThisUpdate) || !crl.NextUpdate.Equal(template.NextUpdate) {
+		t.Errorf("ThisUpdate, NextUpdate = %v, %v, want %v, %v", crl.ThisUpdate, crl.NextUpdate,
+			template.ThisUpdate, template.NextUpdate)
+	}
+	if len(crl.Extensions) != 4 || !crl.Extensions[2].Id.Equal(oidExtensionDeltaCRLIndicator) ||
+		!crl.Extensions[2].Critical || !reflect.DeepEqual(crl.Extensions[3], extraExtension) {
+		t.Errorf("unexpected Extensions: %v", crl.Extensions)
+	}
+
+	if len(crl.RevokedCertificateEntries) != len(template.RevokedCertificateEntries) {
+		t.Fatalf("got %d entries, want %d", len(crl.RevokedCertificateEntries), len(template.RevokedCertificateEntries))
+	}
+	for i, got := range crl.RevokedCertificateEntries {
+		want := template.RevokedCertificateEntries[i]
+		if got.SerialNumber.Cmp(want.SerialNumber) != 0 || !got.RevocationTime.Equal(want.RevocationTime) ||
+			got.ReasonCode != want.ReasonCode {
+			t.Errorf("entry %d = {%v, %v, %d}, want {%v, %v, %d}", i, got.SerialNumber, got.RevocationTime,
+				got.ReasonCode, want.SerialNumber, want.RevocationTime, want.ReasonCode)
+		}
+		if len(got.Raw) == 0 || !bytes.Contains(crl.RawTBSRevocationList, got.Raw) {
+			t.Errorf("entry %d has unexpected Raw %x", i, got.Raw)
+		}
+	}
+	if exts := crl.RevokedCertificateEntries[0].Extensions; len(exts) != 0 {
+		t.Errorf("entry 0 has unexpected extensions %v", exts)
+	}
+	if exts := crl.RevokedCertificateEntries[2].Extensions; len(exts) != 2 ||
+		!exts[0].Id.Equal(oidExtensionReasonCode) || !reflect.DeepEqual(exts[1], invalidityDate) {
+		t.Errorf("entry 2 has unexpected extensions %v", exts)
+	}
+	if len(crl.RevokedCertificates) != len(crl.RevokedCertificateEntries) {
+		t.Errorf("got %d deprecated RevokedCertificates, want %d", len(crl.RevokedCertificates), len(crl.RevokedCertificateEntries))
+	}
+
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("CheckSignatureFrom failed: %s", err)
+	}
+	otherCA := *ca
+	otherCA.KeyUsage = KeyUsageCertSign
+	if err := crl.CheckSignatureFrom(&otherCA); err == nil {
+		t.Error("CheckSignatureFrom succeeded for an issuer without the crlSign key usage")
+	}
+	crl.Signature[len(crl.Signature)-1] ^= 0xff
+	if err := crl.CheckSignatureFrom(ca); err == nil {
+		t.Error("CheckSignatureFrom succeeded with a corrupted signature")
+	}
+
+	if _, err := ParseRevocationList(append(der, 0)); err == nil {
+		t.Error("ParseRevocationList succeeded with trailing data")
+	}
+	if _, err := ParseRevocationList(der[:len(der)-1]); err == nil {
+		t.Error("ParseRevocationList succeeded with truncated input")
+	}
+}
+
+func TestCertificateRequestChallengePassword(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"password", "pässwörd"} {
+		der, err := CreateCertificateRequest(rand.Reader, &CertificateRequest{
+			Subject:           pkix.Name{CommonName: "test"},
+			DNSNames:          []string{"example.com"},
+			ChallengePassword: password,
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if csr.ChallengePassword != password {
+			t.Errorf("ChallengePassword = %q, want %q", csr.ChallengePassword, password)
+		}
+		if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "example.com" {
+			t.Errorf("DNSNames = %v, want [example.com]", csr.DNSNames)
+		}
+		if err := csr.Verify(); err != nil {
+			t.Errorf("Verify failed: %s", err)
+		}
+	}
+
+	der, err := CreateCertificateRequest(rand.Reader, &CertificateRequest{
+		Subject: pkix.Name{CommonName: "test"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.ChallengePassword != "" {
+		t.Errorf("ChallengePassword = %q, want empty", csr.ChallengePassword)
+	}
+}
+
+func TestCertificateRequestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := pkix.Extension{Id: []int{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}
+	nonString := pkix.AttributeTypeAndValueSET{
+		Type: oidChallengePassword,
+		Value: [][]pkix.AttributeTypeAndValue{
+			{{Type: []int{2, 5, 4, 6}, Value: "US"}},
+		},
+	}
+	multiValued := pkix.AttributeTypeAndValueSET{
+		Type: oidChallengePassword,
+		Value: [][]pkix.AttributeTypeAndValue{
+			{{Type: []int{2, 5, 4, 6}, Value: "US"}},
+			{{Type: []int{2, 5, 4, 6}, Value: "GB"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template *CertificateRequest
+		wantErr  string
+	}{
+		{
+			name: "Valid",
+			template: &CertificateRequest{
+				DNSNames:          []string{"example.com"},
+				ExtraExtensions:   []pkix.Extension{ext},
+				ChallengePassword: "password",
+			},
+		},
+		{
+			name:     "DuplicateExtension",
+			template: &CertificateRequest{ExtraExtensions: []pkix.Extension{ext, ext}},
+			wantErr:  "duplicate extension",
+		},
+		{
+			name:     "NonStringChallengePassword",
+			template: &CertificateRequest{Attributes: []pkix.AttributeTypeAndValueSET{nonString}},
+			wantErr:  "not a string",
+		},
+		{
+			name:     "MultiValuedChallengePassword",
+			template: &CertificateRequest{Attributes: []pkix.AttributeTypeAndValueSET{multiValued}},
+			wantErr:  "single value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.template.Subject = pkix.Name{CommonName: "test"}
+			der, err := CreateCertificateRequest(rand.Reader, test.template, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Malformed attributes must not make parsing fail.
+			csr, err := ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatalf("ParseCertificateRequest failed: %s", err)
+			}
+			if test.wantErr != "" && csr.ChallengePassword != "" {
+				t.Errorf("ChallengePassword = %q, want empty", csr.ChallengePassword)
+			}
+			err = csr.Verify()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify failed: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Verify = %v, want error containing %q", err, test.wantErr)
+			}
+		})
+	}
+
+	der, err := CreateCertificateRequest(rand.Reader, &CertificateRequest{
+		Subject: pkix.Name{CommonName: "test"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr.Signature[len(csr.Signature)-1] ^= 1
+	if err := csr.Verify(); err == nil {
+		t.Error("Verify succeeded with a corrupted signature")
+	}
+}
+
 func TestRSAPSAParameters(t *testing.T) {
 	generateParams := func(hashFunc crypto.Hash) []byte {
 		var hashOID asn1.ObjectIdentifier
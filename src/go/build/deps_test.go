@@ -238,7 +238,7 @@ var depsRules = `
 
 	# compression
 	FMT, encoding/binary, hash/adler32, hash/crc32
-	< compress/bzip2, compress/flate, compress/lzw
+	< compress/bzip2, compress/flate, compress/lzw, compress/zstd
 	< archive/zip, compress/gzip, compress/zlib;
 
 	# templates
@@ -335,6 +335,14 @@ var depsRules = `
 	sync
 	< internal/singleflight;
 
+	RUNTIME
+	< internal/intern;
+
+	# net/netip is a small package of IP address value types
+	# that net builds on.
+	internal/bytealg, internal/intern, math, math/bits, strconv
+	< net/netip;
+
 	os
 	< golang.org/x/net/dns/dnsmessage,
 	  golang.org/x/net/lif,
@@ -352,6 +360,7 @@ var depsRules = `
 	internal/poll,
 	internal/singleflight,
 	internal/race,
+	net/netip,
 	os
 	< net;
 
@@ -367,9 +376,17 @@ var depsRules = `
 
 	# logging - most packages should not import; http and up is allowed
 	FMT
+	< log/internal
 	< log;
 
-	log !< crypto/tls, database/sql, go/importer, testing;
+	log, log/slog !< crypto/tls, database/sql, go/importer, testing;
+
+	FMT
+	< log/slog/internal/buffer;
+
+	FMT, encoding, encoding/json,
+	log, log/internal, log/slog/internal/buffer
+	< log/slog;
 
 	FMT, log, net
 	< log/syslog;
@@ -385,7 +402,9 @@ var depsRules = `
 	< crypto/internal/subtle
 	< crypto/cipher
 	< crypto/aes, crypto/des, crypto/hmac, crypto/md5, crypto/rc4,
-	  crypto/sha1, crypto/sha256, crypto/sha512
+	  crypto/sha1, crypto/sha256, crypto/sha512, crypto/internal/sha3
+	< crypto/aesgcmsiv, crypto/hkdf, crypto/pbkdf2
+	< crypto/internal/scrypt
 	< CRYPTO;
 
 	CGO, fmt, net !< CRYPTO;
@@ -400,6 +419,9 @@ var depsRules = `
 	< golang.org/x/crypto/cryptobyte/asn1
 	< golang.org/x/crypto/cryptobyte
 	< golang.org/x/crypto/curve25519
+	< crypto/internal/nistec
+	< crypto/ecdh
+	< crypto/mlkem
 	< crypto/dsa, crypto/elliptic, crypto/rsa
 	< crypto/ecdsa
 	< CRYPTO-MATH;
@@ -411,12 +433,13 @@ var depsRules = `
 	< golang.org/x/crypto/internal/subtle
 	< golang.org/x/crypto/chacha20
 	< golang.org/x/crypto/poly1305
-	< golang.org/x/crypto/chacha20poly1305
-	< golang.org/x/crypto/hkdf
+	< crypto/chacha20poly1305
+	< crypto/internal/hpke
 	< crypto/x509/internal/macos
 	< crypto/x509/pkix
+	< crypto/x509/internal/ocspasn1
 	< crypto/x509
-	< crypto/tls;
+	< crypto/x509/ocsp, crypto/tls;
 
 	# crypto-aware packages
 
@@ -442,11 +465,19 @@ var depsRules = `
 	NET, crypto/tls
 	< net/http/httptrace;
 
+	FMT, NET, crypto/tls, crypto/chacha20poly1305, crypto/hkdf
+	< net/http/internal/quic;
+
+	golang.org/x/net/http2/hpack
+	< net/http/internal/qpack;
+
 	compress/gzip,
 	golang.org/x/net/http/httpguts,
 	golang.org/x/net/http/httpproxy,
 	golang.org/x/net/http2/hpack,
 	net/http/internal,
+	net/http/internal/qpack,
+	net/http/internal/quic,
 	net/http/httptrace,
 	mime/multipart,
 	log
@@ -497,7 +528,10 @@ var depsRules = `
 	FMT, flag, runtime/debug, runtime/trace, internal/sysinfo
 	< testing;
 
-	internal/testlog, runtime/pprof, regexp
+	FMT, crypto/sha256, encoding/json, go/ast, go/parser, go/token
+	< internal/fuzz;
+
+	internal/fuzz, internal/testlog, runtime/pprof, regexp
 	< testing/internal/testdeps;
 
 	OS, flag, testing, internal/cfg
@@ -0,0 +1,237 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestUnmarshalMarshal(t *testing.T) {
+	var tests = []struct {
+		in string
+		ok bool
+	}{
+		{
+			in: "int(1234)",
+			ok: false, // missing version
+		},
+		{
+			in: `go test fuzz v1
+string("a"bcad")`,
+			ok: false, // malformed
+		},
+		{
+			in: `go test fuzz v1
+int()`,
+			ok: false, // empty value
+		},
+		{
+			in: `go test fuzz v1
+uint(-32)`,
+			ok: false, // invalid negative uint
+		},
+		{
+			in: `go test fuzz v1
+int8(1234456)`,
+			ok: false, // int8 too large
+		},
+		{
+			in: `go test fuzz v1
+int(20*5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+int(--5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+bool(0)`,
+			ok: false, // malformed bool
+		},
+		{
+			in: `go test fuzz v1
+byte('aa)`,
+			ok: false, // malformed byte
+		},
+		{
+			in: `go test fuzz v1
+byte('☃')`,
+			ok: false, // byte out of range
+		},
+		{
+			in: `go test fuzz v1
+string("has final newline")
+`,
+			ok: true, // has final newline
+		},
+		{
+			in: `go test fuzz v1
+string("extra")
+[]byte("spacing")
+    `,
+			ok: true, // extra spaces in the final newline
+		},
+		{
+			in: `go test fuzz v1
+float64(0)
+float32(0)`,
+			ok: true, // will be an integer literal since there is no decimal
+		},
+		{
+			in: `go test fuzz v1
+int(-23)
+int8(-2)
+int64(2342425)
+uint(1)
+uint16(234)
+uint32(352342)
+uint64(123)
+rune('œ')
+byte('K')
+byte('ÿ')
+[]byte("hello¿")
+[]byte("a")
+bool(true)
+string("hello\\xbd\\xb2=\\xbc ⌘")
+float64(-12.5)
+float32(2.5)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+float32(-0)
+float64(-0)
+float32(+Inf)
+float32(-Inf)
+float32(NaN)
+float64(+Inf)
+float64(-Inf)
+float64(NaN)
+math.Float64frombits(0x7ff8000000000002)
+math.Float32frombits(0x7fc00001)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+int32(-1)
+int32(2147483647)
+int32(-2147483648)`,
+			ok: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			vals, err := unmarshalCorpusFile([]byte(test.in))
+			if test.ok && err != nil {
+				t.Fatalf("unmarshal unexpected error: %v", err)
+			} else if !test.ok && err == nil {
+				t.Fatalf("unmarshal unexpected success")
+			}
+			if !test.ok {
+				return // skip the rest of the test
+			}
+			newB := marshalCorpusFile(vals...)
+			if newB[len(newB)-1] != '\n' {
+				t.Error("didn't write final newline to corpus file")
+			}
+			// The text may differ from the input, for example in how floats
+			// are spelled, but the values must be preserved.
+			newVals, err := unmarshalCorpusFile(newB)
+			if err != nil {
+				t.Fatalf("unmarshal of marshaled values: %v\n%s", err, newB)
+			}
+			if !valuesEqual(vals, newVals) {
+				t.Errorf("values changed after round trip:\n%v\n%v", vals, newVals)
+			}
+		})
+	}
+}
+
+// valuesEqual reports whether a and b hold the same values. Floats are
+// compared by their bit patterns, so that NaNs compare equal to themselves.
+func valuesEqual(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		switch x := a[i].(type) {
+		case float32:
+			y, ok := b[i].(float32)
+			if !ok || math.Float32bits(x) != math.Float32bits(y) {
+				return false
+			}
+		case float64:
+			y, ok := b[i].(float64)
+			if !ok || math.Float64bits(x) != math.Float64bits(y) {
+				return false
+			}
+		case []byte:
+			y, ok := b[i].([]byte)
+			if !ok || string(x) != string(y) {
+				return false
+			}
+		default:
+			if a[i] != b[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TestMarshalUnmarshalRoundTrip checks that values produced by the fuzzing
+// engine survive a round trip through the corpus file format unchanged.
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	var vals []interface{}
+	for _, f := range []float64{0, math.Copysign(0, -1), 1.5, math.Inf(1), math.Inf(-1), math.NaN(), math.Float64frombits(0x7ff8000000000002), math.MaxFloat64, math.SmallestNonzeroFloat64} {
+		vals = append(vals, f, float32(f))
+	}
+	for _, r := range []rune{0, 'a', '☃', -1, 0xD800, math.MaxInt32, math.MinInt32} {
+		vals = append(vals, r)
+	}
+	for i := 0; i < 256; i++ {
+		vals = append(vals, byte(i))
+	}
+	vals = append(vals,
+		int(math.MinInt64), int8(math.MinInt8), int16(math.MaxInt16), int64(math.MaxInt64),
+		uint(math.MaxUint64), uint16(0), uint32(math.MaxUint32), uint64(math.MaxUint64),
+		true, false,
+		"", "\x00\xff\"`'\n", []byte{}, []byte("\xbd\xb2=\xbc ⌘"),
+	)
+	b := marshalCorpusFile(vals...)
+	got, err := unmarshalCorpusFile(b)
+	if err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, b)
+	}
+	if len(got) != len(vals) {
+		t.Fatalf("got %d values, want %d", len(got), len(vals))
+	}
+	for i := range vals {
+		if !valuesEqual(vals[i:i+1], got[i:i+1]) {
+			t.Errorf("value %d: got %#v, want %#v", i, got[i], vals[i])
+		}
+	}
+}
+
+func BenchmarkMarshalCorpusFile(b *testing.B) {
+	buf := make([]byte, 1024*1024)
+	for i := 0; i < len(buf); i++ {
+		buf[i] = byte(i)
+	}
+
+	for sz := 1; sz <= len(buf); sz <<= 1 {
+		sz := sz
+		b.Run(strconv.Itoa(sz), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.SetBytes(int64(sz))
+				marshalCorpusFile(buf[:sz])
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMutateTypes(t *testing.T) {
+	vals := []interface{}{
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), false, "", []byte{},
+	}
+	m := newMutator()
+	for i := 0; i < 1000; i++ {
+		before := make([]reflect.Type, len(vals))
+		for j, v := range vals {
+			before[j] = reflect.TypeOf(v)
+		}
+		m.mutate(vals, workerSharedMemSize)
+		for j, v := range vals {
+			if got := reflect.TypeOf(v); got != before[j] {
+				t.Fatalf("mutation changed type of value %d from %v to %v", j, before[j], got)
+			}
+		}
+	}
+}
+
+func TestMutateBytesStaysInPlace(t *testing.T) {
+	const maxBytes = 1 << 12
+	m := newMutator()
+	for i := 0; i < 1000; i++ {
+		vals := []interface{}{[]byte("hello, world")}
+		// mutate panics if a byte slice mutator moves the data to a new
+		// address, which would defeat the reuse of m.scratch.
+		m.mutate(vals, maxBytes)
+		if b := vals[0].([]byte); cap(b) > maxBytes {
+			t.Fatalf("mutated value has capacity %d, want at most %d", cap(b), maxBytes)
+		}
+	}
+}
+
+func TestByteSliceMutators(t *testing.T) {
+	for _, mut := range byteSliceMutators {
+		name := runtime.FuncForPC(reflect.ValueOf(mut).Pointer()).Name()
+		name = strings.TrimPrefix(name, "internal/fuzz.")
+		t.Run(name, func(t *testing.T) {
+			m := newMutator()
+			changed := false
+			for i := 0; i < 100 && !changed; i++ {
+				in := make([]byte, 0, 1<<12)
+				in = append(in, "abcdefghijklmnop"...)
+				orig := append([]byte(nil), in...)
+				out := mut(m, in)
+				if out == nil {
+					continue
+				}
+				if len(out) > cap(in) {
+					t.Fatalf("mutator grew slice beyond its capacity")
+				}
+				changed = !bytes.Equal(out, orig)
+			}
+			if !changed {
+				t.Errorf("mutator never changed its input")
+			}
+		})
+	}
+}
+
+func TestPcgRandRestore(t *testing.T) {
+	r := newPcgRand()
+	var state, inc uint64
+	r.save(&state, &inc)
+	want := make([]int, 10)
+	for i := range want {
+		want[i] = r.intn(1000)
+	}
+	r2 := newPcgRand()
+	r2.restore(state, inc)
+	for i := range want {
+		if got := r2.intn(1000); got != want[i] {
+			t.Fatalf("value %d after restore: got %d, want %d", i, got, want[i])
+		}
+	}
+}
+
+func TestDiffCoverage(t *testing.T) {
+	base := []byte{0x01, 0x00, 0xff}
+	if diff := diffCoverage(base, []byte{0x01, 0x00, 0x0f}); diff != nil {
+		t.Errorf("diffCoverage with no new bits = %v, want nil", diff)
+	}
+	diff := diffCoverage(base, []byte{0x03, 0x10, 0xff})
+	if want := []byte{0x02, 0x10, 0x00}; !bytes.Equal(diff, want) {
+		t.Errorf("diffCoverage = %v, want %v", diff, want)
+	}
+	if n := countNewCoverageBits(base, []byte{0x03, 0x10, 0xff}); n != 2 {
+		t.Errorf("countNewCoverageBits = %d, want 2", n)
+	}
+	if n := countBits(base); n != 9 {
+		t.Errorf("countBits = %d, want 9", n)
+	}
+	if !hasCoverageBit(base, []byte{0x00, 0x00, 0x80}) {
+		t.Errorf("hasCoverageBit = false, want true")
+	}
+	if hasCoverageBit(base, []byte{0x02, 0x10, 0x00}) {
+		t.Errorf("hasCoverageBit = true, want false")
+	}
+}
+
+func BenchmarkMutatorBytes(b *testing.B) {
+	for _, size := range []int{1, 10, 100, 1000, 10000, 100000} {
+		size := size
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			vals := []interface{}{make([]byte, size)}
+			m := newMutator()
+			for i := 0; i < b.N; i++ {
+				m.mutate(vals, workerSharedMemSize)
+			}
+		})
+	}
+}
@@ -1065,3 +1065,69 @@ func (fd *FD) WriteMsg(p []byte, oob []byte, sa syscall.Sockaddr) (int, int, err
 	})
 	return n, int(o.msg.Control.Len), err
 }
+
+// ReadFromInet4 is ReadFrom for an IPv4 socket, storing the source
+// address in *from.
+func (fd *FD) ReadFromInet4(p []byte, from *syscall.SockaddrInet4) (int, error) {
+	n, sa, err := fd.ReadFrom(p)
+	if sa4, ok := sa.(*syscall.SockaddrInet4); ok {
+		*from = *sa4
+	}
+	return n, err
+}
+
+// ReadFromInet6 is ReadFrom for an IPv6 socket, storing the source
+// address in *from.
+func (fd *FD) ReadFromInet6(p []byte, from *syscall.SockaddrInet6) (int, error) {
+	n, sa, err := fd.ReadFrom(p)
+	if sa6, ok := sa.(*syscall.SockaddrInet6); ok {
+		*from = *sa6
+	}
+	return n, err
+}
+
+// ReadMsgInet4 is ReadMsg for an IPv4 socket, storing the source
+// address in *sa4.
+func (fd *FD) ReadMsgInet4(p []byte, oob []byte, sa4 *syscall.SockaddrInet4) (int, int, int, error) {
+	n, oobn, flags, sa, err := fd.ReadMsg(p, oob)
+	if sa, ok := sa.(*syscall.SockaddrInet4); ok {
+		*sa4 = *sa
+	}
+	return n, oobn, flags, err
+}
+
+// ReadMsgInet6 is ReadMsg for an IPv6 socket, storing the source
+// address in *sa6.
+func (fd *FD) ReadMsgInet6(p []byte, oob []byte, sa6 *syscall.SockaddrInet6) (int, int, int, error) {
+	n, oobn, flags, sa, err := fd.ReadMsg(p, oob)
+	if sa, ok := sa.(*syscall.SockaddrInet6); ok {
+		*sa6 = *sa
+	}
+	return n, oobn, flags, err
+}
+
+// WriteToInet4 is WriteTo with an IPv4 destination address.
+func (fd *FD) WriteToInet4(buf []byte, sa4 *syscall.SockaddrInet4) (int, error) {
+	return fd.WriteTo(buf, sa4)
+}
+
+// WriteToInet6 is WriteTo with an IPv6 destination address.
+func (fd *FD) WriteToInet6(buf []byte, sa6 *syscall.SockaddrInet6) (int, error) {
+	return fd.WriteTo(buf, sa6)
+}
+
+// WriteMsgInet4 is WriteMsg with an IPv4 destination address.
+func (fd *FD) WriteMsgInet4(p []byte, oob []byte, sa4 *syscall.SockaddrInet4) (int, int, error) {
+	if sa4 == nil {
+		return fd.WriteMsg(p, oob, nil)
+	}
+	return fd.WriteMsg(p, oob, sa4)
+}
+
+// WriteMsgInet6 is WriteMsg with an IPv6 destination address.
+func (fd *FD) WriteMsgInet6(p []byte, oob []byte, sa6 *syscall.SockaddrInet6) (int, int, error) {
+	if sa6 == nil {
+		return fd.WriteMsg(p, oob, nil)
+	}
+	return fd.WriteMsg(p, oob, sa6)
+}
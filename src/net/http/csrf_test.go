@@ -0,0 +1,245 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var okHandler = HandlerFunc(func(w ResponseWriter, r *Request) {
+	w.WriteHeader(StatusOK)
+})
+
+func TestCrossOriginProtectionSecFetchSite(t *testing.T) {
+	protection := NewCrossOriginProtection()
+	handler := protection.Handler(okHandler)
+
+	tests := []struct {
+		name           string
+		method         string
+		secFetchSite   string
+		origin         string
+		expectedStatus int
+	}{
+		{"same-origin allowed", "POST", "same-origin", "", StatusOK},
+		{"none allowed", "POST", "none", "", StatusOK},
+		{"cross-site blocked", "POST", "cross-site", "", StatusForbidden},
+		{"same-site blocked", "POST", "same-site", "", StatusForbidden},
+
+		{"no header with no origin", "POST", "", "", StatusOK},
+		// httptest.NewRequest sets Host to "example.com".
+		{"no header with matching origin", "POST", "", "https://example.com", StatusOK},
+		{"no header with mismatched origin", "POST", "", "https://attacker.example", StatusForbidden},
+		{"no header with null origin", "POST", "", "null", StatusForbidden},
+
+		{"GET allowed", "GET", "cross-site", "", StatusOK},
+		{"HEAD allowed", "HEAD", "cross-site", "", StatusOK},
+		{"OPTIONS allowed", "OPTIONS", "cross-site", "", StatusOK},
+		{"PUT blocked", "PUT", "cross-site", "", StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "https://example.com/", nil)
+			if tc.secFetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tc.secFetchSite)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtectionTrustedOriginBypass(t *testing.T) {
+	protection := NewCrossOriginProtection()
+	err := protection.AddTrustedOrigin("https://trusted.example")
+	if err != nil {
+		t.Fatalf("AddTrustedOrigin: %v", err)
+	}
+	handler := protection.Handler(okHandler)
+
+	tests := []struct {
+		name           string
+		origin         string
+		secFetchSite   string
+		expectedStatus int
+	}{
+		{"trusted origin without sec-fetch-site", "https://trusted.example", "", StatusOK},
+		{"trusted origin with cross-site", "https://trusted.example", "cross-site", StatusOK},
+		{"untrusted origin without sec-fetch-site", "https://attacker.example", "", StatusForbidden},
+		{"untrusted origin with cross-site", "https://attacker.example", "cross-site", StatusForbidden},
+		{"trusted origin with different scheme", "http://trusted.example", "cross-site", StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "https://example.com/", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.secFetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tc.secFetchSite)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtectionPatternBypass(t *testing.T) {
+	protection := NewCrossOriginProtection()
+	protection.AddInsecureBypassPattern("/bypass/")
+	protection.AddInsecureBypassPattern("/only/exact")
+	handler := protection.Handler(okHandler)
+
+	tests := []struct {
+		name           string
+		path           string
+		secFetchSite   string
+		expectedStatus int
+	}{
+		{"bypass path without sec-fetch-site", "/bypass/", "", StatusOK},
+		{"bypass path with cross-site", "/bypass/", "cross-site", StatusOK},
+		{"non-bypass path without sec-fetch-site", "/api/", "", StatusForbidden},
+		{"non-bypass path with cross-site", "/api/", "cross-site", StatusForbidden},
+
+		{"subtree of bypass pattern", "/bypass/foo", "cross-site", StatusOK},
+		{"exact bypass pattern", "/only/exact", "cross-site", StatusOK},
+		{"child of exact bypass pattern", "/only/exact/foo", "cross-site", StatusForbidden},
+
+		// Requests that the ServeMux would redirect are not exempt.
+		{"redirect to bypass pattern", "/bypass", "cross-site", StatusForbidden},
+		{"unclean path into bypass pattern", "/api/../bypass/", "cross-site", StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "https://example.com/", nil)
+			req.URL.Path = tc.path
+			req.Header.Set("Origin", "https://attacker.example")
+			if tc.secFetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tc.secFetchSite)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtectionSetDenyHandler(t *testing.T) {
+	protection := NewCrossOriginProtection()
+
+	handler := protection.Handler(okHandler)
+
+	req := httptest.NewRequest("POST", "https://example.com/", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, StatusForbidden)
+	}
+
+	protection.SetDenyHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if err := protection.Check(r); err == nil {
+			t.Errorf("Check in deny handler = nil, want error")
+		}
+		w.WriteHeader(StatusTeapot)
+	}))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != StatusTeapot {
+		t.Errorf("got status %d, want %d", w.Code, StatusTeapot)
+	}
+
+	protection.SetDenyHandler(nil)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, StatusForbidden)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Sec-Fetch-Site") {
+		t.Errorf("got body %q, want it to mention Sec-Fetch-Site", body)
+	}
+}
+
+func TestCrossOriginProtectionAddTrustedOriginErrors(t *testing.T) {
+	protection := NewCrossOriginProtection()
+
+	tests := []struct {
+		name    string
+		origin  string
+		wantErr bool
+	}{
+		{"valid origin", "https://example.com", false},
+		{"valid origin with port", "https://example.com:8080", false},
+		{"http origin", "http://example.com", false},
+		{"missing scheme", "example.com", true},
+		{"missing host", "https://", true},
+		{"trailing slash", "https://example.com/", true},
+		{"with path", "https://example.com/path", true},
+		{"with query", "https://example.com?query=value", true},
+		{"with fragment", "https://example.com#fragment", true},
+		{"invalid url", "https://ex ample.com", true},
+		{"empty string", "", true},
+		{"null", "null", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := protection.AddTrustedOrigin(tc.origin)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("AddTrustedOrigin(%q) = %v, wantErr %v", tc.origin, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtectionZeroValue(t *testing.T) {
+	var protection CrossOriginProtection
+	protection.AddInsecureBypassPattern("/hook")
+	if err := protection.AddTrustedOrigin("https://trusted.example"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "https://example.com/hook", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	if err := protection.Check(req); err != nil {
+		t.Errorf("Check(bypass path) = %v, want nil", err)
+	}
+
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	req.Header.Set("Origin", "https://trusted.example")
+	if err := protection.Check(req); err != nil {
+		t.Errorf("Check(trusted origin) = %v, want nil", err)
+	}
+
+	req.Header.Set("Origin", "https://attacker.example")
+	if err := protection.Check(req); err == nil {
+		t.Errorf("Check(untrusted origin) = nil, want error")
+	}
+}
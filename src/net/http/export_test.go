@@ -88,6 +88,14 @@ func SetPendingDialHooks(before, after func()) {
 
 func SetTestHookServerServe(fn func(*Server, net.Listener)) { testHookServerServe = fn }
 
+// SetServeMux121 sets whether ServeMux behaves as if GODEBUG contained
+// httpmuxgo121=1, and returns a func which restores the previous setting.
+func SetServeMux121(v bool) (restore func()) {
+	old := use121
+	use121 = v
+	return func() { use121 = old }
+}
+
 func NewTestTimeoutHandler(handler Handler, ch <-chan time.Time) Handler {
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
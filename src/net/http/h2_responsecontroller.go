@@ -0,0 +1,144 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !nethttpomithttp2
+
+// HTTP/2 support for ResponseController.
+//
+// h2_bundle.go is generated from golang.org/x/net/http2 and must not be
+// edited by hand, so the methods ResponseController looks for on the
+// HTTP/2 ResponseWriter are defined here instead, using only what the
+// bundle already provides. Work that must happen on a connection's serve
+// goroutine is sent to it as a func(int) message, which the serve loop runs.
+
+package http
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// http2readDeadlines holds the timers of the read deadlines set on HTTP/2
+// streams. The bundled http2stream has no field for them. A timer's entry
+// is removed when it fires or is cleared. Timers aren't stopped when their
+// stream closes, but closing a stream also closes its body, so a timer that
+// fires afterwards has no effect.
+var http2readDeadlines struct {
+	mu     sync.Mutex
+	timers map[*http2stream]*time.Timer
+}
+
+// http2onReadTimeout is run on its own goroutine (from time.AfterFunc)
+// when the read deadline of st has passed.
+func http2onReadTimeout(st *http2stream) {
+	http2readDeadlines.mu.Lock()
+	delete(http2readDeadlines.timers, st)
+	http2readDeadlines.mu.Unlock()
+	http2closeBodyOnReadTimeout(st)
+}
+
+func http2closeBodyOnReadTimeout(st *http2stream) {
+	if st.body != nil {
+		// Wrap the ErrDeadlineExceeded to avoid callers depending on us
+		// returning the bare error.
+		st.body.CloseWithError(fmt.Errorf("%w", os.ErrDeadlineExceeded))
+	}
+}
+
+func (w *http2responseWriter) SetReadDeadline(deadline time.Time) error {
+	st := w.rws.stream
+	if !deadline.IsZero() && deadline.Before(time.Now()) {
+		// If we're setting a deadline in the past, close the body
+		// immediately so reads after SetReadDeadline returns will fail.
+		http2closeBodyOnReadTimeout(st)
+		return nil
+	}
+	w.rws.conn.sendServeMsg(func(int) {
+		if st.state == http2stateClosed {
+			return
+		}
+		rd := &http2readDeadlines
+		rd.mu.Lock()
+		defer rd.mu.Unlock()
+		if t := rd.timers[st]; t != nil {
+			if !t.Stop() {
+				// Deadline already exceeded.
+				return
+			}
+			delete(rd.timers, st)
+		}
+		if deadline.IsZero() {
+			return
+		}
+		if rd.timers == nil {
+			rd.timers = make(map[*http2stream]*time.Timer)
+		}
+		rd.timers[st] = time.AfterFunc(deadline.Sub(time.Now()), func() { http2onReadTimeout(st) })
+	})
+	return nil
+}
+
+func (w *http2responseWriter) SetWriteDeadline(deadline time.Time) error {
+	st := w.rws.stream
+	if !deadline.IsZero() && deadline.Before(time.Now()) {
+		// If we're setting a deadline in the past, reset the stream immediately
+		// so writes after SetWriteDeadline returns will fail.
+		st.onWriteTimeout()
+		return nil
+	}
+	w.rws.conn.sendServeMsg(func(int) {
+		if st.state == http2stateClosed {
+			return
+		}
+		if st.writeDeadline != nil {
+			if !st.writeDeadline.Stop() {
+				// Deadline already exceeded.
+				return
+			}
+		}
+		if deadline.IsZero() {
+			st.writeDeadline = nil
+		} else if st.writeDeadline == nil {
+			st.writeDeadline = time.AfterFunc(deadline.Sub(time.Now()), st.onWriteTimeout)
+		} else {
+			st.writeDeadline.Reset(deadline.Sub(time.Now()))
+		}
+	})
+	return nil
+}
+
+// EnableFullDuplex is a no-op: HTTP/2 handlers may always read the
+// request body while writing the response.
+func (w *http2responseWriter) EnableFullDuplex() error {
+	return nil
+}
+
+// FlushError is like Flush, but reports whether the buffered data could be
+// written to the stream.
+func (w *http2responseWriter) FlushError() error {
+	rws := w.rws
+	if rws == nil {
+		panic("Header called after Handler finished")
+	}
+	var err error
+	if rws.bw.Buffered() > 0 {
+		err = rws.bw.Flush()
+	} else {
+		// The bufio.Writer won't call chunkWriter.Write
+		// (writeChunk with zero bytes, so we have to do it
+		// ourselves to force the HTTP response header and/or
+		// final DATA frame (with END_STREAM) to be sent.
+		_, err = http2chunkWriter{rws}.Write(nil)
+		if err == nil {
+			select {
+			case <-rws.stream.cw:
+				err = http2errStreamClosed
+			default:
+			}
+		}
+	}
+	return err
+}
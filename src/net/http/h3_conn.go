@@ -0,0 +1,308 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 state shared by clients and servers.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/internal/quic"
+	"sync"
+)
+
+// http3MaxSettingsSize limits the size of a SETTINGS frame we accept.
+const http3MaxSettingsSize = 16 << 10
+
+// An http3Conn holds the connection state common to HTTP/3 clients and
+// servers: the control streams and the peer's settings.
+type http3Conn struct {
+	qc       *quic.Conn
+	isServer bool
+	onGoaway func(id uint64) // called for each GOAWAY frame from the peer
+
+	mu           sync.Mutex
+	peerSettings http3Settings
+	peerStreams  map[uint64]bool // critical stream types opened by the peer
+}
+
+func (c *http3Conn) init(qc *quic.Conn, isServer bool) {
+	c.qc = qc
+	c.isServer = isServer
+	c.peerSettings = http3Settings{maxFieldSectionSize: -1}
+	c.peerStreams = make(map[uint64]bool)
+}
+
+// openControlStream opens our control stream and sends our SETTINGS.
+func (c *http3Conn) openControlStream(ctx context.Context, maxFieldSectionSize int64) (*quic.Stream, error) {
+	st, err := c.qc.NewSendOnlyStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := http3AppendVarint(nil, http3StreamControl)
+	b = appendHTTP3Settings(b, maxFieldSectionSize)
+	if _, err := st.Write(b); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// peerMaxFieldSectionSize returns the peer's limit on the size of field
+// sections we send, or -1 if there is none.
+func (c *http3Conn) peerMaxFieldSectionSize() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peerSettings.maxFieldSectionSize
+}
+
+// abort closes the connection with a connection error.
+func (c *http3Conn) abort(code http3ErrCode, reason string) {
+	c.qc.Abort(&quic.ApplicationError{Code: uint64(code), Reason: reason})
+}
+
+// handleUniStream handles a unidirectional stream opened by the peer.
+func (c *http3Conn) handleUniStream(st *quic.Stream) {
+	fr := newHTTP3FrameReader(st)
+	typ, err := http3ReadVarint(fr.r)
+	if err != nil {
+		st.CloseRead(uint64(http3ErrNoError))
+		return
+	}
+	switch typ {
+	case http3StreamControl, http3StreamQPACKEncoder, http3StreamQPACKDecoder:
+		c.mu.Lock()
+		dup := c.peerStreams[typ]
+		c.peerStreams[typ] = true
+		c.mu.Unlock()
+		if dup {
+			c.abort(http3ErrStreamCreationError, "duplicate critical stream")
+			return
+		}
+		if typ == http3StreamControl {
+			err = c.readControlStream(fr)
+		} else {
+			// The QPACK encoder and decoder streams carry nothing of
+			// interest, since neither side uses the dynamic table.
+			_, err = io.Copy(ioutil.Discard, fr.r)
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		if err == io.EOF {
+			err = http3ConnError{http3ErrClosedCriticalStream, "critical stream closed"}
+		}
+		if ce, ok := err.(http3ConnError); ok {
+			c.abort(ce.code, ce.reason)
+		}
+	case http3StreamPush:
+		if c.isServer {
+			c.abort(http3ErrStreamCreationError, "push stream opened by client")
+		} else {
+			// We never send MAX_PUSH_ID, so the server may not push.
+			c.abort(http3ErrIDError, "push stream without MAX_PUSH_ID")
+		}
+	default:
+		// Unknown stream types must be ignored.
+		st.CloseRead(uint64(http3ErrStreamCreationError))
+	}
+}
+
+// readControlStream reads frames from the peer's control stream until it
+// ends or an error occurs.
+func (c *http3Conn) readControlStream(fr *http3FrameReader) error {
+	typ, _, err := fr.next()
+	if err != nil {
+		return err
+	}
+	if typ != http3FrameSettings {
+		return http3ConnError{http3ErrMissingSettings, "first frame on control stream is not SETTINGS"}
+	}
+	p, err := fr.payload(http3MaxSettingsSize)
+	if err != nil {
+		return err
+	}
+	s, err := parseHTTP3Settings(p)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.peerSettings = s
+	c.mu.Unlock()
+	for {
+		typ, _, err := fr.next()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case http3FrameData, http3FrameHeaders, http3FramePushPromise, http3FrameSettings:
+			return http3ConnError{http3ErrFrameUnexpected, "unexpected frame on control stream"}
+		case http3FrameMaxPushID:
+			if !c.isServer {
+				return http3ConnError{http3ErrFrameUnexpected, "MAX_PUSH_ID sent by server"}
+			}
+		case http3FrameGoaway:
+			p, err := fr.payload(8)
+			if err != nil {
+				return err
+			}
+			id, n := http3ConsumeVarint(p)
+			if n != len(p) {
+				return http3ConnError{http3ErrFrameError, "malformed GOAWAY frame"}
+			}
+			if c.onGoaway != nil {
+				c.onGoaway(id)
+			}
+		}
+		// CANCEL_PUSH frames and unknown frame types are ignored.
+	}
+}
+
+// An http3Body is the body of an HTTP/3 request or response, read from the
+// DATA frames of a request stream.
+// Read and Close may be called concurrently.
+type http3Body struct {
+	qc              *quic.Conn
+	st              *quic.Stream
+	fr              *http3FrameReader
+	contentLength   int64   // -1 if unknown
+	trailer         *Header // where to store trailers
+	maxTrailerBytes int64
+	closeCode       http3ErrCode // sent to the peer if closed before EOF
+	closedErr       error        // returned by Read after Close
+	resetOnClose    bool         // also abort the send side if closed before EOF
+	onDone          func()       // if non-nil, called once reading ends
+
+	// Accessed only by Read.
+	nread       int64
+	inData      bool // reading the payload of a DATA frame
+	sawTrailers bool
+
+	mu       sync.Mutex
+	closed   bool
+	err      error // sticky Read error
+	doneOnce sync.Once
+}
+
+func (b *http3Body) Read(p []byte) (n int, err error) {
+	b.mu.Lock()
+	closed, err := b.closed, b.err
+	b.mu.Unlock()
+	if closed {
+		return 0, b.closedErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err = b.read(p)
+	if err == nil {
+		return n, nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		err = b.closedErr
+	} else {
+		b.err = err
+	}
+	b.mu.Unlock()
+	if err != io.EOF && err != b.closedErr {
+		var se quic.StreamErrorCode
+		if !errors.As(err, &se) {
+			http3Abort(b.qc, b.st, err)
+		}
+	}
+	b.done()
+	return n, err
+}
+
+func (b *http3Body) read(p []byte) (int, error) {
+	for !b.inData || b.fr.remain == 0 {
+		b.inData = false
+		typ, _, err := b.fr.next()
+		if err == io.EOF {
+			if b.contentLength >= 0 && b.nread != b.contentLength {
+				return 0, http3StreamError{http3ErrMessageError, "body shorter than Content-Length"}
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch typ {
+		case http3FrameData:
+			if b.sawTrailers {
+				return 0, http3ConnError{http3ErrFrameUnexpected, "DATA frame after trailers"}
+			}
+			b.inData = true
+		case http3FrameHeaders:
+			if b.sawTrailers {
+				return 0, http3ConnError{http3ErrFrameUnexpected, "second trailer section"}
+			}
+			b.sawTrailers = true
+			if err := b.readTrailers(); err != nil {
+				return 0, err
+			}
+		case http3FrameCancelPush, http3FrameSettings, http3FramePushPromise, http3FrameGoaway, http3FrameMaxPushID:
+			return 0, http3ConnError{http3ErrFrameUnexpected, "unexpected frame on request stream"}
+		}
+		// Unknown frame types are skipped.
+	}
+	n, err := b.fr.Read(p)
+	b.nread += int64(n)
+	if b.contentLength >= 0 && b.nread > b.contentLength {
+		return n, http3StreamError{http3ErrMessageError, "body longer than Content-Length"}
+	}
+	return n, err
+}
+
+func (b *http3Body) readTrailers() error {
+	p, err := b.fr.payload(b.maxTrailerBytes)
+	if ce, ok := err.(http3ConnError); ok && ce.code == http3ErrExcessiveLoad {
+		return http3StreamError{http3ErrExcessiveLoad, "trailers too large"}
+	}
+	if err != nil {
+		return err
+	}
+	_, h, err := http3DecodeFields(p, true)
+	if err != nil {
+		return err
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	if *b.trailer == nil {
+		*b.trailer = make(Header)
+	}
+	for k, vv := range h {
+		(*b.trailer)[k] = vv
+	}
+	return nil
+}
+
+func (b *http3Body) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	sawEOF := b.err == io.EOF
+	b.mu.Unlock()
+	if !sawEOF {
+		b.st.CloseRead(uint64(b.closeCode))
+		if b.resetOnClose {
+			b.st.Reset(uint64(b.closeCode))
+		}
+	}
+	b.done()
+	return nil
+}
+
+func (b *http3Body) done() {
+	if b.onDone != nil {
+		b.doneOnce.Do(b.onDone)
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 framing, as specified in RFC 9114, Section 7.
+
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/internal/qpack"
+	"net/http/internal/quic"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// http3ALPN is the ALPN protocol identifier for HTTP/3.
+const http3ALPN = "h3"
+
+// HTTP/3 frame types.
+const (
+	http3FrameData        = 0x00
+	http3FrameHeaders     = 0x01
+	http3FrameCancelPush  = 0x03
+	http3FrameSettings    = 0x04
+	http3FramePushPromise = 0x05
+	http3FrameGoaway      = 0x07
+	http3FrameMaxPushID   = 0x0d
+)
+
+// HTTP/3 unidirectional stream types. See RFC 9114, Section 6.2, and
+// RFC 9204, Section 4.2.
+const (
+	http3StreamControl      = 0x00
+	http3StreamPush         = 0x01
+	http3StreamQPACKEncoder = 0x02
+	http3StreamQPACKDecoder = 0x03
+)
+
+// HTTP/3 settings. See RFC 9114, Section 7.2.4.1, and RFC 9204, Section 5.
+const (
+	http3SettingQPACKMaxTableCapacity = 0x01
+	http3SettingMaxFieldSectionSize   = 0x06
+	http3SettingQPACKBlockedStreams   = 0x07
+)
+
+// An http3ErrCode is an HTTP/3 error code. See RFC 9114, Section 8.1.
+type http3ErrCode uint64
+
+const (
+	http3ErrNoError                  http3ErrCode = 0x100
+	http3ErrGeneralProtocolError     http3ErrCode = 0x101
+	http3ErrInternalError            http3ErrCode = 0x102
+	http3ErrStreamCreationError      http3ErrCode = 0x103
+	http3ErrClosedCriticalStream     http3ErrCode = 0x104
+	http3ErrFrameUnexpected          http3ErrCode = 0x105
+	http3ErrFrameError               http3ErrCode = 0x106
+	http3ErrExcessiveLoad            http3ErrCode = 0x107
+	http3ErrIDError                  http3ErrCode = 0x108
+	http3ErrSettingsError            http3ErrCode = 0x109
+	http3ErrMissingSettings          http3ErrCode = 0x10a
+	http3ErrRequestRejected          http3ErrCode = 0x10b
+	http3ErrRequestCancelled         http3ErrCode = 0x10c
+	http3ErrRequestIncomplete        http3ErrCode = 0x10d
+	http3ErrMessageError             http3ErrCode = 0x10e
+	http3ErrConnectError             http3ErrCode = 0x10f
+	http3ErrVersionFallback          http3ErrCode = 0x110
+	http3ErrQPACKDecompressionFailed http3ErrCode = 0x200
+)
+
+var http3ErrCodeName = map[http3ErrCode]string{
+	http3ErrNoError:                  "H3_NO_ERROR",
+	http3ErrGeneralProtocolError:     "H3_GENERAL_PROTOCOL_ERROR",
+	http3ErrInternalError:            "H3_INTERNAL_ERROR",
+	http3ErrStreamCreationError:      "H3_STREAM_CREATION_ERROR",
+	http3ErrClosedCriticalStream:     "H3_CLOSED_CRITICAL_STREAM",
+	http3ErrFrameUnexpected:          "H3_FRAME_UNEXPECTED",
+	http3ErrFrameError:               "H3_FRAME_ERROR",
+	http3ErrExcessiveLoad:            "H3_EXCESSIVE_LOAD",
+	http3ErrIDError:                  "H3_ID_ERROR",
+	http3ErrSettingsError:            "H3_SETTINGS_ERROR",
+	http3ErrMissingSettings:          "H3_MISSING_SETTINGS",
+	http3ErrRequestRejected:          "H3_REQUEST_REJECTED",
+	http3ErrRequestCancelled:         "H3_REQUEST_CANCELLED",
+	http3ErrRequestIncomplete:        "H3_REQUEST_INCOMPLETE",
+	http3ErrMessageError:             "H3_MESSAGE_ERROR",
+	http3ErrConnectError:             "H3_CONNECT_ERROR",
+	http3ErrVersionFallback:          "H3_VERSION_FALLBACK",
+	http3ErrQPACKDecompressionFailed: "QPACK_DECOMPRESSION_FAILED",
+}
+
+func (e http3ErrCode) String() string {
+	if s, ok := http3ErrCodeName[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint64(e))
+}
+
+// An http3ConnError is an error which closes the whole connection.
+type http3ConnError struct {
+	code   http3ErrCode
+	reason string
+}
+
+func (e http3ConnError) Error() string {
+	return fmt.Sprintf("http3: connection error: %v: %v", e.code, e.reason)
+}
+
+// An http3StreamError is an error which aborts a single stream.
+type http3StreamError struct {
+	code   http3ErrCode
+	reason string
+}
+
+func (e http3StreamError) Error() string {
+	return fmt.Sprintf("http3: stream error: %v: %v", e.code, e.reason)
+}
+
+// http3Abort reports err to the peer. Connection errors close qc, and
+// any other error aborts st.
+func http3Abort(qc *quic.Conn, st *quic.Stream, err error) {
+	switch e := err.(type) {
+	case http3ConnError:
+		qc.Abort(&quic.ApplicationError{Code: uint64(e.code), Reason: e.reason})
+	case http3StreamError:
+		st.Reset(uint64(e.code))
+		st.CloseRead(uint64(e.code))
+	default:
+		st.Reset(uint64(http3ErrRequestCancelled))
+		st.CloseRead(uint64(http3ErrRequestCancelled))
+	}
+}
+
+// http3AppendVarint appends v to b as a QUIC variable-length integer.
+// See RFC 9000, Section 16.
+func http3AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 1<<6-1:
+		return append(b, byte(v))
+	case v <= 1<<14-1:
+		return append(b, 1<<6|byte(v>>8), byte(v))
+	case v <= 1<<30-1:
+		return append(b, 2<<6|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, 3<<6|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// http3ConsumeVarint parses a variable-length integer at the start of b.
+// It returns the value and the number of bytes consumed, or -1 on error.
+func http3ConsumeVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// http3ReadVarint reads a variable-length integer from r.
+// It returns io.EOF only if no bytes were read.
+func http3ReadVarint(r io.ByteReader) (uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1 << (c >> 6)
+	v := uint64(c & 0x3f)
+	for i := 1; i < n; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func http3AppendFrameHeader(b []byte, typ uint64, length int) []byte {
+	b = http3AppendVarint(b, typ)
+	return http3AppendVarint(b, uint64(length))
+}
+
+// An http3FrameReader reads HTTP/3 frames from a stream.
+type http3FrameReader struct {
+	r      *bufio.Reader
+	remain int64 // unread bytes in the current frame's payload
+}
+
+func newHTTP3FrameReader(r io.Reader) *http3FrameReader {
+	return &http3FrameReader{r: bufio.NewReader(r)}
+}
+
+var errHTTP3TruncatedFrame = http3ConnError{http3ErrFrameError, "truncated frame"}
+
+// next skips the rest of the current frame and reads the header of the
+// next one. It returns io.EOF if the stream ends cleanly at a frame
+// boundary.
+func (fr *http3FrameReader) next() (typ uint64, length int64, err error) {
+	if err := fr.skip(); err != nil {
+		return 0, 0, err
+	}
+	typ, err = http3ReadVarint(fr.r)
+	if err != nil {
+		return 0, 0, fr.readErr(err)
+	}
+	n, err := http3ReadVarint(fr.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, fr.readErr(err)
+	}
+	switch typ {
+	case 0x02, 0x06, 0x08, 0x09:
+		// Frame types used in HTTP/2 which have no HTTP/3 equivalent.
+		// See RFC 9114, Section 7.2.8.
+		return 0, 0, http3ConnError{http3ErrFrameUnexpected, fmt.Sprintf("reserved frame type 0x%x", typ)}
+	}
+	if n > 1<<62 {
+		return 0, 0, errHTTP3TruncatedFrame
+	}
+	fr.remain = int64(n)
+	return typ, fr.remain, nil
+}
+
+// readErr converts an error reading from the stream.
+func (fr *http3FrameReader) readErr(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return errHTTP3TruncatedFrame
+	}
+	return err
+}
+
+// skip discards the rest of the current frame.
+func (fr *http3FrameReader) skip() error {
+	if fr.remain == 0 {
+		return nil
+	}
+	n, err := io.CopyN(ioutil.Discard, fr.r, fr.remain)
+	fr.remain -= n
+	if err == io.EOF {
+		return errHTTP3TruncatedFrame
+	}
+	return err
+}
+
+// payload reads the rest of the current frame, which may be at most max
+// bytes long.
+func (fr *http3FrameReader) payload(max int64) ([]byte, error) {
+	if fr.remain > max {
+		return nil, http3ConnError{http3ErrExcessiveLoad, "frame too large"}
+	}
+	b := make([]byte, fr.remain)
+	_, err := io.ReadFull(fr.r, b)
+	fr.remain = 0
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errHTTP3TruncatedFrame
+	}
+	return b, err
+}
+
+// Read reads from the payload of the current frame.
+func (fr *http3FrameReader) Read(p []byte) (int, error) {
+	if fr.remain == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > fr.remain {
+		p = p[:fr.remain]
+	}
+	n, err := fr.r.Read(p)
+	fr.remain -= int64(n)
+	if err == io.EOF {
+		if fr.remain > 0 {
+			return n, errHTTP3TruncatedFrame
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// http3Settings holds the settings sent by the peer.
+type http3Settings struct {
+	maxFieldSectionSize int64 // -1 if unlimited
+}
+
+func appendHTTP3Settings(b []byte, maxFieldSectionSize int64) []byte {
+	var p []byte
+	p = http3AppendVarint(p, http3SettingMaxFieldSectionSize)
+	p = http3AppendVarint(p, uint64(maxFieldSectionSize))
+	b = http3AppendFrameHeader(b, http3FrameSettings, len(p))
+	return append(b, p...)
+}
+
+func parseHTTP3Settings(p []byte) (http3Settings, error) {
+	s := http3Settings{maxFieldSectionSize: -1}
+	seen := make(map[uint64]bool)
+	for len(p) > 0 {
+		id, n := http3ConsumeVarint(p)
+		if n < 0 {
+			return s, http3ConnError{http3ErrFrameError, "malformed SETTINGS frame"}
+		}
+		p = p[n:]
+		v, n := http3ConsumeVarint(p)
+		if n < 0 {
+			return s, http3ConnError{http3ErrFrameError, "malformed SETTINGS frame"}
+		}
+		p = p[n:]
+		if seen[id] {
+			return s, http3ConnError{http3ErrSettingsError, "duplicate setting"}
+		}
+		seen[id] = true
+		switch id {
+		case 0x02, 0x03, 0x04, 0x05:
+			// HTTP/2 settings with no HTTP/3 equivalent.
+			return s, http3ConnError{http3ErrSettingsError, "reserved setting"}
+		case http3SettingMaxFieldSectionSize:
+			if v < 1<<62 {
+				s.maxFieldSectionSize = int64(v)
+			}
+		}
+		// QPACK settings are ignored, since we never use the
+		// dynamic table. Unknown settings must be ignored.
+	}
+	return s, nil
+}
+
+// http3ConnHeaders are connection-specific header fields, which are
+// not permitted in HTTP/3. See RFC 9114, Section 4.2.
+var http3ConnHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// http3AppendFields appends an encoded field section containing pseudo,
+// a list of pseudo-header name-value pairs, followed by h.
+// Connection-specific fields in h are dropped.
+func http3AppendFields(b []byte, pseudo []string, h Header) []byte {
+	fields := make([]qpack.HeaderField, 0, len(pseudo)/2+len(h))
+	for i := 0; i+1 < len(pseudo); i += 2 {
+		fields = append(fields, qpack.HeaderField{Name: pseudo[i], Value: pseudo[i+1]})
+	}
+	for k, vv := range h {
+		if strSliceContains(http3ConnHeaders, k) {
+			continue
+		}
+		name := strings.ToLower(k)
+		if name == "te" {
+			if len(vv) != 1 || vv[0] != "trailers" {
+				continue
+			}
+		}
+		for _, v := range vv {
+			fields = append(fields, qpack.HeaderField{Name: name, Value: v, Sensitive: name == "authorization"})
+		}
+	}
+	return qpack.AppendFieldSection(b, fields)
+}
+
+// http3FieldsSize returns the size of the fields in h, as defined for
+// SETTINGS_MAX_FIELD_SECTION_SIZE.
+func http3FieldsSize(h Header) int64 {
+	var n int64
+	for k, vv := range h {
+		for _, v := range vv {
+			n += int64(len(k) + len(v) + 32)
+		}
+	}
+	return n
+}
+
+// http3DecodeFields decodes the field section p. Pseudo-header fields are
+// returned separately; they must precede all regular fields, and are
+// not permitted in trailers. Multiple cookie fields are joined.
+func http3DecodeFields(p []byte, trailer bool) (pseudo map[string]string, h Header, err error) {
+	h = make(Header)
+	var cookies []string
+	sawRegular := false
+	err = qpack.DecodeFieldSection(p, func(f qpack.HeaderField) error {
+		if strings.HasPrefix(f.Name, ":") {
+			if trailer || sawRegular {
+				return http3StreamError{http3ErrMessageError, "misplaced pseudo-header field"}
+			}
+			if pseudo == nil {
+				pseudo = make(map[string]string)
+			}
+			if _, dup := pseudo[f.Name]; dup {
+				return http3StreamError{http3ErrMessageError, "duplicate pseudo-header field"}
+			}
+			pseudo[f.Name] = f.Value
+			return nil
+		}
+		sawRegular = true
+		if !httpguts.ValidHeaderFieldName(f.Name) || strings.ToLower(f.Name) != f.Name {
+			return http3StreamError{http3ErrMessageError, fmt.Sprintf("invalid field name %q", f.Name)}
+		}
+		if !httpguts.ValidHeaderFieldValue(f.Value) {
+			return http3StreamError{http3ErrMessageError, fmt.Sprintf("invalid value for field %q", f.Name)}
+		}
+		key := CanonicalHeaderKey(f.Name)
+		if strSliceContains(http3ConnHeaders, key) {
+			return http3StreamError{http3ErrMessageError, fmt.Sprintf("connection-specific field %q", f.Name)}
+		}
+		if key == "Te" && f.Value != "trailers" {
+			return http3StreamError{http3ErrMessageError, `"te" field other than "trailers"`}
+		}
+		if key == "Cookie" {
+			cookies = append(cookies, f.Value)
+			return nil
+		}
+		h[key] = append(h[key], f.Value)
+		return nil
+	})
+	if errors.Is(err, qpack.ErrDecompressionFailed) {
+		return nil, nil, http3ConnError{http3ErrQPACKDecompressionFailed, err.Error()}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cookies) > 0 {
+		h["Cookie"] = []string{strings.Join(cookies, "; ")}
+	}
+	return pseudo, h, nil
+}
+
+// http3ContentLength returns the value of the Content-Length field in h,
+// or -1 if it is absent.
+func http3ContentLength(h Header) (int64, error) {
+	vv := h["Content-Length"]
+	if len(vv) == 0 {
+		return -1, nil
+	}
+	for _, v := range vv[1:] {
+		if v != vv[0] {
+			return 0, http3StreamError{http3ErrMessageError, "conflicting Content-Length fields"}
+		}
+	}
+	n, err := strconv.ParseUint(vv[0], 10, 63)
+	if err != nil {
+		return 0, http3StreamError{http3ErrMessageError, "invalid Content-Length"}
+	}
+	return int64(n), nil
+}
+
+// http3DeclaredTrailers returns a map containing the keys declared in the
+// Trailer field of h, and removes the field.
+func http3DeclaredTrailers(h Header) Header {
+	var trailer Header
+	for _, v := range h["Trailer"] {
+		foreachHeaderElement(v, func(key string) {
+			key = CanonicalHeaderKey(key)
+			switch key {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				// Bogus. (copy of http1 rules)
+				// Ignore.
+			default:
+				if trailer == nil {
+					trailer = make(Header)
+				}
+				trailer[key] = nil
+			}
+		})
+	}
+	delete(h, "Trailer")
+	return trailer
+}
@@ -0,0 +1,689 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 server. See RFC 9114.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http/internal/quic"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// http3HandlerChunkWriteSize is the size of the buffer between a handler
+// and the DATA frames written for its response.
+const http3HandlerChunkWriteSize = 4 << 10
+
+// ListenAndServeQUIC acts identically to ListenAndServeTLS, except that it
+// serves HTTP/3 over QUIC on the UDP network address addr.
+func ListenAndServeQUIC(addr, certFile, keyFile string, handler Handler) error {
+	server := &Server{Addr: addr, Handler: handler}
+	return server.ListenAndServeQUIC(certFile, keyFile)
+}
+
+// ListenAndServeQUIC listens on the UDP network address srv.Addr and
+// then calls ServeQUIC to handle HTTP/3 requests on incoming QUIC
+// connections.
+//
+// Filenames containing a certificate and matching private key for the
+// server must be provided if neither the Server's TLSConfig.Certificates
+// nor TLSConfig.GetCertificate are populated.
+//
+// If srv.Addr is blank, ":https" is used.
+//
+// ListenAndServeQUIC always returns a non-nil error. After Shutdown or
+// Close, the returned error is ErrServerClosed.
+func (srv *Server) ListenAndServeQUIC(certFile, keyFile string) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	return srv.ServeQUIC(pc, certFile, keyFile)
+}
+
+// ServeQUIC accepts incoming QUIC connections on the PacketConn pc and
+// serves HTTP/3 requests on them, calling srv.Handler to reply. ServeQUIC
+// takes ownership of pc, and closes it when the server is closed.
+//
+// Files containing a certificate and matching private key for the
+// server must be provided if neither the Server's
+// TLSConfig.Certificates nor TLSConfig.GetCertificate are populated.
+// The TLSConfig's NextProtos are replaced with "h3".
+//
+// HTTP/3 clients usually discover a server through an Alt-Svc header
+// field in a response sent over HTTP/1.1 or HTTP/2, such as
+//
+//	Alt-Svc: h3=":443"; ma=86400
+//
+// Shutdown sends each HTTP/3 connection a GOAWAY frame and closes it
+// once its active requests finish.
+//
+// ServeQUIC always returns a non-nil error. After Shutdown or Close, the
+// returned error is ErrServerClosed.
+func (srv *Server) ServeQUIC(pc net.PacketConn, certFile, keyFile string) error {
+	config := cloneTLSConfig(srv.TLSConfig)
+	config.NextProtos = []string{http3ALPN}
+
+	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+	if !configHasCert || certFile != "" || keyFile != "" {
+		var err error
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			pc.Close()
+			return err
+		}
+	}
+
+	qconf := &quic.Config{
+		TLSConfig:      config,
+		MaxIdleTimeout: srv.idleTimeout(),
+	}
+	ep := quic.NewEndpoint(pc, qconf)
+	if !srv.trackQUICEndpoint(ep, true) {
+		ep.Close(context.Background())
+		return ErrServerClosed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-srv.getDoneChan():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		qc, err := ep.Accept(ctx)
+		if err != nil {
+			if srv.shuttingDown() {
+				// Shutdown closes the endpoint once its
+				// connections are finished.
+				return ErrServerClosed
+			}
+			srv.trackQUICEndpoint(ep, false)
+			ep.Close(context.Background())
+			return err
+		}
+		sc := newHTTP3ServerConn(srv, qc)
+		if !srv.trackHTTP3Conn(sc, true) {
+			sc.abort(http3ErrNoError, "")
+			continue
+		}
+		go sc.serve()
+	}
+}
+
+// trackQUICEndpoint adds or removes a QUIC endpoint to the set of tracked
+// endpoints. It reports whether the server is still up.
+func (s *Server) trackQUICEndpoint(ep *quic.Endpoint, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quicEndpoints == nil {
+		s.quicEndpoints = make(map[*quic.Endpoint]struct{})
+	}
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.quicEndpoints[ep] = struct{}{}
+	} else {
+		delete(s.quicEndpoints, ep)
+	}
+	return true
+}
+
+// trackHTTP3Conn adds or removes an HTTP/3 connection to the set of
+// tracked connections. It reports whether the server is still up.
+func (s *Server) trackHTTP3Conn(sc *http3serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.http3Conns == nil {
+		s.http3Conns = make(map[*http3serverConn]struct{})
+	}
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.http3Conns[sc] = struct{}{}
+	} else {
+		delete(s.http3Conns, sc)
+	}
+	return true
+}
+
+// closeQUICLocked immediately closes all QUIC endpoints and their
+// connections.
+func (s *Server) closeQUICLocked() {
+	for ep := range s.quicEndpoints {
+		ep.Close(context.Background())
+		delete(s.quicEndpoints, ep)
+	}
+	for sc := range s.http3Conns {
+		delete(s.http3Conns, sc)
+	}
+}
+
+// closeIdleHTTP3Conns sends GOAWAY on all HTTP/3 connections, closes
+// those with no active requests, and reports whether all have been
+// closed. Once they have, it closes the QUIC endpoints.
+func (s *Server) closeIdleHTTP3Conns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quiescent := true
+	for sc := range s.http3Conns {
+		if sc.closeIfIdle() {
+			delete(s.http3Conns, sc)
+		} else {
+			quiescent = false
+		}
+	}
+	if quiescent {
+		s.closeQUICLocked()
+	}
+	return quiescent
+}
+
+// An http3serverConn is an HTTP/3 connection accepted by a Server.
+type http3serverConn struct {
+	http3Conn
+	srv            *Server
+	ctx            context.Context // canceled when the connection ends
+	cancel         context.CancelFunc
+	maxHeaderBytes int64
+	tlsState       *tls.ConnectionState
+
+	// Guarded by http3Conn.mu.
+	ctrl          *quic.Stream // our control stream
+	activeStreams int
+	nextStreamID  int64 // lowest request stream ID not yet accepted
+	goawaySent    bool
+}
+
+func newHTTP3ServerConn(srv *Server, qc *quic.Conn) *http3serverConn {
+	sc := &http3serverConn{
+		srv:            srv,
+		maxHeaderBytes: int64(srv.maxHeaderBytes()),
+	}
+	sc.init(qc, true)
+	state := qc.ConnectionState()
+	sc.tlsState = &state
+	ctx := context.WithValue(context.Background(), ServerContextKey, srv)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, qc.LocalAddr())
+	sc.ctx, sc.cancel = context.WithCancel(ctx)
+	return sc
+}
+
+func (sc *http3serverConn) logf(format string, args ...interface{}) {
+	sc.srv.logf(format, args...)
+}
+
+func (sc *http3serverConn) serve() {
+	defer sc.srv.trackHTTP3Conn(sc, false)
+	defer sc.cancel()
+
+	ctrl, err := sc.openControlStream(sc.ctx, sc.maxHeaderBytes)
+	if err != nil {
+		sc.abort(http3ErrInternalError, "")
+		return
+	}
+	sc.mu.Lock()
+	sc.ctrl = ctrl
+	goaway := sc.goawaySent
+	sc.mu.Unlock()
+	if goaway {
+		sc.writeGoaway()
+	}
+
+	for {
+		st, err := sc.qc.AcceptStream(sc.ctx)
+		if err != nil {
+			return
+		}
+		if st.IsReadOnly() {
+			go sc.handleUniStream(st)
+			continue
+		}
+		sc.mu.Lock()
+		if sc.goawaySent {
+			sc.mu.Unlock()
+			st.Reset(uint64(http3ErrRequestRejected))
+			st.CloseRead(uint64(http3ErrRequestRejected))
+			continue
+		}
+		sc.activeStreams++
+		sc.nextStreamID = st.ID() + 4
+		sc.mu.Unlock()
+		go sc.serveStream(st)
+	}
+}
+
+// closeIfIdle starts a graceful shutdown of the connection, and closes
+// it if no requests are active. It reports whether the connection was
+// closed.
+func (sc *http3serverConn) closeIfIdle() bool {
+	sc.mu.Lock()
+	first := !sc.goawaySent
+	sc.goawaySent = true
+	idle := sc.activeStreams == 0
+	sc.mu.Unlock()
+	if first {
+		sc.writeGoaway()
+	}
+	if idle {
+		sc.abort(http3ErrNoError, "")
+	}
+	return idle
+}
+
+// writeGoaway sends a GOAWAY frame with the lowest request stream ID
+// that has not been accepted.
+func (sc *http3serverConn) writeGoaway() {
+	sc.mu.Lock()
+	ctrl, id := sc.ctrl, sc.nextStreamID
+	sc.mu.Unlock()
+	if ctrl == nil {
+		// serve sends the GOAWAY once the control stream is open.
+		return
+	}
+	p := http3AppendVarint(nil, uint64(id))
+	b := http3AppendFrameHeader(nil, http3FrameGoaway, len(p))
+	ctrl.Write(append(b, p...))
+}
+
+func (sc *http3serverConn) streamDone() {
+	sc.mu.Lock()
+	sc.activeStreams--
+	sc.mu.Unlock()
+}
+
+// errHTTP3HeadersTooLarge is returned by readRequest when the request's
+// header section exceeds the server's MaxHeaderBytes.
+var errHTTP3HeadersTooLarge = http3StreamError{http3ErrExcessiveLoad, "request headers too large"}
+
+func (sc *http3serverConn) serveStream(st *quic.Stream) {
+	defer sc.streamDone()
+	st.SetReadContext(sc.ctx)
+	st.SetWriteContext(sc.ctx)
+	fr := newHTTP3FrameReader(st)
+	req, err := sc.readRequest(st, fr)
+	if err == errHTTP3HeadersTooLarge {
+		// Respond as the HTTP/1 and HTTP/2 servers do.
+		p := http3AppendFields(nil, []string{":status", strconv.Itoa(StatusRequestHeaderFieldsTooLarge)}, nil)
+		st.Write(append(http3AppendFrameHeader(nil, http3FrameHeaders, len(p)), p...))
+		st.CloseWrite()
+		st.CloseRead(uint64(http3ErrNoError))
+		return
+	}
+	if err != nil {
+		http3Abort(sc.qc, st, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(req.ctx)
+	req.ctx = ctx
+	w := &http3ResponseWriter{
+		sc:  sc,
+		st:  st,
+		req: req,
+	}
+	w.bw = bufio.NewWriterSize(http3chunkWriter{w}, http3HandlerChunkWriteSize)
+
+	didPanic := true
+	defer func() {
+		cancel()
+		req.Body.Close()
+		if didPanic {
+			e := recover()
+			st.Reset(uint64(http3ErrInternalError))
+			st.CloseRead(uint64(http3ErrInternalError))
+			// Same as net/http:
+			if e != nil && e != ErrAbortHandler {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				sc.logf("http3: panic serving %v: %v\n%s", sc.qc.RemoteAddr(), e, buf)
+			}
+			return
+		}
+		w.handlerFinished()
+	}()
+	serverHandler{sc.srv}.ServeHTTP(w, req)
+	didPanic = false
+}
+
+// readRequest reads the header section of a request.
+func (sc *http3serverConn) readRequest(st *quic.Stream, fr *http3FrameReader) (*Request, error) {
+	for {
+		typ, length, err := fr.next()
+		if err == io.EOF {
+			return nil, http3StreamError{http3ErrRequestIncomplete, "stream ended before request headers"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case http3FrameHeaders:
+			if length > sc.maxHeaderBytes {
+				return nil, errHTTP3HeadersTooLarge
+			}
+			p, err := fr.payload(sc.maxHeaderBytes)
+			if err != nil {
+				return nil, err
+			}
+			pseudo, h, err := http3DecodeFields(p, false)
+			if err != nil {
+				return nil, err
+			}
+			return sc.newRequest(st, fr, pseudo, h)
+		case http3FrameData:
+			return nil, http3ConnError{http3ErrFrameUnexpected, "DATA frame before HEADERS"}
+		case http3FrameCancelPush, http3FrameSettings, http3FramePushPromise, http3FrameGoaway, http3FrameMaxPushID:
+			return nil, http3ConnError{http3ErrFrameUnexpected, "unexpected frame on request stream"}
+		}
+		// Unknown frame types are skipped.
+	}
+}
+
+func (sc *http3serverConn) newRequest(st *quic.Stream, fr *http3FrameReader, pseudo map[string]string, h Header) (*Request, error) {
+	for k := range pseudo {
+		switch k {
+		case ":method", ":scheme", ":authority", ":path":
+		default:
+			return nil, http3StreamError{http3ErrMessageError, "unknown pseudo-header field " + k}
+		}
+	}
+	method, scheme, authority, path := pseudo[":method"], pseudo[":scheme"], pseudo[":authority"], pseudo[":path"]
+	if !validMethod(method) {
+		return nil, http3StreamError{http3ErrMessageError, "invalid :method"}
+	}
+	var (
+		u          *url.URL
+		requestURI string
+		err        error
+	)
+	if method == "CONNECT" {
+		if authority == "" || scheme != "" || path != "" {
+			return nil, http3StreamError{http3ErrMessageError, "malformed CONNECT request"}
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if scheme == "" || path == "" {
+			return nil, http3StreamError{http3ErrMessageError, "missing :scheme or :path"}
+		}
+		u, err = url.ParseRequestURI(path)
+		if err != nil {
+			return nil, http3StreamError{http3ErrMessageError, "invalid :path"}
+		}
+		requestURI = path
+	}
+	host := authority
+	if host == "" {
+		host = h.Get("Host")
+	}
+	delete(h, "Host")
+	cl, err := http3ContentLength(h)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{
+		Method:        method,
+		URL:           u,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		Header:        h,
+		Host:          host,
+		ContentLength: cl,
+		Trailer:       http3DeclaredTrailers(h),
+		RemoteAddr:    sc.qc.RemoteAddr().String(),
+		RequestURI:    requestURI,
+		TLS:           sc.tlsState,
+		ctx:           sc.ctx,
+	}
+	req.Body = &http3Body{
+		qc:              sc.qc,
+		st:              st,
+		fr:              fr,
+		contentLength:   cl,
+		trailer:         &req.Trailer,
+		maxTrailerBytes: sc.maxHeaderBytes,
+		closeCode:       http3ErrNoError,
+		closedErr:       ErrBodyReadAfterClose,
+	}
+	return req, nil
+}
+
+// http3ResponseWriter is the ResponseWriter for HTTP/3 requests.
+type http3ResponseWriter struct {
+	sc  *http3serverConn
+	st  *quic.Stream
+	req *Request
+	bw  *bufio.Writer // writing to an http3chunkWriter
+
+	handlerHeader Header   // nil until called
+	snapHeader    Header   // snapshot of handlerHeader at WriteHeader time
+	trailers      []string // declared trailers
+	status        int      // status code passed to WriteHeader
+	wroteHeader   bool     // WriteHeader called (explicitly or implicitly)
+	sentHeader    bool     // HEADERS frame sent
+	handlerDone   bool     // handler has finished
+	declaredLen   int64    // Content-Length set by the handler, or -1
+	wroteBytes    int64
+}
+
+// Optional http.ResponseWriter interfaces implemented.
+var (
+	_ Flusher         = (*http3ResponseWriter)(nil)
+	_ io.StringWriter = (*http3ResponseWriter)(nil)
+)
+
+type http3chunkWriter struct{ w *http3ResponseWriter }
+
+func (cw http3chunkWriter) Write(p []byte) (n int, err error) { return cw.w.writeChunk(p) }
+
+func (w *http3ResponseWriter) Header() Header {
+	if w.handlerHeader == nil {
+		w.handlerHeader = make(Header)
+	}
+	return w.handlerHeader
+}
+
+func (w *http3ResponseWriter) WriteHeader(code int) {
+	checkWriteHeaderCode(code)
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.snapHeader = w.handlerHeader.Clone()
+	if w.snapHeader == nil {
+		w.snapHeader = make(Header)
+	}
+	w.declaredLen = -1
+	if v := w.snapHeader.Get("Content-Length"); v != "" {
+		if n, err := strconv.ParseUint(v, 10, 63); err == nil {
+			w.declaredLen = int64(n)
+		} else {
+			w.snapHeader.Del("Content-Length")
+		}
+	}
+}
+
+func (w *http3ResponseWriter) Write(p []byte) (n int, err error) {
+	return w.write(len(p), p, "")
+}
+
+func (w *http3ResponseWriter) WriteString(s string) (n int, err error) {
+	return w.write(len(s), nil, s)
+}
+
+// either dataB or dataS is non-zero.
+func (w *http3ResponseWriter) write(lenData int, dataB []byte, dataS string) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	w.wroteBytes += int64(lenData)
+	if w.declaredLen >= 0 && w.wroteBytes > w.declaredLen {
+		return 0, ErrContentLength
+	}
+	if dataB != nil {
+		return w.bw.Write(dataB)
+	}
+	return w.bw.WriteString(dataS)
+}
+
+func (w *http3ResponseWriter) Flush() {
+	w.FlushError()
+}
+
+func (w *http3ResponseWriter) FlushError() error {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if w.bw.Buffered() > 0 {
+		return w.bw.Flush()
+	}
+	_, err := w.writeChunk(nil)
+	return err
+}
+
+// EnableFullDuplex is a no-op: HTTP/3 handlers may always read the
+// request body while writing the response.
+func (w *http3ResponseWriter) EnableFullDuplex() error {
+	return nil
+}
+
+// declareTrailer notes that a header will need to be written in the
+// trailers at the end of the response.
+func (w *http3ResponseWriter) declareTrailer(k string) {
+	k = CanonicalHeaderKey(k)
+	if !httpguts.ValidTrailerHeader(k) {
+		// Forbidden by RFC 7230, section 4.1.2.
+		w.sc.logf("ignoring invalid trailer %q", k)
+		return
+	}
+	if !strSliceContains(w.trailers, k) {
+		w.trailers = append(w.trailers, k)
+	}
+}
+
+// writeChunk writes chunks from the bufio.Writer, sending the HEADERS
+// frame first if needed.
+func (w *http3ResponseWriter) writeChunk(p []byte) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	isHeadResp := w.req.Method == "HEAD"
+	if !w.sentHeader {
+		w.sentHeader = true
+		h := w.snapHeader
+		if w.declaredLen < 0 && w.handlerDone && bodyAllowedForStatus(w.status) && (len(p) > 0 || !isHeadResp) {
+			h.Set("Content-Length", strconv.Itoa(len(p)))
+		}
+		_, hasContentType := h["Content-Type"]
+		// If the Content-Encoding is non-blank, we shouldn't
+		// sniff the body. See Issue golang.org/issue/31753.
+		if !hasContentType && h.Get("Content-Encoding") == "" && bodyAllowedForStatus(w.status) && len(p) > 0 {
+			h.Set("Content-Type", DetectContentType(p))
+		}
+		if _, ok := h["Date"]; !ok {
+			h.Set("Date", time.Now().UTC().Format(TimeFormat))
+		}
+		for _, v := range h["Trailer"] {
+			foreachHeaderElement(v, w.declareTrailer)
+		}
+		for k := range h {
+			if strings.HasPrefix(k, TrailerPrefix) {
+				delete(h, k)
+			}
+		}
+		if err := w.writeFields([]string{":status", strconv.Itoa(w.status)}, h); err != nil {
+			return 0, err
+		}
+	}
+	if isHeadResp || len(p) == 0 {
+		return len(p), nil
+	}
+	if _, err := w.st.Write(http3AppendFrameHeader(nil, http3FrameData, len(p))); err != nil {
+		return 0, err
+	}
+	return w.st.Write(p)
+}
+
+func (w *http3ResponseWriter) writeFields(pseudo []string, h Header) error {
+	p := http3AppendFields(nil, pseudo, h)
+	b := http3AppendFrameHeader(make([]byte, 0, 16+len(p)), http3FrameHeaders, len(p))
+	_, err := w.st.Write(append(b, p...))
+	return err
+}
+
+// handlerFinished completes the response after the handler returns.
+func (w *http3ResponseWriter) handlerFinished() {
+	w.handlerDone = true
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if err := w.bw.Flush(); err != nil {
+		return
+	}
+	if !w.sentHeader {
+		if _, err := w.writeChunk(nil); err != nil {
+			return
+		}
+	}
+	if w.declaredLen >= 0 && w.wroteBytes < w.declaredLen && w.req.Method != "HEAD" && bodyAllowedForStatus(w.status) {
+		// The handler didn't write the body it promised.
+		w.st.Reset(uint64(http3ErrInternalError))
+		return
+	}
+
+	// Promote undeclared trailers set with the TrailerPrefix.
+	for k, vv := range w.handlerHeader {
+		if !strings.HasPrefix(k, TrailerPrefix) {
+			continue
+		}
+		trailerKey := strings.TrimPrefix(k, TrailerPrefix)
+		w.declareTrailer(trailerKey)
+		w.handlerHeader[CanonicalHeaderKey(trailerKey)] = vv
+	}
+	var trailer Header
+	for _, k := range w.trailers {
+		if vv := w.handlerHeader[k]; len(vv) > 0 {
+			if trailer == nil {
+				trailer = make(Header)
+			}
+			trailer[k] = vv
+		}
+	}
+	if trailer != nil {
+		if err := w.writeFields(nil, trailer); err != nil {
+			return
+		}
+	}
+	w.st.CloseWrite()
+}
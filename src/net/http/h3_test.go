@@ -0,0 +1,418 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	. "net/http"
+	"net/http/httptest"
+	"net/http/internal/quic"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// An http3Test is an HTTPS server which advertises an HTTP/3 endpoint
+// served by the same handler, and a client with HTTP/3 enabled.
+type http3Test struct {
+	t      *testing.T
+	ts     *httptest.Server // HTTP/1.1 over TLS
+	h3     *Server
+	h3addr string
+	tr     *Transport
+	c      *Client
+	done   chan error // result of ServeQUIC
+}
+
+func newHTTP3Test(t *testing.T, h HandlerFunc) *http3Test {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback UDP: %v", err)
+	}
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=60`, port)
+	st := &http3Test{
+		t:      t,
+		h3addr: pc.LocalAddr().String(),
+		done:   make(chan error, 1),
+	}
+	st.ts = httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		h(w, r)
+	}))
+	st.ts.Config.ErrorLog = quietLog
+	st.ts.StartTLS()
+	st.h3 = &Server{
+		Handler:   st.ts.Config.Handler,
+		TLSConfig: st.ts.TLS.Clone(),
+		ErrorLog:  quietLog,
+	}
+	go func() { st.done <- st.h3.ServeQUIC(pc, "", "") }()
+	st.c = st.ts.Client()
+	st.tr = st.c.Transport.(*Transport)
+	st.tr.EnableHTTP3 = true
+	return st
+}
+
+func (st *http3Test) close() {
+	st.h3.Close()
+	if err := <-st.done; err != ErrServerClosed {
+		st.t.Errorf("ServeQUIC = %v, want ErrServerClosed", err)
+	}
+	st.ts.Close()
+	st.tr.CloseIdleConnections()
+}
+
+// get sends a GET request and returns the response with its body read.
+func (st *http3Test) get(path string) (*Response, string) {
+	st.t.Helper()
+	res, err := st.c.Get(st.ts.URL + path)
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		st.t.Fatalf("reading body: %v", err)
+	}
+	return res, string(body)
+}
+
+// upgrade makes a request over TCP, so that the Transport learns of the
+// HTTP/3 endpoint.
+func (st *http3Test) upgrade() {
+	st.t.Helper()
+	if res, _ := st.get("/"); res.ProtoMajor == 3 {
+		st.t.Fatalf("first request used %v, want a TCP protocol", res.Proto)
+	}
+}
+
+func TestHTTP3AltSvcUpgrade(t *testing.T) {
+	defer afterTest(t)
+	st := newHTTP3Test(t, func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "%v %v %v", r.Proto, r.Method, r.URL.Path)
+	})
+	defer st.close()
+	res, body := st.get("/first")
+	if res.ProtoMajor != 1 || body != "HTTP/1.1 GET /first" {
+		t.Errorf("first response: %v %q, want HTTP/1.1", res.Proto, body)
+	}
+	for i := 0; i < 3; i++ {
+		res, body = st.get("/second")
+		if res.Proto != "HTTP/3.0" || body != "HTTP/3.0 GET /second" {
+			t.Errorf("response %v: %v %q, want HTTP/3.0", i, res.Proto, body)
+		}
+		if res.TLS == nil || res.TLS.NegotiatedProtocol != "h3" {
+			t.Errorf("response %v: TLS state %+v, want negotiated protocol h3", i, res.TLS)
+		}
+	}
+}
+
+func TestHTTP3RequestResponse(t *testing.T) {
+	defer afterTest(t)
+	st := newHTTP3Test(t, func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		w.Header().Set("Trailer", "X-Sum")
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Cookie", r.Header.Get("Cookie"))
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		w.WriteHeader(StatusCreated)
+		w.Write(body)
+		w.Header().Set("X-Sum", fmt.Sprint(len(body)))
+		w.Header().Set(TrailerPrefix+"X-Req-Trailer", r.Trailer.Get("X-Req-Trailer"))
+	})
+	defer st.close()
+	st.upgrade()
+
+	body := bytes.Repeat([]byte("0123456789"), 100<<10)
+	req, _ := NewRequest("POST", st.ts.URL+"/post", io.MultiReader(bytes.NewReader(body)))
+	req.Header.Add("Cookie", "a=1")
+	req.Header.Add("Cookie", "b=2")
+	req.Trailer = Header{"X-Req-Trailer": nil}
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{
+		io.MultiReader(bytes.NewReader(body), readerFunc(func([]byte) (int, error) {
+			req.Trailer.Set("X-Req-Trailer", "req")
+			return 0, io.EOF
+		})),
+		io.NopCloser(nil),
+	}
+	res, err := st.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProtoMajor != 3 || res.StatusCode != StatusCreated {
+		t.Errorf("response %v %v, want HTTP/3.0 201", res.Proto, res.Status)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("echoed %v bytes, want %v", len(got), len(body))
+	}
+	if g, w := res.Header.Get("X-Method"), "POST"; g != w {
+		t.Errorf("X-Method = %q, want %q", g, w)
+	}
+	if g, w := res.Header.Get("X-Cookie"), "a=1; b=2"; g != w {
+		t.Errorf("X-Cookie = %q, want %q", g, w)
+	}
+	want := Header{"X-Sum": {fmt.Sprint(len(body))}, "X-Req-Trailer": {"req"}}
+	if fmt.Sprint(res.Trailer) != fmt.Sprint(want) {
+		t.Errorf("Trailer = %v, want %v", res.Trailer, want)
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestHTTP3ContentHeaders(t *testing.T) {
+	defer afterTest(t)
+	st := newHTTP3Test(t, func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/html":
+			io.WriteString(w, "<html><body>hello</body></html>")
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			io.WriteString(zw, "compressed")
+			zw.Close()
+		case "/empty":
+			w.WriteHeader(StatusNoContent)
+		case "/panic":
+			panic(ErrAbortHandler)
+		}
+	})
+	defer st.close()
+	st.upgrade()
+
+	res, body := st.get("/html")
+	if g, w := res.Header.Get("Content-Type"), "text/html; charset=utf-8"; g != w {
+		t.Errorf("Content-Type = %q, want %q", g, w)
+	}
+	if res.ContentLength != int64(len(body)) || res.Header.Get("Date") == "" {
+		t.Errorf("ContentLength = %v, Date = %q; want %v and a date", res.ContentLength, res.Header.Get("Date"), len(body))
+	}
+
+	res, body = st.get("/gzip")
+	if body != "compressed" || !res.Uncompressed {
+		t.Errorf("gzip body = %q, Uncompressed = %v; want %q, true", body, res.Uncompressed, "compressed")
+	}
+
+	res, body = st.get("/empty")
+	if res.StatusCode != StatusNoContent || body != "" {
+		t.Errorf("got %v %q, want 204 with no body", res.Status, body)
+	}
+
+	hres, err := st.c.Head(st.ts.URL + "/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hres.Body.Close()
+	if hres.ProtoMajor != 3 || hres.StatusCode != StatusOK {
+		t.Errorf("HEAD: %v %v, want HTTP/3.0 200", hres.Proto, hres.Status)
+	}
+
+	if res, err := st.c.Get(st.ts.URL + "/panic"); err == nil {
+		_, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		if err == nil {
+			t.Errorf("request to panicking handler succeeded")
+		}
+	}
+
+	// The connection is still usable after a stream error.
+	if res, _ := st.get("/html"); res.ProtoMajor != 3 {
+		t.Errorf("after panic, request used %v", res.Proto)
+	}
+}
+
+func TestHTTP3Fallback(t *testing.T) {
+	defer afterTest(t)
+	// Advertise a UDP port which never answers.
+	blackhole, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback UDP: %v", err)
+	}
+	defer blackhole.Close()
+	altSvc := fmt.Sprintf(`h3=":%d"`, blackhole.LocalAddr().(*net.UDPAddr).Port)
+	ts := httptest.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		io.WriteString(w, r.Proto)
+	}))
+	defer ts.Close()
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.EnableHTTP3 = true
+	tr.TLSHandshakeTimeout = 200 * time.Millisecond
+	defer tr.CloseIdleConnections()
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("request %v: %v", i, err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "HTTP/1.1" {
+			t.Errorf("request %v served over %q, want HTTP/1.1", i, body)
+		}
+		// Only the second request tries HTTP/3; afterwards the
+		// alternative is known to be broken.
+		if d := time.Since(start); i == 2 && d > 150*time.Millisecond {
+			t.Errorf("request %v took %v; HTTP/3 alternative should be ignored", i, d)
+		}
+	}
+}
+
+func TestHTTP3FallbackRequestRejected(t *testing.T) {
+	defer afterTest(t)
+	var altSvc string // set below, before any request is sent
+	ts := httptest.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %s", r.Proto, body)
+	}))
+	defer ts.Close()
+
+	// Advertise an HTTP/3 endpoint which refuses every request stream
+	// with H3_REQUEST_REJECTED.
+	const requestRejected = 0x10b
+	tlsConfig := ts.TLS.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+	ep, err := quic.Listen("udp", "127.0.0.1:0", &quic.Config{TLSConfig: tlsConfig})
+	if err != nil {
+		t.Skipf("cannot listen on loopback UDP: %v", err)
+	}
+	defer ep.Close(context.Background())
+	var rejected int32
+	go func() {
+		for {
+			qc, err := ep.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					st, err := qc.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					if st.IsReadOnly() {
+						continue
+					}
+					atomic.AddInt32(&rejected, 1)
+					st.Reset(requestRejected)
+					st.CloseRead(requestRejected)
+				}
+			}()
+		}
+	}()
+	altSvc = fmt.Sprintf(`h3=":%d"`, ep.LocalAddr().(*net.UDPAddr).Port)
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.EnableHTTP3 = true
+	defer tr.CloseIdleConnections()
+
+	for i := 0; i < 3; i++ {
+		res, err := c.Post(ts.URL, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("request %v: %v", i, err)
+		}
+		got, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if want := "HTTP/1.1 body"; string(got) != want {
+			t.Errorf("request %v: got response %q, want %q", i, got, want)
+		}
+	}
+	// Only the second request tries HTTP/3, which is given up on after
+	// the first attempt and its retries.
+	if got, want := atomic.LoadInt32(&rejected), int32(4); got != want {
+		t.Errorf("server rejected %v streams, want %v", got, want)
+	}
+}
+
+func TestHTTP3AltSvcClear(t *testing.T) {
+	defer afterTest(t)
+	clear := make(chan bool, 1)
+	clear <- false
+	st := newHTTP3Test(t, func(w ResponseWriter, r *Request) {
+		if c := <-clear; c {
+			w.Header().Set("Alt-Svc", "clear")
+		}
+		clear <- false
+		io.WriteString(w, r.Proto)
+	})
+	defer st.close()
+	st.upgrade()
+	if res, _ := st.get("/"); res.ProtoMajor != 3 {
+		t.Fatalf("second request used %v, want HTTP/3.0", res.Proto)
+	}
+	<-clear
+	clear <- true
+	st.get("/")
+	if res, _ := st.get("/"); res.ProtoMajor == 3 {
+		t.Errorf("request after Alt-Svc: clear used %v", res.Proto)
+	}
+}
+
+func TestHTTP3ServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	inHandler := make(chan bool)
+	unblock := make(chan bool)
+	st := newHTTP3Test(t, func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/block" {
+			inHandler <- true
+			<-unblock
+		}
+		io.WriteString(w, r.Proto)
+	})
+	defer st.close()
+	st.upgrade()
+
+	resc := make(chan string, 1)
+	go func() {
+		_, body := st.get("/block")
+		resc <- body
+	}()
+	<-inHandler
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shutdownc := make(chan error, 1)
+	go func() { shutdownc <- st.h3.Shutdown(ctx) }()
+	if err := <-st.done; err != ErrServerClosed {
+		t.Errorf("ServeQUIC = %v, want ErrServerClosed", err)
+	}
+	st.done <- ErrServerClosed // for close
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v with a request in progress", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	if body := <-resc; body != "HTTP/3.0" {
+		t.Errorf("in-flight request got %q, want HTTP/3.0", body)
+	}
+	if err := <-shutdownc; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
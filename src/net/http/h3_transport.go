@@ -0,0 +1,801 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 client. See RFC 9114.
+
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/internal/quic"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	http3DefaultUserAgent = "Go-http-client/3.0"
+
+	// http3DefaultAltSvcMaxAge is the freshness lifetime of an Alt-Svc
+	// entry with no "ma" parameter. See RFC 7838, Section 3.1.
+	http3DefaultAltSvcMaxAge = 24 * time.Hour
+
+	// http3BrokenAltSvcDuration is how long an HTTP/3 alternative which
+	// could not be reached is ignored.
+	http3BrokenAltSvcDuration = 5 * time.Minute
+
+	// http3MaxRetries limits the number of times a request rejected by
+	// the server is retried.
+	http3MaxRetries = 3
+)
+
+var (
+	// errHTTP3Unavailable is returned by roundTripHTTP3 when a request
+	// should be sent over TCP instead.
+	errHTTP3Unavailable = errors.New("net/http: no HTTP/3 alternative available")
+
+	// errHTTP3Retry is returned by http3ClientConn.roundTrip when a
+	// request was not processed by the server, and may be retried on a
+	// new connection.
+	errHTTP3Retry = errors.New("net/http: HTTP/3 request not processed by server")
+
+	errHTTP3RequestHeaderListSize = errors.New("net/http: HTTP/3 request header list larger than peer's advertised limit")
+)
+
+// An http3AltSvc is an HTTP/3 alternative service for an origin.
+type http3AltSvc struct {
+	addr        string // host:port of the QUIC endpoint
+	expires     time.Time
+	brokenUntil time.Time
+}
+
+// An altSvcValue is an alternative advertised in an Alt-Svc header field.
+type altSvcValue struct {
+	protocol  string
+	authority string
+	maxAge    time.Duration
+}
+
+// parseAltSvc parses the value of an Alt-Svc header field, as defined
+// in RFC 7838, Section 3. It reports whether the value is "clear",
+// which invalidates all alternatives. Malformed alternatives are skipped.
+func parseAltSvc(v string) (alts []altSvcValue, clear bool) {
+	v = textproto.TrimString(v)
+	if v == "clear" {
+		return nil, true
+	}
+	for _, alt := range splitAltSvc(v, ',') {
+		params := splitAltSvc(alt, ';')
+		i := strings.IndexByte(params[0], '=')
+		if i < 0 {
+			continue
+		}
+		protocol, err := url.PathUnescape(textproto.TrimString(params[0][:i]))
+		if err != nil {
+			continue
+		}
+		authority, ok := unquoteAltSvc(textproto.TrimString(params[0][i+1:]))
+		if !ok {
+			continue
+		}
+		a := altSvcValue{
+			protocol:  protocol,
+			authority: authority,
+			maxAge:    http3DefaultAltSvcMaxAge,
+		}
+		for _, p := range params[1:] {
+			i := strings.IndexByte(p, '=')
+			if i < 0 || !strings.EqualFold(textproto.TrimString(p[:i]), "ma") {
+				continue
+			}
+			s, _ := unquoteAltSvc(textproto.TrimString(p[i+1:]))
+			if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+				a.maxAge = time.Duration(n) * time.Second
+			}
+		}
+		alts = append(alts, a)
+	}
+	return alts, false
+}
+
+// splitAltSvc splits s at each sep which is not within a quoted string.
+func splitAltSvc(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteAltSvc returns the value of a token or quoted-string.
+func unquoteAltSvc(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' {
+		return s, s != "" && !strings.ContainsAny(s, "\" \t")
+	}
+	if s[len(s)-1] != '"' {
+		return "", false
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			if i == len(s) {
+				return "", false
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), true
+}
+
+// recordHTTP3AltSvc updates the HTTP/3 alternative for req's origin from
+// the Alt-Svc header fields of resp.
+func (t *Transport) recordHTTP3AltSvc(req *Request, resp *Response) {
+	if !t.EnableHTTP3 || req.URL.Scheme != "https" {
+		return
+	}
+	vv := resp.Header["Alt-Svc"]
+	if len(vv) == 0 {
+		return
+	}
+	alts, clear := parseAltSvc(strings.Join(vv, ","))
+	origin := canonicalAddr(req.URL)
+	now := time.Now()
+	t.h3mu.Lock()
+	defer t.h3mu.Unlock()
+	if !clear {
+		for _, a := range alts {
+			if a.protocol != http3ALPN {
+				continue
+			}
+			host, port, err := net.SplitHostPort(a.authority)
+			if err != nil {
+				continue
+			}
+			if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+				continue
+			}
+			if host == "" {
+				host = req.URL.Hostname()
+			}
+			addr := net.JoinHostPort(host, port)
+			if e := t.h3alt[origin]; e != nil && e.addr == addr {
+				e.expires = now.Add(a.maxAge)
+				return
+			}
+			if t.h3alt == nil {
+				t.h3alt = make(map[string]*http3AltSvc)
+			}
+			t.h3alt[origin] = &http3AltSvc{
+				addr:    addr,
+				expires: now.Add(a.maxAge),
+			}
+			return
+		}
+	}
+	// A new Alt-Svc field value replaces all previous alternatives.
+	delete(t.h3alt, origin)
+}
+
+// http3AltAddr returns the address of the HTTP/3 alternative for origin,
+// or "" if there is no usable alternative.
+func (t *Transport) http3AltAddr(origin string) string {
+	t.h3mu.Lock()
+	defer t.h3mu.Unlock()
+	alt := t.h3alt[origin]
+	if alt == nil {
+		return ""
+	}
+	now := time.Now()
+	if !now.Before(alt.expires) {
+		delete(t.h3alt, origin)
+		return ""
+	}
+	if now.Before(alt.brokenUntil) {
+		return ""
+	}
+	return alt.addr
+}
+
+// markHTTP3Broken notes that the HTTP/3 alternative addr for origin
+// could not be reached.
+func (t *Transport) markHTTP3Broken(origin, addr string) {
+	t.h3mu.Lock()
+	defer t.h3mu.Unlock()
+	if alt := t.h3alt[origin]; alt != nil && alt.addr == addr {
+		alt.brokenUntil = time.Now().Add(http3BrokenAltSvcDuration)
+	}
+}
+
+// roundTripHTTP3 sends req over HTTP/3 if its origin has advertised an
+// HTTP/3 alternative. It returns errHTTP3Unavailable if the request
+// should be sent over TCP instead; the caller must rewind req.Body first,
+// since it may have been sent to a server which rejected the request.
+func (t *Transport) roundTripHTTP3(req *Request) (*Response, error) {
+	if req.URL.Scheme != "https" || req.Method == "CONNECT" || req.requiresHTTP1() {
+		return nil, errHTTP3Unavailable
+	}
+	origin := canonicalAddr(req.URL)
+	addr := t.http3AltAddr(origin)
+	if addr == "" {
+		return nil, errHTTP3Unavailable
+	}
+	if t.Proxy != nil {
+		// QUIC can't be sent through an HTTP proxy.
+		if u, err := t.Proxy(req); err != nil || u != nil {
+			return nil, errHTTP3Unavailable
+		}
+	}
+	ctx := req.Context()
+	serverName := req.URL.Hostname()
+	for retry := 0; ; retry++ {
+		cc, err := t.getHTTP3Conn(ctx, addr, serverName)
+		if err != nil {
+			if ctx.Err() != nil {
+				req.closeBody()
+				return nil, ctx.Err()
+			}
+			t.markHTTP3Broken(origin, addr)
+			return nil, errHTTP3Unavailable
+		}
+		resp, err := cc.roundTrip(req)
+		if err == errHTTP3Retry {
+			if retry >= http3MaxRetries {
+				// The server keeps refusing the request without
+				// processing it, so it is safe to send it over TCP.
+				t.markHTTP3Broken(origin, addr)
+				return nil, errHTTP3Unavailable
+			}
+			req, err = rewindBody(req)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.recordHTTP3AltSvc(req, resp)
+		return resp, nil
+	}
+}
+
+// An http3DialCall is an in-flight dial of an HTTP/3 connection.
+type http3DialCall struct {
+	done chan struct{} // closed when the dial completes
+	cc   *http3ClientConn
+	err  error
+}
+
+// getHTTP3Conn returns a cached or new HTTP/3 connection to addr.
+func (t *Transport) getHTTP3Conn(ctx context.Context, addr, serverName string) (*http3ClientConn, error) {
+	key := addr + "/" + serverName
+	t.h3mu.Lock()
+	if cc := t.h3conns[key]; cc != nil && cc.canTakeNewRequest() {
+		t.h3mu.Unlock()
+		return cc, nil
+	}
+	call := t.h3dials[key]
+	if call == nil {
+		if t.h3dials == nil {
+			t.h3dials = make(map[string]*http3DialCall)
+		}
+		call = &http3DialCall{done: make(chan struct{})}
+		t.h3dials[key] = call
+		go t.dialHTTP3(call, key, addr, serverName)
+	}
+	t.h3mu.Unlock()
+	select {
+	case <-call.done:
+		return call.cc, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *Transport) dialHTTP3(call *http3DialCall, key, addr, serverName string) {
+	cc, err := t.newHTTP3ClientConn(key, addr, serverName)
+	t.h3mu.Lock()
+	delete(t.h3dials, key)
+	if err == nil {
+		if t.h3conns == nil {
+			t.h3conns = make(map[string]*http3ClientConn)
+		}
+		t.h3conns[key] = cc
+	}
+	t.h3mu.Unlock()
+	call.cc, call.err = cc, err
+	close(call.done)
+}
+
+// http3Endpoint returns the QUIC endpoint used for HTTP/3 connections.
+func (t *Transport) http3Endpoint() (*quic.Endpoint, error) {
+	t.h3mu.Lock()
+	defer t.h3mu.Unlock()
+	if t.h3ep == nil {
+		ep, err := quic.Listen("udp", ":0", nil)
+		if err != nil {
+			return nil, err
+		}
+		t.h3ep = ep
+	}
+	return t.h3ep, nil
+}
+
+func (t *Transport) removeHTTP3Conn(cc *http3ClientConn) {
+	t.h3mu.Lock()
+	defer t.h3mu.Unlock()
+	if t.h3conns[cc.key] == cc {
+		delete(t.h3conns, cc.key)
+	}
+}
+
+// closeIdleHTTP3Conns closes HTTP/3 connections with no active requests.
+// Once none remain, it closes the QUIC endpoint.
+func (t *Transport) closeIdleHTTP3Conns() {
+	t.h3mu.Lock()
+	var ep *quic.Endpoint
+	for key, cc := range t.h3conns {
+		if cc.closeIfIdle() {
+			delete(t.h3conns, key)
+		}
+	}
+	if len(t.h3conns) == 0 && len(t.h3dials) == 0 {
+		ep = t.h3ep
+		t.h3ep = nil
+	}
+	t.h3mu.Unlock()
+	if ep != nil {
+		ep.Close(context.Background())
+	}
+}
+
+// An http3ClientConn is an HTTP/3 connection used by a Transport.
+type http3ClientConn struct {
+	http3Conn
+	t                      *Transport
+	key                    string
+	tlsState               *tls.ConnectionState
+	maxResponseHeaderBytes int64
+
+	// Guarded by http3Conn.mu.
+	activeStreams int
+	goaway        bool // no new requests may be sent
+}
+
+func (t *Transport) newHTTP3ClientConn(key, addr, serverName string) (*http3ClientConn, error) {
+	ep, err := t.http3Endpoint()
+	if err != nil {
+		return nil, err
+	}
+	config := cloneTLSConfig(t.TLSClientConfig)
+	config.NextProtos = []string{http3ALPN}
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
+	qconf := &quic.Config{
+		TLSConfig:        config,
+		HandshakeTimeout: t.TLSHandshakeTimeout,
+		MaxIdleTimeout:   t.IdleConnTimeout,
+	}
+	qc, err := ep.Dial(context.Background(), "udp", addr, qconf)
+	if err != nil {
+		return nil, err
+	}
+	cc := &http3ClientConn{
+		t:                      t,
+		key:                    key,
+		maxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+	if cc.maxResponseHeaderBytes <= 0 {
+		cc.maxResponseHeaderBytes = 10 << 20 // conservative default; same as http1 and http2
+	}
+	cc.init(qc, false)
+	cc.onGoaway = cc.handleGoaway
+	state := qc.ConnectionState()
+	cc.tlsState = &state
+	if _, err := cc.openControlStream(context.Background(), cc.maxResponseHeaderBytes); err != nil {
+		qc.Abort(nil)
+		return nil, err
+	}
+	go cc.acceptStreams()
+	go func() {
+		qc.Wait(context.Background())
+		t.removeHTTP3Conn(cc)
+	}()
+	return cc, nil
+}
+
+func (cc *http3ClientConn) acceptStreams() {
+	for {
+		st, err := cc.qc.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		if !st.IsReadOnly() {
+			cc.abort(http3ErrStreamCreationError, "server opened a bidirectional stream")
+			return
+		}
+		go cc.handleUniStream(st)
+	}
+}
+
+func (cc *http3ClientConn) handleGoaway(id uint64) {
+	cc.mu.Lock()
+	cc.goaway = true
+	idle := cc.activeStreams == 0
+	cc.mu.Unlock()
+	cc.t.removeHTTP3Conn(cc)
+	if idle {
+		cc.abort(http3ErrNoError, "")
+	}
+}
+
+func (cc *http3ClientConn) canTakeNewRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return !cc.goaway
+}
+
+func (cc *http3ClientConn) closeIfIdle() bool {
+	cc.mu.Lock()
+	idle := cc.activeStreams == 0
+	if idle {
+		cc.goaway = true
+	}
+	cc.mu.Unlock()
+	if idle {
+		cc.abort(http3ErrNoError, "")
+	}
+	return idle
+}
+
+func (cc *http3ClientConn) streamDone() {
+	cc.mu.Lock()
+	cc.activeStreams--
+	closeNow := cc.goaway && cc.activeStreams == 0
+	cc.mu.Unlock()
+	if closeNow {
+		cc.abort(http3ErrNoError, "")
+	}
+}
+
+func (cc *http3ClientConn) roundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+	cc.mu.Lock()
+	if cc.goaway {
+		cc.mu.Unlock()
+		return nil, errHTTP3Retry
+	}
+	cc.activeStreams++
+	cc.mu.Unlock()
+
+	headers, requestedGzip, err := cc.encodeHeaders(req)
+	if err != nil {
+		cc.streamDone()
+		req.closeBody()
+		return nil, err
+	}
+	st, err := cc.qc.NewStream(ctx)
+	if err != nil {
+		cc.streamDone()
+		if ctx.Err() != nil {
+			req.closeBody()
+			return nil, ctx.Err()
+		}
+		return nil, errHTTP3Retry
+	}
+	st.SetReadContext(ctx)
+	st.SetWriteContext(ctx)
+	if _, err := st.Write(headers); err != nil {
+		st.Reset(uint64(http3ErrRequestCancelled))
+		cc.streamDone()
+		req.closeBody()
+		return nil, err
+	}
+	go cc.writeBody(st, req)
+
+	resp, err := cc.readResponse(st, req, requestedGzip)
+	if err != nil {
+		cc.streamDone()
+		var se quic.StreamErrorCode
+		if errors.As(err, &se) {
+			if http3ErrCode(se) == http3ErrRequestRejected {
+				// The server did not process the request.
+				err = errHTTP3Retry
+			}
+			st.Reset(uint64(http3ErrRequestCancelled))
+		} else {
+			http3Abort(cc.qc, st, err)
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// encodeHeaders returns the HEADERS frame for req, and reports whether
+// the Transport asked for a gzip-compressed response.
+func (cc *http3ClientConn) encodeHeaders(req *Request) (frame []byte, requestedGzip bool, err error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err = httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return nil, false, err
+	}
+	path := req.URL.RequestURI()
+	if !strings.HasPrefix(path, "/") && path != "*" {
+		orig := path
+		path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
+		if !strings.HasPrefix(path, "/") && path != "*" {
+			if req.URL.Opaque != "" {
+				return nil, false, fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
+			}
+			return nil, false, fmt.Errorf("invalid request :path %q", orig)
+		}
+	}
+	method := valueOrDefault(req.Method, "GET")
+
+	h := req.Header.Clone()
+	if h == nil {
+		h = make(Header)
+	}
+	delete(h, "Host")
+	delete(h, "Content-Length")
+	delete(h, "Trailer")
+	if _, ok := h["User-Agent"]; !ok {
+		h.Set("User-Agent", http3DefaultUserAgent)
+	} else if h.Get("User-Agent") == "" {
+		delete(h, "User-Agent")
+	}
+	if len(req.Trailer) > 0 {
+		keys := make([]string, 0, len(req.Trailer))
+		for k := range req.Trailer {
+			k = CanonicalHeaderKey(k)
+			if !httpguts.ValidTrailerHeader(k) {
+				return nil, false, fmt.Errorf("invalid Trailer key %q", k)
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		h.Set("Trailer", strings.Join(keys, ","))
+	}
+	if cl := req.outgoingLength(); cl > 0 || cl == 0 && (method == "POST" || method == "PUT" || method == "PATCH") {
+		h.Set("Content-Length", strconv.FormatInt(cl, 10))
+	}
+	if !cc.t.DisableCompression && h.Get("Accept-Encoding") == "" && h.Get("Range") == "" && method != "HEAD" {
+		// Request gzip only, not deflate. See the comment in
+		// persistConn.roundTrip.
+		requestedGzip = true
+		h.Set("Accept-Encoding", "gzip")
+	}
+
+	pseudo := []string{
+		":method", method,
+		":scheme", "https",
+		":authority", host,
+		":path", path,
+	}
+	if limit := cc.peerMaxFieldSectionSize(); limit >= 0 {
+		size := http3FieldsSize(h)
+		for i := 0; i < len(pseudo); i += 2 {
+			size += int64(len(pseudo[i]) + len(pseudo[i+1]) + 32)
+		}
+		if size > limit {
+			return nil, false, errHTTP3RequestHeaderListSize
+		}
+	}
+	p := http3AppendFields(nil, pseudo, h)
+	frame = http3AppendFrameHeader(make([]byte, 0, 16+len(p)), http3FrameHeaders, len(p))
+	return append(frame, p...), requestedGzip, nil
+}
+
+// writeBody sends the request body and trailers, and closes req.Body.
+func (cc *http3ClientConn) writeBody(st *quic.Stream, req *Request) {
+	defer req.closeBody()
+	if req.Body != nil && req.Body != NoBody {
+		buf := make([]byte, cc.t.writeBufferSize())
+		var hdr []byte
+		for {
+			n, err := req.Body.Read(buf)
+			if n > 0 {
+				hdr = http3AppendFrameHeader(hdr[:0], http3FrameData, n)
+				if _, werr := st.Write(hdr); werr != nil {
+					return
+				}
+				if _, werr := st.Write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				st.Reset(uint64(http3ErrRequestCancelled))
+				return
+			}
+		}
+	}
+	var trailer Header
+	for k, vv := range req.Trailer {
+		if len(vv) > 0 {
+			if trailer == nil {
+				trailer = make(Header)
+			}
+			trailer[CanonicalHeaderKey(k)] = vv
+		}
+	}
+	if trailer != nil {
+		p := http3AppendFields(nil, nil, trailer)
+		b := http3AppendFrameHeader(make([]byte, 0, 16+len(p)), http3FrameHeaders, len(p))
+		if _, err := st.Write(append(b, p...)); err != nil {
+			return
+		}
+	}
+	st.CloseWrite()
+}
+
+func (cc *http3ClientConn) readResponse(st *quic.Stream, req *Request, requestedGzip bool) (*Response, error) {
+	if d := cc.t.ResponseHeaderTimeout; d > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer cancel()
+		st.SetReadContext(ctx)
+		defer st.SetReadContext(req.Context())
+	}
+	fr := newHTTP3FrameReader(st)
+	for {
+		typ, length, err := fr.next()
+		if err == io.EOF {
+			return nil, http3StreamError{http3ErrGeneralProtocolError, "stream ended before response headers"}
+		}
+		if err == context.DeadlineExceeded && req.Context().Err() == nil {
+			return nil, errors.New("net/http: timeout awaiting response headers")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case http3FrameHeaders:
+			if length > cc.maxResponseHeaderBytes {
+				return nil, http3StreamError{http3ErrExcessiveLoad, "response headers too large"}
+			}
+			p, err := fr.payload(cc.maxResponseHeaderBytes)
+			if err != nil {
+				return nil, err
+			}
+			pseudo, h, err := http3DecodeFields(p, false)
+			if err != nil {
+				return nil, err
+			}
+			status, err := http3ResponseStatus(pseudo)
+			if err != nil {
+				return nil, err
+			}
+			if status < 200 {
+				// Interim responses are ignored.
+				continue
+			}
+			return cc.newResponse(st, fr, req, status, h, requestedGzip)
+		case http3FrameData:
+			return nil, http3ConnError{http3ErrFrameUnexpected, "DATA frame before HEADERS"}
+		case http3FrameCancelPush, http3FrameSettings, http3FramePushPromise, http3FrameGoaway, http3FrameMaxPushID:
+			return nil, http3ConnError{http3ErrFrameUnexpected, "unexpected frame on request stream"}
+		}
+		// Unknown frame types are skipped.
+	}
+}
+
+func http3ResponseStatus(pseudo map[string]string) (int, error) {
+	for k := range pseudo {
+		if k != ":status" {
+			return 0, http3StreamError{http3ErrMessageError, "unknown pseudo-header field " + k}
+		}
+	}
+	s := pseudo[":status"]
+	status, err := strconv.Atoi(s)
+	if len(s) != 3 || err != nil || status < 100 || status == StatusSwitchingProtocols {
+		return 0, http3StreamError{http3ErrMessageError, fmt.Sprintf("invalid :status %q", s)}
+	}
+	return status, nil
+}
+
+func (cc *http3ClientConn) newResponse(st *quic.Stream, fr *http3FrameReader, req *Request, status int, h Header, requestedGzip bool) (*Response, error) {
+	cl, err := http3ContentLength(h)
+	if err != nil {
+		return nil, err
+	}
+	res := &Response{
+		Status:        strconv.Itoa(status) + " " + StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		Header:        h,
+		ContentLength: cl,
+		Trailer:       http3DeclaredTrailers(h),
+		Request:       req,
+		TLS:           cc.tlsState,
+	}
+	if req.Method == "HEAD" || !bodyAllowedForStatus(status) {
+		res.Body = NoBody
+		st.CloseRead(uint64(http3ErrNoError))
+		cc.streamDone()
+		return res, nil
+	}
+	body := &http3Body{
+		qc:              cc.qc,
+		st:              st,
+		fr:              fr,
+		contentLength:   cl,
+		trailer:         &res.Trailer,
+		maxTrailerBytes: cc.maxResponseHeaderBytes,
+		closeCode:       http3ErrRequestCancelled,
+		closedErr:       errReadOnClosedResBody,
+		resetOnClose:    true,
+		onDone:          cc.streamDone,
+	}
+	res.Body = body
+	if requestedGzip && h.Get("Content-Encoding") == "gzip" {
+		h.Del("Content-Encoding")
+		h.Del("Content-Length")
+		res.ContentLength = -1
+		res.Body = &http3gzipReader{body: body}
+		res.Uncompressed = true
+	}
+	return res, nil
+}
+
+// http3gzipReader wraps a response body so it can lazily
+// call gzip.NewReader on the first call to Read.
+type http3gzipReader struct {
+	_    incomparable
+	body io.ReadCloser // underlying Response.Body
+	zr   *gzip.Reader  // lazily-initialized gzip reader
+	zerr error         // sticky error
+}
+
+func (gz *http3gzipReader) Read(p []byte) (n int, err error) {
+	if gz.zerr != nil {
+		return 0, gz.zerr
+	}
+	if gz.zr == nil {
+		gz.zr, err = gzip.NewReader(gz.body)
+		if err != nil {
+			gz.zerr = err
+			return 0, err
+		}
+	}
+	return gz.zr.Read(p)
+}
+
+func (gz *http3gzipReader) Close() error {
+	return gz.body.Close()
+}
@@ -277,6 +277,206 @@ func TestXForwardedFor(t *testing.T) {
 }
 
 // Issue 38079: don't append to X-Forwarded-For if it's present but nil
+func TestReverseProxyRewriteStripsForwarded(t *testing.T) {
+	headers := []string{
+		"Forwarded",
+		"X-Forwarded-For",
+		"X-Forwarded-Host",
+		"X-Forwarded-Proto",
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range headers {
+			if v := r.Header.Get(h); v != "" {
+				t.Errorf("got %v header: %q", h, v)
+			}
+		}
+		if _, ok := r.Header["User-Agent"]; ok {
+			t.Errorf("got User-Agent header %q, want none", r.Header.Get("User-Agent"))
+		}
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyHandler := &ReverseProxy{
+		Rewrite: func(r *ProxyRequest) {
+			r.SetURL(backendURL)
+		},
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	getReq, _ := http.NewRequest("GET", frontend.URL, nil)
+	getReq.Host = "some-name"
+	getReq.Close = true
+	getReq.Header.Set("User-Agent", "") // send no User-Agent
+	for _, h := range headers {
+		getReq.Header.Set(h, "x")
+	}
+	res, err := frontend.Client().Do(getReq)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestReverseProxyRewriteAfterHopHeaders(t *testing.T) {
+	// Headers set by Rewrite are sent to the backend, even if they
+	// are hop-by-hop headers of the inbound request.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get(fakeHopHeader), "from rewrite"; got != want {
+			t.Errorf("backend got %v header %q, want %q", fakeHopHeader, got, want)
+		}
+		if got, want := r.Header.Get("Proxy-Authorization"), ""; got != want {
+			t.Errorf("backend got Proxy-Authorization header %q, want %q", got, want)
+		}
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyHandler := &ReverseProxy{
+		Rewrite: func(r *ProxyRequest) {
+			r.SetURL(backendURL)
+			if got, want := r.In.Header.Get(fakeHopHeader), "from client"; got != want {
+				t.Errorf("Rewrite: In %v header = %q, want %q", fakeHopHeader, got, want)
+			}
+			if got := r.Out.Header.Get(fakeHopHeader); got != "" {
+				t.Errorf("Rewrite: Out %v header = %q, want none", fakeHopHeader, got)
+			}
+			r.Out.Header.Set(fakeHopHeader, "from rewrite")
+		},
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	getReq, _ := http.NewRequest("GET", frontend.URL, nil)
+	getReq.Header.Set(fakeHopHeader, "from client")
+	getReq.Header.Set("Proxy-Authorization", "secret")
+	res, err := frontend.Client().Do(getReq)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestReverseProxyDirectorAndRewrite(t *testing.T) {
+	for _, p := range []*ReverseProxy{
+		{},
+		{Director: func(*http.Request) {}, Rewrite: func(*ProxyRequest) {}},
+	} {
+		var gotErr error
+		p.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+			gotErr = err
+			rw.WriteHeader(http.StatusBadGateway)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", "http://example.com/", nil))
+		if gotErr == nil || rw.Code != http.StatusBadGateway {
+			t.Errorf("ServeHTTP with Director set = %v, Rewrite set = %v: got %v, %v; want error, 502",
+				p.Director != nil, p.Rewrite != nil, gotErr, rw.Code)
+		}
+	}
+}
+
+func TestProxyRequestSetURL(t *testing.T) {
+	tests := []struct {
+		target, in string
+		wantURL    string
+	}{
+		{"http://backend.example/base", "http://front.example/dir?a=1", "http://backend.example/base/dir?a=1"},
+		{"http://backend.example/base/", "http://front.example/dir", "http://backend.example/base/dir"},
+		{"http://backend.example", "http://front.example/", "http://backend.example/"},
+		{"https://backend.example:8443/base?t=1", "http://front.example/dir?a=1", "https://backend.example:8443/base/dir?t=1&a=1"},
+		{"http://backend.example/a%2Fb", "http://front.example/c%2Fd", "http://backend.example/a%2Fb/c%2Fd"},
+	}
+	for _, tt := range tests {
+		target, err := url.Parse(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := httptest.NewRequest("GET", tt.in, nil)
+		pr := &ProxyRequest{In: in, Out: in.Clone(context.Background())}
+		pr.SetURL(target)
+		if got := pr.Out.URL.String(); got != tt.wantURL {
+			t.Errorf("SetURL(%q) on %q: URL = %q, want %q", tt.target, tt.in, got, tt.wantURL)
+		}
+		if pr.Out.Host != "" {
+			t.Errorf("SetURL(%q) on %q: Host = %q, want empty", tt.target, tt.in, pr.Out.Host)
+		}
+		if pr.In.URL.String() != tt.in {
+			t.Errorf("SetURL(%q) modified inbound URL to %q", tt.target, pr.In.URL)
+		}
+	}
+}
+
+func TestProxyRequestSetXForwarded(t *testing.T) {
+	for _, tt := range []struct {
+		tls        bool
+		remoteAddr string
+		prior      []string
+		wantFor    string
+		wantProto  string
+	}{
+		{false, "192.0.2.1:1234", nil, "192.0.2.1", "http"},
+		{true, "[2001:db8::1]:1234", nil, "2001:db8::1", "https"},
+		{false, "192.0.2.1:1234", []string{"198.51.100.1", "198.51.100.2"}, "198.51.100.1, 198.51.100.2, 192.0.2.1", "http"},
+		{false, "bogus", []string{"198.51.100.1"}, "", "http"},
+	} {
+		scheme := "http"
+		if tt.tls {
+			scheme = "https"
+		}
+		in := httptest.NewRequest("GET", scheme+"://front.example/", nil)
+		in.RemoteAddr = tt.remoteAddr
+		pr := &ProxyRequest{In: in, Out: in.Clone(context.Background())}
+		pr.Out.Header["X-Forwarded-For"] = tt.prior
+		pr.SetXForwarded()
+		if got := pr.Out.Header.Get("X-Forwarded-For"); got != tt.wantFor {
+			t.Errorf("RemoteAddr %q, prior %q: X-Forwarded-For = %q, want %q", tt.remoteAddr, tt.prior, got, tt.wantFor)
+		}
+		if got, want := pr.Out.Header.Get("X-Forwarded-Host"), "front.example"; got != want {
+			t.Errorf("X-Forwarded-Host = %q, want %q", got, want)
+		}
+		if got := pr.Out.Header.Get("X-Forwarded-Proto"); got != tt.wantProto {
+			t.Errorf("X-Forwarded-Proto = %q, want %q", got, tt.wantProto)
+		}
+	}
+}
+
+func TestProxyRequestSetForwarded(t *testing.T) {
+	for _, tt := range []struct {
+		tls        bool
+		remoteAddr string
+		host       string
+		prior      []string
+		want       string
+	}{
+		{false, "192.0.2.1:1234", "front.example", nil, "for=192.0.2.1;host=front.example;proto=http"},
+		{true, "[2001:db8::1]:1234", "front.example:8443", nil, `for="[2001:db8::1]";host="front.example:8443";proto=https`},
+		{false, "bogus", "", nil, "for=unknown;proto=http"},
+		{false, "192.0.2.1:1234", "front.example", []string{"for=198.51.100.1", "for=198.51.100.2;proto=https"},
+			"for=198.51.100.1, for=198.51.100.2;proto=https, for=192.0.2.1;host=front.example;proto=http"},
+		{false, "192.0.2.1:1234", `a"b\c`, nil, `for=192.0.2.1;host="a\"b\\c";proto=http`},
+	} {
+		scheme := "http"
+		if tt.tls {
+			scheme = "https"
+		}
+		in := httptest.NewRequest("GET", scheme+"://front.example/", nil)
+		in.RemoteAddr = tt.remoteAddr
+		in.Host = tt.host
+		pr := &ProxyRequest{In: in, Out: in.Clone(context.Background())}
+		pr.Out.Header["Forwarded"] = tt.prior
+		pr.SetForwarded()
+		if got := pr.Out.Header.Get("Forwarded"); got != tt.want {
+			t.Errorf("RemoteAddr %q, Host %q, prior %q:\nForwarded = %s\nwant        %s", tt.remoteAddr, tt.host, tt.prior, got, tt.want)
+		}
+	}
+}
+
 func TestXForwardedFor_Omit(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if v := r.Header.Get("X-Forwarded-For"); v != "" {
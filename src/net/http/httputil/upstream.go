@@ -0,0 +1,439 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Load-balancing upstream pool for ReverseProxy
+
+package httputil
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A BalancePolicy selects how an UpstreamPool distributes requests
+// among its upstreams.
+type BalancePolicy int
+
+const (
+	// BalanceRoundRobin sends requests to each upstream in turn.
+	BalanceRoundRobin BalancePolicy = iota
+
+	// BalanceLeastOutstanding sends each request to the upstream with
+	// the fewest requests in flight, breaking ties in round-robin order.
+	BalanceLeastOutstanding
+
+	// BalanceConsistentHash sends requests with the same hash key to
+	// the same upstream, remapping only a small fraction of keys when
+	// an upstream is ejected or added. See UpstreamPool.HashKey.
+	BalanceConsistentHash
+)
+
+// Defaults used when the corresponding UpstreamPool field is zero.
+const (
+	defaultUpstreamMaxFails      = 3
+	defaultUpstreamEjectDuration = 30 * time.Second
+	defaultUpstreamMaxRetries    = 2
+)
+
+// upstreamHashReplicas is the number of points each upstream
+// occupies on the consistent hash ring.
+const upstreamHashReplicas = 100
+
+var errNoUpstream = errors.New("httputil: no upstream available")
+
+// An UpstreamPool distributes proxied requests among a set of
+// upstream servers.
+//
+// An UpstreamPool is used as a pair: its Director method selects an
+// upstream and routes the outbound request to it, and the pool itself
+// is the RoundTripper that sends the request, tracks the health of
+// each upstream, and retries failed requests on another upstream:
+//
+//	pool := httputil.NewUpstreamPool(target1, target2)
+//	proxy := &httputil.ReverseProxy{
+//		Director:  pool.Director,
+//		Transport: pool,
+//	}
+//
+// Health tracking is passive. An upstream is ejected from selection
+// for EjectDuration after MaxFails consecutive requests to it fail
+// with a Transport error. HTTP error statuses are not failures. If
+// every upstream is ejected, the pool ignores health and selects
+// among all of them.
+//
+// A request that fails with a Transport error is retried on another
+// upstream if it is idempotent: its method is GET, HEAD, OPTIONS, or
+// TRACE, or it has an Idempotency-Key or X-Idempotency-Key header,
+// and its body is empty or can be recreated with Request.GetBody.
+//
+// An UpstreamPool's fields must not be changed after its first use.
+// Its methods may be called concurrently.
+type UpstreamPool struct {
+	// Policy selects how requests are distributed among upstreams.
+	Policy BalancePolicy
+
+	// HashKey returns the key used to select an upstream under the
+	// BalanceConsistentHash policy.
+	// If nil, the IP address of the client is used.
+	HashKey func(*http.Request) string
+
+	// Transport is used to send requests to upstreams.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// MaxFails is the number of consecutive failures after which an
+	// upstream is ejected. If zero, 3 is used. If negative,
+	// upstreams are never ejected.
+	MaxFails int
+
+	// EjectDuration is how long an ejected upstream is excluded from
+	// selection. Once it expires, a single further failure ejects the
+	// upstream again, while a success restores it fully.
+	// If zero, 30 seconds is used.
+	EjectDuration time.Duration
+
+	// MaxRetries is the maximum number of times a failed idempotent
+	// request is retried, each time on an upstream not yet tried for
+	// that request. If zero, 2 is used. If negative, requests are
+	// never retried.
+	MaxRetries int
+
+	upstreams []*upstream
+	ring      []upstreamRingPoint // sorted by hash
+
+	mu   sync.Mutex
+	next int // index of the next upstream in round-robin order
+}
+
+// An upstream is a single server in an UpstreamPool.
+type upstream struct {
+	outstanding int64 // atomic; requests in flight; first for 64-bit alignment
+	target      *url.URL
+	index       int
+
+	// Guarded by the pool's mu.
+	fails        int       // consecutive failures
+	ejectedUntil time.Time // zero if never ejected
+}
+
+type upstreamRingPoint struct {
+	hash     uint32
+	upstream *upstream
+}
+
+// NewUpstreamPool returns a new UpstreamPool that routes URLs to the
+// scheme, host, and base path of the provided targets, in the manner
+// of NewSingleHostReverseProxy.
+func NewUpstreamPool(targets ...*url.URL) *UpstreamPool {
+	p := &UpstreamPool{}
+	for i, target := range targets {
+		u := &upstream{target: target, index: i}
+		p.upstreams = append(p.upstreams, u)
+		for r := 0; r < upstreamHashReplicas; r++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(r) + "-" + target.String()))
+			p.ring = append(p.ring, upstreamRingPoint{h, u})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p
+}
+
+// NewMultiHostReverseProxy returns a new ReverseProxy that uses pool
+// as both its Director and its Transport.
+func NewMultiHostReverseProxy(pool *UpstreamPool) *ReverseProxy {
+	return &ReverseProxy{Director: pool.Director, Transport: pool}
+}
+
+// upstreamRouteKey is the context key for a request's *upstreamRoute.
+type upstreamRouteKey struct{}
+
+// An upstreamRoute records how the Director routed a request, so that
+// RoundTrip can account for it and route retries elsewhere.
+type upstreamRoute struct {
+	pool     *UpstreamPool
+	orig     url.URL // the URL before routing
+	upstream *upstream
+}
+
+// Director selects an upstream for req and rewrites req to be sent to
+// it. It does not rewrite the Host header. It is intended to be used
+// as a ReverseProxy's Director, with the pool as its Transport.
+func (p *UpstreamPool) Director(req *http.Request) {
+	u := p.pick(req, nil)
+	if u == nil {
+		return
+	}
+	rt := &upstreamRoute{pool: p, orig: *req.URL, upstream: u}
+	*req = *req.WithContext(context.WithValue(req.Context(), upstreamRouteKey{}, rt))
+	rewriteRequestURL(req, u.target)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// explicitly disable User-Agent so it's not set to default value
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// RoundTrip implements the RoundTripper interface. It sends req to the
+// upstream chosen by the Director, or chooses one itself if req was not
+// routed by the pool's Director.
+func (p *UpstreamPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt, _ := req.Context().Value(upstreamRouteKey{}).(*upstreamRoute)
+	if rt == nil || rt.pool != p {
+		u := p.pick(req, nil)
+		if u == nil {
+			closeRequestBody(req)
+			return nil, errNoUpstream
+		}
+		rt = &upstreamRoute{pool: p, orig: *req.URL, upstream: u}
+		req = rt.route(req)
+	}
+	transport := p.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	var tried []*upstream
+	for {
+		u := rt.upstream
+		atomic.AddInt64(&u.outstanding, 1)
+		res, err := transport.RoundTrip(req)
+		if err == nil {
+			p.markSuccess(u)
+			if res.StatusCode == http.StatusSwitchingProtocols {
+				// The body is the upgraded connection, which
+				// ReverseProxy needs unwrapped. Don't count it as
+				// an outstanding request for however long it lasts.
+				atomic.AddInt64(&u.outstanding, -1)
+			} else {
+				res.Body = &upstreamBody{ReadCloser: res.Body, u: u}
+			}
+			return res, nil
+		}
+		atomic.AddInt64(&u.outstanding, -1)
+		if req.Context().Err() != nil {
+			// The request was canceled; that says nothing about the upstream.
+			return nil, err
+		}
+		p.markFailure(u)
+		tried = append(tried, u)
+		if len(tried) > p.maxRetries() || !isRetryableRequest(req) {
+			return nil, err
+		}
+		next := p.pick(req, tried)
+		if next == nil {
+			return nil, err
+		}
+		var body io.ReadCloser
+		if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+			var gerr error
+			if body, gerr = req.GetBody(); gerr != nil {
+				return nil, err
+			}
+		}
+		rt.upstream = next
+		req = rt.route(req)
+		if body != nil {
+			req.Body = body
+		}
+	}
+}
+
+// route returns a copy of req routed to rt.upstream.
+func (rt *upstreamRoute) route(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	u := rt.orig
+	req.URL = &u
+	rewriteRequestURL(req, rt.upstream.target)
+	return req
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// isRetryableRequest reports whether req may be sent again after a
+// failure, which may have occurred after the upstream received it.
+func isRetryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	// The Idempotency-Key, while non-standard, is widely used to
+	// mean a POST or other request is idempotent. See
+	// https://golang.org/issue/19943#issuecomment-421092421
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := req.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return false
+}
+
+func (p *UpstreamPool) maxFails() int {
+	if p.MaxFails == 0 {
+		return defaultUpstreamMaxFails
+	}
+	return p.MaxFails
+}
+
+func (p *UpstreamPool) ejectDuration() time.Duration {
+	if p.EjectDuration == 0 {
+		return defaultUpstreamEjectDuration
+	}
+	return p.EjectDuration
+}
+
+func (p *UpstreamPool) maxRetries() int {
+	if p.MaxRetries == 0 {
+		return defaultUpstreamMaxRetries
+	}
+	if p.MaxRetries < 0 {
+		return 0
+	}
+	return p.MaxRetries
+}
+
+func (p *UpstreamPool) markSuccess(u *upstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u.fails = 0
+	u.ejectedUntil = time.Time{}
+}
+
+func (p *UpstreamPool) markFailure(u *upstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u.fails++
+	if max := p.maxFails(); max > 0 && u.fails >= max {
+		u.ejectedUntil = time.Now().Add(p.ejectDuration())
+	}
+}
+
+// pick selects an upstream for req, excluding the given upstreams.
+// It returns nil if there is none.
+func (p *UpstreamPool) pick(req *http.Request, exclude []*upstream) *upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.upstreams) == 0 {
+		return nil
+	}
+
+	// Prefer upstreams that are not ejected, but fall back to
+	// ejected ones rather than fail outright.
+	now := time.Now()
+	eligible := make([]bool, len(p.upstreams))
+	var healthy, available int
+	for _, u := range p.upstreams {
+		if upstreamIn(u, exclude) {
+			continue
+		}
+		available++
+		if now.After(u.ejectedUntil) {
+			eligible[u.index] = true
+			healthy++
+		}
+	}
+	if available == 0 {
+		return nil
+	}
+	if healthy == 0 {
+		for _, u := range p.upstreams {
+			eligible[u.index] = !upstreamIn(u, exclude)
+		}
+	}
+
+	switch p.Policy {
+	case BalanceConsistentHash:
+		h := crc32.ChecksumIEEE([]byte(p.hashKey(req)))
+		i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+		for n := 0; n < len(p.ring); n++ {
+			pt := p.ring[(i+n)%len(p.ring)]
+			if eligible[pt.upstream.index] {
+				return pt.upstream
+			}
+		}
+		return nil
+	case BalanceLeastOutstanding:
+		var best *upstream
+		var bestN int64
+		for n := 0; n < len(p.upstreams); n++ {
+			u := p.upstreams[(p.next+n)%len(p.upstreams)]
+			if !eligible[u.index] {
+				continue
+			}
+			if o := atomic.LoadInt64(&u.outstanding); best == nil || o < bestN {
+				best, bestN = u, o
+			}
+		}
+		p.next = (best.index + 1) % len(p.upstreams)
+		return best
+	default:
+		for n := 0; n < len(p.upstreams); n++ {
+			u := p.upstreams[(p.next+n)%len(p.upstreams)]
+			if eligible[u.index] {
+				p.next = (u.index + 1) % len(p.upstreams)
+				return u
+			}
+		}
+		return nil
+	}
+}
+
+func upstreamIn(u *upstream, list []*upstream) bool {
+	for _, v := range list {
+		if u == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UpstreamPool) hashKey(req *http.Request) string {
+	if p.HashKey != nil {
+		return p.HashKey(req)
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// upstreamBody wraps a response body to count its request as
+// outstanding until the body is read to EOF or closed.
+type upstreamBody struct {
+	io.ReadCloser
+	u    *upstream
+	once sync.Once
+}
+
+func (b *upstreamBody) done() {
+	b.once.Do(func() { atomic.AddInt64(&b.u.outstanding, -1) })
+}
+
+func (b *upstreamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *upstreamBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
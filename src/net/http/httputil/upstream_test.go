@@ -0,0 +1,312 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestUpstreams starts n backends that respond with their index
+// and the request path, and returns them with their URLs.
+func newTestUpstreams(t *testing.T, n int) ([]*httptest.Server, []*url.URL) {
+	var servers []*httptest.Server
+	var urls []*url.URL
+	for i := 0; i < n; i++ {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%d %s", i, r.URL.Path)
+		}))
+		t.Cleanup(ts.Close)
+		u, err := url.Parse(ts.URL + "/base")
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, ts)
+		urls = append(urls, u)
+	}
+	return servers, urls
+}
+
+// deadUpstream returns the URL of a server that refuses connections.
+func deadUpstream(t *testing.T) *url.URL {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+	return u
+}
+
+func proxyGet(t *testing.T, frontend *httptest.Server, method, path string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, frontend.URL+path, nil)
+	res, err := frontend.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	_, urls := newTestUpstreams(t, 3)
+	pool := NewUpstreamPool(urls...)
+	frontend := httptest.NewServer(NewMultiHostReverseProxy(pool))
+	defer frontend.Close()
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		_, body := proxyGet(t, frontend, "GET", "/dir")
+		got = append(got, body)
+	}
+	want := "0 /base/dir,1 /base/dir,2 /base/dir,0 /base/dir,1 /base/dir,2 /base/dir"
+	if g := strings.Join(got, ","); g != want {
+		t.Errorf("responses = %q, want %q", g, want)
+	}
+}
+
+func TestUpstreamPoolRetryAndEject(t *testing.T) {
+	_, urls := newTestUpstreams(t, 2)
+	dead := deadUpstream(t)
+	pool := NewUpstreamPool(dead, urls[0], urls[1])
+	pool.MaxFails = 2
+	frontend := httptest.NewServer(NewMultiHostReverseProxy(pool))
+	defer frontend.Close()
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		code, body := proxyGet(t, frontend, "GET", "/")
+		if code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, code)
+		}
+		counts[body[:1]]++
+	}
+	if counts["0"] == 0 || counts["1"] == 0 {
+		t.Errorf("responses by upstream = %v; want both live upstreams used", counts)
+	}
+
+	down := pool.upstreams[0]
+	pool.mu.Lock()
+	fails, ejected := down.fails, time.Now().Before(down.ejectedUntil)
+	pool.mu.Unlock()
+	if fails != 2 || !ejected {
+		t.Errorf("dead upstream: fails = %d, ejected = %v; want 2, true", fails, ejected)
+	}
+	for i, u := range pool.upstreams {
+		if o := atomic.LoadInt64(&u.outstanding); o != 0 {
+			t.Errorf("upstream %d: outstanding = %d, want 0", i, o)
+		}
+	}
+}
+
+func TestUpstreamPoolNoRetryNonIdempotent(t *testing.T) {
+	_, urls := newTestUpstreams(t, 1)
+	pool := NewUpstreamPool(deadUpstream(t), urls[0])
+	proxy := NewMultiHostReverseProxy(pool)
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+	frontend := httptest.NewServer(proxy)
+	defer frontend.Close()
+
+	if code, _ := proxyGet(t, frontend, "POST", "/"); code != http.StatusBadGateway {
+		t.Errorf("POST to dead upstream: status %d, want %d", code, http.StatusBadGateway)
+	}
+	// The next request goes to the live upstream in round-robin order.
+	if code, body := proxyGet(t, frontend, "POST", "/"); code != http.StatusOK || body != "0 /base/" {
+		t.Errorf("POST to live upstream: %d %q, want 200 %q", code, body, "0 /base/")
+	}
+}
+
+func TestUpstreamPoolRetryLimit(t *testing.T) {
+	pool := NewUpstreamPool(deadUpstream(t), deadUpstream(t), deadUpstream(t))
+	pool.MaxRetries = 1
+	proxy := NewMultiHostReverseProxy(pool)
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+	frontend := httptest.NewServer(proxy)
+	defer frontend.Close()
+
+	if code, _ := proxyGet(t, frontend, "GET", "/"); code != http.StatusBadGateway {
+		t.Errorf("status %d, want %d", code, http.StatusBadGateway)
+	}
+	var tried int
+	pool.mu.Lock()
+	for _, u := range pool.upstreams {
+		tried += u.fails
+	}
+	pool.mu.Unlock()
+	if tried != 2 {
+		t.Errorf("upstreams tried = %d, want 2", tried)
+	}
+}
+
+func TestUpstreamPoolEjectExpiry(t *testing.T) {
+	a, _ := url.Parse("http://a.example")
+	b, _ := url.Parse("http://b.example")
+	pool := NewUpstreamPool(a, b)
+	pool.MaxFails = 1
+	pool.EjectDuration = time.Hour
+	req := httptest.NewRequest("GET", "/", nil)
+
+	pool.markFailure(pool.upstreams[0])
+	for i := 0; i < 3; i++ {
+		if u := pool.pick(req, nil); u != pool.upstreams[1] {
+			t.Fatalf("pick with a ejected = %v, want b", u.target)
+		}
+	}
+
+	// With every upstream ejected, selection ignores health.
+	pool.markFailure(pool.upstreams[1])
+	if u := pool.pick(req, nil); u == nil {
+		t.Fatalf("pick with all ejected = nil, want an upstream")
+	}
+
+	// Once the ejection expires, a is eligible again.
+	pool.mu.Lock()
+	pool.upstreams[0].ejectedUntil = time.Now().Add(-time.Second)
+	pool.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if u := pool.pick(req, nil); u != pool.upstreams[0] {
+			t.Fatalf("pick after a's ejection expired = %v, want a", u.target)
+		}
+	}
+
+	// A success clears the failure count.
+	pool.markSuccess(pool.upstreams[0])
+	if f := pool.upstreams[0].fails; f != 0 {
+		t.Errorf("fails after success = %d, want 0", f)
+	}
+}
+
+func TestUpstreamPoolLeastOutstanding(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+	slowURL, _ := url.Parse(slow.URL)
+	fastURL, _ := url.Parse(fast.URL)
+
+	pool := NewUpstreamPool(slowURL, fastURL)
+	pool.Policy = BalanceLeastOutstanding
+	frontend := httptest.NewServer(NewMultiHostReverseProxy(pool))
+	defer frontend.Close()
+
+	slowc := make(chan string, 1)
+	go func() {
+		res, err := frontend.Client().Get(frontend.URL)
+		if err != nil {
+			slowc <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		slowc <- string(b)
+	}()
+	for i := 0; atomic.LoadInt64(&pool.upstreams[0].outstanding) == 0; i++ {
+		if i > 1000 {
+			t.Fatal("first request never reached the slow upstream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, body := proxyGet(t, frontend, "GET", "/"); body != "fast" {
+			t.Errorf("request %d with slow upstream busy: got %q, want %q", i, body, "fast")
+		}
+	}
+	release <- struct{}{}
+	if got := <-slowc; got != "slow" {
+		t.Errorf("first request: got %q, want %q", got, "slow")
+	}
+}
+
+func TestUpstreamPoolConsistentHash(t *testing.T) {
+	var urls []*url.URL
+	for i := 0; i < 4; i++ {
+		u, _ := url.Parse(fmt.Sprintf("http://backend%d.example", i))
+		urls = append(urls, u)
+	}
+	pool := NewUpstreamPool(urls...)
+	pool.Policy = BalanceConsistentHash
+	pool.HashKey = func(r *http.Request) string { return r.Header.Get("X-User") }
+
+	const keys = 1000
+	pickFor := func(key string) *upstream {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User", key)
+		return pool.pick(req, nil)
+	}
+	before := make([]*upstream, keys)
+	used := map[*upstream]int{}
+	for i := range before {
+		before[i] = pickFor(fmt.Sprint("user", i))
+		used[before[i]]++
+		if again := pickFor(fmt.Sprint("user", i)); again != before[i] {
+			t.Fatalf("key %d mapped to %v, then %v", i, before[i].target, again.target)
+		}
+	}
+	for _, u := range pool.upstreams {
+		if n := used[u]; n < keys/10 {
+			t.Errorf("upstream %v got %d of %d keys; want a fairer share", u.target, n, keys)
+		}
+	}
+
+	// Ejecting one upstream remaps only its own keys.
+	ejected := pool.upstreams[2]
+	pool.MaxFails = 1
+	pool.markFailure(ejected)
+	for i := range before {
+		after := pickFor(fmt.Sprint("user", i))
+		if after == ejected {
+			t.Fatalf("key %d mapped to ejected upstream", i)
+		}
+		if before[i] != ejected && after != before[i] {
+			t.Errorf("key %d moved from %v to %v", i, before[i].target, after.target)
+		}
+	}
+}
+
+func TestUpstreamPoolWithoutDirector(t *testing.T) {
+	_, urls := newTestUpstreams(t, 2)
+	pool := NewUpstreamPool(urls...)
+	c := &http.Client{Transport: pool}
+	for i := 0; i < 2; i++ {
+		res, err := c.Get("http://unused.example/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if want := fmt.Sprintf("%d /base/x", i); string(b) != want {
+			t.Errorf("request %d: got %q, want %q", i, b, want)
+		}
+	}
+
+	if _, err := (&http.Client{Transport: NewUpstreamPool()}).Get("http://unused.example/"); err == nil {
+		t.Errorf("request with empty pool succeeded")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+// DecodeFieldSection decodes the encoded field section b, calling f for
+// each field line in order. If f returns an error, decoding stops and the
+// error is returned.
+//
+// Field sections referring to the dynamic table are rejected, since we
+// advertise a dynamic table capacity of zero.
+func DecodeFieldSection(b []byte, f func(HeaderField) error) error {
+	ric, n := consumeInteger(b, 8)
+	if n < 0 {
+		return DecodingError{"truncated field section prefix"}
+	}
+	if ric != 0 {
+		return DecodingError{"reference to dynamic table"}
+	}
+	b = b[n:]
+	if _, n = consumeInteger(b, 7); n < 0 { // Delta Base
+		return DecodingError{"truncated field section prefix"}
+	}
+	b = b[n:]
+	for len(b) > 0 {
+		field, n, err := decodeFieldLine(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		if err := f(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeFieldLine(b []byte) (f HeaderField, n int, err error) {
+	c := b[0]
+	switch {
+	case c&indexedFieldLine != 0:
+		if c&staticBit6 == 0 {
+			return f, 0, DecodingError{"reference to dynamic table"}
+		}
+		i, n := consumeInteger(b, 6)
+		if n < 0 {
+			return f, 0, DecodingError{"truncated field line"}
+		}
+		if i >= uint64(len(staticTable)) {
+			return f, 0, DecodingError{"invalid static table index"}
+		}
+		return staticTable[i], n, nil
+	case c&literalWithNameRef != 0:
+		if c&staticBit4 == 0 {
+			return f, 0, DecodingError{"reference to dynamic table"}
+		}
+		i, n := consumeInteger(b, 4)
+		if n < 0 {
+			return f, 0, DecodingError{"truncated field line"}
+		}
+		if i >= uint64(len(staticTable)) {
+			return f, 0, DecodingError{"invalid static table index"}
+		}
+		f.Name = staticTable[i].Name
+		f.Sensitive = c&neverIndexedNameRef != 0
+		v, m, err := consumeString(b[n:], 7)
+		if err != nil {
+			return f, 0, err
+		}
+		f.Value = v
+		return f, n + m, nil
+	case c&literalWithLiteralName != 0:
+		f.Sensitive = c&neverIndexedLiteralName != 0
+		name, n, err := consumeString(b, 3)
+		if err != nil {
+			return f, 0, err
+		}
+		v, m, err := consumeString(b[n:], 7)
+		if err != nil {
+			return f, 0, err
+		}
+		f.Name, f.Value = name, v
+		return f, n + m, nil
+	}
+	// Indexed field lines and literals with post-base indexes always
+	// refer to the dynamic table.
+	return f, 0, DecodingError{"reference to dynamic table"}
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+// Field line representations. See RFC 9204, Section 4.5.
+const (
+	indexedFieldLine        = 0x80 // 1 T index(6+)
+	literalWithNameRef      = 0x40 // 0 1 N T index(4+)
+	literalWithLiteralName  = 0x20 // 0 0 1 N H name-length(3+)
+	indexedPostBase         = 0x10 // 0 0 0 1 index(4+)
+	staticBit6              = 0x40 // T bit of an indexed field line
+	staticBit4              = 0x10 // T bit of a literal with name reference
+	neverIndexedNameRef     = 0x20 // N bit of a literal with name reference
+	neverIndexedLiteralName = 0x10 // N bit of a literal with literal name
+)
+
+// AppendFieldSection appends the encoded field section for fields to b.
+// Field names must already be lowercase.
+func AppendFieldSection(b []byte, fields []HeaderField) []byte {
+	// The Required Insert Count and Delta Base are both zero, since the
+	// dynamic table is never used. See RFC 9204, Section 4.5.1.
+	b = append(b, 0, 0)
+	for _, f := range fields {
+		b = appendFieldLine(b, f)
+	}
+	return b
+}
+
+func appendFieldLine(b []byte, f HeaderField) []byte {
+	key := HeaderField{Name: f.Name, Value: f.Value}
+	if i, ok := staticByField[key]; ok && !f.Sensitive {
+		return appendInteger(b, indexedFieldLine|staticBit6, 6, uint64(i))
+	}
+	if i, ok := staticByName[f.Name]; ok {
+		first := byte(literalWithNameRef | staticBit4)
+		if f.Sensitive {
+			first |= neverIndexedNameRef
+		}
+		b = appendInteger(b, first, 4, uint64(i))
+		return appendString(b, 0, 7, f.Value)
+	}
+	first := byte(literalWithLiteralName)
+	if f.Sensitive {
+		first |= neverIndexedLiteralName
+	}
+	b = appendString(b, first, 3, f.Name)
+	return appendString(b, 0, 7, f.Value)
+}
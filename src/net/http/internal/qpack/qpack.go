@@ -0,0 +1,135 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qpack implements QPACK field compression for HTTP/3, as specified
+// in RFC 9204.
+//
+// Only the static table is used. The encoder never inserts into the dynamic
+// table, and the decoder advertises a dynamic table capacity of zero, so no
+// encoder or decoder streams are needed.
+package qpack
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// A HeaderField is a name-value pair. Both the name and value are treated as
+// opaque sequences of octets.
+type HeaderField struct {
+	Name, Value string
+
+	// Sensitive means that this header field should never be indexed
+	// by an intermediary.
+	Sensitive bool
+}
+
+func (f HeaderField) String() string {
+	var suffix string
+	if f.Sensitive {
+		suffix = " (sensitive)"
+	}
+	return fmt.Sprintf("header field %q = %q%s", f.Name, f.Value, suffix)
+}
+
+// Size returns the size of the field as defined by RFC 9204, Section 3.2.1,
+// for use with the SETTINGS_MAX_FIELD_SECTION_SIZE setting.
+func (f HeaderField) Size() uint64 {
+	return uint64(len(f.Name) + len(f.Value) + 32)
+}
+
+// ErrDecompressionFailed is returned for field sections which cannot be
+// decoded. HTTP/3 treats it as a connection error of type
+// QPACK_DECOMPRESSION_FAILED.
+var ErrDecompressionFailed = errors.New("qpack: decompression failed")
+
+// A DecodingError wraps ErrDecompressionFailed with a description of the
+// problem.
+type DecodingError struct {
+	Reason string
+}
+
+func (e DecodingError) Error() string {
+	return "qpack: decompression failed: " + e.Reason
+}
+
+func (e DecodingError) Unwrap() error { return ErrDecompressionFailed }
+
+// appendInteger appends v using an n-bit prefix, where first holds the
+// bits of the first byte above the prefix. See RFC 7541, Section 5.1.
+func appendInteger(b []byte, first byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, first|byte(v))
+	}
+	b = append(b, first|byte(max))
+	v -= max
+	for v >= 128 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// consumeInteger decodes an integer with an n-bit prefix from b.
+// It returns the value and the number of bytes consumed, or -1 on error.
+func consumeInteger(b []byte, n uint) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	if v < max {
+		return v, 1
+	}
+	var m uint
+	for i := 1; i < len(b); i++ {
+		c := b[i]
+		v += uint64(c&0x7f) << m
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+		m += 7
+		if m >= 63 {
+			return 0, -1
+		}
+	}
+	return 0, -1
+}
+
+// appendString appends s using an n-bit length prefix, where first holds
+// the bits of the first byte above the Huffman flag and the prefix.
+// Huffman coding is used when it is shorter.
+func appendString(b []byte, first byte, n uint, s string) []byte {
+	hbit := byte(1) << n
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendInteger(b, first|hbit, n, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendInteger(b, first, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// consumeString decodes a string with an n-bit length prefix from b.
+func consumeString(b []byte, n uint) (string, int, error) {
+	if len(b) == 0 {
+		return "", 0, DecodingError{"truncated string"}
+	}
+	huffman := b[0]&(1<<n) != 0
+	l, m := consumeInteger(b, n)
+	if m < 0 || l > uint64(len(b)-m) {
+		return "", 0, DecodingError{"truncated string"}
+	}
+	raw := b[m : m+int(l)]
+	if !huffman {
+		return string(raw), m + int(l), nil
+	}
+	s, err := hpack.HuffmanDecodeToString(raw)
+	if err != nil {
+		return "", 0, DecodingError{"invalid Huffman-encoded string"}
+	}
+	return s, m + int(l), nil
+}
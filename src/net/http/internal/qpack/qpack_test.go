@@ -0,0 +1,113 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeAll(b []byte) ([]HeaderField, error) {
+	var fields []HeaderField
+	err := DecodeFieldSection(b, func(f HeaderField) error {
+		fields = append(fields, f)
+		return nil
+	})
+	return fields, err
+}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestStaticTable(t *testing.T) {
+	if len(staticTable) != 99 {
+		t.Fatalf("static table has %v entries, want 99", len(staticTable))
+	}
+	// Spot checks against RFC 9204, Appendix A.
+	for _, tt := range []struct {
+		i int
+		f HeaderField
+	}{
+		{0, HeaderField{Name: ":authority"}},
+		{17, HeaderField{Name: ":method", Value: "GET"}},
+		{25, HeaderField{Name: ":status", Value: "200"}},
+		{63, HeaderField{Name: ":status", Value: "100"}},
+		{98, HeaderField{Name: "x-frame-options", Value: "sameorigin"}},
+	} {
+		if staticTable[tt.i] != tt.f {
+			t.Errorf("staticTable[%v] = %v, want %v", tt.i, staticTable[tt.i], tt.f)
+		}
+	}
+}
+
+func TestDecodeRFCExample(t *testing.T) {
+	// RFC 9204, Appendix B.1: Literal Field Line with Name Reference.
+	got, err := decodeAll(unhex("0000 510b 2f69 6e64 6578 2e68 746d 6c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{{Name: ":path", Value: "/index.html"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	fields := []HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: "/"},
+		{Name: "user-agent", Value: "Go-http-client/3"},
+		{Name: "authorization", Value: "secret", Sensitive: true},
+		{Name: "cookie", Value: "", Sensitive: true},
+		{Name: "x-custom", Value: strings.Repeat("v", 300)},
+		{Name: "x-binary", Value: "\x00\xff"},
+	}
+	b := AppendFieldSection(nil, fields)
+	got, err := decodeAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("round trip:\n got %v\nwant %v", got, fields)
+	}
+	// Fields in the static table are fully indexed.
+	b = AppendFieldSection(nil, fields[:1])
+	if want := []byte{0, 0, 0xc0 | 17}; !reflect.DeepEqual(b, want) {
+		t.Errorf("encoded :method GET as %x, want %x", b, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"required insert count", unhex("0200 80")},
+		{"dynamic indexed", unhex("0000 80")},
+		{"dynamic name reference", unhex("0000 4000")},
+		{"post-base indexed", unhex("0000 10")},
+		{"post-base name reference", unhex("0000 0000")},
+		{"static index out of range", unhex("0000 ff24")},
+		{"truncated string", unhex("0000 5105 2f")},
+		{"truncated integer", unhex("0000 ff")},
+		{"invalid huffman", unhex("0000 5181 00")},
+	} {
+		_, err := decodeAll(tt.b)
+		if !errors.Is(err, ErrDecompressionFailed) {
+			t.Errorf("%v: got error %v, want ErrDecompressionFailed", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// A recvBuffer reassembles a byte stream from possibly out-of-order and
+// duplicated frames, as for STREAM and CRYPTO frames.
+type recvBuffer struct {
+	off  int64    // offset of buf[0]; all data before it has been consumed
+	buf  []byte   // data from off up to the largest offset received
+	have rangeset // offsets received, at or after off
+}
+
+// end returns the offset just past the largest byte received.
+func (r *recvBuffer) end() int64 {
+	return r.off + int64(len(r.buf))
+}
+
+// write records data received at offset off.
+func (r *recvBuffer) write(off int64, data []byte) {
+	if off < r.off {
+		skip := r.off - off
+		if skip >= int64(len(data)) {
+			return
+		}
+		data = data[skip:]
+		off = r.off
+	}
+	if len(data) == 0 {
+		return
+	}
+	end := off + int64(len(data))
+	if end > r.end() {
+		r.buf = append(r.buf, make([]byte, int(end-r.end()))...)
+	}
+	copy(r.buf[off-r.off:], data)
+	r.have.add(off, end)
+}
+
+// readable returns the contiguous data available at off.
+func (r *recvBuffer) readable() []byte {
+	if len(r.have) == 0 || r.have[0].start != r.off {
+		return nil
+	}
+	return r.buf[:r.have[0].end-r.off]
+}
+
+// consume discards the first n readable bytes.
+func (r *recvBuffer) consume(n int) {
+	r.off += int64(n)
+	r.buf = r.buf[n:]
+	r.have.removeBefore(r.off)
+	if len(r.buf) == 0 {
+		r.buf = nil // release the underlying array
+	}
+}
+
+// discard drops all buffered data, treating it as consumed.
+func (r *recvBuffer) discard() {
+	r.off = r.end()
+	r.buf = nil
+	r.have = nil
+}
+
+// A sendBuffer holds data written to a stream until it is acknowledged,
+// tracking what must be sent or retransmitted.
+type sendBuffer struct {
+	off   int64    // offset of buf[0]; all data before it has been acknowledged
+	buf   []byte   // unacknowledged data
+	next  int64    // offset of the first byte never sent
+	lost  rangeset // ranges to retransmit
+	acked rangeset // acknowledged ranges at or after off
+}
+
+// end returns the offset just past the last byte written.
+func (s *sendBuffer) end() int64 {
+	return s.off + int64(len(s.buf))
+}
+
+func (s *sendBuffer) write(b []byte) {
+	s.buf = append(s.buf, b...)
+}
+
+// hasData reports whether there is data to send or retransmit.
+func (s *sendBuffer) hasData() bool {
+	return len(s.lost) > 0 || s.next < s.end()
+}
+
+// nextData returns the next data to send, at most max bytes long. New data
+// is limited to offsets below limit, for flow control. isNew reports whether
+// the data has never been sent.
+func (s *sendBuffer) nextData(max int, limit int64) (off int64, data []byte, isNew bool) {
+	if len(s.lost) > 0 {
+		r := s.lost[0]
+		size := r.size()
+		if size > int64(max) {
+			size = int64(max)
+		}
+		return r.start, s.buf[r.start-s.off:][:size], false
+	}
+	end := s.end()
+	if limit < end {
+		end = limit
+	}
+	if s.next >= end {
+		return s.next, nil, true
+	}
+	size := end - s.next
+	if size > int64(max) {
+		size = int64(max)
+	}
+	return s.next, s.buf[s.next-s.off:][:size], true
+}
+
+// sent records that [off, off+size) has been sent.
+func (s *sendBuffer) sent(off int64, size int) {
+	end := off + int64(size)
+	s.lost.sub(off, end)
+	if end > s.next {
+		s.next = end
+	}
+}
+
+// ack records that [off, off+size) has been acknowledged.
+func (s *sendBuffer) ack(off int64, size int) {
+	s.acked.add(off, off+int64(size))
+	s.lost.sub(off, off+int64(size))
+	if len(s.acked) > 0 && s.acked[0].start <= s.off {
+		n := s.acked[0].end - s.off
+		if n > 0 {
+			s.buf = s.buf[n:]
+			s.off += n
+			if len(s.buf) == 0 {
+				s.buf = nil
+			}
+		}
+		s.acked.removeBefore(s.off)
+	}
+}
+
+// lose records that [off, off+size) was lost and must be retransmitted.
+func (s *sendBuffer) lose(off int64, size int) {
+	start, end := off, off+int64(size)
+	if start < s.off {
+		start = s.off
+	}
+	if start >= end {
+		return
+	}
+	s.lost.add(start, end)
+	for _, r := range s.acked {
+		s.lost.sub(r.start, r.end)
+	}
+}
+
+// discard drops all unsent and unacknowledged data.
+func (s *sendBuffer) discard() {
+	s.off = s.end()
+	s.buf = nil
+	s.lost = nil
+	s.acked = nil
+	if s.next < s.off {
+		s.next = s.off
+	}
+}
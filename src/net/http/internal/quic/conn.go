@@ -0,0 +1,813 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type connSide int8
+
+const (
+	clientSide connSide = 0
+	serverSide connSide = 1
+)
+
+func (s connSide) peer() connSide { return s ^ 1 }
+
+// A numberSpace is a packet number space. See RFC 9000, Section 12.3.
+type numberSpace int
+
+const (
+	initialSpace numberSpace = iota
+	handshakeSpace
+	appDataSpace
+	numberSpaceCount
+)
+
+// connState is the closing state of a connection. See RFC 9000, Section 10.2.
+type connState int
+
+const (
+	connOpen     connState = iota
+	connClosing            // we sent CONNECTION_CLOSE
+	connDraining           // the peer sent CONNECTION_CLOSE
+	connDone               // the connection is finished
+)
+
+// A pnState is the state of one packet number space.
+type pnState struct {
+	// Sending.
+	nextNum          int64
+	largestAcked     int64 // -1 if none
+	sent             []*sentPacket
+	lossTime         time.Time
+	lastAckEliciting time.Time
+
+	// Receiving.
+	recvd               rangeset
+	largestRecvdTime    time.Time
+	ackPending          bool // packets received and not yet acknowledged
+	ackElicitingUnacked int  // ack-eliciting packets not yet acknowledged
+	ackDeadline         time.Time
+
+	cryptoSend sendBuffer
+	cryptoRecv recvBuffer
+
+	discarded bool
+}
+
+// A Conn is a QUIC connection.
+//
+// Multiple goroutines may invoke methods on a Conn simultaneously.
+type Conn struct {
+	side     connSide
+	endpoint *Endpoint
+	config   *Config
+	peerAddr net.Addr
+
+	msgc           chan []byte   // received datagrams
+	wakec          chan struct{} // wakes the loop to send
+	donec          chan struct{} // closed when the loop exits
+	closedc        chan struct{} // closed when closeErr is set
+	handshakeDonec chan struct{} // closed when the handshake completes or fails
+
+	mu sync.Mutex // guards all fields below
+
+	tls           *tls.QUICConn
+	localConnID   []byte
+	origDstConnID []byte // the client's first destination connection ID
+	peerConnID    []byte
+	gotPeerConnID bool
+
+	spaces        [numberSpaceCount]pnState
+	initialKeys   fixedKeys
+	handshakeKeys fixedKeys
+	appKeys       updatingKeys
+
+	peerParams         transportParameters
+	gotPeerParams      bool
+	handshakeDone      bool // TLS handshake complete
+	handshakeConfirmed bool
+	needHandshakeDone  bool // server must send HANDSHAKE_DONE
+	handshakeDeadline  time.Time
+
+	streams             map[streamID]*Stream
+	nextLocalStreamNum  [2]int64
+	localStreamLimit    [2]int64
+	remoteStreamsOpened [2]int64
+	remoteStreamsDone   [2]int64
+	remoteStreamLimit   [2]int64
+	needMaxStreams      [2]bool
+	acceptQueue         []*Stream
+	acceptNotify        chan struct{}
+	streamLimitNotify   [2]chan struct{}
+	sendQueue           []*Stream
+
+	// Connection-level flow control.
+	connRecvMax  int64 // MAX_DATA we have sent
+	connRecvd    int64 // sum of the highest offsets received on each stream
+	connConsumed int64 // bytes read or discarded
+	needMaxData  bool
+	connSendMax  int64 // peer's MAX_DATA
+	connSent     int64 // new stream data sent
+
+	rtt      rttState
+	cc       ccReno
+	ptoCount int
+	probe    [numberSpaceCount]int // probe packets to send
+	needPing bool
+
+	// Anti-amplification limit for unvalidated client addresses.
+	addrValidated bool
+	bytesRecvd    int64
+	bytesSent     int64
+
+	idleTimeout       time.Duration
+	idleDeadline      time.Time
+	lastRecvTime      time.Time
+	lastSendTime      time.Time
+	sentSinceRecv     bool // ack-eliciting packet sent since last receipt
+	keepAliveDeadline time.Time
+
+	pathResponses [][8]byte
+
+	state            connState
+	closeErr         error // error returned by operations after close
+	closeLocal       error // the error we send in CONNECTION_CLOSE
+	closeSendPending bool
+	closeDeadline    time.Time
+}
+
+func newConn(now time.Time, side connSide, e *Endpoint, config *Config, peerAddr net.Addr, dstConnID, srcConnID []byte) (*Conn, error) {
+	c := &Conn{
+		side:           side,
+		endpoint:       e,
+		config:         config,
+		peerAddr:       peerAddr,
+		msgc:           make(chan []byte, 256),
+		wakec:          make(chan struct{}, 1),
+		donec:          make(chan struct{}),
+		closedc:        make(chan struct{}),
+		handshakeDonec: make(chan struct{}),
+		streams:        make(map[streamID]*Stream),
+		acceptNotify:   make(chan struct{}, 1),
+		addrValidated:  side == clientSide,
+		lastRecvTime:   now,
+	}
+	c.streamLimitNotify[bidiStream] = make(chan struct{}, 1)
+	c.streamLimitNotify[uniStream] = make(chan struct{}, 1)
+	c.rtt.init()
+	c.cc.init()
+	for i := range c.spaces {
+		c.spaces[i].largestAcked = -1
+	}
+	c.localConnID = newConnID()
+	if side == clientSide {
+		c.origDstConnID = newConnID()
+		c.peerConnID = c.origDstConnID
+	} else {
+		c.origDstConnID = dstConnID
+		c.peerConnID = srcConnID
+		c.gotPeerConnID = true
+	}
+	clientSecret, serverSecret := initialSecrets(c.origDstConnID)
+	if side == clientSide {
+		c.initialKeys.setRead(tls.TLS_AES_128_GCM_SHA256, serverSecret)
+		c.initialKeys.setWrite(tls.TLS_AES_128_GCM_SHA256, clientSecret)
+	} else {
+		c.initialKeys.setRead(tls.TLS_AES_128_GCM_SHA256, clientSecret)
+		c.initialKeys.setWrite(tls.TLS_AES_128_GCM_SHA256, serverSecret)
+	}
+
+	c.connRecvMax = config.maxConnReadBufferSize()
+	c.remoteStreamLimit[bidiStream] = config.maxBidiRemoteStreams()
+	c.remoteStreamLimit[uniStream] = config.maxUniRemoteStreams()
+	c.idleTimeout = config.maxIdleTimeout()
+	c.handshakeDeadline = now.Add(config.handshakeTimeout())
+
+	tlsConfig := config.TLSConfig.Clone()
+	if tlsConfig.MinVersion < tls.VersionTLS13 {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	qconfig := &tls.QUICConfig{TLSConfig: tlsConfig}
+	if side == clientSide {
+		c.tls = tls.QUICClient(qconfig)
+	} else {
+		c.tls = tls.QUICServer(qconfig)
+	}
+	c.tls.SetTransportParameters(c.localTransportParameters())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.tls.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := c.handleTLSEvents(now); err != nil {
+		c.tls.Close()
+		return nil, err
+	}
+	c.resetIdleTimer(now)
+	return c, nil
+}
+
+func newConnID() []byte {
+	cid := make([]byte, connIDLen)
+	if _, err := rand.Read(cid); err != nil {
+		panic("quic: failed to generate connection ID: " + err.Error())
+	}
+	return cid
+}
+
+func (c *Conn) localTransportParameters() []byte {
+	p := defaultTransportParameters()
+	if c.side == serverSide {
+		p.originalDstConnID = c.origDstConnID
+		p.disableActiveMigration = true
+	}
+	p.maxIdleTimeout = c.idleTimeout
+	p.maxUDPPayloadSize = maxRecvDatagramSize
+	p.initialMaxData = c.connRecvMax
+	p.initialMaxStreamDataBidiLocal = c.config.maxStreamReadBufferSize()
+	p.initialMaxStreamDataBidiRemote = c.config.maxStreamReadBufferSize()
+	p.initialMaxStreamDataUni = c.config.maxStreamReadBufferSize()
+	p.initialMaxStreamsBidi = c.remoteStreamLimit[bidiStream]
+	p.initialMaxStreamsUni = c.remoteStreamLimit[uniStream]
+	p.initialSrcConnID = c.localConnID
+	return p.marshal()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.endpoint.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peerAddr
+}
+
+// ConnectionState returns basic TLS details about the connection.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tls.ConnectionState()
+}
+
+// wake wakes the connection loop so that it sends any pending frames.
+func (c *Conn) wake() {
+	notify(c.wakec)
+}
+
+// loop runs the connection, processing received datagrams and timers
+// and sending packets, until the connection is done.
+func (c *Conn) loop() {
+	defer close(c.donec)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.handleTimers(now)
+		if c.state != connDone {
+			c.send(now)
+		}
+		if c.state == connDone {
+			c.finish()
+			c.mu.Unlock()
+			return
+		}
+		next := c.nextDeadline()
+		c.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+		select {
+		case d := <-c.msgc:
+			c.mu.Lock()
+			c.handleDatagram(time.Now(), d)
+			// Process any other queued datagrams before sending, so we can
+			// coalesce acknowledgements.
+			for more := true; more && c.state != connDone; {
+				select {
+				case d := <-c.msgc:
+					c.handleDatagram(time.Now(), d)
+				default:
+					more = false
+				}
+			}
+			c.mu.Unlock()
+		case <-timer.C:
+		case <-c.wakec:
+		}
+	}
+}
+
+// finish releases the resources of a connection that is done.
+func (c *Conn) finish() {
+	if c.closeErr == nil {
+		c.setCloseErr(errConnClosed)
+	}
+	c.tls.Close()
+	c.endpoint.removeConn(c)
+}
+
+// nextDeadline returns the time at which the loop must next run.
+func (c *Conn) nextDeadline() time.Time {
+	next := time.Now().Add(time.Hour)
+	earliest := func(t time.Time) {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	if c.state == connClosing || c.state == connDraining {
+		earliest(c.closeDeadline)
+		return next
+	}
+	earliest(c.idleDeadline)
+	if !c.handshakeDone {
+		earliest(c.handshakeDeadline)
+	}
+	earliest(c.keepAliveDeadline)
+	for i := range c.spaces {
+		earliest(c.spaces[i].ackDeadline)
+	}
+	t, _ := c.lossDetectionDeadline()
+	earliest(t)
+	return next
+}
+
+// handleTimers performs any actions whose time has come.
+func (c *Conn) handleTimers(now time.Time) {
+	switch c.state {
+	case connClosing, connDraining:
+		if !now.Before(c.closeDeadline) {
+			c.state = connDone
+		}
+		return
+	case connDone:
+		return
+	}
+	if !c.idleDeadline.IsZero() && !now.Before(c.idleDeadline) {
+		c.setCloseErr(errIdleTimeout)
+		c.state = connDone
+		return
+	}
+	if !c.handshakeDone && !now.Before(c.handshakeDeadline) {
+		c.setCloseErr(errHandshakeTimeout)
+		c.state = connDone
+		return
+	}
+	if !c.keepAliveDeadline.IsZero() && !now.Before(c.keepAliveDeadline) {
+		c.needPing = true
+		c.keepAliveDeadline = time.Time{}
+	}
+	if t, space := c.lossDetectionDeadline(); !t.IsZero() && !now.Before(t) {
+		c.onLossDetectionTimeout(now, space)
+	}
+}
+
+var errHandshakeTimeout = handshakeTimeoutError{}
+
+type handshakeTimeoutError struct{}
+
+func (handshakeTimeoutError) Error() string   { return "quic: handshake timed out" }
+func (handshakeTimeoutError) Timeout() bool   { return true }
+func (handshakeTimeoutError) Temporary() bool { return false }
+
+// resetIdleTimer restarts the idle timer. See RFC 9000, Section 10.1.
+func (c *Conn) resetIdleTimer(now time.Time) {
+	if c.idleTimeout <= 0 {
+		c.idleDeadline = time.Time{}
+	} else {
+		// The idle timeout is at least three times the current PTO, so
+		// that a few lost packets do not close the connection.
+		d := c.idleTimeout
+		if pto := 3 * c.rtt.pto(maxAckDelay); d < pto {
+			d = pto
+		}
+		c.idleDeadline = now.Add(d)
+	}
+	if c.config.KeepAlivePeriod > 0 && c.handshakeDone {
+		c.keepAliveDeadline = now.Add(c.config.KeepAlivePeriod)
+	}
+}
+
+// handleTLSEvents processes events produced by the TLS handshake.
+func (c *Conn) handleTLSEvents(now time.Time) error {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret:
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				c.handshakeKeys.setRead(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelApplication:
+				c.appKeys.setRead(e.Suite, e.Data)
+			}
+		case tls.QUICSetWriteSecret:
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				c.handshakeKeys.setWrite(e.Suite, e.Data)
+			case tls.QUICEncryptionLevelApplication:
+				c.appKeys.setWrite(e.Suite, e.Data)
+			}
+		case tls.QUICWriteData:
+			space := spaceForLevel(e.Level)
+			c.spaces[space].cryptoSend.write(e.Data)
+		case tls.QUICTransportParameters:
+			if err := c.receiveTransportParameters(e.Data); err != nil {
+				return err
+			}
+		case tls.QUICTransportParametersRequired:
+			c.tls.SetTransportParameters(c.localTransportParameters())
+		case tls.QUICHandshakeDone:
+			c.onHandshakeDone(now)
+		}
+	}
+}
+
+func spaceForLevel(level tls.QUICEncryptionLevel) numberSpace {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return initialSpace
+	case tls.QUICEncryptionLevelHandshake:
+		return handshakeSpace
+	}
+	return appDataSpace
+}
+
+func levelForSpace(space numberSpace) tls.QUICEncryptionLevel {
+	switch space {
+	case initialSpace:
+		return tls.QUICEncryptionLevelInitial
+	case handshakeSpace:
+		return tls.QUICEncryptionLevelHandshake
+	}
+	return tls.QUICEncryptionLevelApplication
+}
+
+// tlsError converts an error from crypto/tls into a transport error
+// carrying the TLS alert. See RFC 9001, Section 4.8.
+func tlsError(err error) error {
+	code := errTLSBase + 80 // internal_error
+	var ae tls.AlertError
+	if errors.As(err, &ae) {
+		code = errTLSBase + TransportError(ae)
+	}
+	return localTransportError{code: code, reason: err.Error()}
+}
+
+func (c *Conn) receiveTransportParameters(b []byte) error {
+	p, err := unmarshalTransportParameters(b, c.side == clientSide)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(p.initialSrcConnID, c.peerConnID) {
+		return localTransportError{code: errTransportParameter, reason: "initial_source_connection_id does not match"}
+	}
+	if c.side == clientSide && !bytes.Equal(p.originalDstConnID, c.origDstConnID) {
+		return localTransportError{code: errTransportParameter, reason: "original_destination_connection_id does not match"}
+	}
+	if p.retrySrcConnID != nil {
+		return localTransportError{code: errTransportParameter, reason: "unexpected retry_source_connection_id"}
+	}
+	c.peerParams = p
+	c.gotPeerParams = true
+	c.connSendMax = p.initialMaxData
+	c.localStreamLimit[bidiStream] = p.initialMaxStreamsBidi
+	c.localStreamLimit[uniStream] = p.initialMaxStreamsUni
+	if p.maxIdleTimeout > 0 && (c.idleTimeout <= 0 || p.maxIdleTimeout < c.idleTimeout) {
+		c.idleTimeout = p.maxIdleTimeout
+	}
+	notify(c.streamLimitNotify[bidiStream])
+	notify(c.streamLimitNotify[uniStream])
+	return nil
+}
+
+func (c *Conn) onHandshakeDone(now time.Time) {
+	if c.handshakeDone {
+		return
+	}
+	c.handshakeDone = true
+	if c.side == serverSide {
+		// The server's handshake is confirmed as soon as it completes.
+		// See RFC 9001, Section 4.1.2.
+		c.needHandshakeDone = true
+		c.confirmHandshake()
+		c.endpoint.queueAccept(c)
+	}
+	c.resetIdleTimer(now)
+	c.closeHandshakeDonec()
+}
+
+func (c *Conn) closeHandshakeDonec() {
+	select {
+	case <-c.handshakeDonec:
+	default:
+		close(c.handshakeDonec)
+	}
+}
+
+func (c *Conn) confirmHandshake() {
+	if c.handshakeConfirmed {
+		return
+	}
+	c.handshakeConfirmed = true
+	c.discardSpace(initialSpace)
+	c.discardSpace(handshakeSpace)
+}
+
+// discardSpace discards the keys and state of a packet number space.
+// See RFC 9001, Section 4.9.
+func (c *Conn) discardSpace(space numberSpace) {
+	s := &c.spaces[space]
+	if s.discarded {
+		return
+	}
+	s.discarded = true
+	for _, p := range s.sent {
+		if p.inFlight {
+			c.cc.onDiscarded(p)
+		}
+	}
+	s.sent = nil
+	s.lossTime = time.Time{}
+	s.ackPending = false
+	s.ackDeadline = time.Time{}
+	s.cryptoSend = sendBuffer{}
+	s.cryptoRecv = recvBuffer{}
+	switch space {
+	case initialSpace:
+		c.initialKeys.discard()
+	case handshakeSpace:
+		c.handshakeKeys.discard()
+	}
+	c.ptoCount = 0
+	c.probe[space] = 0
+}
+
+// abort closes the connection with an error detected locally, sending
+// a CONNECTION_CLOSE frame to the peer.
+func (c *Conn) abort(now time.Time, err error) {
+	if c.state != connOpen {
+		return
+	}
+	c.closeLocal = err
+	c.setCloseErr(err)
+	c.state = connClosing
+	c.closeSendPending = true
+	c.closeDeadline = now.Add(3 * c.rtt.pto(maxAckDelay))
+	c.wake()
+}
+
+// enterDraining handles a CONNECTION_CLOSE frame from the peer.
+func (c *Conn) enterDraining(now time.Time, err error) {
+	switch c.state {
+	case connOpen:
+		c.setCloseErr(err)
+		c.closeDeadline = now.Add(3 * c.rtt.pto(maxAckDelay))
+	case connClosing:
+	default:
+		return
+	}
+	c.state = connDraining
+	c.closeSendPending = false
+}
+
+// setCloseErr records the error returned by operations on the closed
+// connection, and wakes any goroutines waiting for the connection.
+func (c *Conn) setCloseErr(err error) {
+	if c.closeErr != nil {
+		return
+	}
+	c.closeErr = err
+	close(c.closedc)
+	c.closeHandshakeDonec()
+	for _, s := range c.streams {
+		notify(s.readNotify)
+		notify(s.writeNotify)
+	}
+	for _, s := range c.acceptQueue {
+		notify(s.readNotify)
+		notify(s.writeNotify)
+	}
+	notify(c.acceptNotify)
+	notify(c.streamLimitNotify[bidiStream])
+	notify(c.streamLimitNotify[uniStream])
+}
+
+// Abort closes the connection, sending the peer a CONNECTION_CLOSE frame.
+// If err is an *ApplicationError, its code and reason are sent. Otherwise
+// the application error code 0 is sent, with no reason.
+// Abort does not wait for the peer to acknowledge the close.
+func (c *Conn) Abort(err error) {
+	if err == nil {
+		err = &ApplicationError{}
+	}
+	var ae *ApplicationError
+	if !errors.As(err, &ae) {
+		err = &ApplicationError{Reason: err.Error()}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.abort(time.Now(), err)
+}
+
+// Close closes the connection with application error code 0.
+// It does not wait for the peer to acknowledge the close.
+func (c *Conn) Close() error {
+	c.Abort(nil)
+	return nil
+}
+
+// Wait waits until the connection is closed, by either peer, and returns
+// the reason it was closed.
+func (c *Conn) Wait(ctx context.Context) error {
+	select {
+	case <-c.closedc:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// waitHandshake waits for the handshake to complete.
+func (c *Conn) waitHandshake(ctx context.Context) error {
+	select {
+	case <-c.handshakeDonec:
+	case <-ctx.Done():
+		c.Abort(nil)
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handshakeDone && c.closeErr == nil {
+		return nil
+	}
+	return c.closeErr
+}
+
+// NewStream opens a new bidirectional stream, waiting if the peer's
+// stream limit has been reached.
+func (c *Conn) NewStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, bidiStream)
+}
+
+// NewSendOnlyStream opens a new unidirectional stream, waiting if the
+// peer's stream limit has been reached.
+func (c *Conn) NewSendOnlyStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, uniStream)
+}
+
+func (c *Conn) newLocalStream(ctx context.Context, typ streamType) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closeErr != nil {
+			notify(c.streamLimitNotify[typ])
+			return nil, c.closeErr
+		}
+		if num := c.nextLocalStreamNum[typ]; num < c.localStreamLimit[typ] {
+			c.nextLocalStreamNum[typ]++
+			if c.nextLocalStreamNum[typ] < c.localStreamLimit[typ] {
+				// Pass the wakeup on to any other waiter.
+				notify(c.streamLimitNotify[typ])
+			}
+			s := newStream(c, newStreamID(c.side, typ, num))
+			c.streams[s.id] = s
+			return s, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.streamLimitNotify[typ]:
+		case <-ctx.Done():
+			c.mu.Lock()
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+}
+
+// AcceptStream waits for and returns the next stream opened by the peer.
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if len(c.acceptQueue) > 0 {
+			s := c.acceptQueue[0]
+			c.acceptQueue[0] = nil
+			c.acceptQueue = c.acceptQueue[1:]
+			if len(c.acceptQueue) > 0 {
+				notify(c.acceptNotify)
+			}
+			return s, nil
+		}
+		if c.closeErr != nil {
+			notify(c.acceptNotify)
+			return nil, c.closeErr
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.acceptNotify:
+		case <-ctx.Done():
+			c.mu.Lock()
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+}
+
+// streamForFrame returns the stream a received frame refers to, opening
+// streams initiated by the peer as needed. It returns nil if the stream
+// has already been closed.
+func (c *Conn) streamForFrame(id streamID) (*Stream, error) {
+	typ, num := id.streamType(), id.num()
+	if id.initiator() == c.side {
+		if num >= c.nextLocalStreamNum[typ] {
+			return nil, localTransportError{code: errStreamState, reason: "frame for unopened stream"}
+		}
+		return c.streams[id], nil
+	}
+	if num >= c.remoteStreamLimit[typ] {
+		return nil, localTransportError{code: errStreamLimit, reason: "stream limit exceeded"}
+	}
+	for c.remoteStreamsOpened[typ] <= num {
+		s := newStream(c, newStreamID(c.side.peer(), typ, c.remoteStreamsOpened[typ]))
+		c.remoteStreamsOpened[typ]++
+		c.streams[s.id] = s
+		c.acceptQueue = append(c.acceptQueue, s)
+		notify(c.acceptNotify)
+	}
+	return c.streams[id], nil
+}
+
+// queueStream schedules s to have frames sent.
+func (c *Conn) queueStream(s *Stream) {
+	if !s.inSendQueue && !s.removed {
+		s.inSendQueue = true
+		c.sendQueue = append(c.sendQueue, s)
+	}
+	c.wake()
+}
+
+// streamDataConsumed records that n bytes of s have been read or
+// discarded, extending flow control limits as needed.
+func (c *Conn) streamDataConsumed(s *Stream, n int) {
+	c.connConsumed += int64(n)
+	if window := c.config.maxConnReadBufferSize(); c.connRecvMax-c.connConsumed < window/2 {
+		c.connRecvMax = c.connConsumed + window
+		c.needMaxData = true
+		c.wake()
+	}
+	if s.readClosed || s.finalSize >= 0 {
+		return
+	}
+	if window := c.config.maxStreamReadBufferSize(); s.recvMax-s.recv.off < window/2 {
+		s.recvMax = s.recv.off + window
+		s.needMaxData = true
+		c.queueStream(s)
+	}
+}
+
+// checkStreamDone removes s from the connection once both of its sides
+// are finished, allowing the peer to open another stream.
+func (c *Conn) checkStreamDone(s *Stream) {
+	if s.removed || !s.sendDone() || !s.recvDone() {
+		return
+	}
+	s.removed = true
+	delete(c.streams, s.id)
+	if s.id.initiator() == c.side {
+		return
+	}
+	typ := s.id.streamType()
+	c.remoteStreamsDone[typ]++
+	max := c.config.maxBidiRemoteStreams()
+	if typ == uniStream {
+		max = c.config.maxUniRemoteStreams()
+	}
+	if limit := c.remoteStreamsDone[typ] + max; limit > c.remoteStreamLimit[typ] {
+		c.remoteStreamLimit[typ] = limit
+		c.needMaxStreams[typ] = true
+		c.wake()
+	}
+}
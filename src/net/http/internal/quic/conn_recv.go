@@ -0,0 +1,589 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// maxAckRanges limits the number of ranges of received packet numbers we
+// remember, and so the size of the ACK frames we send.
+const maxAckRanges = 32
+
+// handleDatagram processes a datagram received from the peer, which may
+// contain several coalesced packets.
+func (c *Conn) handleDatagram(now time.Time, b []byte) {
+	if c.state == connDone {
+		return
+	}
+	c.bytesRecvd += int64(len(b))
+	for len(b) > 0 && c.state != connDone {
+		n := c.handlePacket(now, b)
+		if n <= 0 {
+			break
+		}
+		b = b[n:]
+	}
+	if c.state == connClosing {
+		// Respond to any packet with another CONNECTION_CLOSE.
+		// See RFC 9000, Section 10.2.1.
+		c.closeSendPending = true
+	}
+}
+
+// handlePacket processes the packet at the start of b and returns its
+// length, or -1 if the rest of the datagram must be discarded.
+func (c *Conn) handlePacket(now time.Time, b []byte) int {
+	if !isLongHeader(b[0]) {
+		return c.handleShortHeaderPacket(now, b)
+	}
+	p, ok := parseLongHeaderPacket(b)
+	if !ok {
+		return -1
+	}
+	switch {
+	case p.ptype == packetTypeVersionNegotiation:
+		c.handleVersionNegotiation(now, p, b)
+		return -1
+	case p.version != quicVersion1:
+		return -1
+	case p.ptype == packetTypeRetry || p.ptype == packetType0RTT:
+		// We send neither Retry packets nor 0-RTT packets,
+		// and we do not accept 0-RTT.
+		return p.size
+	}
+	var space numberSpace
+	var keys *fixedKeys
+	if p.ptype == packetTypeInitial {
+		space, keys = initialSpace, &c.initialKeys
+	} else {
+		space, keys = handshakeSpace, &c.handshakeKeys
+	}
+	if !keys.r.isSet() {
+		return p.size
+	}
+	if !bytes.Equal(p.dstConnID, c.localConnID) &&
+		!(c.side == serverSide && p.ptype == packetTypeInitial && bytes.Equal(p.dstConnID, c.origDstConnID)) {
+		return p.size
+	}
+	pkt := b[:p.size]
+	pnLen, err := keys.r.hdr.unprotect(pkt, p.pnOff)
+	if err != nil {
+		return p.size
+	}
+	s := &c.spaces[space]
+	pnum := decodePacketNumber(s.recvd.max(), readPacketNumber(pkt[p.pnOff:], pnLen), pnLen)
+	payload, err := keys.r.pkt.open(pkt, p.pnOff+pnLen, pnum)
+	if err != nil {
+		return p.size
+	}
+	if pkt[0]&0x0c != 0 {
+		c.abort(now, localTransportError{code: errProtocolViolation, reason: "reserved header bits are not zero"})
+		return -1
+	}
+	if s.recvd.contains(pnum) {
+		return p.size // duplicate
+	}
+	if c.side == clientSide && p.ptype == packetTypeInitial && !c.gotPeerConnID {
+		c.peerConnID = append([]byte(nil), p.srcConnID...)
+		c.gotPeerConnID = true
+	}
+	if c.side == serverSide && p.ptype == packetTypeHandshake {
+		// Receiving a Handshake packet validates the client's address,
+		// and the client will send no more Initial packets.
+		// See RFC 9001, Section 4.9.1.
+		c.addrValidated = true
+		c.discardSpace(initialSpace)
+	}
+	c.handlePayload(now, space, pnum, payload)
+	return p.size
+}
+
+func (c *Conn) handleShortHeaderPacket(now time.Time, b []byte) int {
+	if !c.appKeys.canRead() {
+		return -1
+	}
+	pnOff := 1 + connIDLen
+	if len(b) < pnOff || !bytes.Equal(b[1:pnOff], c.localConnID) {
+		return -1
+	}
+	pnLen, err := c.appKeys.hdrR.unprotect(b, pnOff)
+	if err != nil {
+		return -1
+	}
+	s := &c.spaces[appDataSpace]
+	pnum := decodePacketNumber(s.recvd.max(), readPacketNumber(b[pnOff:], pnLen), pnLen)
+	payload, err := c.appKeys.open(b, pnOff+pnLen, pnum)
+	if err != nil {
+		return -1
+	}
+	if b[0]&0x18 != 0 {
+		c.abort(now, localTransportError{code: errProtocolViolation, reason: "reserved header bits are not zero"})
+		return -1
+	}
+	if s.recvd.contains(pnum) {
+		return len(b)
+	}
+	c.handlePayload(now, appDataSpace, pnum, payload)
+	return len(b)
+}
+
+func (c *Conn) handleVersionNegotiation(now time.Time, p longPacket, b []byte) {
+	if c.side != clientSide || c.gotPeerConnID || !bytes.Equal(p.dstConnID, c.localConnID) {
+		return
+	}
+	// The versions follow the connection IDs.
+	versions := b[5+1+len(p.dstConnID)+1+len(p.srcConnID):]
+	for len(versions) >= 4 {
+		if binary.BigEndian.Uint32(versions) == quicVersion1 {
+			// A Version Negotiation packet must not list the version we
+			// offered. Ignore it. See RFC 9000, Section 6.2.
+			return
+		}
+		versions = versions[4:]
+	}
+	c.setCloseErr(errVersionNegotiation)
+	c.state = connDone
+}
+
+type versionNegotiationError struct{}
+
+func (versionNegotiationError) Error() string {
+	return "quic: server does not support QUIC version 1"
+}
+
+var errVersionNegotiation = versionNegotiationError{}
+
+// handlePayload processes the frames of a decrypted packet.
+func (c *Conn) handlePayload(now time.Time, space numberSpace, pnum int64, payload []byte) {
+	if c.state == connDraining {
+		return
+	}
+	if len(payload) == 0 {
+		c.abort(now, localTransportError{code: errProtocolViolation, reason: "packet with no frames"})
+		return
+	}
+	ackEliciting, err := c.handleFrames(now, space, payload)
+	if err != nil {
+		c.abort(now, err)
+		return
+	}
+	if c.state != connOpen {
+		return
+	}
+	c.lastRecvTime = now
+	c.sentSinceRecv = false
+	c.resetIdleTimer(now)
+
+	s := &c.spaces[space]
+	if s.discarded {
+		// Processing the packet discarded its own space.
+		return
+	}
+	outOfOrder := pnum < s.recvd.max()
+	if pnum > s.recvd.max() {
+		s.largestRecvdTime = now
+	}
+	s.recvd.add(pnum, pnum+1)
+	if len(s.recvd) > maxAckRanges {
+		s.recvd = s.recvd[len(s.recvd)-maxAckRanges:]
+	}
+	s.ackPending = true
+	if !ackEliciting {
+		return
+	}
+	s.ackElicitingUnacked++
+	// Acknowledge Initial and Handshake packets immediately. In the
+	// application data space, acknowledge every second packet, any
+	// reordered packet, and otherwise after max_ack_delay.
+	// See RFC 9000, Section 13.2.
+	if space != appDataSpace || s.ackElicitingUnacked >= 2 || outOfOrder {
+		s.ackDeadline = now
+	} else if s.ackDeadline.IsZero() {
+		s.ackDeadline = now.Add(maxAckDelay)
+	}
+}
+
+var errFrameEncodingError = localTransportError{code: errFrameEncoding, reason: "malformed frame"}
+
+// handleFrames processes the frames in a packet payload. It reports
+// whether the packet was ack-eliciting.
+func (c *Conn) handleFrames(now time.Time, space numberSpace, b []byte) (ackEliciting bool, err error) {
+	for len(b) > 0 {
+		typ, n := consumeVarint(b)
+		if n < 0 {
+			return false, errFrameEncodingError
+		}
+		b = b[n:]
+		if space != appDataSpace {
+			// Only a few frames are permitted in Initial and Handshake
+			// packets. See RFC 9000, Section 12.4.
+			switch typ {
+			case frameTypePadding, frameTypePing, frameTypeAck, frameTypeAckECN,
+				frameTypeCrypto, frameTypeConnectionCloseTransport:
+			default:
+				return false, localTransportError{code: errProtocolViolation, reason: "frame not permitted in packet type"}
+			}
+		}
+		switch typ {
+		case frameTypePadding, frameTypeAck, frameTypeAckECN,
+			frameTypeConnectionCloseTransport, frameTypeConnectionCloseApplication:
+		default:
+			ackEliciting = true
+		}
+		switch {
+		case typ == frameTypePadding, typ == frameTypePing:
+			n = 0
+		case typ == frameTypeAck, typ == frameTypeAckECN:
+			var acked rangeset
+			var delay uint64
+			acked, delay, n = parseAckFrame(b, typ)
+			if n >= 0 {
+				err = c.handleAck(now, space, acked, delay)
+			}
+		case typ == frameTypeResetStream:
+			n, err = c.handleResetStreamFrame(b)
+		case typ == frameTypeStopSending:
+			n, err = c.handleStopSendingFrame(b)
+		case typ == frameTypeCrypto:
+			n, err = c.handleCryptoFrame(now, space, b)
+		case typ == frameTypeNewToken:
+			if c.side == serverSide {
+				return false, localTransportError{code: errProtocolViolation, reason: "client sent NEW_TOKEN"}
+			}
+			_, n = consumeVarintBytes(b)
+		case typ >= frameTypeStreamBase && typ < frameTypeStreamBase+8:
+			n, err = c.handleStreamFrame(b, typ)
+		case typ == frameTypeMaxData:
+			var v int64
+			v, n = consumeVarintInt64(b)
+			if n >= 0 && v > c.connSendMax {
+				c.connSendMax = v
+			}
+		case typ == frameTypeMaxStreamData:
+			n, err = c.handleMaxStreamDataFrame(b)
+		case typ == frameTypeMaxStreamsBidi, typ == frameTypeMaxStreamsUni:
+			var v int64
+			v, n = consumeVarintInt64(b)
+			if n >= 0 {
+				if v > maxStreamsLimit {
+					return false, errFrameEncodingError
+				}
+				styp := bidiStream
+				if typ == frameTypeMaxStreamsUni {
+					styp = uniStream
+				}
+				if v > c.localStreamLimit[styp] {
+					c.localStreamLimit[styp] = v
+					notify(c.streamLimitNotify[styp])
+				}
+			}
+		case typ == frameTypeDataBlocked, typ == frameTypeStreamsBlockedBidi,
+			typ == frameTypeStreamsBlockedUni, typ == frameTypeRetireConnectionID:
+			_, n = consumeVarint(b)
+		case typ == frameTypeStreamDataBlocked:
+			n = skipVarints(b, 2)
+		case typ == frameTypeNewConnectionID:
+			// We use a single connection ID for the peer, so alternatives
+			// are not needed.
+			n = skipVarints(b, 2)
+			if n >= 0 {
+				cid, m := consumeUint8Bytes(b[n:])
+				if m < 0 || len(cid) == 0 || len(cid) > maxConnIDLen || len(b) < n+m+16 {
+					return false, errFrameEncodingError
+				}
+				n += m + 16
+			}
+		case typ == frameTypePathChallenge:
+			if len(b) < 8 {
+				return false, errFrameEncodingError
+			}
+			var data [8]byte
+			copy(data[:], b)
+			c.pathResponses = append(c.pathResponses, data)
+			n = 8
+		case typ == frameTypePathResponse:
+			if len(b) < 8 {
+				return false, errFrameEncodingError
+			}
+			n = 8
+		case typ == frameTypeConnectionCloseTransport:
+			n, err = c.handleConnectionCloseTransportFrame(now, b)
+		case typ == frameTypeConnectionCloseApplication:
+			n, err = c.handleConnectionCloseApplicationFrame(now, b)
+		case typ == frameTypeHandshakeDone:
+			if c.side == serverSide {
+				return false, localTransportError{code: errProtocolViolation, reason: "client sent HANDSHAKE_DONE"}
+			}
+			c.confirmHandshake()
+			n = 0
+		default:
+			return false, errFrameEncodingError
+		}
+		if err != nil {
+			return false, err
+		}
+		if n < 0 {
+			return false, errFrameEncodingError
+		}
+		b = b[n:]
+		if c.state != connOpen {
+			break
+		}
+	}
+	return ackEliciting, nil
+}
+
+// skipVarints returns the length of count varints at the start of b.
+func skipVarints(b []byte, count int) int {
+	off := 0
+	for i := 0; i < count; i++ {
+		_, n := consumeVarint(b[off:])
+		if n < 0 {
+			return -1
+		}
+		off += n
+	}
+	return off
+}
+
+func (c *Conn) handleCryptoFrame(now time.Time, space numberSpace, b []byte) (int, error) {
+	off, n := consumeVarintInt64(b)
+	if n < 0 {
+		return -1, nil
+	}
+	data, m := consumeVarintBytes(b[n:])
+	if m < 0 {
+		return -1, nil
+	}
+	s := &c.spaces[space]
+	// Limit the amount of out-of-order handshake data we buffer.
+	// See RFC 9000, Section 7.5.
+	const maxCryptoBuffer = 64 << 10
+	if off+int64(len(data))-s.cryptoRecv.off > maxCryptoBuffer {
+		return -1, localTransportError{code: errCryptoBufferExceeded, reason: "too much buffered CRYPTO data"}
+	}
+	s.cryptoRecv.write(off, data)
+	if data := s.cryptoRecv.readable(); len(data) > 0 {
+		s.cryptoRecv.consume(len(data))
+		if err := c.tls.HandleData(levelForSpace(space), data); err != nil {
+			return -1, tlsError(err)
+		}
+		if err := c.handleTLSEvents(now); err != nil {
+			return -1, err
+		}
+	}
+	return n + m, nil
+}
+
+func (c *Conn) handleStreamFrame(b []byte, typ uint64) (int, error) {
+	idv, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	off := n
+	var dataOff int64
+	if typ&streamOffBit != 0 {
+		v, n := consumeVarintInt64(b[off:])
+		if n < 0 {
+			return -1, nil
+		}
+		dataOff = v
+		off += n
+	}
+	var data []byte
+	if typ&streamLenBit != 0 {
+		var n int
+		data, n = consumeVarintBytes(b[off:])
+		if n < 0 {
+			return -1, nil
+		}
+		off += n
+	} else {
+		data = b[off:]
+		off = len(b)
+	}
+	fin := typ&streamFinBit != 0
+	end := dataOff + int64(len(data))
+	if end > maxVarint {
+		return -1, localTransportError{code: errFrameEncoding, reason: "stream data exceeds maximum offset"}
+	}
+
+	id := streamID(idv)
+	s, err := c.streamForFrame(id)
+	if err != nil || s == nil {
+		return off, err
+	}
+	if !s.hasRecv {
+		return -1, localTransportError{code: errStreamState, reason: "STREAM frame for send-only stream"}
+	}
+	if s.finalSize >= 0 && (end > s.finalSize || fin && end != s.finalSize) {
+		return -1, localTransportError{code: errFinalSize, reason: "data beyond final size"}
+	}
+	if fin {
+		if s.recvHighest > end {
+			return -1, localTransportError{code: errFinalSize, reason: "final size below received data"}
+		}
+		s.finalSize = end
+	}
+	if end > s.recvMax {
+		return -1, localTransportError{code: errFlowControl, reason: "stream flow control limit exceeded"}
+	}
+	if end > s.recvHighest {
+		c.connRecvd += end - s.recvHighest
+		s.recvHighest = end
+		if c.connRecvd > c.connRecvMax {
+			return -1, localTransportError{code: errFlowControl, reason: "connection flow control limit exceeded"}
+		}
+	}
+	if s.readClosed || s.resetCode >= 0 {
+		// The data is discarded, but still counts against flow control.
+		if n := s.recvHighest - s.recv.end(); n > 0 {
+			s.recv.off = s.recvHighest
+			c.connConsumed += n
+		}
+		return off, nil
+	}
+	s.recv.write(dataOff, data)
+	notify(s.readNotify)
+	return off, nil
+}
+
+func (c *Conn) handleResetStreamFrame(b []byte) (int, error) {
+	idv, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	off := n
+	code, n := consumeVarint(b[off:])
+	if n < 0 {
+		return -1, nil
+	}
+	off += n
+	finalSize, n := consumeVarintInt64(b[off:])
+	if n < 0 {
+		return -1, nil
+	}
+	off += n
+	s, err := c.streamForFrame(streamID(idv))
+	if err != nil || s == nil {
+		return off, err
+	}
+	if !s.hasRecv {
+		return -1, localTransportError{code: errStreamState, reason: "RESET_STREAM for send-only stream"}
+	}
+	if s.finalSize >= 0 && finalSize != s.finalSize || finalSize < s.recvHighest {
+		return -1, localTransportError{code: errFinalSize, reason: "RESET_STREAM final size mismatch"}
+	}
+	if finalSize > s.recvMax {
+		return -1, localTransportError{code: errFlowControl, reason: "stream flow control limit exceeded"}
+	}
+	c.connRecvd += finalSize - s.recvHighest
+	s.recvHighest = finalSize
+	if c.connRecvd > c.connRecvMax {
+		return -1, localTransportError{code: errFlowControl, reason: "connection flow control limit exceeded"}
+	}
+	s.finalSize = finalSize
+	if s.resetCode >= 0 || (s.readClosed && s.allRead()) {
+		return off, nil
+	}
+	s.resetCode = int64(code)
+	s.needMaxData = false
+	// All data up to the final size now counts as consumed.
+	n = int(finalSize - s.recv.off)
+	s.recv.discard()
+	s.recv.off = finalSize
+	c.connConsumed += int64(n)
+	if s.stopSending >= 0 && !s.stopSendingSent {
+		s.stopSending = -1 // no longer needed
+	}
+	notify(s.readNotify)
+	c.checkStreamDone(s)
+	return off, nil
+}
+
+func (c *Conn) handleStopSendingFrame(b []byte) (int, error) {
+	idv, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	code, m := consumeVarint(b[n:])
+	if m < 0 {
+		return -1, nil
+	}
+	s, err := c.streamForFrame(streamID(idv))
+	if err != nil || s == nil {
+		return n + m, err
+	}
+	if !s.hasSend {
+		return -1, localTransportError{code: errStreamState, reason: "STOP_SENDING for receive-only stream"}
+	}
+	if s.stopRecvd < 0 {
+		s.stopRecvd = int64(code)
+	}
+	// Respond with RESET_STREAM. See RFC 9000, Section 3.5.
+	s.resetLocked(code)
+	return n + m, nil
+}
+
+func (c *Conn) handleMaxStreamDataFrame(b []byte) (int, error) {
+	idv, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	max, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1, nil
+	}
+	s, err := c.streamForFrame(streamID(idv))
+	if err != nil || s == nil {
+		return n + m, err
+	}
+	if !s.hasSend {
+		return -1, localTransportError{code: errStreamState, reason: "MAX_STREAM_DATA for receive-only stream"}
+	}
+	if max > s.sendMax {
+		s.sendMax = max
+		if s.send.next < s.send.end() {
+			c.queueStream(s)
+		}
+	}
+	return n + m, nil
+}
+
+func (c *Conn) handleConnectionCloseTransportFrame(now time.Time, b []byte) (int, error) {
+	code, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	off := n
+	_, n = consumeVarint(b[off:]) // frame type
+	if n < 0 {
+		return -1, nil
+	}
+	off += n
+	reason, n := consumeVarintBytes(b[off:])
+	if n < 0 {
+		return -1, nil
+	}
+	off += n
+	c.enterDraining(now, &PeerTransportError{Code: TransportError(code), Reason: string(reason)})
+	return off, nil
+}
+
+func (c *Conn) handleConnectionCloseApplicationFrame(now time.Time, b []byte) (int, error) {
+	code, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	reason, m := consumeVarintBytes(b[n:])
+	if m < 0 {
+		return -1, nil
+	}
+	c.enterDraining(now, &ApplicationError{Code: code, Reason: string(reason)})
+	return n + m, nil
+}
@@ -0,0 +1,396 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"errors"
+	"time"
+)
+
+// An outPacket is a packet being assembled, before protection.
+type outPacket struct {
+	space        numberSpace
+	num          int64
+	pnLen        int
+	payload      []byte
+	frames       []sentFrame
+	ackEliciting bool
+}
+
+// send sends as many datagrams as are needed to carry pending frames,
+// subject to congestion control and the anti-amplification limit.
+func (c *Conn) send(now time.Time) {
+	for {
+		if c.state == connDraining || c.state == connDone {
+			return
+		}
+		if c.state == connClosing && !c.closeSendPending {
+			return
+		}
+		dgram := c.appendDatagram(now)
+		if dgram == nil {
+			return
+		}
+		c.bytesSent += int64(len(dgram))
+		c.lastSendTime = now
+		c.endpoint.writeTo(dgram, c.peerAddr)
+		if c.state == connClosing {
+			c.closeSendPending = false
+			if c.endpoint.isClosing() {
+				// The endpoint is shutting down and will not wait for
+				// the draining period.
+				c.state = connDone
+			}
+			return
+		}
+	}
+}
+
+// packetOverhead returns the size of the header and AEAD tag of a packet.
+func (c *Conn) packetOverhead(space numberSpace, pnLen int) int {
+	if space == appDataSpace {
+		return 1 + len(c.peerConnID) + pnLen + aeadTagSize
+	}
+	n := 1 + 4 + 1 + len(c.peerConnID) + 1 + len(c.localConnID) + 2 + pnLen + aeadTagSize
+	if space == initialSpace {
+		n++ // empty token
+	}
+	return n
+}
+
+func (c *Conn) canWriteSpace(space numberSpace) bool {
+	if c.spaces[space].discarded {
+		return false
+	}
+	switch space {
+	case initialSpace:
+		return c.initialKeys.w.isSet()
+	case handshakeSpace:
+		return c.handshakeKeys.w.isSet()
+	}
+	return c.appKeys.canWrite()
+}
+
+// appendDatagram assembles a datagram of coalesced packets, returning nil
+// if there is nothing to send.
+func (c *Conn) appendDatagram(now time.Time) []byte {
+	limit := maxDatagramSize
+	if !c.addrValidated {
+		// Send at most three times the data received from an
+		// unvalidated address. See RFC 9000, Section 8.1.
+		if n := 3*c.bytesRecvd - c.bytesSent; n < int64(limit) {
+			limit = int(n)
+		}
+	}
+	var pkts []*outPacket
+	size := 0
+	for space := initialSpace; space < numberSpaceCount; space++ {
+		if !c.canWriteSpace(space) {
+			continue
+		}
+		p := c.buildPacket(now, space, limit-size)
+		if p == nil {
+			continue
+		}
+		pkts = append(pkts, p)
+		size += c.packetOverhead(space, p.pnLen) + len(p.payload)
+	}
+	if len(pkts) == 0 {
+		return nil
+	}
+
+	// Datagrams containing ack-eliciting Initial packets are padded to
+	// the minimum size. See RFC 9000, Section 14.1.
+	if pkts[0].space == initialSpace && (c.side == clientSide || pkts[0].ackEliciting) && size < minInitialDatagramSize {
+		pad := minInitialDatagramSize - size
+		if pad > limit-size {
+			pad = limit - size
+		}
+		last := pkts[len(pkts)-1]
+		last.payload = append(last.payload, make([]byte, pad)...)
+		size += pad
+	}
+
+	b := make([]byte, 0, size)
+	for _, p := range pkts {
+		// Header protection samples 16 bytes starting 4 bytes after the
+		// packet number. See RFC 9001, Section 5.4.2.
+		if n := maxPacketNumLen - p.pnLen - len(p.payload); n > 0 {
+			p.payload = append(p.payload, make([]byte, n)...)
+		}
+		b = c.appendPacket(b, p)
+		s := &c.spaces[p.space]
+		s.nextNum++
+		sp := &sentPacket{
+			num:          p.num,
+			time:         now,
+			size:         c.packetOverhead(p.space, p.pnLen) + len(p.payload),
+			ackEliciting: p.ackEliciting,
+			inFlight:     p.ackEliciting,
+			frames:       p.frames,
+		}
+		if sp.ackEliciting {
+			s.lastAckEliciting = now
+			if c.probe[p.space] > 0 {
+				c.probe[p.space]--
+			}
+			if !c.sentSinceRecv {
+				c.sentSinceRecv = true
+				c.resetIdleTimer(now)
+			}
+		}
+		if sp.ackEliciting {
+			c.cc.onSent(sp)
+			s.sent = append(s.sent, sp)
+		}
+		if c.side == clientSide && p.space == handshakeSpace {
+			// The client discards Initial keys when it first sends a
+			// Handshake packet. See RFC 9001, Section 4.9.1.
+			c.discardSpace(initialSpace)
+		}
+	}
+	return b
+}
+
+// appendPacket appends the protected form of p.
+func (c *Conn) appendPacket(b []byte, p *outPacket) []byte {
+	start := len(b)
+	var pnOff int
+	var keys directionalKeys
+	if p.space == appDataSpace {
+		b = append(b, fixedBit|c.appKeys.keyPhaseBit()|byte(p.pnLen-1))
+		b = append(b, c.peerConnID...)
+		keys = directionalKeys{pkt: c.appKeys.curW, hdr: c.appKeys.hdrW}
+	} else {
+		typ := byte(longTypeInitial)
+		keys = c.initialKeys.w
+		if p.space == handshakeSpace {
+			typ = longTypeHS
+			keys = c.handshakeKeys.w
+		}
+		b = append(b, headerFormLong|fixedBit|typ|byte(p.pnLen-1))
+		b = append(b, 0, 0, 0, quicVersion1)
+		b = appendUint8Bytes(b, c.peerConnID)
+		b = appendUint8Bytes(b, c.localConnID)
+		if p.space == initialSpace {
+			b = appendVarint(b, 0) // token length
+		}
+		// The length is always encoded in two bytes, so that it is known
+		// when sizing the packet.
+		length := p.pnLen + len(p.payload) + aeadTagSize
+		b = append(b, 0x40|byte(length>>8), byte(length))
+	}
+	pnOff = len(b) - start
+	b = appendPacketNumber(b, p.num, p.pnLen)
+	b = append(b, p.payload...)
+	pkt := keys.pkt.seal(b[start:], pnOff+p.pnLen, p.num)
+	b = append(b[:start], pkt...)
+	keys.hdr.protect(b[start:], pnOff, p.pnLen)
+	return b
+}
+
+// buildPacket assembles the frames of a packet in the given space, using
+// at most room bytes. It returns nil if there is nothing to send.
+func (c *Conn) buildPacket(now time.Time, space numberSpace, room int) *outPacket {
+	s := &c.spaces[space]
+	p := &outPacket{
+		space: space,
+		num:   s.nextNum,
+		pnLen: packetNumberLength(s.nextNum, s.largestAcked),
+	}
+	max := room - c.packetOverhead(space, p.pnLen)
+	if max < 32 {
+		return nil
+	}
+	if c.state == connClosing {
+		p.payload = c.appendConnectionClose(p.payload, space)
+		return p
+	}
+
+	var ack []byte
+	ackDue := false
+	if s.ackPending {
+		var delay time.Duration
+		if space == appDataSpace {
+			delay = now.Sub(s.largestRecvdTime)
+		}
+		ack = appendAckFrame(nil, s.recvd, delay, maxAckRanges)
+		ackDue = !s.ackDeadline.IsZero() && !now.Before(s.ackDeadline)
+		max -= len(ack)
+	}
+
+	if c.cc.canSend() || c.probe[space] > 0 {
+		c.appendDataFrames(p, space, max)
+		if !p.ackEliciting && (c.probe[space] > 0 || c.needPing && space == appDataSpace) {
+			p.payload = append(p.payload, frameTypePing)
+			p.frames = append(p.frames, sentFrame{kind: sentPing})
+			p.ackEliciting = true
+		}
+		if space == appDataSpace {
+			c.needPing = false
+		}
+	}
+	if ack != nil && (ackDue || len(p.payload) > 0) {
+		p.payload = append(p.payload, ack...)
+		s.ackPending = false
+		s.ackElicitingUnacked = 0
+		s.ackDeadline = time.Time{}
+	}
+	if len(p.payload) == 0 {
+		return nil
+	}
+	return p
+}
+
+// appendDataFrames appends ack-eliciting frames to p, using at most max
+// bytes of payload.
+func (c *Conn) appendDataFrames(p *outPacket, space numberSpace, max int) {
+	s := &c.spaces[space]
+	add := func(f sentFrame) {
+		p.frames = append(p.frames, f)
+		p.ackEliciting = true
+	}
+	if space == appDataSpace && c.needHandshakeDone {
+		p.payload = append(p.payload, frameTypeHandshakeDone)
+		add(sentFrame{kind: sentHandshakeDone})
+		c.needHandshakeDone = false
+	}
+	for s.cryptoSend.hasData() {
+		avail := max - len(p.payload) - cryptoFrameOverhead(s.cryptoSend.end(), max)
+		if avail <= 0 {
+			return
+		}
+		off, data, _ := s.cryptoSend.nextData(avail, s.cryptoSend.end())
+		p.payload = appendCryptoFrame(p.payload, off, data)
+		s.cryptoSend.sent(off, len(data))
+		add(sentFrame{kind: sentCrypto, off: off, size: len(data)})
+	}
+	if space != appDataSpace {
+		return
+	}
+
+	for len(c.pathResponses) > 0 && max-len(p.payload) >= 9 {
+		p.payload = appendPathResponseFrame(p.payload, c.pathResponses[0])
+		c.pathResponses = c.pathResponses[1:]
+		p.ackEliciting = true
+	}
+	if c.needMaxData && max-len(p.payload) >= 9 {
+		p.payload = appendMaxDataFrame(p.payload, c.connRecvMax)
+		add(sentFrame{kind: sentMaxData})
+		c.needMaxData = false
+	}
+	for typ := bidiStream; typ <= uniStream; typ++ {
+		if c.needMaxStreams[typ] && max-len(p.payload) >= 9 {
+			p.payload = appendMaxStreamsFrame(p.payload, typ, c.remoteStreamLimit[typ])
+			add(sentFrame{kind: sentMaxStreams, typ: typ})
+			c.needMaxStreams[typ] = false
+		}
+	}
+
+	// Send stream frames, visiting each queued stream at most once and
+	// moving streams with more to send to the back of the queue.
+	n := len(c.sendQueue)
+	for i := 0; i < n && len(c.sendQueue) > 0; i++ {
+		st := c.sendQueue[0]
+		c.sendQueue = c.sendQueue[1:]
+		full := false
+		if !st.removed {
+			full = c.appendStreamFrames(p, st, max, add)
+		}
+		if !st.removed && st.hasFramesToSend() {
+			c.sendQueue = append(c.sendQueue, st)
+		} else {
+			st.inSendQueue = false
+		}
+		if full {
+			break
+		}
+	}
+}
+
+// appendStreamFrames appends frames for st to p. It reports whether the
+// packet is full.
+func (c *Conn) appendStreamFrames(p *outPacket, st *Stream, max int, add func(sentFrame)) (full bool) {
+	const maxControlFrameSize = 1 + 8 + 8 + 8
+	if max-len(p.payload) < maxControlFrameSize {
+		return true
+	}
+	if st.stopSending >= 0 && !st.stopSendingSent {
+		p.payload = appendStopSendingFrame(p.payload, st.id, uint64(st.stopSending))
+		add(sentFrame{kind: sentStopSending, id: st.id})
+		st.stopSendingSent = true
+		c.checkStreamDone(st)
+	}
+	if st.needMaxData && max-len(p.payload) >= maxControlFrameSize {
+		p.payload = appendMaxStreamDataFrame(p.payload, st.id, st.recvMax)
+		add(sentFrame{kind: sentMaxStreamData, id: st.id})
+		st.needMaxData = false
+		c.checkStreamDone(st)
+	}
+	if st.resetSendCode >= 0 {
+		if !st.resetSent && max-len(p.payload) >= maxControlFrameSize {
+			p.payload = appendResetStreamFrame(p.payload, st.id, uint64(st.resetSendCode), st.sendFinalSize)
+			add(sentFrame{kind: sentResetStream, id: st.id})
+			st.resetSent = true
+		}
+		return false
+	}
+	for {
+		avail := max - len(p.payload) - streamFrameOverhead(st.id, st.send.end(), max)
+		if avail <= 0 {
+			return st.send.hasData() || st.writeClosed && !st.finSent
+		}
+		// New data is limited by both stream and connection flow control.
+		limit := st.sendMax
+		if connLimit := st.send.next + c.connSendMax - c.connSent; connLimit < limit {
+			limit = connLimit
+		}
+		off, data, isNew := st.send.nextData(avail, limit)
+		fin := st.writeClosed && !st.finSent && off+int64(len(data)) == st.sendFinalSize
+		if len(data) == 0 && !fin {
+			return false
+		}
+		p.payload = appendStreamFrame(p.payload, st.id, off, data, fin)
+		st.send.sent(off, len(data))
+		if isNew {
+			c.connSent += int64(len(data))
+		}
+		if fin {
+			st.finSent = true
+		}
+		add(sentFrame{kind: sentStream, id: st.id, off: off, size: len(data), fin: fin})
+		if len(data) == 0 {
+			return false
+		}
+	}
+}
+
+// appendConnectionClose appends a CONNECTION_CLOSE frame for the error
+// the connection is closing with.
+func (c *Conn) appendConnectionClose(b []byte, space numberSpace) []byte {
+	var ae *ApplicationError
+	if errors.As(c.closeLocal, &ae) {
+		if space != appDataSpace {
+			// Application errors are not sent before the handshake
+			// completes. See RFC 9000, Section 10.2.3.
+			return appendConnectionCloseTransportFrame(b, errApplicationError, 0, "")
+		}
+		return appendConnectionCloseApplicationFrame(b, ae.Code, truncateReason(ae.Reason))
+	}
+	code := errInternal
+	reason := ""
+	var le localTransportError
+	if errors.As(c.closeLocal, &le) {
+		code, reason = le.code, le.reason
+	}
+	return appendConnectionCloseTransportFrame(b, code, 0, truncateReason(reason))
+}
+
+func truncateReason(s string) string {
+	if len(s) > maxCloseReasonLen {
+		s = s[:maxCloseReasonLen]
+	}
+	return s
+}
@@ -0,0 +1,347 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/internal"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfigs(t *testing.T) (server, client *Config) {
+	cert, err := tls.X509KeyPair(internal.LocalhostCert, internal.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	server = &Config{
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"test"},
+		},
+	}
+	client = &Config{
+		TLSConfig: &tls.Config{
+			RootCAs:    roots,
+			ServerName: "example.com",
+			NextProtos: []string{"test"},
+		},
+	}
+	return server, client
+}
+
+// A lossyPacketConn drops some of the datagrams it sends.
+type lossyPacketConn struct {
+	net.PacketConn
+
+	mu    sync.Mutex
+	count int
+	drop  func(n int) bool
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	c.count++
+	drop := c.drop(c.count)
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+type testPair struct {
+	server, client *Endpoint
+	sconn, cconn   *Conn
+}
+
+func newTestPair(t *testing.T, wrap func(net.PacketConn) net.PacketConn) *testPair {
+	t.Helper()
+	serverConfig, clientConfig := testConfigs(t)
+	spc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	cpc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		spc, cpc = wrap(spc), wrap(cpc)
+	}
+	p := &testPair{
+		server: NewEndpoint(spc, serverConfig),
+		client: NewEndpoint(cpc, nil),
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		p.client.Close(ctx)
+		p.server.Close(ctx)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	acceptc := make(chan *Conn, 1)
+	go func() {
+		c, err := p.server.Accept(ctx)
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+		}
+		acceptc <- c
+	}()
+	p.cconn, err = p.client.Dial(ctx, "udp", spc.LocalAddr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	p.sconn = <-acceptc
+	if p.sconn == nil {
+		t.FailNow()
+	}
+	return p
+}
+
+func TestConnHandshake(t *testing.T) {
+	p := newTestPair(t, nil)
+	for _, c := range []*Conn{p.cconn, p.sconn} {
+		state := c.ConnectionState()
+		if !state.HandshakeComplete || state.Version != tls.VersionTLS13 {
+			t.Errorf("connection state: complete=%v version=%x", state.HandshakeComplete, state.Version)
+		}
+		if state.NegotiatedProtocol != "test" {
+			t.Errorf("negotiated protocol = %q, want %q", state.NegotiatedProtocol, "test")
+		}
+	}
+}
+
+// echo accepts streams on c and echoes data back until EOF.
+func echo(t *testing.T, c *Conn) {
+	for {
+		s, err := c.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			if _, err := io.Copy(s, s); err != nil {
+				t.Errorf("echo: %v", err)
+			}
+			s.CloseWrite()
+		}()
+	}
+}
+
+func testEcho(t *testing.T, p *testPair, size int) {
+	go echo(t, p.sconn)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	s, err := p.cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReadContext(ctx)
+	s.SetWriteContext(ctx)
+	want := make([]byte, size)
+	for i := range want {
+		want[i] = byte(i * 7)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.Write(want)
+		s.CloseWrite()
+		errc <- err
+	}()
+	got, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatalf("reading echoed data: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("writing data: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echoed %v bytes, want %v bytes equal to those sent", len(got), len(want))
+	}
+}
+
+func TestConnStreamEcho(t *testing.T) {
+	p := newTestPair(t, nil)
+	testEcho(t, p, 3<<20) // larger than the flow control windows
+}
+
+func TestConnLossy(t *testing.T) {
+	p := newTestPair(t, func(pc net.PacketConn) net.PacketConn {
+		return &lossyPacketConn{
+			PacketConn: pc,
+			// Drop the first datagram, forcing a handshake retransmission,
+			// and then every tenth.
+			drop: func(n int) bool { return n == 1 || n%10 == 0 },
+		}
+	})
+	testEcho(t, p, 128<<10)
+}
+
+func TestConnManyStreams(t *testing.T) {
+	p := newTestPair(t, nil)
+	go echo(t, p.sconn)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	// More streams than the default limit of 100, so stream credit
+	// must be returned as streams finish.
+	var wg sync.WaitGroup
+	for i := 0; i < 250; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := p.cconn.NewStream(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.SetReadContext(ctx)
+			msg := []byte{byte(i)}
+			s.Write(msg)
+			s.CloseWrite()
+			got, err := ioutil.ReadAll(s)
+			if err != nil || !bytes.Equal(got, msg) {
+				t.Errorf("stream %v: got %v, %v; want %v", i, got, err, msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConnUniStream(t *testing.T) {
+	p := newTestPair(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := p.cconn.NewSendOnlyStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsWriteOnly() {
+		t.Errorf("locally opened unidirectional stream is not write-only")
+	}
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read on write-only stream succeeded")
+	}
+	s.Write([]byte("hello"))
+	s.CloseWrite()
+	rs, err := p.sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rs.IsReadOnly() {
+		t.Errorf("peer's unidirectional stream is not read-only")
+	}
+	rs.SetReadContext(ctx)
+	got, err := ioutil.ReadAll(rs)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("read %q, %v; want %q", got, err, "hello")
+	}
+}
+
+func TestStreamReset(t *testing.T) {
+	p := newTestPair(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := p.cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("x"))
+	rs, err := p.sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.SetReadContext(ctx)
+	if _, err := rs.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	s.Reset(42)
+	if _, err := rs.Read(make([]byte, 1)); err != StreamErrorCode(42) {
+		t.Errorf("Read after reset: %v, want %v", err, StreamErrorCode(42))
+	}
+
+	// STOP_SENDING causes writes to fail with the peer's code.
+	rs.CloseRead(7)
+	rs.SetWriteContext(ctx)
+	s.SetReadContext(ctx)
+	s2, err := p.cconn.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.Write([]byte("y"))
+	rs2, err := p.sconn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs2.CloseRead(7)
+	s2.SetWriteContext(ctx)
+	for {
+		_, err := s2.Write(make([]byte, 1024))
+		if err == StreamErrorCode(7) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Write after STOP_SENDING: %v, want %v", err, StreamErrorCode(7))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	p := newTestPair(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p.cconn.Abort(&ApplicationError{Code: 0x10c, Reason: "done"})
+	err := p.sconn.Wait(ctx)
+	var ae *ApplicationError
+	if !errors.As(err, &ae) || ae.Code != 0x10c || ae.Reason != "done" {
+		t.Fatalf("peer Wait returned %v, want application error 0x10c", err)
+	}
+	if _, err := p.sconn.AcceptStream(ctx); err == nil {
+		t.Errorf("AcceptStream on closed connection succeeded")
+	}
+	if _, err := p.cconn.NewStream(ctx); err == nil {
+		t.Errorf("NewStream on closed connection succeeded")
+	}
+}
+
+func TestConnIdleTimeout(t *testing.T) {
+	var blackhole int32
+	p := newTestPair(t, func(pc net.PacketConn) net.PacketConn {
+		return &lossyPacketConn{
+			PacketConn: pc,
+			drop:       func(int) bool { return atomic.LoadInt32(&blackhole) != 0 },
+		}
+	})
+	// Drop everything once the handshake is done.
+	atomic.StoreInt32(&blackhole, 1)
+	p.cconn.mu.Lock()
+	p.cconn.idleTimeout = 100 * time.Millisecond
+	p.cconn.resetIdleTimer(time.Now())
+	p.cconn.mu.Unlock()
+	p.cconn.wake()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := p.cconn.Wait(ctx)
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Wait returned %v, want a timeout error", err)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// An Endpoint handles QUIC traffic on a network address.
+// It can accept inbound connections or create outbound ones.
+//
+// Multiple goroutines may invoke methods on an Endpoint simultaneously.
+type Endpoint struct {
+	pc     net.PacketConn
+	config *Config // for accepting connections; nil if not listening
+
+	readDonec chan struct{}
+	acceptc   chan struct{}
+
+	mu          sync.Mutex
+	conns       map[string]*Conn // by connection ID
+	acceptQueue []*Conn
+	closing     bool
+	readErr     error
+}
+
+// maxAcceptQueue limits the number of connections waiting to be accepted.
+const maxAcceptQueue = 128
+
+// Listen listens on a local network address. The network must be "udp",
+// "udp4" or "udp6". If config is non-nil, the endpoint accepts inbound
+// connections; otherwise it may only be used to Dial.
+func Listen(network, address string, config *Config) (*Endpoint, error) {
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEndpoint(pc, config), nil
+}
+
+// NewEndpoint returns an endpoint using pc. The endpoint takes ownership
+// of pc and closes it when the endpoint is closed. If config is non-nil,
+// the endpoint accepts inbound connections.
+func NewEndpoint(pc net.PacketConn, config *Config) *Endpoint {
+	e := &Endpoint{
+		pc:        pc,
+		config:    config,
+		readDonec: make(chan struct{}),
+		acceptc:   make(chan struct{}, 1),
+		conns:     make(map[string]*Conn),
+	}
+	go e.readLoop()
+	return e
+}
+
+// LocalAddr returns the local network address.
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.pc.LocalAddr()
+}
+
+// Accept waits for and returns the next connection to the endpoint.
+// The returned connection has completed its handshake.
+func (e *Endpoint) Accept(ctx context.Context) (*Conn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for {
+		if len(e.acceptQueue) > 0 {
+			c := e.acceptQueue[0]
+			e.acceptQueue[0] = nil
+			e.acceptQueue = e.acceptQueue[1:]
+			if len(e.acceptQueue) > 0 {
+				notify(e.acceptc)
+			}
+			return c, nil
+		}
+		if e.closing || e.readErr != nil {
+			// Pass the wakeup on to any other goroutine in Accept.
+			notify(e.acceptc)
+			if e.readErr != nil {
+				return nil, e.readErr
+			}
+			return nil, errEndpointClosed
+		}
+		e.mu.Unlock()
+		select {
+		case <-e.acceptc:
+		case <-ctx.Done():
+			e.mu.Lock()
+			return nil, ctx.Err()
+		}
+		e.mu.Lock()
+	}
+}
+
+// Dial creates and returns a connection to a network address, waiting for
+// the handshake to complete. If config.TLSConfig has no ServerName, the
+// host in address is used.
+func (e *Endpoint) Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.TLSConfig == nil {
+		return nil, errors.New("quic: Dial requires a TLS configuration")
+	}
+	if config.TLSConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		c := *config
+		c.TLSConfig = config.TLSConfig.Clone()
+		c.TLSConfig.ServerName = host
+		config = &c
+	}
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return nil, errEndpointClosed
+	}
+	e.mu.Unlock()
+	c, err := newConn(time.Now(), clientSide, e, config, addr, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.conns[string(c.localConnID)] = c
+	e.mu.Unlock()
+	go c.loop()
+	if err := c.waitHandshake(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the endpoint, closing all of its connections with
+// application error code 0. It waits for the connections to send their
+// final packets, or for ctx to be done, and then closes the underlying
+// network connection.
+func (e *Endpoint) Close(ctx context.Context) error {
+	e.mu.Lock()
+	e.closing = true
+	var conns []*Conn
+	seen := make(map[*Conn]bool)
+	for _, c := range e.conns {
+		if !seen[c] {
+			seen[c] = true
+			conns = append(conns, c)
+		}
+	}
+	e.mu.Unlock()
+	notify(e.acceptc)
+	for _, c := range conns {
+		c.Abort(nil)
+	}
+	for _, c := range conns {
+		select {
+		case <-c.donec:
+		case <-ctx.Done():
+		}
+	}
+	err := e.pc.Close()
+	<-e.readDonec
+	return err
+}
+
+func (e *Endpoint) isClosing() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closing
+}
+
+// writeTo sends a datagram. Errors are ignored: loss recovery handles
+// datagrams which could not be sent.
+func (e *Endpoint) writeTo(b []byte, addr net.Addr) {
+	e.pc.WriteTo(b, addr)
+}
+
+// queueAccept adds a connection which has completed its handshake to the
+// accept queue.
+func (e *Endpoint) queueAccept(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// The client's original destination connection ID is no longer
+	// needed to route packets.
+	delete(e.conns, string(c.origDstConnID))
+	if e.closing || len(e.acceptQueue) >= maxAcceptQueue {
+		c.abort(time.Now(), localTransportError{code: errConnectionRefused})
+		return
+	}
+	e.acceptQueue = append(e.acceptQueue, c)
+	notify(e.acceptc)
+}
+
+// removeConn removes a finished connection.
+func (e *Endpoint) removeConn(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range []string{string(c.localConnID), string(c.origDstConnID)} {
+		if e.conns[id] == c {
+			delete(e.conns, id)
+		}
+	}
+}
+
+func (e *Endpoint) readLoop() {
+	defer close(e.readDonec)
+	for {
+		buf := make([]byte, maxRecvDatagramSize+1)
+		n, addr, err := e.pc.ReadFrom(buf)
+		if err != nil {
+			e.mu.Lock()
+			if !e.closing {
+				e.readErr = err
+			}
+			e.mu.Unlock()
+			notify(e.acceptc)
+			return
+		}
+		if n > maxRecvDatagramSize {
+			continue
+		}
+		e.handleDatagram(buf[:n], addr)
+	}
+}
+
+func (e *Endpoint) handleDatagram(b []byte, addr net.Addr) {
+	cid, ok := dstConnIDForDatagram(b)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	c := e.conns[string(cid)]
+	e.mu.Unlock()
+	if c != nil {
+		select {
+		case c.msgc <- b:
+		default:
+			// The connection is not keeping up; drop the datagram.
+		}
+		return
+	}
+	if e.config == nil || !isLongHeader(b[0]) {
+		return
+	}
+	p, ok := parseLongHeaderPacket(b)
+	if !ok {
+		return
+	}
+	if p.version != quicVersion1 {
+		if p.ptype != packetTypeVersionNegotiation && len(b) >= minInitialDatagramSize {
+			vn := appendVersionNegotiation(nil, p.srcConnID, p.dstConnID, quicVersion1)
+			e.pc.WriteTo(vn, addr)
+		}
+		return
+	}
+	// A server creates a connection in response to an Initial packet in a
+	// datagram of at least the minimum size. See RFC 9000, Section 14.1.
+	if p.ptype != packetTypeInitial || len(b) < minInitialDatagramSize || len(p.dstConnID) < 8 {
+		return
+	}
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return
+	}
+	e.mu.Unlock()
+	c, err := newConn(time.Now(), serverSide, e, e.config, addr,
+		append([]byte(nil), p.dstConnID...), append([]byte(nil), p.srcConnID...))
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	e.conns[string(c.localConnID)] = c
+	e.conns[string(c.origDstConnID)] = c
+	e.mu.Unlock()
+	c.msgc <- b
+	go c.loop()
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "time"
+
+// Frame types. See RFC 9000, Section 19.
+const (
+	frameTypePadding                    = 0x00
+	frameTypePing                       = 0x01
+	frameTypeAck                        = 0x02
+	frameTypeAckECN                     = 0x03
+	frameTypeResetStream                = 0x04
+	frameTypeStopSending                = 0x05
+	frameTypeCrypto                     = 0x06
+	frameTypeNewToken                   = 0x07
+	frameTypeStreamBase                 = 0x08 // low three bits carry flags
+	frameTypeMaxData                    = 0x10
+	frameTypeMaxStreamData              = 0x11
+	frameTypeMaxStreamsBidi             = 0x12
+	frameTypeMaxStreamsUni              = 0x13
+	frameTypeDataBlocked                = 0x14
+	frameTypeStreamDataBlocked          = 0x15
+	frameTypeStreamsBlockedBidi         = 0x16
+	frameTypeStreamsBlockedUni          = 0x17
+	frameTypeNewConnectionID            = 0x18
+	frameTypeRetireConnectionID         = 0x19
+	frameTypePathChallenge              = 0x1a
+	frameTypePathResponse               = 0x1b
+	frameTypeConnectionCloseTransport   = 0x1c
+	frameTypeConnectionCloseApplication = 0x1d
+	frameTypeHandshakeDone              = 0x1e
+)
+
+// Flags in the type of STREAM frames.
+const (
+	streamFinBit = 0x01
+	streamLenBit = 0x02
+	streamOffBit = 0x04
+)
+
+// ackDelayExponent is the ack_delay_exponent we send, and the default.
+const ackDelayExponent = 3
+
+// maxAckDelay is the max_ack_delay we send, and the default.
+const maxAckDelay = 25 * time.Millisecond
+
+// appendAckFrame appends an ACK frame acknowledging the packet numbers in
+// seen, which must not be empty. At most maxRanges ranges are included,
+// starting from the largest.
+func appendAckFrame(b []byte, seen rangeset, delay time.Duration, maxRanges int) []byte {
+	b = append(b, frameTypeAck)
+	last := seen[len(seen)-1]
+	b = appendVarint(b, uint64(last.end-1))
+	b = appendVarint(b, uint64(delay.Microseconds()>>ackDelayExponent))
+	n := len(seen)
+	if n > maxRanges {
+		n = maxRanges
+	}
+	b = appendVarint(b, uint64(n-1))
+	b = appendVarint(b, uint64(last.size()-1))
+	prevStart := last.start
+	for i := len(seen) - 2; i >= len(seen)-n; i-- {
+		r := seen[i]
+		b = appendVarint(b, uint64(prevStart-r.end-1))
+		b = appendVarint(b, uint64(r.size()-1))
+		prevStart = r.start
+	}
+	return b
+}
+
+// parseAckFrame parses an ACK frame body (after the type), returning the
+// acknowledged packet numbers and the encoded ACK delay.
+func parseAckFrame(b []byte, typ uint64) (acked rangeset, delay uint64, n int) {
+	off := 0
+	largest, m := consumeVarintInt64(b[off:])
+	if m < 0 {
+		return nil, 0, -1
+	}
+	off += m
+	delay, m = consumeVarint(b[off:])
+	if m < 0 {
+		return nil, 0, -1
+	}
+	off += m
+	count, m := consumeVarint(b[off:])
+	if m < 0 {
+		return nil, 0, -1
+	}
+	off += m
+	first, m := consumeVarintInt64(b[off:])
+	if m < 0 || first > largest {
+		return nil, 0, -1
+	}
+	off += m
+	smallest := largest - first
+	acked.add(smallest, largest+1)
+	for i := uint64(0); i < count; i++ {
+		gap, m := consumeVarintInt64(b[off:])
+		if m < 0 {
+			return nil, 0, -1
+		}
+		off += m
+		length, m := consumeVarintInt64(b[off:])
+		if m < 0 {
+			return nil, 0, -1
+		}
+		off += m
+		largest = smallest - gap - 2
+		if largest < 0 || length > largest {
+			return nil, 0, -1
+		}
+		smallest = largest - length
+		acked.add(smallest, largest+1)
+	}
+	if typ == frameTypeAckECN {
+		for i := 0; i < 3; i++ {
+			_, m := consumeVarint(b[off:])
+			if m < 0 {
+				return nil, 0, -1
+			}
+			off += m
+		}
+	}
+	return acked, delay, off
+}
+
+func appendCryptoFrame(b []byte, off int64, data []byte) []byte {
+	b = append(b, frameTypeCrypto)
+	b = appendVarint(b, uint64(off))
+	return appendVarintBytes(b, data)
+}
+
+// cryptoFrameOverhead returns the size of a CRYPTO frame header.
+func cryptoFrameOverhead(off int64, size int) int {
+	return 1 + sizeVarint(uint64(off)) + sizeVarint(uint64(size))
+}
+
+// appendStreamFrame appends a STREAM frame. The length is always included.
+func appendStreamFrame(b []byte, id streamID, off int64, data []byte, fin bool) []byte {
+	typ := byte(frameTypeStreamBase | streamLenBit)
+	if off != 0 {
+		typ |= streamOffBit
+	}
+	if fin {
+		typ |= streamFinBit
+	}
+	b = append(b, typ)
+	b = appendVarint(b, uint64(id))
+	if off != 0 {
+		b = appendVarint(b, uint64(off))
+	}
+	return appendVarintBytes(b, data)
+}
+
+// streamFrameOverhead returns the size of a STREAM frame header.
+func streamFrameOverhead(id streamID, off int64, size int) int {
+	n := 1 + sizeVarint(uint64(id)) + sizeVarint(uint64(size))
+	if off != 0 {
+		n += sizeVarint(uint64(off))
+	}
+	return n
+}
+
+func appendResetStreamFrame(b []byte, id streamID, code uint64, finalSize int64) []byte {
+	b = append(b, frameTypeResetStream)
+	b = appendVarint(b, uint64(id))
+	b = appendVarint(b, code)
+	return appendVarint(b, uint64(finalSize))
+}
+
+func appendStopSendingFrame(b []byte, id streamID, code uint64) []byte {
+	b = append(b, frameTypeStopSending)
+	b = appendVarint(b, uint64(id))
+	return appendVarint(b, code)
+}
+
+func appendMaxDataFrame(b []byte, max int64) []byte {
+	b = append(b, frameTypeMaxData)
+	return appendVarint(b, uint64(max))
+}
+
+func appendMaxStreamDataFrame(b []byte, id streamID, max int64) []byte {
+	b = append(b, frameTypeMaxStreamData)
+	b = appendVarint(b, uint64(id))
+	return appendVarint(b, uint64(max))
+}
+
+func appendMaxStreamsFrame(b []byte, styp streamType, max int64) []byte {
+	if styp == uniStream {
+		b = append(b, frameTypeMaxStreamsUni)
+	} else {
+		b = append(b, frameTypeMaxStreamsBidi)
+	}
+	return appendVarint(b, uint64(max))
+}
+
+func appendConnectionCloseTransportFrame(b []byte, code TransportError, frameType uint64, reason string) []byte {
+	b = append(b, frameTypeConnectionCloseTransport)
+	b = appendVarint(b, uint64(code))
+	b = appendVarint(b, frameType)
+	return appendVarintBytes(b, []byte(reason))
+}
+
+func appendConnectionCloseApplicationFrame(b []byte, code uint64, reason string) []byte {
+	b = append(b, frameTypeConnectionCloseApplication)
+	b = appendVarint(b, code)
+	return appendVarintBytes(b, []byte(reason))
+}
+
+func appendPathResponseFrame(b []byte, data [8]byte) []byte {
+	b = append(b, frameTypePathResponse)
+	return append(b, data[:]...)
+}
+
+// maxCloseReasonLen limits the reason phrase we send in CONNECTION_CLOSE
+// frames, so that the frame always fits in a packet.
+const maxCloseReasonLen = 256
@@ -0,0 +1,420 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "time"
+
+// Loss detection and congestion control, following RFC 9002.
+
+const (
+	timerGranularity  = time.Millisecond
+	initialRTT        = 333 * time.Millisecond
+	packetThreshold   = 3
+	minCongestionWnd  = 2 * maxDatagramSize
+	initialCongestion = 10 * maxDatagramSize
+)
+
+// A sentPacket records a packet we sent and have not yet seen acknowledged
+// or declared lost.
+type sentPacket struct {
+	num          int64
+	time         time.Time
+	size         int
+	ackEliciting bool
+	inFlight     bool
+	frames       []sentFrame
+}
+
+type sentFrameKind int8
+
+const (
+	sentAck sentFrameKind = iota
+	sentCrypto
+	sentStream
+	sentResetStream
+	sentStopSending
+	sentMaxData
+	sentMaxStreamData
+	sentMaxStreams
+	sentHandshakeDone
+	sentPing
+)
+
+// A sentFrame records the information needed to handle the loss or
+// acknowledgement of a frame.
+type sentFrame struct {
+	kind sentFrameKind
+	id   streamID
+	off  int64
+	size int
+	fin  bool
+	typ  streamType // for sentMaxStreams
+}
+
+// rttState estimates the round-trip time. See RFC 9002, Section 5.
+type rttState struct {
+	min      time.Duration
+	latest   time.Duration
+	smoothed time.Duration
+	variance time.Duration
+	sampled  bool
+}
+
+func (r *rttState) init() {
+	r.smoothed = initialRTT
+	r.variance = initialRTT / 2
+}
+
+func (r *rttState) update(latest, ackDelay time.Duration) {
+	r.latest = latest
+	if !r.sampled {
+		r.sampled = true
+		r.min = latest
+		r.smoothed = latest
+		r.variance = latest / 2
+		return
+	}
+	if latest < r.min {
+		r.min = latest
+	}
+	adjusted := latest
+	if latest >= r.min+ackDelay {
+		adjusted = latest - ackDelay
+	}
+	diff := r.smoothed - adjusted
+	if diff < 0 {
+		diff = -diff
+	}
+	r.variance = (3*r.variance + diff) / 4
+	r.smoothed = (7*r.smoothed + adjusted) / 8
+}
+
+// pto returns the probe timeout, including the peer's maximum ACK delay.
+// See RFC 9002, Section 6.2.1.
+func (r *rttState) pto(maxAckDelay time.Duration) time.Duration {
+	v := 4 * r.variance
+	if v < timerGranularity {
+		v = timerGranularity
+	}
+	return r.smoothed + v + maxAckDelay
+}
+
+// lossDelay returns the time threshold for declaring a packet lost.
+// See RFC 9002, Section 6.1.2.
+func (r *rttState) lossDelay() time.Duration {
+	d := r.smoothed
+	if r.latest > d {
+		d = r.latest
+	}
+	d = d * 9 / 8
+	if d < timerGranularity {
+		d = timerGranularity
+	}
+	return d
+}
+
+// ccReno is a NewReno congestion controller. See RFC 9002, Section 7.
+type ccReno struct {
+	window        int
+	ssthresh      int
+	inFlight      int
+	recoveryStart time.Time
+}
+
+func (cc *ccReno) init() {
+	cc.window = initialCongestion
+	cc.ssthresh = int(^uint(0) >> 1)
+}
+
+func (cc *ccReno) canSend() bool {
+	return cc.inFlight < cc.window
+}
+
+func (cc *ccReno) onSent(p *sentPacket) {
+	cc.inFlight += p.size
+}
+
+func (cc *ccReno) onAcked(p *sentPacket) {
+	cc.inFlight -= p.size
+	if !p.time.After(cc.recoveryStart) {
+		return
+	}
+	if cc.window < cc.ssthresh {
+		cc.window += p.size
+	} else {
+		cc.window += maxDatagramSize * p.size / cc.window
+	}
+}
+
+func (cc *ccReno) onLost(now time.Time, p *sentPacket) {
+	cc.inFlight -= p.size
+	if !p.time.After(cc.recoveryStart) {
+		return
+	}
+	cc.recoveryStart = now
+	cc.ssthresh = cc.window / 2
+	if cc.ssthresh < minCongestionWnd {
+		cc.ssthresh = minCongestionWnd
+	}
+	cc.window = cc.ssthresh
+}
+
+func (cc *ccReno) onDiscarded(p *sentPacket) {
+	cc.inFlight -= p.size
+}
+
+// peerMaxAckDelay returns the maximum ACK delay to allow for in the given
+// space. See RFC 9002, Section 6.2.1.
+func (c *Conn) peerMaxAckDelay(space numberSpace) time.Duration {
+	if space != appDataSpace || !c.gotPeerParams {
+		return 0
+	}
+	return c.peerParams.maxAckDelay
+}
+
+// handleAck processes an ACK frame.
+func (c *Conn) handleAck(now time.Time, space numberSpace, acked rangeset, delay uint64) error {
+	s := &c.spaces[space]
+	largest := acked.max()
+	if largest >= s.nextNum {
+		return localTransportError{code: errProtocolViolation, reason: "acknowledgement of unsent packet"}
+	}
+	if s.discarded {
+		return nil
+	}
+	if largest > s.largestAcked {
+		s.largestAcked = largest
+	}
+	var newlyAcked []*sentPacket
+	rttSample := false
+	var largestSentTime time.Time
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if !acked.contains(p.num) {
+			kept = append(kept, p)
+			continue
+		}
+		newlyAcked = append(newlyAcked, p)
+		if p.num == largest {
+			largestSentTime = p.time
+		}
+		if p.ackEliciting {
+			rttSample = true
+		}
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	if len(newlyAcked) == 0 {
+		return nil
+	}
+	if rttSample && !largestSentTime.IsZero() {
+		ackDelay := time.Duration(0)
+		if space == appDataSpace {
+			exp := uint(ackDelayExponent)
+			if c.gotPeerParams {
+				exp = uint(c.peerParams.ackDelayExponent)
+			}
+			ackDelay = time.Duration(delay<<exp) * time.Microsecond
+			if c.handshakeConfirmed && ackDelay > c.peerMaxAckDelay(space) {
+				ackDelay = c.peerMaxAckDelay(space)
+			}
+		}
+		c.rtt.update(now.Sub(largestSentTime), ackDelay)
+	}
+	for _, p := range newlyAcked {
+		if p.inFlight {
+			c.cc.onAcked(p)
+		}
+		c.onFramesAcked(space, p)
+	}
+	c.detectLoss(now, space)
+	c.ptoCount = 0
+	return nil
+}
+
+// onFramesAcked handles the acknowledgement of the frames in a packet.
+func (c *Conn) onFramesAcked(space numberSpace, p *sentPacket) {
+	for _, f := range p.frames {
+		switch f.kind {
+		case sentCrypto:
+			c.spaces[space].cryptoSend.ack(f.off, f.size)
+		case sentStream:
+			s := c.streams[f.id]
+			if s == nil {
+				continue
+			}
+			s.send.ack(f.off, f.size)
+			if f.fin {
+				s.finAcked = true
+			}
+			notify(s.writeNotify)
+			c.checkStreamDone(s)
+		case sentResetStream:
+			if s := c.streams[f.id]; s != nil {
+				s.resetAcked = true
+				c.checkStreamDone(s)
+			}
+		}
+	}
+}
+
+// onFramesLost handles the loss of the frames in a packet, scheduling
+// them to be sent again as needed.
+func (c *Conn) onFramesLost(space numberSpace, p *sentPacket) {
+	for _, f := range p.frames {
+		switch f.kind {
+		case sentCrypto:
+			if !c.spaces[space].discarded {
+				c.spaces[space].cryptoSend.lose(f.off, f.size)
+			}
+		case sentStream:
+			s := c.streams[f.id]
+			if s == nil || s.resetSendCode >= 0 {
+				continue
+			}
+			s.send.lose(f.off, f.size)
+			if f.fin && !s.finAcked {
+				s.finSent = false
+			}
+			c.queueStream(s)
+		case sentResetStream:
+			if s := c.streams[f.id]; s != nil && !s.resetAcked {
+				s.resetSent = false
+				c.queueStream(s)
+			}
+		case sentStopSending:
+			if s := c.streams[f.id]; s != nil && s.resetCode < 0 && !s.allReceived() {
+				s.stopSendingSent = false
+				c.queueStream(s)
+			}
+		case sentMaxData:
+			c.needMaxData = true
+		case sentMaxStreamData:
+			if s := c.streams[f.id]; s != nil && !s.readClosed && s.finalSize < 0 {
+				s.needMaxData = true
+				c.queueStream(s)
+			}
+		case sentMaxStreams:
+			c.needMaxStreams[f.typ] = true
+		case sentHandshakeDone:
+			c.needHandshakeDone = true
+		}
+	}
+}
+
+// detectLoss declares packets lost using the packet and time thresholds,
+// and sets the loss timer for the space. See RFC 9002, Section 6.1.
+func (c *Conn) detectLoss(now time.Time, space numberSpace) {
+	s := &c.spaces[space]
+	s.lossTime = time.Time{}
+	if s.largestAcked < 0 {
+		return
+	}
+	lossDelay := c.rtt.lossDelay()
+	lostSendTime := now.Add(-lossDelay)
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if p.num > s.largestAcked {
+			kept = append(kept, p)
+			continue
+		}
+		if !p.time.After(lostSendTime) || s.largestAcked-p.num >= packetThreshold {
+			if p.inFlight {
+				c.cc.onLost(now, p)
+			}
+			c.onFramesLost(space, p)
+			continue
+		}
+		if t := p.time.Add(lossDelay); s.lossTime.IsZero() || t.Before(s.lossTime) {
+			s.lossTime = t
+		}
+		kept = append(kept, p)
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+}
+
+func (s *pnState) ackElicitingInFlight() bool {
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			return true
+		}
+	}
+	return false
+}
+
+// lossDetectionDeadline returns the time of the loss detection timer and
+// the space it applies to. See RFC 9002, Appendix A.8.
+func (c *Conn) lossDetectionDeadline() (time.Time, numberSpace) {
+	if c.state != connOpen {
+		return time.Time{}, 0
+	}
+	var t time.Time
+	var space numberSpace
+	for i := range c.spaces {
+		s := &c.spaces[i]
+		if !s.lossTime.IsZero() && (t.IsZero() || s.lossTime.Before(t)) {
+			t, space = s.lossTime, numberSpace(i)
+		}
+	}
+	if !t.IsZero() {
+		return t, space
+	}
+	shift := uint(c.ptoCount)
+	if shift > 16 {
+		shift = 16
+	}
+	backoff := time.Duration(1) << shift
+	anyInFlight := false
+	for i := range c.spaces {
+		sp := numberSpace(i)
+		s := &c.spaces[i]
+		if s.discarded || !s.ackElicitingInFlight() {
+			continue
+		}
+		anyInFlight = true
+		if sp == appDataSpace && !c.handshakeConfirmed {
+			continue
+		}
+		pt := s.lastAckEliciting.Add(c.rtt.pto(c.peerMaxAckDelay(sp)) * backoff)
+		if t.IsZero() || pt.Before(t) {
+			t, space = pt, sp
+		}
+	}
+	if !anyInFlight && c.side == clientSide && !c.handshakeConfirmed && !c.lastSendTime.IsZero() {
+		// The client arms the PTO timer even with nothing in flight until
+		// the handshake is confirmed, since the server may be blocked by
+		// the anti-amplification limit. See RFC 9002, Section 6.2.2.1.
+		space = initialSpace
+		if c.handshakeKeys.w.isSet() {
+			space = handshakeSpace
+		}
+		t = c.lastSendTime.Add(c.rtt.pto(0) * backoff)
+	}
+	return t, space
+}
+
+// onLossDetectionTimeout handles the expiry of the loss detection timer.
+func (c *Conn) onLossDetectionTimeout(now time.Time, space numberSpace) {
+	if !c.spaces[space].lossTime.IsZero() {
+		c.detectLoss(now, space)
+		return
+	}
+	// The probe timeout fired. Send one or two ack-eliciting packets,
+	// retransmitting data in flight. See RFC 9002, Section 6.2.4.
+	c.ptoCount++
+	s := &c.spaces[space]
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			c.onFramesLost(space, p)
+		}
+	}
+	c.probe[space] = 2
+	c.wake()
+}
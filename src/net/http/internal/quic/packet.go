@@ -0,0 +1,244 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "encoding/binary"
+
+const quicVersion1 = 0x00000001
+
+// connIDLen is the length of the connection IDs we issue.
+const connIDLen = 8
+
+// maxConnIDLen is the maximum length of a connection ID in QUIC version 1.
+const maxConnIDLen = 20
+
+// minInitialDatagramSize is the size to which client datagrams containing
+// Initial packets are padded. See RFC 9000, Section 14.1.
+const minInitialDatagramSize = 1200
+
+// maxDatagramSize is the largest datagram we send. Without path MTU
+// discovery, we stick to the minimum every QUIC path must support.
+const maxDatagramSize = 1200
+
+// maxRecvDatagramSize is the largest datagram we accept.
+const maxRecvDatagramSize = 1500
+
+type packetType byte
+
+const (
+	packetTypeInvalid packetType = iota
+	packetTypeInitial
+	packetType0RTT
+	packetTypeHandshake
+	packetTypeRetry
+	packetType1RTT
+	packetTypeVersionNegotiation
+)
+
+func (p packetType) String() string {
+	switch p {
+	case packetTypeInitial:
+		return "Initial"
+	case packetType0RTT:
+		return "0-RTT"
+	case packetTypeHandshake:
+		return "Handshake"
+	case packetTypeRetry:
+		return "Retry"
+	case packetType1RTT:
+		return "1-RTT"
+	case packetTypeVersionNegotiation:
+		return "VersionNegotiation"
+	}
+	return "Invalid"
+}
+
+// Bits in the first byte of a packet.
+const (
+	headerFormLong  = 0x80
+	fixedBit        = 0x40
+	longTypeMask    = 0x30
+	longTypeInitial = 0x00
+	longType0RTT    = 0x10
+	longTypeHS      = 0x20
+	longTypeRetry   = 0x30
+)
+
+func isLongHeader(b byte) bool {
+	return b&headerFormLong != 0
+}
+
+// getPacketType returns the type of the packet starting at b.
+func getPacketType(b []byte) packetType {
+	if len(b) == 0 {
+		return packetTypeInvalid
+	}
+	if !isLongHeader(b[0]) {
+		if b[0]&fixedBit == 0 {
+			return packetTypeInvalid
+		}
+		return packetType1RTT
+	}
+	if len(b) < 5 {
+		return packetTypeInvalid
+	}
+	if binary.BigEndian.Uint32(b[1:5]) == 0 {
+		return packetTypeVersionNegotiation
+	}
+	switch b[0] & longTypeMask {
+	case longTypeInitial:
+		return packetTypeInitial
+	case longType0RTT:
+		return packetType0RTT
+	case longTypeHS:
+		return packetTypeHandshake
+	case longTypeRetry:
+		return packetTypeRetry
+	}
+	return packetTypeInvalid
+}
+
+// dstConnIDForDatagram returns the destination connection ID of the first
+// packet in a datagram. For short header packets, it assumes the connection
+// ID is one we issued.
+func dstConnIDForDatagram(b []byte) (cid []byte, ok bool) {
+	if len(b) < 1 {
+		return nil, false
+	}
+	if !isLongHeader(b[0]) {
+		if len(b) < 1+connIDLen {
+			return nil, false
+		}
+		return b[1 : 1+connIDLen], true
+	}
+	if len(b) < 6 {
+		return nil, false
+	}
+	cid, n := consumeUint8Bytes(b[5:])
+	if n < 0 || len(cid) > maxConnIDLen {
+		return nil, false
+	}
+	return cid, true
+}
+
+// A longPacket is a parsed long header packet, before decryption.
+type longPacket struct {
+	ptype     packetType
+	version   uint32
+	dstConnID []byte
+	srcConnID []byte
+	token     []byte // Initial packets only
+	pnOff     int    // offset of the packet number
+	size      int    // total size of the packet, including header
+}
+
+// parseLongHeaderPacket parses the header of the long header packet at the
+// start of b.
+func parseLongHeaderPacket(b []byte) (p longPacket, ok bool) {
+	p.ptype = getPacketType(b)
+	if p.ptype == packetTypeInvalid || p.ptype == packetType1RTT {
+		return p, false
+	}
+	p.version = binary.BigEndian.Uint32(b[1:5])
+	off := 5
+	var n int
+	p.dstConnID, n = consumeUint8Bytes(b[off:])
+	if n < 0 || len(p.dstConnID) > maxConnIDLen {
+		return p, false
+	}
+	off += n
+	p.srcConnID, n = consumeUint8Bytes(b[off:])
+	if n < 0 || len(p.srcConnID) > maxConnIDLen {
+		return p, false
+	}
+	off += n
+	switch p.ptype {
+	case packetTypeVersionNegotiation, packetTypeRetry:
+		// These packets extend to the end of the datagram.
+		p.size = len(b)
+		return p, true
+	case packetTypeInitial:
+		p.token, n = consumeVarintBytes(b[off:])
+		if n < 0 {
+			return p, false
+		}
+		off += n
+	}
+	length, n := consumeVarint(b[off:])
+	if n < 0 {
+		return p, false
+	}
+	off += n
+	if length > uint64(len(b)-off) {
+		return p, false
+	}
+	p.pnOff = off
+	p.size = off + int(length)
+	return p, true
+}
+
+// decodePacketNumber decodes a truncated packet number, given the largest
+// packet number received so far. See RFC 9000, Appendix A.3.
+func decodePacketNumber(largest, truncated int64, pnLen int) int64 {
+	expected := largest + 1
+	win := int64(1) << (uint(pnLen) * 8)
+	hwin := win / 2
+	mask := win - 1
+	candidate := (expected &^ mask) | truncated
+	if candidate <= expected-hwin && candidate < (1<<62)-win {
+		return candidate + win
+	}
+	if candidate > expected+hwin && candidate >= win {
+		return candidate - win
+	}
+	return candidate
+}
+
+// packetNumberLength returns the number of bytes needed to encode pnum,
+// given the largest packet number acknowledged by the peer.
+// See RFC 9000, Section 17.1.
+func packetNumberLength(pnum, largestAcked int64) int {
+	d := pnum - largestAcked
+	switch {
+	case d < 0x80:
+		return 1
+	case d < 0x8000:
+		return 2
+	case d < 0x800000:
+		return 3
+	}
+	return 4
+}
+
+// readPacketNumber reads a packet number of length pnLen from b.
+func readPacketNumber(b []byte, pnLen int) int64 {
+	var v int64
+	for i := 0; i < pnLen; i++ {
+		v = v<<8 | int64(b[i])
+	}
+	return v
+}
+
+// appendPacketNumber appends the low pnLen bytes of pnum.
+func appendPacketNumber(b []byte, pnum int64, pnLen int) []byte {
+	for i := pnLen - 1; i >= 0; i-- {
+		b = append(b, byte(pnum>>(8*uint(i))))
+	}
+	return b
+}
+
+// appendVersionNegotiation appends a Version Negotiation packet sent in
+// response to a packet with the given connection IDs. See RFC 9000,
+// Section 17.2.1.
+func appendVersionNegotiation(b, dstConnID, srcConnID []byte, versions ...uint32) []byte {
+	b = append(b, headerFormLong|fixedBit)
+	b = append(b, 0, 0, 0, 0)
+	b = appendUint8Bytes(b, dstConnID)
+	b = appendUint8Bytes(b, srcConnID)
+	for _, v := range versions {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/chacha20poly1305"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// initialSalt is the salt used to derive Initial packet protection keys.
+// See RFC 9001, Section 5.2.
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+const (
+	aeadTagSize       = 16
+	headerSampleSize  = 16
+	maxPacketNumLen   = 4
+	headerMaskLength  = 5
+	longHeaderHPBits  = 0x0f
+	shortHeaderHPBits = 0x1f
+)
+
+var errDecrypt = errors.New("quic: packet decryption failed")
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446, Section 7.1.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	const prefix = "tls13 "
+	info := make([]byte, 0, 2+1+len(prefix)+len(label)+1)
+	info = append(info, byte(length>>8), byte(length))
+	info = append(info, byte(len(prefix)+len(label)))
+	info = append(info, prefix...)
+	info = append(info, label...)
+	info = append(info, 0) // empty context
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(h, secret, info).Read(out); err != nil {
+		panic("quic: HKDF-Expand-Label invocation failed unexpectedly")
+	}
+	return out
+}
+
+// suiteParams returns the hash and AEAD key size of a TLS 1.3 cipher suite.
+func suiteParams(suite uint16) (crypto.Hash, int) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		return crypto.SHA256, 16
+	case tls.TLS_AES_256_GCM_SHA384:
+		return crypto.SHA384, 32
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		return crypto.SHA256, chacha20poly1305.KeySize
+	}
+	panic("quic: unsupported cipher suite")
+}
+
+// A headerKey removes or applies header protection. See RFC 9001, Section 5.4.
+type headerKey struct {
+	block     cipher.Block // for AES suites
+	chachaKey []byte       // for ChaCha20
+}
+
+func newHeaderKey(suite uint16, key []byte) headerKey {
+	if suite == tls.TLS_CHACHA20_POLY1305_SHA256 {
+		return headerKey{chachaKey: key}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	return headerKey{block: block}
+}
+
+func (k headerKey) isSet() bool {
+	return k.block != nil || k.chachaKey != nil
+}
+
+// mask computes the header protection mask for a sample of the ciphertext.
+func (k headerKey) mask(sample []byte) (mask [headerMaskLength]byte) {
+	if k.block != nil {
+		var out [aes.BlockSize]byte
+		k.block.Encrypt(out[:], sample)
+		copy(mask[:], out[:])
+		return mask
+	}
+	c, err := chacha20.NewUnauthenticatedCipher(k.chachaKey, sample[4:16])
+	if err != nil {
+		panic(err)
+	}
+	c.SetCounter(binary.LittleEndian.Uint32(sample[:4]))
+	c.XORKeyStream(mask[:], mask[:])
+	return mask
+}
+
+// protect applies header protection to a packet whose packet number starts at
+// pnOff and is pnLen bytes long.
+func (k headerKey) protect(pkt []byte, pnOff, pnLen int) {
+	mask := k.mask(pkt[pnOff+maxPacketNumLen:][:headerSampleSize])
+	if isLongHeader(pkt[0]) {
+		pkt[0] ^= mask[0] & longHeaderHPBits
+	} else {
+		pkt[0] ^= mask[0] & shortHeaderHPBits
+	}
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+	}
+}
+
+// unprotect removes header protection from a packet whose packet number
+// starts at pnOff, returning the packet number length. It reports an error
+// if the packet is too short to contain a sample.
+func (k headerKey) unprotect(pkt []byte, pnOff int) (pnLen int, err error) {
+	if len(pkt) < pnOff+maxPacketNumLen+headerSampleSize {
+		return 0, errDecrypt
+	}
+	mask := k.mask(pkt[pnOff+maxPacketNumLen:][:headerSampleSize])
+	if isLongHeader(pkt[0]) {
+		pkt[0] ^= mask[0] & longHeaderHPBits
+	} else {
+		pkt[0] ^= mask[0] & shortHeaderHPBits
+	}
+	pnLen = int(pkt[0]&0x03) + 1
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+	}
+	return pnLen, nil
+}
+
+// A packetKey applies or removes packet protection. See RFC 9001, Section 5.3.
+type packetKey struct {
+	aead cipher.AEAD
+	iv   []byte
+}
+
+func newPacketKey(suite uint16, key, iv []byte) packetKey {
+	var aead cipher.AEAD
+	var err error
+	if suite == tls.TLS_CHACHA20_POLY1305_SHA256 {
+		aead, err = chacha20poly1305.New(key)
+	} else {
+		var block cipher.Block
+		block, err = aes.NewCipher(key)
+		if err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return packetKey{aead: aead, iv: iv}
+}
+
+func (k packetKey) isSet() bool {
+	return k.aead != nil
+}
+
+func (k packetKey) nonce(pnum int64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(uint64(pnum) >> (8 * i))
+	}
+	return nonce
+}
+
+// seal encrypts the payload of pkt in place, where the header is
+// pkt[:hdrLen], and appends the authentication tag.
+func (k packetKey) seal(pkt []byte, hdrLen int, pnum int64) []byte {
+	hdr := pkt[:hdrLen]
+	return k.aead.Seal(hdr, k.nonce(pnum), pkt[hdrLen:], hdr)
+}
+
+// open decrypts the payload of pkt, where the header is pkt[:hdrLen].
+func (k packetKey) open(pkt []byte, hdrLen int, pnum int64) ([]byte, error) {
+	hdr := pkt[:hdrLen]
+	payload, err := k.aead.Open(pkt[hdrLen:hdrLen], k.nonce(pnum), pkt[hdrLen:], hdr)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return payload, nil
+}
+
+// keysFromSecret derives the packet protection and header protection keys
+// from a traffic secret. See RFC 9001, Section 5.1.
+func keysFromSecret(suite uint16, secret []byte) (packetKey, headerKey) {
+	h, keyLen := suiteParams(suite)
+	key := hkdfExpandLabel(h.New, secret, "quic key", keyLen)
+	iv := hkdfExpandLabel(h.New, secret, "quic iv", 12)
+	hp := hkdfExpandLabel(h.New, secret, "quic hp", keyLen)
+	return newPacketKey(suite, key, iv), newHeaderKey(suite, hp)
+}
+
+// nextSecret derives the next generation of a 1-RTT traffic secret.
+// See RFC 9001, Section 6.1.
+func nextSecret(suite uint16, secret []byte) []byte {
+	h, _ := suiteParams(suite)
+	return hkdfExpandLabel(h.New, secret, "quic ku", len(secret))
+}
+
+// initialSecrets returns the client and server Initial secrets derived from
+// the client's first destination connection ID. See RFC 9001, Section 5.2.
+func initialSecrets(cid []byte) (client, server []byte) {
+	initial := hkdf.Extract(crypto.SHA256.New, cid, initialSalt)
+	client = hkdfExpandLabel(crypto.SHA256.New, initial, "client in", 32)
+	server = hkdfExpandLabel(crypto.SHA256.New, initial, "server in", 32)
+	return client, server
+}
+
+// directionalKeys are the keys for one direction of one packet number space.
+type directionalKeys struct {
+	pkt packetKey
+	hdr headerKey
+}
+
+func (k directionalKeys) isSet() bool {
+	return k.pkt.isSet()
+}
+
+// fixedKeys are the keys for the Initial and Handshake spaces, which do not
+// change once set.
+type fixedKeys struct {
+	r, w directionalKeys
+}
+
+func (k *fixedKeys) setRead(suite uint16, secret []byte) {
+	k.r.pkt, k.r.hdr = keysFromSecret(suite, secret)
+}
+
+func (k *fixedKeys) setWrite(suite uint16, secret []byte) {
+	k.w.pkt, k.w.hdr = keysFromSecret(suite, secret)
+}
+
+func (k *fixedKeys) discard() {
+	*k = fixedKeys{}
+}
+
+// updatingKeys are the 1-RTT keys, which may be updated by the peer.
+// We never initiate a key update ourselves. See RFC 9001, Section 6.
+type updatingKeys struct {
+	suite uint16
+
+	// hdrR and hdrW are not changed by key updates.
+	hdrR, hdrW headerKey
+
+	phase bool // current key phase bit
+
+	// Read keys for the previous, current and next key phases.
+	prevR, curR, nextR packetKey
+	// firstCurPnum is the first packet number decrypted with curR.
+	firstCurPnum int64
+
+	curW                            packetKey
+	nextReadSecret, nextWriteSecret []byte
+}
+
+func (k *updatingKeys) canRead() bool  { return k.curR.isSet() }
+func (k *updatingKeys) canWrite() bool { return k.curW.isSet() }
+
+func (k *updatingKeys) setRead(suite uint16, secret []byte) {
+	k.suite = suite
+	k.curR, k.hdrR = keysFromSecret(suite, secret)
+	k.nextReadSecret = nextSecret(suite, secret)
+	k.nextR, _ = keysFromSecret(suite, k.nextReadSecret)
+	k.firstCurPnum = -1
+}
+
+func (k *updatingKeys) setWrite(suite uint16, secret []byte) {
+	k.curW, k.hdrW = keysFromSecret(suite, secret)
+	k.nextWriteSecret = nextSecret(suite, secret)
+}
+
+// open decrypts a 1-RTT packet, handling a key update initiated by the peer.
+// The header protection must already have been removed.
+func (k *updatingKeys) open(pkt []byte, hdrLen int, pnum int64) ([]byte, error) {
+	phase := pkt[0]&0x04 != 0
+	if phase == k.phase {
+		payload, err := k.curR.open(pkt, hdrLen, pnum)
+		if err == nil && (k.firstCurPnum < 0 || pnum < k.firstCurPnum) {
+			k.firstCurPnum = pnum
+		}
+		return payload, err
+	}
+	if k.prevR.isSet() && pnum < k.firstCurPnum {
+		// A delayed packet from the previous key phase.
+		return k.prevR.open(pkt, hdrLen, pnum)
+	}
+	// The peer has initiated a key update.
+	payload, err := k.nextR.open(pkt, hdrLen, pnum)
+	if err != nil {
+		return nil, err
+	}
+	k.phase = phase
+	k.prevR, k.curR = k.curR, k.nextR
+	k.firstCurPnum = pnum
+	k.nextReadSecret = nextSecret(k.suite, k.nextReadSecret)
+	k.nextR, _ = keysFromSecret(k.suite, k.nextReadSecret)
+	k.curW, _ = keysFromSecret(k.suite, k.nextWriteSecret)
+	k.nextWriteSecret = nextSecret(k.suite, k.nextWriteSecret)
+	return payload, nil
+}
+
+// keyPhaseBit returns the key phase bit to set in sent 1-RTT packets.
+func (k *updatingKeys) keyPhaseBit() byte {
+	if k.phase {
+		return 0x04
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 9001, Appendix A.1.
+func TestInitialKeys(t *testing.T) {
+	client, server := initialSecrets(unhex("8394c8f03e515708"))
+	for _, test := range []struct {
+		name   string
+		secret []byte
+		key    string
+		iv     string
+		hp     string
+	}{{
+		name:   "client",
+		secret: client,
+		key:    "1f369613dd76d5467730efcbe3b1a22d",
+		iv:     "fa044b2f42a3fd3b46fb255c",
+		hp:     "9f50449e04a0e810283a1e9933adedd2",
+	}, {
+		name:   "server",
+		secret: server,
+		key:    "cf3a5331653c364c88f0f379b6067e37",
+		iv:     "0ac1493ca1905853b0bba03e",
+		hp:     "c206b8d9b9f0f37644430b490eeaa314",
+	}} {
+		h, keyLen := suiteParams(tls.TLS_AES_128_GCM_SHA256)
+		if got := hkdfExpandLabel(h.New, test.secret, "quic key", keyLen); !bytes.Equal(got, unhex(test.key)) {
+			t.Errorf("%v key = %x, want %v", test.name, got, test.key)
+		}
+		if got := hkdfExpandLabel(h.New, test.secret, "quic iv", 12); !bytes.Equal(got, unhex(test.iv)) {
+			t.Errorf("%v iv = %x, want %v", test.name, got, test.iv)
+		}
+		if got := hkdfExpandLabel(h.New, test.secret, "quic hp", keyLen); !bytes.Equal(got, unhex(test.hp)) {
+			t.Errorf("%v hp = %x, want %v", test.name, got, test.hp)
+		}
+	}
+}
+
+// Test vector from RFC 9001, Appendix A.5.
+func TestChaCha20PacketProtection(t *testing.T) {
+	const suite = tls.TLS_CHACHA20_POLY1305_SHA256
+	secret := unhex("9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b")
+	h, keyLen := suiteParams(suite)
+	if got, want := hkdfExpandLabel(h.New, secret, "quic key", keyLen), unhex("c6d98ff3441c3fe1b2182094f69caa2ed4b716b65488960a7a984979fb23e1c8"); !bytes.Equal(got, want) {
+		t.Errorf("key = %x, want %x", got, want)
+	}
+	if got, want := nextSecret(suite, secret), unhex("1223504755036d556342ee9361d253421a826c9ecdf3c7148684b36b714881f9"); !bytes.Equal(got, want) {
+		t.Errorf("next secret = %x, want %x", got, want)
+	}
+
+	const pnum = 654360564
+	hdr := unhex("4200bff4")
+	payload := unhex("01")
+	want := unhex("4cfe4189655e5cd55c41f69080575d7999c25a5bfb")
+
+	pkt, hk := keysFromSecret(suite, secret)
+	b := append(append([]byte(nil), hdr...), payload...)
+	b = pkt.seal(b, len(hdr), pnum)
+	hk.protect(b, 1, 3)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("protected packet:\n got %x\nwant %x", b, want)
+	}
+
+	pnLen, err := hk.unprotect(b, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pnLen != 3 {
+		t.Fatalf("packet number length = %v, want 3", pnLen)
+	}
+	got := decodePacketNumber(654360563, readPacketNumber(b[1:], pnLen), pnLen)
+	if got != pnum {
+		t.Fatalf("packet number = %v, want %v", got, pnum)
+	}
+	out, err := pkt.open(b, 1+pnLen, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("payload = %x, want %x", out, payload)
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	const suite = tls.TLS_AES_128_GCM_SHA256
+	secret := bytes.Repeat([]byte{1}, 32)
+	var sender, receiver updatingKeys
+	sender.setWrite(suite, secret)
+	sender.setRead(suite, secret)
+	receiver.setRead(suite, secret)
+	receiver.setWrite(suite, secret)
+
+	seal := func(keys packetKey, phase byte, pnum int64) []byte {
+		b := []byte{fixedBit | phase, byte(pnum)}
+		b = append(b, "payload"...)
+		return keys.seal(b, 2, pnum)
+	}
+	if _, err := receiver.open(seal(sender.curW, 0, 0), 2, 0); err != nil {
+		t.Fatalf("open with current keys: %v", err)
+	}
+	// The peer updates its keys, and uses the next key phase.
+	next, _ := keysFromSecret(suite, nextSecret(suite, secret))
+	if _, err := receiver.open(seal(next, 0x04, 2), 2, 2); err != nil {
+		t.Fatalf("open with updated keys: %v", err)
+	}
+	if receiver.keyPhaseBit() != 0x04 {
+		t.Errorf("key phase not updated after peer key update")
+	}
+	// A delayed packet from the previous phase can still be read.
+	if _, err := receiver.open(seal(sender.curW, 0, 1), 2, 1); err != nil {
+		t.Fatalf("open delayed packet with previous keys: %v", err)
+	}
+	// Our write keys are updated too.
+	if _, err := next.open(seal(receiver.curW, 0x04, 3), 2, 3); err != nil {
+		t.Fatalf("open packet sent with updated write keys: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quic implements the QUIC transport protocol, version 1, as
+// specified in RFC 9000, RFC 9001 and RFC 9002.
+//
+// It provides what HTTP/3 needs: reliable, flow-controlled bidirectional and
+// unidirectional streams over a TLS 1.3 secured connection. It does not
+// implement connection migration, 0-RTT, Retry or stateless resets, and
+// issues only a single connection ID.
+package quic
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A Config structure is used to configure a QUIC endpoint or connection.
+// A Config may be reused; the quic package will not modify it.
+type Config struct {
+	// TLSConfig is the TLS configuration. Its MinVersion is raised to TLS
+	// 1.3 if needed. It must be non-nil, and for servers must provide a
+	// certificate.
+	TLSConfig *tls.Config
+
+	// MaxBidiRemoteStreams limits the number of simultaneous bidirectional
+	// streams the peer may open. If zero, the default is 100.
+	MaxBidiRemoteStreams int64
+
+	// MaxUniRemoteStreams limits the number of simultaneous unidirectional
+	// streams the peer may open. If zero, the default is 100.
+	MaxUniRemoteStreams int64
+
+	// MaxStreamReadBufferSize is the maximum amount of data buffered for
+	// reading on a single stream, and the stream flow control window.
+	// If zero, the default is 1 MiB.
+	MaxStreamReadBufferSize int64
+
+	// MaxStreamWriteBufferSize is the maximum amount of data buffered for
+	// writing on a single stream before Write blocks.
+	// If zero, the default is 1 MiB.
+	MaxStreamWriteBufferSize int64
+
+	// MaxConnReadBufferSize is the connection flow control window, the
+	// maximum amount of data buffered for reading across all streams.
+	// If zero, the default is 1 MiB.
+	MaxConnReadBufferSize int64
+
+	// MaxIdleTimeout is the maximum time a connection may be idle before it
+	// is closed. The effective timeout is the smaller of this and the
+	// peer's. If zero, the default is 30 seconds. If negative, connections
+	// never time out.
+	MaxIdleTimeout time.Duration
+
+	// KeepAlivePeriod, if positive, is the interval at which PING frames
+	// are sent on an otherwise idle connection to keep it alive.
+	KeepAlivePeriod time.Duration
+
+	// HandshakeTimeout limits the time spent establishing a connection.
+	// If zero, the default is 10 seconds.
+	HandshakeTimeout time.Duration
+}
+
+func configDefault(v, def int64) int64 {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+func (c *Config) maxBidiRemoteStreams() int64 {
+	return configDefault(c.MaxBidiRemoteStreams, 100)
+}
+
+func (c *Config) maxUniRemoteStreams() int64 {
+	return configDefault(c.MaxUniRemoteStreams, 100)
+}
+
+func (c *Config) maxStreamReadBufferSize() int64 {
+	return configDefault(c.MaxStreamReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxStreamWriteBufferSize() int64 {
+	return configDefault(c.MaxStreamWriteBufferSize, 1<<20)
+}
+
+func (c *Config) maxConnReadBufferSize() int64 {
+	return configDefault(c.MaxConnReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxIdleTimeout() time.Duration {
+	switch {
+	case c.MaxIdleTimeout == 0:
+		return 30 * time.Second
+	case c.MaxIdleTimeout < 0:
+		return 0
+	}
+	return c.MaxIdleTimeout
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return c.HandshakeTimeout
+}
+
+// A TransportError is a QUIC transport error code, sent or received in a
+// CONNECTION_CLOSE frame. See RFC 9000, Section 20.1.
+type TransportError uint64
+
+const (
+	errNo                   TransportError = 0x0
+	errInternal             TransportError = 0x1
+	errConnectionRefused    TransportError = 0x2
+	errFlowControl          TransportError = 0x3
+	errStreamLimit          TransportError = 0x4
+	errStreamState          TransportError = 0x5
+	errFinalSize            TransportError = 0x6
+	errFrameEncoding        TransportError = 0x7
+	errTransportParameter   TransportError = 0x8
+	errConnectionIDLimit    TransportError = 0x9
+	errProtocolViolation    TransportError = 0xa
+	errInvalidToken         TransportError = 0xb
+	errApplicationError     TransportError = 0xc
+	errCryptoBufferExceeded TransportError = 0xd
+	errKeyUpdateError       TransportError = 0xe
+	errAEADLimitReached     TransportError = 0xf
+	errNoViablePath         TransportError = 0x10
+	errTLSBase              TransportError = 0x100 // 0x100-0x1ff; TLS alert codes
+)
+
+func (e TransportError) String() string {
+	switch e {
+	case errNo:
+		return "NO_ERROR"
+	case errInternal:
+		return "INTERNAL_ERROR"
+	case errConnectionRefused:
+		return "CONNECTION_REFUSED"
+	case errFlowControl:
+		return "FLOW_CONTROL_ERROR"
+	case errStreamLimit:
+		return "STREAM_LIMIT_ERROR"
+	case errStreamState:
+		return "STREAM_STATE_ERROR"
+	case errFinalSize:
+		return "FINAL_SIZE_ERROR"
+	case errFrameEncoding:
+		return "FRAME_ENCODING_ERROR"
+	case errTransportParameter:
+		return "TRANSPORT_PARAMETER_ERROR"
+	case errConnectionIDLimit:
+		return "CONNECTION_ID_LIMIT_ERROR"
+	case errProtocolViolation:
+		return "PROTOCOL_VIOLATION"
+	case errInvalidToken:
+		return "INVALID_TOKEN"
+	case errApplicationError:
+		return "APPLICATION_ERROR"
+	case errCryptoBufferExceeded:
+		return "CRYPTO_BUFFER_EXCEEDED"
+	case errKeyUpdateError:
+		return "KEY_UPDATE_ERROR"
+	case errAEADLimitReached:
+		return "AEAD_LIMIT_REACHED"
+	case errNoViablePath:
+		return "NO_VIABLE_PATH"
+	}
+	if e >= 0x100 && e <= 0x1ff {
+		return fmt.Sprintf("CRYPTO_ERROR(%v)", uint64(e)&0xff)
+	}
+	return fmt.Sprintf("ERROR %d", uint64(e))
+}
+
+func (e TransportError) Error() string {
+	return "quic: " + e.String()
+}
+
+// A localTransportError is a transport error detected locally, with an
+// explanation that is sent to the peer as the reason phrase.
+type localTransportError struct {
+	code   TransportError
+	reason string
+}
+
+func (e localTransportError) Error() string {
+	if e.reason == "" {
+		return e.code.Error()
+	}
+	return fmt.Sprintf("%v: %v", e.code, e.reason)
+}
+
+func (e localTransportError) Unwrap() error { return e.code }
+
+// A PeerTransportError is a transport error closing the connection, sent by
+// the peer.
+type PeerTransportError struct {
+	Code   TransportError
+	Reason string
+}
+
+func (e *PeerTransportError) Error() string {
+	return fmt.Sprintf("quic: peer closed connection: %v: %q", e.Code, e.Reason)
+}
+
+// An ApplicationError is an application protocol error code, sent or
+// received in a CONNECTION_CLOSE frame. See RFC 9000, Section 20.2.
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *ApplicationError) Error() string {
+	return fmt.Sprintf("quic: application error 0x%x: %q", e.Code, e.Reason)
+}
+
+// A StreamErrorCode is an application protocol error code, sent or received
+// in a RESET_STREAM or STOP_SENDING frame.
+type StreamErrorCode uint64
+
+func (e StreamErrorCode) Error() string {
+	return fmt.Sprintf("quic: stream error code 0x%x", uint64(e))
+}
+
+// errIdleTimeout is returned when a connection is closed due to inactivity.
+var errIdleTimeout = idleTimeoutError{}
+
+type idleTimeoutError struct{}
+
+func (idleTimeoutError) Error() string   { return "quic: connection closed after idle timeout" }
+func (idleTimeoutError) Timeout() bool   { return true }
+func (idleTimeoutError) Temporary() bool { return false }
+
+// errConnClosed is returned by operations on a connection that was closed
+// locally.
+var errConnClosed = errors.New("quic: connection closed")
+
+// errEndpointClosed is returned by operations on a closed Endpoint.
+var errEndpointClosed = errors.New("quic: endpoint closed")
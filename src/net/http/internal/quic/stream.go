@@ -0,0 +1,381 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// A streamID is a QUIC stream ID. The low two bits encode the initiator and
+// the stream type. See RFC 9000, Section 2.1.
+type streamID uint64
+
+type streamType int
+
+const (
+	bidiStream streamType = 0
+	uniStream  streamType = 1
+)
+
+func newStreamID(initiator connSide, typ streamType, num int64) streamID {
+	return streamID(num<<2 | int64(typ)<<1 | int64(initiator))
+}
+
+func (id streamID) initiator() connSide    { return connSide(id & 1) }
+func (id streamID) streamType() streamType { return streamType(id >> 1 & 1) }
+func (id streamID) num() int64             { return int64(id >> 2) }
+
+// A Stream is an ordered byte stream within a QUIC connection.
+//
+// Stream methods may be called concurrently with each other, but Read and
+// Write are not safe for concurrent use with themselves.
+type Stream struct {
+	id   streamID
+	conn *Conn
+
+	// All fields below are guarded by conn.mu.
+
+	readCtx  context.Context
+	writeCtx context.Context
+
+	// Receive side.
+	hasRecv         bool
+	recv            recvBuffer
+	recvMax         int64 // flow control limit we have sent
+	recvHighest     int64 // largest offset received
+	finalSize       int64 // -1 until known
+	resetCode       int64 // RESET_STREAM code received, or -1
+	readClosed      bool  // CloseRead called, or all data read
+	stopSending     int64 // STOP_SENDING code to send, or -1
+	stopSendingSent bool
+	needMaxData     bool // MAX_STREAM_DATA must be sent
+
+	// Send side.
+	hasSend       bool
+	send          sendBuffer
+	sendMax       int64 // peer's flow control limit
+	writeClosed   bool  // CloseWrite or Reset called
+	finSent       bool
+	finAcked      bool
+	resetSendCode int64 // RESET_STREAM code to send, or -1
+	resetSent     bool
+	resetAcked    bool
+	stopRecvd     int64 // STOP_SENDING code received, or -1
+	inSendQueue   bool
+	sendFinalSize int64 // final size, once writeClosed
+
+	readNotify  chan struct{}
+	writeNotify chan struct{}
+	removed     bool
+}
+
+func newStream(c *Conn, id streamID) *Stream {
+	s := &Stream{
+		id:            id,
+		conn:          c,
+		readCtx:       context.Background(),
+		writeCtx:      context.Background(),
+		finalSize:     -1,
+		resetCode:     -1,
+		stopSending:   -1,
+		resetSendCode: -1,
+		stopRecvd:     -1,
+		readNotify:    make(chan struct{}, 1),
+		writeNotify:   make(chan struct{}, 1),
+	}
+	local := id.initiator() == c.side
+	s.hasRecv = id.streamType() == bidiStream || !local
+	s.hasSend = id.streamType() == bidiStream || local
+	if s.hasRecv {
+		s.recvMax = c.config.maxStreamReadBufferSize()
+	}
+	if s.hasSend {
+		switch {
+		case id.streamType() == uniStream:
+			s.sendMax = c.peerParams.initialMaxStreamDataUni
+		case local:
+			s.sendMax = c.peerParams.initialMaxStreamDataBidiRemote
+		default:
+			s.sendMax = c.peerParams.initialMaxStreamDataBidiLocal
+		}
+	}
+	return s
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// ID returns the QUIC stream ID of s.
+func (s *Stream) ID() int64 {
+	return int64(s.id)
+}
+
+// IsReadOnly reports whether s is a unidirectional stream opened by the peer.
+func (s *Stream) IsReadOnly() bool {
+	return !s.hasSend
+}
+
+// IsWriteOnly reports whether s is a unidirectional stream opened locally.
+func (s *Stream) IsWriteOnly() bool {
+	return !s.hasRecv
+}
+
+// SetReadContext sets the context used by Read. A Read blocked waiting for
+// data returns ctx.Err() when ctx is done.
+func (s *Stream) SetReadContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.readCtx = ctx
+	s.conn.mu.Unlock()
+	notify(s.readNotify)
+}
+
+// SetWriteContext sets the context used by Write. A Write blocked waiting
+// for buffer space returns ctx.Err() when ctx is done.
+func (s *Stream) SetWriteContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.writeCtx = ctx
+	s.conn.mu.Unlock()
+	notify(s.writeNotify)
+}
+
+var (
+	errReadOnlyStream  = errors.New("quic: write to read-only stream")
+	errWriteOnlyStream = errors.New("quic: read from write-only stream")
+	errStreamClosed    = errors.New("quic: use of closed stream")
+)
+
+// Read reads data from the stream. It returns io.EOF once the peer has
+// finished sending and all data has been read, and a StreamErrorCode if the
+// peer reset the stream.
+func (s *Stream) Read(b []byte) (int, error) {
+	if !s.hasRecv {
+		return 0, errWriteOnlyStream
+	}
+	c := s.conn
+	c.mu.Lock()
+	for {
+		if s.readClosed && s.resetCode < 0 && !s.allRead() {
+			c.mu.Unlock()
+			return 0, errStreamClosed
+		}
+		if data := s.recv.readable(); len(data) > 0 && s.resetCode < 0 {
+			if len(b) == 0 {
+				c.mu.Unlock()
+				return 0, nil
+			}
+			n := copy(b, data)
+			s.recv.consume(n)
+			c.streamDataConsumed(s, n)
+			c.mu.Unlock()
+			return n, nil
+		}
+		if s.resetCode >= 0 {
+			c.mu.Unlock()
+			return 0, StreamErrorCode(s.resetCode)
+		}
+		if s.allRead() {
+			if !s.readClosed {
+				s.readClosed = true
+				c.checkStreamDone(s)
+			}
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		if c.closeErr != nil {
+			err := c.closeErr
+			c.mu.Unlock()
+			return 0, err
+		}
+		ctx := s.readCtx
+		c.mu.Unlock()
+		select {
+		case <-s.readNotify:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+}
+
+// allRead reports whether all data up to the final size has been read.
+func (s *Stream) allRead() bool {
+	return s.finalSize >= 0 && s.recv.off == s.finalSize
+}
+
+// allReceived reports whether all data up to the final size has been
+// received.
+func (s *Stream) allReceived() bool {
+	if s.finalSize < 0 {
+		return false
+	}
+	return s.recv.off == s.finalSize || s.recv.have.isrange(s.recv.off, s.finalSize)
+}
+
+// Write writes data to the stream. It blocks while the stream's write
+// buffer is full.
+func (s *Stream) Write(b []byte) (n int, err error) {
+	if !s.hasSend {
+		return 0, errReadOnlyStream
+	}
+	c := s.conn
+	max := int(c.config.maxStreamWriteBufferSize())
+	c.mu.Lock()
+	for len(b) > 0 {
+		if s.stopRecvd >= 0 {
+			err = StreamErrorCode(s.stopRecvd)
+			break
+		}
+		if s.writeClosed {
+			err = errStreamClosed
+			break
+		}
+		if c.closeErr != nil {
+			err = c.closeErr
+			break
+		}
+		room := max - len(s.send.buf)
+		if room <= 0 {
+			ctx := s.writeCtx
+			c.mu.Unlock()
+			select {
+			case <-s.writeNotify:
+			case <-ctx.Done():
+				return n, ctx.Err()
+			}
+			c.mu.Lock()
+			continue
+		}
+		if room > len(b) {
+			room = len(b)
+		}
+		s.send.write(b[:room])
+		b = b[room:]
+		n += room
+		c.queueStream(s)
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// CloseWrite closes the write side of the stream, sending a FIN to the
+// peer after all written data.
+func (s *Stream) CloseWrite() {
+	if !s.hasSend {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.writeClosed {
+		return
+	}
+	s.writeClosed = true
+	s.sendFinalSize = s.send.end()
+	c.queueStream(s)
+}
+
+// CloseRead aborts the read side of the stream, discarding any buffered
+// data and asking the peer to stop sending with the given error code.
+// It does nothing if all data has already been received.
+func (s *Stream) CloseRead(code uint64) {
+	if !s.hasRecv {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.readClosed {
+		return
+	}
+	s.readClosed = true
+	if s.resetCode < 0 && !s.allReceived() {
+		s.stopSending = int64(code)
+		c.queueStream(s)
+	}
+	s.needMaxData = false
+	n := len(s.recv.buf)
+	s.recv.discard()
+	c.streamDataConsumed(s, n)
+	c.checkStreamDone(s)
+	notify(s.readNotify)
+}
+
+// Reset aborts the write side of the stream, discarding unsent data and
+// sending the peer a RESET_STREAM frame with the given error code.
+func (s *Stream) Reset(code uint64) {
+	if !s.hasSend {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.resetLocked(code)
+}
+
+func (s *Stream) resetLocked(code uint64) {
+	if s.resetSendCode >= 0 || s.finAcked {
+		return
+	}
+	s.writeClosed = true
+	s.resetSendCode = int64(code)
+	// The final size is the amount of flow control credit consumed.
+	s.sendFinalSize = s.send.next
+	s.send.discard()
+	s.conn.queueStream(s)
+	notify(s.writeNotify)
+}
+
+// Close closes the stream. The write side is closed as if by CloseWrite,
+// and if unread data remains the read side is closed as if by CloseRead
+// with error code 0.
+func (s *Stream) Close() error {
+	s.CloseWrite()
+	s.CloseRead(0)
+	return nil
+}
+
+// sendDone reports whether the send side needs no further frames sent or
+// acknowledged.
+func (s *Stream) sendDone() bool {
+	return !s.hasSend || s.resetAcked || s.finAcked && len(s.send.buf) == 0
+}
+
+// recvDone reports whether the receive side is finished from our side.
+func (s *Stream) recvDone() bool {
+	if !s.hasRecv {
+		return true
+	}
+	if s.stopSending >= 0 && !s.stopSendingSent {
+		return false
+	}
+	if s.needMaxData {
+		return false
+	}
+	return s.readClosed || (s.resetCode >= 0 && s.finalSize >= 0)
+}
+
+// hasFramesToSend reports whether s has anything to send in a packet,
+// ignoring congestion and flow control.
+func (s *Stream) hasFramesToSend() bool {
+	if s.stopSending >= 0 && !s.stopSendingSent {
+		return true
+	}
+	if s.needMaxData {
+		return true
+	}
+	if s.resetSendCode >= 0 {
+		return !s.resetSent
+	}
+	if s.send.hasData() {
+		return true
+	}
+	return s.writeClosed && !s.finSent
+}
@@ -0,0 +1,245 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "time"
+
+// transportParameters are the QUIC transport parameters exchanged during the
+// handshake. See RFC 9000, Section 18.
+type transportParameters struct {
+	originalDstConnID              []byte
+	maxIdleTimeout                 time.Duration
+	statelessResetToken            []byte
+	maxUDPPayloadSize              int64
+	initialMaxData                 int64
+	initialMaxStreamDataBidiLocal  int64
+	initialMaxStreamDataBidiRemote int64
+	initialMaxStreamDataUni        int64
+	initialMaxStreamsBidi          int64
+	initialMaxStreamsUni           int64
+	ackDelayExponent               int8
+	maxAckDelay                    time.Duration
+	disableActiveMigration         bool
+	preferredAddrPresent           bool
+	activeConnIDLimit              int64
+	initialSrcConnID               []byte
+	retrySrcConnID                 []byte
+}
+
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+)
+
+// maxStreamsLimit is the largest permitted stream count. See RFC 9000,
+// Section 4.6.
+const maxStreamsLimit = 1 << 60
+
+func defaultTransportParameters() transportParameters {
+	return transportParameters{
+		maxUDPPayloadSize: 65527,
+		ackDelayExponent:  3,
+		maxAckDelay:       25 * time.Millisecond,
+		activeConnIDLimit: 2,
+	}
+}
+
+func appendParam(b []byte, id uint64, v []byte) []byte {
+	b = appendVarint(b, id)
+	return appendVarintBytes(b, v)
+}
+
+func appendIntParam(b []byte, id uint64, v int64) []byte {
+	b = appendVarint(b, id)
+	b = appendVarint(b, uint64(sizeVarint(uint64(v))))
+	return appendVarint(b, uint64(v))
+}
+
+// marshal encodes the parameters, omitting those with default values.
+func (p *transportParameters) marshal() []byte {
+	d := defaultTransportParameters()
+	var b []byte
+	if p.originalDstConnID != nil {
+		b = appendParam(b, paramOriginalDestinationConnectionID, p.originalDstConnID)
+	}
+	if p.maxIdleTimeout != 0 {
+		b = appendIntParam(b, paramMaxIdleTimeout, p.maxIdleTimeout.Milliseconds())
+	}
+	if p.statelessResetToken != nil {
+		b = appendParam(b, paramStatelessResetToken, p.statelessResetToken)
+	}
+	if p.maxUDPPayloadSize != d.maxUDPPayloadSize {
+		b = appendIntParam(b, paramMaxUDPPayloadSize, p.maxUDPPayloadSize)
+	}
+	for _, v := range []struct {
+		id  uint64
+		val int64
+	}{
+		{paramInitialMaxData, p.initialMaxData},
+		{paramInitialMaxStreamDataBidiLocal, p.initialMaxStreamDataBidiLocal},
+		{paramInitialMaxStreamDataBidiRemote, p.initialMaxStreamDataBidiRemote},
+		{paramInitialMaxStreamDataUni, p.initialMaxStreamDataUni},
+		{paramInitialMaxStreamsBidi, p.initialMaxStreamsBidi},
+		{paramInitialMaxStreamsUni, p.initialMaxStreamsUni},
+	} {
+		if v.val != 0 {
+			b = appendIntParam(b, v.id, v.val)
+		}
+	}
+	if p.ackDelayExponent != d.ackDelayExponent {
+		b = appendIntParam(b, paramAckDelayExponent, int64(p.ackDelayExponent))
+	}
+	if p.maxAckDelay != d.maxAckDelay {
+		b = appendIntParam(b, paramMaxAckDelay, p.maxAckDelay.Milliseconds())
+	}
+	if p.disableActiveMigration {
+		b = appendParam(b, paramDisableActiveMigration, nil)
+	}
+	if p.activeConnIDLimit != d.activeConnIDLimit {
+		b = appendIntParam(b, paramActiveConnectionIDLimit, p.activeConnIDLimit)
+	}
+	if p.initialSrcConnID != nil {
+		b = appendParam(b, paramInitialSourceConnectionID, p.initialSrcConnID)
+	}
+	if p.retrySrcConnID != nil {
+		b = appendParam(b, paramRetrySourceConnectionID, p.retrySrcConnID)
+	}
+	return b
+}
+
+// unmarshalTransportParameters decodes and validates transport parameters
+// sent by a peer. fromServer reports whether the peer is a server.
+func unmarshalTransportParameters(b []byte, fromServer bool) (transportParameters, error) {
+	p := defaultTransportParameters()
+	seen := make(map[uint64]bool)
+	fail := func(reason string) (transportParameters, error) {
+		return p, localTransportError{code: errTransportParameter, reason: reason}
+	}
+	for len(b) > 0 {
+		id, n := consumeVarint(b)
+		if n < 0 {
+			return fail("malformed transport parameters")
+		}
+		b = b[n:]
+		val, n := consumeVarintBytes(b)
+		if n < 0 {
+			return fail("malformed transport parameters")
+		}
+		b = b[n:]
+		if seen[id] {
+			return fail("duplicate transport parameter")
+		}
+		seen[id] = true
+
+		var intVal int64
+		switch id {
+		case paramMaxIdleTimeout, paramMaxUDPPayloadSize, paramInitialMaxData,
+			paramInitialMaxStreamDataBidiLocal, paramInitialMaxStreamDataBidiRemote,
+			paramInitialMaxStreamDataUni, paramInitialMaxStreamsBidi,
+			paramInitialMaxStreamsUni, paramAckDelayExponent, paramMaxAckDelay,
+			paramActiveConnectionIDLimit:
+			v, n := consumeVarintInt64(val)
+			if n != len(val) {
+				return fail("malformed integer transport parameter")
+			}
+			intVal = v
+		}
+
+		switch id {
+		case paramOriginalDestinationConnectionID:
+			if !fromServer {
+				return fail("client sent original_destination_connection_id")
+			}
+			p.originalDstConnID = val
+		case paramMaxIdleTimeout:
+			p.maxIdleTimeout = time.Duration(intVal) * time.Millisecond
+		case paramStatelessResetToken:
+			if !fromServer || len(val) != 16 {
+				return fail("invalid stateless_reset_token")
+			}
+			p.statelessResetToken = val
+		case paramMaxUDPPayloadSize:
+			if intVal < 1200 {
+				return fail("max_udp_payload_size too small")
+			}
+			p.maxUDPPayloadSize = intVal
+		case paramInitialMaxData:
+			p.initialMaxData = intVal
+		case paramInitialMaxStreamDataBidiLocal:
+			p.initialMaxStreamDataBidiLocal = intVal
+		case paramInitialMaxStreamDataBidiRemote:
+			p.initialMaxStreamDataBidiRemote = intVal
+		case paramInitialMaxStreamDataUni:
+			p.initialMaxStreamDataUni = intVal
+		case paramInitialMaxStreamsBidi:
+			if intVal > maxStreamsLimit {
+				return fail("initial_max_streams_bidi too large")
+			}
+			p.initialMaxStreamsBidi = intVal
+		case paramInitialMaxStreamsUni:
+			if intVal > maxStreamsLimit {
+				return fail("initial_max_streams_uni too large")
+			}
+			p.initialMaxStreamsUni = intVal
+		case paramAckDelayExponent:
+			if intVal > 20 {
+				return fail("ack_delay_exponent too large")
+			}
+			p.ackDelayExponent = int8(intVal)
+		case paramMaxAckDelay:
+			if intVal >= 1<<14 {
+				return fail("max_ack_delay too large")
+			}
+			p.maxAckDelay = time.Duration(intVal) * time.Millisecond
+		case paramDisableActiveMigration:
+			if len(val) != 0 {
+				return fail("invalid disable_active_migration")
+			}
+			p.disableActiveMigration = true
+		case paramPreferredAddress:
+			if !fromServer {
+				return fail("client sent preferred_address")
+			}
+			// We do not migrate, so the address itself is ignored.
+			p.preferredAddrPresent = true
+		case paramActiveConnectionIDLimit:
+			if intVal < 2 {
+				return fail("active_connection_id_limit too small")
+			}
+			p.activeConnIDLimit = intVal
+		case paramInitialSourceConnectionID:
+			p.initialSrcConnID = val
+		case paramRetrySourceConnectionID:
+			if !fromServer {
+				return fail("client sent retry_source_connection_id")
+			}
+			p.retrySrcConnID = val
+		default:
+			// Unknown parameters are ignored. See RFC 9000, Section 7.4.2.
+		}
+	}
+	if p.initialSrcConnID == nil {
+		return fail("missing initial_source_connection_id")
+	}
+	if fromServer && p.originalDstConnID == nil {
+		return fail("missing original_destination_connection_id")
+	}
+	return p, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// maxVarint is the largest value representable as a variable-length integer.
+const maxVarint = (1 << 62) - 1
+
+// consumeVarint parses a variable-length integer, returning its value and
+// encoded length. It returns a negative length if b is too short.
+// See RFC 9000, Section 16.
+func consumeVarint(b []byte) (v uint64, n int) {
+	if len(b) < 1 {
+		return 0, -1
+	}
+	n = 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v = uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// consumeVarintInt64 is consumeVarint returning an int64.
+func consumeVarintInt64(b []byte) (v int64, n int) {
+	u, n := consumeVarint(b)
+	// QUIC varints are 62 bits, so they always fit.
+	return int64(u), n
+}
+
+// appendVarint appends v as a variable-length integer.
+// It panics if v does not fit in 62 bits.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 63:
+		return append(b, byte(v))
+	case v <= 16383:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v <= 1073741823:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case v <= maxVarint:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	panic("quic: varint too large")
+}
+
+// sizeVarint returns the encoded length of v.
+func sizeVarint(v uint64) int {
+	switch {
+	case v <= 63:
+		return 1
+	case v <= 16383:
+		return 2
+	case v <= 1073741823:
+		return 4
+	case v <= maxVarint:
+		return 8
+	}
+	panic("quic: varint too large")
+}
+
+// consumeVarintBytes parses a varint length-prefixed byte slice.
+func consumeVarintBytes(b []byte) ([]byte, int) {
+	size, n := consumeVarint(b)
+	if n < 0 || size > uint64(len(b)-n) {
+		return nil, -1
+	}
+	return b[n : n+int(size)], n + int(size)
+}
+
+// appendVarintBytes appends a varint length-prefixed byte slice.
+func appendVarintBytes(b, v []byte) []byte {
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// consumeUint8Bytes parses a uint8 length-prefixed byte slice.
+func consumeUint8Bytes(b []byte) ([]byte, int) {
+	if len(b) < 1 || int(b[0]) > len(b)-1 {
+		return nil, -1
+	}
+	return b[1 : 1+int(b[0])], 1 + int(b[0])
+}
+
+// appendUint8Bytes appends a uint8 length-prefixed byte slice.
+func appendUint8Bytes(b, v []byte) []byte {
+	b = append(b, byte(len(v)))
+	return append(b, v...)
+}
+
+// A rangeset is a set of int64s, stored as an ordered list of
+// non-overlapping, non-adjacent half-open intervals.
+type rangeset []i64range
+
+type i64range struct {
+	start, end int64 // [start, end)
+}
+
+func (r i64range) size() int64 { return r.end - r.start }
+
+// add adds [start, end) to the set.
+func (s *rangeset) add(start, end int64) {
+	if start >= end {
+		return
+	}
+	rs := *s
+	// Find the first range that ends at or after start.
+	i := 0
+	for i < len(rs) && rs[i].end < start {
+		i++
+	}
+	if i == len(rs) || rs[i].start > end {
+		// No overlap; insert a new range.
+		rs = append(rs, i64range{})
+		copy(rs[i+1:], rs[i:])
+		rs[i] = i64range{start, end}
+		*s = rs
+		return
+	}
+	// Merge with rs[i] and any following ranges it now touches.
+	if start < rs[i].start {
+		rs[i].start = start
+	}
+	j := i + 1
+	for j < len(rs) && rs[j].start <= end {
+		j++
+	}
+	if rs[j-1].end > end {
+		end = rs[j-1].end
+	}
+	if end > rs[i].end {
+		rs[i].end = end
+	}
+	rs = append(rs[:i+1], rs[j:]...)
+	*s = rs
+}
+
+// sub removes [start, end) from the set.
+func (s *rangeset) sub(start, end int64) {
+	if start >= end {
+		return
+	}
+	rs := *s
+	var out rangeset
+	for _, r := range rs {
+		if r.end <= start || r.start >= end {
+			out = append(out, r)
+			continue
+		}
+		if r.start < start {
+			out = append(out, i64range{r.start, start})
+		}
+		if r.end > end {
+			out = append(out, i64range{end, r.end})
+		}
+	}
+	*s = out
+}
+
+// contains reports whether v is in the set.
+func (s rangeset) contains(v int64) bool {
+	for _, r := range s {
+		if v < r.start {
+			return false
+		}
+		if v < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeContaining returns the range containing v, or the zero range.
+func (s rangeset) rangeContaining(v int64) i64range {
+	for _, r := range s {
+		if v >= r.start && v < r.end {
+			return r
+		}
+	}
+	return i64range{}
+}
+
+// min returns the smallest value in the set, or 0 if it is empty.
+func (s rangeset) min() int64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[0].start
+}
+
+// max returns the largest value in the set, or -1 if it is empty.
+func (s rangeset) max() int64 {
+	if len(s) == 0 {
+		return -1
+	}
+	return s[len(s)-1].end - 1
+}
+
+// isrange reports whether the set is exactly [start, end).
+func (s rangeset) isrange(start, end int64) bool {
+	switch len(s) {
+	case 0:
+		return start == end
+	case 1:
+		return s[0].start == start && s[0].end == end
+	}
+	return false
+}
+
+// removeBefore removes all values less than v from the set.
+func (s *rangeset) removeBefore(v int64) {
+	rs := *s
+	for len(rs) > 0 && rs[0].end <= v {
+		rs = rs[1:]
+	}
+	if len(rs) > 0 && rs[0].start < v {
+		rs[0].start = v
+	}
+	*s = rs
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVarint(t *testing.T) {
+	// Examples from RFC 9000, Appendix A.1.
+	for _, test := range []struct {
+		b string
+		v uint64
+	}{
+		{"c2197c5eff14e88c", 151288809941952652},
+		{"9d7f3e7d", 494878333},
+		{"7bbd", 15293},
+		{"25", 37},
+	} {
+		v, n := consumeVarint(unhex(test.b))
+		if v != test.v || n != len(test.b)/2 {
+			t.Errorf("consumeVarint(%v) = %v, %v; want %v, %v", test.b, v, n, test.v, len(test.b)/2)
+		}
+		if got := appendVarint(nil, test.v); !bytes.Equal(got, unhex(test.b)) {
+			t.Errorf("appendVarint(%v) = %x, want %v", test.v, got, test.b)
+		}
+		if got, want := sizeVarint(test.v), len(test.b)/2; got != want {
+			t.Errorf("sizeVarint(%v) = %v, want %v", test.v, got, want)
+		}
+	}
+	// The two-byte encoding of 37 is also valid.
+	if v, n := consumeVarint(unhex("4025")); v != 37 || n != 2 {
+		t.Errorf("consumeVarint(4025) = %v, %v; want 37, 2", v, n)
+	}
+	if _, n := consumeVarint(unhex("c2197c")); n != -1 {
+		t.Errorf("consumeVarint of truncated input = %v, want -1", n)
+	}
+}
+
+func TestRangeset(t *testing.T) {
+	var s rangeset
+	s.add(10, 20)
+	s.add(30, 40)
+	s.add(20, 25) // adjacent, merged
+	s.add(0, 5)
+	want := rangeset{{0, 5}, {10, 25}, {30, 40}}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("after adds: %v, want %v", s, want)
+	}
+	s.add(4, 31)
+	if want := (rangeset{{0, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after merging add: %v, want %v", s, want)
+	}
+	s.sub(10, 20)
+	if want := (rangeset{{0, 10}, {20, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after sub: %v, want %v", s, want)
+	}
+	if !s.contains(9) || s.contains(10) || !s.contains(20) || s.contains(40) {
+		t.Errorf("contains gives wrong results for %v", s)
+	}
+	if s.min() != 0 || s.max() != 39 {
+		t.Errorf("min, max = %v, %v; want 0, 39", s.min(), s.max())
+	}
+	s.removeBefore(25)
+	if !s.isrange(25, 40) {
+		t.Errorf("after removeBefore(25): %v, want [25, 40)", s)
+	}
+}
+
+func TestAckFrame(t *testing.T) {
+	var seen rangeset
+	seen.add(0, 3)
+	seen.add(5, 6)
+	seen.add(10, 20)
+	b := appendAckFrame(nil, seen, 800*time.Microsecond, 10)
+	if b[0] != frameTypeAck {
+		t.Fatalf("frame type = %x, want %x", b[0], frameTypeAck)
+	}
+	acked, delay, n := parseAckFrame(b[1:], frameTypeAck)
+	if n != len(b)-1 {
+		t.Fatalf("parsed %v bytes of %v", n, len(b)-1)
+	}
+	if !reflect.DeepEqual(acked, seen) {
+		t.Errorf("acked = %v, want %v", acked, seen)
+	}
+	if want := uint64(800 >> ackDelayExponent); delay != want {
+		t.Errorf("delay = %v, want %v", delay, want)
+	}
+
+	// Only the largest ranges are sent when limited.
+	b = appendAckFrame(nil, seen, 0, 2)
+	acked, _, _ = parseAckFrame(b[1:], frameTypeAck)
+	if want := (rangeset{{5, 6}, {10, 20}}); !reflect.DeepEqual(acked, want) {
+		t.Errorf("limited acked = %v, want %v", acked, want)
+	}
+}
+
+func TestTransportParameters(t *testing.T) {
+	p := defaultTransportParameters()
+	p.originalDstConnID = []byte{1, 2, 3, 4}
+	p.maxIdleTimeout = 30 * time.Second
+	p.statelessResetToken = bytes.Repeat([]byte{9}, 16)
+	p.maxUDPPayloadSize = 1500
+	p.initialMaxData = 1 << 20
+	p.initialMaxStreamDataBidiLocal = 1 << 16
+	p.initialMaxStreamDataBidiRemote = 1 << 17
+	p.initialMaxStreamDataUni = 1 << 18
+	p.initialMaxStreamsBidi = 100
+	p.initialMaxStreamsUni = 3
+	p.maxAckDelay = 50 * time.Millisecond
+	p.disableActiveMigration = true
+	p.initialSrcConnID = []byte{5, 6, 7, 8}
+	got, err := unmarshalTransportParameters(p.marshal(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, p)
+	}
+
+	// Clients may not send server-only parameters.
+	if _, err := unmarshalTransportParameters(p.marshal(), false); err == nil {
+		t.Errorf("client parameters with original_destination_connection_id accepted")
+	}
+	p.originalDstConnID = nil
+	p.statelessResetToken = nil
+	if _, err := unmarshalTransportParameters(p.marshal(), false); err != nil {
+		t.Errorf("valid client parameters rejected: %v", err)
+	}
+	p.initialSrcConnID = nil
+	if _, err := unmarshalTransportParameters(p.marshal(), false); err == nil {
+		t.Errorf("parameters without initial_source_connection_id accepted")
+	}
+	dup := appendIntParam(appendIntParam(nil, paramInitialMaxData, 1), paramInitialMaxData, 2)
+	dup = appendParam(dup, paramInitialSourceConnectionID, []byte{1})
+	if _, err := unmarshalTransportParameters(dup, false); err == nil {
+		t.Errorf("duplicate parameter accepted")
+	}
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	// Example from RFC 9000, Appendix A.3.
+	if got := decodePacketNumber(0xa82f30ea, 0x9b32, 2); got != 0xa82f9b32 {
+		t.Errorf("decodePacketNumber = %x, want a82f9b32", got)
+	}
+	for _, test := range []struct {
+		pnum, largestAcked int64
+		want               int
+	}{
+		{0, -1, 1},
+		{0x7e, -1, 1},
+		{0xac5c02, 0xabe8b3, 2},
+		{0xace8fe, 0xabe8b3, 3},
+	} {
+		if got := packetNumberLength(test.pnum, test.largestAcked); got != test.want {
+			t.Errorf("packetNumberLength(%x, %x) = %v, want %v", test.pnum, test.largestAcked, got, test.want)
+		}
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	var r recvBuffer
+	r.write(5, []byte("world"))
+	if got := r.readable(); got != nil {
+		t.Fatalf("readable with gap = %q, want nil", got)
+	}
+	r.write(0, []byte("hello"))
+	r.write(3, []byte("lo"))
+	if got := string(r.readable()); got != "helloworld" {
+		t.Fatalf("readable = %q, want %q", got, "helloworld")
+	}
+	r.consume(5)
+	if got := string(r.readable()); got != "world" {
+		t.Fatalf("after consume, readable = %q, want %q", got, "world")
+	}
+
+	var s sendBuffer
+	s.write([]byte("0123456789"))
+	off, data, isNew := s.nextData(4, 100)
+	if off != 0 || string(data) != "0123" || !isNew {
+		t.Fatalf("nextData = %v, %q, %v", off, data, isNew)
+	}
+	s.sent(0, 4)
+	off, data, _ = s.nextData(100, 8)
+	if off != 4 || string(data) != "4567" {
+		t.Fatalf("flow-limited nextData = %v, %q", off, data)
+	}
+	s.sent(4, 4)
+	s.lose(0, 4)
+	s.ack(2, 2) // partially acknowledged by a retransmission
+	off, data, isNew = s.nextData(100, 100)
+	if off != 0 || string(data) != "01" || isNew {
+		t.Fatalf("retransmit nextData = %v, %q, %v", off, data, isNew)
+	}
+	s.sent(0, 2)
+	s.ack(0, 2)
+	if s.off != 4 {
+		t.Fatalf("after acks, off = %v, want 4", s.off)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoutingFirstSegment(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+	}{
+		{"/a/b/c", []string{"a", "b", "c"}},
+		{"/a/b/", []string{"a", "b", "/"}},
+		{"/", []string{"/"}},
+		{"/a/%62/c", []string{"a", "b", "c"}},
+		{"/a%2Fb%2fc", []string{"a/b/c"}},
+	} {
+		var got []string
+		rest := test.in
+		for len(rest) > 0 {
+			var seg string
+			seg, rest = firstSegment(rest)
+			got = append(got, seg)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func getTestTree(t *testing.T) *routingNode {
+	root := &routingNode{}
+	for _, p := range []string{
+		"/a",
+		"/a/b",
+		"/a/{x}",
+		"/g/h/i",
+		"/g/{x}/j",
+		"/a/b/{x...}",
+		"/a/b/{y}",
+		"/a/b/{$}",
+
+		"GET /m/",
+		"POST /m/",
+		"GET /h",
+		"POST /h",
+		"GET /h/{a}/{b}",
+
+		"example.com/",
+		"example.com/a",
+		"example.com/a/{$}",
+		"example.com/b/{x...}",
+	} {
+		root.addPattern(mustParsePattern(t, p), nil)
+	}
+	return root
+}
+
+func TestRoutingNodeMatch(t *testing.T) {
+	root := getTestTree(t)
+
+	for _, test := range []struct {
+		host, method, path string
+		wantPat            string // "" for nil (no match)
+		wantMatches        []string
+	}{
+		{"", "GET", "/a", "/a", nil},
+		{"", "GET", "/m/b", "GET /m/", nil},
+		{"", "HEAD", "/m/b", "GET /m/", nil},
+		{"", "POST", "/m/b", "POST /m/", nil},
+		{"", "PUT", "/m/b", "", nil},
+		{"", "GET", "/b", "", nil},
+		{"", "GET", "/a/b", "/a/b", nil},
+		{"", "GET", "/a/c", "/a/{x}", []string{"c"}},
+		{"", "GET", "/a/b/", "/a/b/{$}", nil},
+		{"", "GET", "/a/b/c", "/a/b/{y}", []string{"c"}},
+		{"", "GET", "/a/b/c/d", "/a/b/{x...}", []string{"c/d"}},
+		{"", "GET", "/g/h/i", "/g/h/i", nil},
+		{"", "GET", "/g/h/j", "/g/{x}/j", []string{"h"}},
+		{"", "GET", "/h/x/y", "GET /h/{a}/{b}", []string{"x", "y"}},
+		{"", "POST", "/h", "POST /h", nil},
+		{"", "HEAD", "/h", "GET /h", nil},
+
+		{"example.com", "GET", "/", "example.com/", nil},
+		{"example.com", "GET", "/a", "example.com/a", nil},
+		{"example.com", "GET", "/a/", "example.com/a/{$}", nil},
+		{"example.com", "GET", "/b/c/d", "example.com/b/{x...}", []string{"c/d"}},
+		{"example.com", "GET", "/b/a%2fb", "example.com/b/{x...}", []string{"a/b"}},
+		{"example.com", "GET", "/c", "example.com/", nil},
+		{"other.com", "GET", "/a/c", "/a/{x}", []string{"c"}},
+	} {
+		n, gotMatches := root.match(test.host, test.method, test.path)
+		got := ""
+		if n != nil {
+			got = n.pattern.String()
+		}
+		if got != test.wantPat {
+			t.Errorf("%s %s %s: got pattern %q, want %q", test.host, test.method, test.path, got, test.wantPat)
+			continue
+		}
+		if !reflect.DeepEqual(gotMatches, test.wantMatches) {
+			t.Errorf("%s %s %s: got matches %q, want %q", test.host, test.method, test.path, gotMatches, test.wantMatches)
+		}
+	}
+}
+
+func TestRoutingMatchingMethods(t *testing.T) {
+	hostTree := &routingNode{}
+	for _, p := range []string{
+		"GET a.com/",
+		"PUT b.com/",
+		"POST /foo/{x}",
+	} {
+		hostTree.addPattern(mustParsePattern(t, p), nil)
+	}
+
+	for _, test := range []struct {
+		name       string
+		tree       *routingNode
+		host, path string
+		want       string
+	}{
+		{"post", getTestTree(t), "", "/m/foo", "GET,HEAD,POST"},
+		{"get", getTestTree(t), "", "/h/x/y", "GET,HEAD"},
+		{"host-get", hostTree, "a.com", "/", "GET,HEAD"},
+		{"host-put", hostTree, "b.com", "/", "PUT"},
+		{"host-none", hostTree, "c.com", "/", ""},
+		{"host-path", hostTree, "a.com", "/foo/bar", "GET,HEAD,POST"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ms := map[string]bool{}
+			test.tree.matchingMethods(test.host, test.path, ms)
+			got := ""
+			for i, m := range sortedKeys(ms) {
+				if i > 0 {
+					got += ","
+				}
+				got += m
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
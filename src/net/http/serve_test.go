@@ -397,6 +397,186 @@ func TestServeMuxHandleFuncWithNilHandler(t *testing.T) {
 	mux.HandleFunc("/", nil)
 }
 
+func TestServeMuxHandlePatterns(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	h := func(s string) HandlerFunc {
+		return func(w ResponseWriter, r *Request) {
+			fmt.Fprintf(w, "%s id=%s rest=%s", s, r.PathValue("id"), r.PathValue("rest"))
+		}
+	}
+	mux.Handle("GET /items/{id}", h("get"))
+	mux.Handle("DELETE /items/{id}", h("delete"))
+	mux.Handle("GET /items/new", h("new"))
+	mux.Handle("/files/{rest...}", h("files"))
+	mux.Handle("/{$}", h("root"))
+
+	for _, tt := range []struct {
+		method, path string
+		code         int
+		pattern      string
+		body         string
+	}{
+		{"GET", "/items/7", 200, "GET /items/{id}", "get id=7 rest="},
+		{"HEAD", "/items/7", 200, "GET /items/{id}", ""},
+		{"DELETE", "/items/7", 200, "DELETE /items/{id}", "delete id=7 rest="},
+		{"GET", "/items/new", 200, "GET /items/new", "new id= rest="},
+		{"GET", "/items/a%2Fb", 200, "GET /items/{id}", "get id=a/b rest="},
+		{"GET", "/files/a/b/c", 200, "/files/{rest...}", "files id= rest=a/b/c"},
+		{"GET", "/", 200, "/{$}", "root id= rest="},
+		{"GET", "/other", 404, "", ""},
+	} {
+		u, err := url.Parse(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Request{Method: tt.method, Host: "example.com", URL: u}
+		_, pattern := mux.Handler(r)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, r)
+		if pattern != tt.pattern || rr.Code != tt.code {
+			t.Errorf("%s %s = %d, %q, want %d, %q", tt.method, tt.path, rr.Code, pattern, tt.code, tt.pattern)
+		}
+		if tt.body != "" && rr.Body.String() != tt.body {
+			t.Errorf("%s %s: body = %q, want %q", tt.method, tt.path, rr.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestServeMuxMethodNotAllowed(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(ResponseWriter, *Request) {})
+	mux.HandleFunc("PUT /items/{id}", func(ResponseWriter, *Request) {})
+
+	r := &Request{Method: "POST", Host: "example.com", URL: &url.URL{Path: "/items/1"}}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, r)
+	if rr.Code != StatusMethodNotAllowed {
+		t.Errorf("code = %d, want %d", rr.Code, StatusMethodNotAllowed)
+	}
+	if got, want := rr.Header().Get("Allow"), "GET, HEAD, PUT"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+}
+
+func TestServeMuxRegisterConflict(t *testing.T) {
+	for _, tt := range []struct {
+		p1, p2 string
+	}{
+		{"/a", "/a"},
+		{"/items/{id}", "/items/{name}"},
+		{"/a/{x}", "/{y}/b"},
+		{"GET /", "/index.html"},
+	} {
+		func() {
+			defer func() {
+				err := recover()
+				if err == nil {
+					t.Errorf("registering %q after %q: got no panic", tt.p2, tt.p1)
+					return
+				}
+				if !strings.Contains(fmt.Sprint(err), "conflicts with") {
+					t.Errorf("registering %q after %q: panic %v, want conflict", tt.p2, tt.p1, err)
+				}
+			}()
+			mux := NewServeMux()
+			mux.HandleFunc(tt.p1, func(ResponseWriter, *Request) {})
+			mux.HandleFunc(tt.p2, func(ResponseWriter, *Request) {})
+		}()
+	}
+}
+
+func TestServeMuxInvalidPattern(t *testing.T) {
+	for _, p := range []string{"GET", "/{x", "/{a...}/b", "BAD=METHOD /"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: got no panic", p)
+				}
+			}()
+			NewServeMux().HandleFunc(p, func(ResponseWriter, *Request) {})
+		}()
+	}
+}
+
+// Test that GODEBUG=httpmuxgo121=1 restores the earlier pattern syntax
+// and matching rules.
+func TestServeMux121(t *testing.T) {
+	defer SetServeMux121(true)()
+	mux := NewServeMux()
+	h := func(s string) HandlerFunc {
+		return func(w ResponseWriter, r *Request) {
+			fmt.Fprintf(w, "%s id=%s", s, r.PathValue("id"))
+		}
+	}
+	// None of these patterns is rejected, and none of them conflict.
+	for _, p := range []string{"/{id}", "/a{x}", "/images/", "/images/thumbnails/", "example.com/", "GET /", "/index.html"} {
+		mux.Handle(p, h(p))
+	}
+
+	for _, tt := range []struct {
+		method, host, path string
+		code               int
+		pattern            string
+	}{
+		{"GET", "", "/{id}", 200, "/{id}"},
+		{"GET", "", "/7", 404, ""},
+		{"GET", "", "/a{x}", 200, "/a{x}"},
+		{"GET", "", "/images/a.png", 200, "/images/"},
+		{"GET", "", "/images/thumbnails/a.png", 200, "/images/thumbnails/"},
+		{"GET", "", "/images", 301, "/images/"},
+		{"GET", "example.com", "/index.html", 200, "example.com/"},
+		{"POST", "", "/index.html", 200, "/index.html"},
+		{"GET", "", "/", 404, ""},
+	} {
+		r := &Request{Method: tt.method, Host: tt.host, URL: &url.URL{Path: tt.path}}
+		_, pattern := mux.Handler(r)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, r)
+		if pattern != tt.pattern || rr.Code != tt.code {
+			t.Errorf("%s %s%s = %d, %q, want %d, %q", tt.method, tt.host, tt.path, rr.Code, pattern, tt.code, tt.pattern)
+		}
+		if want := tt.pattern + " id="; tt.code == 200 && rr.Body.String() != want {
+			t.Errorf("%s %s%s: body = %q, want %q", tt.method, tt.host, tt.path, rr.Body.String(), want)
+		}
+	}
+
+	defer func() {
+		if err := recover(); !strings.Contains(fmt.Sprint(err), "multiple registrations") {
+			t.Errorf("registering %q twice: panic %v, want multiple registrations", "/index.html", err)
+		}
+	}()
+	mux.Handle("/index.html", h("again"))
+}
+
+func TestSetPathValue(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	mux.HandleFunc("/a/{b}/c/{d...}", func(_ ResponseWriter, r *Request) {
+		kvs := map[string]string{
+			"b": "X",
+			"d": "Y",
+			"a": "Z",
+		}
+		for k, v := range kvs {
+			r.SetPathValue(k, v)
+		}
+		for k, w := range kvs {
+			if g := r.PathValue(k); g != w {
+				t.Errorf("%q: got %q, want %q", k, g, w)
+			}
+		}
+		r2 := r.Clone(r.Context())
+		r2.SetPathValue("b", "other")
+		if g := r.PathValue("b"); g != "X" {
+			t.Errorf("after SetPathValue on clone: got %q, want %q", g, "X")
+		}
+	})
+	r := &Request{Method: "GET", URL: &url.URL{Path: "/a/b/c/d/e"}}
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+}
+
 var serveMuxTests2 = []struct {
 	method  string
 	host    string
@@ -21,6 +21,7 @@ import (
 	"log"
 	"net"
 	"net/http/httptrace"
+	"net/http/internal/quic"
 	"net/textproto"
 	"net/url"
 	"os"
@@ -280,6 +281,21 @@ type Transport struct {
 	// To use a custom dialer or TLS config and still attempt HTTP/2
 	// upgrades, set this to true.
 	ForceAttemptHTTP2 bool
+
+	// EnableHTTP3 controls whether HTTP/3 is used for https requests.
+	// If true, the Transport records HTTP/3 alternative services
+	// advertised by servers in Alt-Svc response header fields, and sends
+	// later requests to the same origin over QUIC. Requests fall back to
+	// TCP if the QUIC connection cannot be established, and the
+	// alternative is then ignored for a while.
+	// HTTP/3 is not used for requests sent through a proxy.
+	EnableHTTP3 bool
+
+	h3mu    sync.Mutex
+	h3ep    *quic.Endpoint              // shared by all HTTP/3 connections
+	h3alt   map[string]*http3AltSvc     // keyed by origin host:port
+	h3conns map[string]*http3ClientConn // keyed by QUIC address and server name
+	h3dials map[string]*http3DialCall   // in-flight dials, keyed as h3conns
 }
 
 // A cancelKey is the key of the reqCanceler map.
@@ -325,6 +341,7 @@ func (t *Transport) Clone() *Transport {
 		GetProxyConnectHeader:  t.GetProxyConnectHeader,
 		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
 		ForceAttemptHTTP2:      t.ForceAttemptHTTP2,
+		EnableHTTP3:            t.EnableHTTP3,
 		WriteBufferSize:        t.WriteBufferSize,
 		ReadBufferSize:         t.ReadBufferSize,
 	}
@@ -555,6 +572,19 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 		req.closeBody()
 		return nil, errors.New("http: no Host in request URL")
 	}
+	if t.EnableHTTP3 {
+		if resp, err := t.roundTripHTTP3(req); err != errHTTP3Unavailable {
+			if err == nil {
+				resp.Request = origReq
+			}
+			return resp, err
+		}
+		var err error
+		req, err = rewindBody(req)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	for {
 		select {
@@ -593,6 +623,7 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 		}
 		if err == nil {
 			resp.Request = origReq
+			t.recordHTTP3AltSvc(req, resp)
 			return resp, nil
 		}
 
@@ -771,6 +802,7 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.h2transport; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	t.closeIdleHTTP3Conns()
 }
 
 // CancelRequest cancels an in-flight request by closing its connection.
@@ -13,8 +13,10 @@ import (
 	"io"
 	"net"
 	"net/http/internal"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Issue 15446: incorrect wrapping of errors when server closes an idle connection.
@@ -260,3 +262,31 @@ func TestTransportBodyAltRewind(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestParseAltSvc(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  []altSvcValue
+		clear bool
+	}{
+		{in: "clear", clear: true},
+		{in: ` h3=":443"; ma=3600`, want: []altSvcValue{{"h3", ":443", time.Hour}}},
+		{
+			in: `h3-29=":443", h3="alt.example.com:8443"; persist=1, h2=":443"`,
+			want: []altSvcValue{
+				{"h3-29", ":443", 24 * time.Hour},
+				{"h3", "alt.example.com:8443", 24 * time.Hour},
+				{"h2", ":443", 24 * time.Hour},
+			},
+		},
+		{in: `h3=":443"; ma="60"; foo="a,b;c"`, want: []altSvcValue{{"h3", ":443", time.Minute}}},
+		{in: `h%33=":1"`, want: []altSvcValue{{"h3", ":1", 24 * time.Hour}}},
+		{in: `h3, h3=":1"; ma=x`, want: []altSvcValue{{"h3", ":1", 24 * time.Hour}}},
+	}
+	for _, tt := range tests {
+		got, clear := parseAltSvc(tt.in)
+		if !reflect.DeepEqual(got, tt.want) || clear != tt.clear {
+			t.Errorf("parseAltSvc(%q) = %v, %v; want %v, %v", tt.in, got, clear, tt.want, tt.clear)
+		}
+	}
+}
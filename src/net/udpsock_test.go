@@ -8,6 +8,7 @@ package net
 
 import (
 	"internal/testenv"
+	"net/netip"
 	"reflect"
 	"runtime"
 	"testing"
@@ -444,3 +445,109 @@ func TestUDPReadSizeError(t *testing.T) {
 		}
 	}
 }
+
+func TestUDPAddrPortConversion(t *testing.T) {
+	tests := []struct {
+		addr *UDPAddr
+		want netip.AddrPort
+	}{
+		{nil, netip.AddrPort{}},
+		{&UDPAddr{IP: IPv4(192, 0, 2, 1).To4(), Port: 53}, netip.MustParseAddrPort("192.0.2.1:53")},
+		{&UDPAddr{IP: IPv4(192, 0, 2, 1), Port: 53}, netip.MustParseAddrPort("[::ffff:192.0.2.1]:53")},
+		{&UDPAddr{IP: ParseIP("fe80::1"), Port: 80, Zone: "eth0"}, netip.MustParseAddrPort("[fe80::1%eth0]:80")},
+	}
+	for _, tt := range tests {
+		if got := tt.addr.AddrPort(); got != tt.want {
+			t.Errorf("%v.AddrPort() = %v; want %v", tt.addr, got, tt.want)
+		}
+		if tt.addr == nil {
+			continue
+		}
+		back := UDPAddrFromAddrPort(tt.want)
+		if !back.IP.Equal(tt.addr.IP) || back.Port != tt.addr.Port || back.Zone != tt.addr.Zone {
+			t.Errorf("UDPAddrFromAddrPort(%v) = %v; want %v", tt.want, back, tt.addr)
+		}
+		tcp := TCPAddrFromAddrPort(tt.want)
+		if got := tcp.AddrPort(); got != tt.want {
+			t.Errorf("TCPAddrFromAddrPort(%v).AddrPort() = %v; want %v", tt.want, got, tt.want)
+		}
+	}
+	if got := UDPAddrFromAddrPort(netip.AddrPort{}); got.IP != nil {
+		t.Errorf("UDPAddrFromAddrPort of zero AddrPort has IP %v; want nil", got.IP)
+	}
+}
+
+func TestUDPAddrPortReadWrite(t *testing.T) {
+	switch runtime.GOOS {
+	case "plan9":
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+
+	for _, network := range []string{"udp4", "udp6"} {
+		if !testableNetwork(network) {
+			continue
+		}
+		t.Run(network, func(t *testing.T) {
+			c, err := newLocalPacketListener(network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			conn := c.(*UDPConn)
+			ap := conn.LocalAddr().(*UDPAddr).AddrPort()
+			if network == "udp4" {
+				ap = netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+			}
+
+			msg := []byte("UDP ADDRPORT TEST")
+			buf := make([]byte, 64)
+			if _, err := conn.WriteToUDPAddrPort(msg, ap); err != nil {
+				t.Fatal(err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, from, err := conn.ReadFromUDPAddrPort(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != string(msg) {
+				t.Errorf("ReadFromUDPAddrPort read %q; want %q", buf[:n], msg)
+			}
+			if from.Port() != ap.Port() || from.Addr().Unmap() != ap.Addr().Unmap() {
+				t.Errorf("ReadFromUDPAddrPort from %v; want %v", from, ap)
+			}
+
+			if runtime.GOOS == "windows" {
+				// WSARecvMsg/WSASendMsg need more setup than this test does.
+				return
+			}
+			if _, _, err := conn.WriteMsgUDPAddrPort(msg, nil, ap); err != nil {
+				t.Fatal(err)
+			}
+			n, _, _, from, err = conn.ReadMsgUDPAddrPort(buf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != string(msg) || from.Port() != ap.Port() {
+				t.Errorf("ReadMsgUDPAddrPort read %q from %v; want %q from %v", buf[:n], from, msg, ap)
+			}
+
+			allocs := testing.AllocsPerRun(100, func() {
+				if _, err := conn.WriteToUDPAddrPort(msg, ap); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := conn.ReadFromUDPAddrPort(buf); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := conn.WriteMsgUDPAddrPort(msg, nil, ap); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, _, _, err := conn.ReadMsgUDPAddrPort(buf, nil); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if got := int(allocs); got != 0 {
+				t.Errorf("WriteTo/ReadFrom/WriteMsg/ReadMsg UDPAddrPort allocated %d objects; want 0", got)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package debug_test
 
 import (
 	"internal/testenv"
+	"math"
 	"runtime"
 	. "runtime/debug"
 	"testing"
@@ -191,3 +192,50 @@ func TestSetMaxThreadsOvf(t *testing.T) {
 	nt := SetMaxThreads(1 << (30 + ^uint(0)>>63))
 	SetMaxThreads(nt) // restore previous value
 }
+
+var setMemoryLimitSink interface{}
+
+func TestSetMemoryLimit(t *testing.T) {
+	// Test that the variable is being set and returned correctly.
+	old := SetMemoryLimit(123 << 20)
+	defer SetMemoryLimit(old)
+	if got := SetMemoryLimit(-1); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(123 MiB); SetMemoryLimit(-1) = %d, want %d", got, 123<<20)
+	}
+	if got := SetMemoryLimit(-1); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(-1) changed the limit to %d", got)
+	}
+	if got := SetMemoryLimit(math.MaxInt64); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(123 MiB); SetMemoryLimit(x) = %d, want %d", got, 123<<20)
+	}
+
+	// Test that the limit drives collection even with GOGC=off.
+	defer SetGCPercent(SetGCPercent(-1))
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC != math.MaxUint64 {
+		t.Fatalf("NextGC = %d with GOGC=off and no memory limit, want math.MaxUint64", ms.NextGC)
+	}
+	const limit = 64 << 20
+	SetMemoryLimit(limit)
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC > limit {
+		t.Errorf("NextGC = %d MB with memory limit %d MB, want at most the limit", ms.NextGC>>20, limit>>20)
+	}
+	ngc1 := ms.NumGC
+	for i := 0; i < 4*limit; i += 1 << 10 {
+		setMemoryLimitSink = make([]byte, 1<<10)
+	}
+	setMemoryLimitSink = nil
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC == ngc1 {
+		t.Errorf("expected GC to run with GOGC=off under a memory limit but it did not")
+	}
+	// The limit covers all memory mapped by the runtime, not just the
+	// heap. It is soft, so allow a little slack for memory mapped since
+	// the last GC cycle.
+	if retained := ms.Sys - ms.HeapReleased; retained > limit+limit/20 {
+		t.Errorf("runtime retained %d MB with memory limit %d MB", retained>>20, limit>>20)
+	}
+}
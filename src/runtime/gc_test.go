@@ -31,6 +31,51 @@ func TestGcSys(t *testing.T) {
 	}
 }
 
+func TestGCMemoryLimitLiveHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	got := runTestProg(t, "testprog", "GCMemoryLimitLiveHeap")
+	want := "OK\n"
+	if got != want {
+		t.Fatalf("expected %q, but got %q", want, got)
+	}
+}
+
+func TestGOMEMLIMIT(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  string
+	}{
+		{"off", "9223372036854775807\n"},
+		{"0", "0\n"},
+		{"1048576", "1048576\n"},
+		{"64MiB", "67108864\n"},
+		{"9223372036854775807B", "9223372036854775807\n"},
+	} {
+		got := runTestProg(t, "testprog", "MemoryLimitEnv", "GOMEMLIMIT="+test.value)
+		if got != test.want {
+			t.Errorf("GOMEMLIMIT=%s: got %q, want %q", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{
+		"64MB",
+		"64mib",
+		"-1",
+		"1PiB",
+		"9223372036854775808",
+		"8388608TiB",
+		"99999999999999999999",
+	} {
+		got := runTestProg(t, "testprog", "MemoryLimitEnv", "GOMEMLIMIT="+value)
+		want := "GOMEMLIMIT=" + value + "\nfatal error: malformed GOMEMLIMIT"
+		if !strings.HasPrefix(got, want) {
+			t.Errorf("GOMEMLIMIT=%s: got %q, want prefix %q", value, got, want)
+		}
+	}
+}
+
 func TestGcDeepNesting(t *testing.T) {
 	type T [2][2][2][2][2][2][2][2][2][2]*int
 	a := new(T)
@@ -169,6 +169,12 @@ const defaultHeapMinimum = 4 << 20
 // Initialized from $GOGC.  GOGC=off means no GC.
 var gcpercent int32
 
+// memoryLimit is the soft limit on the total amount of memory managed
+// by the Go runtime, in bytes. maxInt64 means no limit.
+//
+// Initialized from $GOMEMLIMIT. Protected by mheap_.lock.
+var memoryLimit int64 = maxInt64
+
 func gcinit() {
 	if unsafe.Sizeof(workbuf{}) != _WorkbufSize {
 		throw("size of Workbuf is suboptimal")
@@ -185,8 +191,9 @@ func gcinit() {
 	// This will go into computing the initial GC goal.
 	memstats.heap_marked = uint64(float64(heapminimum) / (1 + memstats.triggerRatio))
 
-	// Set gcpercent from the environment. This will also compute
-	// and set the GC trigger and goal.
+	// Set the memory limit and gcpercent from the environment. The
+	// latter will also compute and set the GC trigger and goal.
+	memoryLimit = readGOMEMLIMIT()
 	_ = setGCPercent(readgogc())
 
 	work.startSema = 1
@@ -207,6 +214,19 @@ func readgogc() int32 {
 	return 100
 }
 
+func readGOMEMLIMIT() int64 {
+	p := gogetenv("GOMEMLIMIT")
+	if p == "" || p == "off" {
+		return maxInt64
+	}
+	n, ok := parseByteCount(p)
+	if !ok {
+		print("GOMEMLIMIT=", p, "\n")
+		throw("malformed GOMEMLIMIT; see `go doc runtime/debug.SetMemoryLimit`")
+	}
+	return n
+}
+
 // gcenable is called after the bulk of the runtime initialization,
 // just before we're about to start letting user code run.
 // It kicks off the background sweeper goroutine, the background
@@ -246,6 +266,23 @@ func setGCPercent(in int32) (out int32) {
 	return out
 }
 
+//go:linkname setMemoryLimit runtime/debug.setMemoryLimit
+func setMemoryLimit(in int64) (out int64) {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		out = memoryLimit
+		// A negative limit just queries the current one.
+		if in >= 0 {
+			memoryLimit = in
+			// Update pacing in response to the memory limit change.
+			gcSetTriggerRatio(memstats.triggerRatio)
+		}
+		unlock(&mheap_.lock)
+	})
+	return out
+}
+
 // Garbage collector phase.
 // Indicates to write barrier and synchronization task to perform.
 var gcphase uint32
@@ -816,7 +853,7 @@ func pollFractionalWorkerExit() bool {
 // This can be called any time. If GC is the in the middle of a
 // concurrent phase, it will adjust the pacing of that phase.
 //
-// This depends on gcpercent, memstats.heap_marked, and
+// This depends on gcpercent, memoryLimit, memstats.heap_marked, and
 // memstats.heap_live. These must be up to date.
 //
 // mheap_.lock must be held or the world must be stopped.
@@ -903,6 +940,23 @@ func gcSetTriggerRatio(triggerRatio float64) {
 		}
 	}
 
+	// If there is a memory limit, don't let the heap grow past what
+	// fits under it. This applies even if GOGC=off.
+	if limitGoal := memoryLimitHeapGoal(); limitGoal < goal {
+		goal = limitGoal
+		// Leave the mutator some runway to allocate into while
+		// the cycle runs. If the live heap alone already exceeds
+		// the goal, there's nothing to leave, so trigger right
+		// away and let gcCPULimiter keep this from spiraling.
+		maxTrigger := goal
+		if goal > memstats.heap_marked {
+			maxTrigger = memstats.heap_marked + (goal-memstats.heap_marked)*7/10
+		}
+		if trigger > maxTrigger {
+			trigger = maxTrigger
+		}
+	}
+
 	// Commit to the trigger and goal.
 	memstats.gc_trigger = trigger
 	atomic.Store64(&memstats.next_gc, goal)
@@ -1724,6 +1778,13 @@ func gcMarkTermination(nextTriggerRatio float64) {
 	totalCpu := sched.totaltime + (now-sched.procresizetime)*int64(gomaxprocs)
 	memstats.gc_cpu_fraction = float64(work.totaltime) / float64(totalCpu)
 
+	// Feed this cycle to the death spiral guard. If that changes
+	// whether the memory limit may hold the heap goal down,
+	// recompute the trigger and goal for the next cycle.
+	if gcCPULimiter.update(cycleCpu, totalCpu) {
+		gcSetTriggerRatio(memstats.triggerRatio)
+	}
+
 	// Reset sweep state.
 	sweep.nbgsweep = 0
 	sweep.npausesweep = 0
@@ -0,0 +1,150 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Memory limit.
+//
+// The memory limit (memoryLimit, set by GOMEMLIMIT or
+// runtime/debug.SetMemoryLimit) is a soft cap on the total amount of
+// memory mapped by the Go runtime: the heap, goroutine stacks, and
+// runtime metadata. It is enforced on two fronts:
+//
+// 1. The pacer caps the heap goal at the limit less the memory mapped
+//    for everything but the heap (see memoryLimitHeapGoal), so the GC
+//    runs more often as total memory use approaches the limit.
+//
+// 2. The scavenger caps the retained heap at retainLimitPercent of the
+//    limit less that same overhead (see memoryLimitRetainedGoal), so
+//    memory freed by the GC is returned to the OS instead of
+//    lingering as fragmentation.
+//
+// A limit that is too small for the program's live heap would make
+// the GC run continuously, a "death spiral" in which the program makes
+// little progress. gcCPULimiter guards against that by letting the
+// heap grow past the limit once the GC has been using too much CPU.
+
+package runtime
+
+import "runtime/internal/atomic"
+
+const (
+	// retainLimitPercent is the portion of the memory limit, less
+	// non-heap overhead, that the scavenger allows the heap to retain.
+	// The rest is headroom for non-heap memory growth between GC cycles.
+	retainLimitPercent = 95
+
+	// gcCPULimiterCapacity is the capacity of gcCPULimiter's bucket
+	// in nanoseconds of CPU time per P.
+	gcCPULimiterCapacity = 1e9
+)
+
+// nonHeapSys returns the number of bytes of memory the runtime has
+// mapped for purposes other than the GC'd heap.
+func nonHeapSys() uint64 {
+	return memstats.stacks_sys.load() + memstats.mspan_sys.load() +
+		memstats.mcache_sys.load() + memstats.buckhash_sys.load() +
+		memstats.gcMiscSys.load() + memstats.other_sys.load() +
+		atomic.Load64(&memstats.manual_inuse)
+}
+
+// memoryLimitHeapGoal returns the heap goal implied by the memory limit,
+// or ^uint64(0) if there is no memory limit.
+//
+// While gcCPULimiter is limiting, the goal is raised to at least what
+// GOGC=100 would give, so the cost of each cycle is amortized over
+// enough allocation to keep the GC's CPU use bounded.
+//
+// mheap_.lock must be held or the world must be stopped.
+func memoryLimitHeapGoal() uint64 {
+	assertWorldStoppedOrLockHeld(&mheap_.lock)
+
+	if memoryLimit == maxInt64 {
+		return ^uint64(0)
+	}
+	goal := uint64(0)
+	if limit, overhead := uint64(memoryLimit), nonHeapSys(); limit > overhead {
+		goal = limit - overhead
+	}
+	if gcCPULimiter.limiting {
+		min := memstats.heap_marked * 2
+		if min < defaultHeapMinimum {
+			min = defaultHeapMinimum
+		}
+		if goal < min {
+			goal = min
+		}
+	}
+	return goal
+}
+
+// memoryLimitRetainedGoal returns the scavenger's retained heap goal
+// implied by the memory limit, or ^uint64(0) if there is no memory limit.
+//
+// mheap_.lock must be held or the world must be stopped.
+func memoryLimitRetainedGoal() uint64 {
+	assertWorldStoppedOrLockHeld(&mheap_.lock)
+
+	if memoryLimit == maxInt64 {
+		return ^uint64(0)
+	}
+	limit := uint64(memoryLimit) / 100 * retainLimitPercent
+	if overhead := nonHeapSys(); limit > overhead {
+		return limit - overhead
+	}
+	return 0
+}
+
+// gcCPULimiter is a leaky bucket of GC CPU time that guards against
+// GC death spirals under a memory limit.
+//
+// CPU time spent in the GC fills the bucket and CPU time left to the
+// mutator drains it. When the bucket fills up, the GC has been using
+// more than half of the available CPU for a sustained period, and the
+// limiter starts limiting: the memory limit may no longer hold the heap
+// goal below memoryLimitHeapGoal's floor. It stops limiting once the
+// bucket has drained to half full.
+//
+// The bucket is only updated at the end of each GC cycle, with the
+// world stopped.
+var gcCPULimiter gcCPULimiterState
+
+type gcCPULimiterState struct {
+	// fill is the amount of GC CPU time in the bucket, in nanoseconds.
+	fill int64
+
+	// lastTotal is the total CPU time available to the program as of
+	// the last update, in nanoseconds.
+	lastTotal int64
+
+	// limiting indicates whether the limiter is in effect.
+	limiting bool
+}
+
+// update accounts for a GC cycle that used gcTime nanoseconds of CPU
+// time, where totalTime is the total CPU time that has been available
+// to the program since it started. It reports whether the limiting
+// state changed.
+//
+// The world must be stopped.
+func (l *gcCPULimiterState) update(gcTime, totalTime int64) bool {
+	assertWorldStopped()
+
+	mutatorTime := totalTime - l.lastTotal - gcTime
+	l.lastTotal = totalTime
+	l.fill += gcTime - mutatorTime
+	if l.fill < 0 {
+		l.fill = 0
+	}
+	capacity := int64(gomaxprocs) * gcCPULimiterCapacity
+	if l.fill > capacity {
+		l.fill = capacity
+	}
+
+	was := l.limiting
+	if l.fill == capacity {
+		l.limiting = true
+	} else if l.fill <= capacity/2 {
+		l.limiting = false
+	}
+	return l.limiting != was
+}
@@ -107,7 +107,8 @@ func heapRetained() uint64 {
 // its rate and RSS goal.
 //
 // The RSS goal is based on the current heap goal with a small overhead
-// to accommodate non-determinism in the allocator.
+// to accommodate non-determinism in the allocator, capped by the
+// memory limit.
 //
 // The pacing is based on scavengePageRate, which applies to both regular and
 // huge pages. See that constant for more information.
@@ -130,6 +131,10 @@ func gcPaceScavenger() {
 	// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
 	// that also avoids the overflow from a multiplication.
 	retainedGoal += retainedGoal / (1.0 / (retainExtraPercent / 100.0))
+	// Don't retain more than fits under the memory limit, if any.
+	if limitGoal := memoryLimitRetainedGoal(); limitGoal < retainedGoal {
+		retainedGoal = limitGoal
+	}
 	// Align it to a physical page boundary to make the following calculations
 	// a bit more exact.
 	retainedGoal = (retainedGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
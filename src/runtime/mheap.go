@@ -1278,6 +1278,7 @@ HaveSpan:
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys.
 		memstats.heap_sys.add(-int64(nbytes))
+		atomic.Xadd64(&memstats.manual_inuse, int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -1469,6 +1470,7 @@ func (h *mheap) freeSpanLocked(s *mspan, typ spanAllocType) {
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys, so add it back.
 		memstats.heap_sys.add(int64(nbytes))
+		atomic.Xadd64(&memstats.manual_inuse, -int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -344,6 +344,8 @@ const (
 	maxInt  = int(maxUint >> 1)
 )
 
+const maxInt64 = int64(^uint64(0) >> 1)
+
 // atoi parses an int from a string s.
 // The bool result reports whether s is a number
 // representable by a value of type int.
@@ -401,6 +403,62 @@ func atoi32(s string) (int32, bool) {
 	return 0, false
 }
 
+// parseByteCount parses a string that represents a count of bytes.
+//
+// s must be a non-negative decimal integer, optionally followed by one
+// of the unit suffixes B, KiB, MiB, GiB, or TiB. The binary suffixes
+// are multiples of 1024 in the IEC sense, so "1KiB" is 1024 bytes.
+//
+// The bool result reports whether s is well-formed and its value
+// fits in an int64.
+func parseByteCount(s string) (int64, bool) {
+	// Strip the unit suffix, if any.
+	mult := uint64(1)
+	if len(s) > 0 && s[len(s)-1] == 'B' {
+		s = s[:len(s)-1]
+		if len(s) >= 2 && s[len(s)-1] == 'i' {
+			switch s[len(s)-2] {
+			case 'K':
+				mult = 1 << 10
+			case 'M':
+				mult = 1 << 20
+			case 'G':
+				mult = 1 << 30
+			case 'T':
+				mult = 1 << 40
+			default:
+				return 0, false
+			}
+			s = s[:len(s)-2]
+		}
+	}
+	if s == "" {
+		return 0, false
+	}
+
+	n := uint64(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if n > uint64(maxInt64)/10 {
+			// overflow
+			return 0, false
+		}
+		n = n*10 + uint64(c-'0')
+		if n > uint64(maxInt64) {
+			// overflow
+			return 0, false
+		}
+	}
+	if n > uint64(maxInt64)/mult {
+		// overflow
+		return 0, false
+	}
+	return int64(n * mult), true
+}
+
 //go:nosplit
 func findnull(s *byte) int {
 	if s == nil {
@@ -454,3 +454,51 @@ func TestAtoi32(t *testing.T) {
 		}
 	}
 }
+
+type parseByteCountTest struct {
+	in  string
+	out int64
+	ok  bool
+}
+
+var parseByteCountTests = []parseByteCountTest{
+	{"", 0, false},
+	{"0", 0, true},
+	{"0B", 0, true},
+	{"1", 1, true},
+	{"1B", 1, true},
+	{"12345", 12345, true},
+	{"1KiB", 1 << 10, true},
+	{"64MiB", 64 << 20, true},
+	{"2GiB", 2 << 30, true},
+	{"3TiB", 3 << 40, true},
+	{"9223372036854775807", 1<<63 - 1, true},
+	{"9223372036854775807B", 1<<63 - 1, true},
+	{"9223372036854775808", 0, false},
+	{"8388607TiB", 8388607 << 40, true},
+	{"8388608TiB", 0, false},
+	{"18446744073709551616", 0, false},
+	{"99999999999999999999", 0, false},
+	{"9007199254740992KiB", 0, false},
+	{"-1", 0, false},
+	{"B", 0, false},
+	{"KiB", 0, false},
+	{"1K", 0, false},
+	{"1KB", 0, false},
+	{"1kiB", 0, false},
+	{"1PiB", 0, false},
+	{"1iB", 0, false},
+	{"1 MiB", 0, false},
+	{"1MiBB", 0, false},
+	{"off", 0, false},
+}
+
+func TestParseByteCount(t *testing.T) {
+	for _, test := range parseByteCountTests {
+		out, ok := runtime.ParseByteCount(test.in)
+		if test.out != out || test.ok != ok {
+			t.Errorf("parseByteCount(%q) = (%v, %v) want (%v, %v)",
+				test.in, out, ok, test.out, test.ok)
+		}
+	}
+}
@@ -21,6 +21,8 @@ func init() {
 	register("GCPhys", GCPhys)
 	register("DeferLiveness", DeferLiveness)
 	register("GCZombie", GCZombie)
+	register("GCMemoryLimitLiveHeap", GCMemoryLimitLiveHeap)
+	register("MemoryLimitEnv", MemoryLimitEnv)
 }
 
 func GCSys() {
@@ -300,3 +302,55 @@ func GCZombie() {
 	runtime.KeepAlive(keep)
 	runtime.KeepAlive(zombies)
 }
+
+// MemoryLimitEnv prints the memory limit, as set by GOMEMLIMIT.
+func MemoryLimitEnv() {
+	fmt.Println(debug.SetMemoryLimit(-1))
+}
+
+type memoryLimitNode struct {
+	next  *memoryLimitNode
+	value int
+}
+
+// GCMemoryLimitLiveHeap keeps a live heap larger than the memory limit, with
+// GOGC=off. The GC then runs back to back, until the GC CPU limiter engages
+// and raises the heap goal to twice the live heap.
+func GCMemoryLimitLiveHeap() {
+	runtime.GOMAXPROCS(1)
+	debug.SetGCPercent(-1)
+	const limit = 8 << 20
+	debug.SetMemoryLimit(limit)
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC > limit {
+		fmt.Printf("heap goal is %d bytes with memory limit %d bytes before the heap grew\n", ms.NextGC, limit)
+		return
+	}
+
+	// About 32 MiB of small pointerful objects, which are expensive to mark.
+	var live *memoryLimitNode
+	for i := 0; i < 2<<20; i++ {
+		live = &memoryLimitNode{next: live, value: i}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	liveHeap := ms.HeapAlloc
+
+	// While a cycle runs, the heap goal may be a little above the live
+	// heap, but only the limiter raises it well past it.
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		for i := 0; i < 1000; i++ {
+			workthegc()
+		}
+		runtime.ReadMemStats(&ms)
+		if ms.NextGC >= liveHeap/2*3 {
+			runtime.KeepAlive(live)
+			fmt.Println("OK")
+			return
+		}
+	}
+	runtime.KeepAlive(live)
+	fmt.Printf("heap goal stayed at %d bytes with a live heap of %d bytes after %d GCs\n", ms.NextGC, liveHeap, ms.NumGC)
+}
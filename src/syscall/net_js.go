@@ -91,18 +91,50 @@ func Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
 	return 0, nil, ENOSYS
 }
 
+func RecvfromInet4(fd int, p []byte, flags int, from *SockaddrInet4) (n int, err error) {
+	return 0, ENOSYS
+}
+
+func RecvfromInet6(fd int, p []byte, flags int, from *SockaddrInet6) (n int, err error) {
+	return 0, ENOSYS
+}
+
 func Sendto(fd int, p []byte, flags int, to Sockaddr) error {
 	return ENOSYS
 }
 
+func SendtoInet4(fd int, p []byte, flags int, to *SockaddrInet4) error {
+	return ENOSYS
+}
+
+func SendtoInet6(fd int, p []byte, flags int, to *SockaddrInet6) error {
+	return ENOSYS
+}
+
 func Recvmsg(fd int, p, oob []byte, flags int) (n, oobn, recvflags int, from Sockaddr, err error) {
 	return 0, 0, 0, nil, ENOSYS
 }
 
+func RecvmsgInet4(fd int, p, oob []byte, flags int, from *SockaddrInet4) (n, oobn, recvflags int, err error) {
+	return 0, 0, 0, ENOSYS
+}
+
+func RecvmsgInet6(fd int, p, oob []byte, flags int, from *SockaddrInet6) (n, oobn, recvflags int, err error) {
+	return 0, 0, 0, ENOSYS
+}
+
 func SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
 	return 0, ENOSYS
 }
 
+func SendmsgNInet4(fd int, p, oob []byte, to *SockaddrInet4, flags int) (n int, err error) {
+	return 0, ENOSYS
+}
+
+func SendmsgNInet6(fd int, p, oob []byte, to *SockaddrInet6, flags int) (n int, err error) {
+	return 0, ENOSYS
+}
+
 func GetsockoptInt(fd, level, opt int) (value int, err error) {
 	return 0, ENOSYS
 }